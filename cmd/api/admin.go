@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runCreateAdmin implements the "create-admin" subcommand, which bootstraps
+// the first admin since admins can not register themselves. The password is
+// read from the first line of stdin so it stays out of the shell history. An
+// existing user of the organization is promoted and reactivated instead.
+func runCreateAdmin(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	username := flags.String("username", "", "Username of the admin")
+	email := flags.String("email", "", "Optional email address of the admin")
+	org := flags.String("org", "default", "Slug of the organization the admin manages")
+	flags.Parse(args)
+
+	if *username == "" {
+		fmt.Fprintln(os.Stderr, "Usage: echo <password> | api create-admin --username <name> [--email <address>] [--org <slug>]")
+		os.Exit(2)
+	}
+	if cfg.Storage != "mysql" {
+		log.Fatalf("create-admin needs mysql storage, %s storage does not persist users", cfg.Storage)
+	}
+
+	db := openDatabase(cfg.Database)
+	defer db.Close()
+	users := repository.NewMySQLUserRepository(db)
+	ctx := context.Background()
+
+	organization, err := repository.NewMySQLOrganizationRepository(db).GetBySlug(ctx, *org)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Fatalf("Unknown organization %q, create it with create-org first", *org)
+	} else if err != nil {
+		log.Fatalf("Error looking up organization %s: %v", *org, err)
+	}
+
+	existing, err := users.GetByUsername(ctx, *username)
+	if err == nil {
+		if existing.OrganizationID != organization.ID {
+			log.Fatalf("User %s belongs to another organization", *username)
+		}
+		if err := users.UpdateRole(ctx, existing.ID, models.RoleAdmin); err != nil {
+			log.Fatalf("Error promoting %s: %v", *username, err)
+		}
+		if err := users.SetActive(ctx, existing.ID, true); err != nil {
+			log.Fatalf("Error reactivating %s: %v", *username, err)
+		}
+		fmt.Printf("Promoted user %d (%s) to admin\n", existing.ID, *username)
+		return
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		log.Fatalf("Error looking up %s: %v", *username, err)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Fatalf("Error reading the password from stdin: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatal("The password must be given on stdin")
+	}
+	if err := passwordPolicy(cfg.Auth.Password).Check(password, *username); err != nil {
+		log.Fatalf("Refusing the password: %v", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatalf("Error hashing password: %v", err)
+	}
+	admin := models.User{OrganizationID: organization.ID, Username: *username, Email: *email,
+		Password: string(hash), Role: models.RoleAdmin}
+	if err := users.Create(ctx, &admin); err != nil {
+		log.Fatalf("Error creating %s: %v", *username, err)
+	}
+	fmt.Printf("Created admin %d (%s) of organization %s\n", admin.ID, *username, organization.Slug)
+}
+
+// runCreateOrganization implements the "create-org" subcommand. The new
+// organization is invite only until its admin opens registration.
+func runCreateOrganization(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("create-org", flag.ExitOnError)
+	slug := flags.String("slug", "", "Slug of the organization, lower case letters, digits and dashes")
+	name := flags.String("name", "", "Display name of the organization, the slug when empty")
+	flags.Parse(args)
+
+	if !models.ValidSlug(*slug) {
+		fmt.Fprintln(os.Stderr, "Usage: api create-org --slug <slug> [--name <name>]")
+		os.Exit(2)
+	}
+	if *name == "" {
+		*name = *slug
+	}
+	if cfg.Storage != "mysql" {
+		log.Fatalf("create-org needs mysql storage, %s storage does not persist organizations", cfg.Storage)
+	}
+
+	db := openDatabase(cfg.Database)
+	defer db.Close()
+
+	organization := models.Organization{Slug: *slug, Name: *name}
+	err := repository.NewMySQLOrganizationRepository(db).Create(context.Background(), &organization)
+	if errors.Is(err, repository.ErrDuplicate) {
+		log.Fatalf("Organization %s already exists", *slug)
+	} else if err != nil {
+		log.Fatalf("Error creating organization %s: %v", *slug, err)
+	}
+	fmt.Printf("Created organization %d (%s)\n", organization.ID, *slug)
+}
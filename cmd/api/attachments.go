@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/blob"
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// blobDeletionBatch is the number of queued blobs deleted per round
+const blobDeletionBatch = 100
+
+// buildBlobStore creates the store keeping the content of attachments
+func buildBlobStore(cfg config.Attachments) blob.BlobStore {
+	if cfg.Store != "s3" {
+		return blob.NewFileStore(cfg.Dir)
+	}
+
+	store, err := blob.NewS3Store(blob.S3Config{
+		Endpoint:        cfg.S3.Endpoint,
+		Region:          cfg.S3.Region,
+		Bucket:          cfg.S3.Bucket,
+		AccessKeyID:     cfg.S3.AccessKeyID,
+		SecretAccessKey: cfg.S3.SecretAccessKey.Value(),
+		PathStyle:       cfg.S3.PathStyle,
+	})
+	if err != nil {
+		log.Fatalf("Error configuring the attachment store: %v", err)
+	}
+	return store
+}
+
+// attachmentURLSecret returns the key download links are signed with. Without
+// one a random key is generated, so links do not survive a restart and are
+// only honoured by the replica that issued them.
+func attachmentURLSecret(cfg config.Attachments, appLogger *logger.Logger) []byte {
+	if cfg.URLSecret != "" {
+		return []byte(cfg.URLSecret.Value())
+	}
+
+	appLogger.LogWarn("No ATTACHMENTS_URL_SECRET configured, generating a random one; download links will not survive a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Error generating the attachment URL secret: %v", err)
+	}
+	return secret
+}
+
+// purgeDeletedBlobs periodically deletes the blobs of removed attachments and
+// tasks from the store. Blobs that could not be deleted stay queued for the
+// next round.
+func purgeDeletedBlobs(ctx context.Context, attachments repository.AttachmentRepository, blobs blob.BlobStore, appLogger *logger.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			keys, err := attachments.PendingBlobDeletions(ctx, blobDeletionBatch)
+			if err != nil {
+				if ctx.Err() == nil {
+					appLogger.LogError(err, "Failed to load the blobs to delete")
+				}
+				break
+			}
+
+			deleted := make([]string, 0, len(keys))
+			for _, key := range keys {
+				if err := blobs.Delete(ctx, key); err != nil {
+					if ctx.Err() == nil {
+						appLogger.LogError(err, "Failed to delete blob "+key)
+					}
+					continue
+				}
+				deleted = append(deleted, key)
+			}
+			if err := attachments.ForgetBlobDeletions(ctx, deleted); err != nil {
+				if ctx.Err() == nil {
+					appLogger.LogError(err, "Failed to forget deleted blobs")
+				}
+				break
+			}
+			if len(deleted) > 0 {
+				appLogger.LogInfo("Deleted %d blobs of removed attachments", len(deleted))
+			}
+
+			// Keep going while full batches are deleted, leave failures for the next round
+			if len(keys) < blobDeletionBatch || len(deleted) < len(keys) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
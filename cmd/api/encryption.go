@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// loadKeyring builds the task summary keyring from TASK_SUMMARY_KEYS, a comma
+// separated list of id:base64key pairs, and TASK_SUMMARY_PRIMARY_KEY, the ID
+// of the key new summaries are encrypted with. It returns nil when no keys are
+// configured, which leaves summaries unencrypted.
+func loadKeyring(cfg config.Encryption) *encryption.Keyring {
+	spec := cfg.TaskSummaryKeys.Value()
+	if spec == "" {
+		return nil
+	}
+
+	keys, err := encryption.ParseKeys(spec)
+	if err != nil {
+		log.Fatalf("Error parsing TASK_SUMMARY_KEYS: %v", err)
+	}
+
+	keyring, err := encryption.NewKeyring(cfg.TaskSummaryPrimaryKey, keys)
+	if err != nil {
+		log.Fatalf("Error loading task summary keys: %v", err)
+	}
+	return keyring
+}
+
+// runRotateKeys implements the "rotate-keys" subcommand, which re-encrypts
+// every task and schedule summary and TOTP secret that is not yet encrypted
+// with the primary key
+func runRotateKeys(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", 100, "Number of rows re-encrypted per transaction")
+	flags.Parse(args)
+
+	if *batchSize <= 0 {
+		log.Fatalf("--batch-size must be positive")
+	}
+
+	keyring := loadKeyring(cfg.Encryption)
+	if keyring == nil {
+		log.Fatalf("TASK_SUMMARY_KEYS is required to rotate keys")
+	}
+
+	db := openDatabase(cfg.Database)
+	defer db.Close()
+
+	tasks := repository.NewMySQLTaskRepository(db, repository.WithSummaryEncryption(keyring))
+	total, err := tasks.RotateSummaryKeys(context.Background(), *batchSize, func(rotated int) {
+		fmt.Printf("Re-encrypted %d summaries\n", rotated)
+	})
+	if err != nil {
+		log.Fatalf("Error rotating keys after %d summaries: %v", total, err)
+	}
+
+	schedules := repository.NewMySQLScheduleRepository(db, keyring)
+	scheduleSummaries, err := schedules.RotateSummaryKeys(context.Background(), *batchSize, func(rotated int) {
+		fmt.Printf("Re-encrypted %d schedule summaries\n", rotated)
+	})
+	if err != nil {
+		log.Fatalf("Error rotating keys after %d schedule summaries: %v", scheduleSummaries, err)
+	}
+
+	mfa := repository.NewMySQLMFARepository(db, keyring)
+	secrets, err := mfa.RotateSecretKeys(context.Background(), *batchSize, func(rotated int) {
+		fmt.Printf("Re-encrypted %d TOTP secrets\n", rotated)
+	})
+	if err != nil {
+		log.Fatalf("Error rotating keys after %d TOTP secrets: %v", secrets, err)
+	}
+	fmt.Printf("Done, %d task summaries, %d schedule summaries and %d TOTP secrets are now encrypted with key %s\n",
+		total, scheduleSummaries, secrets, keyring.PrimaryKeyID())
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/logger"
+)
+
+// buildPublisher creates the task event publisher selected by EVENTS_PUBLISHER
+// (none, inprocess or amqp). The returned function releases its resources.
+func buildPublisher(cfg config.Events, appLogger *logger.Logger) (events.Publisher, func()) {
+	switch cfg.Publisher {
+	case "", "none":
+		return events.NopPublisher{}, func() {}
+	case "inprocess":
+		publisher := events.NewInProcessPublisher()
+		publisher.Subscribe(func(event events.Envelope) {
+			appLogger.LogInfo("Task event %s published: %s", event.ID, event.Type)
+		})
+		return events.NewRetryPublisher(publisher, 1, 0), func() {}
+	case "amqp":
+		publisher, err := events.NewAMQPPublisher(cfg.AMQPURL.Value(), cfg.AMQPExchange)
+		if err != nil {
+			log.Fatalf("Error connecting to the message broker: %v", err)
+		}
+		closePublisher := func() {
+			if err := publisher.Close(); err != nil {
+				appLogger.LogError(err, "Failed to close the message broker connection")
+			}
+		}
+		// Failed events stay in the outbox and are retried by the relay
+		return events.NewRetryPublisher(publisher, 1, 0), closePublisher
+	default:
+		log.Fatalf("Unknown event publisher %q, must be one of 'none', 'inprocess' or 'amqp'", cfg.Publisher)
+		return nil, nil
+	}
+}
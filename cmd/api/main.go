@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
-	"net/http"
 	"os"
+	"time"
+	// Schedule time zones must resolve in minimal images without a zoneinfo database
+	_ "time/tzdata"
 
 	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/events"
 	"github.com/makcim392/maintenance-api/internal/health"
 	"github.com/makcim392/maintenance-api/internal/logger"
 	"github.com/makcim392/maintenance-api/internal/metrics"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/notify"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/schedule"
 	"github.com/makcim392/maintenance-api/internal/server"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -21,57 +34,112 @@ import (
 )
 
 func main() {
-	// Load default.env for base configuration
-	err := godotenv.Load("default.env")
-	if err != nil {
-		log.Fatalf("Error loading default.env file: %v", err)
+	// Variables from the environment win over .env, which wins over default.env
+	cfg, args, err := config.Load(os.Args[1:], envLookup(".env", "default.env"))
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	// Load .env to override default.env
-	err = godotenv.Overload(".env")
 	if err != nil {
-		log.Printf("No .env file found or failed to load it: %v", err)
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	// Get application environment
-	appEnv := os.Getenv("APP_ENV")
-	if appEnv == "" {
-		appEnv = "prod" // Default to production if not set
+	// Subcommands
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			runMigrate(cfg, args[1:])
+		case "rotate-keys":
+			runRotateKeys(cfg, args[1:])
+		case "create-admin":
+			runCreateAdmin(cfg, args[1:])
+		case "create-org":
+			runCreateOrganization(cfg, args[1:])
+		case "config":
+			// Print the effective configuration with secrets redacted
+			fmt.Print(cfg)
+		default:
+			log.Fatalf("Unknown command %q, must be one of 'migrate', 'rotate-keys', 'create-admin', 'create-org' or 'config'", args[0])
+		}
+		return
 	}
 
-	// Get database connection details from environment variables
-	dbHost := os.Getenv("DB_HOST")
+	// Task summaries are encrypted at rest when keys are configured
+	keyring := loadKeyring(cfg.Encryption)
 
-	dbPort := "3306" // Default to container port
-	if appEnv == "dev" {
-		dbHost = os.Getenv("DEV_DB_HOST")
-		dbPort = os.Getenv("DEV_DB_PORT")
-	}
+	var db *sql.DB
+	var taskRepo repository.TaskRepository
+	var userRepo repository.UserRepository
+	var assetRepo repository.AssetRepository
+	var scheduleRepo repository.ScheduleRepository
+	var outboxRepo repository.OutboxRepository
+	var tokenRepo repository.TokenRepository
+	var permissionRepo repository.PermissionRepository
+	var invitationRepo repository.InvitationRepository
+	var teamRepo repository.TeamRepository
+	var organizationRepo repository.OrganizationRepository
+	var attemptRepo repository.LoginAttemptRepository
+	var mfaRepo repository.MFARepository
+	var resetRepo repository.PasswordResetRepository
+	var apiKeyRepo repository.APIKeyRepository
+	var identityRepo repository.IdentityRepository
+	var commentRepo repository.CommentRepository
+	var attachmentRepo repository.AttachmentRepository
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
+	switch cfg.Storage {
+	case "mysql":
+		db = openDatabase(cfg.Database)
+		defer db.Close()
 
-	// Default to local port for debugging if not set
-	if dbPort == "" {
-		dbPort = "3307"
-	}
-
-	// Construct DSN and connect to the database
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", dbUser, dbPassword, dbHost, dbPort, dbName)
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
-	}
-	defer db.Close()
+		// Apply pending migrations before serving requests when requested
+		if cfg.Database.AutoMigrate {
+			applyMigrations(db)
+		}
 
-	// Test database connection
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Error pinging database: %v", err)
+		taskRepo = repository.NewMySQLTaskRepository(db, repository.WithSummaryEncryption(keyring))
+		userRepo = repository.NewMySQLUserRepository(db)
+		assetRepo = repository.NewMySQLAssetRepository(db)
+		scheduleRepo = repository.NewMySQLScheduleRepository(db, keyring)
+		outboxRepo = repository.NewMySQLOutboxRepository(db)
+		tokenRepo = repository.NewMySQLTokenRepository(db)
+		permissionRepo = repository.NewMySQLPermissionRepository(db)
+		invitationRepo = repository.NewMySQLInvitationRepository(db)
+		teamRepo = repository.NewMySQLTeamRepository(db)
+		organizationRepo = repository.NewMySQLOrganizationRepository(db)
+		attemptRepo = repository.NewMySQLLoginAttemptRepository(db)
+		// TOTP secrets are encrypted with the task summary keys
+		mfaRepo = repository.NewMySQLMFARepository(db, keyring)
+		resetRepo = repository.NewMySQLPasswordResetRepository(db)
+		apiKeyRepo = repository.NewMySQLAPIKeyRepository(db)
+		identityRepo = repository.NewMySQLIdentityRepository(db)
+		commentRepo = repository.NewMySQLCommentRepository(db)
+		attachmentRepo = repository.NewMySQLAttachmentRepository(db)
+	case "memory":
+		// In-memory storage for local development, data is lost on restart
+		users := repository.NewMemoryUserRepository()
+		tasks := repository.NewMemoryTaskRepository(users)
+		taskRepo = tasks
+		userRepo = users
+		assetRepo = repository.NewMemoryAssetRepository(tasks)
+		scheduleRepo = repository.NewMemoryScheduleRepository(users)
+		outboxRepo = tasks.Outbox()
+		tokenRepo = repository.NewMemoryTokenRepository()
+		permissionRepo = repository.NewMemoryPermissionRepository()
+		invitationRepo = repository.NewMemoryInvitationRepository(users)
+		teamRepo = repository.NewMemoryTeamRepository(users)
+		organizationRepo = repository.NewMemoryOrganizationRepository()
+		attemptRepo = repository.NewMemoryLoginAttemptRepository()
+		mfaRepo = repository.NewMemoryMFARepository()
+		resetRepo = repository.NewMemoryPasswordResetRepository()
+		apiKeyRepo = repository.NewMemoryAPIKeyRepository()
+		identityRepo = repository.NewMemoryIdentityRepository(users)
+		commentRepo = repository.NewMemoryCommentRepository(tasks)
+		attachmentRepo = repository.NewMemoryAttachmentRepository(tasks)
+	default:
+		log.Fatalf("Unknown storage backend %q, must be either 'mysql' or 'memory'", cfg.Storage)
 	}
 
 	// Initialize logger
-	appLogger := logger.New()
+	appLogger := logger.NewFromConfig(cfg.Log)
 
 	// Create router
 	router := mux.NewRouter()
@@ -80,41 +148,276 @@ func main() {
 	router.Use(middleware.LoggingMiddleware(appLogger))
 	router.Use(metrics.MetricsMiddleware)
 
+	// Task lifecycle events are relayed from the outbox to the configured broker
+	publisher, closePublisher := buildPublisher(cfg.Events, appLogger)
+	defer closePublisher()
+
+	// Access tokens are signed with RS256 or EdDSA keys from the environment
+	signingKeys := loadSigningKeys(cfg.JWT, appLogger)
+
+	// Role permissions are read from storage and refreshed in the background
+	authorizer := authz.New(nil)
+	if err := authorizer.Load(context.Background(), permissionRepo); err != nil {
+		log.Fatalf("Error loading role permissions: %v", err)
+	}
+
 	// Initialize handlers
-	taskHandler := handlers.NewTaskHandler(db)
-	authHandler := handlers.NewAuthHandler(db)
+	taskHandler := handlers.NewTaskHandler(taskRepo, handlers.WithAssets(assetRepo), handlers.WithAuthorizer(authorizer),
+		handlers.WithTeams(teamRepo))
+	assetHandler := handlers.NewAssetHandler(assetRepo, taskRepo, teamRepo, authorizer)
+	commentHandler := handlers.NewCommentHandler(commentRepo, taskRepo, userRepo, teamRepo, authorizer)
+	// The content of attachments is kept in the configured blob store
+	blobStore := buildBlobStore(cfg.Attachments)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentRepo, taskRepo, teamRepo, blobStore, authorizer,
+		attachmentURLSecret(cfg.Attachments, appLogger))
+	attachmentHandler.MaxSize = int64(cfg.Attachments.MaxSize)
+	attachmentHandler.URLTTL = cfg.Attachments.URLTTL
+	scheduleHandler := handlers.NewScheduleHandler(scheduleRepo, userRepo, assetRepo)
+	scheduleHandler.Organizations = organizationRepo
+	authHandler := handlers.NewAuthHandler(userRepo, tokenRepo, invitationRepo, signingKeys)
+	authHandler.OpenRegistration = cfg.Auth.Registration == "open"
+	authHandler.Organizations = organizationRepo
+	authHandler.Attempts = attemptRepo
+	authHandler.UsernameLockout = lockoutPolicy(cfg.Auth.Lockout, cfg.Auth.Lockout.UsernameThreshold)
+	authHandler.AddressLockout = lockoutPolicy(cfg.Auth.Lockout, cfg.Auth.Lockout.AddressThreshold)
+	authHandler.TrustForwardedFor = cfg.Auth.Lockout.TrustForwardedFor
+	authHandler.MFA = mfaRepo
+	authHandler.MFARequiredRoles = mfaRequiredRoles(cfg.Auth.MFA)
+	authHandler.Passwords = passwordPolicy(cfg.Auth.Password)
+	passwordHandler := handlers.NewPasswordHandler(userRepo, tokenRepo, resetRepo, buildPasswordMailer(*cfg, appLogger))
+	passwordHandler.Policy = authHandler.Passwords
+	passwordHandler.ResetTTL = cfg.Auth.Password.ResetTTL
+	passwordHandler.ResetURL = cfg.Auth.Password.ResetURL
+	passwordHandler.Attempts = attemptRepo
+	passwordHandler.Lockout = authHandler.UsernameLockout
+	userHandler := handlers.NewUserHandler(userRepo, tokenRepo)
+	userHandler.Attempts = attemptRepo
+	mfaHandler := handlers.NewMFAHandler(mfaRepo, userRepo)
+	mfaHandler.Issuer = cfg.Auth.MFA.Issuer
+	mfaHandler.RequiredRoles = authHandler.MFARequiredRoles
+	mfaHandler.Attempts = attemptRepo
+	mfaHandler.Lockout = authHandler.UsernameLockout
+	invitationHandler := handlers.NewInvitationHandler(invitationRepo, signingKeys, authorizer)
+	invitationHandler.SignupURL = cfg.Auth.SignupURL
+	teamHandler := handlers.NewTeamHandler(teamRepo, userRepo)
+	organizationHandler := handlers.NewOrganizationHandler(organizationRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, authorizer)
+	sessionHandler := handlers.NewSessionHandler(tokenRepo)
+	oidcHandler := buildOIDCHandler(cfg.Auth.OIDC, identityRepo, userRepo, organizationRepo, authHandler)
 	healthChecker := health.New(db, appLogger)
 
-	validator := &auth.JWTValidator{}
-	authMiddleware := middleware.NewAuthMiddlewareHandler(validator)
+	// API keys are recognized by their prefix, everything else is an access token
+	validator := auth.ValidatorChain{
+		&auth.APIKeyValidator{Keys: apiKeyRepo, Users: userRepo},
+		&auth.JWTValidator{Keys: signingKeys, Revocations: tokenRepo, Sessions: tokenRepo},
+	}
+	authMiddleware := middleware.NewAuthMiddlewareHandler(validator, userRepo)
+	authMiddleware.MFARequiredRoles = make(map[string]bool)
+	for role := range authHandler.MFARequiredRoles {
+		authMiddleware.MFARequiredRoles[string(role)] = true
+	}
+	permissions := middleware.NewPermissionMiddleware(authorizer)
 
 	// Auth routes
 	router.HandleFunc("/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods("POST")
 	router.HandleFunc("/register", authHandler.Register).Methods("POST")
+	router.HandleFunc("/token/refresh", authHandler.RefreshToken).Methods("POST")
+	router.HandleFunc("/logout", authMiddleware.MFAEnrolmentMiddleware(authHandler.Logout)).Methods("POST")
+	router.HandleFunc("/password/forgot", passwordHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", passwordHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/me/password", authMiddleware.SessionMiddleware(passwordHandler.ChangePassword)).Methods("POST")
+	router.HandleFunc("/me/sessions", authMiddleware.SessionMiddleware(sessionHandler.ListSessions)).Methods("GET")
+	router.HandleFunc("/me/sessions/{id}", authMiddleware.SessionMiddleware(sessionHandler.DeleteSession)).Methods("DELETE")
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler(signingKeys)).Methods("GET")
+
+	// OpenID Connect routes, when a provider is configured
+	if oidcHandler != nil {
+		router.HandleFunc("/oidc/login", oidcHandler.Login).Methods("GET")
+		router.HandleFunc("/oidc/callback", oidcHandler.Callback).Methods("GET")
+		router.HandleFunc("/me/identities/oidc", authMiddleware.SessionMiddleware(oidcHandler.LinkIdentity)).Methods("POST")
+	}
 
 	// Task routes
-	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(taskHandler.CreateTask)).Methods("POST")
-	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(taskHandler.UpdateTask)).Methods("PUT")
-	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(taskHandler.ListTasks)).Methods("GET")
-	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(taskHandler.DeleteTask)).Methods("DELETE")
+	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskCreate, taskHandler.CreateTask))).Methods("POST")
+	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskUpdateOwn, taskHandler.UpdateTask))).Methods("PUT")
+	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, taskHandler.ListTasks))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/transitions", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskTransitionOwn, taskHandler.TransitionTask))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/transitions", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, taskHandler.ListTransitions))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.CreateComment))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/comments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.ListComments))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.GetComment))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.UpdateComment))).Methods("PUT")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.DeleteComment))).Methods("DELETE")
+	router.HandleFunc("/tasks/{id}/attachments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.UploadAttachment))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/attachments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.ListAttachments))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/attachments/{attachment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.GetAttachment))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/attachments/{attachment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.DeleteAttachment))).Methods("DELETE")
+	// Signed download links work without an Authorization header
+	router.HandleFunc("/tasks/{id}/attachments/{attachment_id}/{variant:content|thumbnail}", attachmentHandler.DownloadAttachment).Methods("GET")
+	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskDeleteTeam, taskHandler.DeleteTask))).Methods("DELETE")
+
+	// Asset routes
+	router.HandleFunc("/assets", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetManage, assetHandler.CreateAsset))).Methods("POST")
+	router.HandleFunc("/assets", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetRead, assetHandler.ListAssets))).Methods("GET")
+	router.HandleFunc("/assets/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetRead, assetHandler.GetAsset))).Methods("GET")
+	router.HandleFunc("/assets/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetManage, assetHandler.UpdateAsset))).Methods("PUT")
+	router.HandleFunc("/assets/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetManage, assetHandler.DeleteAsset))).Methods("DELETE")
+	router.HandleFunc("/assets/{id}/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, assetHandler.ListAssetTasks))).Methods("GET")
+
+	// Schedule routes
+	router.HandleFunc("/schedules", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleManage, scheduleHandler.CreateSchedule))).Methods("POST")
+	router.HandleFunc("/schedules", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleRead, scheduleHandler.ListSchedules))).Methods("GET")
+	router.HandleFunc("/schedules/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleRead, scheduleHandler.GetSchedule))).Methods("GET")
+	router.HandleFunc("/schedules/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleManage, scheduleHandler.UpdateSchedule))).Methods("PUT")
+	router.HandleFunc("/schedules/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleManage, scheduleHandler.DeleteSchedule))).Methods("DELETE")
+	router.HandleFunc("/schedules/{id}/preview", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionScheduleRead, scheduleHandler.PreviewSchedule))).Methods("GET")
+
+	// User administration routes
+	router.HandleFunc("/users", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.ListUsers))).Methods("GET")
+	router.HandleFunc("/users/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.GetUser))).Methods("GET")
+	router.HandleFunc("/users/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.DeleteUser))).Methods("DELETE")
+	router.HandleFunc("/users/{id}/role", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.UpdateUserRole))).Methods("PUT")
+	router.HandleFunc("/users/{id}/deactivate", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.DeactivateUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/reactivate", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.ReactivateUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/unlock", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.UnlockUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/sign-out", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.SignOutUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/mfa", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, mfaHandler.ResetUserMFA))).Methods("DELETE")
+
+	// Two-factor authentication routes, reachable without a second factor so
+	// users whose role requires one can set it up
+	router.HandleFunc("/me/mfa", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.GetMFAStatus)).Methods("GET")
+	router.HandleFunc("/me/mfa", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.DisableMFA)).Methods("DELETE")
+	router.HandleFunc("/me/mfa/totp", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.StartTOTP)).Methods("POST")
+	router.HandleFunc("/me/mfa/totp/verify", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.ConfirmTOTP)).Methods("POST")
+	router.HandleFunc("/me/mfa/recovery-codes", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.RegenerateRecoveryCodes)).Methods("POST")
+
+	// Invitation routes
+	router.HandleFunc("/invitations", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserInvite, invitationHandler.CreateInvitation))).Methods("POST")
+	router.HandleFunc("/invitations", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserInvite, invitationHandler.ListInvitations))).Methods("GET")
+	router.HandleFunc("/invitations/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserInvite, invitationHandler.RevokeInvitation))).Methods("DELETE")
+
+	// API key routes, keys can not be managed with an API key
+	router.HandleFunc("/api-keys", authMiddleware.SessionMiddleware(permissions.Require(models.PermissionAPIKeyManage, apiKeyHandler.CreateAPIKey))).Methods("POST")
+	router.HandleFunc("/api-keys", authMiddleware.SessionMiddleware(permissions.Require(models.PermissionAPIKeyManage, apiKeyHandler.ListAPIKeys))).Methods("GET")
+	router.HandleFunc("/api-keys/{id}", authMiddleware.SessionMiddleware(permissions.Require(models.PermissionAPIKeyManage, apiKeyHandler.RevokeAPIKey))).Methods("DELETE")
+
+	// Team routes
+	router.HandleFunc("/teams", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamManage, teamHandler.CreateTeam))).Methods("POST")
+	router.HandleFunc("/teams", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamRead, teamHandler.ListTeams))).Methods("GET")
+	router.HandleFunc("/teams/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamRead, teamHandler.GetTeam))).Methods("GET")
+	router.HandleFunc("/teams/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamManage, teamHandler.UpdateTeam))).Methods("PUT")
+	router.HandleFunc("/teams/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamManage, teamHandler.DeleteTeam))).Methods("DELETE")
+	router.HandleFunc("/teams/{id}/members/{user_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamManage, teamHandler.SetTeamMember))).Methods("PUT")
+	router.HandleFunc("/teams/{id}/members/{user_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTeamManage, teamHandler.RemoveTeamMember))).Methods("DELETE")
+
+	// Organization routes, every user reads their own organization
+	router.HandleFunc("/organization", authMiddleware.AuthMiddleware(organizationHandler.GetOrganization)).Methods("GET")
+	router.HandleFunc("/organization/settings", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionOrgManage, organizationHandler.UpdateOrganizationSettings))).Methods("PUT")
 
 	router.HandleFunc("/test", handlers.TestHandler).Methods("GET")
-	
+
 	// Health check endpoints
 	router.HandleFunc("/health", healthChecker.HealthHandler).Methods("GET")
 	router.HandleFunc("/health/ready", healthChecker.ReadinessHandler).Methods("GET")
 	router.HandleFunc("/health/live", healthChecker.LivenessHandler).Methods("GET")
-	
+
 	// Add metrics endpoint
 	router.Handle("/metrics", metrics.MetricsHandler()).Methods("GET")
 
-	// Get server port from environment variables
-	port := os.Getenv("APP_PORT_HOST")
-	if port == "" {
-		port = "8080" // Default to 8080 if not set
-	}
-
 	// Create and start server with graceful shutdown
-	srv := server.New(":"+port, router, appLogger, healthChecker)
+	srv := server.New(cfg.Server, router, appLogger, healthChecker)
+
+	// Notify the managers of the technician's teams about performed tasks in the background
+	dispatcher := notify.NewDispatcher(outboxRepo, userRepo, buildSinks(cfg.Notify, appLogger), appLogger)
+	dispatcher.Keyring = keyring
+	dispatcher.Teams = teamRepo
+	srv.RunInBackground(func(ctx context.Context) {
+		dispatcher.Start(ctx, 5*time.Second)
+	})
+
+	// Publish the task events committed to the outbox in the background
+	relay := events.NewRelay(outboxRepo, publisher, appLogger)
+	relay.Keyring = keyring
+	srv.RunInBackground(func(ctx context.Context) {
+		relay.Start(ctx, time.Second)
+	})
+
+	// Turn upcoming occurrences of maintenance schedules into tasks
+	scheduler := schedule.NewScheduler(scheduleRepo, taskRepo, appLogger)
+	srv.RunInBackground(func(ctx context.Context) {
+		scheduler.Start(ctx, time.Minute)
+	})
+
+	// Pick up changes to role permissions without a restart
+	srv.RunInBackground(func(ctx context.Context) {
+		refreshPermissions(ctx, authorizer, permissionRepo, appLogger, time.Minute)
+	})
+
+	// Drop refresh tokens and revocations once they have expired
+	srv.RunInBackground(func(ctx context.Context) {
+		purgeExpiredTokens(ctx, tokenRepo, appLogger, time.Hour)
+	})
+
+	// Drop password reset tokens once they have expired
+	srv.RunInBackground(func(ctx context.Context) {
+		purgePasswordResets(ctx, resetRepo, appLogger, time.Hour)
+	})
+
+	// Forget failed logins once they no longer count towards a lockout
+	srv.RunInBackground(func(ctx context.Context) {
+		purgeLoginAttempts(ctx, attemptRepo, lockoutWindow(cfg.Auth.Lockout), appLogger, time.Hour)
+	})
+
+	// Delete the blobs of removed attachments and tasks from the store
+	srv.RunInBackground(func(ctx context.Context) {
+		purgeDeletedBlobs(ctx, attachmentRepo, blobStore, appLogger, time.Minute)
+	})
+
 	appLogger.LogError(srv.Start(), "Server failed to start")
+	// Send the reset mails queued before the shutdown
+	passwordHandler.Wait()
+}
+
+// openDatabase connects to MySQL using the configured connection details
+func openDatabase(cfg config.Database) *sql.DB {
+	db, err := sql.Open("mysql", cfg.DSN())
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+
+	// Test database connection
+	if err := db.Ping(); err != nil {
+		log.Fatalf("Error pinging database: %v", err)
+	}
+
+	return db
+}
+
+// envLookup resolves a variable from the process environment, then from the
+// env files in order of precedence. Missing files are skipped.
+func envLookup(files ...string) func(string) (string, bool) {
+	var loaded []map[string]string
+	for _, file := range files {
+		vars, err := godotenv.Read(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", file, err)
+		}
+		loaded = append(loaded, vars)
+	}
+
+	return func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		for _, vars := range loaded {
+			if value, ok := vars[name]; ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
 }
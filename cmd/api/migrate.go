@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/migrate"
+)
+
+const migrateUsage = `Usage: api migrate <command> [flags]
+
+Commands:
+  up       Apply all pending migrations
+  down     Roll back the most recent migrations
+  status   Show which migrations have been applied
+`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Print the migrations that would run without executing them")
+	steps := flags.Int("steps", 1, "Number of migrations to roll back (down only)")
+	flags.Parse(args[1:])
+
+	db := openDatabase(cfg.Database)
+	defer db.Close()
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, *dryRun)
+		printMigrations(os.Stdout, "apply", applied, *dryRun, err != nil)
+		if err != nil {
+			log.Fatalf("Error applying migrations: %v", err)
+		}
+	case "down":
+		rolledBack, err := migrator.Down(ctx, *steps, *dryRun)
+		printMigrations(os.Stdout, "roll back", rolledBack, *dryRun, err != nil)
+		if err != nil {
+			log.Fatalf("Error rolling back migrations: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+		printStatus(os.Stdout, statuses)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q\n\n%s", command, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+// applyMigrations runs pending migrations before the server starts
+func applyMigrations(db *sql.DB) {
+	migrator, err := migrate.New(db)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+
+	applied, err := migrator.Up(context.Background(), false)
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	}
+	if err != nil {
+		log.Fatalf("Error applying migrations: %v", err)
+	}
+}
+
+// printMigrations reports the migrations returned by Up or Down, which only
+// include those that completed when the run failed
+func printMigrations(w io.Writer, verb string, migrations []migrate.Migration, dryRun bool, failed bool) {
+	if len(migrations) == 0 && !failed {
+		fmt.Fprintf(w, "Nothing to %s\n", verb)
+		return
+	}
+
+	for _, migration := range migrations {
+		if !dryRun {
+			fmt.Fprintf(w, "%04d_%s: done\n", migration.Version, migration.Name)
+			continue
+		}
+
+		script := migration.Up
+		if verb != "apply" {
+			script = migration.Down
+		}
+		fmt.Fprintf(w, "-- Would %s %04d_%s\n", verb, migration.Version, migration.Name)
+		for _, statement := range migrate.SplitStatements(script) {
+			fmt.Fprintf(w, "%s;\n", statement)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func printStatus(w io.Writer, statuses []migrate.Status) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/mail"
+	"github.com/makcim392/maintenance-api/internal/notify"
+)
+
+// buildSinks creates the notification sinks listed in NOTIFY_SINKS (log, smtp, webhook)
+func buildSinks(cfg config.Notify, appLogger *logger.Logger) []notify.Sink {
+	var sinks []notify.Sink
+	for _, sink := range cfg.Sinks {
+		var notifier notify.Notifier
+		switch sink {
+		case "log":
+			notifier = notify.NewLogNotifier(appLogger)
+		case "smtp":
+			sender := mail.NewSMTPSender(cfg.SMTP.Addr, cfg.SMTP.From, cfg.SMTP.Username, cfg.SMTP.Password.Value())
+			notifier = notify.NewEmailNotifier(sender)
+		case "webhook":
+			notifier = notify.NewWebhookNotifier(cfg.WebhookURL)
+		default:
+			log.Fatalf("Unknown notification sink %q, must be one of 'log', 'smtp' or 'webhook'", sink)
+		}
+		sinks = append(sinks, notify.Sink{Name: sink, Notifier: notifier})
+	}
+	return sinks
+}
+
+// buildPasswordMailer creates the sender of password reset mails named by
+// AUTH_PASSWORD_MAILER. The log sender writes the reset link to the log, use
+// it only where the log is as private as the mailbox.
+func buildPasswordMailer(cfg config.Config, appLogger *logger.Logger) mail.Sender {
+	switch cfg.Auth.Password.Mailer {
+	case "log":
+		return mail.NewLogSender(appLogger)
+	case "smtp":
+		smtp := cfg.Notify.SMTP
+		return mail.NewSMTPSender(smtp.Addr, smtp.From, smtp.Username, smtp.Password.Value())
+	default:
+		log.Fatalf("Unknown password mailer %q, must be either 'log' or 'smtp'", cfg.Auth.Password.Mailer)
+		return nil
+	}
+}
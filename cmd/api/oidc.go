@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/oidc"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// buildOIDCHandler creates the handler of logins through the OpenID Connect
+// provider of AUTH_OIDC_ISSUER_URL, or nil when none is configured. The
+// provider is only contacted on the first login.
+func buildOIDCHandler(cfg config.OIDC, identities repository.IdentityRepository, users repository.UserRepository,
+	organizations repository.OrganizationRepository, authHandler *handlers.AuthHandler) *handlers.OIDCHandler {
+	if cfg.IssuerURL == "" {
+		return nil
+	}
+
+	client := oidc.NewClient(oidc.Config{
+		IssuerURL:    cfg.IssuerURL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret.Value(),
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}, nil)
+	handler := handlers.NewOIDCHandler(client, identities, users, authHandler)
+	handler.GroupsClaim = cfg.GroupsClaim
+	handler.RoleMapping = make(map[string]models.Role)
+	for group, role := range cfg.Roles() {
+		handler.RoleMapping[group] = models.Role(role)
+	}
+	handler.DefaultRole = models.Role(cfg.DefaultRole)
+	handler.Provision = cfg.Provision
+
+	if cfg.Organization != "" {
+		organization, err := organizations.GetBySlug(context.Background(), cfg.Organization)
+		if err != nil {
+			log.Fatalf("Error loading AUTH_OIDC_ORGANIZATION %q: %v", cfg.Organization, err)
+		}
+		handler.OrganizationID = organization.ID
+	}
+	return handler
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// refreshPermissions periodically reloads the role permissions so grants
+// changed in the database apply without a restart. The previous grants are
+// kept when a reload fails.
+func refreshPermissions(ctx context.Context, authorizer *authz.Authorizer, permissions repository.PermissionRepository, appLogger *logger.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := authorizer.Load(ctx, permissions); err != nil && ctx.Err() == nil {
+			appLogger.LogError(err, "Failed to reload role permissions")
+		}
+	}
+}
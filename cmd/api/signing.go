@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/logger"
+)
+
+// loadSigningKeys builds the JWT key set from JWT_KEY_FILES, a comma separated
+// list of id:path pairs of PEM files, and JWT_KEYS, a comma separated list of
+// id:base64pem pairs. JWT_SIGNING_KEY_ID names the private key new tokens are
+// signed with, every other key only verifies. Without keys an ephemeral
+// Ed25519 key is generated, so tokens do not survive a restart.
+func loadSigningKeys(cfg config.JWT, appLogger *logger.Logger) *auth.KeySet {
+	files, err := auth.LoadKeyFiles(cfg.KeyFiles)
+	if err != nil {
+		log.Fatalf("Error loading JWT_KEY_FILES: %v", err)
+	}
+	encoded, err := auth.ParseEncodedKeys(cfg.Keys.Value())
+	if err != nil {
+		log.Fatalf("Error parsing JWT_KEYS: %v", err)
+	}
+	keys := append(files, encoded...)
+
+	primary := cfg.SigningKeyID
+	if len(keys) == 0 {
+		appLogger.LogInfo("No JWT signing keys configured, generating an ephemeral key; tokens will not survive a restart")
+		key, err := auth.GenerateKey("ephemeral")
+		if err != nil {
+			log.Fatalf("Error generating JWT signing key: %v", err)
+		}
+		keys, primary = []*auth.Key{key}, key.ID
+	}
+
+	keySet, err := auth.NewKeySet(primary, keys...)
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %v", err)
+	}
+	return keySet
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/config"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// purgeExpiredTokens periodically deletes refresh tokens, sessions and access
+// token revocations that can no longer be presented
+func purgeExpiredTokens(ctx context.Context, tokens repository.TokenRepository, appLogger *logger.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := tokens.PurgeExpired(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			appLogger.LogError(err, "Failed to purge expired tokens")
+		} else if purged > 0 {
+			appLogger.LogInfo("Purged %d expired tokens", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockoutPolicy builds the login lockout policy for the threshold from the
+// configuration
+func lockoutPolicy(cfg config.Lockout, threshold int) auth.LockoutPolicy {
+	return auth.LockoutPolicy{
+		Threshold: threshold,
+		BaseDelay: cfg.BaseDelay,
+		MaxDelay:  cfg.MaxDelay,
+		Window:    lockoutWindow(cfg),
+	}
+}
+
+// lockoutWindow is how long failed logins are remembered: a day, or the
+// longest lockout when that is longer
+func lockoutWindow(cfg config.Lockout) time.Duration {
+	if cfg.MaxDelay > 24*time.Hour {
+		return cfg.MaxDelay
+	}
+	return 24 * time.Hour
+}
+
+// mfaRequiredRoles returns the set of roles that must log in with a second factor
+func mfaRequiredRoles(cfg config.MFA) map[models.Role]bool {
+	roles := make(map[models.Role]bool, len(cfg.RequiredRoles))
+	for _, role := range cfg.RequiredRoles {
+		roles[models.Role(role)] = true
+	}
+	return roles
+}
+
+// purgeLoginAttempts periodically deletes the failed logins that are older
+// than the window and can no longer lock anyone out
+func purgeLoginAttempts(ctx context.Context, attempts repository.LoginAttemptRepository, window time.Duration, appLogger *logger.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := attempts.Purge(ctx, time.Now().Add(-window))
+		if err != nil && ctx.Err() == nil {
+			appLogger.LogError(err, "Failed to purge failed logins")
+		} else if purged > 0 {
+			appLogger.LogInfo("Purged %d failed login counters", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// passwordPolicy builds the password policy from the configuration, adding
+// the passwords of the breached list file to the bundled ones
+func passwordPolicy(cfg config.Password) auth.PasswordPolicy {
+	policy := auth.PasswordPolicy{MinLength: cfg.MinLength, Breached: auth.BundledBreachedPasswords()}
+	if cfg.BreachedListFile == "" {
+		return policy
+	}
+
+	file, err := os.Open(cfg.BreachedListFile)
+	if err != nil {
+		log.Fatalf("Error opening breached password list: %v", err)
+	}
+	defer file.Close()
+	policy.Breached = policy.Breached.Clone()
+	if err := policy.Breached.ReadBreachedPasswords(file); err != nil {
+		log.Fatalf("Error reading breached password list %s: %v", cfg.BreachedListFile, err)
+	}
+	return policy
+}
+
+// purgePasswordResets periodically deletes password reset tokens that have expired
+func purgePasswordResets(ctx context.Context, resets repository.PasswordResetRepository, appLogger *logger.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := resets.PurgeExpired(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			appLogger.LogError(err, "Failed to purge expired password reset tokens")
+		} else if purged > 0 {
+			appLogger.LogInfo("Purged %d expired password reset tokens", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
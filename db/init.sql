@@ -13,7 +13,7 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS tasks (
                                      id             varchar(36) primary key,
                                      summary        text null,
-                                     performed_date timestamp not null,
+                                     performed_at   timestamp not null,
                                      technician_id  int not null,
                                      created_at     timestamp default CURRENT_TIMESTAMP null,
                                      updated_at     timestamp default CURRENT_TIMESTAMP null on update CURRENT_TIMESTAMP,
@@ -23,7 +23,7 @@ CREATE TABLE IF NOT EXISTS tasks (
 );
 
 -- Indexes
-CREATE INDEX idx_performed_date ON tasks (performed_date);
+CREATE INDEX idx_performed_at ON tasks (performed_at);
 CREATE INDEX idx_technician ON tasks (technician_id);
 
 -- Insert users if table is empty
@@ -37,7 +37,7 @@ SELECT * FROM (
 WHERE NOT EXISTS (SELECT 1 FROM users);
 
 -- Insert tasks if table is empty
-INSERT INTO tasks (id, summary, performed_date, technician_id, created_at, updated_at)
+INSERT INTO tasks (id, summary, performed_at, technician_id, created_at, updated_at)
 SELECT * FROM (
                   SELECT '0e1667ec-e1ad-4210-9055-7c35e935a316', 'Replaced the faulty part on the second device.', '2024-12-29 10:30:00', 1, '2024-12-29 20:28:17', '2024-12-29 20:28:17' UNION ALL
                   SELECT '2182d110-43d6-4d21-8bd4-ad243ca6dec7', 'Replaced the faulty part on the device.', '2024-12-29 10:30:00', 1, '2024-12-31 21:13:26', '2024-12-31 21:13:26' UNION ALL
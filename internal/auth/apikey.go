@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+const (
+	// APIKeyTTL is how long an API key is valid unless another expiry is requested
+	APIKeyTTL = 90 * 24 * time.Hour
+	// MaxAPIKeyTTL is the longest expiry an API key can be created with
+	MaxAPIKeyTTL = 365 * 24 * time.Hour
+	// APIKeyTouchInterval is how often the last use of an API key is
+	// recorded, so busy integrations do not write on every request
+	APIKeyTouchInterval = time.Minute
+
+	// apiKeyScheme starts every API key, so they are told apart from access
+	// tokens and found by secret scanners
+	apiKeyScheme = "mapi_"
+	// apiKeyPrefixBytes is the randomness of the prefix identifying a key
+	apiKeyPrefixBytes = 4
+	// apiKeySecretBytes is the randomness of the secret part of a key
+	apiKeySecretBytes = 32
+)
+
+var (
+	// ErrUnrecognizedToken is returned by a validator for a token of a kind it
+	// does not handle, so a ValidatorChain tries the next one
+	ErrUnrecognizedToken = errors.New("token not recognized")
+
+	// ErrInvalidAPIKey is returned for an unknown, revoked or expired API key
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// NewAPIKey returns a random API key, the prefix identifying it and the hash
+// to store for it. Only the prefix and the hash are persisted, the key itself
+// is handed to its creator once.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	raw := make([]byte, apiKeyPrefixBytes+apiKeySecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(raw[:apiKeyPrefixBytes])
+	key = apiKeyScheme + prefix + "_" + base64.RawURLEncoding.EncodeToString(raw[apiKeyPrefixBytes:])
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of an API key. A fast hash is
+// enough because the key carries 256 bits of randomness.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix returns the prefix of an API key, false when the token is not
+// shaped like one
+func APIKeyPrefix(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, apiKeyScheme)
+	prefix, secret, found := strings.Cut(rest, "_")
+	if !ok || !found || len(prefix) != 2*apiKeyPrefixBytes || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// APIKeyStore looks up the API keys checked by APIKeyValidator
+type APIKeyStore interface {
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	Touch(ctx context.Context, id int64, at time.Time) error
+}
+
+// UserStore looks up the user an API key acts for
+type UserStore interface {
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+}
+
+// APIKeyValidator implements TokenValidator for API keys. The claims it
+// returns carry the current role of the user who created the key and the
+// permissions granted to the key.
+type APIKeyValidator struct {
+	Keys  APIKeyStore
+	Users UserStore
+}
+
+// ValidateToken looks the key up by its prefix and compares its hash, then
+// checks it is neither revoked nor expired. Tokens that are not API keys
+// return ErrUnrecognizedToken.
+func (v *APIKeyValidator) ValidateToken(tokenString string) (*Claims, error) {
+	prefix, ok := APIKeyPrefix(tokenString)
+	if !ok {
+		return nil, ErrUnrecognizedToken
+	}
+
+	ctx := context.Background()
+	key, err := v.Keys.GetByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(HashAPIKey(tokenString)), []byte(key.KeyHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.Status(now) != models.APIKeyActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := v.Users.GetByID(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= APIKeyTouchInterval {
+		if err := v.Keys.Touch(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	permissions := make([]string, 0, len(key.Permissions))
+	for _, permission := range key.Permissions {
+		permissions = append(permissions, string(permission))
+	}
+	return &Claims{
+		UserID:      key.UserID,
+		OrgID:       key.OrganizationID,
+		Role:        string(user.Role),
+		APIKeyID:    key.ID,
+		Permissions: permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(key.ExpiresAt),
+		},
+	}, nil
+}
+
+// ValidatorChain tries its validators in order. The first one that recognizes
+// the token decides, a token none recognizes returns ErrUnrecognizedToken.
+type ValidatorChain []TokenValidator
+
+// ValidateToken returns the result of the first validator that recognizes the token
+func (c ValidatorChain) ValidateToken(tokenString string) (*Claims, error) {
+	for _, validator := range c {
+		claims, err := validator.ValidateToken(tokenString)
+		if errors.Is(err, ErrUnrecognizedToken) {
+			continue
+		}
+		return claims, err
+	}
+	return nil, ErrUnrecognizedToken
+}
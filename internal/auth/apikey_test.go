@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeyStore struct {
+	keys    map[string]*models.APIKey
+	touched []int64
+}
+
+func (s *apiKeyStore) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	key, ok := s.keys[prefix]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *apiKeyStore) Touch(ctx context.Context, id int64, at time.Time) error {
+	s.touched = append(s.touched, id)
+	for _, key := range s.keys {
+		if key.ID == id {
+			key.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+type userStore map[uint]*models.User
+
+func (s userStore) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	user, ok := s[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return user, nil
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^mapi_[0-9a-f]{8}_[A-Za-z0-9_-]{43}$`, key)
+	assert.Equal(t, HashAPIKey(key), hash)
+
+	parsed, ok := APIKeyPrefix(key)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, parsed)
+
+	other, otherPrefix, _, err := NewAPIKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, prefix, otherPrefix)
+
+	for _, token := range []string{"", "eyJhbGciOiJFZERTQSJ9.e30.sig", "mapi_", "mapi_abcd1234", "mapi_abcd1234_", "mapi_abc_secret"} {
+		_, ok := APIKeyPrefix(token)
+		assert.False(t, ok, token)
+	}
+}
+
+func TestAPIKeyValidator(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	assert.NoError(t, err)
+	stored := &models.APIKey{ID: 3, OrganizationID: 2, UserID: 7, Prefix: prefix, KeyHash: hash,
+		Permissions: []models.Permission{models.PermissionTaskReadOwn}, ExpiresAt: time.Now().Add(time.Hour)}
+	store := &apiKeyStore{keys: map[string]*models.APIKey{prefix: stored}}
+	validator := &APIKeyValidator{Keys: store, Users: userStore{7: {ID: 7, Role: models.RoleManager}}}
+
+	t.Run("valid key", func(t *testing.T) {
+		claims, err := validator.ValidateToken(key)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(7), claims.UserID)
+		assert.Equal(t, int64(2), claims.OrgID)
+		assert.Equal(t, "manager", claims.Role)
+		assert.Equal(t, int64(3), claims.APIKeyID)
+		assert.Equal(t, []string{"task:read:own"}, claims.Permissions)
+		assert.WithinDuration(t, stored.ExpiresAt, claims.ExpiresAt.Time, time.Second)
+		assert.Equal(t, []int64{3}, store.touched)
+
+		// The last use is only recorded once per interval
+		_, err = validator.ValidateToken(key)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{3}, store.touched)
+	})
+
+	t.Run("wrong secret with a known prefix", func(t *testing.T) {
+		_, err := validator.ValidateToken("mapi_" + prefix + "_forged")
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other, _, _, _ := NewAPIKey()
+		_, err := validator.ValidateToken(other)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("expired and revoked keys", func(t *testing.T) {
+		stored.ExpiresAt = time.Now().Add(-time.Minute)
+		_, err := validator.ValidateToken(key)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+		now := time.Now()
+		stored.ExpiresAt = now.Add(time.Hour)
+		stored.RevokedAt = &now
+		_, err = validator.ValidateToken(key)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("access tokens are not recognized", func(t *testing.T) {
+		_, err := validator.ValidateToken("eyJhbGciOiJFZERTQSJ9.e30.sig")
+		assert.ErrorIs(t, err, ErrUnrecognizedToken)
+	})
+}
+
+func TestValidatorChain(t *testing.T) {
+	keys := newTestKeySet(t)
+	key, prefix, hash, err := NewAPIKey()
+	assert.NoError(t, err)
+	store := &apiKeyStore{keys: map[string]*models.APIKey{prefix: {ID: 1, OrganizationID: 1, UserID: 7, KeyHash: hash,
+		ExpiresAt: time.Now().Add(time.Hour)}}}
+	chain := ValidatorChain{
+		&APIKeyValidator{Keys: store, Users: userStore{7: {ID: 7, Role: models.RoleTechnician}}},
+		&JWTValidator{Keys: keys},
+	}
+
+	token, _, err := keys.IssueAccessToken(7, 1, "technician", "", false)
+	assert.NoError(t, err)
+	claims, err := chain.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Zero(t, claims.APIKeyID)
+
+	claims, err = chain.ValidateToken(key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), claims.APIKeyID)
+
+	// A malformed token is refused by the last validator
+	_, err = chain.ValidateToken("garbage")
+	assert.Error(t, err)
+
+	_, err = ValidatorChain{}.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrUnrecognizedToken)
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationToken(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	t.Run("round trip", func(t *testing.T) {
+		token, err := keys.IssueInvitationToken("invite-1", "new@example.com", "manager", time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		claims, err := keys.ParseInvitationToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "invite-1", claims.ID)
+		assert.Equal(t, "new@example.com", claims.Email)
+		assert.Equal(t, "manager", claims.Role)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, err := keys.IssueInvitationToken("invite-2", "new@example.com", "manager", time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		_, err = keys.ParseInvitationToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("signed with another key", func(t *testing.T) {
+		token, err := newTestKeySet(t).IssueInvitationToken("invite-3", "new@example.com", "admin", time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		_, err = keys.ParseInvitationToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("tokens are not interchangeable", func(t *testing.T) {
+		accessToken, _, err := keys.IssueAccessToken(1, 1, "technician", "", false)
+		assert.NoError(t, err)
+		_, err = keys.ParseInvitationToken(accessToken)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+
+		invitation, err := keys.IssueInvitationToken("invite-4", "new@example.com", "admin", time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		_, err = (&JWTValidator{Keys: keys, Revocations: &revocationList{}}).ValidateToken(invitation)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+	})
+}
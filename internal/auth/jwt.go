@@ -1,49 +1,82 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/models"
 )
 
-var jwtKey = []byte("your-secret-key") // In production, use environment variable
+const (
+	// AccessTokenTTL is how long an access token is accepted, clients renew it with a refresh token
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new token pair
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// SessionTouchInterval is how often the last use of a session is
+	// recorded, so requests do not all write to the database
+	SessionTouchInterval = time.Minute
+)
+
+var (
+	// ErrTokenRevoked is returned for an access token that was revoked before it expired
+	ErrTokenRevoked = errors.New("token has been revoked")
+
+	// ErrMissingTokenID is returned for an access token without a jti when revocation is checked
+	ErrMissingTokenID = errors.New("token has no ID")
+
+	// ErrMissingOrganization is returned for an access token that names no
+	// organization, such as one issued before organizations were introduced
+	ErrMissingOrganization = errors.New("token has no organization")
+
+	// ErrSessionTerminated is returned for an access token whose session was
+	// signed out, or that names no session when sessions are checked
+	ErrSessionTerminated = errors.New("session has been terminated")
+)
 
 type Claims struct {
 	UserID uint
-	Role   string
+	// OrgID is the organization of the user, every request is limited to it
+	OrgID int64
+	Role  string
+	// MFA is set when the user logged in with a second factor
+	MFA bool `json:",omitempty"`
+	// SessionID is the session of the login the token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// APIKeyID is set when the request authenticated with an API key rather
+	// than an access token, Permissions then lists the permissions granted to
+	// the key. Neither is ever part of a signed token.
+	APIKeyID    int64    `json:"-"`
+	Permissions []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, role string) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Role:   role,
+// IssueAccessToken signs an access token valid for AccessTokenTTL with the
+// primary key and returns its claims, whose ID (jti) identifies the token for
+// revocation. sessionID names the session of the login and mfa records whether
+// the login was completed with a second factor.
+func (s *KeySet) IssueAccessToken(userID uint, orgID int64, role, sessionID string, mfa bool) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:    userID,
+		OrgID:     orgID,
+		Role:      role,
+		MFA:       mfa,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
-}
-
-func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
+	signed, err := s.Sign(claims)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
-
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-
-	return claims, nil
+	return signed, claims, nil
 }
 
 // TokenValidator defines the interface for token validation
@@ -51,15 +84,39 @@ type TokenValidator interface {
 	ValidateToken(tokenString string) (*Claims, error)
 }
 
+// RevocationChecker reports whether an access token was revoked before it expired
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// SessionStore looks up the sessions checked by JWTValidator
+type SessionStore interface {
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	TouchSession(ctx context.Context, id string, at time.Time) error
+}
+
 // JWTValidator implements TokenValidator
-type JWTValidator struct{}
+type JWTValidator struct {
+	// Keys verifies the token signature, every token is rejected without it
+	Keys *KeySet
+	// Revocations, when set, rejects revoked tokens and tokens without a jti
+	Revocations RevocationChecker
+	// Sessions, when set, rejects tokens whose session was terminated or
+	// expired and tokens without a session, and records when sessions are used
+	Sessions SessionStore
+}
 
-// ValidateToken implementation moved to JWTValidator
+// ValidateToken verifies the signature of the token against the key set and
+// checks its expiry, its organization and, when configured, its revocation
+// and its session
 func (v *JWTValidator) ValidateToken(tokenString string) (*Claims, error) {
+	if v.Keys == nil {
+		return nil, ErrUnknownKey
+	}
+
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.Keys.Keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -69,5 +126,58 @@ func (v *JWTValidator) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Access tokens carry no audience, tokens that do were issued for
+	// something else, like an invitation
+	if len(claims.Audience) > 0 {
+		return nil, ErrUnexpectedAudience
+	}
+
+	if claims.OrgID == 0 {
+		return nil, ErrMissingOrganization
+	}
+
+	if v.Revocations != nil {
+		if claims.ID == "" {
+			return nil, ErrMissingTokenID
+		}
+		revoked, err := v.Revocations.IsRevoked(context.Background(), claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	if v.Sessions != nil {
+		if err := v.checkSession(claims); err != nil {
+			return nil, err
+		}
+	}
+
 	return claims, nil
 }
+
+// checkSession rejects the token unless its session is active and belongs to
+// its user, and records the use of the session at most every
+// SessionTouchInterval
+func (v *JWTValidator) checkSession(claims *Claims) error {
+	if claims.SessionID == "" {
+		return ErrSessionTerminated
+	}
+
+	ctx := context.Background()
+	session, err := v.Sessions.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return ErrSessionTerminated
+	}
+	now := time.Now()
+	if session.UserID != claims.UserID || !session.Active(now) {
+		return ErrSessionTerminated
+	}
+
+	if now.Sub(session.LastSeenAt) >= SessionTouchInterval {
+		return v.Sessions.TouchSession(ctx, session.ID, now)
+	}
+	return nil
+}
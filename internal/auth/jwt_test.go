@@ -1,17 +1,19 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/makcim392/maintenance-api/internal/models"
 	"github.com/stretchr/testify/assert"
 )
 
-// Existing TestGenerateToken and TestValidateToken remain the same...
-
 func TestJWTValidator_ValidateToken(t *testing.T) {
-	validator := &JWTValidator{}
+	keys := newTestKeySet(t)
+	validator := &JWTValidator{Keys: keys}
 
 	tests := []struct {
 		name       string
@@ -23,7 +25,7 @@ func TestJWTValidator_ValidateToken(t *testing.T) {
 		{
 			name: "Valid token with JWTValidator",
 			setupToken: func() string {
-				token, _ := GenerateToken(1, "user")
+				token, _, _ := keys.IssueAccessToken(1, 1, "user", "", false)
 				return token
 			},
 			wantUserID: 1,
@@ -41,9 +43,10 @@ func TestJWTValidator_ValidateToken(t *testing.T) {
 						IssuedAt:  jwt.NewNumericDate(time.Now()),
 					},
 				}
-				token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-				// Sign with HS256 key but claim RS256
-				tokenString, _ := token.SignedString(jwtKey)
+				// An HMAC token naming one of our keys must not be accepted
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+				token.Header["kid"] = keys.PrimaryKeyID()
+				tokenString, _ := token.SignedString([]byte("your-secret-key"))
 				return tokenString
 			},
 			wantUserID: 0,
@@ -62,7 +65,7 @@ func TestJWTValidator_ValidateToken(t *testing.T) {
 		{
 			name: "Token with invalid signature",
 			setupToken: func() string {
-				validToken, _ := GenerateToken(1, "user")
+				validToken, _, _ := keys.IssueAccessToken(1, 1, "user", "", false)
 				return validToken + "corrupted"
 			},
 			wantUserID: 0,
@@ -80,8 +83,7 @@ func TestJWTValidator_ValidateToken(t *testing.T) {
 						IssuedAt:  jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
 					},
 				}
-				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-				tokenString, _ := token.SignedString(jwtKey)
+				tokenString, _ := keys.Sign(claims)
 				return tokenString
 			},
 			wantUserID: 0,
@@ -109,6 +111,9 @@ func TestJWTValidator_ValidateToken(t *testing.T) {
 }
 
 func TestTokenExpirationTimes(t *testing.T) {
+	keys := newTestKeySet(t)
+	validator := &JWTValidator{Keys: keys}
+
 	tests := []struct {
 		name       string
 		setupToken func() string
@@ -119,13 +124,13 @@ func TestTokenExpirationTimes(t *testing.T) {
 			setupToken: func() string {
 				claims := Claims{
 					UserID: 1,
+					OrgID:  1,
 					Role:   "user",
 					RegisteredClaims: jwt.RegisteredClaims{
 						IssuedAt: jwt.NewNumericDate(time.Now()),
 					},
 				}
-				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-				tokenString, _ := token.SignedString(jwtKey)
+				tokenString, _ := keys.Sign(claims)
 				return tokenString
 			},
 			wantErr: false,
@@ -135,14 +140,14 @@ func TestTokenExpirationTimes(t *testing.T) {
 			setupToken: func() string {
 				claims := Claims{
 					UserID: 1,
+					OrgID:  1,
 					Role:   "user",
 					RegisteredClaims: jwt.RegisteredClaims{
 						ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Second)),
 						IssuedAt:  jwt.NewNumericDate(time.Now()),
 					},
 				}
-				token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-				tokenString, _ := token.SignedString(jwtKey)
+				tokenString, _ := keys.Sign(claims)
 				return tokenString
 			},
 			wantErr: false,
@@ -152,7 +157,7 @@ func TestTokenExpirationTimes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			token := tt.setupToken()
-			claims, err := ValidateToken(token)
+			claims, err := validator.ValidateToken(token)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -164,3 +169,151 @@ func TestTokenExpirationTimes(t *testing.T) {
 		})
 	}
 }
+
+// revocationList implements RevocationChecker for testing
+type revocationList struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (l *revocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return l.revoked[jti], l.err
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	keys := newTestKeySet(t)
+	token, claims, err := keys.IssueAccessToken(7, 1, "technician", "", false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(AccessTokenTTL), claims.ExpiresAt.Time, 2*time.Second)
+
+	_, other, err := keys.IssueAccessToken(7, 1, "technician", "", false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, claims.ID, other.ID)
+
+	parsed, err := (&JWTValidator{Keys: keys}).ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, claims.ID, parsed.ID)
+	assert.Equal(t, int64(1), parsed.OrgID)
+}
+
+func TestJWTValidator_MissingOrganization(t *testing.T) {
+	keys := newTestKeySet(t)
+	token, _, err := keys.IssueAccessToken(7, 0, "technician", "", false)
+	assert.NoError(t, err)
+
+	parsed, err := (&JWTValidator{Keys: keys}).ValidateToken(token)
+	assert.ErrorIs(t, err, ErrMissingOrganization)
+	assert.Nil(t, parsed)
+}
+
+func TestJWTValidator_Revocation(t *testing.T) {
+	keys := newTestKeySet(t)
+	token, claims, err := keys.IssueAccessToken(1, 1, "manager", "", false)
+	assert.NoError(t, err)
+
+	t.Run("token that was not revoked is accepted", func(t *testing.T) {
+		validator := &JWTValidator{Keys: keys, Revocations: &revocationList{}}
+		parsed, err := validator.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), parsed.UserID)
+	})
+
+	t.Run("revoked token is rejected", func(t *testing.T) {
+		validator := &JWTValidator{Keys: keys, Revocations: &revocationList{revoked: map[string]bool{claims.ID: true}}}
+		parsed, err := validator.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+		assert.Nil(t, parsed)
+	})
+
+	t.Run("token without jti is rejected", func(t *testing.T) {
+		tokenString, _ := keys.Sign(Claims{
+			UserID: 1,
+			OrgID:  1,
+			Role:   "manager",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+
+		validator := &JWTValidator{Keys: keys, Revocations: &revocationList{}}
+		_, err := validator.ValidateToken(tokenString)
+		assert.ErrorIs(t, err, ErrMissingTokenID)
+	})
+
+	t.Run("revocation lookup failure is an error", func(t *testing.T) {
+		validator := &JWTValidator{Keys: keys, Revocations: &revocationList{err: errors.New("database down")}}
+		_, err := validator.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
+
+// sessionList implements SessionStore for testing
+type sessionList struct {
+	sessions map[string]models.Session
+	touched  []string
+}
+
+func (l *sessionList) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	session, ok := l.sessions[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &session, nil
+}
+
+func (l *sessionList) TouchSession(ctx context.Context, id string, at time.Time) error {
+	l.touched = append(l.touched, id)
+	return nil
+}
+
+func TestJWTValidator_Sessions(t *testing.T) {
+	keys := newTestKeySet(t)
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	sessions := &sessionList{sessions: map[string]models.Session{
+		"recent":     {ID: "recent", UserID: 1, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+		"idle":       {ID: "idle", UserID: 1, LastSeenAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		"terminated": {ID: "terminated", UserID: 1, LastSeenAt: now, ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt},
+		"expired":    {ID: "expired", UserID: 1, LastSeenAt: now, ExpiresAt: now.Add(-time.Minute)},
+		"of-other":   {ID: "of-other", UserID: 2, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+	}}
+	validator := &JWTValidator{Keys: keys, Sessions: sessions}
+
+	for sessionID, wantErr := range map[string]error{
+		"recent":     nil,
+		"idle":       nil,
+		"terminated": ErrSessionTerminated,
+		"expired":    ErrSessionTerminated,
+		"of-other":   ErrSessionTerminated,
+		"unknown":    ErrSessionTerminated,
+		"":           ErrSessionTerminated,
+	} {
+		token, _, err := keys.IssueAccessToken(1, 1, "technician", sessionID, false)
+		assert.NoError(t, err)
+		claims, err := validator.ValidateToken(token)
+		if wantErr != nil {
+			assert.ErrorIs(t, err, wantErr, sessionID)
+			continue
+		}
+		assert.NoError(t, err, sessionID)
+		assert.Equal(t, sessionID, claims.SessionID)
+	}
+
+	// Only the session that was not used within the interval is touched
+	assert.Equal(t, []string{"idle"}, sessions.touched)
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken()
+	assert.NoError(t, err)
+	assert.Len(t, token, 43)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashRefreshToken(token))
+	assert.NotContains(t, hash, token)
+
+	other, otherHash, err := NewRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.NotEqual(t, hash, otherHash)
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing or verification
+const minRSAKeyBits = 2048
+
+var (
+	// ErrUnknownKey is returned for a token whose kid is not in the key set
+	ErrUnknownKey = errors.New("unknown signing key")
+
+	// ErrUnexpectedAlgorithm is returned for a token whose alg does not match its key
+	ErrUnexpectedAlgorithm = errors.New("unexpected signing algorithm")
+)
+
+// Key is an RSA or Ed25519 key identified by the kid it is published under.
+// Keys loaded from a public key can only verify tokens.
+type Key struct {
+	ID      string
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// GenerateKey creates a random Ed25519 signing key
+func GenerateKey(id string) (*Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: id, private: private, public: public}, nil
+}
+
+// ParsePEMKey parses a PEM encoded private key (PKCS #8 or PKCS #1) or public
+// key (PKIX or PKCS #1). RSA keys must have at least 2048 bits.
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s has unsupported PEM type %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	return newKey(id, parsed)
+}
+
+// LoadKeyFiles loads the keys listed in a comma separated list of id:path
+// pairs, each file holding one PEM encoded key
+func LoadKeyFiles(spec string) ([]*Key, error) {
+	return parseKeySpec(spec, "id:path", func(id, path string) (*Key, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		return ParsePEMKey(id, data)
+	})
+}
+
+// ParseEncodedKeys parses a comma separated list of id:base64 pairs, each
+// value being a base64 encoded PEM key, for keys passed in the environment
+func ParseEncodedKeys(spec string) ([]*Key, error) {
+	return parseKeySpec(spec, "id:base64pem", func(id, encoded string) (*Key, error) {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		return ParsePEMKey(id, data)
+	})
+}
+
+func parseKeySpec(spec, form string, load func(id, value string) (*Key, error)) ([]*Key, error) {
+	var keys []*Key
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %q must have the form %s", pair, form)
+		}
+		key, err := load(id, value)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func newKey(id string, parsed interface{}) (*Key, error) {
+	if id == "" || strings.ContainsAny(id, ":,") {
+		return nil, fmt.Errorf("invalid key ID %q", id)
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.private, key.public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.private, key.public = k, k.Public()
+	case *rsa.PublicKey:
+		key.public = k
+	case ed25519.PublicKey:
+		key.public = k
+	default:
+		return nil, fmt.Errorf("key %s must be an RSA or Ed25519 key, got %T", id, parsed)
+	}
+
+	if public, ok := key.public.(*rsa.PublicKey); ok && public.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("key %s must have at least %d bits, got %d", id, minRSAKeyBits, public.N.BitLen())
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key holds a private key
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// method returns the JWT signing method matching the key type
+func (k *Key) method() jwt.SigningMethod {
+	if _, ok := k.public.(*rsa.PublicKey); ok {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// N and E are set for RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are set for Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the public half of the key as a JWK
+func (k *Key) jwk() JWK {
+	jwk := JWK{Use: "sig", Alg: k.method().Alg(), Kid: k.ID}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// ParseJWKS parses the public signing keys of a JSON Web Key Set, such as the
+// one an OpenID Connect provider publishes. Keys of other types, curves or
+// uses, and keys without a kid, are skipped.
+func ParseJWKS(data []byte) ([]*Key, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	var keys []*Key
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		var public interface{}
+		switch {
+		case jwk.Kty == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has an invalid modulus", jwk.Kid)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %s has an invalid exponent", jwk.Kid)
+			}
+			public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %s has an invalid public key", jwk.Kid)
+			}
+			public = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+		key, err := newKey(jwk.Kid, public)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet signs tokens with its primary key and verifies tokens signed with
+// any of its keys, so a new key can be rolled out while tokens signed with
+// the previous one are still in circulation.
+type KeySet struct {
+	primary *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet creates a KeySet that signs with the key with the primary ID
+func NewKeySet(primary string, keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key set needs at least one key")
+	}
+
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	set.primary = set.keys[primary]
+	if set.primary == nil {
+		return nil, fmt.Errorf("primary key %q is not in the key set", primary)
+	}
+	if !set.primary.CanSign() {
+		return nil, fmt.Errorf("primary key %q is a public key and can not sign", primary)
+	}
+	return set, nil
+}
+
+// NewVerificationKeySet creates a KeySet without a primary key, which only
+// verifies tokens, such as the ID tokens of an OpenID Connect provider
+func NewVerificationKeySet(keys ...*Key) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+// PrimaryKeyID returns the kid new tokens are signed with, empty for a
+// verification key set
+func (s *KeySet) PrimaryKeyID() string {
+	if s.primary == nil {
+		return ""
+	}
+	return s.primary.ID
+}
+
+// Sign signs the claims with the primary key and sets the kid header
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.primary == nil {
+		return "", errors.New("key set has no signing key")
+	}
+	token := jwt.NewWithClaims(s.primary.method(), claims)
+	token.Header["kid"] = s.primary.ID
+	return token.SignedString(s.primary.private)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header and
+// rejects tokens whose alg does not match the key
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method().Alg() {
+		return nil, ErrUnexpectedAlgorithm
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys of the set ordered by kid
+func (s *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		set.Keys = append(set.Keys, s.keys[id].jwk())
+	}
+	return set
+}
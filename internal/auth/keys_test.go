@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestKeySet returns a key set with a single Ed25519 signing key
+func newTestKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	key, err := GenerateKey("test")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keys, err := NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	return keys
+}
+
+func rsaPEM(t *testing.T, bits int) (private, public []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func ed25519PEM(t *testing.T) []byte {
+	t.Helper()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal Ed25519 key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePEMKey(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaPEM(t, 2048)
+
+	t.Run("RSA private key signs with RS256", func(t *testing.T) {
+		key, err := ParsePEMKey("rsa", rsaPrivate)
+		assert.NoError(t, err)
+		assert.True(t, key.CanSign())
+		assert.Equal(t, "RS256", key.method().Alg())
+	})
+
+	t.Run("Ed25519 private key signs with EdDSA", func(t *testing.T) {
+		key, err := ParsePEMKey("ed", ed25519PEM(t))
+		assert.NoError(t, err)
+		assert.True(t, key.CanSign())
+		assert.Equal(t, "EdDSA", key.method().Alg())
+	})
+
+	t.Run("public key only verifies", func(t *testing.T) {
+		key, err := ParsePEMKey("rsa-public", rsaPublic)
+		assert.NoError(t, err)
+		assert.False(t, key.CanSign())
+	})
+
+	t.Run("short RSA key is rejected", func(t *testing.T) {
+		short, _ := rsaPEM(t, 1024)
+		_, err := ParsePEMKey("short", short)
+		assert.ErrorContains(t, err, "at least 2048 bits")
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := ParsePEMKey("garbage", []byte("not a key"))
+		assert.Error(t, err)
+		_, err = ParsePEMKey("a:b", rsaPrivate)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadKeys(t *testing.T) {
+	rsaPrivate, _ := rsaPEM(t, 2048)
+	path := filepath.Join(t.TempDir(), "rsa.pem")
+	assert.NoError(t, os.WriteFile(path, rsaPrivate, 0o600))
+
+	keys, err := LoadKeyFiles("2024:" + path)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "2024", keys[0].ID)
+
+	_, err = LoadKeyFiles("missing:" + filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+
+	keys, err = ParseEncodedKeys("a:" + base64.StdEncoding.EncodeToString(ed25519PEM(t)) + ", b:" + base64.StdEncoding.EncodeToString(rsaPrivate))
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	_, err = ParseEncodedKeys("no-separator")
+	assert.Error(t, err)
+
+	keys, err = ParseEncodedKeys("")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestKeySet(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaPEM(t, 2048)
+	rsaKey, err := ParsePEMKey("rsa-2024", rsaPrivate)
+	assert.NoError(t, err)
+	edKey, err := GenerateKey("ed-2025")
+	assert.NoError(t, err)
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := NewKeySet("none")
+		assert.Error(t, err)
+
+		_, err = NewKeySet("missing", edKey)
+		assert.Error(t, err)
+
+		_, err = NewKeySet(edKey.ID, edKey, edKey)
+		assert.Error(t, err)
+
+		public, _ := ParsePEMKey("public", rsaPublic)
+		_, err = NewKeySet("public", public)
+		assert.ErrorContains(t, err, "can not sign")
+	})
+
+	t.Run("tokens carry the kid and verify against the set", func(t *testing.T) {
+		for _, key := range []*Key{rsaKey, edKey} {
+			keys, err := NewKeySet(key.ID, key)
+			assert.NoError(t, err)
+
+			token, _, err := keys.IssueAccessToken(3, 1, "technician", "", false)
+			assert.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, key.method().Alg(), parsed.Header["alg"])
+
+			claims, err := (&JWTValidator{Keys: keys}).ValidateToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(3), claims.UserID)
+		}
+	})
+
+	t.Run("tokens of the previous key verify after rotation", func(t *testing.T) {
+		before, err := NewKeySet(rsaKey.ID, rsaKey)
+		assert.NoError(t, err)
+		oldToken, _, err := before.IssueAccessToken(3, 1, "technician", "", false)
+		assert.NoError(t, err)
+
+		after, err := NewKeySet(edKey.ID, edKey, rsaKey)
+		assert.NoError(t, err)
+		newToken, _, err := after.IssueAccessToken(3, 1, "technician", "", false)
+		assert.NoError(t, err)
+
+		validator := &JWTValidator{Keys: after}
+		_, err = validator.ValidateToken(oldToken)
+		assert.NoError(t, err)
+		_, err = validator.ValidateToken(newToken)
+		assert.NoError(t, err)
+
+		// Once the old key is retired its tokens are rejected
+		retired, err := NewKeySet(edKey.ID, edKey)
+		assert.NoError(t, err)
+		_, err = (&JWTValidator{Keys: retired}).ValidateToken(oldToken)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("alg must match the key", func(t *testing.T) {
+		keys, err := NewKeySet(edKey.ID, edKey, rsaKey)
+		assert.NoError(t, err)
+
+		// An EdDSA signature presented under the kid of the RSA key
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{UserID: 1})
+		token.Header["kid"] = rsaKey.ID
+		signed, err := token.SignedString(edKey.private)
+		assert.NoError(t, err)
+
+		_, err = (&JWTValidator{Keys: keys}).ValidateToken(signed)
+		assert.ErrorIs(t, err, ErrUnexpectedAlgorithm)
+	})
+
+	t.Run("validator without keys rejects every token", func(t *testing.T) {
+		keys, _ := NewKeySet(edKey.ID, edKey)
+		token, _, _ := keys.IssueAccessToken(1, 1, "manager", "", false)
+		_, err := (&JWTValidator{}).ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("JWKS publishes the public keys", func(t *testing.T) {
+		keys, err := NewKeySet(edKey.ID, edKey, rsaKey)
+		assert.NoError(t, err)
+
+		jwks := keys.JWKS()
+		assert.Len(t, jwks.Keys, 2)
+
+		ed := jwks.Keys[0]
+		assert.Equal(t, JWK{Kty: "OKP", Use: "sig", Alg: "EdDSA", Kid: "ed-2025", Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(edKey.public.(ed25519.PublicKey))}, ed)
+
+		rsaJWK := jwks.Keys[1]
+		assert.Equal(t, "RSA", rsaJWK.Kty)
+		assert.Equal(t, "RS256", rsaJWK.Alg)
+		assert.Equal(t, "rsa-2024", rsaJWK.Kid)
+		assert.Equal(t, "AQAB", rsaJWK.E)
+		n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, new(big.Int).SetBytes(n).Cmp(rsaKey.public.(*rsa.PublicKey).N))
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaPrivate, _ := rsaPEM(t, 2048)
+	rsaKey, err := ParsePEMKey("rsa-2024", rsaPrivate)
+	assert.NoError(t, err)
+	edKey, err := GenerateKey("ed-2025")
+	assert.NoError(t, err)
+	signing, err := NewKeySet(edKey.ID, edKey, rsaKey)
+	assert.NoError(t, err)
+
+	// The published set of a key set parses back to its public keys
+	published, err := json.Marshal(signing.JWKS())
+	assert.NoError(t, err)
+	keys, err := ParseJWKS(published)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	for _, key := range keys {
+		assert.False(t, key.CanSign())
+	}
+
+	verification, err := NewVerificationKeySet(keys...)
+	assert.NoError(t, err)
+	assert.Empty(t, verification.PrimaryKeyID())
+	_, err = verification.Sign(&Claims{})
+	assert.Error(t, err)
+	for _, key := range []*Key{edKey, rsaKey} {
+		issuer, _ := NewKeySet(key.ID, key)
+		token, _, err := issuer.IssueAccessToken(3, 1, "technician", "", false)
+		assert.NoError(t, err)
+		_, err = (&JWTValidator{Keys: verification}).ValidateToken(token)
+		assert.NoError(t, err)
+	}
+
+	t.Run("unsupported keys are skipped", func(t *testing.T) {
+		keys, err := ParseJWKS([]byte(`{"keys":[
+			{"kty":"EC","crv":"P-256","kid":"ec","x":"AA","y":"AA"},
+			{"kty":"RSA","use":"enc","kid":"enc","n":"AQAB","e":"AQAB"},
+			{"kty":"OKP","crv":"Ed25519","x":"` + base64.RawURLEncoding.EncodeToString(make([]byte, 32)) + `"}
+		]}`))
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, data := range []string{
+			`not json`,
+			`{"keys":[{"kty":"RSA","kid":"short","n":"AQAB","e":"AQAB"}]}`,
+			`{"keys":[{"kty":"RSA","kid":"bad","n":"!","e":"AQAB"}]}`,
+			`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"bad","x":"AQAB"}]}`,
+		} {
+			_, err := ParseJWKS([]byte(data))
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// LockoutPolicy decides how long logins are refused after consecutive
+// failures. Every failure past the threshold doubles the lockout.
+type LockoutPolicy struct {
+	// Threshold is the number of failures allowed before the first lockout
+	Threshold int
+	// BaseDelay is the first lockout
+	BaseDelay time.Duration
+	// MaxDelay caps the lockout
+	MaxDelay time.Duration
+	// Window is how long failures are remembered, a failure more than Window
+	// after the previous one starts counting from one again
+	Window time.Duration
+}
+
+var (
+	// DefaultUsernameLockout locks a username out for a minute after 5
+	// failures, up to an hour
+	DefaultUsernameLockout = LockoutPolicy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+
+	// DefaultAddressLockout is more lenient because one address may be
+	// shared by many users, behind a NAT for instance
+	DefaultAddressLockout = LockoutPolicy{Threshold: 20, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+
+	// DefaultResetLockout limits password reset requests for a username to 5
+	// before they are refused for 15 minutes, up to a day. Every request
+	// counts, whether or not it mails a token.
+	DefaultResetLockout = LockoutPolicy{Threshold: 5, BaseDelay: 15 * time.Minute, MaxDelay: 24 * time.Hour, Window: 24 * time.Hour}
+)
+
+// Delay returns how long logins are refused after the given number of
+// consecutive failures, zero below the threshold
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// LockedUntil returns the time logins are refused until, the zero time when
+// the failures do not lock the key out
+func (p LockoutPolicy) LockedUntil(attempts *models.LoginAttempts) time.Time {
+	if attempts == nil {
+		return time.Time{}
+	}
+	delay := p.Delay(attempts.Failures)
+	if delay == 0 {
+		return time.Time{}
+	}
+	return attempts.LastFailureAt.Add(delay)
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{1000, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.delay, policy.Delay(tt.failures), "%d failures", tt.failures)
+	}
+
+	last := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	assert.True(t, policy.LockedUntil(nil).IsZero())
+	assert.True(t, policy.LockedUntil(&models.LoginAttempts{Failures: 2, LastFailureAt: last}).IsZero())
+	assert.Equal(t, last.Add(2*time.Minute), policy.LockedUntil(&models.LoginAttempts{Failures: 4, LastFailureAt: last}))
+
+	// A policy without a threshold never locks out
+	assert.Zero(t, LockoutPolicy{}.Delay(100))
+}
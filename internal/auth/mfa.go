@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// MFAAudience is the aud claim of MFA challenge tokens, which keeps them
+	// from being accepted as access tokens
+	MFAAudience = "mfa"
+	// MFAChallengeTTL is how long the second step of a login can be completed
+	MFAChallengeTTL = 5 * time.Minute
+)
+
+// MFAChallengeClaims are the claims of the token Login hands out instead of
+// an access token to users with two-factor authentication. It proves the
+// password was checked and names the user whose code is expected.
+type MFAChallengeClaims struct {
+	UserID uint `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// IssueMFAChallenge signs an MFA challenge token valid for MFAChallengeTTL
+func (s *KeySet) IssueMFAChallenge(userID uint) (string, error) {
+	now := time.Now()
+	return s.Sign(&MFAChallengeClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{MFAAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// ParseMFAChallenge verifies the signature, expiry and audience of an MFA
+// challenge token
+func (s *KeySet) ParseMFAChallenge(token string) (*MFAChallengeClaims, error) {
+	claims := &MFAChallengeClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, s.Keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyAudience(MFAAudience, true) {
+		return nil, ErrUnexpectedAudience
+	}
+	return claims, nil
+}
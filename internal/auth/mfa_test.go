@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFAChallenge(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := keys.IssueMFAChallenge(42)
+	assert.NoError(t, err)
+	claims, err := keys.ParseMFAChallenge(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), claims.UserID)
+
+	t.Run("signed with another key", func(t *testing.T) {
+		token, err := newTestKeySet(t).IssueMFAChallenge(42)
+		assert.NoError(t, err)
+		_, err = keys.ParseMFAChallenge(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("challenges are not access tokens", func(t *testing.T) {
+		_, err := (&JWTValidator{Keys: keys}).ValidateToken(token)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+
+		accessToken, _, err := keys.IssueAccessToken(42, 1, "manager", "", false)
+		assert.NoError(t, err)
+		_, err = keys.ParseMFAChallenge(accessToken)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+	})
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCState(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := keys.IssueOIDCState("state", "nonce", "verifier", 7)
+	assert.NoError(t, err)
+	claims, err := keys.ParseOIDCState(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "state", claims.State)
+	assert.Equal(t, "nonce", claims.Nonce)
+	assert.Equal(t, "verifier", claims.Verifier)
+	assert.Equal(t, uint(7), claims.LinkUserID)
+
+	t.Run("signed with another key", func(t *testing.T) {
+		token, err := newTestKeySet(t).IssueOIDCState("state", "nonce", "verifier", 0)
+		assert.NoError(t, err)
+		_, err = keys.ParseOIDCState(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("state tokens are not access tokens", func(t *testing.T) {
+		_, err := (&JWTValidator{Keys: keys}).ValidateToken(token)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+
+		challenge, err := keys.IssueMFAChallenge(7)
+		assert.NoError(t, err)
+		_, err = keys.ParseOIDCState(challenge)
+		assert.ErrorIs(t, err, ErrUnexpectedAudience)
+	})
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash, it refuses longer ones
+const MaxPasswordBytes = 72
+
+// ErrWeakPassword is wrapped by every error of PasswordPolicy.Check
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// PasswordPolicy decides which passwords users may set. Following NIST SP
+// 800-63B it asks for length and rejects known breached passwords instead of
+// requiring character classes.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// Breached holds known breached passwords, which are refused
+	Breached BreachedPasswords
+}
+
+// DefaultPasswordPolicy asks for 10 characters and checks the bundled list
+// of breached passwords
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 10, Breached: BundledBreachedPasswords()}
+
+// Check returns an error wrapping ErrWeakPassword that tells the user what
+// is wrong with the password, nil when the policy accepts it
+func (p PasswordPolicy) Check(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: password must be at least %d characters long", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > MaxPasswordBytes {
+		return fmt.Errorf("%w: password must be at most %d bytes long", ErrWeakPassword, MaxPasswordBytes)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("%w: password must not contain the username", ErrWeakPassword)
+	}
+	if p.Breached.Contains(password) {
+		return fmt.Errorf("%w: password appears in a list of breached passwords, choose another one", ErrWeakPassword)
+	}
+	return nil
+}
+
+// BreachedPasswords is a set of known breached passwords, compared case
+// insensitively
+type BreachedPasswords map[string]struct{}
+
+// Contains reports whether the password is in the set
+func (b BreachedPasswords) Contains(password string) bool {
+	_, ok := b[strings.ToLower(password)]
+	return ok
+}
+
+// ReadBreachedPasswords adds the passwords of r, one per line, to the set.
+// Blank lines and lines starting with # are skipped.
+func (b BreachedPasswords) ReadBreachedPasswords(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+var (
+	bundledOnce     sync.Once
+	bundledBreached BreachedPasswords
+)
+
+// BundledBreachedPasswords returns the breached passwords shipped with the
+// binary, the most common ones of public breach corpora. Callers must not
+// modify the set, copy it with Clone to add to it.
+func BundledBreachedPasswords() BreachedPasswords {
+	bundledOnce.Do(func() {
+		bundledBreached = make(BreachedPasswords)
+		// Reading from a string can not fail
+		_ = bundledBreached.ReadBreachedPasswords(strings.NewReader(bundledBreachedPasswords))
+	})
+	return bundledBreached
+}
+
+// Clone returns a copy of the set
+func (b BreachedPasswords) Clone() BreachedPasswords {
+	clone := make(BreachedPasswords, len(b))
+	for password := range b {
+		clone[password] = struct{}{}
+	}
+	return clone
+}
+
+// PasswordResetTTL is how long a password reset token is valid by default
+const PasswordResetTTL = time.Hour
+
+// PasswordResetCooldown is how long after mailing a reset token no other one
+// is mailed to the user by default
+const PasswordResetCooldown = time.Minute
+
+// NewPasswordResetToken returns a random opaque password reset token and the
+// hash to store for it. Reset tokens are built like refresh tokens.
+func NewPasswordResetToken() (token, hash string, err error) {
+	return NewRefreshToken()
+}
+
+// HashPasswordResetToken returns the hash stored for a password reset token
+func HashPasswordResetToken(token string) string {
+	return HashRefreshToken(token)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 10, Breached: BundledBreachedPasswords()}
+
+	tests := []struct {
+		name     string
+		password string
+		problem  string
+	}{
+		{"accepted", "correct horse battery", ""},
+		{"too short", "short", "at least 10 characters"},
+		{"length counts characters", "ééééééééé", "at least 10 characters"},
+		{"too long for bcrypt", strings.Repeat("x", 73), "at most 72 bytes"},
+		{"contains the username", "alice-is-great", "must not contain the username"},
+		{"breached", "password123", "breached passwords"},
+		{"breached in another case", "Password123", "breached passwords"},
+		{"breached variation", "Football2024", "breached passwords"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "Alice")
+			if tt.problem == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrWeakPassword)
+			assert.Contains(t, err.Error(), tt.problem)
+		})
+	}
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	bundled := BundledBreachedPasswords()
+	assert.True(t, bundled.Contains("qwertyuiop"))
+	assert.False(t, bundled.Contains("# Common passwords from public breach corpora and their usual variations,"))
+
+	extended := bundled.Clone()
+	assert.NoError(t, extended.ReadBreachedPasswords(strings.NewReader("# company words\n\n  Maintenance2025  \nacme-corp\n")))
+	assert.True(t, extended.Contains("maintenance2025"))
+	assert.True(t, extended.Contains("ACME-CORP"))
+	assert.False(t, bundled.Contains("acme-corp"))
+}
@@ -0,0 +1,205 @@
+// Package authz decides what an authenticated user may do.
+//
+// Roles are granted named permissions (models.Permission), loaded from the
+// role_permissions table. Route level checks only need the role and are done
+// by the Require middleware, checks against a resource, such as whether a
+// technician owns a task or reports to a manager, are centralised in the
+// Authorizer methods below.
+package authz
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// Subject is the authenticated user an action is checked for
+type Subject struct {
+	UserID int64
+	Role   models.Role
+	// Team holds the IDs of the users in the teams the subject manages,
+	// nested teams included. It is only consulted for :team permissions.
+	Team []int64
+	// Scopes, when not nil, limits the subject to these permissions on top of
+	// its role, as for requests made with an API key
+	Scopes []models.Permission
+}
+
+// scoped reports whether the scopes of the subject cover the permission,
+// with the same :any and :team variants as Authorizer.Can
+func (s Subject) scoped(permission models.Permission) bool {
+	if s.Scopes == nil {
+		return true
+	}
+	for _, scope := range s.Scopes {
+		if scope == permission || scope == permission.Team() || scope == permission.Any() {
+			return true
+		}
+	}
+	return false
+}
+
+// manages reports whether userID is in one of the teams of the subject
+func (s Subject) manages(userID int64) bool {
+	for _, id := range s.Team {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer holds the permissions granted to each role. It is safe for
+// concurrent use and can be reloaded while requests are served.
+type Authorizer struct {
+	mu     sync.RWMutex
+	grants map[models.Role]map[models.Permission]bool
+}
+
+// New creates an Authorizer with the given grants
+func New(grants map[models.Role][]models.Permission) *Authorizer {
+	a := &Authorizer{}
+	a.Set(grants)
+	return a
+}
+
+// Default creates an Authorizer with models.DefaultRolePermissions
+func Default() *Authorizer {
+	return New(models.DefaultRolePermissions)
+}
+
+// Set replaces the grants of every role
+func (a *Authorizer) Set(grants map[models.Role][]models.Permission) {
+	sets := make(map[models.Role]map[models.Permission]bool, len(grants))
+	for role, permissions := range grants {
+		sets[role] = make(map[models.Permission]bool, len(permissions))
+		for _, permission := range permissions {
+			sets[role][permission] = true
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.grants = sets
+}
+
+// Load replaces the grants with the ones stored in the repository
+func (a *Authorizer) Load(ctx context.Context, permissions repository.PermissionRepository) error {
+	grants, err := permissions.RolePermissions(ctx)
+	if err != nil {
+		return err
+	}
+	a.Set(grants)
+	return nil
+}
+
+// Can reports whether the role holds the permission. The :any variant of a
+// permission also grants its :team and :own variants, the :team variant its
+// :own variant.
+func (a *Authorizer) Can(role models.Role, permission models.Permission) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.grants[role][permission] || a.grants[role][permission.Team()] || a.grants[role][permission.Any()]
+}
+
+// Allows reports whether the role of the subject holds the permission and
+// its scopes, if any, cover it
+func (a *Authorizer) Allows(subject Subject, permission models.Permission) bool {
+	return subject.scoped(permission) && a.Can(subject.Role, permission)
+}
+
+// TeamScoped reports whether the role holds any :team permission, in which
+// case the checks need Subject.Team
+func (a *Authorizer) TeamScoped(role models.Role) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for permission := range a.grants[role] {
+		if strings.HasSuffix(string(permission), ":team") {
+			return true
+		}
+	}
+	return false
+}
+
+// owns checks a permission scoped to the owner of a resource: the :any
+// variant allows every resource, the :team variant the resources of the
+// subject's teams and the :own variant only the subject's own
+func (a *Authorizer) owns(subject Subject, own models.Permission, ownerID int64) bool {
+	if a.Allows(subject, own.Any()) {
+		return true
+	}
+	if subject.manages(ownerID) && a.Allows(subject, own.Team()) {
+		return true
+	}
+	return ownerID == subject.UserID && a.Allows(subject, own)
+}
+
+// CanReadTask reports whether the subject may see a task performed by ownerID
+// and its history
+func (a *Authorizer) CanReadTask(subject Subject, ownerID int64) bool {
+	return a.owns(subject, models.PermissionTaskReadOwn, ownerID)
+}
+
+// CanReadAllTasks reports whether the subject may list the tasks of every
+// technician rather than only their own or their team's
+func (a *Authorizer) CanReadAllTasks(subject Subject) bool {
+	return a.Allows(subject, models.PermissionTaskReadAny)
+}
+
+// TaskOwners returns the users whose tasks the subject may list, or nil when
+// it may list every task
+func (a *Authorizer) TaskOwners(subject Subject) []int64 {
+	if a.CanReadAllTasks(subject) {
+		return nil
+	}
+	owners := []int64{}
+	if a.Allows(subject, models.PermissionTaskReadOwn) {
+		owners = append(owners, subject.UserID)
+	}
+	if a.Allows(subject, models.PermissionTaskReadTeam) {
+		for _, id := range subject.Team {
+			if id != subject.UserID {
+				owners = append(owners, id)
+			}
+		}
+	}
+	return owners
+}
+
+// CanUpdateTask reports whether the subject may edit a task performed by ownerID
+func (a *Authorizer) CanUpdateTask(subject Subject, ownerID int64) bool {
+	return a.owns(subject, models.PermissionTaskUpdateOwn, ownerID)
+}
+
+// CanDeleteTask reports whether the subject may delete a task performed by ownerID
+func (a *Authorizer) CanDeleteTask(subject Subject, ownerID int64) bool {
+	if a.Allows(subject, models.PermissionTaskDeleteAny) {
+		return true
+	}
+	return subject.manages(ownerID) && a.Allows(subject, models.PermissionTaskDeleteTeam)
+}
+
+// CanDeleteComment reports whether the subject may delete a comment written
+// by authorID on a task performed by ownerID. Authors delete their own
+// comments and whoever may delete the task moderates its comments.
+func (a *Authorizer) CanDeleteComment(subject Subject, authorID, ownerID int64) bool {
+	return authorID == subject.UserID || a.CanDeleteTask(subject, ownerID)
+}
+
+// CanDeleteAttachment reports whether the subject may delete a file uploaded
+// by uploaderID to a task performed by ownerID, like comments
+func (a *Authorizer) CanDeleteAttachment(subject Subject, uploaderID, ownerID int64) bool {
+	return uploaderID == subject.UserID || a.CanDeleteTask(subject, ownerID)
+}
+
+// CanTransitionTask reports whether the subject may move a task performed by
+// ownerID into status next. Cancelling also needs models.PermissionTaskCancel.
+func (a *Authorizer) CanTransitionTask(subject Subject, ownerID int64, next models.TaskStatus) bool {
+	if next == models.StatusCancelled && !a.Allows(subject, models.PermissionTaskCancel) {
+		return false
+	}
+	return a.owns(subject, models.PermissionTaskTransitionOwn, ownerID)
+}
@@ -0,0 +1,202 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	a := Default()
+
+	tests := []struct {
+		role       models.Role
+		permission models.Permission
+		want       bool
+	}{
+		{models.RoleTechnician, models.PermissionTaskCreate, true},
+		{models.RoleTechnician, models.PermissionTaskReadOwn, true},
+		{models.RoleTechnician, models.PermissionTaskReadAny, false},
+		{models.RoleTechnician, models.PermissionTaskUpdateOwn, true},
+		{models.RoleTechnician, models.PermissionTaskUpdateAny, false},
+		{models.RoleTechnician, models.PermissionTaskCancel, false},
+		{models.RoleTechnician, models.PermissionTaskDeleteTeam, false},
+		{models.RoleTechnician, models.PermissionAssetRead, true},
+		{models.RoleTechnician, models.PermissionAssetManage, false},
+		{models.RoleTechnician, models.PermissionScheduleRead, false},
+		{models.RoleTechnician, models.PermissionUserManage, false},
+		{models.RoleManager, models.PermissionTaskCreate, false},
+		// :team grants imply the matching :own permission
+		{models.RoleManager, models.PermissionTaskReadOwn, true},
+		{models.RoleManager, models.PermissionTaskReadAny, false},
+		{models.RoleManager, models.PermissionTaskUpdateOwn, false},
+		{models.RoleManager, models.PermissionTaskTransitionOwn, true},
+		{models.RoleManager, models.PermissionTaskCancel, true},
+		{models.RoleManager, models.PermissionTaskDeleteTeam, true},
+		{models.RoleManager, models.PermissionTaskDeleteAny, false},
+		{models.RoleManager, models.PermissionTeamRead, true},
+		{models.RoleManager, models.PermissionTeamManage, false},
+		{models.RoleManager, models.PermissionAssetManage, true},
+		{models.RoleManager, models.PermissionScheduleManage, true},
+		{models.RoleManager, models.PermissionUserManage, false},
+		{models.RoleAdmin, models.PermissionUserManage, true},
+		{models.RoleTechnician, models.PermissionUserInvite, false},
+		{models.RoleManager, models.PermissionUserInvite, true},
+		{models.RoleAdmin, models.PermissionUserInvite, true},
+		// :any grants imply the matching :team and :own permissions
+		{models.RoleAdmin, models.PermissionTaskDeleteTeam, true},
+		{models.RoleAdmin, models.PermissionTaskReadOwn, true},
+		{models.RoleAdmin, models.PermissionTeamManage, true},
+		{models.RoleAdmin, models.PermissionTaskCreate, false},
+		{models.Role("guest"), models.PermissionTaskReadOwn, false},
+		{models.Role(""), models.PermissionAssetRead, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, a.Can(tt.role, tt.permission), "%s %s", tt.role, tt.permission)
+	}
+}
+
+func TestTaskMatrix(t *testing.T) {
+	a := Default()
+	technician := Subject{UserID: 1, Role: models.RoleTechnician}
+	// The manager manages a team made of themselves and the technician
+	manager := Subject{UserID: 2, Role: models.RoleManager, Team: []int64{1, 2}}
+	admin := Subject{UserID: 4, Role: models.RoleAdmin}
+	guest := Subject{UserID: 3, Role: models.Role("guest")}
+
+	// Each task is owned by the technician or by another user
+	const own, other = int64(1), int64(9)
+
+	type check struct {
+		name string
+		can  func(Subject, int64) bool
+	}
+	checks := []check{
+		{"read", a.CanReadTask},
+		{"update", a.CanUpdateTask},
+		{"complete", func(s Subject, owner int64) bool { return a.CanTransitionTask(s, owner, models.StatusCompleted) }},
+		{"cancel", func(s Subject, owner int64) bool { return a.CanTransitionTask(s, owner, models.StatusCancelled) }},
+	}
+
+	tests := []struct {
+		subject Subject
+		owner   int64
+		want    map[string]bool
+	}{
+		{technician, own, map[string]bool{"read": true, "update": true, "complete": true, "cancel": false}},
+		{technician, other, map[string]bool{"read": false, "update": false, "complete": false, "cancel": false}},
+		{manager, own, map[string]bool{"read": true, "update": false, "complete": true, "cancel": true}},
+		{manager, 2, map[string]bool{"read": true, "update": false, "complete": true, "cancel": true}},
+		{manager, other, map[string]bool{"read": false, "update": false, "complete": false, "cancel": false}},
+		{admin, other, map[string]bool{"read": true, "update": false, "complete": true, "cancel": true}},
+		{guest, 3, map[string]bool{"read": false, "update": false, "complete": false, "cancel": false}},
+		{guest, other, map[string]bool{"read": false, "update": false, "complete": false, "cancel": false}},
+	}
+	for _, tt := range tests {
+		for _, c := range checks {
+			name := fmt.Sprintf("%s %s task of user %d", tt.subject.Role, c.name, tt.owner)
+			t.Run(name, func(t *testing.T) {
+				assert.Equal(t, tt.want[c.name], c.can(tt.subject, tt.owner))
+			})
+		}
+	}
+
+	assert.False(t, a.CanReadAllTasks(technician))
+	assert.False(t, a.CanReadAllTasks(manager))
+	assert.True(t, a.CanReadAllTasks(admin))
+	assert.False(t, a.CanReadAllTasks(guest))
+
+	// Granting task:update:any lets managers edit every task
+	grants := map[models.Role][]models.Permission{
+		models.RoleManager: append(models.DefaultRolePermissions[models.RoleManager], models.PermissionTaskUpdateAny),
+	}
+	assert.True(t, New(grants).CanUpdateTask(manager, other))
+}
+
+func TestTeamScope(t *testing.T) {
+	a := Default()
+	technician := Subject{UserID: 1, Role: models.RoleTechnician, Team: []int64{5}}
+	manager := Subject{UserID: 2, Role: models.RoleManager, Team: []int64{1, 2, 3}}
+	lonely := Subject{UserID: 7, Role: models.RoleManager}
+	admin := Subject{UserID: 4, Role: models.RoleAdmin}
+
+	assert.False(t, a.TeamScoped(models.RoleTechnician))
+	assert.True(t, a.TeamScoped(models.RoleManager))
+	assert.False(t, a.TeamScoped(models.RoleAdmin))
+
+	t.Run("task owners", func(t *testing.T) {
+		assert.Equal(t, []int64{1}, a.TaskOwners(technician), "a team is ignored without :team permissions")
+		assert.Equal(t, []int64{2, 1, 3}, a.TaskOwners(manager))
+		assert.Equal(t, []int64{7}, a.TaskOwners(lonely))
+		assert.Nil(t, a.TaskOwners(admin))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.True(t, a.CanDeleteTask(manager, 3))
+		assert.False(t, a.CanDeleteTask(manager, 9))
+		assert.False(t, a.CanDeleteTask(lonely, 7), "deleting is not granted for own tasks")
+		assert.False(t, a.CanDeleteTask(technician, 5))
+		assert.True(t, a.CanDeleteTask(admin, 9))
+	})
+
+	t.Run("delete comments", func(t *testing.T) {
+		assert.True(t, a.CanDeleteComment(technician, 1, 9), "authors delete their own comments")
+		assert.False(t, a.CanDeleteComment(technician, 2, 1))
+		assert.True(t, a.CanDeleteComment(manager, 1, 3))
+		assert.False(t, a.CanDeleteComment(manager, 1, 9))
+		assert.True(t, a.CanDeleteComment(admin, 1, 9))
+	})
+
+	t.Run("delete attachments", func(t *testing.T) {
+		assert.True(t, a.CanDeleteAttachment(technician, 1, 9), "uploaders delete their own files")
+		assert.False(t, a.CanDeleteAttachment(technician, 2, 1))
+		assert.True(t, a.CanDeleteAttachment(manager, 1, 3))
+		assert.False(t, a.CanDeleteAttachment(manager, 1, 9))
+	})
+}
+
+func TestLoad(t *testing.T) {
+	permissions := repository.NewMemoryPermissionRepository()
+	a := Default()
+
+	// Revoking a grant in storage takes effect on the next load
+	permissions.SetRolePermissions(map[models.Role][]models.Permission{
+		models.RoleManager: {models.PermissionTaskReadAny},
+	})
+	assert.True(t, a.Can(models.RoleManager, models.PermissionTaskDeleteTeam))
+	assert.NoError(t, a.Load(context.Background(), permissions))
+	assert.False(t, a.Can(models.RoleManager, models.PermissionTaskDeleteTeam))
+	assert.True(t, a.Can(models.RoleManager, models.PermissionTaskReadAny))
+	assert.False(t, a.Can(models.RoleTechnician, models.PermissionTaskCreate))
+}
+
+func TestScopes(t *testing.T) {
+	a := Default()
+	manager := Subject{UserID: 2, Role: models.RoleManager, Team: []int64{1, 2}}
+	scoped := manager
+	scoped.Scopes = []models.Permission{models.PermissionTaskReadOwn}
+
+	// A scope never grants more than the role holds
+	assert.True(t, a.Allows(manager, models.PermissionTaskReadTeam))
+	assert.False(t, a.Allows(scoped, models.PermissionTaskReadTeam))
+	assert.True(t, a.Allows(scoped, models.PermissionTaskReadOwn))
+	assert.False(t, a.Allows(Subject{Role: models.RoleTechnician, Scopes: []models.Permission{models.PermissionTaskReadAny}}, models.PermissionTaskReadAny))
+
+	assert.Equal(t, []int64{2}, a.TaskOwners(scoped))
+	assert.True(t, a.CanReadTask(scoped, 2))
+	assert.False(t, a.CanReadTask(scoped, 1))
+	assert.False(t, a.CanUpdateTask(scoped, 2))
+
+	// The :any variant of a scope covers the :team and :own variants
+	scoped.Scopes = []models.Permission{models.PermissionTaskReadAny}
+	assert.True(t, a.Allows(scoped, models.PermissionTaskReadTeam))
+	assert.Equal(t, []int64{2, 1}, a.TaskOwners(scoped))
+
+	// An empty list of scopes allows nothing
+	scoped.Scopes = []models.Permission{}
+	assert.False(t, a.Allows(scoped, models.PermissionTaskReadOwn))
+}
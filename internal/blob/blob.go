@@ -0,0 +1,46 @@
+// Package blob stores the content of task attachments. The metadata lives in
+// the database, BlobStore keeps the bytes under opaque keys, either on the
+// local filesystem or in an S3 compatible bucket.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for an unknown key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps blobs under keys of slash separated segments of letters,
+// digits, dots, dashes and underscores
+type BlobStore interface {
+	// Put stores size bytes read from content under key, replacing any
+	// previous blob
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key, the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key, an unknown key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that could escape the store, such as ../ segments
+// on the filesystem, or that need escaping in a URL
+func validKey(key string) error {
+	if key == "" || len(key) > 1024 {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid blob key %q", key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBlobStore runs the behaviour every BlobStore shares
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	content := []byte("%PDF-1.7 signed service report")
+
+	t.Run("put and get", func(t *testing.T) {
+		assert.NoError(t, store.Put(ctx, "attachments/report", bytes.NewReader(content), int64(len(content)), "application/pdf"))
+
+		reader, err := store.Get(ctx, "attachments/report")
+		if assert.NoError(t, err) {
+			defer reader.Close()
+			got, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, content, got)
+		}
+	})
+
+	t.Run("put replaces", func(t *testing.T) {
+		assert.NoError(t, store.Put(ctx, "attachments/report", bytes.NewReader([]byte("v2")), 2, "application/pdf"))
+
+		reader, err := store.Get(ctx, "attachments/report")
+		if assert.NoError(t, err) {
+			defer reader.Close()
+			got, _ := io.ReadAll(reader)
+			assert.Equal(t, "v2", string(got))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, store.Delete(ctx, "attachments/report"))
+		_, err := store.Get(ctx, "attachments/report")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Deleting twice is not an error
+		assert.NoError(t, store.Delete(ctx, "attachments/report"))
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, key := range []string{"", "../secret", "attachments/../../secret", "/absolute", "a//b", "a b", "a/"} {
+			assert.Error(t, store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), ""), key)
+			_, err := store.Get(ctx, key)
+			assert.Error(t, err, key)
+			assert.NotErrorIs(t, err, ErrNotFound, key)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+// Package blobtest runs a stand-in for an S3 compatible service in tests. It
+// keeps objects in memory and serves one bucket with path-style addressing.
+package blobtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// S3Server is an S3 compatible service on an httptest server supporting
+// PutObject, GetObject and DeleteObject. Requests must carry a Signature
+// Version 4 Authorization header for AccessKeyID, the signature itself is
+// not verified.
+type S3Server struct {
+	*httptest.Server
+	Bucket      string
+	AccessKeyID string
+
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// Object is an object stored in an S3Server
+type Object struct {
+	Content     []byte
+	ContentType string
+}
+
+// NewS3Server starts a server for one bucket, the caller closes it
+func NewS3Server(bucket, accessKeyID string) *S3Server {
+	s := &S3Server{
+		Bucket:      bucket,
+		AccessKeyID: accessKeyID,
+		objects:     make(map[string]Object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Object returns the object stored under key
+func (s *S3Server) Object(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+// Keys returns the keys of every stored object in order
+func (s *S3Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *S3Server) serve(w http.ResponseWriter, r *http.Request) {
+	credential := "AWS4-HMAC-SHA256 Credential=" + s.AccessKeyID + "/"
+	if !strings.HasPrefix(r.Header.Get("Authorization"), credential) || r.Header.Get("X-Amz-Date") == "" ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(content)) != r.ContentLength {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = Object{Content: content, ContentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.ContentType)
+		w.Write(object.Content)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// writeError answers with an S3 XML error document
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code></Error>`, code)
+}
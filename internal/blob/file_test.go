@@ -0,0 +1,28 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "attachments")
+	store := NewFileStore(dir)
+	testBlobStore(t, store)
+
+	t.Run("short content is not stored", func(t *testing.T) {
+		err := store.Put(context.Background(), "short", bytes.NewReader([]byte("abc")), 10, "text/plain")
+		assert.Error(t, err)
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		for _, entry := range entries {
+			assert.NotEqual(t, "short", entry.Name())
+			assert.NotContains(t, entry.Name(), ".upload-")
+		}
+	})
+}
@@ -0,0 +1,497 @@
+// Package config loads the application configuration into a typed struct.
+//
+// Values are resolved from, in increasing precedence, the defaults below, an
+// optional YAML file, environment variables and command line flags. The
+// result is validated as a whole so every problem is reported at once.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete application configuration. The yaml tag names the
+// key in the configuration file, env the environment variable and flag the
+// command line flag a field can be set with.
+type Config struct {
+	// Storage is the repository backend, mysql or memory
+	Storage     string      `yaml:"storage" env:"STORAGE" flag:"storage" usage:"Storage backend: mysql or memory"`
+	Server      Server      `yaml:"server"`
+	Database    Database    `yaml:"database"`
+	Log         Log         `yaml:"log"`
+	JWT         JWT         `yaml:"jwt"`
+	Auth        Auth        `yaml:"auth"`
+	Notify      Notify      `yaml:"notify"`
+	Events      Events      `yaml:"events"`
+	Encryption  Encryption  `yaml:"encryption"`
+	Attachments Attachments `yaml:"attachments"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port            int           `yaml:"port" env:"APP_PORT_HOST" flag:"port" usage:"Port the HTTP server listens on"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// Addr returns the listen address of the server
+func (s Server) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+// Database configures the MySQL connection
+type Database struct {
+	Host     string `yaml:"host" env:"DB_HOST"`
+	Port     int    `yaml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password Secret `yaml:"password" env:"DB_PASSWORD"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	// AutoMigrate applies pending migrations before the server starts
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" flag:"migrate" usage:"Apply pending database migrations before starting the server"`
+}
+
+// DSN returns the go-sql-driver/mysql data source name
+func (d Database) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Password.Value(), d.Host, d.Port, d.Name)
+}
+
+// Log configures the application logger
+type Log struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is json or text
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// JWT configures the access token signing keys
+type JWT struct {
+	// KeyFiles is a comma separated list of id:path pairs of PEM files
+	KeyFiles string `yaml:"key_files" env:"JWT_KEY_FILES"`
+	// Keys is a comma separated list of id:base64pem pairs
+	Keys Secret `yaml:"keys" env:"JWT_KEYS"`
+	// SigningKeyID is the key new tokens are signed with
+	SigningKeyID string `yaml:"signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+}
+
+// Auth configures how accounts are created
+type Auth struct {
+	// Registration is invite, every user needs an invitation, or open,
+	// technicians may register without one
+	Registration string `yaml:"registration" env:"AUTH_REGISTRATION"`
+	// SignupURL is the frontend page invitation links point to, the token is
+	// appended as the token query parameter
+	SignupURL string   `yaml:"signup_url" env:"AUTH_SIGNUP_URL"`
+	Lockout   Lockout  `yaml:"lockout"`
+	MFA       MFA      `yaml:"mfa"`
+	Password  Password `yaml:"password"`
+	OIDC      OIDC     `yaml:"oidc"`
+}
+
+// OIDC configures login through an OpenID Connect provider, which is off
+// while IssuerURL is empty
+type OIDC struct {
+	// IssuerURL is the issuer of the provider, its metadata is discovered
+	// from IssuerURL/.well-known/openid-configuration
+	IssuerURL    string `yaml:"issuer_url" env:"AUTH_OIDC_ISSUER_URL"`
+	ClientID     string `yaml:"client_id" env:"AUTH_OIDC_CLIENT_ID"`
+	ClientSecret Secret `yaml:"client_secret" env:"AUTH_OIDC_CLIENT_SECRET"`
+	// RedirectURL is the /oidc/callback URL of the API as registered at the provider
+	RedirectURL string `yaml:"redirect_url" env:"AUTH_OIDC_REDIRECT_URL"`
+	// Scopes are requested on top of openid
+	Scopes []string `yaml:"scopes" env:"AUTH_OIDC_SCOPES"`
+	// GroupsClaim is the ID token claim listing the groups of the user
+	GroupsClaim string `yaml:"groups_claim" env:"AUTH_OIDC_GROUPS_CLAIM"`
+	// RoleMapping lists group=role pairs, users in several mapped groups
+	// get the highest role
+	RoleMapping []string `yaml:"role_mapping" env:"AUTH_OIDC_ROLE_MAPPING"`
+	// DefaultRole is the role of provisioned users in no mapped group, empty
+	// refuses them
+	DefaultRole string `yaml:"default_role" env:"AUTH_OIDC_DEFAULT_ROLE"`
+	// Provision creates a user on the first login of an account no user is
+	// linked to
+	Provision bool `yaml:"provision" env:"AUTH_OIDC_PROVISION"`
+	// Organization is the slug of the organization provisioned users join,
+	// the default one when empty
+	Organization string `yaml:"organization" env:"AUTH_OIDC_ORGANIZATION"`
+}
+
+// Roles returns RoleMapping as a map from group to role, skipping malformed
+// entries which Validate reports
+func (o OIDC) Roles() map[string]string {
+	roles := make(map[string]string)
+	for _, entry := range o.RoleMapping {
+		if group, role, ok := strings.Cut(entry, "="); ok && group != "" {
+			roles[group] = role
+		}
+	}
+	return roles
+}
+
+// Password configures the password policy and the password reset flow
+type Password struct {
+	// MinLength is the minimum number of characters of a password
+	MinLength int `yaml:"min_length" env:"AUTH_PASSWORD_MIN_LENGTH"`
+	// BreachedListFile names a file of breached passwords, one per line,
+	// refused on top of the bundled list
+	BreachedListFile string `yaml:"breached_list_file" env:"AUTH_PASSWORD_BREACHED_LIST_FILE"`
+	// ResetTTL is how long a password reset token can be used
+	ResetTTL time.Duration `yaml:"reset_ttl" env:"AUTH_PASSWORD_RESET_TTL"`
+	// ResetURL is the frontend page reset links point to, the token is
+	// appended as the token query parameter. Reset mails carry the bare
+	// token without it.
+	ResetURL string `yaml:"reset_url" env:"AUTH_PASSWORD_RESET_URL"`
+	// Mailer sends the reset mails: log only logs them, smtp sends them
+	// through the notify.smtp server
+	Mailer string `yaml:"mailer" env:"AUTH_PASSWORD_MAILER"`
+}
+
+// MFA configures two-factor authentication
+type MFA struct {
+	// RequiredRoles lists the roles that must log in with a second factor,
+	// their tokens from logins without one only allow enrolling
+	RequiredRoles []string `yaml:"required_roles" env:"AUTH_MFA_REQUIRED_ROLES"`
+	// Issuer names the service in authenticator apps
+	Issuer string `yaml:"issuer" env:"AUTH_MFA_ISSUER"`
+}
+
+// Lockout configures how long /login is refused after consecutive failures
+// for a username or from a client address. The lockout starts at BaseDelay
+// and doubles with every further failure, up to MaxDelay.
+type Lockout struct {
+	// UsernameThreshold is the number of failures for a username before it is locked out
+	UsernameThreshold int `yaml:"username_threshold" env:"AUTH_LOCKOUT_USERNAME_THRESHOLD"`
+	// AddressThreshold is the number of failures from a client address before it is locked out
+	AddressThreshold int           `yaml:"address_threshold" env:"AUTH_LOCKOUT_ADDRESS_THRESHOLD"`
+	BaseDelay        time.Duration `yaml:"base_delay" env:"AUTH_LOCKOUT_BASE_DELAY"`
+	MaxDelay         time.Duration `yaml:"max_delay" env:"AUTH_LOCKOUT_MAX_DELAY"`
+	// TrustForwardedFor takes the client address from the last X-Forwarded-For
+	// entry, set it when the API is only reachable through a reverse proxy
+	TrustForwardedFor bool `yaml:"trust_forwarded_for" env:"AUTH_LOCKOUT_TRUST_FORWARDED_FOR"`
+}
+
+// Notify configures the manager notification sinks
+type Notify struct {
+	// Sinks lists the enabled sinks: log, smtp and webhook
+	Sinks      []string `yaml:"sinks" env:"NOTIFY_SINKS"`
+	SMTP       SMTP     `yaml:"smtp"`
+	WebhookURL string   `yaml:"webhook_url" env:"NOTIFY_WEBHOOK_URL"`
+}
+
+// SMTP configures the mail server used by the smtp sink
+type SMTP struct {
+	Addr     string `yaml:"addr" env:"SMTP_ADDR"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password Secret `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// Events configures the task event publisher
+type Events struct {
+	// Publisher is none, inprocess or amqp
+	Publisher string `yaml:"publisher" env:"EVENTS_PUBLISHER"`
+	// AMQPURL usually carries the broker credentials
+	AMQPURL      Secret `yaml:"amqp_url" env:"AMQP_URL"`
+	AMQPExchange string `yaml:"amqp_exchange" env:"AMQP_EXCHANGE"`
+}
+
+// Encryption configures the task summary encryption at rest
+type Encryption struct {
+	// TaskSummaryKeys is a comma separated list of id:base64key pairs, empty to disable encryption
+	TaskSummaryKeys       Secret `yaml:"task_summary_keys" env:"TASK_SUMMARY_KEYS"`
+	TaskSummaryPrimaryKey string `yaml:"task_summary_primary_key" env:"TASK_SUMMARY_PRIMARY_KEY"`
+}
+
+// Attachments configures the files attached to tasks and where they are stored
+type Attachments struct {
+	// Store is local, files under Dir, or s3, objects in an S3 compatible bucket
+	Store string `yaml:"store" env:"ATTACHMENTS_STORE"`
+	Dir   string `yaml:"dir" env:"ATTACHMENTS_DIR"`
+	S3    S3     `yaml:"s3"`
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int `yaml:"max_size" env:"ATTACHMENTS_MAX_SIZE"`
+	// URLSecret signs the download links, a random secret is generated when
+	// empty so links do not survive a restart
+	URLSecret Secret `yaml:"url_secret" env:"ATTACHMENTS_URL_SECRET"`
+	// URLTTL is how long a download link can be used
+	URLTTL time.Duration `yaml:"url_ttl" env:"ATTACHMENTS_URL_TTL"`
+}
+
+// S3 configures the bucket of the s3 attachment store
+type S3 struct {
+	// Endpoint is the base URL of the service, such as https://s3.eu-west-1.amazonaws.com
+	Endpoint        string `yaml:"endpoint" env:"ATTACHMENTS_S3_ENDPOINT"`
+	Region          string `yaml:"region" env:"ATTACHMENTS_S3_REGION"`
+	Bucket          string `yaml:"bucket" env:"ATTACHMENTS_S3_BUCKET"`
+	AccessKeyID     string `yaml:"access_key_id" env:"ATTACHMENTS_S3_ACCESS_KEY_ID"`
+	SecretAccessKey Secret `yaml:"secret_access_key" env:"ATTACHMENTS_S3_SECRET_ACCESS_KEY"`
+	// PathStyle addresses the bucket in the path rather than the host name,
+	// as most self-hosted services expect
+	PathStyle bool `yaml:"path_style" env:"ATTACHMENTS_S3_PATH_STYLE"`
+}
+
+// Default returns the configuration used for every value that is not set
+func Default() *Config {
+	return &Config{
+		Storage: "mysql",
+		Server: Server{
+			Port:            8080,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			Host: "127.0.0.1",
+			Port: 3306,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Auth: Auth{
+			Registration: "invite",
+			Lockout: Lockout{
+				UsernameThreshold: 5,
+				AddressThreshold:  20,
+				BaseDelay:         time.Minute,
+				MaxDelay:          time.Hour,
+			},
+			MFA: MFA{
+				Issuer: "Maintenance API",
+			},
+			Password: Password{
+				MinLength: 10,
+				ResetTTL:  time.Hour,
+				Mailer:    "log",
+			},
+			OIDC: OIDC{
+				Scopes:      []string{"email", "profile"},
+				GroupsClaim: "groups",
+				DefaultRole: "technician",
+				Provision:   true,
+			},
+		},
+		Notify: Notify{
+			Sinks: []string{"log"},
+			SMTP: SMTP{
+				From: "maintenance-api@localhost",
+			},
+		},
+		Events: Events{
+			Publisher:    "none",
+			AMQPExchange: "maintenance.tasks",
+		},
+		Attachments: Attachments{
+			Store:   "local",
+			Dir:     "data/attachments",
+			MaxSize: 10 << 20,
+			URLTTL:  15 * time.Minute,
+			S3: S3{
+				Region: "us-east-1",
+			},
+		},
+	}
+}
+
+// Validate checks the whole configuration and reports every problem found
+func (c *Config) Validate() error {
+	var problems []error
+	invalid := func(key, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	oneOf(invalid, "storage", c.Storage, "mysql", "memory")
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			invalid(timeout.key, "must be positive, got %s", timeout.value)
+		}
+	}
+
+	if c.Storage == "mysql" {
+		if c.Database.Host == "" {
+			invalid("database.host", "is required for mysql storage")
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			invalid("database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+		}
+		if c.Database.User == "" {
+			invalid("database.user", "is required for mysql storage")
+		}
+		if c.Database.Name == "" {
+			invalid("database.name", "is required for mysql storage")
+		}
+	}
+
+	oneOf(invalid, "log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf(invalid, "log.format", c.Log.Format, "json", "text")
+
+	if (c.JWT.KeyFiles != "" || c.JWT.Keys != "") && c.JWT.SigningKeyID == "" {
+		invalid("jwt.signing_key_id", "is required when signing keys are configured")
+	}
+
+	oneOf(invalid, "auth.registration", c.Auth.Registration, "invite", "open")
+	if c.Auth.SignupURL != "" {
+		if u, err := url.Parse(c.Auth.SignupURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("auth.signup_url", "must be an http or https URL")
+		}
+	}
+	if c.Auth.Lockout.UsernameThreshold < 1 {
+		invalid("auth.lockout.username_threshold", "must be positive, got %d", c.Auth.Lockout.UsernameThreshold)
+	}
+	if c.Auth.Lockout.AddressThreshold < 1 {
+		invalid("auth.lockout.address_threshold", "must be positive, got %d", c.Auth.Lockout.AddressThreshold)
+	}
+	if c.Auth.Lockout.BaseDelay <= 0 {
+		invalid("auth.lockout.base_delay", "must be positive, got %s", c.Auth.Lockout.BaseDelay)
+	} else if c.Auth.Lockout.MaxDelay < c.Auth.Lockout.BaseDelay {
+		invalid("auth.lockout.max_delay", "must not be shorter than auth.lockout.base_delay, got %s", c.Auth.Lockout.MaxDelay)
+	}
+	for _, role := range c.Auth.MFA.RequiredRoles {
+		oneOf(invalid, "auth.mfa.required_roles", role, "technician", "manager", "admin")
+	}
+	if c.Auth.MFA.Issuer == "" {
+		invalid("auth.mfa.issuer", "is required")
+	}
+	if c.Auth.Password.MinLength < 8 || c.Auth.Password.MinLength > 72 {
+		invalid("auth.password.min_length", "must be between 8 and 72, got %d", c.Auth.Password.MinLength)
+	}
+	if c.Auth.Password.ResetTTL <= 0 {
+		invalid("auth.password.reset_ttl", "must be positive, got %s", c.Auth.Password.ResetTTL)
+	}
+	if c.Auth.Password.ResetURL != "" {
+		if u, err := url.Parse(c.Auth.Password.ResetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("auth.password.reset_url", "must be an http or https URL")
+		}
+	}
+	oneOf(invalid, "auth.password.mailer", c.Auth.Password.Mailer, "log", "smtp")
+	if c.Auth.Password.Mailer == "smtp" && c.Notify.SMTP.Addr == "" {
+		invalid("notify.smtp.addr", "is required for the smtp password mailer")
+	}
+	if oidc := c.Auth.OIDC; oidc.IssuerURL != "" {
+		if u, err := url.Parse(oidc.IssuerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("auth.oidc.issuer_url", "must be an http or https URL")
+		}
+		if oidc.ClientID == "" {
+			invalid("auth.oidc.client_id", "is required with an issuer")
+		}
+		if u, err := url.Parse(oidc.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("auth.oidc.redirect_url", "must be an http or https URL")
+		}
+		if oidc.GroupsClaim == "" && len(oidc.RoleMapping) > 0 {
+			invalid("auth.oidc.groups_claim", "is required with a role mapping")
+		}
+		for _, entry := range oidc.RoleMapping {
+			group, role, ok := strings.Cut(entry, "=")
+			if !ok || group == "" {
+				invalid("auth.oidc.role_mapping", "entries must be group=role, got %q", entry)
+				continue
+			}
+			oneOf(invalid, "auth.oidc.role_mapping", role, "technician", "manager", "admin")
+		}
+		if oidc.DefaultRole != "" {
+			oneOf(invalid, "auth.oidc.default_role", oidc.DefaultRole, "technician", "manager", "admin")
+		}
+	}
+
+	for _, sink := range c.Notify.Sinks {
+		switch sink {
+		case "log":
+		case "smtp":
+			if c.Notify.SMTP.Addr == "" {
+				invalid("notify.smtp.addr", "is required for the smtp sink")
+			}
+		case "webhook":
+			if u, err := url.Parse(c.Notify.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				invalid("notify.webhook_url", "must be an http or https URL for the webhook sink")
+			}
+		default:
+			invalid("notify.sinks", "unknown sink %q, must be one of log, smtp or webhook", sink)
+		}
+	}
+
+	oneOf(invalid, "events.publisher", c.Events.Publisher, "none", "inprocess", "amqp")
+	if c.Events.Publisher == "amqp" {
+		if c.Events.AMQPURL == "" {
+			invalid("events.amqp_url", "is required for the amqp publisher")
+		}
+		if c.Events.AMQPExchange == "" {
+			invalid("events.amqp_exchange", "is required for the amqp publisher")
+		}
+	}
+
+	if c.Encryption.TaskSummaryKeys != "" && c.Encryption.TaskSummaryPrimaryKey == "" {
+		invalid("encryption.task_summary_primary_key", "is required when task summary keys are configured")
+	}
+
+	switch c.Attachments.Store {
+	case "local":
+		if c.Attachments.Dir == "" {
+			invalid("attachments.dir", "is required for the local store")
+		}
+	case "s3":
+		s3 := c.Attachments.S3
+		if u, err := url.Parse(s3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("attachments.s3.endpoint", "must be an http or https URL for the s3 store")
+		}
+		for _, required := range []struct {
+			key   string
+			value string
+		}{
+			{"attachments.s3.region", s3.Region},
+			{"attachments.s3.bucket", s3.Bucket},
+			{"attachments.s3.access_key_id", s3.AccessKeyID},
+			{"attachments.s3.secret_access_key", s3.SecretAccessKey.Value()},
+		} {
+			if required.value == "" {
+				invalid(required.key, "is required for the s3 store")
+			}
+		}
+	default:
+		oneOf(invalid, "attachments.store", c.Attachments.Store, "local", "s3")
+	}
+	if c.Attachments.MaxSize < 1 {
+		invalid("attachments.max_size", "must be positive, got %d", c.Attachments.MaxSize)
+	}
+	if c.Attachments.URLTTL <= 0 {
+		invalid("attachments.url_ttl", "must be positive, got %s", c.Attachments.URLTTL)
+	}
+
+	return errors.Join(problems...)
+}
+
+func oneOf(invalid func(key, format string, args ...interface{}), key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	invalid(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// String renders the configuration as YAML with every secret redacted
+func (c *Config) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("error rendering configuration: %v", err)
+	}
+	return string(out)
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a lookup function over a fixed set of variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+// baseEnv is the minimum needed for a valid mysql configuration
+func baseEnv() map[string]string {
+	return map[string]string{"DB_USER": "user", "DB_NAME": "tasks_db"}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, args, err := Load(nil, env(baseEnv()))
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, "mysql", cfg.Storage)
+	assert.Equal(t, ":8080", cfg.Server.Addr())
+	assert.Equal(t, 15*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, "user:@tcp(127.0.0.1:3306)/tasks_db", cfg.Database.DSN())
+	assert.Equal(t, []string{"log"}, cfg.Notify.Sinks)
+	assert.Equal(t, "none", cfg.Events.Publisher)
+	assert.Equal(t, "invite", cfg.Auth.Registration)
+	assert.Equal(t, 5, cfg.Auth.Lockout.UsernameThreshold)
+	assert.Equal(t, time.Hour, cfg.Auth.Lockout.MaxDelay)
+	assert.Empty(t, cfg.Auth.MFA.RequiredRoles)
+	assert.Equal(t, "Maintenance API", cfg.Auth.MFA.Issuer)
+	assert.Equal(t, 10, cfg.Auth.Password.MinLength)
+	assert.Equal(t, time.Hour, cfg.Auth.Password.ResetTTL)
+	assert.Equal(t, "log", cfg.Auth.Password.Mailer)
+	assert.Empty(t, cfg.Auth.OIDC.IssuerURL)
+	assert.Equal(t, []string{"email", "profile"}, cfg.Auth.OIDC.Scopes)
+	assert.True(t, cfg.Auth.OIDC.Provision)
+	assert.Equal(t, "local", cfg.Attachments.Store)
+	assert.Equal(t, 10<<20, cfg.Attachments.MaxSize)
+	assert.Equal(t, 15*time.Minute, cfg.Attachments.URLTTL)
+}
+
+func TestAttachments(t *testing.T) {
+	vars := baseEnv()
+	vars["ATTACHMENTS_STORE"] = "s3"
+	vars["ATTACHMENTS_S3_ENDPOINT"] = "https://s3.eu-west-1.amazonaws.com"
+	vars["ATTACHMENTS_S3_REGION"] = "eu-west-1"
+	vars["ATTACHMENTS_S3_BUCKET"] = "maintenance-attachments"
+	vars["ATTACHMENTS_S3_ACCESS_KEY_ID"] = "AKIAEXAMPLE"
+	vars["ATTACHMENTS_S3_SECRET_ACCESS_KEY"] = "s3-secret"
+	vars["ATTACHMENTS_URL_SECRET"] = "url-secret"
+	cfg, _, err := Load(nil, env(vars))
+	assert.NoError(t, err)
+	assert.Equal(t, "maintenance-attachments", cfg.Attachments.S3.Bucket)
+	assert.NotContains(t, cfg.String(), "s3-secret")
+	assert.NotContains(t, cfg.String(), "url-secret")
+
+	vars["ATTACHMENTS_S3_ENDPOINT"] = "s3.eu-west-1.amazonaws.com"
+	vars["ATTACHMENTS_S3_BUCKET"] = ""
+	vars["ATTACHMENTS_MAX_SIZE"] = "0"
+	_, _, err = Load(nil, env(vars))
+	assert.Error(t, err)
+	for _, problem := range []string{
+		"attachments.s3.endpoint: must be an http or https URL for the s3 store",
+		"attachments.s3.bucket: is required for the s3 store",
+		"attachments.max_size: must be positive, got 0",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	vars["ATTACHMENTS_STORE"] = "gcs"
+	_, _, err = Load(nil, env(vars))
+	assert.ErrorContains(t, err, `attachments.store: must be one of local, s3, got "gcs"`)
+}
+
+func TestOIDC(t *testing.T) {
+	vars := baseEnv()
+	vars["AUTH_OIDC_ISSUER_URL"] = "https://idp.example.com/realms/maintenance"
+	vars["AUTH_OIDC_CLIENT_ID"] = "maintenance-api"
+	vars["AUTH_OIDC_CLIENT_SECRET"] = "oidc-secret"
+	vars["AUTH_OIDC_REDIRECT_URL"] = "https://api.example.com/oidc/callback"
+	vars["AUTH_OIDC_ROLE_MAPPING"] = "maint-admins=admin, maint-managers=manager"
+	cfg, _, err := Load(nil, env(vars))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"maint-admins": "admin", "maint-managers": "manager"}, cfg.Auth.OIDC.Roles())
+	assert.NotContains(t, cfg.String(), "oidc-secret")
+
+	vars["AUTH_OIDC_CLIENT_ID"] = ""
+	vars["AUTH_OIDC_REDIRECT_URL"] = "/oidc/callback"
+	vars["AUTH_OIDC_ROLE_MAPPING"] = "maint-admins=owner,maint-managers"
+	vars["AUTH_OIDC_DEFAULT_ROLE"] = "guest"
+	_, _, err = Load(nil, env(vars))
+	assert.Error(t, err)
+	for _, problem := range []string{
+		"auth.oidc.client_id: is required with an issuer",
+		"auth.oidc.redirect_url: must be an http or https URL",
+		`auth.oidc.role_mapping: must be one of technician, manager, admin, got "owner"`,
+		`auth.oidc.role_mapping: entries must be group=role, got "maint-managers"`,
+		`auth.oidc.default_role: must be one of technician, manager, admin, got "guest"`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+storage: memory
+server:
+  port: 9000
+  read_timeout: 5s
+database:
+  host: db.internal
+  user: file_user
+  name: file_db
+notify:
+  sinks: [log, webhook]
+  webhook_url: https://hooks.example.com/tasks
+`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		cfg, _, err := Load([]string{"--config", path}, env(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "memory", cfg.Storage)
+		assert.Equal(t, 9000, cfg.Server.Port)
+		assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+		assert.Equal(t, 15*time.Second, cfg.Server.WriteTimeout)
+		assert.Equal(t, "db.internal", cfg.Database.Host)
+		assert.Equal(t, []string{"log", "webhook"}, cfg.Notify.Sinks)
+	})
+
+	t.Run("environment overrides the file", func(t *testing.T) {
+		cfg, _, err := Load(nil, env(map[string]string{
+			"CONFIG_FILE":   path,
+			"APP_PORT_HOST": "9100",
+			"DB_HOST":       "db.env",
+			"NOTIFY_SINKS":  "log, smtp",
+			"SMTP_ADDR":     "mail:25",
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, 9100, cfg.Server.Port)
+		assert.Equal(t, "db.env", cfg.Database.Host)
+		assert.Equal(t, "file_user", cfg.Database.User)
+		assert.Equal(t, []string{"log", "smtp"}, cfg.Notify.Sinks)
+	})
+
+	t.Run("flags override the environment", func(t *testing.T) {
+		cfg, args, err := Load([]string{"--config", path, "--storage=mysql", "--port", "9200", "--migrate", "migrate", "up"},
+			env(map[string]string{"STORAGE": "memory", "APP_PORT_HOST": "9100", "DB_AUTO_MIGRATE": "false"}))
+		assert.NoError(t, err)
+		assert.Equal(t, "mysql", cfg.Storage)
+		assert.Equal(t, 9200, cfg.Server.Port)
+		assert.True(t, cfg.Database.AutoMigrate)
+		assert.Equal(t, []string{"migrate", "up"}, args)
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Run("problems are reported together", func(t *testing.T) {
+		_, _, err := Load(nil, env(map[string]string{
+			"APP_PORT_HOST":            "0",
+			"DB_USER":                  "",
+			"LOG_LEVEL":                "verbose",
+			"NOTIFY_SINKS":             "log,pager",
+			"EVENTS_PUBLISHER":         "amqp",
+			"TASK_SUMMARY_KEYS":        "k1:c2VjcmV0",
+			"SERVER_IDLE_TIMEOUT":      "0s",
+			"AUTH_REGISTRATION":        "closed",
+			"AUTH_SIGNUP_URL":          "app.example.com/signup",
+			"AUTH_LOCKOUT_MAX_DELAY":   "30s",
+			"AUTH_MFA_REQUIRED_ROLES":  "admin,owner",
+			"AUTH_PASSWORD_MIN_LENGTH": "6",
+			"AUTH_PASSWORD_RESET_URL":  "ftp://app.example.com/reset",
+			"AUTH_PASSWORD_MAILER":     "smtp",
+		}))
+		assert.Error(t, err)
+		for _, problem := range []string{
+			"server.port: must be between 1 and 65535, got 0",
+			"server.idle_timeout: must be positive",
+			"database.user: is required for mysql storage",
+			"database.name: is required for mysql storage",
+			`log.level: must be one of debug, info, warn, error, got "verbose"`,
+			`auth.registration: must be one of invite, open, got "closed"`,
+			"auth.signup_url: must be an http or https URL",
+			"auth.lockout.max_delay: must not be shorter than auth.lockout.base_delay",
+			`auth.mfa.required_roles: must be one of technician, manager, admin, got "owner"`,
+			"auth.password.min_length: must be between 8 and 72, got 6",
+			"auth.password.reset_url: must be an http or https URL",
+			"notify.smtp.addr: is required for the smtp password mailer",
+			`notify.sinks: unknown sink "pager"`,
+			"events.amqp_url: is required for the amqp publisher",
+			"encryption.task_summary_primary_key: is required",
+		} {
+			assert.Contains(t, err.Error(), problem)
+		}
+	})
+
+	t.Run("malformed values name the variable", func(t *testing.T) {
+		vars := baseEnv()
+		vars["DB_PORT"] = "mysql"
+		vars["SERVER_READ_TIMEOUT"] = "10"
+		_, _, err := Load([]string{"--migrate=maybe"}, env(vars))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `database.port: invalid DB_PORT: "mysql" is not a number`)
+		assert.Contains(t, err.Error(), "server.read_timeout: invalid SERVER_READ_TIMEOUT")
+		assert.Contains(t, err.Error(), `database.auto_migrate: invalid --migrate: "maybe" is not a boolean`)
+	})
+
+	t.Run("unknown keys in the file are rejected", func(t *testing.T) {
+		path := writeFile(t, "server:\n  prot: 9000\n")
+		_, _, err := Load([]string{"--config", path}, env(baseEnv()))
+		assert.ErrorContains(t, err, "field prot not found")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, env(baseEnv()))
+		assert.ErrorContains(t, err, "reading configuration file")
+	})
+
+	t.Run("help", func(t *testing.T) {
+		// Silence the usage printed by the flag set
+		stderr := os.Stderr
+		os.Stderr, _ = os.Open(os.DevNull)
+		defer func() { os.Stderr = stderr }()
+
+		_, _, err := Load([]string{"-h"}, env(baseEnv()))
+		assert.ErrorIs(t, err, flag.ErrHelp)
+	})
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	vars := baseEnv()
+	vars["DB_PASSWORD"] = "hunter2"
+	vars["SMTP_PASSWORD"] = "mail-secret"
+	vars["JWT_KEYS"] = "k1:cGVt"
+	vars["JWT_SIGNING_KEY_ID"] = "k1"
+	cfg, _, err := Load(nil, env(vars))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "hunter2", cfg.Database.Password.Value())
+	assert.Contains(t, cfg.Database.DSN(), "hunter2")
+
+	for _, printed := range []string{
+		cfg.String(),
+		fmt.Sprintf("%v", cfg),
+		fmt.Sprintf("%+v", *cfg),
+		fmt.Sprintf("%#v", cfg.Database),
+	} {
+		assert.NotContains(t, printed, "hunter2")
+		assert.NotContains(t, printed, "mail-secret")
+		assert.NotContains(t, printed, "cGVt")
+		assert.Contains(t, printed, redacted)
+	}
+
+	// Unset secrets stay visibly unset
+	assert.True(t, strings.Contains(cfg.String(), "amqp_url: \"\""))
+}
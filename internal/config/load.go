@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from, in increasing precedence, the defaults,
+// the YAML file named by the --config flag or CONFIG_FILE, the environment
+// read through lookupEnv and the command line flags in args. Empty variables
+// count as unset. It returns the arguments left after the flags, and
+// flag.ErrHelp when -h was given.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	configPath := flags.String("config", "", "Path of an optional YAML configuration file")
+	values := make(map[string]*flagValue)
+	walk(reflect.ValueOf(cfg).Elem(), "", func(field reflect.StructField, _ reflect.Value, _ string) {
+		if name := field.Tag.Get("flag"); name != "" {
+			values[name] = &flagValue{isBool: field.Type.Kind() == reflect.Bool}
+			flags.Var(values[name], name, field.Tag.Get("usage"))
+		}
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Environment and flags are applied together so every malformed value is
+	// reported along with the validation problems
+	var problems []error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(field reflect.StructField, value reflect.Value, key string) {
+		if name := field.Tag.Get("env"); name != "" {
+			if raw, ok := lookupEnv(name); ok && raw != "" {
+				if err := setValue(value, raw); err != nil {
+					problems = append(problems, fmt.Errorf("%s: invalid %s: %w", key, name, err))
+				}
+			}
+		}
+		if name := field.Tag.Get("flag"); name != "" && values[name].set {
+			if err := setValue(value, values[name].raw); err != nil {
+				problems = append(problems, fmt.Errorf("%s: invalid --%s: %w", key, name, err))
+			}
+		}
+	})
+	if len(problems) > 0 {
+		return nil, nil, errors.Join(problems...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// loadFile merges a YAML file over cfg, unknown keys are rejected so typos
+// do not go unnoticed
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// walk calls fn for every leaf field of the struct v with its dotted YAML key
+func walk(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, key string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), key, fn)
+			continue
+		}
+		fn(field, v.Field(i), key)
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into a field of one of the kinds used by Config
+func setValue(value reflect.Value, raw string) error {
+	switch {
+	case value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		value.SetInt(int64(n))
+	case value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		value.SetBool(b)
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported configuration type %s", value.Type())
+	}
+	return nil
+}
+
+// flagValue records the raw value of a flag so it can be applied after the
+// configuration file and the environment
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.raw
+}
+
+func (f *flagValue) Set(raw string) error {
+	f.raw, f.set = raw, true
+	return nil
+}
+
+// IsBoolFlag lets boolean flags be given without a value, like --migrate
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,36 @@
+package config
+
+// redacted replaces the value of a secret wherever it is printed
+const redacted = "[REDACTED]"
+
+// Secret is a configuration value that is redacted when printed, logged or
+// marshalled. Value returns the actual secret.
+type Secret string
+
+// Value returns the unredacted secret
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String redacts the secret, an unset secret prints as empty
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString redacts the secret for the %#v verb
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalYAML redacts the secret
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MarshalJSON redacts the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
@@ -0,0 +1,175 @@
+// Package encryption implements AES-GCM envelope encryption for sensitive fields.
+//
+// Every value is encrypted with its own random data key. The data key is then
+// encrypted ("wrapped") with a key encryption key from the Keyring, and the
+// ID of that key is stored next to the value so keys can be rotated without
+// losing access to older rows.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeySize is the length in bytes of key encryption keys and data keys (AES-256)
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a value was sealed with a key that is not in the keyring
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrDecrypt is returned when a value cannot be authenticated or decrypted
+	ErrDecrypt = errors.New("decryption failed")
+)
+
+// Sealed is an encrypted value together with what is needed to decrypt it
+type Sealed struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keyring holds the key encryption keys by ID. New values are always sealed
+// with the primary key; any key in the ring can open values.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a Keyring that seals with the primary key
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one key")
+	}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, KeySize, len(key))
+		}
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+
+	return &Keyring{
+		primary: primary,
+		keys:    keys,
+	}, nil
+}
+
+// ParseKeys parses a comma separated list of id:base64key pairs
+func ParseKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %q must have the form id:base64key", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %s: %w", id, err)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// PrimaryKeyID returns the ID of the key new values are sealed with
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped with the primary key.
+// The additional data is authenticated but not stored, so the same value must
+// be passed to Open; binding it to the row ID stops values being moved between rows.
+func (k *Keyring) Seal(plaintext, additionalData []byte) (Sealed, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return Sealed{}, err
+	}
+
+	ciphertext, err := seal(dataKey, plaintext, additionalData)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	wrappedKey, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	return Sealed{
+		KeyID:      k.primary,
+		WrappedKey: wrappedKey,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Open decrypts a sealed value
+func (k *Keyring) Open(sealed Sealed, additionalData []byte) ([]byte, error) {
+	key, ok := k.keys[sealed.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, sealed.KeyID)
+	}
+
+	dataKey, err := open(key, sealed.WrappedKey, []byte(sealed.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, sealed.Ciphertext, additionalData)
+}
+
+// seal encrypts with AES-GCM and prepends the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
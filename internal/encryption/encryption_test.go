@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestKeyring(t *testing.T) {
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1), "k0": testKey(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", keyring.PrimaryKeyID())
+
+	t.Run("round trip", func(t *testing.T) {
+		sealed, err := keyring.Seal([]byte("Replaced the pump at 12 Main St"), []byte("task1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "k1", sealed.KeyID)
+		assert.NotContains(t, string(sealed.Ciphertext), "Main St")
+
+		plaintext, err := keyring.Open(sealed, []byte("task1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Replaced the pump at 12 Main St", string(plaintext))
+	})
+
+	t.Run("every value gets its own data key", func(t *testing.T) {
+		first, err := keyring.Seal([]byte("same"), nil)
+		assert.NoError(t, err)
+		second, err := keyring.Seal([]byte("same"), nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.WrappedKey, second.WrappedKey)
+		assert.NotEqual(t, first.Ciphertext, second.Ciphertext)
+	})
+
+	t.Run("additional data must match", func(t *testing.T) {
+		sealed, err := keyring.Seal([]byte("summary"), []byte("task1"))
+		assert.NoError(t, err)
+
+		_, err = keyring.Open(sealed, []byte("task2"))
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("tampered ciphertext is rejected", func(t *testing.T) {
+		sealed, err := keyring.Seal([]byte("summary"), nil)
+		assert.NoError(t, err)
+		sealed.Ciphertext[len(sealed.Ciphertext)-1] ^= 0xff
+
+		_, err = keyring.Open(sealed, nil)
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("values sealed with an older key still open", func(t *testing.T) {
+		old, err := NewKeyring("k0", map[string][]byte{"k0": testKey(2)})
+		assert.NoError(t, err)
+		sealed, err := old.Seal([]byte("legacy"), nil)
+		assert.NoError(t, err)
+
+		plaintext, err := keyring.Open(sealed, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "legacy", string(plaintext))
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := keyring.Open(Sealed{KeyID: "retired"}, nil)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	_, err := NewKeyring("k1", nil)
+	assert.Error(t, err)
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+	assert.Error(t, err)
+
+	_, err = NewKeyring("missing", map[string][]byte{"k1": testKey(1)})
+	assert.Error(t, err)
+
+	_, err = NewKeyring("k:1", map[string][]byte{"k:1": testKey(1)})
+	assert.Error(t, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(1))
+
+	keys, err := ParseKeys("2024:" + encoded + ", 2025:" + encoded)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, testKey(1), keys["2025"])
+
+	_, err = ParseKeys("no-separator")
+	assert.Error(t, err)
+
+	_, err = ParseKeys("k1:not base64!")
+	assert.Error(t, err)
+
+	_, err = ParseKeys("k1:" + encoded + ",k1:" + encoded)
+	assert.Error(t, err)
+}
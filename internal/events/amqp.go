@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConfirmed is returned when the broker negatively acknowledges a message
+var ErrNotConfirmed = errors.New("broker did not confirm the message")
+
+// AMQPPublisher publishes events to a durable topic exchange on a
+// RabbitMQ-compatible broker, using the event type as routing key. Publishes
+// wait for broker confirmation so a returned nil means the broker has the message.
+type AMQPPublisher struct {
+	url      string
+	exchange string
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+// NewAMQPPublisher connects to the broker and declares the exchange
+func NewAMQPPublisher(url, exchange string) (*AMQPPublisher, error) {
+	p := &AMQPPublisher{
+		url:      url,
+		exchange: exchange,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// connect opens a connection and a confirm-mode channel. Callers hold p.mu.
+func (p *AMQPPublisher) connect() error {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return fmt.Errorf("connecting to broker: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("opening channel: %w", err)
+	}
+
+	if err := channel.ExchangeDeclare(p.exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("declaring exchange %s: %w", p.exchange, err)
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("enabling publisher confirms: %w", err)
+	}
+
+	p.conn = conn
+	p.channel = channel
+	return nil
+}
+
+// reset drops the current connection so the next publish reconnects. Callers hold p.mu.
+func (p *AMQPPublisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn = nil
+	p.channel = nil
+}
+
+// Publish sends the event and waits for the broker to confirm it
+func (p *AMQPPublisher) Publish(ctx context.Context, event Envelope) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil || p.conn.IsClosed() {
+		p.reset()
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	confirmation, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, p.exchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID,
+		Type:         event.Type,
+		Timestamp:    event.OccurredAt,
+		AppId:        event.Source,
+		Headers: amqp.Table{
+			"version": int32(event.Version),
+		},
+		Body: body,
+	})
+	if err != nil {
+		p.reset()
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		p.reset()
+		return err
+	}
+	if !acked {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// Close closes the broker connection
+func (p *AMQPPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	p.channel = nil
+	return err
+}
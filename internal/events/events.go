@@ -0,0 +1,120 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// Source identifies this service in published envelopes
+const Source = "maintenance-api"
+
+// Task lifecycle event types. They double as AMQP routing keys.
+const (
+	TypeTaskCreated = "task.created"
+	TypeTaskUpdated = "task.updated"
+	TypeTaskDeleted = "task.deleted"
+	// TypeTaskTransitioned is emitted when a task moves to another status
+	TypeTaskTransitioned = "task.transitioned"
+)
+
+// TaskEventVersion is the schema version of the task event payloads. Bump it
+// whenever a field is removed or changes meaning; adding fields is compatible.
+const TaskEventVersion = 1
+
+// Envelope wraps every published event with the metadata consumers need to
+// route, deduplicate and decode it. The ID is assigned when the event is
+// written to the outbox and kept when its publication is retried.
+type Envelope struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	Source     string    `json:"source"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// OrganizationID is the organization of the technician of the task
+	OrganizationID int64           `json:"organization_id"`
+	ActorID        int64           `json:"actor_id,omitempty"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// TaskData is the payload of task.created and task.updated events
+type TaskData struct {
+	ID           string `json:"id"`
+	TechnicianID int64  `json:"technician_id"`
+	AssetID      *int64 `json:"asset_id,omitempty"`
+	Summary      string `json:"summary"`
+	// EncryptedSummary carries the summary, bound to ID, while the event waits
+	// in the outbox of a database that encrypts summaries at rest. The relay
+	// opens it before publishing, so published events never carry it.
+	EncryptedSummary *encryption.Sealed `json:"encrypted_summary,omitempty"`
+	PerformedAt      time.Time          `json:"performed_at"`
+	Status           string             `json:"status,omitempty"`
+}
+
+// TaskDeletedData is the payload of task.deleted events
+type TaskDeletedData struct {
+	ID string `json:"id"`
+}
+
+// TaskTransitionedData is the payload of task.transitioned events
+type TaskTransitionedData struct {
+	ID     string `json:"id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewTaskCreated builds the event emitted after a task was created
+func NewTaskCreated(data TaskData, organizationID, actorID int64) Envelope {
+	return newEnvelope(TypeTaskCreated, TaskEventVersion, organizationID, actorID, data)
+}
+
+// NewTaskUpdated builds the event emitted after a task was updated
+func NewTaskUpdated(data TaskData, organizationID, actorID int64) Envelope {
+	return newEnvelope(TypeTaskUpdated, TaskEventVersion, organizationID, actorID, data)
+}
+
+// NewTaskDeleted builds the event emitted after a task was deleted
+func NewTaskDeleted(taskID string, organizationID, actorID int64) Envelope {
+	return newEnvelope(TypeTaskDeleted, TaskEventVersion, organizationID, actorID, TaskDeletedData{ID: taskID})
+}
+
+// NewTaskTransitioned builds the event emitted after a task changed status
+func NewTaskTransitioned(transition models.TaskTransition, organizationID int64) Envelope {
+	return newEnvelope(TypeTaskTransitioned, TaskEventVersion, organizationID, transition.ActorID, TaskTransitionedData{
+		ID:     transition.TaskID,
+		From:   string(transition.From),
+		To:     string(transition.To),
+		Reason: transition.Reason,
+	})
+}
+
+// NewTaskData builds the payload of task.created and task.updated events
+func NewTaskData(task models.Task) TaskData {
+	return TaskData{
+		ID:           task.ID,
+		TechnicianID: task.TechnicianID,
+		AssetID:      task.AssetID,
+		Summary:      task.Summary,
+		PerformedAt:  task.PerformedAt,
+		Status:       string(task.Status),
+	}
+}
+
+func newEnvelope(eventType string, version int, organizationID, actorID int64, data interface{}) Envelope {
+	// The payload types above always marshal
+	raw, _ := json.Marshal(data)
+	return Envelope{
+		ID:             uuid.New().String(),
+		Type:           eventType,
+		Version:        version,
+		Source:         Source,
+		OccurredAt:     time.Now().UTC(),
+		OrganizationID: organizationID,
+		ActorID:        actorID,
+		Data:           raw,
+	}
+}
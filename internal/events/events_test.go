@@ -0,0 +1,110 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyPublisher fails the first failures calls
+type flakyPublisher struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyPublisher) Publish(ctx context.Context, event Envelope) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func TestEnvelope(t *testing.T) {
+	performedAt := time.Date(2024, 12, 29, 10, 30, 0, 0, time.UTC)
+	event := NewTaskCreated(NewTaskData(models.Task{
+		ID: "task1", TechnicianID: 7, Summary: "Replaced the faulty part", PerformedAt: performedAt,
+	}), 2, 7)
+
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, TypeTaskCreated, event.Type)
+	assert.Equal(t, TaskEventVersion, event.Version)
+	assert.Equal(t, Source, event.Source)
+	assert.Equal(t, int64(2), event.OrganizationID)
+	assert.Equal(t, int64(7), event.ActorID)
+	assert.False(t, event.OccurredAt.IsZero())
+
+	raw, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Type           string   `json:"type"`
+		Version        int      `json:"version"`
+		OrganizationID int64    `json:"organization_id"`
+		Data           TaskData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, TypeTaskCreated, decoded.Type)
+	assert.Equal(t, 1, decoded.Version)
+	assert.Equal(t, int64(2), decoded.OrganizationID)
+	assert.Equal(t, "task1", decoded.Data.ID)
+	assert.Equal(t, "Replaced the faulty part", decoded.Data.Summary)
+	assert.True(t, performedAt.Equal(decoded.Data.PerformedAt))
+
+	deleted := NewTaskDeleted("task1", 2, 3)
+	assert.Equal(t, TypeTaskDeleted, deleted.Type)
+	assert.JSONEq(t, `{"id":"task1"}`, string(deleted.Data))
+	assert.NotEqual(t, event.ID, deleted.ID)
+
+	transitioned := NewTaskTransitioned(models.TaskTransition{
+		TaskID: "task1", From: models.StatusScheduled, To: models.StatusCancelled, ActorID: 2, Reason: "duplicate",
+	}, 2)
+	assert.Equal(t, TypeTaskTransitioned, transitioned.Type)
+	assert.Equal(t, int64(2), transitioned.ActorID)
+	assert.JSONEq(t, `{"id":"task1","from":"scheduled","to":"cancelled","reason":"duplicate"}`, string(transitioned.Data))
+}
+
+func TestInProcessPublisher(t *testing.T) {
+	publisher := NewInProcessPublisher()
+	var first, second []string
+	publisher.Subscribe(func(e Envelope) { first = append(first, e.Type) })
+	publisher.Subscribe(func(e Envelope) { second = append(second, e.Type) })
+
+	assert.NoError(t, publisher.Publish(context.Background(), NewTaskDeleted("task1", 1, 1)))
+	assert.Equal(t, []string{TypeTaskDeleted}, first)
+	assert.Equal(t, []string{TypeTaskDeleted}, second)
+}
+
+func TestRetryPublisher(t *testing.T) {
+	ctx := context.Background()
+	event := NewTaskDeleted("task1", 1, 1)
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		next := &flakyPublisher{failures: 2}
+		err := NewRetryPublisher(next, 3, time.Millisecond).Publish(ctx, event)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, next.calls)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		next := &flakyPublisher{failures: 5}
+		err := NewRetryPublisher(next, 3, time.Millisecond).Publish(ctx, event)
+		assert.Error(t, err)
+		assert.Equal(t, 3, next.calls)
+	})
+
+	t.Run("stops waiting when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		next := &flakyPublisher{failures: 5}
+		err := NewRetryPublisher(next, 3, time.Hour).Publish(ctx, event)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, next.calls)
+	})
+}
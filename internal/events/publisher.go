@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/metrics"
+)
+
+// Publisher delivers events to downstream consumers
+type Publisher interface {
+	Publish(ctx context.Context, event Envelope) error
+}
+
+// NopPublisher discards every event
+type NopPublisher struct{}
+
+// Publish does nothing
+func (NopPublisher) Publish(ctx context.Context, event Envelope) error {
+	return nil
+}
+
+// InProcessPublisher delivers events synchronously to subscribers in the same process
+type InProcessPublisher struct {
+	mu          sync.RWMutex
+	subscribers []func(Envelope)
+}
+
+// NewInProcessPublisher creates an InProcessPublisher without subscribers
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+// Subscribe registers a handler that receives every published event
+func (p *InProcessPublisher) Subscribe(handler func(Envelope)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, handler)
+}
+
+// Publish hands the event to every subscriber
+func (p *InProcessPublisher) Publish(ctx context.Context, event Envelope) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, subscriber := range p.subscribers {
+		subscriber(event)
+	}
+	return nil
+}
+
+// RetryPublisher retries failed publishes with exponential backoff and
+// records the outcome in the events metrics
+type RetryPublisher struct {
+	next Publisher
+
+	// Attempts is the total number of tries per event
+	Attempts int
+	// Backoff is the delay before the first retry, doubled on every further retry
+	Backoff time.Duration
+}
+
+// NewRetryPublisher wraps next with retries
+func NewRetryPublisher(next Publisher, attempts int, backoff time.Duration) *RetryPublisher {
+	return &RetryPublisher{
+		next:     next,
+		Attempts: attempts,
+		Backoff:  backoff,
+	}
+}
+
+// Publish tries to publish the event until it succeeds, the attempts are used
+// up or ctx is cancelled
+func (p *RetryPublisher) Publish(ctx context.Context, event Envelope) error {
+	delay := p.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = p.next.Publish(ctx, event)
+		if err == nil {
+			metrics.RecordEventPublished(event.Type, true)
+			return nil
+		}
+		if attempt >= p.Attempts {
+			break
+		}
+
+		metrics.RecordEventPublishRetry(event.Type)
+		select {
+		case <-ctx.Done():
+			metrics.RecordEventPublished(event.Type, false)
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	metrics.RecordEventPublished(event.Type, false)
+	return err
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// Outbox is the part of the transactional outbox the relay drains, it is
+// implemented by the repository outbox repositories
+type Outbox interface {
+	Claim(ctx context.Context, topic string, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkProcessed(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error
+	MarkDiscarded(ctx context.Context, id int64, reason string) error
+}
+
+// Relay publishes the task events written to the events topic of the outbox
+// in the transaction of the change they describe. An event is marked
+// processed only once it was published, so delivery is at least once and
+// consumers deduplicate on the envelope ID.
+type Relay struct {
+	outbox    Outbox
+	publisher Publisher
+	logger    *logger.Logger
+
+	// BatchSize is the maximum number of events claimed per run
+	BatchSize int
+	// Lease is how long a claimed event is hidden from other relays
+	Lease time.Duration
+	// RetryBackoff is the delay before the first retry, doubled on every further attempt
+	RetryBackoff time.Duration
+	// MaxBackoff caps the retry delay. Events are never given up on for a
+	// publisher that is down, they are retried until it is back.
+	MaxBackoff time.Duration
+	// Keyring opens summaries that were encrypted at rest, nil when encryption is disabled
+	Keyring *encryption.Keyring
+}
+
+// NewRelay creates a Relay with default batching and retry settings
+func NewRelay(outbox Outbox, publisher Publisher, logger *logger.Logger) *Relay {
+	return &Relay{
+		outbox:       outbox,
+		publisher:    publisher,
+		logger:       logger,
+		BatchSize:    100,
+		Lease:        time.Minute,
+		RetryBackoff: time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+// Start relays pending events every interval until ctx is cancelled
+func (r *Relay) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RelayPending(ctx); err != nil {
+				r.logger.LogError(err, "Failed to relay task events")
+			}
+		}
+	}
+}
+
+// RelayPending claims one batch of due events, publishes them in the order
+// they were written and returns how many were published
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	messages, err := r.outbox.Claim(ctx, models.OutboxEvents, r.BatchSize, r.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, message := range messages {
+		var event Envelope
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			// Retrying can not fix a payload that does not decode
+			r.logger.LogError(err, fmt.Sprintf("Discarding outbox event %d", message.ID))
+			if err := r.outbox.MarkDiscarded(ctx, message.ID, err.Error()); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		err := r.openSummary(&event)
+		if err == nil {
+			err = r.publisher.Publish(ctx, event)
+		}
+		if err != nil {
+			r.logger.LogError(err, fmt.Sprintf("Failed to publish %s event %s, will retry", event.Type, event.ID))
+			if err := r.outbox.MarkFailed(ctx, message.ID, err.Error(), r.backoff(message.Attempts)); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		published++
+		if err := r.outbox.MarkProcessed(ctx, message.ID); err != nil {
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+// openSummary replaces a task summary that waited in the outbox encrypted
+// with its plaintext
+func (r *Relay) openSummary(event *Envelope) error {
+	if event.Type != TypeTaskCreated && event.Type != TypeTaskUpdated {
+		return nil
+	}
+
+	var data TaskData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return fmt.Errorf("decoding %s event %s: %w", event.Type, event.ID, err)
+	}
+	if data.EncryptedSummary == nil {
+		return nil
+	}
+	if r.Keyring == nil {
+		return fmt.Errorf("task %s summary is encrypted but no keyring is configured", data.ID)
+	}
+
+	summary, err := r.Keyring.Open(*data.EncryptedSummary, []byte(data.ID))
+	if err != nil {
+		return fmt.Errorf("decrypting task %s summary: %w", data.ID, err)
+	}
+	data.Summary = string(summary)
+	data.EncryptedSummary = nil
+	// TaskData always marshals
+	event.Data, _ = json.Marshal(data)
+	return nil
+}
+
+// backoff returns the retry delay after the given number of previous attempts
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.RetryBackoff
+	for i := 0; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOutbox hands out its messages once and records what became of them
+type fakeOutbox struct {
+	messages  []models.OutboxMessage
+	topic     string
+	processed []int64
+	failed    map[int64]time.Duration
+	discarded []int64
+}
+
+func (o *fakeOutbox) Claim(ctx context.Context, topic string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	o.topic = topic
+	messages := o.messages
+	o.messages = nil
+	return messages, nil
+}
+
+func (o *fakeOutbox) MarkProcessed(ctx context.Context, id int64) error {
+	o.processed = append(o.processed, id)
+	return nil
+}
+
+func (o *fakeOutbox) MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	if o.failed == nil {
+		o.failed = make(map[int64]time.Duration)
+	}
+	o.failed[id] = retryAfter
+	return nil
+}
+
+func (o *fakeOutbox) MarkDiscarded(ctx context.Context, id int64, reason string) error {
+	o.discarded = append(o.discarded, id)
+	return nil
+}
+
+func outboxMessage(t *testing.T, id int64, attempts int, event Envelope) models.OutboxMessage {
+	payload, err := json.Marshal(event)
+	assert.NoError(t, err)
+	return models.OutboxMessage{ID: id, EventType: event.Type, Payload: payload, Attempts: attempts}
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	created := NewTaskCreated(NewTaskData(models.Task{ID: "task1", TechnicianID: 7, Summary: "Replaced the pump seal"}), 2, 7)
+	deleted := NewTaskDeleted("task1", 2, 3)
+
+	t.Run("publishes the events in order and keeps their IDs", func(t *testing.T) {
+		outbox := &fakeOutbox{messages: []models.OutboxMessage{outboxMessage(t, 1, 0, created), outboxMessage(t, 2, 0, deleted)}}
+		publisher := NewInProcessPublisher()
+		var published []Envelope
+		publisher.Subscribe(func(event Envelope) { published = append(published, event) })
+
+		count, err := NewRelay(outbox, publisher, logger.New()).RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.Equal(t, models.OutboxEvents, outbox.topic)
+		assert.Equal(t, []int64{1, 2}, outbox.processed)
+		if assert.Len(t, published, 2) {
+			assert.Equal(t, created.ID, published[0].ID)
+			assert.Equal(t, int64(2), published[0].OrganizationID)
+			assert.Equal(t, deleted.ID, published[1].ID)
+		}
+	})
+
+	t.Run("failed publishes are retried with backoff and never discarded", func(t *testing.T) {
+		outbox := &fakeOutbox{messages: []models.OutboxMessage{outboxMessage(t, 1, 0, created), outboxMessage(t, 2, 20, deleted)}}
+		relay := NewRelay(outbox, &flakyPublisher{failures: 2}, logger.New())
+
+		count, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+		assert.Empty(t, outbox.processed)
+		assert.Empty(t, outbox.discarded)
+		assert.Equal(t, relay.RetryBackoff, outbox.failed[1])
+		assert.Equal(t, relay.MaxBackoff, outbox.failed[2])
+	})
+
+	t.Run("payloads that do not decode are discarded", func(t *testing.T) {
+		outbox := &fakeOutbox{messages: []models.OutboxMessage{{ID: 1, EventType: TypeTaskCreated, Payload: json.RawMessage(`"garbage"`)}}}
+
+		count, err := NewRelay(outbox, NopPublisher{}, logger.New()).RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+		assert.Equal(t, []int64{1}, outbox.discarded)
+	})
+
+	t.Run("summaries encrypted at rest are published in plaintext", func(t *testing.T) {
+		keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+		assert.NoError(t, err)
+		sealed, err := keyring.Seal([]byte("Replaced the pump seal"), []byte("task1"))
+		assert.NoError(t, err)
+		encrypted := NewTaskCreated(TaskData{ID: "task1", TechnicianID: 7, EncryptedSummary: &sealed}, 2, 7)
+
+		publisher := NewInProcessPublisher()
+		var published []Envelope
+		publisher.Subscribe(func(event Envelope) { published = append(published, event) })
+
+		// Without the keyring the event waits in the outbox
+		outbox := &fakeOutbox{messages: []models.OutboxMessage{outboxMessage(t, 1, 0, encrypted)}}
+		relay := NewRelay(outbox, publisher, logger.New())
+		_, err = relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Contains(t, outbox.failed, int64(1))
+		assert.Empty(t, published)
+
+		outbox.messages = []models.OutboxMessage{outboxMessage(t, 1, 1, encrypted)}
+		relay.Keyring = keyring
+		count, err := relay.RelayPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+		if assert.Len(t, published, 1) {
+			var data TaskData
+			assert.NoError(t, json.Unmarshal(published[0].Data, &data))
+			assert.Equal(t, "Replaced the pump seal", data.Summary)
+			assert.Nil(t, data.EncryptedSummary)
+			assert.NotContains(t, string(published[0].Data), "encrypted_summary")
+		}
+	})
+}
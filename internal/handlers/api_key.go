@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// apiKeyAttempts is how many times a key is generated again when its prefix
+// is already taken
+const apiKeyAttempts = 3
+
+// APIKeyHandler lets users create API keys for their integrations
+type APIKeyHandler struct {
+	keys       repository.APIKeyRepository
+	authorizer *authz.Authorizer
+}
+
+func NewAPIKeyHandler(keys repository.APIKeyRepository, authorizer *authz.Authorizer) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys:       keys,
+		authorizer: authorizer,
+	}
+}
+
+// CreateAPIKeyRequest is the body of CreateAPIKey
+type CreateAPIKeyRequest struct {
+	Name        string              `json:"name"`
+	Permissions []models.Permission `json:"permissions"`
+	// ExpiresAt defaults to auth.APIKeyTTL from now
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyResponse is an API key with its current status. The key itself is
+// only returned when it is created.
+type APIKeyResponse struct {
+	models.APIKey
+	Status models.APIKeyStatus `json:"status"`
+	Key    string              `json:"key,omitempty"`
+}
+
+// CreateAPIKey creates an API key acting for the user and returns it. The key
+// may only be granted permissions the user holds.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		http.Error(w, "Name is required and must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Permissions) == 0 {
+		http.Error(w, "At least one permission is required", http.StatusBadRequest)
+		return
+	}
+	permissions := make([]models.Permission, 0, len(req.Permissions))
+	granted := make(map[models.Permission]bool, len(req.Permissions))
+	for _, permission := range req.Permissions {
+		if !h.authorizer.Allows(subject, permission) {
+			http.Error(w, fmt.Sprintf("Can not grant permission %s", permission), http.StatusForbidden)
+			return
+		}
+		if !granted[permission] {
+			granted[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(auth.APIKeyTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(auth.MaxAPIKeyTTL)) {
+		http.Error(w, "Expiry must be in the future and at most 365 days away", http.StatusBadRequest)
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:      uint(subject.UserID),
+		Name:        req.Name,
+		Permissions: permissions,
+		ExpiresAt:   expiresAt.UTC().Truncate(time.Second),
+	}
+	var key string
+	for attempt := 0; ; attempt++ {
+		var err error
+		key, apiKey.Prefix, apiKey.KeyHash, err = auth.NewAPIKey()
+		if err != nil {
+			http.Error(w, "Error generating API key", http.StatusInternalServerError)
+			return
+		}
+		err = h.keys.Create(r.Context(), &apiKey)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, repository.ErrDuplicate) || attempt+1 == apiKeyAttempts {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(APIKeyResponse{APIKey: apiKey, Status: apiKey.Status(now), Key: key}); err != nil {
+		log.Printf("Error encoding API key: %v", err)
+	}
+}
+
+// ListAPIKeys returns the API keys of the user, or every API key for users
+// with user:manage. ?status= filters by status.
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	status := models.APIKeyStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.APIKeyActive, models.APIKeyRevoked, models.APIKeyExpired:
+	default:
+		http.Error(w, "Invalid status. Must be one of 'active', 'revoked' or 'expired'", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.keys.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	all := h.authorizer.Allows(subject, models.PermissionUserManage)
+	response := []APIKeyResponse{}
+	for _, key := range keys {
+		if !all && int64(key.UserID) != subject.UserID {
+			continue
+		}
+		if status != "" && key.Status(now) != status {
+			continue
+		}
+		response = append(response, APIKeyResponse{APIKey: key, Status: key.Status(now)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding API keys: %v", err)
+	}
+}
+
+// RevokeAPIKey revokes an API key of the user, or any API key for users with
+// user:manage. Requests made with the key are refused right away.
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.keys.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if int64(key.UserID) != subject.UserID && !h.authorizer.Allows(subject, models.PermissionUserManage) {
+		http.Error(w, "Not allowed to revoke this API key", http.StatusForbidden)
+		return
+	}
+
+	err = h.keys.Revoke(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConflict) {
+		http.Error(w, "API key was already revoked", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "API key revoked successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
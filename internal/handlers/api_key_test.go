@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	keys := repository.NewMemoryAPIKeyRepository()
+	handler := NewAPIKeyHandler(keys, authz.Default())
+	validator := &auth.APIKeyValidator{Keys: keys, Users: users}
+
+	manager := &models.User{Username: "manager", Role: models.RoleManager}
+	assert.NoError(t, users.Create(context.Background(), manager))
+	other := &models.User{Username: "other", Role: models.RoleManager}
+	assert.NoError(t, users.Create(context.Background(), other))
+	admin := &models.User{ID: 99, Role: models.RoleAdmin}
+
+	serve := func(handle http.HandlerFunc, method, target, body string, user *models.User, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(user.ID))
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(user.Role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	create := func(user *models.User, body string) APIKeyResponse {
+		rr := serve(handler.CreateAPIKey, "POST", "/api-keys", body, user, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var key APIKeyResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &key))
+		return key
+	}
+
+	t.Run("technicians can not create keys", func(t *testing.T) {
+		technician := &models.User{ID: 9, Role: models.RoleTechnician}
+		rr := serve(guarded(models.PermissionAPIKeyManage, handler.CreateAPIKey), "POST", "/api-keys",
+			`{"name":"sync","permissions":["task:read:own"]}`, technician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("create validation", func(t *testing.T) {
+		for body, message := range map[string]string{
+			`{"permissions":["task:read:own"]}`: "Name is required",
+			`{"name":"sync"}`:                   "At least one permission is required",
+			`{"name":"sync","permissions":["task:read:own"],"expires_at":"2020-01-01T00:00:00Z"}`: "Expiry must be in the future",
+			`{"name":"sync","permissions":["task:read:own"],"expires_at":"2999-01-01T00:00:00Z"}`: "at most 365 days away",
+			`{"name":`: "Invalid request body",
+		} {
+			rr := serve(handler.CreateAPIKey, "POST", "/api-keys", body, manager, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			assert.Contains(t, rr.Body.String(), message, body)
+		}
+
+		// A key never gets more than its creator holds
+		for _, permission := range []string{"user:manage", "unknown:permission"} {
+			rr := serve(handler.CreateAPIKey, "POST", "/api-keys", `{"name":"sync","permissions":["`+permission+`"]}`, manager, nil)
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+			assert.Contains(t, rr.Body.String(), "Can not grant permission "+permission)
+		}
+	})
+
+	t.Run("created key authenticates once with its permissions", func(t *testing.T) {
+		key := create(manager, `{"name":" sync ","permissions":["task:read:team","asset:read","asset:read"]}`)
+		assert.Equal(t, "sync", key.Name)
+		assert.Equal(t, manager.ID, key.UserID)
+		assert.Equal(t, models.APIKeyActive, key.Status)
+		assert.Equal(t, []models.Permission{models.PermissionTaskReadTeam, models.PermissionAssetRead}, key.Permissions)
+		assert.WithinDuration(t, time.Now().Add(auth.APIKeyTTL), key.ExpiresAt, time.Minute)
+		assert.Contains(t, key.Key, key.Prefix)
+
+		claims, err := validator.ValidateToken(key.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, manager.ID, claims.UserID)
+		assert.Equal(t, []string{"task:read:team", "asset:read"}, claims.Permissions)
+
+		stored, err := keys.Get(context.Background(), key.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, stored.LastUsedAt)
+		assert.Equal(t, auth.HashAPIKey(key.Key), stored.KeyHash)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		key := create(manager, `{"name":"revoked","permissions":["asset:read"]}`)
+		id := map[string]string{"id": strconv.FormatInt(key.ID, 10)}
+
+		// Only the creator or an admin may revoke it
+		rr := serve(handler.RevokeAPIKey, "DELETE", "/api-keys/"+id["id"], "", other, id)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.RevokeAPIKey, "DELETE", "/api-keys/"+id["id"], "", manager, id)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(handler.RevokeAPIKey, "DELETE", "/api-keys/"+id["id"], "", admin, id)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		_, err := validator.ValidateToken(key.Key)
+		assert.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+
+		rr = serve(handler.RevokeAPIKey, "DELETE", "/api-keys/99", "", manager, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		create(other, `{"name":"other","permissions":["asset:read"]}`)
+
+		list := func(user *models.User, target string) []APIKeyResponse {
+			rr := serve(handler.ListAPIKeys, "GET", target, "", user, nil)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var keys []APIKeyResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &keys))
+			for _, key := range keys {
+				assert.Empty(t, key.Key)
+			}
+			return keys
+		}
+
+		// Users see their own keys, admins every key
+		assert.Len(t, list(manager, "/api-keys"), 2)
+		assert.Len(t, list(other, "/api-keys"), 1)
+		assert.Len(t, list(admin, "/api-keys"), 3)
+		assert.Len(t, list(manager, "/api-keys?status=revoked"), 1)
+		assert.Len(t, list(manager, "/api-keys?status=active"), 1)
+
+		rr := serve(handler.ListAPIKeys, "GET", "/api-keys?status=unknown", "", manager, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// Limits on asset fields, matching the column sizes
+const (
+	maxSerialNumberLength = 100
+	maxAssetTypeLength    = 100
+	maxLocationLength     = 255
+	maxMetadataEntries    = 50
+	maxMetadataLength     = 255
+)
+
+// AssetHandler serves the asset registry and the maintenance history of each asset
+type AssetHandler struct {
+	assets     repository.AssetRepository
+	tasks      repository.TaskRepository
+	teams      repository.TeamRepository
+	authorizer *authz.Authorizer
+}
+
+// NewAssetHandler creates an AssetHandler. teams scopes managers to the
+// tasks of their teams in the maintenance history, it may be nil.
+func NewAssetHandler(assets repository.AssetRepository, tasks repository.TaskRepository, teams repository.TeamRepository, authorizer *authz.Authorizer) *AssetHandler {
+	return &AssetHandler{
+		assets:     assets,
+		tasks:      tasks,
+		teams:      teams,
+		authorizer: authorizer,
+	}
+}
+
+// CreateAsset registers a new asset, managers only
+func (h *AssetHandler) CreateAsset(w http.ResponseWriter, r *http.Request) {
+	var asset models.Asset
+	if err := json.NewDecoder(r.Body).Decode(&asset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAsset(&asset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.assets.Create(r.Context(), &asset)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Serial number already registered", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(asset); err != nil {
+		log.Printf("Error encoding asset: %v", err)
+	}
+}
+
+// ListAssets returns every asset
+func (h *AssetHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	assets, err := h.assets.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(assets); err != nil {
+		log.Printf("Error encoding assets: %v", err)
+	}
+}
+
+// GetAsset returns a single asset
+func (h *AssetHandler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	id, ok := assetIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	asset, err := h.assets.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(asset); err != nil {
+		log.Printf("Error encoding asset: %v", err)
+	}
+}
+
+// UpdateAsset replaces the fields of an asset, managers only
+func (h *AssetHandler) UpdateAsset(w http.ResponseWriter, r *http.Request) {
+	id, ok := assetIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var asset models.Asset
+	if err := json.NewDecoder(r.Body).Decode(&asset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAsset(&asset); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	asset.ID = id
+	err := h.assets.Update(r.Context(), &asset)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Serial number already registered", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Asset updated successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
+
+// DeleteAsset removes an asset without maintenance history, managers only
+func (h *AssetHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	id, ok := assetIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.assets.Delete(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrInUse) {
+		http.Error(w, "Asset has maintenance history and can not be deleted", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Asset deleted successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
+
+// ListAssetTasks returns the maintenance history of an asset. It accepts the
+// GET /tasks query parameters and applies the same visibility rules.
+func (h *AssetHandler) ListAssetTasks(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+	if !h.authorizer.Allows(subject, models.PermissionTaskReadOwn) {
+		http.Error(w, "Unauthorized role", http.StatusForbidden)
+		return
+	}
+
+	id, ok := assetIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	exists, err := h.assets.Exists(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	filter, err := parseTaskFilter(r.URL.Query(), subject, h.authorizer)
+	if errors.Is(err, errTechnicianFilter) || errors.Is(err, errTechnicianNotManaged) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.AssetID = &id
+
+	page, err := h.tasks.List(r.Context(), filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error listing tasks of asset %d: %v", id, err)
+		http.Error(w, "Error listing tasks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		log.Printf("Error encoding tasks: %v", err)
+	}
+}
+
+// validateAsset trims and checks the client supplied fields of an asset
+func validateAsset(asset *models.Asset) error {
+	asset.SerialNumber = strings.TrimSpace(asset.SerialNumber)
+	asset.Type = strings.TrimSpace(asset.Type)
+	asset.Location = strings.TrimSpace(asset.Location)
+
+	if asset.SerialNumber == "" || len(asset.SerialNumber) > maxSerialNumberLength {
+		return fmt.Errorf("serial_number is required and must not exceed %d characters", maxSerialNumberLength)
+	}
+	if asset.Type == "" || len(asset.Type) > maxAssetTypeLength {
+		return fmt.Errorf("type is required and must not exceed %d characters", maxAssetTypeLength)
+	}
+	if len(asset.Location) > maxLocationLength {
+		return fmt.Errorf("location must not exceed %d characters", maxLocationLength)
+	}
+	if asset.InstallDate != "" {
+		if _, err := time.Parse("2006-01-02", asset.InstallDate); err != nil {
+			return errors.New("Invalid install_date, expected a YYYY-MM-DD date")
+		}
+	}
+	if len(asset.Metadata) > maxMetadataEntries {
+		return fmt.Errorf("metadata must not have more than %d entries", maxMetadataEntries)
+	}
+	for key, value := range asset.Metadata {
+		if key == "" || len(key) > maxMetadataLength || len(value) > maxMetadataLength {
+			return fmt.Errorf("metadata keys must not be empty and keys and values must not exceed %d characters", maxMetadataLength)
+		}
+	}
+	return nil
+}
+
+// assetIDParam parses the {id} route variable, answering 400 when it is not an asset ID
+func assetIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid asset ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
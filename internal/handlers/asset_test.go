@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssetHandler(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(context.Background(), &tech))
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	assets := repository.NewMemoryAssetRepository(tasks)
+	handler := NewAssetHandler(assets, tasks, nil, authz.Default())
+	taskHandler := NewTaskHandler(tasks, WithAssets(assets))
+
+	serve := func(handle http.HandlerFunc, method, target, body string, userID int, role models.Role, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	rr := serve(handler.CreateAsset, "POST", "/assets",
+		`{"serial_number":" PUMP-0001 ","type":"pump","install_date":"2021-03-15","metadata":{"vendor":"Acme"}}`, 99, models.RoleManager, nil)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var pump models.Asset
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pump))
+	assert.Equal(t, "PUMP-0001", pump.SerialNumber)
+	pumpID := map[string]string{"id": strconv.FormatInt(pump.ID, 10)}
+
+	t.Run("create validation", func(t *testing.T) {
+		for _, body := range []string{
+			`{"type":"pump"}`,
+			`{"serial_number":"X","type":""}`,
+			`{"serial_number":"X","type":"pump","install_date":"15/03/2021"}`,
+			`{"serial_number":"X","type":"pump","metadata":{"":"empty key"}}`,
+		} {
+			rr := serve(handler.CreateAsset, "POST", "/assets", body, 99, models.RoleManager, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+
+		rr := serve(handler.CreateAsset, "POST", "/assets", `{"serial_number":"PUMP-0001","type":"pump"}`, 99, models.RoleManager, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("only managers manage assets", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionAssetManage, handler.CreateAsset), "POST", "/assets", `{"serial_number":"X","type":"pump"}`, int(tech.ID), models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = serve(guarded(models.PermissionAssetManage, handler.UpdateAsset), "PUT", "/assets/1", `{"serial_number":"X","type":"pump"}`, int(tech.ID), models.RoleTechnician, pumpID)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = serve(guarded(models.PermissionAssetManage, handler.DeleteAsset), "DELETE", "/assets/1", "", int(tech.ID), models.RoleTechnician, pumpID)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("everyone reads assets", func(t *testing.T) {
+		rr := serve(handler.ListAssets, "GET", "/assets", "", int(tech.ID), models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []models.Asset
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		assert.Len(t, list, 1)
+
+		rr = serve(handler.GetAsset, "GET", "/assets/1", "", int(tech.ID), models.RoleTechnician, pumpID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"vendor":"Acme"`)
+
+		rr = serve(handler.GetAsset, "GET", "/assets/42", "", int(tech.ID), models.RoleTechnician, map[string]string{"id": "42"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = serve(handler.GetAsset, "GET", "/assets/abc", "", int(tech.ID), models.RoleTechnician, map[string]string{"id": "abc"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rr := serve(handler.UpdateAsset, "PUT", "/assets/1", `{"serial_number":"PUMP-0001","type":"pump","location":"Plant 2"}`, 99, models.RoleManager, pumpID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		stored, err := assets.Get(context.Background(), pump.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Plant 2", stored.Location)
+	})
+
+	t.Run("tasks must reference a registered asset", func(t *testing.T) {
+		rr := serve(taskHandler.CreateTask, "POST", "/tasks", `{"summary":"Seal","performed_at":"2024-12-25T10:00:00Z","asset_id":42}`, int(tech.ID), models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Asset not found")
+
+		body := `{"summary":"Seal","performed_at":"2024-12-25T10:00:00Z","asset_id":` + pumpID["id"] + `}`
+		rr = serve(taskHandler.CreateTask, "POST", "/tasks", body, int(tech.ID), models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		task := models.Task{ID: "other", TechnicianID: int64(tech.ID), PerformedAt: time.Now()}
+		assert.NoError(t, tasks.Create(context.Background(), &task, task.TechnicianID))
+	})
+
+	t.Run("maintenance history", func(t *testing.T) {
+		rr := serve(handler.ListAssetTasks, "GET", "/assets/1/tasks", "", 99, models.RoleAdmin, pumpID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page repository.TaskPage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "Seal", page.Tasks[0].Summary)
+		}
+
+		rr = serve(handler.ListAssetTasks, "GET", "/assets/1/tasks", "", 98, models.RoleManager, pumpID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		assert.Empty(t, page.Tasks, "managers only see the tasks of their teams")
+
+		rr = serve(handler.ListAssetTasks, "GET", "/assets/1/tasks", "", 42, models.RoleTechnician, pumpID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		assert.Empty(t, page.Tasks, "technicians only see their own tasks")
+
+		rr = serve(handler.ListAssetTasks, "GET", "/assets/42/tasks", "", 99, models.RoleManager, map[string]string{"id": "42"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("assets with history can not be deleted", func(t *testing.T) {
+		rr := serve(handler.DeleteAsset, "DELETE", "/assets/1", "", 99, models.RoleManager, pumpID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
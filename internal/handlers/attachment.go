@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/blob"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/thumbnail"
+)
+
+// attachmentTypes are the content types accepted for attachments, as sniffed
+// from the content rather than declared by the client
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// thumbnailSize is the largest side of attachment thumbnails in pixels
+const thumbnailSize = 256
+
+// maxFileNameLength bounds the stored name of an attachment, in bytes
+const maxFileNameLength = 255
+
+// AttachmentHandler serves the files attached to tasks. Whoever can see a
+// task can attach files to it. The content is downloaded through signed
+// links that expire, so it can be opened without an Authorization header.
+type AttachmentHandler struct {
+	attachments repository.AttachmentRepository
+	tasks       repository.TaskRepository
+	teams       repository.TeamRepository
+	blobs       blob.BlobStore
+	authorizer  *authz.Authorizer
+	urlSecret   []byte
+
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int64
+	// URLTTL is how long the download links of a response can be used
+	URLTTL time.Duration
+
+	now func() time.Time
+}
+
+// NewAttachmentHandler creates an AttachmentHandler keeping the content of
+// attachments in blobs. Download links are signed with urlSecret, teams
+// scopes managers to the tasks of their teams and may be nil.
+func NewAttachmentHandler(attachments repository.AttachmentRepository, tasks repository.TaskRepository, teams repository.TeamRepository,
+	blobs blob.BlobStore, authorizer *authz.Authorizer, urlSecret []byte) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachments: attachments,
+		tasks:       tasks,
+		teams:       teams,
+		blobs:       blobs,
+		authorizer:  authorizer,
+		urlSecret:   urlSecret,
+		MaxSize:     10 << 20,
+		URLTTL:      15 * time.Minute,
+		now:         time.Now,
+	}
+}
+
+// AttachmentResponse is an attachment with signed links to its content and,
+// for images, its thumbnail
+type AttachmentResponse struct {
+	models.Attachment
+	DownloadURL  string `json:"download_url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	// URLExpiresAt is when the links stop working
+	URLExpiresAt time.Time `json:"url_expires_at"`
+}
+
+// UploadAttachment attaches the file of the "file" part of a multipart form
+// to a task. Files larger than MaxSize are refused with 413 and content
+// other than JPEG, PNG, GIF and WebP images and PDF documents with 415.
+// JPEG, PNG and GIF images also get a thumbnail.
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+
+	// Leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxSize+64<<10)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	var part io.Reader
+	var fileName string
+	for part == nil {
+		next, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "A file part is required", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			uploadError(w, err, h.MaxSize)
+			return
+		}
+		if next.FormName() == "file" {
+			part, fileName = next, next.FileName()
+		}
+	}
+
+	// Spool the file so its type can be sniffed and its size is known
+	// before it reaches the blob store
+	spool, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), io.LimitReader(part, h.MaxSize+1))
+	if err != nil {
+		uploadError(w, err, h.MaxSize)
+		return
+	}
+	if size > h.MaxSize {
+		uploadError(w, &http.MaxBytesError{Limit: h.MaxSize}, h.MaxSize)
+		return
+	}
+	if size == 0 {
+		http.Error(w, "File is empty", http.StatusBadRequest)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := spool.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !attachmentTypes[contentType] {
+		http.Error(w, "Only JPEG, PNG, GIF and WebP images and PDF documents can be attached", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:          uuid.New().String(),
+		TaskID:      taskID,
+		UploaderID:  subject.UserID,
+		FileName:    sanitizeFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+	}
+	attachment.StorageKey = "attachments/" + attachment.ID
+	if err := h.store(r, spool, &attachment); err != nil {
+		h.discard(r, &attachment)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.attachments.Create(r.Context(), &attachment)
+	if err != nil {
+		// The task may have been deleted while the file was uploaded
+		h.discard(r, &attachment)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(h.response(attachment)); err != nil {
+		log.Printf("Error encoding attachment: %v", err)
+	}
+}
+
+// uploadError answers 413 when the body of an upload exceeds the limit and
+// 400 for any other malformed body
+func uploadError(w http.ResponseWriter, err error, maxSize int64) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("File must not exceed %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Malformed multipart body: "+err.Error(), http.StatusBadRequest)
+}
+
+// store puts the spooled content of an attachment in the blob store, with a
+// thumbnail for images the standard library decodes. An image that can not
+// be decoded is still stored, without a thumbnail.
+func (h *AttachmentHandler) store(r *http.Request, spool *os.File, attachment *models.Attachment) error {
+	// Section readers leave the spool open, HTTP clients close request bodies
+	content := io.NewSectionReader(spool, 0, attachment.Size)
+	if err := h.blobs.Put(r.Context(), attachment.StorageKey, content, attachment.Size, attachment.ContentType); err != nil {
+		return err
+	}
+
+	if !thumbnail.Supported(attachment.ContentType) {
+		return nil
+	}
+	thumb, err := thumbnail.Generate(io.NewSectionReader(spool, 0, attachment.Size), thumbnailSize)
+	if err != nil {
+		log.Printf("No thumbnail for attachment %s: %v", attachment.ID, err)
+		return nil
+	}
+
+	key := attachment.StorageKey + "-thumbnail"
+	if err := h.blobs.Put(r.Context(), key, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		return err
+	}
+	attachment.ThumbnailKey = key
+	return nil
+}
+
+// discard removes the blobs of an attachment that could not be stored,
+// unknown keys are no error
+func (h *AttachmentHandler) discard(r *http.Request, attachment *models.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.blobs.Delete(r.Context(), key); err != nil {
+			log.Printf("Error deleting blob %s: %v", key, err)
+		}
+	}
+}
+
+// ListAttachments returns the attachments of a task, oldest first
+func (h *AttachmentHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+
+	attachments, err := h.attachments.List(r.Context(), taskID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responses := make([]AttachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		responses = append(responses, h.response(attachment))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		log.Printf("Error encoding attachments: %v", err)
+	}
+}
+
+// GetAttachment returns an attachment with fresh download links
+func (h *AttachmentHandler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+	attachment, ok := h.attachment(w, r, taskID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.response(*attachment)); err != nil {
+		log.Printf("Error encoding attachment: %v", err)
+	}
+}
+
+// DeleteAttachment removes an attachment, its blobs are deleted in the
+// background. Uploaders delete their own files, whoever may delete the task
+// deletes any of its files.
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	ownerID, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID)
+	if !ok {
+		return
+	}
+	attachment, ok := h.attachment(w, r, taskID)
+	if !ok {
+		return
+	}
+	if !h.authorizer.CanDeleteAttachment(subject, attachment.UploaderID, ownerID) {
+		http.Error(w, "Unauthorized to delete this attachment", http.StatusForbidden)
+		return
+	}
+
+	err := h.attachments.Delete(r.Context(), taskID, attachment.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Attachment deleted successfully",
+		"id":      attachment.ID,
+	})
+}
+
+// DownloadAttachment serves the content or the thumbnail of an attachment,
+// as named by the {variant} route variable, to whoever holds a link signed by
+// response. It does not need authentication, links that were tampered with
+// or have expired are refused with 403.
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, id, variant := vars["id"], vars["attachment_id"], vars["variant"]
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	signature, decodeErr := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("signature"))
+	if err != nil || decodeErr != nil || h.now().Unix() >= expires ||
+		!hmac.Equal(signature, h.sign(taskID, id, variant, expires)) {
+		http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		return
+	}
+
+	attachment, err := h.attachments.Get(r.Context(), taskID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if variant == "thumbnail" {
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	}
+	if key == "" {
+		http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+		return
+	}
+
+	content, err := h.blobs.Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", expires-h.now().Unix()))
+	if variant == "content" {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+		w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}))
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Error sending attachment %s: %v", attachment.ID, err)
+	}
+}
+
+// attachment returns the attachment of the {attachment_id} route variable,
+// answering 404 when the task has no such attachment
+func (h *AttachmentHandler) attachment(w http.ResponseWriter, r *http.Request, taskID string) (*models.Attachment, bool) {
+	attachment, err := h.attachments.Get(r.Context(), taskID, mux.Vars(r)["attachment_id"])
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return attachment, true
+}
+
+// response adds download links valid for URLTTL to an attachment
+func (h *AttachmentHandler) response(attachment models.Attachment) AttachmentResponse {
+	expiresAt := h.now().Add(h.URLTTL).Truncate(time.Second)
+	response := AttachmentResponse{
+		Attachment:   attachment,
+		DownloadURL:  h.downloadURL(attachment, "content", expiresAt),
+		URLExpiresAt: expiresAt.UTC(),
+	}
+	if attachment.ThumbnailKey != "" {
+		response.ThumbnailURL = h.downloadURL(attachment, "thumbnail", expiresAt)
+	}
+	return response
+}
+
+// downloadURL returns the signed link to a variant of an attachment, relative
+// to the API
+func (h *AttachmentHandler) downloadURL(attachment models.Attachment, variant string, expiresAt time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", base64.RawURLEncoding.EncodeToString(h.sign(attachment.TaskID, attachment.ID, variant, expiresAt.Unix())))
+	return "/tasks/" + url.PathEscape(attachment.TaskID) + "/attachments/" + url.PathEscape(attachment.ID) + "/" + variant + "?" + query.Encode()
+}
+
+// sign returns the HMAC-SHA256 authorizing the download of a variant of an
+// attachment until expires, in Unix seconds
+func (h *AttachmentHandler) sign(taskID, id, variant string, expires int64) []byte {
+	mac := hmac.New(sha256.New, h.urlSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", taskID, id, variant, expires)
+	return mac.Sum(nil)
+}
+
+// sanitizeFileName keeps the last path element of a client supplied file
+// name, bounded to maxFileNameLength bytes. Control and format characters
+// are dropped, right-to-left overrides could disguise the extension.
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	return name
+}
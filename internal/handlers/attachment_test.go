@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/blob"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartFile returns a multipart/form-data body carrying content in the
+// named part, and its content type
+func multipartFile(t *testing.T, field, fileName string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("note", "before the repair"))
+	part, err := writer.CreateFormFile(field, fileName)
+	assert.NoError(t, err)
+	_, err = part.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return &body, writer.FormDataContentType()
+}
+
+func TestAttachmentHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	other := models.User{Username: "tech2", Role: models.RoleTechnician}
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	for _, user := range []*models.User{&tech, &other, &manager} {
+		assert.NoError(t, users.Create(ctx, user))
+	}
+
+	teams := repository.NewMemoryTeamRepository(users)
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(ctx, &team))
+	for _, member := range []models.TeamMember{
+		{TeamID: team.ID, UserID: tech.ID, Role: models.TeamRoleMember},
+		{TeamID: team.ID, UserID: manager.ID, Role: models.TeamRoleManager},
+	} {
+		assert.NoError(t, teams.SetMember(ctx, &member))
+	}
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	attachments := repository.NewMemoryAttachmentRepository(tasks)
+	blobs := blob.NewFileStore(t.TempDir())
+	handler := NewAttachmentHandler(attachments, tasks, teams, blobs, authz.Default(), []byte("url secret"))
+	handler.MaxSize = 64 << 10
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Summary: "Replace the pump seal",
+		PerformedAt: time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC), Status: models.StatusInProgress}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	serve := func(handle http.HandlerFunc, method string, body *bytes.Buffer, contentType string, user models.User, vars map[string]string) *httptest.ResponseRecorder {
+		if body == nil {
+			body = &bytes.Buffer{}
+		}
+		req := httptest.NewRequest(method, "/tasks/task1/attachments", body)
+		req.Header.Set("Content-Type", contentType)
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(user.ID))
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(user.Role))
+		req = mux.SetURLVars(req.WithContext(reqCtx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	taskVars := map[string]string{"id": "task1"}
+	attachmentVars := func(id string) map[string]string {
+		return map[string]string{"id": "task1", "attachment_id": id}
+	}
+	upload := func(t *testing.T, user models.User, fileName string, content []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		body, contentType := multipartFile(t, "file", fileName, content)
+		return serve(handler.UploadAttachment, "POST", body, contentType, user, taskVars)
+	}
+	// download follows a signed link through the router, without authentication
+	download := func(link string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.HandleFunc("/tasks/{id}/attachments/{attachment_id}/{variant:content|thumbnail}", handler.DownloadAttachment)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", link, nil))
+		return rr
+	}
+
+	photo := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	for x := 0; x < 800; x++ {
+		photo.Set(x, 300, color.RGBA{R: 255, A: 255})
+	}
+	var photoPNG bytes.Buffer
+	assert.NoError(t, png.Encode(&photoPNG, photo))
+	reportPDF := []byte("%PDF-1.7\n1 0 obj << /Type /Catalog >> endobj\n%%EOF\n")
+
+	var image1 AttachmentResponse
+	t.Run("upload an image", func(t *testing.T) {
+		rr := upload(t, tech, `C:\Users\pat\Pictures\before.png`, photoPNG.Bytes())
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &image1))
+
+		assert.Equal(t, "before.png", image1.FileName)
+		assert.Equal(t, "image/png", image1.ContentType)
+		assert.Equal(t, int64(photoPNG.Len()), image1.Size)
+		assert.Len(t, image1.Checksum, 64)
+		assert.Equal(t, int64(tech.ID), image1.UploaderID)
+		assert.NotEmpty(t, image1.DownloadURL)
+		assert.NotEmpty(t, image1.ThumbnailURL)
+		assert.NotContains(t, rr.Body.String(), "storage_key")
+	})
+
+	t.Run("download through signed links", func(t *testing.T) {
+		rr := download(image1.DownloadURL)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, photoPNG.Bytes(), rr.Body.Bytes())
+		assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), `filename=before.png`)
+
+		rr = download(image1.ThumbnailURL)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+		config, err := jpeg.DecodeConfig(rr.Body)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 256, config.Width)
+			assert.Equal(t, 192, config.Height)
+		}
+	})
+
+	t.Run("links can not be tampered with", func(t *testing.T) {
+		link, err := url.Parse(image1.DownloadURL)
+		assert.NoError(t, err)
+		query := link.Query()
+
+		// The signature of the thumbnail does not open the content
+		thumbnailLink, _ := url.Parse(image1.ThumbnailURL)
+		query.Set("signature", thumbnailLink.Query().Get("signature"))
+		link.RawQuery = query.Encode()
+		assert.Equal(t, http.StatusForbidden, download(link.String()).Code)
+
+		original, _ := url.Parse(image1.DownloadURL)
+		query = original.Query()
+		query.Set("expires", "9999999999")
+		link.RawQuery = query.Encode()
+		assert.Equal(t, http.StatusForbidden, download(link.String()).Code)
+
+		assert.Equal(t, http.StatusForbidden, download(strings.Split(image1.DownloadURL, "?")[0]).Code)
+	})
+
+	t.Run("links expire", func(t *testing.T) {
+		handler.now = func() time.Time { return time.Now().Add(handler.URLTTL + time.Second) }
+		defer func() { handler.now = time.Now }()
+		assert.Equal(t, http.StatusForbidden, download(image1.DownloadURL).Code)
+	})
+
+	var report AttachmentResponse
+	t.Run("upload a document", func(t *testing.T) {
+		rr := upload(t, manager, "service report.pdf", reportPDF)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, "application/pdf", report.ContentType)
+		assert.Empty(t, report.ThumbnailURL)
+
+		rr = download(report.DownloadURL)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, reportPDF, rr.Body.Bytes())
+
+		thumbnail := strings.Replace(report.DownloadURL, "/content?", "/thumbnail?", 1)
+		assert.Equal(t, http.StatusForbidden, download(thumbnail).Code)
+	})
+
+	t.Run("the content decides the type", func(t *testing.T) {
+		rr := upload(t, tech, "photo.jpg", []byte("#!/bin/sh\nrm -rf /\n"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+		// A corrupt image is kept, without a thumbnail
+		rr = upload(t, tech, "broken.png", photoPNG.Bytes()[:100])
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var broken AttachmentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &broken))
+		assert.Empty(t, broken.ThumbnailURL)
+		assert.Equal(t, http.StatusOK, serve(handler.DeleteAttachment, "DELETE", nil, "", tech, attachmentVars(broken.ID)).Code)
+	})
+
+	t.Run("malformed uploads", func(t *testing.T) {
+		rr := upload(t, tech, "large.pdf", append(append([]byte{}, reportPDF...), make([]byte, handler.MaxSize)...))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+		rr = upload(t, tech, "empty.pdf", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		body, contentType := multipartFile(t, "document", "report.pdf", reportPDF)
+		rr = serve(handler.UploadAttachment, "POST", body, contentType, tech, taskVars)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "A file part is required")
+
+		rr = serve(handler.UploadAttachment, "POST", bytes.NewBufferString(`{"file":"x"}`), "application/json", tech, taskVars)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("attachments follow task visibility", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, upload(t, other, "report.pdf", reportPDF).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.ListAttachments, "GET", nil, "", other, taskVars).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetAttachment, "GET", nil, "", other, attachmentVars(image1.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.DeleteAttachment, "DELETE", nil, "", other, attachmentVars(image1.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetAttachment, "GET", nil, "", tech, attachmentVars("missing")).Code)
+	})
+
+	t.Run("list and get", func(t *testing.T) {
+		rr := serve(handler.ListAttachments, "GET", nil, "", manager, taskVars)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []AttachmentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, image1.ID, list[0].ID)
+			assert.Equal(t, report.ID, list[1].ID)
+			assert.Equal(t, http.StatusOK, download(list[0].DownloadURL).Code)
+		}
+
+		rr = serve(handler.GetAttachment, "GET", nil, "", tech, attachmentVars(report.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var got AttachmentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+		assert.Equal(t, "service report.pdf", got.FileName)
+		assert.True(t, got.URLExpiresAt.After(time.Now()))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		// Technicians delete their own files, managers those of their team
+		rr := serve(handler.DeleteAttachment, "DELETE", nil, "", tech, attachmentVars(report.ID))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = serve(handler.DeleteAttachment, "DELETE", nil, "", manager, attachmentVars(report.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Equal(t, http.StatusNotFound, download(report.DownloadURL).Code)
+		keys, err := attachments.PendingBlobDeletions(ctx, 10)
+		assert.NoError(t, err)
+		assert.Contains(t, keys, "attachments/"+report.ID)
+	})
+
+	t.Run("deleting the task queues its blobs", func(t *testing.T) {
+		assert.NoError(t, tasks.Delete(ctx, task.ID, 1))
+		keys, err := attachments.PendingBlobDeletions(ctx, 10)
+		assert.NoError(t, err)
+		assert.Contains(t, keys, "attachments/"+image1.ID)
+		assert.Contains(t, keys, "attachments/"+image1.ID+"-thumbnail")
+		assert.Equal(t, http.StatusNotFound, download(image1.DownloadURL).Code)
+	})
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	for name, want := range map[string]string{
+		"report.pdf":                 "report.pdf",
+		"../../etc/passwd":           "passwd",
+		`C:\photos\before.jpg`:       "before.jpg",
+		" bad\x00name\r\n.png ":      "badname.png",
+		"":                           "attachment",
+		"..":                         "attachment",
+		strings.Repeat("é", 200):     strings.Repeat("é", 127),
+		"dir/":                       "attachment",
+		"\u202egnp.exe":              "gnp.exe",
+		"rapport d'intervention.pdf": "rapport d'intervention.pdf",
+	} {
+		assert.Equal(t, want, sanitizeFileName(name), name)
+	}
+}
@@ -1,23 +1,73 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/metrics"
+	"github.com/makcim392/maintenance-api/internal/middleware"
 	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	db *sql.DB
+	users       repository.UserRepository
+	tokens      repository.TokenRepository
+	invitations repository.InvitationRepository
+	keys        *auth.KeySet
+
+	// OpenRegistration lets technicians register without an invitation,
+	// every other role always needs one
+	OpenRegistration bool
+	// Organizations, when set, lets technicians register into the
+	// organization they name, provided it allows open registration. Without
+	// it they register into the default organization.
+	Organizations repository.OrganizationRepository
+	// Attempts, when set, refuses logins for a username or from a client
+	// address after repeated failures, as decided by UsernameLockout and
+	// AddressLockout
+	Attempts        repository.LoginAttemptRepository
+	UsernameLockout auth.LockoutPolicy
+	AddressLockout  auth.LockoutPolicy
+	// TrustForwardedFor takes the client address from the last
+	// X-Forwarded-For entry instead of the connection
+	TrustForwardedFor bool
+	// MFA, when set, asks users with a confirmed TOTP enrollment for a code
+	// after their password, see LoginMFA
+	MFA repository.MFARepository
+	// MFARequiredRoles are the roles that must use two-factor authentication,
+	// their logins without it are told to enrol
+	MFARequiredRoles map[models.Role]bool
+	// Passwords decides which passwords users may register with
+	Passwords auth.PasswordPolicy
 }
 
-func NewAuthHandler(db *sql.DB) *AuthHandler {
+// dummyPasswordHash is compared with the password sent for an unknown
+// username, so the response takes as long as for a known one and timing does
+// not reveal which usernames exist
+var dummyPasswordHash = []byte("$2a$10$ZIBbA5juJEreCCSeJjqj4e.OSaveBxZbhyj4xofzHmGG.hDXMTDN.")
+
+func NewAuthHandler(users repository.UserRepository, tokens repository.TokenRepository, invitations repository.InvitationRepository, keys *auth.KeySet) *AuthHandler {
 	return &AuthHandler{
-		db: db,
+		users:           users,
+		tokens:          tokens,
+		invitations:     invitations,
+		keys:            keys,
+		UsernameLockout: auth.DefaultUsernameLockout,
+		AddressLockout:  auth.DefaultAddressLockout,
+		Passwords:       auth.DefaultPasswordPolicy,
 	}
 }
 
@@ -25,58 +75,611 @@ type LoginRequest struct {
 	Username string      `json:"username"`
 	Password string      `json:"password"`
 	Role     models.Role `json:"role"`
+	Email    string      `json:"email,omitempty"`
+	// DeviceName names the session the login starts in the session list
+	DeviceName string `json:"device_name,omitempty"`
 }
 
+const (
+	// maxDeviceNameLength is the longest device name a login may give
+	maxDeviceNameLength = 100
+	// maxUserAgentLength is how much of the User-Agent header is kept for a session
+	maxUserAgentLength = 255
+)
+
+// Login exchanges a username and password for tokens. Unknown usernames and
+// wrong passwords get the same answer, and once a username or a client
+// address failed too often logins are refused until the lockout expires.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if len(req.DeviceName) > maxDeviceNameLength {
+		http.Error(w, "Device name is too long", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	usernameKey := models.UsernameAttemptKey(req.Username)
+	addressKey := models.AddressAttemptKey(h.clientAddress(r))
+	if until := h.reserveAttempt(ctx, usernameKey, addressKey); !until.IsZero() {
+		metrics.RecordAuthAttempt("password", false)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	// The attempt was counted as failed, take it back unless it was
+	failed := false
+	defer func() {
+		if !failed {
+			h.releaseAttempt(ctx, usernameKey, addressKey)
+		}
+	}()
+
+	// Look up the user
+	user, err := h.users.GetByUsername(ctx, req.Username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Verify password, against the dummy hash for unknown users
+	hash := dummyPasswordHash
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user == nil {
+		failed = true
+		metrics.RecordAuthAttempt("password", false)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
 
-	// Query user from database
-	var user models.User
-	query := `SELECT id, password, role FROM users WHERE username = ?`
-	err := h.db.QueryRow(query, req.Username).Scan(&user.ID, &user.Password, &user.Role)
+	// Only tell the owner of the account it was deactivated
+	if !user.Active {
+		metrics.RecordAuthAttempt("password", false)
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	// Users with a second factor get a challenge instead of tokens. Their
+	// failures are only reset by LoginMFA, or the password alone would let
+	// codes be guessed without ever being locked out for long.
+	enrolled, err := h.mfaEnrolled(ctx, user.ID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enrolled {
+		challenge, err := h.keys.IssueMFAChallenge(user.ID)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		metrics.RecordAuthAttempt("password", true)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+			ExpiresIn:   int(auth.MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	h.resetFailures(ctx, usernameKey)
+
+	response, err := h.startSession(r, user, req.DeviceName, false)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	metrics.RecordAuthAttempt("password", true)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// MFAChallengeResponse is returned by Login instead of tokens to users with
+// two-factor authentication, MFAToken is exchanged for tokens with LoginMFA
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	// ExpiresIn is the lifetime of the challenge in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// LoginMFARequest is the body of LoginMFA, with either a code from the
+// authenticator app or an unused recovery code
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	// DeviceName names the session the login starts, as for Login
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// LoginMFA completes the login of a user with two-factor authentication by
+// exchanging the challenge of Login and a second factor for tokens. Wrong
+// codes count as failed logins of the user and of the client address.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		http.Error(w, "Code or recovery code is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.DeviceName) > maxDeviceNameLength {
+		http.Error(w, "Device name is too long", http.StatusBadRequest)
+		return
+	}
+	if h.MFA == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	method := "totp"
+	if req.Code == "" {
+		method = "recovery_code"
+	}
+
+	claims, err := h.keys.ParseMFAChallenge(req.MFAToken)
+	if err != nil {
+		metrics.RecordAuthAttempt(method, false)
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
 			return
 		}
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
+	if !user.Active {
+		metrics.RecordAuthAttempt(method, false)
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
 
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	usernameKey := models.UsernameAttemptKey(user.Username)
+	addressKey := models.AddressAttemptKey(h.clientAddress(r))
+	if until := h.reserveAttempt(ctx, usernameKey, addressKey); !until.IsZero() {
+		metrics.RecordAuthAttempt(method, false)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	// The attempt was counted as failed, take it back unless it was
+	failed := false
+	defer func() {
+		if !failed {
+			h.releaseAttempt(ctx, usernameKey, addressKey)
+		}
+	}()
+
+	if req.Code != "" {
+		err = verifyTOTP(ctx, h.MFA, user.ID, req.Code)
+	} else {
+		err = h.MFA.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(req.RecoveryCode))
+		if errors.Is(err, repository.ErrNotFound) {
+			err = errInvalidCode
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidCode) {
+			failed = true
+			metrics.RecordAuthAttempt(method, false)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	h.resetFailures(ctx, usernameKey)
+
+	response, err := h.startSession(r, user, req.DeviceName, true)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	metrics.RecordAuthAttempt(method, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// mfaEnrolled reports whether the user has a confirmed second factor
+func (h *AuthHandler) mfaEnrolled(ctx context.Context, userID uint) (bool, error) {
+	if h.MFA == nil {
+		return false, nil
+	}
+	enrollment, err := h.MFA.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enrollment.Confirmed(), nil
+}
+
+// reserveAttempt counts the login as failed for the username and the address
+// before the password is checked, so concurrent guesses can not all pass the
+// lockout. When either is locked out nothing is counted and the time logins
+// are refused until is returned, the zero time otherwise. Errors are only
+// logged, the login goes on.
+func (h *AuthHandler) reserveAttempt(ctx context.Context, usernameKey, addressKey string) time.Time {
+	if h.Attempts == nil {
+		return time.Time{}
+	}
+	now := time.Now()
+	until, err := h.Attempts.Reserve(ctx, usernameKey, now, h.UsernameLockout)
+	if err != nil {
+		log.Printf("Error counting login of %s: %v", usernameKey, err)
+	} else if !until.IsZero() {
+		return until
+	}
+
+	until, addressErr := h.Attempts.Reserve(ctx, addressKey, now, h.AddressLockout)
+	if addressErr != nil {
+		log.Printf("Error counting login of %s: %v", addressKey, addressErr)
+	} else if !until.IsZero() && err == nil {
+		if err := h.Attempts.Release(ctx, usernameKey); err != nil {
+			log.Printf("Error releasing login of %s: %v", usernameKey, err)
+		}
+	}
+	return until
+}
+
+// releaseAttempt takes back a login counted by reserveAttempt that did not fail
+func (h *AuthHandler) releaseAttempt(ctx context.Context, usernameKey, addressKey string) {
+	if h.Attempts == nil {
+		return
+	}
+	for _, key := range []string{usernameKey, addressKey} {
+		if err := h.Attempts.Release(ctx, key); err != nil {
+			log.Printf("Error releasing login of %s: %v", key, err)
+		}
+	}
+}
+
+// resetFailures forgets the failed logins of a username once its password was
+// given. The failures of the address are kept, otherwise logging into one
+// account would reset the guesses made against every other.
+func (h *AuthHandler) resetFailures(ctx context.Context, usernameKey string) {
+	if h.Attempts == nil {
+		return
+	}
+	if err := h.Attempts.Reset(ctx, usernameKey); err != nil {
+		log.Printf("Error resetting failed logins of %s: %v", usernameKey, err)
+	}
+}
+
+// clientAddress returns the address of the client for address lockouts and
+// sessions
+func (h *AuthHandler) clientAddress(r *http.Request) string {
+	if h.TrustForwardedFor {
+		// The proxy appends the address it received the request from, every
+		// entry before it may have been sent by the client
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if address := strings.TrimSpace(entries[len(entries)-1]); address != "" {
+				return address
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RegisterRequest is the body of Register
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Role and Email are taken from the invitation when one is given
+	Role  models.Role `json:"role"`
+	Email string      `json:"email,omitempty"`
+	// InvitationToken is the signed token of an invitation
+	InvitationToken string `json:"invitation_token,omitempty"`
+	// Organization is the slug of the organization to register into without
+	// an invitation, the default organization when empty. Invited users join
+	// the organization of the invitation.
+	Organization string `json:"organization,omitempty"`
+}
+
+// TokenResponse is returned by Login and RefreshToken
+type TokenResponse struct {
+	// Token is the short-lived access token sent as a Bearer token
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int `json:"expires_in"`
+	// MFAEnrolmentRequired is set when the role of the user requires
+	// two-factor authentication and the token only allows enrolling
+	MFAEnrolmentRequired bool `json:"mfa_enrolment_required,omitempty"`
+}
+
+// RefreshRequest carries the refresh token for RefreshToken and Logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// Each refresh token can be exchanged once, presenting one a second time means
+// it leaked and the whole family is revoked.
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	stored, err := h.tokens.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID, string(user.Role))
+	// Marking the token as used is a compare-and-set, so of two concurrent
+	// exchanges of the same token only one wins and the other counts as reuse
+	if stored.UsedAt == nil {
+		err = h.tokens.UseRefreshToken(ctx, stored.ID)
+	} else {
+		err = repository.ErrConflict
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			log.Printf("Refresh token reuse detected for user %d, revoking token family %s", stored.UserID, stored.FamilyID)
+			if err := h.tokens.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				log.Printf("Error revoking token family %s: %v", stored.FamilyID, err)
+			}
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Issue the new access token with the current role
+	user, err := h.users.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !user.Active {
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	if err := h.renewSession(r, stored); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// The second factor of the login carries over to the tokens it refreshes
+	response, err := h.issueTokens(ctx, user, stored.FamilyID, stored.MFA)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	// Return token
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout revokes the access token of the request and, when its refresh token
+// is sent along, every token of that login
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	userID, _ := ctx.Value(middleware.UserIDContextKey).(int)
+
+	if req.RefreshToken != "" {
+		stored, err := h.tokens.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		// A token of another user is ignored rather than revoked
+		if stored != nil && int(stored.UserID) == userID {
+			if err := h.tokens.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if jti, _ := ctx.Value(middleware.TokenIDContextKey).(string); jti != "" {
+		expiresAt, ok := ctx.Value(middleware.TokenExpiryContextKey).(time.Time)
+		if !ok {
+			expiresAt = time.Now().Add(auth.AccessTokenTTL)
+		}
+		if err := h.tokens.RevokeAccessToken(ctx, jti, expiresAt); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
+		"message": "Logged out successfully",
 	})
 }
 
+// startSession records the session of a new login from the client of the
+// request and issues the first tokens of its refresh token family
+func (h *AuthHandler) startSession(r *http.Request, user *models.User, deviceName string, mfa bool) (*TokenResponse, error) {
+	// Every login starts a new refresh token family, which is the session
+	session := h.newSession(r, uuid.NewString(), user.ID)
+	session.DeviceName = strings.TrimSpace(deviceName)
+	if err := h.tokens.CreateSession(r.Context(), session); err != nil {
+		return nil, err
+	}
+	return h.issueTokens(r.Context(), user, session.ID, mfa)
+}
+
+// renewSession records the refresh of a token of the session from the client
+// of the request. Families started before sessions were recorded get theirs
+// now, without the device name of the login.
+func (h *AuthHandler) renewSession(r *http.Request, token *models.RefreshToken) error {
+	ctx := r.Context()
+	_, err := h.tokens.GetSession(ctx, token.FamilyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = h.tokens.CreateSession(ctx, h.newSession(r, token.FamilyID, token.UserID))
+		if errors.Is(err, repository.ErrDuplicate) {
+			// Created by a concurrent refresh of another token of the family
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return h.tokens.RenewSession(ctx, token.FamilyID, h.clientAddress(r), time.Now().Add(auth.RefreshTokenTTL))
+}
+
+// newSession describes a session of the user from the client of the request
+func (h *AuthHandler) newSession(r *http.Request, id string, userID uint) *models.Session {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return &models.Session{
+		ID:        id,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: h.clientAddress(r),
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL).UTC(),
+	}
+}
+
+// issueTokens signs an access token for the user and stores a refresh token in
+// the given family, which is also the session the access token is bound to.
+// mfa tells whether the login used a second factor.
+func (h *AuthHandler) issueTokens(ctx context.Context, user *models.User, familyID string, mfa bool) (*TokenResponse, error) {
+	accessToken, claims, err := h.keys.IssueAccessToken(user.ID, user.OrganizationID, string(user.Role), familyID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = h.tokens.CreateRefreshToken(ctx, &models.RefreshToken{
+		UserID:        user.ID,
+		FamilyID:      familyID,
+		TokenHash:     hash,
+		AccessTokenID: claims.ID,
+		MFA:           mfa,
+		ExpiresAt:     time.Now().Add(auth.RefreshTokenTTL).UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		// Only possible without MFA, users who have it always log in with it
+		MFAEnrolmentRequired: !mfa && h.MFARequiredRoles[user.Role],
+	}, nil
+}
+
+// Register creates a user. With an invitation token the role, email and
+// organization come from the invitation, which can only be used once. Without
+// one only technicians can register, and only when registration is open on the
+// deployment and in the organization.
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
+	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	var claims *auth.InvitationClaims
+	var orgID int64
+	if req.InvitationToken != "" {
+		var err error
+		if claims, err = h.keys.ParseInvitationToken(req.InvitationToken); err != nil {
+			http.Error(w, "Invalid or expired invitation", http.StatusForbidden)
+			return
+		}
+		req.Role, req.Email = models.Role(claims.Role), claims.Email
+	} else {
+		if !h.OpenRegistration {
+			http.Error(w, "Registration requires an invitation", http.StatusForbidden)
+			return
+		}
+		if req.Role == "" {
+			req.Role = models.RoleTechnician
+		}
+		if req.Role != models.RoleTechnician {
+			http.Error(w, "Only technicians can register without an invitation", http.StatusForbidden)
+			return
+		}
+		var ok bool
+		if orgID, ok = h.registrationOrganization(w, r, req.Organization); !ok {
+			return
+		}
+	}
+
 	// Validate role
-	if req.Role != models.RoleTechnician && req.Role != models.RoleManager {
-		http.Error(w, "Invalid role. Must be either 'technician' or 'manager'", http.StatusBadRequest)
+	if !req.Role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Validate email, it is optional but must be deliverable when set
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.Passwords.Check(req.Password, req.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -87,22 +690,69 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Insert user into database
-	query := `
-        INSERT INTO users (username, password, role)
-        VALUES (?, ?, ?)
-    `
-	result, err := h.db.Exec(query, req.Username, hashedPassword, req.Role)
+	// Store the user, consuming the invitation
+	user := models.User{
+		OrganizationID: orgID,
+		Username:       req.Username,
+		Email:          req.Email,
+		Password:       string(hashedPassword),
+		Role:           req.Role,
+	}
+	if claims != nil {
+		err = h.invitations.Accept(r.Context(), claims.ID, &user)
+	} else {
+		err = h.users.Create(r.Context(), &user)
+	}
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			http.Error(w, "Invitation was already used or revoked", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			http.Error(w, "Username already taken", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":       id,
+		"id":       user.ID,
 		"username": req.Username,
 		"role":     req.Role,
 	})
 }
+
+// registrationOrganization returns the organization a technician registers
+// into without an invitation, writing the error response when there is none
+func (h *AuthHandler) registrationOrganization(w http.ResponseWriter, r *http.Request, slug string) (int64, bool) {
+	if h.Organizations == nil {
+		if slug != "" {
+			http.Error(w, "Unknown organization", http.StatusBadRequest)
+			return 0, false
+		}
+		return models.DefaultOrganizationID, true
+	}
+
+	var organization *models.Organization
+	var err error
+	if slug == "" {
+		organization, err = h.Organizations.Get(r.Context(), models.DefaultOrganizationID)
+	} else {
+		organization, err = h.Organizations.GetBySlug(r.Context(), slug)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Unknown organization", http.StatusBadRequest)
+		return 0, false
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if !organization.Settings.OpenRegistration {
+		http.Error(w, "Registration requires an invitation", http.StatusForbidden)
+		return 0, false
+	}
+	return organization.ID, true
+}
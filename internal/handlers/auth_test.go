@@ -2,14 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
 	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -21,16 +29,17 @@ func TestLogin(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewAuthHandler(db)
+	handler := NewAuthHandler(repository.NewMySQLUserRepository(db), repository.NewMemoryTokenRepository(),
+		repository.NewMySQLInvitationRepository(db), testKeySet(t))
 
 	t.Run("successful login", func(t *testing.T) {
 		// Create test password hash
 		hashedPass, _ := bcrypt.GenerateFromPassword([]byte("correctpass"), bcrypt.DefaultCost)
 
 		// Set up mock DB response
-		rows := sqlmock.NewRows([]string{"id", "password", "role"}).
-			AddRow(1, string(hashedPass), models.RoleTechnician)
-		mock.ExpectQuery("SELECT id, password, role FROM users WHERE username = ?").
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "password", "role", "active"}).
+			AddRow(1, 1, string(hashedPass), models.RoleTechnician, true)
+		mock.ExpectQuery("SELECT id, organization_id, password, role, active FROM users WHERE username = ?").
 			WithArgs("testuser").
 			WillReturnRows(rows)
 
@@ -49,19 +58,21 @@ func TestLogin(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response map[string]string
+		var response TokenResponse
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Contains(t, response, "token")
-		assert.NotEmpty(t, response["token"])
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.Equal(t, "Bearer", response.TokenType)
+		assert.Equal(t, 900, response.ExpiresIn)
 	})
 
 	t.Run("invalid credentials - wrong password", func(t *testing.T) {
 		hashedPass, _ := bcrypt.GenerateFromPassword([]byte("correctpass"), bcrypt.DefaultCost)
 
-		rows := sqlmock.NewRows([]string{"id", "password", "role"}).
-			AddRow(1, string(hashedPass), models.RoleTechnician)
-		mock.ExpectQuery("SELECT id, password, role FROM users WHERE username = ?").
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "password", "role", "active"}).
+			AddRow(1, 1, string(hashedPass), models.RoleTechnician, true)
+		mock.ExpectQuery("SELECT id, organization_id, password, role, active FROM users WHERE username = ?").
 			WithArgs("testuser").
 			WillReturnRows(rows)
 
@@ -82,7 +93,7 @@ func TestLogin(t *testing.T) {
 	})
 
 	t.Run("user not found", func(t *testing.T) {
-		mock.ExpectQuery("SELECT id, password, role FROM users WHERE username = ?").
+		mock.ExpectQuery("SELECT id, organization_id, password, role, active FROM users WHERE username = ?").
 			WithArgs("nonexistent").
 			WillReturnError(sql.ErrNoRows)
 
@@ -102,6 +113,25 @@ func TestLogin(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Invalid credentials")
 	})
 
+	t.Run("deactivated user", func(t *testing.T) {
+		hashedPass, _ := bcrypt.GenerateFromPassword([]byte("correctpass"), bcrypt.MinCost)
+
+		rows := sqlmock.NewRows([]string{"id", "organization_id", "password", "role", "active"}).
+			AddRow(1, 1, string(hashedPass), models.RoleTechnician, false)
+		mock.ExpectQuery("SELECT id, organization_id, password, role, active FROM users WHERE username = ?").
+			WithArgs("testuser").
+			WillReturnRows(rows)
+
+		body, _ := json.Marshal(map[string]string{"username": "testuser", "password": "correctpass"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		handler.Login(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Account is deactivated")
+	})
+
 	t.Run("invalid request body", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer([]byte("invalid json")))
 		req.Header.Set("Content-Type", "application/json")
@@ -114,7 +144,7 @@ func TestLogin(t *testing.T) {
 	})
 
 	t.Run("database error", func(t *testing.T) {
-		mock.ExpectQuery("SELECT id, password, role FROM users WHERE username = ?").
+		mock.ExpectQuery("SELECT id, organization_id, password, role, active FROM users WHERE username = ?").
 			WithArgs("testuser").
 			WillReturnError(sql.ErrConnDone)
 
@@ -135,6 +165,119 @@ func TestLogin(t *testing.T) {
 	})
 }
 
+func TestLoginLockout(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	attempts := repository.NewMemoryLoginAttemptRepository()
+	handler := NewAuthHandler(users, repository.NewMemoryTokenRepository(), repository.NewMemoryInvitationRepository(users), testKeySet(t))
+	handler.Attempts = attempts
+	handler.UsernameLockout = auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	handler.AddressLockout = auth.LockoutPolicy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	loginAs(t, handler, users, "alice")
+
+	login := func(username, password, address string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		req.RemoteAddr = address + ":4321"
+		w := httptest.NewRecorder()
+		handler.Login(w, req)
+		return w
+	}
+
+	t.Run("username is locked out after repeated failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("alice", "guess", "10.0.0.1").Code)
+		}
+		w := login("alice", "secret", "10.0.0.2")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+		// The failures double the lockout, the next one lasts two minutes
+		assert.NoError(t, attempts.RecordFailure(context.Background(), models.UsernameAttemptKey("alice"), time.Now(), time.Hour))
+		assert.Equal(t, "120", login("alice", "secret", "10.0.0.2").Header().Get("Retry-After"))
+	})
+
+	t.Run("unknown usernames are locked out alike", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			w := login("nobody", "guess", "10.0.0.3")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), "Invalid credentials")
+		}
+		w := login("nobody", "guess", "10.0.0.3")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "Too many failed login attempts")
+	})
+
+	t.Run("address is locked out across usernames", func(t *testing.T) {
+		loginAs(t, handler, users, "bob")
+		for _, username := range []string{"u1", "u2", "u3", "u4", "u5"} {
+			assert.Equal(t, http.StatusUnauthorized, login(username, "guess", "10.0.0.4").Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, login("bob", "secret", "10.0.0.4").Code)
+		assert.Equal(t, http.StatusOK, login("bob", "secret", "10.0.0.5").Code)
+	})
+
+	t.Run("forwarded address is only trusted when configured", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"username": "bob", "password": "secret"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		req.RemoteAddr = "10.0.0.5:4321"
+		req.Header.Set("X-Forwarded-For", "10.9.9.9, 10.0.0.4")
+		w := httptest.NewRecorder()
+		handler.Login(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		handler.TrustForwardedFor = true
+		defer func() { handler.TrustForwardedFor = false }()
+		req = httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		req.RemoteAddr = "10.0.0.5:4321"
+		req.Header.Set("X-Forwarded-For", "10.9.9.9, 10.0.0.4")
+		w = httptest.NewRecorder()
+		handler.Login(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("successful login forgets the failures of the username", func(t *testing.T) {
+		loginAs(t, handler, users, "carol")
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("carol", "guess", "10.0.0.6").Code)
+		}
+		assert.Equal(t, http.StatusOK, login("carol", "secret", "10.0.0.6").Code)
+		_, err := attempts.Get(context.Background(), models.UsernameAttemptKey("carol"))
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.Equal(t, http.StatusUnauthorized, login("carol", "guess", "10.0.0.6").Code)
+	})
+
+	t.Run("concurrent guesses do not get past the threshold", func(t *testing.T) {
+		loginAs(t, handler, users, "dave")
+		codes := make([]int, 20)
+		var wg sync.WaitGroup
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = login("dave", "guess", "10.0.1."+strconv.Itoa(i)).Code
+			}(i)
+		}
+		wg.Wait()
+
+		counts := make(map[int]int)
+		for _, code := range codes {
+			counts[code]++
+		}
+		assert.Equal(t, map[int]int{http.StatusUnauthorized: 3, http.StatusTooManyRequests: 17}, counts)
+		attempts, err := attempts.Get(context.Background(), models.UsernameAttemptKey("dave"))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts.Failures)
+	})
+
+	t.Run("refused and successful logins do not count against the address", func(t *testing.T) {
+		loginAs(t, handler, users, "erin")
+		assert.Equal(t, http.StatusOK, login("erin", "secret", "10.0.0.7").Code)
+		attempts, err := attempts.Get(context.Background(), models.AddressAttemptKey("10.0.0.7"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, attempts.Failures)
+	})
+}
+
 func TestRegister(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -142,16 +285,18 @@ func TestRegister(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewAuthHandler(db)
+	handler := NewAuthHandler(repository.NewMySQLUserRepository(db), repository.NewMemoryTokenRepository(),
+		repository.NewMySQLInvitationRepository(db), testKeySet(t))
+	handler.OpenRegistration = true
 
 	t.Run("successful registration - technician", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").
-			WithArgs("newuser", sqlmock.AnyArg(), models.RoleTechnician).
+			WithArgs(models.DefaultOrganizationID, "newuser", nil, sqlmock.AnyArg(), models.RoleTechnician).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		reqBody := LoginRequest{
 			Username: "newuser",
-			Password: "newpass",
+			Password: "brass lantern 42",
 			Role:     models.RoleTechnician,
 		}
 		body, _ := json.Marshal(reqBody)
@@ -170,14 +315,10 @@ func TestRegister(t *testing.T) {
 		assert.Equal(t, string(models.RoleTechnician), response["role"])
 	})
 
-	t.Run("successful registration - manager", func(t *testing.T) {
-		mock.ExpectExec("INSERT INTO users").
-			WithArgs("manager", sqlmock.AnyArg(), models.RoleManager).
-			WillReturnResult(sqlmock.NewResult(2, 1))
-
+	t.Run("manager needs an invitation", func(t *testing.T) {
 		reqBody := LoginRequest{
 			Username: "manager",
-			Password: "managerpass",
+			Password: "brass lantern 42",
 			Role:     models.RoleManager,
 		}
 		body, _ := json.Marshal(reqBody)
@@ -187,13 +328,54 @@ func TestRegister(t *testing.T) {
 
 		handler.Register(w, req)
 
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Only technicians can register without an invitation")
+	})
+
+	t.Run("successful registration - with email", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs(models.DefaultOrganizationID, "mailer", "mailer@example.com", sqlmock.AnyArg(), models.RoleTechnician).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+
+		reqBody := LoginRequest{
+			Username: "mailer",
+			Password: "brass lantern 42",
+			Role:     models.RoleTechnician,
+			Email:    "mailer@example.com",
+		}
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.Register(w, req)
+
 		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		reqBody := LoginRequest{
+			Username: "mailer",
+			Password: "brass lantern 42",
+			Role:     models.RoleTechnician,
+			Email:    "not-an-email",
+		}
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.Register(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid email address")
 	})
 
 	t.Run("invalid role", func(t *testing.T) {
 		reqBody := LoginRequest{
 			Username: "newuser",
-			Password: "newpass",
+			Password: "brass lantern 42",
 			Role:     "invalid_role",
 		}
 		body, _ := json.Marshal(reqBody)
@@ -207,6 +389,61 @@ func TestRegister(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Invalid request body")
 	})
 
+	t.Run("weak password", func(t *testing.T) {
+		for _, password := range []string{"", "short", "password123", "newuser-lantern"} {
+			body, _ := json.Marshal(LoginRequest{Username: "newuser", Password: password, Role: models.RoleTechnician})
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			handler.Register(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, password)
+			assert.Contains(t, w.Body.String(), "password", password)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("admin role", func(t *testing.T) {
+		body, _ := json.Marshal(LoginRequest{Username: "boss", Password: "brass lantern 42", Role: models.RoleAdmin})
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		handler.Register(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Only technicians can register without an invitation")
+	})
+
+	t.Run("duplicate username", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs(models.DefaultOrganizationID, "newuser", nil, sqlmock.AnyArg(), models.RoleTechnician).
+			WillReturnError(&mysql.MySQLError{Number: 1062})
+
+		body, _ := json.Marshal(LoginRequest{Username: "newuser", Password: "brass lantern 42", Role: models.RoleTechnician})
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		handler.Register(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "Username already taken")
+	})
+
+	t.Run("registration closed", func(t *testing.T) {
+		inviteOnly := NewAuthHandler(repository.NewMySQLUserRepository(db), repository.NewMemoryTokenRepository(),
+			repository.NewMySQLInvitationRepository(db), testKeySet(t))
+
+		body, _ := json.Marshal(LoginRequest{Username: "newuser", Password: "brass lantern 42", Role: models.RoleTechnician})
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		inviteOnly.Register(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Registration requires an invitation")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("invalid request body", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBuffer([]byte("invalid json")))
 		req.Header.Set("Content-Type", "application/json")
@@ -220,12 +457,12 @@ func TestRegister(t *testing.T) {
 
 	t.Run("database error", func(t *testing.T) {
 		mock.ExpectExec("INSERT INTO users").
-			WithArgs("newuser", sqlmock.AnyArg(), models.RoleTechnician).
+			WithArgs(models.DefaultOrganizationID, "newuser", nil, sqlmock.AnyArg(), models.RoleTechnician).
 			WillReturnError(sql.ErrConnDone)
 
 		reqBody := LoginRequest{
 			Username: "newuser",
-			Password: "newpass",
+			Password: "brass lantern 42",
 			Role:     models.RoleTechnician,
 		}
 		body, _ := json.Marshal(reqBody)
@@ -239,3 +476,206 @@ func TestRegister(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Error creating user")
 	})
 }
+
+// testKeySet returns a key set with a single Ed25519 signing key
+func testKeySet(t *testing.T) *auth.KeySet {
+	t.Helper()
+	key, err := auth.GenerateKey("test")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keys, err := auth.NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	return keys
+}
+
+// loginAs registers a user in the memory repository and logs in through the handler
+func loginAs(t *testing.T, handler *AuthHandler, users *repository.MemoryUserRepository, username string) TokenResponse {
+	hashedPass, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if _, err := users.GetByUsername(context.Background(), username); err != nil {
+		assert.NoError(t, users.Create(context.Background(), &models.User{
+			Username: username, Password: string(hashedPass), Role: models.RoleTechnician,
+		}))
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": username, "password": "secret"})
+	w := httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func refresh(handler *AuthHandler, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: refreshToken})
+	w := httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(body)))
+	return w
+}
+
+func TestRefreshToken(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	keys := testKeySet(t)
+	handler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	validator := &auth.JWTValidator{Keys: keys, Revocations: tokens}
+
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		login := loginAs(t, handler, users, "rotating")
+
+		w := refresh(handler, login.RefreshToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var rotated TokenResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+		assert.NotEqual(t, login.RefreshToken, rotated.RefreshToken)
+		assert.NotEqual(t, login.Token, rotated.Token)
+
+		claims, err := validator.ValidateToken(rotated.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, string(models.RoleTechnician), claims.Role)
+
+		// The rotated token can be exchanged in turn
+		assert.Equal(t, http.StatusOK, refresh(handler, rotated.RefreshToken).Code)
+	})
+
+	t.Run("reuse revokes the whole family", func(t *testing.T) {
+		login := loginAs(t, handler, users, "replayed")
+		other := loginAs(t, handler, users, "replayed")
+
+		w := refresh(handler, login.RefreshToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var rotated TokenResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+
+		// Replaying the exchanged token is rejected...
+		w = refresh(handler, login.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid refresh token")
+
+		// ...and so is every token of the family, refresh and access
+		assert.Equal(t, http.StatusUnauthorized, refresh(handler, rotated.RefreshToken).Code)
+		_, err := validator.ValidateToken(rotated.Token)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+		_, err = validator.ValidateToken(login.Token)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+
+		// Other logins of the same user are unaffected
+		_, err = validator.ValidateToken(other.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, refresh(handler, other.RefreshToken).Code)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		w := refresh(handler, "not-a-refresh-token")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		token, hash, _ := auth.NewRefreshToken()
+		user, _ := users.GetByUsername(context.Background(), "rotating")
+		assert.NoError(t, tokens.CreateRefreshToken(context.Background(), &models.RefreshToken{
+			UserID: user.ID, FamilyID: "expired", TokenHash: hash, ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(handler, token).Code)
+	})
+
+	t.Run("deactivated user", func(t *testing.T) {
+		login := loginAs(t, handler, users, "deactivated")
+		user, _ := users.GetByUsername(context.Background(), "deactivated")
+		assert.NoError(t, users.SetActive(context.Background(), user.ID, false))
+
+		w := refresh(handler, login.RefreshToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Account is deactivated")
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		w := refresh(handler, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Refresh token is required")
+	})
+}
+
+func TestLogout(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	keys := testKeySet(t)
+	handler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	validator := &auth.JWTValidator{Keys: keys, Revocations: tokens}
+	logout := middleware.NewAuthMiddlewareHandler(validator, users).AuthMiddleware(handler.Logout)
+
+	t.Run("revokes the access and refresh token", func(t *testing.T) {
+		login := loginAs(t, handler, users, "leaving")
+
+		body, _ := json.Marshal(RefreshRequest{RefreshToken: login.RefreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		w := httptest.NewRecorder()
+		logout(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := validator.ValidateToken(login.Token)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+		assert.Equal(t, http.StatusUnauthorized, refresh(handler, login.RefreshToken).Code)
+
+		// The revoked token can not be used to log out again
+		req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		w = httptest.NewRecorder()
+		logout(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("without a refresh token only the access token is revoked", func(t *testing.T) {
+		login := loginAs(t, handler, users, "leaving")
+
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		w := httptest.NewRecorder()
+		logout(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := validator.ValidateToken(login.Token)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+		assert.Equal(t, http.StatusOK, refresh(handler, login.RefreshToken).Code)
+	})
+
+	t.Run("refresh token of another user is ignored", func(t *testing.T) {
+		victim := loginAs(t, handler, users, "victim")
+		attacker := loginAs(t, handler, users, "attacker")
+
+		body, _ := json.Marshal(RefreshRequest{RefreshToken: victim.RefreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/logout", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+attacker.Token)
+		w := httptest.NewRecorder()
+		logout(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := validator.ValidateToken(victim.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, refresh(handler, victim.RefreshToken).Code)
+	})
+}
+
+func TestJWKSHandler(t *testing.T) {
+	keys := testKeySet(t)
+
+	w := httptest.NewRecorder()
+	JWKSHandler(keys)(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var jwks auth.JWKS
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "test", jwks.Keys[0].Kid)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	assert.NotContains(t, w.Body.String(), `"d"`)
+}
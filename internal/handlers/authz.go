@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// requestSubject returns the authenticated user of the request, answering
+// 500 when the auth middleware did not run
+func requestSubject(w http.ResponseWriter, r *http.Request) (authz.Subject, bool) {
+	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
+	if !ok {
+		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
+		return authz.Subject{}, false
+	}
+
+	role, ok := r.Context().Value(middleware.RoleContextKey).(string)
+	if !ok {
+		http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
+		return authz.Subject{}, false
+	}
+	// Only API keys set scopes, nil leaves access tokens unrestricted
+	scopes, _ := r.Context().Value(middleware.PermissionsContextKey).([]models.Permission)
+	return authz.Subject{UserID: int64(userID), Role: models.Role(role), Scopes: scopes}, true
+}
+
+// teamSubject returns the authenticated user of the request like
+// requestSubject, with the members of the teams they manage when their role
+// holds :team permissions. Without a team repository nobody manages a team.
+func teamSubject(w http.ResponseWriter, r *http.Request, authorizer *authz.Authorizer, teams repository.TeamRepository) (authz.Subject, bool) {
+	subject, ok := requestSubject(w, r)
+	if !ok || teams == nil || !authorizer.TeamScoped(subject.Role) {
+		return subject, ok
+	}
+
+	team, err := teams.ManagedUsers(r.Context(), uint(subject.UserID))
+	if err != nil {
+		log.Printf("Error loading the teams of user %d: %v", subject.UserID, err)
+		http.Error(w, "Error loading teams", http.StatusInternalServerError)
+		return authz.Subject{}, false
+	}
+	subject.Team = team
+	return subject, true
+}
+
+// readableTask returns the technician of a task the subject can see. Tasks of
+// other technicians are reported as not found so their existence is not revealed.
+func readableTask(w http.ResponseWriter, r *http.Request, tasks repository.TaskRepository, authorizer *authz.Authorizer,
+	subject authz.Subject, taskID string) (int64, bool) {
+	ownerID, err := tasks.Owner(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !authorizer.CanReadTask(subject, ownerID)) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return 0, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	return ownerID, true
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// guarded wraps a handler with the permission check of its route
+func guarded(permission models.Permission, handler http.HandlerFunc) http.HandlerFunc {
+	return middleware.NewPermissionMiddleware(authz.Default()).Require(permission, handler)
+}
+
+func TestRequestSubject(t *testing.T) {
+	t.Run("authenticated request", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 7)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
+
+		subject, ok := requestSubject(httptest.NewRecorder(), req.WithContext(ctx))
+		assert.True(t, ok)
+		assert.Equal(t, authz.Subject{UserID: 7, Role: models.RoleManager}, subject)
+	})
+
+	t.Run("API key", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 7)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
+		ctx = context.WithValue(ctx, middleware.PermissionsContextKey, []models.Permission{models.PermissionAssetRead})
+
+		subject, ok := requestSubject(httptest.NewRecorder(), req.WithContext(ctx))
+		assert.True(t, ok)
+		assert.Equal(t, []models.Permission{models.PermissionAssetRead}, subject.Scopes)
+	})
+
+	t.Run("missing role", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 7)
+
+		rr := httptest.NewRecorder()
+		_, ok := requestSubject(rr, req.WithContext(ctx))
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// maxCommentLength bounds the body of a comment, like the summary of a task
+const maxCommentLength = 2500
+
+// mentionPattern matches @username mentions. The @ must not follow a word
+// character or a dot so email addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.-]+)`)
+
+// CommentHandler serves the comment thread of each task. Whoever can see a
+// task can read and write its comments.
+type CommentHandler struct {
+	comments   repository.CommentRepository
+	tasks      repository.TaskRepository
+	users      repository.UserRepository
+	teams      repository.TeamRepository
+	authorizer *authz.Authorizer
+}
+
+// NewCommentHandler creates a CommentHandler. Mentions are resolved against
+// users, teams scopes managers to the tasks of their teams and may be nil.
+func NewCommentHandler(comments repository.CommentRepository, tasks repository.TaskRepository, users repository.UserRepository,
+	teams repository.TeamRepository, authorizer *authz.Authorizer) *CommentHandler {
+	return &CommentHandler{
+		comments:   comments,
+		tasks:      tasks,
+		users:      users,
+		teams:      teams,
+		authorizer: authorizer,
+	}
+}
+
+// commentRequest is the body of POST and PUT /tasks/{id}/comments
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+// CommentResponse is a comment in GetComment together with its previous bodies
+type CommentResponse struct {
+	models.TaskComment
+	Revisions []models.TaskCommentRevision `json:"revisions"`
+}
+
+// CreateComment adds a comment to a task. Mentioned users who can see the
+// task are notified.
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	ownerID, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID)
+	if !ok {
+		return
+	}
+
+	mentions, err := h.mentions(r.Context(), body, subject.UserID, ownerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := models.TaskComment{TaskID: taskID, AuthorID: subject.UserID, Body: body, Mentions: mentions}
+	err = h.comments.Create(r.Context(), &comment)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		log.Printf("Error encoding comment: %v", err)
+	}
+}
+
+// ListComments returns the comments of a task, oldest first
+func (h *CommentHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+
+	comments, err := h.comments.List(r.Context(), taskID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(comments); err != nil {
+		log.Printf("Error encoding comments: %v", err)
+	}
+}
+
+// GetComment returns a comment with its edit history
+func (h *CommentHandler) GetComment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+	comment, ok := h.comment(w, r, taskID)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.comments.Revisions(r.Context(), taskID, comment.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CommentResponse{TaskComment: *comment, Revisions: revisions}); err != nil {
+		log.Printf("Error encoding comment: %v", err)
+	}
+}
+
+// UpdateComment replaces the body of a comment, only its author may edit it.
+// The previous body is kept in the edit history and users mentioned for the
+// first time are notified.
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	ownerID, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID)
+	if !ok {
+		return
+	}
+	comment, ok := h.comment(w, r, taskID)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != subject.UserID {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	mentions, err := h.mentions(r.Context(), body, subject.UserID, ownerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment.Body = body
+	comment.Mentions = mentions
+	err = h.comments.Update(r.Context(), comment)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		log.Printf("Error encoding comment: %v", err)
+	}
+}
+
+// DeleteComment removes a comment and its edit history. Authors delete their
+// own comments, whoever may delete the task deletes any of its comments.
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	subject, ok := teamSubject(w, r, h.authorizer, h.teams)
+	if !ok {
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	ownerID, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID)
+	if !ok {
+		return
+	}
+	comment, ok := h.comment(w, r, taskID)
+	if !ok {
+		return
+	}
+	if !h.authorizer.CanDeleteComment(subject, comment.AuthorID, ownerID) {
+		http.Error(w, "Unauthorized to delete this comment", http.StatusForbidden)
+		return
+	}
+
+	err := h.comments.Delete(r.Context(), taskID, comment.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Comment deleted successfully",
+		"id":      strconv.FormatInt(comment.ID, 10),
+	})
+}
+
+// decodeCommentBody reads and validates the body of a new or edited comment,
+// answering 400 when it is empty or too long
+func decodeCommentBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(body) > maxCommentLength {
+		http.Error(w, fmt.Sprintf("Comment must not exceed %d characters", maxCommentLength), http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// comment returns the comment of the {comment_id} route variable, answering
+// 400 for a malformed ID and 404 when the task has no such comment
+func (h *CommentHandler) comment(w http.ResponseWriter, r *http.Request, taskID string) (*models.TaskComment, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["comment_id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	comment, err := h.comments.Get(r.Context(), taskID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return comment, true
+}
+
+// mentions resolves the @usernames of a comment body to the IDs of active
+// users who can see the task performed by ownerID. Unknown names, users who
+// can not see the task and the author are left as plain text.
+func (h *CommentHandler) mentions(ctx context.Context, body string, authorID, ownerID int64) ([]int64, error) {
+	mentions := []int64{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// A mention at the end of a sentence is followed by its punctuation
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		user, err := h.users.GetByUsername(ctx, username)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if int64(user.ID) == authorID || !user.Active {
+			continue
+		}
+
+		readable, err := h.canReadTask(ctx, user, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if readable {
+			mentions = append(mentions, int64(user.ID))
+		}
+	}
+	return mentions, nil
+}
+
+// canReadTask reports whether a user may see a task performed by ownerID, so
+// mentions do not reveal tasks to users who could not open them
+func (h *CommentHandler) canReadTask(ctx context.Context, user *models.User, ownerID int64) (bool, error) {
+	subject := authz.Subject{UserID: int64(user.ID), Role: user.Role}
+	if h.teams != nil && h.authorizer.TeamScoped(user.Role) {
+		team, err := h.teams.ManagedUsers(ctx, user.ID)
+		if err != nil {
+			return false, err
+		}
+		subject.Team = team
+	}
+	return h.authorizer.CanReadTask(subject, ownerID), nil
+}
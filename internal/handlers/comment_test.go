@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	other := models.User{Username: "tech2", Role: models.RoleTechnician}
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	outsider := models.User{Username: "manager2", Role: models.RoleManager}
+	admin := models.User{Username: "admin", Role: models.RoleAdmin}
+	for _, user := range []*models.User{&tech, &other, &manager, &outsider, &admin} {
+		assert.NoError(t, users.Create(ctx, user))
+	}
+
+	// The manager manages the technician's team, the outsider nobody
+	teams := repository.NewMemoryTeamRepository(users)
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(ctx, &team))
+	for _, member := range []models.TeamMember{
+		{TeamID: team.ID, UserID: tech.ID, Role: models.TeamRoleMember},
+		{TeamID: team.ID, UserID: manager.ID, Role: models.TeamRoleManager},
+	} {
+		assert.NoError(t, teams.SetMember(ctx, &member))
+	}
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	comments := repository.NewMemoryCommentRepository(tasks)
+	handler := NewCommentHandler(comments, tasks, users, teams, authz.Default())
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Summary: "Inspect the boiler",
+		PerformedAt: time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC), Status: models.StatusInProgress}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	serve := func(handle http.HandlerFunc, method, body string, user models.User, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/tasks/task1/comments", bytes.NewBufferString(body))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(user.ID))
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(user.Role))
+		req = mux.SetURLVars(req.WithContext(reqCtx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	taskVars := map[string]string{"id": "task1"}
+	commentVars := func(id int64) map[string]string {
+		return map[string]string{"id": "task1", "comment_id": strconv.FormatInt(id, 10)}
+	}
+	create := func(t *testing.T, user models.User, body string) models.TaskComment {
+		t.Helper()
+		rr := serve(handler.CreateComment, "POST", body, user, taskVars)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var comment models.TaskComment
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &comment))
+		return comment
+	}
+
+	question := create(t, manager, `{"body":" @tech1 was the seal replaced? Ask @tech2, @manager2 or @nobody, mail bob@tech1 or tell @admin. "}`)
+
+	t.Run("create", func(t *testing.T) {
+		assert.Equal(t, int64(manager.ID), question.AuthorID)
+		assert.Equal(t, "manager1", question.AuthorName)
+		assert.Equal(t, "@tech1 was the seal replaced? Ask @tech2, @manager2 or @nobody, mail bob@tech1 or tell @admin.", question.Body)
+
+		// Users who can not see the task are not mentioned
+		assert.Equal(t, []int64{int64(tech.ID), int64(admin.ID)}, question.Mentions)
+		assert.Equal(t, 1, tasks.Outbox().Pending(models.OutboxNotifications))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		for _, body := range []string{`not json`, `{"body":"  "}`, `{"body":"` + strings.Repeat("a", maxCommentLength+1) + `"}`} {
+			rr := serve(handler.CreateComment, "POST", body, manager, taskVars)
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("comments follow task visibility", func(t *testing.T) {
+		for _, user := range []models.User{other, outsider} {
+			assert.Equal(t, http.StatusNotFound, serve(handler.ListComments, "GET", "", user, taskVars).Code)
+			assert.Equal(t, http.StatusNotFound, serve(handler.CreateComment, "POST", `{"body":"Hi"}`, user, taskVars).Code)
+			assert.Equal(t, http.StatusNotFound, serve(handler.GetComment, "GET", "", user, commentVars(question.ID)).Code)
+		}
+		rr := serve(handler.ListComments, "GET", "", admin, map[string]string{"id": "missing"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		create(t, tech, `{"body":"Yes, @manager1"}`)
+
+		rr := serve(handler.ListComments, "GET", "", tech, taskVars)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []models.TaskComment
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, question.ID, list[0].ID)
+			assert.Equal(t, "tech1", list[1].AuthorName)
+			assert.Equal(t, []int64{int64(manager.ID)}, list[1].Mentions)
+		}
+	})
+
+	t.Run("only the author edits", func(t *testing.T) {
+		rr := serve(handler.UpdateComment, "PUT", `{"body":"Changed"}`, tech, commentVars(question.ID))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.UpdateComment, "PUT", `{"body":"@tech1 was the seal replaced?"}`, manager, commentVars(question.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var edited models.TaskComment
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &edited))
+		assert.Equal(t, "@tech1 was the seal replaced?", edited.Body)
+		assert.Equal(t, []int64{int64(tech.ID)}, edited.Mentions)
+		assert.NotNil(t, edited.EditedAt)
+
+		rr = serve(handler.GetComment, "GET", "", tech, commentVars(question.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response CommentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "@tech1 was the seal replaced?", response.Body)
+		if assert.Len(t, response.Revisions, 1) {
+			assert.Equal(t, question.Body, response.Revisions[0].Body)
+		}
+	})
+
+	t.Run("unknown comments", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, serve(handler.GetComment, "GET", "", tech, map[string]string{"id": "task1", "comment_id": "x"}).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetComment, "GET", "", tech, commentVars(99)).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.UpdateComment, "PUT", `{"body":"x"}`, tech, commentVars(99)).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.DeleteComment, "DELETE", "", tech, commentVars(99)).Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		// Technicians delete their own comments only
+		rr := serve(handler.DeleteComment, "DELETE", "", tech, commentVars(question.ID))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		own := create(t, tech, `{"body":"Typo"}`)
+		rr = serve(handler.DeleteComment, "DELETE", "", tech, commentVars(own.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// Managers moderate the comments on the tasks of their team
+		reply := create(t, tech, `{"body":"Off topic"}`)
+		rr = serve(handler.DeleteComment, "DELETE", "", manager, commentVars(reply.ID))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetComment, "GET", "", manager, commentVars(reply.ID)).Code)
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// InvitationHandler lets managers and admins invite users to register
+type InvitationHandler struct {
+	invitations repository.InvitationRepository
+	keys        *auth.KeySet
+	authorizer  *authz.Authorizer
+
+	// SignupURL, when set, is the page of the frontend that registers with
+	// an invitation. Created invitations then carry a signup_url with the token.
+	SignupURL string
+}
+
+func NewInvitationHandler(invitations repository.InvitationRepository, keys *auth.KeySet, authorizer *authz.Authorizer) *InvitationHandler {
+	return &InvitationHandler{
+		invitations: invitations,
+		keys:        keys,
+		authorizer:  authorizer,
+	}
+}
+
+// CreateInvitationRequest is the body of CreateInvitation
+type CreateInvitationRequest struct {
+	Email string      `json:"email"`
+	Role  models.Role `json:"role"`
+	// ExpiresAt defaults to auth.InvitationTTL from now
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// InvitationResponse is an invitation with its current status. The token
+// and signup URL are only returned when the invitation is created.
+type InvitationResponse struct {
+	models.Invitation
+	Status    models.InvitationStatus `json:"status"`
+	Token     string                  `json:"token,omitempty"`
+	SignupURL string                  `json:"signup_url,omitempty"`
+}
+
+// CreateInvitation creates an invitation and returns its single-use token.
+// Inviting an admin needs user:manage on top of user:invite.
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		http.Error(w, "Role is required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == models.RoleAdmin && !h.authorizer.Allows(subject, models.PermissionUserManage) {
+		http.Error(w, "Only admins can invite admins", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(auth.InvitationTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(auth.MaxInvitationTTL)) {
+		http.Error(w, "Expiry must be in the future and at most 30 days away", http.StatusBadRequest)
+		return
+	}
+
+	invitation := models.Invitation{
+		TokenID:   uuid.NewString(),
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: uint(subject.UserID),
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+	token, err := h.keys.IssueInvitationToken(invitation.TokenID, invitation.Email, string(invitation.Role), invitation.ExpiresAt)
+	if err != nil {
+		http.Error(w, "Error generating invitation", http.StatusInternalServerError)
+		return
+	}
+	if err := h.invitations.Create(r.Context(), &invitation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := InvitationResponse{Invitation: invitation, Status: invitation.Status(now), Token: token}
+	if h.SignupURL != "" {
+		if signup, err := url.Parse(h.SignupURL); err == nil {
+			query := signup.Query()
+			query.Set("token", token)
+			signup.RawQuery = query.Encode()
+			response.SignupURL = signup.String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding invitation: %v", err)
+	}
+}
+
+// ListInvitations returns the invitations created by the user, or every
+// invitation for users with user:manage. ?status= filters by status.
+func (h *InvitationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	status := models.InvitationStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		http.Error(w, "Invalid status. Must be one of 'pending', 'accepted', 'revoked' or 'expired'", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := h.invitations.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	all := h.authorizer.Allows(subject, models.PermissionUserManage)
+	response := []InvitationResponse{}
+	for _, invitation := range invitations {
+		if !all && int64(invitation.InvitedBy) != subject.UserID {
+			continue
+		}
+		if status != "" && invitation.Status(now) != status {
+			continue
+		}
+		response = append(response, InvitationResponse{Invitation: invitation, Status: invitation.Status(now)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding invitations: %v", err)
+	}
+}
+
+// RevokeInvitation revokes a pending invitation created by the user, or any
+// invitation for users with user:manage
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.invitations.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if int64(invitation.InvitedBy) != subject.UserID && !h.authorizer.Allows(subject, models.PermissionUserManage) {
+		http.Error(w, "Not allowed to revoke this invitation", http.StatusForbidden)
+		return
+	}
+
+	err = h.invitations.Revoke(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConflict) {
+		http.Error(w, "Invitation was already accepted or revoked", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Invitation revoked successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
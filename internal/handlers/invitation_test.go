@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationHandler(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	invitations := repository.NewMemoryInvitationRepository(users)
+	keys := testKeySet(t)
+	handler := NewInvitationHandler(invitations, keys, authz.Default())
+	handler.SignupURL = "https://app.example.com/signup?lang=en"
+	authHandler := NewAuthHandler(users, repository.NewMemoryTokenRepository(), invitations, keys)
+
+	serve := func(handle http.HandlerFunc, method, target, body string, userID int, role models.Role, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	register := func(body map[string]string) *httptest.ResponseRecorder {
+		encoded, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		authHandler.Register(rr, httptest.NewRequest("POST", "/register", bytes.NewBuffer(encoded)))
+		return rr
+	}
+	invite := func(userID int, role models.Role, body string) InvitationResponse {
+		rr := serve(handler.CreateInvitation, "POST", "/invitations", body, userID, role, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var invitation InvitationResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &invitation))
+		return invitation
+	}
+
+	t.Run("technicians can not invite", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionUserInvite, handler.CreateInvitation), "POST", "/invitations",
+			`{"email":"new@example.com","role":"technician"}`, 1, models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("create validation", func(t *testing.T) {
+		for body, message := range map[string]string{
+			`{"email":"not-an-email","role":"manager"}`:                                        "Invalid email address",
+			`{"email":"new@example.com"}`:                                                      "Role is required",
+			`{"email":"new@example.com","role":"owner"}`:                                       "Invalid request body",
+			`{"email":"new@example.com","role":"manager","expires_at":"2020-01-01T00:00:00Z"}`: "Expiry must be in the future",
+		} {
+			rr := serve(handler.CreateInvitation, "POST", "/invitations", body, 10, models.RoleManager, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+			assert.Contains(t, rr.Body.String(), message, body)
+		}
+
+		rr := serve(handler.CreateInvitation, "POST", "/invitations", `{"email":"boss@example.com","role":"admin"}`, 10, models.RoleManager, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Only admins can invite admins")
+	})
+
+	t.Run("invitation registers once with its role and email", func(t *testing.T) {
+		invitation := invite(10, models.RoleManager, `{"email":"new@example.com","role":"manager"}`)
+		assert.Equal(t, models.InvitationPending, invitation.Status)
+		assert.Equal(t, uint(10), invitation.InvitedBy)
+		assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), invitation.ExpiresAt, time.Minute)
+		assert.NotEmpty(t, invitation.Token)
+		assert.Contains(t, invitation.SignupURL, "https://app.example.com/signup?lang=en&token=")
+
+		// The role and email of the request are overridden by the invitation
+		rr := register(map[string]string{"username": "newmanager", "password": "brass lantern 42", "role": "technician",
+			"email": "other@example.com", "invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		user, err := users.GetByUsername(context.Background(), "newmanager")
+		assert.NoError(t, err)
+		assert.Equal(t, models.RoleManager, user.Role)
+		stored, _ := users.GetByID(context.Background(), user.ID)
+		assert.Equal(t, "new@example.com", stored.Email)
+
+		rr = register(map[string]string{"username": "again", "password": "brass lantern 42", "invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Invitation was already used or revoked")
+	})
+
+	t.Run("taken username keeps the invitation usable", func(t *testing.T) {
+		invitation := invite(10, models.RoleManager, `{"email":"retry@example.com","role":"technician"}`)
+
+		rr := register(map[string]string{"username": "newmanager", "password": "brass lantern 42", "invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		rr = register(map[string]string{"username": "retried", "password": "brass lantern 42", "invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("forged and tampered tokens", func(t *testing.T) {
+		forged, err := testKeySet(t).IssueInvitationToken("forged", "evil@example.com", "admin", time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		rr := register(map[string]string{"username": "evil", "password": "brass lantern 42", "invitation_token": forged})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Invalid or expired invitation")
+
+		// Signed with the right key but never stored
+		unknown, err := keys.IssueInvitationToken("unknown", "evil@example.com", "admin", time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		rr = register(map[string]string{"username": "evil", "password": "brass lantern 42", "invitation_token": unknown})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		invitation := invite(10, models.RoleManager, `{"email":"revoked@example.com","role":"manager"}`)
+		id := map[string]string{"id": strconv.FormatInt(invitation.ID, 10)}
+
+		// Only the inviter or an admin may revoke it
+		rr := serve(handler.RevokeInvitation, "DELETE", "/invitations/"+id["id"], "", 11, models.RoleManager, id)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.RevokeInvitation, "DELETE", "/invitations/"+id["id"], "", 10, models.RoleManager, id)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(handler.RevokeInvitation, "DELETE", "/invitations/"+id["id"], "", 1, models.RoleAdmin, id)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = register(map[string]string{"username": "revoked", "password": "brass lantern 42", "invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.RevokeInvitation, "DELETE", "/invitations/99", "", 1, models.RoleAdmin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		invite(1, models.RoleAdmin, `{"email":"admin@example.com","role":"admin"}`)
+
+		list := func(userID int, role models.Role, target string) []InvitationResponse {
+			rr := serve(handler.ListInvitations, "GET", target, "", userID, role, nil)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var invitations []InvitationResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &invitations))
+			for _, invitation := range invitations {
+				assert.Empty(t, invitation.Token)
+			}
+			return invitations
+		}
+
+		// Managers see their own invitations, admins every invitation
+		assert.Len(t, list(10, models.RoleManager, "/invitations"), 3)
+		assert.Len(t, list(11, models.RoleManager, "/invitations"), 0)
+		assert.Len(t, list(1, models.RoleAdmin, "/invitations"), 4)
+
+		accepted := list(1, models.RoleAdmin, "/invitations?status=accepted")
+		assert.Len(t, accepted, 2)
+		pending := list(1, models.RoleAdmin, "/invitations?status=pending")
+		if assert.Len(t, pending, 1) {
+			assert.Equal(t, models.RoleAdmin, pending[0].Role)
+		}
+
+		rr := serve(handler.ListInvitations, "GET", "/invitations?status=unknown", "", 1, models.RoleAdmin, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
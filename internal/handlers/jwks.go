@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+)
+
+// JWKSHandler serves the public keys access tokens can be verified with at
+// /.well-known/jwks.json, so other services never need a shared secret
+func JWKSHandler(keys *auth.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Verifiers may cache the set briefly, a new key is published before it signs
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}
+}
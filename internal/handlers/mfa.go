@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// errInvalidCode is returned by verifyTOTP for a wrong, expired or replayed code
+var errInvalidCode = errors.New("invalid code")
+
+// MFAHandler lets users manage their own second factor and admins reset the
+// second factor of a user who lost it
+type MFAHandler struct {
+	mfa   repository.MFARepository
+	users repository.UserRepository
+
+	// Issuer names the service in authenticator apps
+	Issuer string
+	// RequiredRoles are the roles that can not disable two-factor authentication
+	RequiredRoles map[models.Role]bool
+	// Attempts, when set, counts wrong codes as failed logins of the user,
+	// so codes can not be guessed here either, as decided by Lockout
+	Attempts repository.LoginAttemptRepository
+	Lockout  auth.LockoutPolicy
+}
+
+func NewMFAHandler(mfa repository.MFARepository, users repository.UserRepository) *MFAHandler {
+	return &MFAHandler{
+		mfa:     mfa,
+		users:   users,
+		Issuer:  "Maintenance API",
+		Lockout: auth.DefaultUsernameLockout,
+	}
+}
+
+// MFAStatus is returned by GetMFAStatus
+type MFAStatus struct {
+	// Enabled is set once an enrollment was confirmed
+	Enabled bool `json:"enabled"`
+	// Pending is set while an enrollment waits for its first code
+	Pending bool `json:"pending"`
+	// Required is set when the role of the user requires two-factor authentication
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollmentResponse is returned by StartTOTP
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// ProvisioningURI is the otpauth:// URI to show as a QR code
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFACodeRequest carries the second factor confirming an MFA change, a code
+// from the authenticator app or, where accepted, an unused recovery code
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// RecoveryCodesResponse is returned by ConfirmTOTP and
+// RegenerateRecoveryCodes. The codes are shown this once, only their hashes
+// are stored.
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetMFAStatus returns the second factor status of the user
+func (h *MFAHandler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	status := MFAStatus{Required: h.RequiredRoles[subject.Role]}
+	enrollment, err := h.mfa.GetTOTP(ctx, uint(subject.UserID))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if enrollment != nil {
+		status.Enabled = enrollment.Confirmed()
+		status.Pending = !enrollment.Confirmed()
+	}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = h.mfa.RecoveryCodesLeft(ctx, uint(subject.UserID)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Error encoding MFA status: %v", err)
+	}
+}
+
+// StartTOTP generates a new TOTP secret for the user. It is only used once
+// ConfirmTOTP received a code for it, starting again replaces it.
+func (h *MFAHandler) StartTOTP(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, uint(subject.UserID))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	err = h.mfa.StartTOTP(ctx, &models.TOTPEnrollment{UserID: user.ID, Secret: secret})
+	if errors.Is(err, repository.ErrConflict) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(h.Issuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator app works by sending a code, and returns their recovery codes
+func (h *MFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userID := uint(subject.UserID)
+	enrollment, err := h.mfa.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "No two-factor enrollment was started", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if enrollment.Confirmed() {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(enrollment.Secret, req.Code, time.Now())
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	err = h.mfa.ConfirmTOTP(ctx, userID, step, hashes)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "No two-factor enrollment was started", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConflict) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{
+		Message:       "Two-factor authentication enabled, log in again to use it",
+		RecoveryCodes: codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, which
+// takes a current code from the authenticator app
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userID := uint(subject.UserID)
+	if !h.verify(w, r, userID, req) {
+		return
+	}
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := h.mfa.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{
+		Message:       "Recovery codes regenerated successfully",
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableMFA removes the second factor of the user after checking a code or
+// a recovery code. Users whose role requires two-factor authentication can
+// not disable it.
+func (h *MFAHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	if h.RequiredRoles[subject.Role] {
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "Code or recovery code is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := uint(subject.UserID)
+	if !h.verify(w, r, userID, req) {
+		return
+	}
+	err := h.mfa.DeleteTOTP(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled successfully",
+	})
+}
+
+// ResetUserMFA removes the second factor of a user who lost both their
+// authenticator app and their recovery codes, admins only
+func (h *MFAHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// The lookup keeps admins to the users of their organization
+	ctx := r.Context()
+	if _, err := h.users.GetByID(ctx, id); errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err := h.mfa.DeleteTOTP(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication reset successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+// verify checks the code or recovery code of the request, answering when it
+// is wrong or the user is locked out. Wrong codes count as failed logins.
+func (h *MFAHandler) verify(w http.ResponseWriter, r *http.Request, userID uint, req MFACodeRequest) bool {
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	// The attempt is counted as failed before the code is checked, so
+	// concurrent guesses can not all pass the lockout
+	key := models.UsernameAttemptKey(user.Username)
+	reserved := false
+	if h.Attempts != nil {
+		until, err := h.Attempts.Reserve(ctx, key, time.Now(), h.Lockout)
+		if err != nil {
+			log.Printf("Error counting attempt of %s: %v", key, err)
+		} else if !until.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+			http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+			return false
+		}
+		reserved = err == nil
+	}
+
+	if req.Code != "" {
+		err = verifyTOTP(ctx, h.mfa, userID, req.Code)
+	} else {
+		err = h.mfa.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(req.RecoveryCode))
+		if errors.Is(err, repository.ErrNotFound) {
+			err = errInvalidCode
+		}
+	}
+	if errors.Is(err, errInvalidCode) {
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return false
+	}
+	if reserved {
+		if err := h.Attempts.Release(ctx, key); err != nil {
+			log.Printf("Error releasing attempt of %s: %v", key, err)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// verifyTOTP accepts a code of the confirmed enrollment of the user once,
+// returning errInvalidCode for wrong codes and codes of a step already used
+func verifyTOTP(ctx context.Context, mfa repository.MFARepository, userID uint, code string) error {
+	enrollment, err := mfa.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return errInvalidCode
+	} else if err != nil {
+		return err
+	}
+	if !enrollment.Confirmed() {
+		return errInvalidCode
+	}
+
+	step, valid := auth.ValidateTOTP(enrollment.Secret, code, time.Now())
+	if !valid {
+		return errInvalidCode
+	}
+	err = mfa.UseTOTPStep(ctx, userID, step)
+	if errors.Is(err, repository.ErrConflict) || errors.Is(err, repository.ErrNotFound) {
+		return errInvalidCode
+	}
+	return err
+}
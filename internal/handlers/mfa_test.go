@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFA(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	mfa := repository.NewMemoryMFARepository()
+	attempts := repository.NewMemoryLoginAttemptRepository()
+	keys := testKeySet(t)
+	authHandler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	authHandler.MFA = mfa
+	authHandler.Attempts = attempts
+	handler := NewMFAHandler(mfa, users)
+	handler.Attempts = attempts
+	handler.Lockout = auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	loginAs(t, authHandler, users, "alice")
+	alice, _ := users.GetByUsername(ctx, "alice")
+
+	serve := func(handle http.HandlerFunc, method, body string, user *models.User, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/me/mfa", bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(user.ID))
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(user.Role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	login := func(body interface{}, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload)))
+		return rr
+	}
+	// The codes below are relative to the current time step, start with
+	// enough of it left that the test does not cross into the next
+	if left := auth.TOTPPeriod - time.Since(time.Unix(auth.TOTPStep(time.Now())*int64(auth.TOTPPeriod.Seconds()), 0)); left < 5*time.Second {
+		time.Sleep(left)
+	}
+	step := auth.TOTPStep(time.Now())
+	codeAt := func(secret string, offset int64) string {
+		code, err := auth.TOTPCode(secret, step+offset)
+		assert.NoError(t, err)
+		return code
+	}
+	status := func() MFAStatus {
+		var status MFAStatus
+		assert.NoError(t, json.Unmarshal(serve(handler.GetMFAStatus, "GET", "", alice, nil).Body.Bytes(), &status))
+		return status
+	}
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("enrolment", func(t *testing.T) {
+		rr := serve(handler.StartTOTP, "POST", "", alice, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var enrollment TOTPEnrollmentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+		assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/Maintenance%20API:alice?")
+		secret = enrollment.Secret
+		assert.Equal(t, MFAStatus{Pending: true}, status())
+
+		// A pending enrollment does not change the login yet
+		loginAs(t, authHandler, users, "alice")
+
+		rr = serve(handler.ConfirmTOTP, "POST", `{"code":"000000"}`, alice, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(handler.ConfirmTOTP, "POST", `{"code":"`+codeAt(secret, -1)+`"}`, alice, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var recovery RecoveryCodesResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &recovery))
+		assert.Len(t, recovery.RecoveryCodes, auth.RecoveryCodeCount)
+		recoveryCodes = recovery.RecoveryCodes
+		assert.Equal(t, MFAStatus{Enabled: true, RecoveryCodesLeft: auth.RecoveryCodeCount}, status())
+
+		rr = serve(handler.StartTOTP, "POST", "", alice, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("login takes a second step", func(t *testing.T) {
+		rr := login(map[string]string{"username": "alice", "password": "secret"}, authHandler.Login)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var challenge MFAChallengeResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+		assert.True(t, challenge.MFARequired)
+		assert.NotContains(t, rr.Body.String(), `"token"`)
+
+		// The challenge is not an access token
+		_, err := (&auth.JWTValidator{Keys: keys, Revocations: tokens}).ValidateToken(challenge.MFAToken)
+		assert.Error(t, err)
+
+		// The code of the step used to confirm the enrollment was spent
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, Code: codeAt(secret, -1)}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "Invalid code\n", rr.Body.String())
+
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, Code: codeAt(secret, 0)}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		claims, err := (&auth.JWTValidator{Keys: keys, Revocations: tokens}).ValidateToken(response.Token)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFA)
+
+		// Refreshed tokens keep the second factor
+		rr = refresh(authHandler, response.RefreshToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		claims, err = (&auth.JWTValidator{Keys: keys, Revocations: tokens}).ValidateToken(response.Token)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFA)
+
+		// Replaying the code fails
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, Code: codeAt(secret, 0)}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = login(LoginMFARequest{MFAToken: "not-a-token", Code: codeAt(secret, 1)}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Invalid or expired MFA token")
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		assert.NoError(t, attempts.Reset(ctx, models.UsernameAttemptKey("alice")))
+		rr := login(map[string]string{"username": "alice", "password": "secret"}, authHandler.Login)
+		var challenge MFAChallengeResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, RecoveryCode: recoveryCodes[0]}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, RecoveryCode: recoveryCodes[0]}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, auth.RecoveryCodeCount-1, status().RecoveryCodesLeft)
+
+		rr = serve(handler.RegenerateRecoveryCodes, "POST", `{"code":"`+codeAt(secret, 1)+`"}`, alice, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var recovery RecoveryCodesResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &recovery))
+		assert.NotContains(t, recovery.RecoveryCodes, recoveryCodes[1])
+		recoveryCodes = recovery.RecoveryCodes
+		assert.Equal(t, auth.RecoveryCodeCount, status().RecoveryCodesLeft)
+	})
+
+	t.Run("wrong codes lock the user out", func(t *testing.T) {
+		assert.NoError(t, attempts.Reset(ctx, models.UsernameAttemptKey("alice")))
+		rr := login(map[string]string{"username": "alice", "password": "secret"}, authHandler.Login)
+		var challenge MFAChallengeResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+
+		for i := 0; i < auth.DefaultUsernameLockout.Threshold; i++ {
+			rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, Code: "000000"}, authHandler.LoginMFA)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		}
+		rr = login(LoginMFARequest{MFAToken: challenge.MFAToken, Code: codeAt(secret, 0)}, authHandler.LoginMFA)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		rr = serve(handler.DisableMFA, "DELETE", `{"code":"`+codeAt(secret, 0)+`"}`, alice, nil)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.NoError(t, attempts.Reset(ctx, models.UsernameAttemptKey("alice")))
+	})
+
+	t.Run("required roles can not disable it", func(t *testing.T) {
+		handler.RequiredRoles = map[models.Role]bool{models.RoleTechnician: true}
+		defer func() { handler.RequiredRoles = nil }()
+
+		rr := serve(handler.DisableMFA, "DELETE", `{"recovery_code":"`+recoveryCodes[1]+`"}`, alice, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.True(t, status().Required)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		rr := serve(handler.DisableMFA, "DELETE", `{"code":"123"}`, alice, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Equal(t, "Invalid code\n", rr.Body.String())
+
+		rr = serve(handler.DisableMFA, "DELETE", `{"recovery_code":"`+recoveryCodes[0]+`"}`, alice, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, MFAStatus{}, status())
+		loginAs(t, authHandler, users, "alice")
+	})
+
+	t.Run("admins reset a lost second factor", func(t *testing.T) {
+		admin := models.User{Username: "admin", Role: models.RoleAdmin}
+		assert.NoError(t, users.Create(ctx, &admin))
+		id := map[string]string{"id": "1"}
+
+		rr := serve(guarded(models.PermissionUserManage, handler.ResetUserMFA), "DELETE", "", alice, id)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(guarded(models.PermissionUserManage, handler.ResetUserMFA), "DELETE", "", &admin, id)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), "not enabled")
+
+		assert.NoError(t, mfa.StartTOTP(ctx, &models.TOTPEnrollment{UserID: alice.ID, Secret: secret}))
+		assert.NoError(t, mfa.ConfirmTOTP(ctx, alice.ID, 1, nil))
+		rr = serve(guarded(models.PermissionUserManage, handler.ResetUserMFA), "DELETE", "", &admin, id)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		loginAs(t, authHandler, users, "alice")
+
+		rr = serve(guarded(models.PermissionUserManage, handler.ResetUserMFA), "DELETE", "", &admin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("required roles are told to enrol", func(t *testing.T) {
+		authHandler.MFARequiredRoles = map[models.Role]bool{models.RoleTechnician: true}
+		defer func() { authHandler.MFARequiredRoles = nil }()
+
+		response := loginAs(t, authHandler, users, "alice")
+		assert.True(t, response.MFAEnrolmentRequired)
+	})
+}
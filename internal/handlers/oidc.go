@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/metrics"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/oidc"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// oidcStateCookie holds the signed state of a login in progress, see
+// auth.OIDCStateClaims
+const oidcStateCookie = "oidc_state"
+
+// roleOrder ranks the roles from the highest, for users in several mapped groups
+var roleOrder = []models.Role{models.RoleAdmin, models.RoleManager, models.RoleTechnician}
+
+// OIDCHandler logs users in through an OpenID Connect provider. Accounts at
+// the provider are linked to users explicitly by signed in users, or
+// provisioned with a new user on their first login.
+type OIDCHandler struct {
+	client     *oidc.Client
+	identities repository.IdentityRepository
+	users      repository.UserRepository
+	auth       *AuthHandler
+
+	// GroupsClaim is the ID token claim listing the groups of the user
+	GroupsClaim string
+	// RoleMapping gives the users of a group a role. Users in several mapped
+	// groups get the highest role. When set, the role of every user follows
+	// their groups on every login and a change revokes their tokens.
+	RoleMapping map[string]models.Role
+	// DefaultRole is the role of users in no mapped group, empty refuses
+	// their logins
+	DefaultRole models.Role
+	// Provision creates a user on the first login of an account no user is
+	// linked to
+	Provision bool
+	// OrganizationID is the organization provisioned users join, the
+	// default one when 0
+	OrganizationID int64
+}
+
+// NewOIDCHandler creates an OIDCHandler issuing tokens like authHandler
+func NewOIDCHandler(client *oidc.Client, identities repository.IdentityRepository, users repository.UserRepository, authHandler *AuthHandler) *OIDCHandler {
+	return &OIDCHandler{
+		client:      client,
+		identities:  identities,
+		users:       users,
+		auth:        authHandler,
+		GroupsClaim: "groups",
+		DefaultRole: models.RoleTechnician,
+		Provision:   true,
+	}
+}
+
+// Login sends the user to the provider, see Callback for the way back
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, ok := h.start(w, r, 0)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// LinkIdentity starts a login at the provider that links the account to the
+// signed in user rather than logging in with it. The user follows the
+// returned authorization URL from the same browser.
+func (h *OIDCHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	authURL, ok := h.start(w, r, uint(subject.UserID))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": authURL,
+	})
+}
+
+// start creates the state, nonce and PKCE verifier of a login, keeps them in
+// the state cookie and returns the authorization URL
+func (h *OIDCHandler) start(w http.ResponseWriter, r *http.Request, linkUserID uint) (string, bool) {
+	var state, nonce, verifier string
+	var err error
+	for _, value := range []*string{&state, &nonce, &verifier} {
+		if *value, err = oidc.RandomValue(); err != nil {
+			http.Error(w, "Error generating login state", http.StatusInternalServerError)
+			return "", false
+		}
+	}
+
+	authURL, err := h.client.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error discovering the identity provider: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return "", false
+	}
+	token, err := h.auth.keys.IssueOIDCState(state, nonce, verifier, linkUserID)
+	if err != nil {
+		http.Error(w, "Error generating login state", http.StatusInternalServerError)
+		return "", false
+	}
+	h.setStateCookie(w, token, int(auth.OIDCStateTTL.Seconds()))
+	return authURL, true
+}
+
+// setStateCookie sets the state cookie, or clears it when maxAge is negative.
+// Lax lets the cookie follow the redirect back from the provider.
+func (h *OIDCHandler) setStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.client.RedirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Callback completes a login started by Login or LinkIdentity. Logins answer
+// with tokens, or an MFA challenge for users with a second factor the
+// provider did not check; links answer with the linked identity.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cookie, err := r.Cookie(oidcStateCookie)
+	h.setStateCookie(w, "", -1)
+	if query.Get("error") != "" {
+		metrics.RecordAuthAttempt("oidc", false)
+		http.Error(w, "Login refused by the identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	// The state ties the answer of the provider to the browser that started the login
+	var state *auth.OIDCStateClaims
+	if err == nil {
+		state, err = h.auth.keys.ParseOIDCState(cookie.Value)
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	rawIDToken, err := h.client.Exchange(ctx, query.Get("code"), state.Verifier)
+	var token *oidc.IDToken
+	if err == nil {
+		token, err = h.client.Verify(ctx, rawIDToken, state.Nonce)
+	}
+	if err != nil {
+		log.Printf("Error completing an OpenID Connect login: %v", err)
+		metrics.RecordAuthAttempt("oidc", false)
+		http.Error(w, "Could not verify the login", http.StatusUnauthorized)
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		h.link(w, r, state.LinkUserID, token)
+		return
+	}
+	h.login(w, r, token)
+}
+
+// link links the account of the ID token to the user who started the link
+func (h *OIDCHandler) link(w http.ResponseWriter, r *http.Request, userID uint, token *oidc.IDToken) {
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !user.Active {
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	identity := &models.Identity{
+		UserID:         user.ID,
+		Issuer:         token.Issuer,
+		Subject:        token.Subject,
+		OrganizationID: user.OrganizationID,
+	}
+	err = h.identities.Create(ctx, identity)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "The account is already linked to a user", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(identity); err != nil {
+		log.Printf("Error encoding identity: %v", err)
+	}
+}
+
+// login logs in the user linked to the account of the ID token, provisioning
+// one when none is
+func (h *OIDCHandler) login(w http.ResponseWriter, r *http.Request, token *oidc.IDToken) {
+	ctx := r.Context()
+	mappedRole, mapped := h.mappedRole(token)
+
+	var user *models.User
+	identity, err := h.identities.GetBySubject(ctx, token.Issuer, token.Subject)
+	switch {
+	case err == nil:
+		if user, err = h.users.GetByID(ctx, identity.UserID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		if user, ok := h.provision(w, r, token, mappedRole); ok {
+			h.issueTokens(w, r, user, token)
+		}
+		return
+	default:
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active {
+		metrics.RecordAuthAttempt("oidc", false)
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+	// With a role mapping the provider manages the roles, users in no mapped
+	// group fall back to DefaultRole so leaving a group takes its role away
+	if len(h.RoleMapping) > 0 {
+		role := mappedRole
+		if !mapped {
+			role = h.DefaultRole
+		}
+		if role == "" {
+			metrics.RecordAuthAttempt("oidc", false)
+			http.Error(w, "The account is in no group allowed to use the service", http.StatusForbidden)
+			return
+		}
+		if role != user.Role {
+			if err := h.users.UpdateRole(ctx, user.ID, role); err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			// Tokens issued with the old role end with it
+			if err := h.auth.tokens.RevokeUser(ctx, user.ID); err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			user.Role = role
+		}
+	}
+	h.issueTokens(w, r, user, token)
+}
+
+// provision creates a user for the account of the ID token, with the mapped
+// role or else DefaultRole
+func (h *OIDCHandler) provision(w http.ResponseWriter, r *http.Request, token *oidc.IDToken, role models.Role) (*models.User, bool) {
+	if !h.Provision {
+		metrics.RecordAuthAttempt("oidc", false)
+		http.Error(w, "No user is linked to the account", http.StatusForbidden)
+		return nil, false
+	}
+	if role == "" {
+		role = h.DefaultRole
+	}
+	if role == "" {
+		metrics.RecordAuthAttempt("oidc", false)
+		http.Error(w, "The account is in no group allowed to use the service", http.StatusForbidden)
+		return nil, false
+	}
+
+	// Only a verified email is trusted. The user has no password and can only
+	// log in through the provider.
+	user := &models.User{
+		Username:       provisionedUsername(token),
+		Role:           role,
+		OrganizationID: h.OrganizationID,
+	}
+	if token.EmailVerified {
+		user.Email = token.Email
+	}
+	err := h.identities.Provision(r.Context(), &models.Identity{Issuer: token.Issuer, Subject: token.Subject}, user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Username "+user.Username+" is already taken, sign in and link the account instead", http.StatusConflict)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// issueTokens answers a login with tokens, or with an MFA challenge for users
+// with a second factor when the provider did not check one
+func (h *OIDCHandler) issueTokens(w http.ResponseWriter, r *http.Request, user *models.User, token *oidc.IDToken) {
+	ctx := r.Context()
+	mfa := contains(token.AMR, "mfa")
+	if !mfa {
+		enrolled, err := h.auth.mfaEnrolled(ctx, user.ID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if enrolled {
+			h.challenge(ctx, w, user)
+			return
+		}
+	}
+
+	response, err := h.auth.startSession(r, user, "", mfa)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	metrics.RecordAuthAttempt("oidc", true)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// challenge answers with an MFA challenge to complete with LoginMFA
+func (h *OIDCHandler) challenge(ctx context.Context, w http.ResponseWriter, user *models.User) {
+	challenge, err := h.auth.keys.IssueMFAChallenge(user.ID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	metrics.RecordAuthAttempt("oidc", true)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    challenge,
+		ExpiresIn:   int(auth.MFAChallengeTTL.Seconds()),
+	})
+}
+
+// mappedRole returns the highest role mapped to the groups of the user
+func (h *OIDCHandler) mappedRole(token *oidc.IDToken) (models.Role, bool) {
+	mapped := make(map[models.Role]bool)
+	for _, group := range token.Strings(h.GroupsClaim) {
+		if role, ok := h.RoleMapping[group]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range roleOrder {
+		if mapped[role] {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// provisionedUsername picks the username of a provisioned user from the
+// claims of the ID token, the subject when it has no better one
+func provisionedUsername(token *oidc.IDToken) string {
+	if token.PreferredUsername != "" {
+		return token.PreferredUsername
+	}
+	if token.Email != "" && token.EmailVerified {
+		return token.Email
+	}
+	return token.Subject
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/oidc"
+	"github.com/makcim392/maintenance-api/internal/oidc/oidctest"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCHandler(t *testing.T) {
+	ctx := context.Background()
+	provider := oidctest.NewProvider("maintenance-api", "client-secret")
+	defer provider.Close()
+
+	users := repository.NewMemoryUserRepository()
+	identities := repository.NewMemoryIdentityRepository(users)
+	mfa := repository.NewMemoryMFARepository()
+	keys := testKeySet(t)
+	tokens := repository.NewMemoryTokenRepository()
+	authHandler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	authHandler.MFA = mfa
+	client := oidc.NewClient(oidc.Config{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     "maintenance-api",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://api.example.com/oidc/callback",
+	}, nil)
+	handler := NewOIDCHandler(client, identities, users, authHandler)
+	handler.RoleMapping = map[string]models.Role{"maint-admins": models.RoleAdmin, "maint-managers": models.RoleManager}
+	validator := &auth.JWTValidator{Keys: keys}
+
+	// callback follows the authorization URL at the provider and serves the
+	// redirect back with the state cookie
+	callback := func(t *testing.T, authURL string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		back, err := provider.Authorize(authURL)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/oidc/callback?"+back.RawQuery, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		handler.Callback(rr, req)
+		return rr
+	}
+	stateCookie := func(t *testing.T, rr *httptest.ResponseRecorder) *http.Cookie {
+		t.Helper()
+		cookies := rr.Result().Cookies()
+		assert.Len(t, cookies, 1)
+		return cookies[0]
+	}
+	login := func(t *testing.T) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.Login(rr, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+		assert.Equal(t, http.StatusFound, rr.Code)
+		return callback(t, rr.Header().Get("Location"), stateCookie(t, rr))
+	}
+	loggedInAs := func(t *testing.T, rr *httptest.ResponseRecorder) *auth.Claims {
+		t.Helper()
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.RefreshToken)
+		claims, err := validator.ValidateToken(response.Token)
+		assert.NoError(t, err)
+		return claims
+	}
+
+	t.Run("state cookie", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.Login(rr, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+		cookie := stateCookie(t, rr)
+		assert.Equal(t, oidcStateCookie, cookie.Name)
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.Equal(t, int(auth.OIDCStateTTL.Seconds()), cookie.MaxAge)
+
+		state, err := keys.ParseOIDCState(cookie.Value)
+		assert.NoError(t, err)
+		assert.Contains(t, rr.Header().Get("Location"), "state="+state.State)
+		assert.Contains(t, rr.Header().Get("Location"), "code_challenge="+oidc.Challenge(state.Verifier))
+	})
+
+	t.Run("first login provisions a user with the mapped role", func(t *testing.T) {
+		provider.SetUser(map[string]interface{}{"sub": "idp-alice", "preferred_username": "alice",
+			"email": "alice@example.com", "email_verified": true, "groups": []string{"staff", "maint-managers"}})
+		claims := loggedInAs(t, login(t))
+		assert.False(t, claims.MFA)
+		assert.Equal(t, string(models.RoleManager), claims.Role)
+
+		user, err := users.GetByID(ctx, claims.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, "alice@example.com", user.Email)
+		assert.Equal(t, models.DefaultOrganizationID, user.OrganizationID)
+
+		// The next login finds the user, with the role following the groups
+		provider.SetUser(map[string]interface{}{"sub": "idp-alice", "preferred_username": "renamed",
+			"groups": []string{"maint-managers", "maint-admins"}, "amr": []string{"pwd", "mfa"}})
+		claims = loggedInAs(t, login(t))
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, string(models.RoleAdmin), claims.Role)
+		assert.True(t, claims.MFA)
+		user, _ = users.GetByID(ctx, claims.UserID)
+		assert.Equal(t, models.RoleAdmin, user.Role)
+
+		// Provisioned users have no password to log in with
+		stored, _ := users.GetByUsername(ctx, "alice")
+		assert.Empty(t, stored.Password)
+	})
+
+	t.Run("users in no mapped group", func(t *testing.T) {
+		provider.SetUser(map[string]interface{}{"sub": "idp-dave", "email": "dave@example.com", "email_verified": false})
+		claims := loggedInAs(t, login(t))
+		assert.Equal(t, string(models.RoleTechnician), claims.Role)
+
+		// An unverified email neither names nor reaches the user
+		user, _ := users.GetByID(ctx, claims.UserID)
+		assert.Equal(t, "idp-dave", user.Username)
+		assert.Empty(t, user.Email)
+
+		// The provider manages their role too, a role given in the API does not last
+		assert.NoError(t, users.UpdateRole(ctx, user.ID, models.RoleManager))
+		claims = loggedInAs(t, login(t))
+		assert.Equal(t, string(models.RoleTechnician), claims.Role)
+
+		handler.DefaultRole = ""
+		defer func() { handler.DefaultRole = models.RoleTechnician }()
+		provider.SetUser(map[string]interface{}{"sub": "idp-erin"})
+		rr := login(t)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		_, err := users.GetByUsername(ctx, "idp-erin")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("leaving a group takes its role and tokens away", func(t *testing.T) {
+		current := &auth.JWTValidator{Keys: keys, Revocations: tokens, Sessions: tokens}
+		provider.SetUser(map[string]interface{}{"sub": "idp-hank", "groups": []string{"maint-admins"}})
+		rr := login(t)
+		assert.Equal(t, string(models.RoleAdmin), loggedInAs(t, rr).Role)
+		var admin TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &admin))
+
+		// Downgraded to manager, the admin tokens stop working
+		provider.SetUser(map[string]interface{}{"sub": "idp-hank", "groups": []string{"maint-managers"}})
+		rr = login(t)
+		assert.Equal(t, string(models.RoleManager), loggedInAs(t, rr).Role)
+		assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, admin.RefreshToken).Code)
+		_, err := current.ValidateToken(admin.Token)
+		assert.Error(t, err)
+		var manager TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &manager))
+		_, err = current.ValidateToken(manager.Token)
+		assert.NoError(t, err)
+
+		// Removed from every mapped group, back to the default role
+		provider.SetUser(map[string]interface{}{"sub": "idp-hank", "groups": []string{"staff"}})
+		assert.Equal(t, string(models.RoleTechnician), loggedInAs(t, login(t)).Role)
+		assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, manager.RefreshToken).Code)
+
+		// Or refused without one
+		handler.DefaultRole = ""
+		defer func() { handler.DefaultRole = models.RoleTechnician }()
+		assert.Equal(t, http.StatusForbidden, login(t).Code)
+	})
+
+	t.Run("provisioning", func(t *testing.T) {
+		// A taken username is not taken over
+		provider.SetUser(map[string]interface{}{"sub": "idp-other-alice", "preferred_username": "alice"})
+		rr := login(t)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "link the account")
+
+		handler.Provision = false
+		defer func() { handler.Provision = true }()
+		provider.SetUser(map[string]interface{}{"sub": "idp-frank"})
+		rr = login(t)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "No user is linked")
+	})
+
+	t.Run("link an account to a signed in user", func(t *testing.T) {
+		loginAs(t, authHandler, users, "bob")
+		bob, _ := users.GetByUsername(ctx, "bob")
+		link := func(t *testing.T) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/me/identities/oidc", nil)
+			reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(bob.ID))
+			reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(bob.Role))
+			rr := httptest.NewRecorder()
+			handler.LinkIdentity(rr, req.WithContext(reqCtx))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			return callback(t, response["authorization_url"], stateCookie(t, rr))
+		}
+
+		provider.SetUser(map[string]interface{}{"sub": "idp-bob", "preferred_username": "robert"})
+		rr := link(t)
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var identity models.Identity
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &identity))
+		assert.Equal(t, bob.ID, identity.UserID)
+		assert.Equal(t, provider.Issuer(), identity.Issuer)
+		assert.Equal(t, "idp-bob", identity.Subject)
+
+		claims := loggedInAs(t, login(t))
+		assert.Equal(t, bob.ID, claims.UserID)
+
+		// An account is linked to one user
+		rr = link(t)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("users with a second factor are challenged", func(t *testing.T) {
+		carol := &models.User{Username: "carol", Role: models.RoleTechnician}
+		assert.NoError(t, users.Create(ctx, carol))
+		assert.NoError(t, identities.Create(ctx, &models.Identity{UserID: carol.ID, Issuer: provider.Issuer(), Subject: "idp-carol"}))
+		assert.NoError(t, mfa.StartTOTP(ctx, &models.TOTPEnrollment{UserID: carol.ID, Secret: "JBSWY3DPEHPK3PXP"}))
+		assert.NoError(t, mfa.ConfirmTOTP(ctx, carol.ID, 1, nil))
+
+		provider.SetUser(map[string]interface{}{"sub": "idp-carol"})
+		rr := login(t)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var challenge MFAChallengeResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+		assert.True(t, challenge.MFARequired)
+		parsed, err := keys.ParseMFAChallenge(challenge.MFAToken)
+		assert.NoError(t, err)
+		assert.Equal(t, carol.ID, parsed.UserID)
+
+		// Unless the provider checked one
+		provider.SetUser(map[string]interface{}{"sub": "idp-carol", "amr": []string{"otp", "mfa"}})
+		claims := loggedInAs(t, login(t))
+		assert.True(t, claims.MFA)
+	})
+
+	t.Run("deactivated user", func(t *testing.T) {
+		provider.SetUser(map[string]interface{}{"sub": "idp-gina"})
+		claims := loggedInAs(t, login(t))
+		assert.NoError(t, users.SetActive(ctx, claims.UserID, false))
+		rr := login(t)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("failed logins", func(t *testing.T) {
+		provider.SetUser(map[string]interface{}{"sub": "idp-alice"})
+		rr := httptest.NewRecorder()
+		handler.Login(rr, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+		authURL, cookie := rr.Header().Get("Location"), stateCookie(t, rr)
+
+		// Without the cookie of the browser that started the login
+		rr = callback(t, authURL, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// With the cookie of another login
+		other := httptest.NewRecorder()
+		handler.Login(other, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+		rr = callback(t, authURL, stateCookie(t, other))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		// The callback clears the cookie
+		rr = callback(t, authURL, cookie)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		cleared := stateCookie(t, rr)
+		assert.Empty(t, cleared.Value)
+		assert.Negative(t, cleared.MaxAge)
+
+		// A code the provider never issued
+		req := httptest.NewRequest(http.MethodGet, "/oidc/callback?code=reused&state=x", nil)
+		state, _ := keys.IssueOIDCState("x", "nonce", "verifier", 0)
+		req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+		rr = httptest.NewRecorder()
+		handler.Callback(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		provider.SetUser(nil)
+		rr = login(t)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "refused")
+	})
+
+	t.Run("provider unavailable", func(t *testing.T) {
+		down := NewOIDCHandler(oidc.NewClient(oidc.Config{IssuerURL: "http://127.0.0.1:1", ClientID: "maintenance-api"}, nil),
+			identities, users, authHandler)
+		rr := httptest.NewRecorder()
+		down.Login(rr, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+	})
+}
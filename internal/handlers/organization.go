@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// OrganizationHandler serves the organization of the authenticated user.
+// Organizations themselves are created on the command line.
+type OrganizationHandler struct {
+	organizations repository.OrganizationRepository
+}
+
+func NewOrganizationHandler(organizations repository.OrganizationRepository) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizations: organizations,
+	}
+}
+
+// GetOrganization returns the organization of the user with its settings
+func (h *OrganizationHandler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organization(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(organization); err != nil {
+		log.Printf("Error encoding organization: %v", err)
+	}
+}
+
+// UpdateOrganizationSettings replaces the settings of the organization of the user
+func (h *OrganizationHandler) UpdateOrganizationSettings(w http.ResponseWriter, r *http.Request) {
+	organization, ok := h.organization(w, r)
+	if !ok {
+		return
+	}
+
+	var settings models.OrganizationSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.organizations.UpdateSettings(r.Context(), organization.ID, settings)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Organization settings updated successfully",
+		"id":      strconv.FormatInt(organization.ID, 10),
+	})
+}
+
+// organization loads the organization the request is scoped to
+func (h *OrganizationHandler) organization(w http.ResponseWriter, r *http.Request) (*models.Organization, bool) {
+	orgID, ok := tenant.Organization(r.Context())
+	if !ok {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	organization, err := h.organizations.Get(r.Context(), orgID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return organization, true
+}
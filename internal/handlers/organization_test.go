@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationHandler(t *testing.T) {
+	ctx := context.Background()
+	organizations := repository.NewMemoryOrganizationRepository()
+	globex := models.Organization{Slug: "globex", Name: "Globex"}
+	assert.NoError(t, organizations.Create(ctx, &globex))
+	handler := NewOrganizationHandler(organizations)
+
+	serve := func(handle http.HandlerFunc, method, body string, orgID int64, role models.Role) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/organization", bytes.NewBufferString(body))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(role))
+		req = req.WithContext(tenant.WithOrganization(reqCtx, orgID))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	t.Run("get the own organization", func(t *testing.T) {
+		rr := serve(handler.GetOrganization, "GET", "", globex.ID, models.RoleTechnician)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var organization models.Organization
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &organization))
+		assert.Equal(t, "globex", organization.Slug)
+		assert.False(t, organization.Settings.OpenRegistration)
+	})
+
+	t.Run("only admins change the settings", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionOrgManage, handler.UpdateOrganizationSettings), "PUT",
+			`{"open_registration":true}`, globex.ID, models.RoleManager)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("update settings", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionOrgManage, handler.UpdateOrganizationSettings), "PUT",
+			`{"open_registration":true,"default_timezone":"Europe/Madrid"}`, globex.ID, models.RoleAdmin)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		stored, _ := organizations.Get(ctx, globex.ID)
+		assert.Equal(t, models.OrganizationSettings{OpenRegistration: true, DefaultTimezone: "Europe/Madrid"}, stored.Settings)
+		// The default organization is left alone
+		other, _ := organizations.Get(ctx, models.DefaultOrganizationID)
+		assert.Empty(t, other.Settings.DefaultTimezone)
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		rr := serve(handler.UpdateOrganizationSettings, "PUT", `{"default_timezone":"Mars/Olympus"}`, globex.ID, models.RoleAdmin)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "default_timezone")
+		assert.Equal(t, http.StatusBadRequest, serve(handler.UpdateOrganizationSettings, "PUT", `{`, globex.ID, models.RoleAdmin).Code)
+	})
+
+	t.Run("unknown organization", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetOrganization, "GET", "", 99, models.RoleAdmin).Code)
+	})
+}
+
+func TestRegisterIntoOrganization(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	organizations := repository.NewMemoryOrganizationRepository()
+	closed := models.Organization{Slug: "closed", Name: "Closed"}
+	open := models.Organization{Slug: "open", Name: "Open", Settings: models.OrganizationSettings{OpenRegistration: true}}
+	assert.NoError(t, organizations.Create(ctx, &closed))
+	assert.NoError(t, organizations.Create(ctx, &open))
+
+	keys := testKeySet(t)
+	handler := NewAuthHandler(users, repository.NewMemoryTokenRepository(),
+		repository.NewMemoryInvitationRepository(users), keys)
+	handler.OpenRegistration = true
+	handler.Organizations = organizations
+
+	register := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Register(rr, httptest.NewRequest("POST", "/register", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	rr := register(`{"username":"tech1","password":"brass lantern 42","organization":"open"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	user, err := users.GetByUsername(ctx, "tech1")
+	assert.NoError(t, err)
+	assert.Equal(t, open.ID, user.OrganizationID)
+
+	rr = register(`{"username":"tech2","password":"brass lantern 42"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	user, _ = users.GetByUsername(ctx, "tech2")
+	assert.Equal(t, models.DefaultOrganizationID, user.OrganizationID)
+
+	rr = register(`{"username":"tech3","password":"brass lantern 42","organization":"closed"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Registration requires an invitation")
+
+	rr = register(`{"username":"tech3","password":"brass lantern 42","organization":"nowhere"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Unknown organization")
+
+	// The token names the organization of the user
+	rr = httptest.NewRecorder()
+	handler.Login(rr, httptest.NewRequest("POST", "/login", bytes.NewBufferString(`{"username":"tech1","password":"brass lantern 42"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response TokenResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	claims, err := (&auth.JWTValidator{Keys: keys}).ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, open.ID, claims.OrgID)
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/mail"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHandler lets users change their password and reset a forgotten one
+// with a token mailed to them
+type PasswordHandler struct {
+	users  repository.UserRepository
+	tokens repository.TokenRepository
+	resets repository.PasswordResetRepository
+	mailer mail.Sender
+
+	// Policy decides which new passwords are accepted
+	Policy auth.PasswordPolicy
+	// ResetTTL is how long a reset token can be used
+	ResetTTL time.Duration
+	// ResetURL, when set, is the page of the frontend that resets a password.
+	// Reset mails then link to it with the token, else they carry the token.
+	ResetURL string
+	// ResetCooldown is how long after mailing a reset token no other one is
+	// mailed to the user
+	ResetCooldown time.Duration
+	// Attempts, when set, counts wrong current passwords against the login
+	// lockout of the user, limits reset requests per username and has the
+	// login lockout lifted by a reset
+	Attempts repository.LoginAttemptRepository
+	// Lockout decides how long password changes are refused after wrong
+	// current passwords
+	Lockout auth.LockoutPolicy
+	// ResetLockout decides how many reset requests a username gets
+	ResetLockout auth.LockoutPolicy
+
+	// sends holds a slot for every reset mail ForgotPassword is sending
+	sends chan struct{}
+	// pending counts the reset mails ForgotPassword is still sending
+	pending sync.WaitGroup
+}
+
+// maxPendingResets is how many reset mails are sent at once, requests past
+// it are dropped
+const maxPendingResets = 32
+
+func NewPasswordHandler(users repository.UserRepository, tokens repository.TokenRepository, resets repository.PasswordResetRepository, mailer mail.Sender) *PasswordHandler {
+	return &PasswordHandler{
+		users:    users,
+		tokens:   tokens,
+		resets:   resets,
+		mailer:   mailer,
+		Policy:        auth.DefaultPasswordPolicy,
+		ResetTTL:      auth.PasswordResetTTL,
+		ResetCooldown: auth.PasswordResetCooldown,
+		Lockout:       auth.DefaultUsernameLockout,
+		ResetLockout:  auth.DefaultResetLockout,
+		sends:         make(chan struct{}, maxPendingResets),
+	}
+}
+
+// ChangePasswordRequest is the body of ChangePassword
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ForgotPasswordRequest is the body of ForgotPassword
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest is the body of ResetPassword
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePassword replaces the password of the user after checking the
+// current one, and signs them out everywhere
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// GetByID leaves the password out, GetByUsername has it
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, uint(subject.UserID))
+	if err == nil {
+		var credentials *models.User
+		if credentials, err = h.users.GetByUsername(ctx, user.Username); err == nil {
+			user.Password = credentials.Password
+		}
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The attempt counts as a failed login of the user until the current
+	// password is found right, like in Login
+	key := models.UsernameAttemptKey(user.Username)
+	reserved := false
+	if h.Attempts != nil {
+		until, err := h.Attempts.Reserve(ctx, key, time.Now(), h.Lockout)
+		if err != nil {
+			log.Printf("Error counting password change of user %d: %v", user.ID, err)
+		} else if !until.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+			http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		reserved = err == nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if reserved {
+		if err := h.Attempts.Release(ctx, key); err != nil {
+			log.Printf("Error releasing the password change attempt of user %d: %v", user.ID, err)
+		}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.NewPassword)) == nil {
+		http.Error(w, "New password must differ from the current one", http.StatusBadRequest)
+		return
+	}
+	if !h.setPassword(w, r, user, req.NewPassword) {
+		return
+	}
+
+	h.send(ctx, user, "Your password was changed",
+		fmt.Sprintf("Hello %s,\n\nThe password of your account was just changed and every session was signed out.\n\n"+
+			"If it was not you, reset your password right away and tell your administrator.\n", user.Username))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed successfully, log in again with the new one",
+	})
+}
+
+// ForgotPassword mails a reset token to the user. The token is created and
+// mailed in the background after the answer, so neither the answer nor the
+// time it takes tell whether the user exists and has an email address.
+// Requests past the reset lockout of the username, or while maxPendingResets
+// mails are being sent, are dropped with the same answer.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	if h.resetAllowed(r.Context(), req.Username) {
+		select {
+		case h.sends <- struct{}{}:
+			ctx := context.WithoutCancel(r.Context())
+			h.pending.Add(1)
+			go func() {
+				defer func() {
+					<-h.sends
+					h.pending.Done()
+				}()
+				if err := h.mailResetToken(ctx, req.Username); err != nil {
+					log.Printf("Error sending a password reset token: %v", err)
+				}
+			}()
+		default:
+			log.Printf("Dropping a password reset request, %d are being sent already", maxPendingResets)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists and has an email address, a reset link was sent to it",
+	})
+}
+
+// resetAllowed counts a reset request for the username, whether or not a
+// user has it, and reports whether it is within the reset lockout
+func (h *PasswordHandler) resetAllowed(ctx context.Context, username string) bool {
+	if h.Attempts == nil {
+		return true
+	}
+	until, err := h.Attempts.Reserve(ctx, models.PasswordResetAttemptKey(username), time.Now(), h.ResetLockout)
+	if err != nil {
+		log.Printf("Error counting a password reset request: %v", err)
+		return false
+	}
+	return until.IsZero()
+}
+
+// Wait blocks until the reset mails queued by ForgotPassword were sent
+func (h *PasswordHandler) Wait() {
+	h.pending.Wait()
+}
+
+// mailResetToken creates a reset token for the user and mails it, doing
+// nothing for unknown, deactivated and email-less users, for users who only
+// log in through OpenID Connect and have no password to reset, and for users
+// mailed a token within the cooldown
+func (h *PasswordHandler) mailResetToken(ctx context.Context, username string) error {
+	found, err := h.users.GetByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && found.Password == "") {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// GetByUsername leaves the email out, GetByID has it
+	user, err := h.users.GetByID(ctx, found.ID)
+	if err != nil {
+		return err
+	}
+	if !user.Active || user.Email == "" {
+		return nil
+	}
+	if h.ResetCooldown > 0 {
+		recent, err := h.resets.CountActiveSince(ctx, user.ID, time.Now().Add(-h.ResetCooldown))
+		if err != nil {
+			return err
+		}
+		if recent > 0 {
+			return nil
+		}
+	}
+
+	token, hash, err := auth.NewPasswordResetToken()
+	if err != nil {
+		return err
+	}
+	err = h.resets.Create(ctx, &models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.ResetTTL).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := "Reset token: " + token
+	if h.ResetURL != "" {
+		if reset, err := url.Parse(h.ResetURL); err == nil {
+			query := reset.Query()
+			query.Set("token", token)
+			reset.RawQuery = query.Encode()
+			link = reset.String()
+		}
+	}
+	h.send(ctx, user, "Reset your password",
+		fmt.Sprintf("Hello %s,\n\nSomeone asked to reset the password of your account. Within %d minutes, "+
+			"choose a new one with:\n\n%s\n\nIf it was not you, ignore this message, your password stays unchanged.\n",
+			user.Username, int(h.ResetTTL.Minutes()), link))
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token, which can be used
+// once, and signs the user out everywhere
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	reset, err := h.resets.Get(ctx, auth.HashPasswordResetToken(req.Token))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.users.GetByID(ctx, reset.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !user.Active {
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	// A weak password is refused before the token is spent, so the user can
+	// try another one
+	if err := h.Policy.Check(req.Password, user.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.resets.Use(ctx, reset); errors.Is(err, repository.ErrConflict) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !h.setPassword(w, r, user, req.Password) {
+		return
+	}
+
+	// Whoever locked the account out no longer knows the password
+	if h.Attempts != nil {
+		if err := h.Attempts.Reset(ctx, models.UsernameAttemptKey(user.Username)); err != nil {
+			log.Printf("Error resetting failed logins of user %d: %v", user.ID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password reset successfully",
+	})
+}
+
+// setPassword checks the password against the policy, stores its hash and
+// revokes every token of the user, writing the error response on failure
+func (h *PasswordHandler) setPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	if err := h.Policy.Check(password, user.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Error processing request", http.StatusInternalServerError)
+		return false
+	}
+
+	ctx := r.Context()
+	if err := h.users.UpdatePassword(ctx, user.ID, string(hash)); errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+
+	// Sessions opened with the old password end with it, the change is not
+	// reported as done while they may still be open
+	if err := h.tokens.RevokeUser(ctx, user.ID); err != nil {
+		log.Printf("Error revoking tokens of user %d: %v", user.ID, err)
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// send mails the user when they have an email address, failures are only logged
+func (h *PasswordHandler) send(ctx context.Context, user *models.User, subject, body string) {
+	if h.mailer == nil || user.Email == "" {
+		return
+	}
+	if err := h.mailer.Send(ctx, mail.Message{To: []string{user.Email}, Subject: subject, Body: body}); err != nil {
+		log.Printf("Error mailing user %d: %v", user.ID, err)
+	}
+}
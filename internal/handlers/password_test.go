@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/mail"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	resets := repository.NewMemoryPasswordResetRepository()
+	attempts := repository.NewMemoryLoginAttemptRepository()
+	mailer := &mail.MemorySender{}
+	authHandler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), testKeySet(t))
+	authHandler.Attempts = attempts
+	handler := NewPasswordHandler(users, tokens, resets, mailer)
+	handler.ResetURL = "https://app.example.com/reset?lang=en"
+	handler.Attempts = attempts
+	// Subtests ask for several tokens in a row, the cooldown has its own
+	handler.ResetCooldown = 0
+
+	hashedPass, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Password: string(hashedPass), Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, alice))
+	bob := &models.User{Username: "bob", Password: string(hashedPass), Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, bob))
+	// Carol logs in through OpenID Connect only
+	carol := &models.User{Username: "carol", Email: "carol@example.com", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, carol))
+
+	serve := func(handle http.HandlerFunc, body string, user *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		if user != nil {
+			ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(user.ID))
+			req = req.WithContext(context.WithValue(ctx, middleware.RoleContextKey, string(user.Role)))
+		}
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		// Let the reset mails queued by the request go out
+		handler.Wait()
+		return rr
+	}
+	login := func(username, password string) int {
+		body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+		return serve(authHandler.Login, string(body), nil).Code
+	}
+	resetToken := func() string {
+		messages := mailer.Messages()
+		link := regexp.MustCompile(`https://\S+`).FindString(messages[len(messages)-1].Body)
+		parsed, err := url.Parse(link)
+		assert.NoError(t, err)
+		assert.Equal(t, "en", parsed.Query().Get("lang"))
+		return parsed.Query().Get("token")
+	}
+
+	t.Run("change password", func(t *testing.T) {
+		session := loginAs(t, authHandler, users, "alice")
+
+		rr := serve(handler.ChangePassword, `{"current_password":"wrong","new_password":"brass lantern 42"}`, alice)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.ChangePassword, `{"current_password":"secret","new_password":"password123"}`, alice)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "breached")
+
+		rr = serve(handler.ChangePassword, `{"current_password":"secret","new_password":"brass lantern 42"}`, alice)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, login("alice", "brass lantern 42"))
+		assert.Equal(t, http.StatusUnauthorized, login("alice", "secret"))
+
+		// Every session opened with the old password is signed out
+		assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, session.RefreshToken).Code)
+
+		messages := mailer.Messages()
+		assert.Len(t, messages, 1)
+		assert.Equal(t, []string{"alice@example.com"}, messages[0].To)
+		assert.Equal(t, "Your password was changed", messages[0].Subject)
+
+		rr = serve(handler.ChangePassword, `{"current_password":"brass lantern 42","new_password":"brass lantern 42"}`, alice)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("forgot password answers the same for everyone", func(t *testing.T) {
+		sent := len(mailer.Messages())
+		for _, username := range []string{"nobody", "bob", "carol"} {
+			rr := serve(handler.ForgotPassword, `{"username":"`+username+`"}`, nil)
+			assert.Equal(t, http.StatusAccepted, rr.Code)
+			assert.Contains(t, rr.Body.String(), "If the account exists")
+		}
+		// Bob has no email address to send the token to, Carol no password
+		assert.Len(t, mailer.Messages(), sent)
+
+		rr := serve(handler.ForgotPassword, `{}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("reset password", func(t *testing.T) {
+		session := loginAs(t, authHandler, users, "bob")
+		for i := 0; i < 10; i++ {
+			login("alice", "wrong")
+		}
+		assert.Equal(t, http.StatusTooManyRequests, login("alice", "brass lantern 42"))
+
+		rr := serve(handler.ForgotPassword, `{"username":"alice"}`, nil)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		messages := mailer.Messages()
+		assert.Equal(t, "Reset your password", messages[len(messages)-1].Subject)
+		assert.Contains(t, messages[len(messages)-1].Body, "60 minutes")
+		token := resetToken()
+		assert.NotEmpty(t, token)
+
+		// A weak password leaves the token usable
+		rr = serve(handler.ResetPassword, `{"token":"`+token+`","password":"alice2024!!"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "username")
+
+		rr = serve(handler.ResetPassword, `{"token":"`+token+`","password":"copper kettle 7"}`, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		// The reset lifts the lockout
+		assert.Equal(t, http.StatusOK, login("alice", "copper kettle 7"))
+
+		rr = serve(handler.ResetPassword, `{"token":"`+token+`","password":"silver teapot 9"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Invalid or expired reset token")
+
+		// Other users are not affected
+		assert.Equal(t, http.StatusOK, refresh(authHandler, session.RefreshToken).Code)
+	})
+
+	t.Run("a reset uses up the other tokens of the user", func(t *testing.T) {
+		serve(handler.ForgotPassword, `{"username":"alice"}`, nil)
+		first := resetToken()
+		serve(handler.ForgotPassword, `{"username":"alice"}`, nil)
+		second := resetToken()
+
+		rr := serve(handler.ResetPassword, `{"token":"`+second+`","password":"silver teapot 9"}`, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(handler.ResetPassword, `{"token":"`+first+`","password":"golden ladle 3"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("reset mails are limited per username", func(t *testing.T) {
+		limited := NewPasswordHandler(users, tokens, resets, mailer)
+		limited.Attempts = repository.NewMemoryLoginAttemptRepository()
+		limited.ResetLockout = auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+		forgot := func() {
+			rr := httptest.NewRecorder()
+			limited.ForgotPassword(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"username":"alice"}`)))
+			assert.Equal(t, http.StatusAccepted, rr.Code)
+			limited.Wait()
+		}
+		sent := len(mailer.Messages())
+
+		// The token mailed a moment ago is still valid, no other one is sent
+		forgot()
+		forgot()
+		assert.Len(t, mailer.Messages(), sent+1)
+
+		limited.ResetCooldown = 0
+		forgot()
+		assert.Len(t, mailer.Messages(), sent+2)
+		// Past the lockout requests are dropped, and logins are not affected
+		forgot()
+		assert.Len(t, mailer.Messages(), sent+2)
+		assert.Equal(t, http.StatusOK, login("alice", "silver teapot 9"))
+	})
+
+	t.Run("reset mails are dropped while the queue is full", func(t *testing.T) {
+		full := NewPasswordHandler(users, tokens, resets, mailer)
+		for i := 0; i < maxPendingResets; i++ {
+			full.sends <- struct{}{}
+		}
+		sent := len(mailer.Messages())
+
+		rr := httptest.NewRecorder()
+		full.ForgotPassword(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"username":"alice"}`)))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		full.Wait()
+		assert.Len(t, mailer.Messages(), sent)
+	})
+
+	t.Run("expired and unknown tokens", func(t *testing.T) {
+		token, hash, err := auth.NewPasswordResetToken()
+		assert.NoError(t, err)
+		assert.NoError(t, resets.Create(ctx, &models.PasswordReset{
+			UserID: alice.ID, TokenHash: hash, ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		for _, token := range []string{token, "unknown"} {
+			rr := serve(handler.ResetPassword, `{"token":"`+token+`","password":"golden ladle 3"}`, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), "Invalid or expired reset token")
+		}
+	})
+
+	t.Run("forgot password answers before the mail is sent", func(t *testing.T) {
+		sender := blockingSender{release: make(chan struct{})}
+		slow := NewPasswordHandler(users, tokens, resets, sender)
+
+		rr := httptest.NewRecorder()
+		slow.ForgotPassword(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"username":"alice"}`)))
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		close(sender.release)
+		slow.Wait()
+	})
+
+	t.Run("wrong current passwords lock the change out", func(t *testing.T) {
+		locked := NewPasswordHandler(users, tokens, resets, mailer)
+		locked.Attempts = repository.NewMemoryLoginAttemptRepository()
+		locked.Lockout = auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+		for i := 0; i < 2; i++ {
+			rr := serve(locked.ChangePassword, `{"current_password":"wrong","new_password":"golden ladle 3"}`, bob)
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+		}
+		// The right current password is not counted as a failure
+		rr := serve(locked.ChangePassword, `{"current_password":"secret","new_password":"secret"}`, bob)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = serve(locked.ChangePassword, `{"current_password":"wrong","new_password":"golden ladle 3"}`, bob)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(locked.ChangePassword, `{"current_password":"secret","new_password":"golden ladle 3"}`, bob)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusOK, login("bob", "secret"))
+	})
+
+	t.Run("sessions that can not be revoked fail the change", func(t *testing.T) {
+		failing := NewPasswordHandler(users, failingRevocations{tokens}, resets, mailer)
+
+		rr := serve(failing.ChangePassword, `{"current_password":"secret","new_password":"golden ladle 3"}`, bob)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Error revoking sessions")
+	})
+
+	t.Run("deactivated user", func(t *testing.T) {
+		serve(handler.ForgotPassword, `{"username":"alice"}`, nil)
+		token := resetToken()
+		assert.NoError(t, users.SetActive(ctx, alice.ID, false))
+		sent := len(mailer.Messages())
+
+		rr := serve(handler.ResetPassword, `{"token":"`+token+`","password":"golden ladle 3"}`, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		serve(handler.ForgotPassword, `{"username":"alice"}`, nil)
+		assert.Len(t, mailer.Messages(), sent)
+	})
+}
+
+// blockingSender holds every mail until release is closed
+type blockingSender struct {
+	release chan struct{}
+}
+
+func (s blockingSender) Send(ctx context.Context, message mail.Message) error {
+	<-s.release
+	return nil
+}
+
+// failingRevocations is a TokenRepository that can not revoke tokens
+type failingRevocations struct {
+	repository.TokenRepository
+}
+
+func (failingRevocations) RevokeUser(ctx context.Context, userID uint) error {
+	return errors.New("database is down")
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/schedule"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// Preview sizes for GET /schedules/{id}/preview
+const (
+	defaultPreviewCount = 10
+	maxPreviewCount     = 100
+	maxRuleLength       = 255
+)
+
+// ScheduleHandler lets managers define recurring maintenance schedules
+type ScheduleHandler struct {
+	schedules repository.ScheduleRepository
+	users     repository.UserRepository
+	assets    repository.AssetRepository
+
+	// Organizations, when set, supplies the default timezone of the
+	// organization for schedules created without one. UTC is used otherwise.
+	Organizations repository.OrganizationRepository
+}
+
+func NewScheduleHandler(schedules repository.ScheduleRepository, users repository.UserRepository, assets repository.AssetRepository) *ScheduleHandler {
+	return &ScheduleHandler{
+		schedules: schedules,
+		users:     users,
+		assets:    assets,
+	}
+}
+
+// scheduleRequest is the body of POST /schedules and PUT /schedules/{id}
+type scheduleRequest struct {
+	Summary      string     `json:"summary"`
+	Rule         string     `json:"rule"`
+	Timezone     string     `json:"timezone"`
+	TechnicianID int64      `json:"technician_id"`
+	AssetID      *int64     `json:"asset_id"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	Active       *bool      `json:"active"`
+}
+
+// errInvalidSchedule marks validation failures of a schedule request
+type errInvalidSchedule struct {
+	message string
+}
+
+func (e errInvalidSchedule) Error() string {
+	return e.message
+}
+
+// CreateSchedule defines a new recurring schedule, managers only
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
+	if !ok {
+		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
+		return
+	}
+
+	s, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	s.CreatedBy = int64(userID)
+
+	if err := h.schedules.Create(r.Context(), s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Printf("Error encoding schedule: %v", err)
+	}
+}
+
+// ListSchedules returns every schedule, managers only
+func (h *ScheduleHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.schedules.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(schedules); err != nil {
+		log.Printf("Error encoding schedules: %v", err)
+	}
+}
+
+// GetSchedule returns a single schedule, managers only
+func (h *ScheduleHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Printf("Error encoding schedule: %v", err)
+	}
+}
+
+// UpdateSchedule replaces the definition of a schedule, managers only. Tasks
+// already created for it are kept.
+func (h *ScheduleHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleIDParam(w, r)
+	if !ok {
+		return
+	}
+	s, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	s.ID = id
+	err := h.schedules.Update(r.Context(), s)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Schedule updated successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
+
+// DeleteSchedule removes a schedule, managers only. Tasks already created for it are kept.
+func (h *ScheduleHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.schedules.Delete(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Schedule deleted successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
+
+// PreviewSchedule returns the next occurrences of a schedule from now on, managers only
+func (h *ScheduleHandler) PreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	count := defaultPreviewCount
+	if value := r.URL.Query().Get("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPreviewCount {
+			http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxPreviewCount), http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+
+	s, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		http.Error(w, "Invalid stored timezone", http.StatusInternalServerError)
+		return
+	}
+	rule, err := schedule.ParseRule(s.Rule, s.StartsAt, loc)
+	if err != nil {
+		http.Error(w, "Invalid stored rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]time.Time{
+		"occurrences": schedule.Occurrences(rule, time.Now(), s.EndsAt, count),
+	})
+}
+
+// decodeSchedule reads and validates a schedule request, answering 400 when it is invalid
+func (h *ScheduleHandler) decodeSchedule(w http.ResponseWriter, r *http.Request) (*models.Schedule, bool) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	s, err := h.validateSchedule(r.Context(), req)
+	var invalid errInvalidSchedule
+	if errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return s, true
+}
+
+func (h *ScheduleHandler) validateSchedule(ctx context.Context, req scheduleRequest) (*models.Schedule, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	s := models.Schedule{
+		Summary:      strings.TrimSpace(req.Summary),
+		Rule:         strings.TrimSpace(req.Rule),
+		Timezone:     req.Timezone,
+		TechnicianID: req.TechnicianID,
+		AssetID:      req.AssetID,
+		StartsAt:     now,
+		Active:       req.Active == nil || *req.Active,
+	}
+	if s.Timezone == "" {
+		timezone, err := h.defaultTimezone(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.Timezone = timezone
+	}
+	if req.StartsAt != nil {
+		s.StartsAt = req.StartsAt.UTC().Truncate(time.Second)
+	}
+	if req.EndsAt != nil {
+		endsAt := req.EndsAt.UTC().Truncate(time.Second)
+		s.EndsAt = &endsAt
+	}
+
+	if s.Summary == "" || len(s.Summary) > 2500 {
+		return nil, errInvalidSchedule{"Summary is required and must not exceed 2500 characters"}
+	}
+	if s.EndsAt != nil && !s.EndsAt.After(s.StartsAt) {
+		return nil, errInvalidSchedule{"ends_at must be after starts_at"}
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, errInvalidSchedule{"Invalid timezone"}
+	}
+	if len(s.Rule) > maxRuleLength {
+		return nil, errInvalidSchedule{fmt.Sprintf("Rule must not exceed %d characters", maxRuleLength)}
+	}
+	if _, err := schedule.ParseRule(s.Rule, s.StartsAt, loc); err != nil {
+		return nil, errInvalidSchedule{"Invalid rule: " + err.Error()}
+	}
+
+	technician, err := h.users.GetByID(ctx, uint(s.TechnicianID))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && technician.Role != models.RoleTechnician) {
+		return nil, errInvalidSchedule{"technician_id must reference a technician"}
+	} else if err != nil {
+		return nil, err
+	}
+	if s.AssetID != nil {
+		exists, err := h.assets.Exists(ctx, *s.AssetID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errInvalidSchedule{"Asset not found"}
+		}
+	}
+
+	// Occurrences before now or before the start are never materialized
+	s.MaterializedUntil = now
+	if start := s.StartsAt.Add(-time.Second); start.After(now) {
+		s.MaterializedUntil = start
+	}
+	return &s, nil
+}
+
+// defaultTimezone returns the default timezone of the organization of the
+// request, UTC when it has none
+func (h *ScheduleHandler) defaultTimezone(ctx context.Context) (string, error) {
+	orgID, ok := tenant.Organization(ctx)
+	if h.Organizations == nil || !ok {
+		return "UTC", nil
+	}
+	organization, err := h.Organizations.Get(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	if organization.Settings.DefaultTimezone == "" {
+		return "UTC", nil
+	}
+	return organization.Settings.DefaultTimezone, nil
+}
+
+// loadSchedule fetches the schedule named by the {id} route variable, answering 400 or 404 when it can not
+func (h *ScheduleHandler) loadSchedule(w http.ResponseWriter, r *http.Request) (*models.Schedule, bool) {
+	id, ok := scheduleIDParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	s, err := h.schedules.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return s, true
+}
+
+// scheduleIDParam parses the {id} route variable, answering 400 when it is not a schedule ID
+func scheduleIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	assert.NoError(t, users.Create(ctx, &tech))
+	assert.NoError(t, users.Create(ctx, &manager))
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	schedules := repository.NewMemoryScheduleRepository(users)
+	handler := NewScheduleHandler(schedules, users, repository.NewMemoryAssetRepository(tasks))
+
+	serve := func(handle http.HandlerFunc, method, target, body string, role models.Role, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(manager.ID))
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(reqCtx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	body := `{"summary":"Inspect the fire extinguishers","rule":"0 9 1 * *","timezone":"UTC","technician_id":1,"starts_at":"2099-01-01T00:00:00Z"}`
+	rr := serve(handler.CreateSchedule, "POST", "/schedules", body, models.RoleManager, nil)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created models.Schedule
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.True(t, created.Active)
+	assert.Equal(t, int64(manager.ID), created.CreatedBy)
+	assert.Equal(t, time.Date(2098, 12, 31, 23, 59, 59, 0, time.UTC), created.MaterializedUntil)
+	id := map[string]string{"id": "1"}
+
+	t.Run("validation", func(t *testing.T) {
+		for _, body := range []string{
+			`{"rule":"0 9 * * *","technician_id":1}`,
+			`{"summary":"x","rule":"every day","technician_id":1}`,
+			`{"summary":"x","rule":"FREQ=HOURLY","technician_id":1}`,
+			`{"summary":"x","rule":"0 9 * * *","timezone":"Mars/Olympus","technician_id":1}`,
+			`{"summary":"x","rule":"0 9 * * *","technician_id":2}`,
+			`{"summary":"x","rule":"0 9 * * *","technician_id":99}`,
+			`{"summary":"x","rule":"0 9 * * *","technician_id":1,"asset_id":5}`,
+			`{"summary":"x","rule":"0 9 * * *","technician_id":1,"starts_at":"2099-01-01T00:00:00Z","ends_at":"2098-01-01T00:00:00Z"}`,
+		} {
+			rr := serve(handler.CreateSchedule, "POST", "/schedules", body, models.RoleManager, nil)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+
+	t.Run("managers only", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionScheduleManage, handler.CreateSchedule), "POST", "/schedules", body, models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = serve(guarded(models.PermissionScheduleRead, handler.ListSchedules), "GET", "/schedules", "", models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = serve(guarded(models.PermissionScheduleRead, handler.PreviewSchedule), "GET", "/schedules/1/preview", "", models.RoleTechnician, id)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("preview", func(t *testing.T) {
+		rr := serve(handler.PreviewSchedule, "GET", "/schedules/1/preview?count=3", "", models.RoleManager, id)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var preview struct {
+			Occurrences []time.Time `json:"occurrences"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+		assert.Equal(t, []time.Time{
+			time.Date(2099, 1, 1, 9, 0, 0, 0, time.UTC),
+			time.Date(2099, 2, 1, 9, 0, 0, 0, time.UTC),
+			time.Date(2099, 3, 1, 9, 0, 0, 0, time.UTC),
+		}, preview.Occurrences)
+
+		rr = serve(handler.PreviewSchedule, "GET", "/schedules/1/preview?count=1000", "", models.RoleManager, id)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = serve(handler.PreviewSchedule, "GET", "/schedules/9/preview", "", models.RoleManager, map[string]string{"id": "9"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("update and pause", func(t *testing.T) {
+		update := `{"summary":"Inspect the fire extinguishers","rule":"FREQ=WEEKLY;BYDAY=MO","timezone":"Europe/Berlin","technician_id":1,"starts_at":"2099-01-01T00:00:00Z","active":false}`
+		rr := serve(handler.UpdateSchedule, "PUT", "/schedules/1", update, models.RoleManager, id)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		stored, err := schedules.Get(ctx, 1)
+		assert.NoError(t, err)
+		assert.False(t, stored.Active)
+		assert.Equal(t, "Europe/Berlin", stored.Timezone)
+		assert.Equal(t, created.CreatedBy, stored.CreatedBy)
+
+		rr = serve(handler.UpdateSchedule, "PUT", "/schedules/9", update, models.RoleManager, map[string]string{"id": "9"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("list, get and delete", func(t *testing.T) {
+		rr := serve(handler.ListSchedules, "GET", "/schedules", "", models.RoleManager, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []models.Schedule
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		assert.Len(t, list, 1)
+
+		assert.Equal(t, http.StatusOK, serve(handler.GetSchedule, "GET", "/schedules/1", "", models.RoleManager, id).Code)
+		assert.Equal(t, http.StatusOK, serve(handler.DeleteSchedule, "DELETE", "/schedules/1", "", models.RoleManager, id).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.GetSchedule, "GET", "/schedules/1", "", models.RoleManager, id).Code)
+	})
+}
+
+func TestScheduleDefaultTimezone(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+
+	organizations := repository.NewMemoryOrganizationRepository()
+	assert.NoError(t, organizations.UpdateSettings(ctx, models.DefaultOrganizationID,
+		models.OrganizationSettings{DefaultTimezone: "Europe/Madrid"}))
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	handler := NewScheduleHandler(repository.NewMemoryScheduleRepository(users), users, repository.NewMemoryAssetRepository(tasks))
+	handler.Organizations = organizations
+
+	create := func(body string) models.Schedule {
+		req := httptest.NewRequest("POST", "/schedules", bytes.NewBufferString(body))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(models.RoleManager))
+		rr := httptest.NewRecorder()
+		handler.CreateSchedule(rr, req.WithContext(tenant.WithOrganization(reqCtx, models.DefaultOrganizationID)))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var created models.Schedule
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		return created
+	}
+
+	assert.Equal(t, "Europe/Madrid", create(`{"summary":"x","rule":"0 9 * * *","technician_id":1}`).Timezone)
+	assert.Equal(t, "UTC", create(`{"summary":"x","rule":"0 9 * * *","timezone":"UTC","technician_id":1}`).Timezone)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// SessionHandler lets users see the devices they are logged in on and sign
+// out of them
+type SessionHandler struct {
+	tokens repository.TokenRepository
+}
+
+func NewSessionHandler(tokens repository.TokenRepository) *SessionHandler {
+	return &SessionHandler{
+		tokens: tokens,
+	}
+}
+
+// SessionResponse is a session in ListSessions, Current marks the session of
+// the request
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the active sessions of the user, the most recently
+// seen first
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.tokens.ListSessions(r.Context(), uint(subject.UserID))
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	current, _ := r.Context().Value(middleware.SessionIDContextKey).(string)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{Session: session, Current: session.ID == current})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding sessions: %v", err)
+	}
+}
+
+// DeleteSession signs the user out of one of their sessions, the current one
+// included. Its refresh tokens are revoked and its access tokens refused
+// right away.
+func (h *SessionHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	// Sessions of other users are not found, rather than forbidden, so their
+	// IDs can not be probed
+	session, err := h.tokens.GetSession(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && int64(session.UserID) != subject.UserID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !session.Active(time.Now()) {
+		http.Error(w, "Session has already ended", http.StatusConflict)
+		return
+	}
+
+	if err := h.tokens.RevokeFamily(r.Context(), session.ID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Session signed out successfully",
+		"id":      session.ID,
+	})
+}
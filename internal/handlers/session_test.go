@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	keys := testKeySet(t)
+	authHandler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	handler := NewSessionHandler(tokens)
+	validator := &auth.JWTValidator{Keys: keys, Revocations: tokens, Sessions: tokens}
+	authMiddleware := middleware.NewAuthMiddlewareHandler(validator, users)
+
+	// Register the user through loginAs, then log in from devices
+	loginAs(t, authHandler, users, "alice")
+	alice, _ := users.GetByUsername(ctx, "alice")
+	login := func(t *testing.T, deviceName, userAgent, address string) TokenResponse {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"username": "alice", "password": "secret", "device_name": deviceName})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = address + ":41000"
+		w := httptest.NewRecorder()
+		authHandler.Login(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response TokenResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	serve := func(handle http.HandlerFunc, method, target, token string, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req = mux.SetURLVars(req, vars)
+		w := httptest.NewRecorder()
+		authMiddleware.SessionMiddleware(handle)(w, req)
+		return w
+	}
+	list := func(t *testing.T, token string) []SessionResponse {
+		t.Helper()
+		w := serve(handler.ListSessions, http.MethodGet, "/me/sessions", token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var sessions []SessionResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+		return sessions
+	}
+	sessionOf := func(t *testing.T, token string) string {
+		t.Helper()
+		claims, err := validator.ValidateToken(token)
+		assert.NoError(t, err)
+		return claims.SessionID
+	}
+
+	laptop := login(t, "Work laptop", "Mozilla/5.0 (X11; Linux x86_64)", "192.0.2.10")
+	phone := login(t, " Phone ", "MaintenanceApp/2.1 (Android 14)", "198.51.100.7")
+
+	t.Run("lists the sessions of the user", func(t *testing.T) {
+		// The first login of loginAs is a session too
+		sessions := list(t, laptop.Token)
+		assert.Len(t, sessions, 3)
+
+		byDevice := map[string]SessionResponse{}
+		for _, session := range sessions {
+			assert.Equal(t, alice.ID, session.UserID)
+			byDevice[session.DeviceName] = session
+		}
+		assert.True(t, byDevice["Work laptop"].Current)
+		assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", byDevice["Work laptop"].UserAgent)
+		assert.Equal(t, "192.0.2.10", byDevice["Work laptop"].IPAddress)
+		assert.False(t, byDevice["Phone"].Current)
+		assert.Equal(t, sessionOf(t, phone.Token), byDevice["Phone"].ID)
+
+		// Other users do not see them
+		other := loginAs(t, authHandler, users, "bob")
+		assert.Len(t, list(t, other.Token), 1)
+	})
+
+	t.Run("refreshing keeps the session", func(t *testing.T) {
+		body, _ := json.Marshal(RefreshRequest{RefreshToken: phone.RefreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(body))
+		req.RemoteAddr = "203.0.113.5:41000"
+		w := httptest.NewRecorder()
+		authHandler.RefreshToken(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &phone))
+
+		session, err := tokens.GetSession(ctx, sessionOf(t, phone.Token))
+		assert.NoError(t, err)
+		assert.Equal(t, "Phone", session.DeviceName)
+		assert.Equal(t, "203.0.113.5", session.IPAddress)
+	})
+
+	t.Run("sign out of another session", func(t *testing.T) {
+		phoneSession := sessionOf(t, phone.Token)
+		w := serve(handler.DeleteSession, http.MethodDelete, "/me/sessions/"+phoneSession, laptop.Token, map[string]string{"id": phoneSession})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Its tokens are refused right away
+		w = serve(handler.ListSessions, http.MethodGet, "/me/sessions", phone.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, phone.RefreshToken).Code)
+		assert.Len(t, list(t, laptop.Token), 2)
+
+		w = serve(handler.DeleteSession, http.MethodDelete, "/me/sessions/"+phoneSession, laptop.Token, map[string]string{"id": phoneSession})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("sessions of other users are not found", func(t *testing.T) {
+		other := loginAs(t, authHandler, users, "bob")
+		otherSession := sessionOf(t, other.Token)
+		for _, id := range []string{otherSession, "unknown"} {
+			w := serve(handler.DeleteSession, http.MethodDelete, "/me/sessions/"+id, laptop.Token, map[string]string{"id": id})
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		}
+		_, err := validator.ValidateToken(other.Token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("sign out of the current session", func(t *testing.T) {
+		laptopSession := sessionOf(t, laptop.Token)
+		w := serve(handler.DeleteSession, http.MethodDelete, "/me/sessions/"+laptopSession, laptop.Token, map[string]string{"id": laptopSession})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = serve(handler.ListSessions, http.MethodGet, "/me/sessions", laptop.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("terminated sessions refuse tokens", func(t *testing.T) {
+		current := login(t, "", "", "192.0.2.10")
+		assert.NoError(t, tokens.RevokeUser(ctx, alice.ID))
+
+		w := serve(handler.ListSessions, http.MethodGet, "/me/sessions", current.Token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("tokens without a session are refused", func(t *testing.T) {
+		token, _, err := keys.IssueAccessToken(alice.ID, alice.OrganizationID, string(alice.Role), "", false)
+		assert.NoError(t, err)
+
+		w := serve(handler.ListSessions, http.MethodGet, "/me/sessions", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Session has been terminated")
+	})
+
+	t.Run("families from before sessions get one at refresh", func(t *testing.T) {
+		token, hash, _ := auth.NewRefreshToken()
+		assert.NoError(t, tokens.CreateRefreshToken(ctx, &models.RefreshToken{
+			UserID: alice.ID, FamilyID: "legacy-family", TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour),
+		}))
+
+		w := refresh(authHandler, token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var refreshed TokenResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+		assert.Equal(t, "legacy-family", sessionOf(t, refreshed.Token))
+		assert.Len(t, list(t, refreshed.Token), 1)
+	})
+
+	t.Run("device names are limited", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"username": "alice", "password": "secret", "device_name": strings.Repeat("a", 101)})
+		w := httptest.NewRecorder()
+		authHandler.Login(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Device name is too long")
+	})
+}
@@ -1,30 +1,69 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/authz"
 	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/repository"
 
 	"github.com/google/uuid"
 	"github.com/makcim392/maintenance-api/internal/models"
 )
 
 type TaskHandler struct {
-	db *sql.DB
+	tasks      repository.TaskRepository
+	assets     repository.AssetRepository
+	teams      repository.TeamRepository
+	authorizer *authz.Authorizer
 }
 
-func NewTaskHandler(db *sql.DB) *TaskHandler {
-	return &TaskHandler{
-		db: db,
+// TaskHandlerOption configures optional TaskHandler dependencies
+type TaskHandlerOption func(*TaskHandler)
+
+// WithAssets validates the asset_id of new tasks against the asset registry
+func WithAssets(assets repository.AssetRepository) TaskHandlerOption {
+	return func(h *TaskHandler) {
+		h.assets = assets
+	}
+}
+
+// WithTeams scopes roles holding :team permissions, such as managers, to the
+// tasks of the teams they manage. Without it they manage nobody.
+func WithTeams(teams repository.TeamRepository) TaskHandlerOption {
+	return func(h *TaskHandler) {
+		h.teams = teams
+	}
+}
+
+// WithAuthorizer checks access to individual tasks against the given
+// grants instead of models.DefaultRolePermissions
+func WithAuthorizer(authorizer *authz.Authorizer) TaskHandlerOption {
+	return func(h *TaskHandler) {
+		h.authorizer = authorizer
 	}
 }
 
+func NewTaskHandler(tasks repository.TaskRepository, opts ...TaskHandlerOption) *TaskHandler {
+	h := &TaskHandler{
+		tasks:      tasks,
+		authorizer: authz.Default(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// subject returns the authenticated user with the members of their teams
+func (h *TaskHandler) subject(w http.ResponseWriter, r *http.Request) (authz.Subject, bool) {
+	return teamSubject(w, r, h.authorizer, h.teams)
+}
+
 func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
@@ -44,60 +83,58 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task.ID = uuid.New().String()
-
-	// Get user information from context using your existing context keys
-	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
-	if !ok {
-		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
+	// Tasks recorded without a status were performed already
+	if task.Status == "" {
+		task.Status = models.StatusCompleted
+	}
+	if !task.Status.ValidInitial() {
+		http.Error(w, "Invalid initial status, must be scheduled, in_progress or completed", http.StatusBadRequest)
 		return
 	}
 
-	role, ok := r.Context().Value(middleware.RoleContextKey).(string)
-	if !ok {
-		http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
-		return
+	if task.AssetID != nil && h.assets != nil {
+		exists, err := h.assets.Exists(r.Context(), *task.AssetID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Asset not found", http.StatusBadRequest)
+			return
+		}
 	}
 
-	if role != string(models.RoleTechnician) {
-		http.Error(w, "Unauthorized to create task", http.StatusForbidden)
+	task.ID = uuid.New().String()
+
+	// The route requires models.PermissionTaskCreate, tasks are recorded for
+	// the user who performed them
+	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
+	if !ok {
+		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
 		return
 	}
 
 	task.TechnicianID = int64(userID)
 
-	// Insert into database
-	query := `
-        INSERT INTO tasks (id, technician_id, summary, performed_at)
-        VALUES (?, ?, ?, ?)
-    `
-	_, err := h.db.Exec(query, task.ID, task.TechnicianID, task.Summary, task.PerformedAt)
-	if err != nil {
+	// Store the task, its task.created event is queued in the same transaction
+	if err := h.tasks.Create(r.Context(), &task, int64(userID)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(task)
+	err := json.NewEncoder(w).Encode(task)
 	if err != nil {
 		log.Printf("Error encoding task: %v", err)
 	}
 }
 
+// UpdateTask changes the summary and performed date of a task. By default
+// only the technician who performed it may edit it, roles granted
+// models.PermissionTaskUpdateAny may edit every task.
 func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
-	value := r.Context().Value(middleware.UserIDContextKey)
-	log.Printf("Value in context: %v, Type: %T", value, value)
-
-	// Get user information from context using your existing context keys
-	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
-		return
-	}
-
-	role, ok := r.Context().Value(middleware.RoleContextKey).(string)
-	if !ok {
-		http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
 		return
 	}
 
@@ -105,9 +142,8 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	taskID := vars["id"]
 
 	// First, check if task exists and get current technician ID
-	var currentTechID int
-	err := h.db.QueryRow("SELECT technician_id FROM tasks WHERE id = ?", taskID).Scan(&currentTechID)
-	if errors.Is(err, sql.ErrNoRows) {
+	currentTechID, err := h.tasks.Owner(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -115,13 +151,7 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if userID != currentTechID {
-		http.Error(w, "Unauthorized to modify this task", http.StatusForbidden)
-		return
-	}
-
-	// Check authorization using your existing role constants
-	if role != string(models.RoleManager) && userID != currentTechID {
+	if !h.authorizer.CanUpdateTask(subject, currentTechID) {
 		http.Error(w, "Unauthorized to modify this task", http.StatusForbidden)
 		return
 	}
@@ -137,26 +167,18 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `
-        UPDATE tasks SET summary = ?, performed_at = ?
-		WHERE 
-		id = ? AND technician_id = ?
-    `
-	result, err := h.db.Exec(query, task.Summary, task.PerformedAt, taskID, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// The task keeps its technician when a manager edits it, the repository
+	// only updates it while it still belongs to them
+	task.ID = taskID
+	task.TechnicianID = currentTechID
+	err = h.tasks.Update(r.Context(), &task, subject.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found or unauthorized", http.StatusNotFound)
 		return
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Task not found or unauthorized", http.StatusNotFound)
-		return
-	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -166,115 +188,54 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *TaskHandler) ListTasks(w http.ResponseWriter, r *http.Request) {
-	// Get user information from context using your existing context keys
-	userID, ok := r.Context().Value(middleware.UserIDContextKey).(int)
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unable to get user ID from context", http.StatusInternalServerError)
 		return
 	}
 
-	role, ok := r.Context().Value(middleware.RoleContextKey).(string)
-	if !ok {
-		http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
-		return
-	}
-
-	var query string
-	var args []interface{}
-
-	// Build query based on user role with DATE_FORMAT
-	if role == string(models.RoleTechnician) {
-		query = `
-            SELECT t.id, t.summary, 
-            DATE_FORMAT(t.performed_at, '%Y-%m-%d %H:%i:%s') as performed_at, 
-            t.technician_id, u.username
-            FROM tasks t
-            JOIN users u ON t.technician_id = u.id
-            WHERE t.technician_id = ?
-            ORDER BY t.performed_at DESC`
-		args = append(args, userID)
-	} else if role == string(models.RoleManager) {
-		query = `
-            SELECT t.id, t.summary, 
-            DATE_FORMAT(t.performed_at, '%Y-%m-%d %H:%i:%s') as performed_at, 
-            t.technician_id, u.username
-            FROM tasks t
-            JOIN users u ON t.technician_id = u.id
-            ORDER BY t.performed_at DESC`
-	} else {
+	// Technicians only see their own tasks, managers the tasks of their teams
+	if !h.authorizer.Allows(subject, models.PermissionTaskReadOwn) {
 		http.Error(w, "Unauthorized role", http.StatusForbidden)
 		return
 	}
 
-	// Execute query
-	rows, err := h.db.Query(query, args...)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	filter, err := parseTaskFilter(r.URL.Query(), subject, h.authorizer)
+	if errors.Is(err, errTechnicianFilter) || errors.Is(err, errTechnicianNotManaged) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
-	}
-	defer rows.Close()
-
-	type TaskResponse struct {
-		ID           string    `json:"id"`
-		Summary      string    `json:"summary"`
-		PerformedAt  time.Time `json:"performed_at"`
-		TechnicianID int64     `json:"technician_id"`
-		Username     string    `json:"technician_name"`
-	}
-
-	var tasks []TaskResponse
-
-	// Iterate through results
-	for rows.Next() {
-		var task TaskResponse
-		var performedAtStr string // Change to string to receive the formatted date
-
-		err := rows.Scan(
-			&task.ID,
-			&task.Summary,
-			&performedAtStr,
-			&task.TechnicianID,
-			&task.Username,
-		)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Parse the formatted date string
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", performedAtStr)
-		if err != nil {
-			http.Error(w, "Error parsing date", http.StatusInternalServerError)
-			return
-		}
-		task.PerformedAt = parsedTime
-
-		tasks = append(tasks, task)
 	}
 
-	if err = rows.Err(); err != nil {
+	page, err := h.tasks.List(r.Context(), filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, repository.ErrInvalidDate) {
+		http.Error(w, "Error parsing date", http.StatusInternalServerError)
+		return
+	} else if errors.Is(err, repository.ErrDecrypt) {
+		log.Printf("Error listing tasks: %v", err)
+		http.Error(w, "Error decrypting task summary", http.StatusInternalServerError)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(tasks); err != nil {
+	if err := json.NewEncoder(w).Encode(page); err != nil {
 		log.Printf("Error encoding tasks: %v", err)
 	}
 }
 
+// DeleteTask removes a task. The route requires models.PermissionTaskDeleteTeam,
+// managers may only delete the tasks of their teams.
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
-	// Get user role from context
-	role, ok := r.Context().Value(middleware.RoleContextKey).(string)
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
-		return
-	}
-
-	// Only managers can delete tasks
-	if role != string(models.RoleManager) {
-		http.Error(w, "Unauthorized to delete tasks", http.StatusForbidden)
 		return
 	}
 
@@ -283,34 +244,28 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	taskID := vars["id"]
 
 	// Check if task exists before deleting
-	var exists bool
-	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?)", taskID).Scan(&exists)
-	if err != nil {
+	ownerID, err := h.tasks.Owner(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if !exists {
-		http.Error(w, "Task not found", http.StatusNotFound)
+	if !h.authorizer.CanDeleteTask(subject, ownerID) {
+		http.Error(w, "Unauthorized to delete this task", http.StatusForbidden)
 		return
 	}
 
 	// Delete the task
-	query := "DELETE FROM tasks WHERE id = ?"
-	result, err := h.db.Exec(query, taskID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err = h.tasks.Delete(r.Context(), taskID, subject.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
 		return
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Task not found", http.StatusNotFound)
-		return
-	}
 
 	// Return success response
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+var (
+	// errTechnicianFilter is returned when a technician tries to list another technician's tasks
+	errTechnicianFilter = errors.New("Only managers can filter by technician")
+
+	// errTechnicianNotManaged is returned when a manager filters by a technician outside their teams
+	errTechnicianNotManaged = errors.New("Technician is not in your teams")
+)
+
+// maxQueryLength bounds the free-text search term
+const maxQueryLength = 200
+
+// parseTaskFilter builds the ListTasks filter from the query string. The
+// subject is scoped to the tasks it may read: its own, those of its teams or
+// every task.
+func parseTaskFilter(values url.Values, subject authz.Subject, authorizer *authz.Authorizer) (repository.TaskFilter, error) {
+	var filter repository.TaskFilter
+
+	owners := authorizer.TaskOwners(subject)
+	if value := values.Get("technician_id"); value != "" {
+		if !authorizer.Allows(subject, models.PermissionTaskReadTeam) {
+			return filter, errTechnicianFilter
+		}
+		technicianID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || technicianID <= 0 {
+			return filter, errors.New("Invalid technician_id")
+		}
+		if !authorizer.CanReadTask(subject, technicianID) {
+			return filter, errTechnicianNotManaged
+		}
+		filter.TechnicianID = &technicianID
+	} else if len(owners) == 1 {
+		filter.TechnicianID = &owners[0]
+	} else if owners != nil {
+		filter.TechnicianIDs = owners
+	}
+
+	if value := values.Get("performed_from"); value != "" {
+		from, err := parseDateParam(value, false)
+		if err != nil {
+			return filter, errors.New("Invalid performed_from, expected an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		filter.PerformedFrom = &from
+	}
+	if value := values.Get("performed_to"); value != "" {
+		to, err := parseDateParam(value, true)
+		if err != nil {
+			return filter, errors.New("Invalid performed_to, expected an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		filter.PerformedTo = &to
+	}
+	if filter.PerformedFrom != nil && filter.PerformedTo != nil && filter.PerformedFrom.After(*filter.PerformedTo) {
+		return filter, errors.New("performed_from must not be after performed_to")
+	}
+
+	if value := values.Get("status"); value != "" {
+		filter.Status = models.TaskStatus(value)
+		if !filter.Status.Valid() {
+			return filter, errors.New("Invalid status")
+		}
+	}
+
+	filter.Query = strings.TrimSpace(values.Get("q"))
+	if len(filter.Query) > maxQueryLength {
+		return filter, fmt.Errorf("q must not exceed %d characters", maxQueryLength)
+	}
+
+	sort, err := repository.ParseTaskSort(values.Get("sort"))
+	if err != nil {
+		return filter, fmt.Errorf("Invalid sort, must be %q or %q", repository.SortPerformedAtDesc, repository.SortPerformedAtAsc)
+	}
+	filter.Sort = sort
+
+	filter.Limit = repository.DefaultTaskLimit
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > repository.MaxTaskLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", repository.MaxTaskLimit)
+		}
+		filter.Limit = limit
+	}
+
+	filter.Cursor = values.Get("cursor")
+	return filter, nil
+}
+
+// parseDateParam accepts an RFC 3339 timestamp or a plain date. A plain date
+// used as an upper bound covers the whole day.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTaskFilter(t *testing.T) {
+	authorizer := authz.Default()
+	technician := authz.Subject{UserID: 5, Role: models.RoleTechnician}
+	manager := authz.Subject{UserID: 2, Role: models.RoleManager, Team: []int64{2, 7, 8}}
+	admin := authz.Subject{UserID: 1, Role: models.RoleAdmin}
+
+	t.Run("defaults", func(t *testing.T) {
+		for _, subject := range []authz.Subject{technician, manager, admin} {
+			filter, err := parseTaskFilter(url.Values{}, subject, authorizer)
+			assert.NoError(t, err)
+			assert.Equal(t, repository.SortPerformedAtDesc, filter.Sort)
+			assert.Equal(t, repository.DefaultTaskLimit, filter.Limit)
+			assert.Nil(t, filter.PerformedFrom)
+			assert.Nil(t, filter.PerformedTo)
+			assert.Empty(t, filter.Query)
+			assert.Empty(t, filter.Cursor)
+		}
+	})
+
+	t.Run("technician is scoped to their own tasks", func(t *testing.T) {
+		filter, err := parseTaskFilter(url.Values{}, technician, authorizer)
+		assert.NoError(t, err)
+		if assert.NotNil(t, filter.TechnicianID) {
+			assert.Equal(t, int64(5), *filter.TechnicianID)
+		}
+	})
+
+	t.Run("technician cannot filter by technician", func(t *testing.T) {
+		_, err := parseTaskFilter(url.Values{"technician_id": {"5"}}, technician, authorizer)
+		assert.ErrorIs(t, err, errTechnicianFilter)
+	})
+
+	t.Run("admin sees every technician unless filtered", func(t *testing.T) {
+		filter, err := parseTaskFilter(url.Values{}, admin, authorizer)
+		assert.NoError(t, err)
+		assert.Nil(t, filter.TechnicianID)
+		assert.Nil(t, filter.TechnicianIDs)
+
+		filter, err = parseTaskFilter(url.Values{"technician_id": {"7"}}, admin, authorizer)
+		assert.NoError(t, err)
+		if assert.NotNil(t, filter.TechnicianID) {
+			assert.Equal(t, int64(7), *filter.TechnicianID)
+		}
+
+		_, err = parseTaskFilter(url.Values{"technician_id": {"abc"}}, admin, authorizer)
+		assert.Error(t, err)
+	})
+
+	t.Run("manager is scoped to their teams", func(t *testing.T) {
+		filter, err := parseTaskFilter(url.Values{}, manager, authorizer)
+		assert.NoError(t, err)
+		assert.Nil(t, filter.TechnicianID)
+		assert.Equal(t, []int64{2, 7, 8}, filter.TechnicianIDs)
+
+		filter, err = parseTaskFilter(url.Values{"technician_id": {"7"}}, manager, authorizer)
+		assert.NoError(t, err)
+		if assert.NotNil(t, filter.TechnicianID) {
+			assert.Equal(t, int64(7), *filter.TechnicianID)
+		}
+
+		_, err = parseTaskFilter(url.Values{"technician_id": {"9"}}, manager, authorizer)
+		assert.ErrorIs(t, err, errTechnicianNotManaged)
+
+		// A manager without a team only sees their own tasks
+		filter, err = parseTaskFilter(url.Values{}, authz.Subject{UserID: 3, Role: models.RoleManager}, authorizer)
+		assert.NoError(t, err)
+		if assert.NotNil(t, filter.TechnicianID) {
+			assert.Equal(t, int64(3), *filter.TechnicianID)
+		}
+	})
+
+	t.Run("every parameter", func(t *testing.T) {
+		for _, subject := range []authz.Subject{technician, manager, admin} {
+			filter, err := parseTaskFilter(url.Values{
+				"performed_from": {"2024-12-01T08:00:00Z"},
+				"performed_to":   {"2024-12-31"},
+				"status":         {"scheduled"},
+				"q":              {"  pump  "},
+				"sort":           {"performed_at"},
+				"limit":          {"10"},
+				"cursor":         {"abc"},
+			}, subject, authorizer)
+			assert.NoError(t, err)
+			assert.Equal(t, time.Date(2024, 12, 1, 8, 0, 0, 0, time.UTC), *filter.PerformedFrom)
+			assert.Equal(t, time.Date(2024, 12, 31, 23, 59, 59, 999999999, time.UTC), *filter.PerformedTo)
+			assert.Equal(t, "pump", filter.Query)
+			assert.Equal(t, repository.SortPerformedAtAsc, filter.Sort)
+			assert.Equal(t, 10, filter.Limit)
+			assert.Equal(t, "abc", filter.Cursor)
+		}
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, values := range []url.Values{
+			{"performed_from": {"12/01/2024"}},
+			{"performed_to": {"tomorrow"}},
+			{"performed_from": {"2024-12-31"}, "performed_to": {"2024-12-01"}},
+			{"status": {"done"}},
+			{"sort": {"technician"}},
+			{"limit": {"0"}},
+			{"limit": {"1000"}},
+			{"limit": {"ten"}},
+		} {
+			_, err := parseTaskFilter(values, admin, authorizer)
+			assert.Error(t, err, values.Encode())
+		}
+	})
+}
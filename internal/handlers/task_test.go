@@ -12,8 +12,11 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/logger"
 	"github.com/makcim392/maintenance-api/internal/middleware"
 	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,7 +28,7 @@ func TestCreateTask(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewTaskHandler(db)
+	handler := NewTaskHandler(repository.NewMySQLTaskRepository(db))
 
 	// Define a fixed timestamp for testing
 	fixedTime := time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC)
@@ -51,9 +54,19 @@ func TestCreateTask(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
+		// The task, its notification and its event are written in one transaction
+		mock.ExpectBegin()
 		mock.ExpectExec("INSERT INTO tasks").
-			WithArgs(sqlmock.AnyArg(), 1, task.Summary, fixedTime).
+			WithArgs(sqlmock.AnyArg(), 1, nil, task.Summary, nil, nil, fixedTime, models.StatusCompleted).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventTaskPerformed, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectTaskOrganization(mock, sqlmock.AnyArg())
+		expectTaskEvent(mock, events.TypeTaskCreated)
+		mock.ExpectCommit()
 
 		handler.CreateTask(rr, req)
 
@@ -61,6 +74,40 @@ func TestCreateTask(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("outbox failure rolls back the task", func(t *testing.T) {
+		task := models.Task{
+			Summary:     "Test task",
+			PerformedAt: fixedTime,
+		}
+
+		taskJSON, err := json.Marshal(task)
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(taskJSON))
+		req.Header.Set("Content-Type", "application/json")
+
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleTechnician))
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO tasks").
+			WithArgs(sqlmock.AnyArg(), 1, nil, task.Summary, nil, nil, fixedTime, models.StatusCompleted).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		handler.CreateTask(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("unauthorized role", func(t *testing.T) {
 		task := models.Task{
 			Summary:     "Test task",
@@ -80,10 +127,10 @@ func TestCreateTask(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		handler.CreateTask(rr, req)
+		guarded(models.PermissionTaskCreate, handler.CreateTask)(rr, req)
 
 		assert.Equal(t, http.StatusForbidden, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Unauthorized to create task")
+		assert.Contains(t, rr.Body.String(), "Missing permission task:create")
 	})
 
 	// Previous test cases remain the same...
@@ -139,7 +186,7 @@ func TestUpdateTask(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewTaskHandler(db)
+	handler := NewTaskHandler(repository.NewMySQLTaskRepository(db))
 	fixedTime := time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC)
 
 	t.Run("successful update by technician", func(t *testing.T) {
@@ -172,10 +219,15 @@ func TestUpdateTask(t *testing.T) {
 			WithArgs("123").
 			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(1))
 
-		// Expect the update
+		// Expect the update and its event in one transaction
+		mock.ExpectBegin()
 		mock.ExpectExec("UPDATE tasks").
-			WithArgs(task.Summary, task.PerformedAt, "123", 1).
+			WithArgs(task.Summary, nil, nil, task.PerformedAt, "123", 1).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectStoredTask(mock, "123", 1)
+		expectTaskOrganization(mock, "123")
+		expectTaskEvent(mock, events.TypeTaskUpdated)
+		mock.ExpectCommit()
 
 		handler.UpdateTask(rr, req)
 
@@ -277,9 +329,11 @@ func TestUpdateTask(t *testing.T) {
 			WithArgs("123").
 			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(1))
 
+		mock.ExpectBegin()
 		mock.ExpectExec("UPDATE tasks").
-			WithArgs(task.Summary, task.PerformedAt, "123", 1).
+			WithArgs(task.Summary, nil, nil, task.PerformedAt, "123", 1).
 			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
 		handler.UpdateTask(rr, req)
 
@@ -295,7 +349,7 @@ func TestListTasks(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewTaskHandler(db)
+	handler := NewTaskHandler(repository.NewMySQLTaskRepository(db), WithTeams(testTeams(t)))
 	fixedTime := time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC)
 	formattedTime := fixedTime.Format("2006-01-02 15:04:05")
 
@@ -310,22 +364,27 @@ func TestListTasks(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// Expect query for technician's tasks only
-		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "username"}).
-			AddRow("task1", "Task 1 summary", formattedTime, 1, "tech1").
-			AddRow("task2", "Task 2 summary", formattedTime, 1, "tech1")
+		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}).
+			AddRow("task1", "Task 1 summary", formattedTime, 1, nil, "tech1", nil, nil, "completed").
+			AddRow("task2", "Task 2 summary", formattedTime, 1, nil, "tech1", nil, nil, "completed")
 
 		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*FROM tasks t.*WHERE t.technician_id = ?.*").
-			WithArgs(1).
+			WithArgs(1, repository.DefaultTaskLimit+1).
 			WillReturnRows(rows)
 
 		handler.ListTasks(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		var tasks []map[string]interface{}
-		err := json.Unmarshal(rr.Body.Bytes(), &tasks)
+		var page struct {
+			Tasks      []map[string]interface{} `json:"tasks"`
+			NextCursor string                   `json:"next_cursor"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &page)
 		assert.NoError(t, err)
+		tasks := page.Tasks
 		assert.Len(t, tasks, 2)
+		assert.Empty(t, page.NextCursor)
 		assert.Equal(t, "task1", tasks[0]["id"])
 		assert.Equal(t, float64(1), tasks[0]["technician_id"])
 		assert.Equal(t, "tech1", tasks[0]["technician_name"])
@@ -341,27 +400,107 @@ func TestListTasks(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		// Expect query for all tasks
-		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "username"}).
-			AddRow("task1", "Task 1 summary", formattedTime, 1, "tech1").
-			AddRow("task2", "Task 2 summary", formattedTime, 3, "tech2")
+		// Expect query for the tasks of the manager's team
+		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}).
+			AddRow("task1", "Task 1 summary", formattedTime, 1, nil, "tech1", nil, nil, "completed").
+			AddRow("task2", "Task 2 summary", formattedTime, 3, nil, "tech2", nil, nil, "completed")
 
-		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*FROM tasks t.*ORDER BY t.performed_at DESC").
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*FROM tasks t.*WHERE t.technician_id IN \\(\\?, \\?, \\?\\).*ORDER BY t.performed_at DESC").
+			WithArgs(2, 1, 3, repository.DefaultTaskLimit+1).
 			WillReturnRows(rows)
 
 		handler.ListTasks(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		var tasks []map[string]interface{}
-		err := json.Unmarshal(rr.Body.Bytes(), &tasks)
+		var page struct {
+			Tasks []map[string]interface{} `json:"tasks"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &page)
 		assert.NoError(t, err)
+		tasks := page.Tasks
 		assert.Len(t, tasks, 2)
 		// Verify tasks from different technicians are included
 		assert.Equal(t, float64(1), tasks[0]["technician_id"])
 		assert.Equal(t, float64(3), tasks[1]["technician_id"])
 	})
 
+	t.Run("manager filters, sorts and pages", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/tasks?technician_id=3&performed_from=2024-12-01&performed_to=2024-12-31&q=pump&sort=performed_at&limit=1", nil)
+
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 2)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}).
+			AddRow("task1", "Fixed the pump", formattedTime, 3, nil, "tech2", nil, nil, "completed").
+			AddRow("task2", "Replaced the pump", formattedTime, 3, nil, "tech2", nil, nil, "completed")
+
+		from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2024, 12, 31, 23, 59, 59, 999999999, time.UTC)
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*WHERE t.technician_id = \\? AND t.performed_at >= \\? AND t.performed_at <= \\? AND \\(t.summary LIKE \\? OR u.username LIKE \\?\\).*ORDER BY t.performed_at ASC").
+			WithArgs(3, from, to, "%pump%", "%pump%", 2).
+			WillReturnRows(rows)
+
+		handler.ListTasks(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var page struct {
+			Tasks      []map[string]interface{} `json:"tasks"`
+			NextCursor string                   `json:"next_cursor"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		assert.Len(t, page.Tasks, 1)
+		assert.NotEmpty(t, page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("technician cannot filter by technician", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/tasks?technician_id=3", nil)
+
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleTechnician))
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler.ListTasks(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Only managers can filter by technician")
+	})
+
+	t.Run("manager cannot filter by a technician outside their teams", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/tasks?technician_id=9", nil)
+
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 2)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler.ListTasks(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Technician is not in your teams")
+	})
+
+	t.Run("invalid query parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=101", "sort=summary", "performed_from=yesterday", "cursor=garbage"} {
+			req := httptest.NewRequest("GET", "/tasks?"+query, nil)
+
+			ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 2)
+			ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
+			req = req.WithContext(ctx)
+
+			rr := httptest.NewRecorder()
+			handler.ListTasks(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		}
+	})
+
 	t.Run("unauthorized role", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/tasks", nil)
 
@@ -398,7 +537,7 @@ func TestListTasks(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*").
-			WithArgs(1).
+			WithArgs(1, repository.DefaultTaskLimit+1).
 			WillReturnError(sql.ErrConnDone)
 
 		handler.ListTasks(rr, req)
@@ -417,11 +556,11 @@ func TestListTasks(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// Return an invalid date format
-		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "username"}).
-			AddRow("task1", "Task 1 summary", "invalid-date", 1, "tech1")
+		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}).
+			AddRow("task1", "Task 1 summary", "invalid-date", 1, nil, "tech1", nil, nil, "completed")
 
 		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*").
-			WithArgs(1).
+			WithArgs(1, repository.DefaultTaskLimit+1).
 			WillReturnRows(rows)
 
 		handler.ListTasks(rr, req)
@@ -429,6 +568,29 @@ func TestListTasks(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Error parsing date")
 	})
+
+	t.Run("encrypted summary without a keyring", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/tasks", nil)
+
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleTechnician))
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		rows := sqlmock.NewRows([]string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}).
+			AddRow("task1", "c2VhbGVk", "2024-12-25 10:00:00", 1, nil, "tech1", "2025-01", "d3JhcHBlZA==", "completed")
+
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*").
+			WithArgs(1, repository.DefaultTaskLimit+1).
+			WillReturnRows(rows)
+
+		handler.ListTasks(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Error decrypting task summary")
+		assert.NotContains(t, rr.Body.String(), "2025-01")
+	})
 }
 
 func TestDeleteTask(t *testing.T) {
@@ -439,35 +601,38 @@ func TestDeleteTask(t *testing.T) {
 	}
 	defer db.Close()
 
-	handler := NewTaskHandler(db)
-
-	t.Run("successful deletion by manager", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/tasks/123", nil)
+	handler := NewTaskHandler(repository.NewMySQLTaskRepository(db), WithTeams(testTeams(t)))
 
-		// Add manager context
-		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
-		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
-		req = req.WithContext(ctx)
-
-		// Add URL parameters
-		vars := map[string]string{
-			"id": "123",
-		}
-		req = mux.SetURLVars(req, vars)
+	deleteAs := func(userID int, role models.Role, taskID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/tasks/"+taskID, nil)
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(ctx), map[string]string{"id": taskID})
 
 		rr := httptest.NewRecorder()
+		handler.DeleteTask(rr, req)
+		return rr
+	}
 
-		// Expect check for existing task
-		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+	t.Run("successful deletion by manager", func(t *testing.T) {
+		// Expect the owner lookup, the task was performed by a member of the team
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
 			WithArgs("123").
-			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
-
-		// Expect the delete operation
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(3))
+
+		// Expect the delete operation, queueing the blobs of the attachments and the event
+		mock.ExpectBegin()
+		expectTaskOrganization(mock, "123")
+		mock.ExpectExec("INSERT INTO blob_deletions").
+			WithArgs("123", "123").
+			WillReturnResult(sqlmock.NewResult(0, 2))
 		mock.ExpectExec("DELETE FROM tasks WHERE id = ?").
 			WithArgs("123").
 			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTaskEvent(mock, events.TypeTaskDeleted)
+		mock.ExpectCommit()
 
-		handler.DeleteTask(rr, req)
+		rr := deleteAs(2, models.RoleManager, "123")
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -479,6 +644,39 @@ func TestDeleteTask(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("manager cannot delete tasks outside their teams", func(t *testing.T) {
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
+			WithArgs("123").
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(9))
+
+		rr := deleteAs(2, models.RoleManager, "123")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Unauthorized to delete this task")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("admin deletes any task", func(t *testing.T) {
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
+			WithArgs("123").
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(9))
+		mock.ExpectBegin()
+		expectTaskOrganization(mock, "123")
+		mock.ExpectExec("INSERT INTO blob_deletions").
+			WithArgs("123", "123").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM tasks WHERE id = ?").
+			WithArgs("123").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTaskEvent(mock, events.TypeTaskDeleted)
+		mock.ExpectCommit()
+
+		rr := deleteAs(4, models.RoleAdmin, "123")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("unauthorized role (technician)", func(t *testing.T) {
 		req := httptest.NewRequest("DELETE", "/tasks/123", nil)
 
@@ -494,32 +692,18 @@ func TestDeleteTask(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		handler.DeleteTask(rr, req)
+		guarded(models.PermissionTaskDeleteTeam, handler.DeleteTask)(rr, req)
 
 		assert.Equal(t, http.StatusForbidden, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Unauthorized to delete tasks")
+		assert.Contains(t, rr.Body.String(), "Missing permission task:delete:team")
 	})
 
 	t.Run("task not found", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/tasks/nonexistent", nil)
-
-		// Add manager context
-		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
-		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
-		req = req.WithContext(ctx)
-
-		vars := map[string]string{
-			"id": "nonexistent",
-		}
-		req = mux.SetURLVars(req, vars)
-
-		rr := httptest.NewRecorder()
-
-		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
 			WithArgs("nonexistent").
-			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+			WillReturnError(sql.ErrNoRows)
 
-		handler.DeleteTask(rr, req)
+		rr := deleteAs(2, models.RoleManager, "nonexistent")
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Task not found")
@@ -527,52 +711,32 @@ func TestDeleteTask(t *testing.T) {
 	})
 
 	t.Run("database error during check", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/tasks/123", nil)
-
-		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
-		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
-		req = req.WithContext(ctx)
-
-		vars := map[string]string{
-			"id": "123",
-		}
-		req = mux.SetURLVars(req, vars)
-
-		rr := httptest.NewRecorder()
-
-		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
 			WithArgs("123").
 			WillReturnError(sql.ErrConnDone)
 
-		handler.DeleteTask(rr, req)
+		rr := deleteAs(2, models.RoleManager, "123")
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("database error during delete", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/tasks/123", nil)
-
-		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
-		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleManager))
-		req = req.WithContext(ctx)
-
-		vars := map[string]string{
-			"id": "123",
-		}
-		req = mux.SetURLVars(req, vars)
-
-		rr := httptest.NewRecorder()
-
-		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = ?").
 			WithArgs("123").
-			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(1))
 
+		mock.ExpectBegin()
+		expectTaskOrganization(mock, "123")
+		mock.ExpectExec("INSERT INTO blob_deletions").
+			WithArgs("123", "123").
+			WillReturnResult(sqlmock.NewResult(0, 0))
 		mock.ExpectExec("DELETE FROM tasks WHERE id = ?").
 			WithArgs("123").
 			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
 
-		handler.DeleteTask(rr, req)
+		rr := deleteAs(2, models.RoleManager, "123")
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -588,9 +752,171 @@ func TestDeleteTask(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		handler.DeleteTask(rr, req)
+		guarded(models.PermissionTaskDeleteTeam, handler.DeleteTask)(rr, req)
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
 		assert.Contains(t, rr.Body.String(), "Unable to get role from context")
 	})
 }
+
+// expectTaskOrganization expects the lookup of the organization a task event is attributed to
+func expectTaskOrganization(mock sqlmock.Sqlmock, taskID interface{}) {
+	mock.ExpectQuery("SELECT u.organization_id FROM tasks t").
+		WithArgs(taskID).
+		WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(1))
+}
+
+// expectStoredTask expects a task to be read back in the transaction of its
+// update, for the event
+func expectStoredTask(mock sqlmock.Sqlmock, taskID interface{}, technicianID int64) {
+	mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FROM tasks WHERE id = \\? FOR UPDATE").
+		WithArgs(taskID).
+		WillReturnRows(sqlmock.NewRows([]string{"technician_id", "asset_id", "summary", "summary_key_id", "summary_wrapped_key", "performed_at", "status"}).
+			AddRow(technicianID, nil, "Updated task", nil, nil, "2024-12-25 10:00:00", models.StatusScheduled))
+}
+
+// expectTaskEvent expects a task event to be queued in the events topic of the outbox
+func expectTaskEvent(mock sqlmock.Sqlmock, eventType string) {
+	mock.ExpectExec("INSERT INTO notification_outbox \\(topic, event_type, payload\\)").
+		WithArgs(models.OutboxEvents, eventType, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// testTeams returns a team repository in which manager 2 manages
+// technicians 1 and 3, technician 9 is in no team
+func testTeams(t *testing.T) repository.TeamRepository {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	for _, user := range []models.User{
+		{Username: "tech1", Role: models.RoleTechnician},
+		{Username: "manager", Role: models.RoleManager},
+		{Username: "tech2", Role: models.RoleTechnician},
+	} {
+		assert.NoError(t, users.Create(ctx, &user))
+	}
+
+	teams := repository.NewMemoryTeamRepository(users)
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(ctx, &team))
+	for _, member := range []models.TeamMember{
+		{TeamID: team.ID, UserID: 1, Role: models.TeamRoleMember},
+		{TeamID: team.ID, UserID: 2, Role: models.TeamRoleManager},
+		{TeamID: team.ID, UserID: 3, Role: models.TeamRoleMember},
+	} {
+		assert.NoError(t, teams.SetMember(ctx, &member))
+	}
+	return teams
+}
+
+func TestTaskHandlerWithMemoryRepository(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(context.Background(), &tech))
+
+	// The manager manages the technician's team
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	assert.NoError(t, users.Create(context.Background(), &manager))
+	teams := repository.NewMemoryTeamRepository(users)
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(context.Background(), &team))
+	for _, member := range []models.TeamMember{
+		{TeamID: team.ID, UserID: tech.ID, Role: models.TeamRoleMember},
+		{TeamID: team.ID, UserID: manager.ID, Role: models.TeamRoleManager},
+	} {
+		assert.NoError(t, teams.SetMember(context.Background(), &member))
+	}
+
+	tasksRepo := repository.NewMemoryTaskRepository(users)
+	handler := NewTaskHandler(tasksRepo, WithTeams(teams))
+	fixedTime := time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC)
+
+	withUser := func(req *http.Request, userID int, role models.Role) *http.Request {
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		return req.WithContext(ctx)
+	}
+
+	// Create a task as the technician
+	taskJSON, _ := json.Marshal(models.Task{Summary: "Memory task", PerformedAt: fixedTime})
+	req := withUser(httptest.NewRequest("POST", "/tasks", bytes.NewBuffer(taskJSON)), int(tech.ID), models.RoleTechnician)
+	rr := httptest.NewRecorder()
+	handler.CreateTask(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var created models.Task
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+
+	// Update it
+	taskJSON, _ = json.Marshal(models.Task{Summary: "Updated memory task", PerformedAt: fixedTime})
+	req = withUser(httptest.NewRequest("PUT", "/tasks/"+created.ID, bytes.NewBuffer(taskJSON)), int(tech.ID), models.RoleTechnician)
+	req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+	rr = httptest.NewRecorder()
+	handler.UpdateTask(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Another technician cannot update it, and no event is published
+	req = withUser(httptest.NewRequest("PUT", "/tasks/"+created.ID, bytes.NewBuffer(taskJSON)), 42, models.RoleTechnician)
+	req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+	rr = httptest.NewRecorder()
+	handler.UpdateTask(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Neither can a manager without task:update:any
+	req = withUser(httptest.NewRequest("PUT", "/tasks/"+created.ID, bytes.NewBuffer(taskJSON)), int(manager.ID), models.RoleManager)
+	req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+	rr = httptest.NewRecorder()
+	handler.UpdateTask(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Manager lists it
+	req = withUser(httptest.NewRequest("GET", "/tasks", nil), int(manager.ID), models.RoleManager)
+	rr = httptest.NewRecorder()
+	handler.ListTasks(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var page struct {
+		Tasks []map[string]interface{} `json:"tasks"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	tasks := page.Tasks
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "Updated memory task", tasks[0]["summary"])
+	assert.Equal(t, "tech1", tasks[0]["technician_name"])
+
+	// Manager deletes it
+	req = withUser(httptest.NewRequest("DELETE", "/tasks/"+created.ID, nil), int(manager.ID), models.RoleManager)
+	req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+	rr = httptest.NewRecorder()
+	handler.DeleteTask(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req = withUser(httptest.NewRequest("DELETE", "/tasks/"+created.ID, nil), int(manager.ID), models.RoleManager)
+	req = mux.SetURLVars(req, map[string]string{"id": created.ID})
+	rr = httptest.NewRecorder()
+	handler.DeleteTask(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Exactly one event per successful mutation is relayed from the outbox
+	publisher := events.NewInProcessPublisher()
+	var published []events.Envelope
+	publisher.Subscribe(func(event events.Envelope) {
+		published = append(published, event)
+	})
+	relayed, err := events.NewRelay(tasksRepo.Outbox(), publisher, logger.New()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, relayed)
+	if assert.Len(t, published, 3) {
+		assert.Equal(t, events.TypeTaskCreated, published[0].Type)
+		assert.Equal(t, events.TypeTaskUpdated, published[1].Type)
+		assert.Equal(t, events.TypeTaskDeleted, published[2].Type)
+		assert.Equal(t, int64(tech.ID), published[0].ActorID)
+		assert.Equal(t, int64(manager.ID), published[2].ActorID)
+		assert.Equal(t, tech.OrganizationID, published[2].OrganizationID)
+
+		var data events.TaskData
+		assert.NoError(t, json.Unmarshal(published[1].Data, &data))
+		assert.Equal(t, created.ID, data.ID)
+		assert.Equal(t, "Updated memory task", data.Summary)
+		assert.Equal(t, int64(tech.ID), data.TechnicianID)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// maxReasonLength bounds the free-text reason of a status transition
+const maxReasonLength = 500
+
+// transitionRequest is the body of POST /tasks/{id}/transitions
+type transitionRequest struct {
+	Status models.TaskStatus `json:"status"`
+	Reason string            `json:"reason"`
+}
+
+// TransitionTask moves a task to another status of its workflow. Technicians
+// may only move their own tasks and only managers may cancel. Tasks the
+// subject can not read are reported as not found.
+func (h *TaskHandler) TransitionTask(w http.ResponseWriter, r *http.Request) {
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return
+	}
+
+	var req transitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Status.Valid() {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxReasonLength {
+		http.Error(w, fmt.Sprintf("Reason must not exceed %d characters", maxReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	// Tasks the subject cannot see are not found, only visible tasks they may
+	// not move are forbidden
+	taskID := mux.Vars(r)["id"]
+	if _, ok := readableTask(w, r, h.tasks, h.authorizer, subject, taskID); !ok {
+		return
+	}
+	task, err := h.tasks.Get(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !h.authorizer.CanTransitionTask(subject, task.TechnicianID, req.Status) {
+		if req.Status == models.StatusCancelled && !h.authorizer.Allows(subject, models.PermissionTaskCancel) {
+			http.Error(w, "Only managers can cancel tasks", http.StatusForbidden)
+		} else {
+			http.Error(w, "Unauthorized to modify this task", http.StatusForbidden)
+		}
+		return
+	}
+	if !task.Status.CanTransitionTo(req.Status) {
+		http.Error(w, fmt.Sprintf("Cannot transition task from %s to %s", task.Status, req.Status), http.StatusConflict)
+		return
+	}
+
+	transition := models.TaskTransition{
+		TaskID:  taskID,
+		From:    task.Status,
+		To:      req.Status,
+		ActorID: subject.UserID,
+		Reason:  req.Reason,
+	}
+	err = h.tasks.Transition(r.Context(), &transition)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrConflict) {
+		// Another request moved the task between our read and the update
+		http.Error(w, "Task status changed concurrently, retry", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(transition); err != nil {
+		log.Printf("Error encoding transition: %v", err)
+	}
+}
+
+// ListTransitions returns the status history of a task, oldest first.
+// Technicians only see the history of their own tasks.
+func (h *TaskHandler) ListTransitions(w http.ResponseWriter, r *http.Request) {
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.authorizer.Allows(subject, models.PermissionTaskReadOwn) {
+		http.Error(w, "Unauthorized role", http.StatusForbidden)
+		return
+	}
+
+	taskID := mux.Vars(r)["id"]
+	ownerID, err := h.tasks.Owner(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !h.authorizer.CanReadTask(subject, ownerID) {
+		// Do not reveal that another technician's task exists
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	transitions, err := h.tasks.Transitions(r.Context(), taskID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(transitions); err != nil {
+		log.Printf("Error encoding transitions: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitionTask(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+
+	// The manager manages the technician's team
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	assert.NoError(t, users.Create(ctx, &manager))
+	teams := repository.NewMemoryTeamRepository(users)
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(ctx, &team))
+	for _, member := range []models.TeamMember{
+		{TeamID: team.ID, UserID: tech.ID, Role: models.TeamRoleMember},
+		{TeamID: team.ID, UserID: manager.ID, Role: models.TeamRoleManager},
+	} {
+		assert.NoError(t, teams.SetMember(ctx, &member))
+	}
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	handler := NewTaskHandler(tasks, WithTeams(teams))
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Summary: "Inspect the boiler",
+		PerformedAt: time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC), Status: models.StatusScheduled}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	transition := func(userID int, role models.Role, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/tasks/task1/transitions", bytes.NewBufferString(body))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(reqCtx), map[string]string{"id": "task1"})
+		rr := httptest.NewRecorder()
+		handler.TransitionTask(rr, req)
+		return rr
+	}
+
+	t.Run("invalid body", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, transition(int(tech.ID), models.RoleTechnician, `{"status":"done"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, transition(int(tech.ID), models.RoleTechnician, `not json`).Code)
+	})
+
+	t.Run("another technician does not see the task", func(t *testing.T) {
+		rr := transition(42, models.RoleTechnician, `{"status":"in_progress"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("technician cannot cancel", func(t *testing.T) {
+		rr := transition(int(tech.ID), models.RoleTechnician, `{"status":"cancelled"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Only managers can cancel tasks")
+	})
+
+	t.Run("skipping a step is a conflict", func(t *testing.T) {
+		rr := transition(int(tech.ID), models.RoleTechnician, `{"status":"completed"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Cannot transition task from scheduled to completed")
+	})
+
+	t.Run("technician starts and completes their task", func(t *testing.T) {
+		rr := transition(int(tech.ID), models.RoleTechnician, `{"status":"in_progress"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var created models.TaskTransition
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		assert.Equal(t, models.StatusScheduled, created.From)
+		assert.Equal(t, models.StatusInProgress, created.To)
+		assert.Equal(t, int64(tech.ID), created.ActorID)
+
+		rr = transition(int(tech.ID), models.RoleTechnician, `{"status":"completed","reason":"Replaced the valve"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, 1, tasks.Outbox().Pending(models.OutboxNotifications), "completion notifies managers")
+	})
+
+	t.Run("manager of another team does not see the task", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, transition(99, models.RoleManager, `{"status":"reopened"}`).Code)
+	})
+
+	t.Run("manager reopens and cancels", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, transition(int(manager.ID), models.RoleManager, `{"status":"reopened"}`).Code)
+		assert.Equal(t, http.StatusCreated, transition(int(manager.ID), models.RoleManager, `{"status":"cancelled","reason":"Duplicate"}`).Code)
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/tasks/missing/transitions", bytes.NewBufferString(`{"status":"cancelled"}`))
+		reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, 99)
+		reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(models.RoleManager))
+		req = mux.SetURLVars(req.WithContext(reqCtx), map[string]string{"id": "missing"})
+		rr := httptest.NewRecorder()
+		handler.TransitionTask(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	// The events were queued with the transitions and are relayed from the outbox
+	publisher := events.NewInProcessPublisher()
+	var published []events.Envelope
+	publisher.Subscribe(func(event events.Envelope) {
+		published = append(published, event)
+	})
+	_, err := events.NewRelay(tasks.Outbox(), publisher, logger.New()).RelayPending(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, published, 5) {
+		assert.Equal(t, events.TypeTaskCreated, published[0].Type)
+		var data events.TaskTransitionedData
+		assert.NoError(t, json.Unmarshal(published[4].Data, &data))
+		assert.Equal(t, events.TypeTaskTransitioned, published[4].Type)
+		assert.Equal(t, "reopened", data.From)
+		assert.Equal(t, "cancelled", data.To)
+		assert.Equal(t, "Duplicate", data.Reason)
+		assert.Equal(t, int64(manager.ID), published[4].ActorID)
+	}
+
+	t.Run("history", func(t *testing.T) {
+		list := func(userID int, role models.Role) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/tasks/task1/transitions", nil)
+			reqCtx := context.WithValue(req.Context(), middleware.UserIDContextKey, userID)
+			reqCtx = context.WithValue(reqCtx, middleware.RoleContextKey, string(role))
+			req = mux.SetURLVars(req.WithContext(reqCtx), map[string]string{"id": "task1"})
+			rr := httptest.NewRecorder()
+			handler.ListTransitions(rr, req)
+			return rr
+		}
+
+		rr := list(int(tech.ID), models.RoleTechnician)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var history []models.TaskTransition
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+		if assert.Len(t, history, 5) {
+			assert.Equal(t, models.StatusScheduled, history[0].To)
+			assert.Equal(t, models.StatusCancelled, history[4].To)
+		}
+
+		assert.Equal(t, http.StatusOK, list(int(manager.ID), models.RoleManager).Code)
+		assert.Equal(t, http.StatusNotFound, list(99, models.RoleManager).Code)
+		assert.Equal(t, http.StatusNotFound, list(42, models.RoleTechnician).Code)
+	})
+}
+
+func TestCreateTaskInitialStatus(t *testing.T) {
+	users := repository.NewMemoryUserRepository()
+	handler := NewTaskHandler(repository.NewMemoryTaskRepository(users))
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/tasks", bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(models.RoleTechnician))
+		rr := httptest.NewRecorder()
+		handler.CreateTask(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := create(`{"summary":"Planned","performed_at":"2024-12-25T10:00:00Z","status":"scheduled"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"scheduled"`)
+
+	rr = create(`{"summary":"Recorded","performed_at":"2024-12-25T10:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"completed"`)
+
+	for _, status := range []string{"cancelled", "reopened", "done"} {
+		rr = create(`{"summary":"Bad","performed_at":"2024-12-25T10:00:00Z","status":"` + status + `"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, status)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+const maxTeamNameLength = 100
+
+// TeamHandler serves the team endpoints. Teams group technicians under the
+// managers who may see and handle their tasks.
+type TeamHandler struct {
+	teams repository.TeamRepository
+	users repository.UserRepository
+}
+
+func NewTeamHandler(teams repository.TeamRepository, users repository.UserRepository) *TeamHandler {
+	return &TeamHandler{
+		teams: teams,
+		users: users,
+	}
+}
+
+// teamRequest is the body of POST /teams and PUT /teams/{id}
+type teamRequest struct {
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// memberRequest is the body of PUT /teams/{id}/members/{user_id}
+type memberRequest struct {
+	Role models.TeamRole `json:"role"`
+}
+
+// TeamDetail is a team with its members, returned by GetTeam
+type TeamDetail struct {
+	models.Team
+	Members []models.TeamMember `json:"members"`
+}
+
+// ListTeams returns every team
+func (h *TeamHandler) ListTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := h.teams.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teams); err != nil {
+		log.Printf("Error encoding teams: %v", err)
+	}
+}
+
+// GetTeam returns a team and its members
+func (h *TeamHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.team(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.teams.Members(r.Context(), team.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(TeamDetail{Team: *team, Members: members}); err != nil {
+		log.Printf("Error encoding team: %v", err)
+	}
+}
+
+// CreateTeam creates a team, optionally nested under a parent team
+func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeTeam(w, r)
+	if !ok {
+		return
+	}
+
+	team := models.Team{Name: req.Name, ParentID: req.ParentID}
+	if !h.saveTeam(w, r, h.teams.Create(r.Context(), &team)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Team created successfully",
+		"id":      strconv.FormatInt(team.ID, 10),
+	})
+}
+
+// UpdateTeam renames a team or moves it under another parent. A team can not
+// be moved under itself or one of its sub-teams.
+func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.team(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeTeam(w, r)
+	if !ok {
+		return
+	}
+
+	if req.ParentID != nil {
+		cycle, err := h.createsCycle(r, team.ID, *req.ParentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if cycle {
+			http.Error(w, "A team can not be nested under itself or its sub-teams", http.StatusBadRequest)
+			return
+		}
+	}
+
+	team.Name = req.Name
+	team.ParentID = req.ParentID
+	if !h.saveTeam(w, r, h.teams.Update(r.Context(), team)) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Team updated successfully",
+		"id":      strconv.FormatInt(team.ID, 10),
+	})
+}
+
+// DeleteTeam removes a team without sub-teams. Its members keep their tasks.
+func (h *TeamHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := teamIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.teams.Delete(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrInUse) {
+		http.Error(w, "Team has sub-teams, move or delete them first", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Team deleted successfully",
+		"id":      strconv.FormatInt(id, 10),
+	})
+}
+
+// SetTeamMember adds a user to a team or changes their role in it. Only
+// users with the manager role can manage a team.
+func (h *TeamHandler) SetTeamMember(w http.ResponseWriter, r *http.Request) {
+	team, ok := h.team(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := memberIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req memberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		http.Error(w, "Invalid role. Must be either 'member' or 'manager'", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Role == models.TeamRoleManager && user.Role != models.RoleManager {
+		http.Error(w, "Only managers can manage a team", http.StatusBadRequest)
+		return
+	}
+
+	err = h.teams.SetMember(r.Context(), &models.TeamMember{TeamID: team.ID, UserID: userID, Role: req.Role})
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Team or user not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Team member saved successfully",
+		"id":      strconv.FormatUint(uint64(userID), 10),
+		"role":    string(req.Role),
+	})
+}
+
+// RemoveTeamMember removes a user from a team
+func (h *TeamHandler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	teamID, ok := teamIDParam(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := memberIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.teams.RemoveMember(r.Context(), teamID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Team member not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Team member removed successfully",
+		"id":      strconv.FormatUint(uint64(userID), 10),
+	})
+}
+
+// createsCycle reports whether nesting team id under parentID would make the
+// team its own ancestor
+func (h *TeamHandler) createsCycle(r *http.Request, id, parentID int64) (bool, error) {
+	teams, err := h.teams.List(r.Context())
+	if err != nil {
+		return false, err
+	}
+	parents := make(map[int64]*int64, len(teams))
+	for _, team := range teams {
+		parents[team.ID] = team.ParentID
+	}
+
+	// Walk up from the new parent, the number of steps bounds a stored cycle
+	current := &parentID
+	for steps := 0; current != nil && steps <= len(teams); steps++ {
+		if *current == id {
+			return true, nil
+		}
+		current = parents[*current]
+	}
+	return false, nil
+}
+
+// saveTeam maps the errors of creating or updating a team to a response
+func (h *TeamHandler) saveTeam(w http.ResponseWriter, r *http.Request, err error) bool {
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Team name already exists", http.StatusConflict)
+		return false
+	} else if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Parent team not found", http.StatusBadRequest)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (h *TeamHandler) team(w http.ResponseWriter, r *http.Request) (*models.Team, bool) {
+	id, ok := teamIDParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	team, err := h.teams.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return team, true
+}
+
+func decodeTeam(w http.ResponseWriter, r *http.Request) (*teamRequest, bool) {
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Name) > maxTeamNameLength {
+		http.Error(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+func teamIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func memberIDParam(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["user_id"], 10, 32)
+	if err != nil || id == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
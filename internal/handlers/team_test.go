@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	teams := repository.NewMemoryTeamRepository(users)
+	handler := NewTeamHandler(teams, users)
+
+	for _, user := range []models.User{
+		{Username: "admin", Role: models.RoleAdmin},
+		{Username: "manager1", Role: models.RoleManager},
+		{Username: "tech1", Role: models.RoleTechnician},
+	} {
+		assert.NoError(t, users.Create(ctx, &user))
+	}
+
+	serve := func(handle http.HandlerFunc, method, body string, role models.Role, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/teams", bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, 1)
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	team := func(id string) map[string]string { return map[string]string{"id": id} }
+	member := func(id, userID string) map[string]string { return map[string]string{"id": id, "user_id": userID} }
+
+	t.Run("only admins manage teams", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionTeamManage, handler.CreateTeam), "POST", `{"name":"Plant"}`, models.RoleManager, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Missing permission team:manage")
+
+		rr = serve(guarded(models.PermissionTeamRead, handler.ListTeams), "GET", "", models.RoleTechnician, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionTeamManage, handler.CreateTeam), "POST", `{"name":"Plant"}`, models.RoleAdmin, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		rr = serve(handler.CreateTeam, "POST", `{"name":"North crew","parent_id":1}`, models.RoleAdmin, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		tests := []struct {
+			name string
+			body string
+			code int
+		}{
+			{"missing name", `{"name":"  "}`, http.StatusBadRequest},
+			{"invalid body", `{`, http.StatusBadRequest},
+			{"taken name", `{"name":"Plant"}`, http.StatusConflict},
+			{"unknown parent", `{"name":"Orphan","parent_id":99}`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.code, serve(handler.CreateTeam, "POST", tt.body, models.RoleAdmin, nil).Code)
+			})
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		rr := serve(handler.UpdateTeam, "PUT", `{"name":"Plant","parent_id":2}`, models.RoleAdmin, team("1"))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "under itself or its sub-teams")
+		rr = serve(handler.UpdateTeam, "PUT", `{"name":"North crew","parent_id":2}`, models.RoleAdmin, team("2"))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(handler.UpdateTeam, "PUT", `{"name":"North","parent_id":1}`, models.RoleAdmin, team("2"))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		updated, _ := teams.Get(ctx, 2)
+		assert.Equal(t, "North", updated.Name)
+
+		assert.Equal(t, http.StatusNotFound, serve(handler.UpdateTeam, "PUT", `{"name":"Gone"}`, models.RoleAdmin, team("99")).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(handler.UpdateTeam, "PUT", `{"name":"Gone"}`, models.RoleAdmin, team("abc")).Code)
+	})
+
+	t.Run("members", func(t *testing.T) {
+		rr := serve(handler.SetTeamMember, "PUT", `{"role":"manager"}`, models.RoleAdmin, member("1", "2"))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(handler.SetTeamMember, "PUT", `{"role":"member"}`, models.RoleAdmin, member("2", "3"))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve(handler.SetTeamMember, "PUT", `{"role":"manager"}`, models.RoleAdmin, member("2", "3"))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Only managers can manage a team")
+		assert.Equal(t, http.StatusBadRequest, serve(handler.SetTeamMember, "PUT", `{"role":"owner"}`, models.RoleAdmin, member("2", "3")).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.SetTeamMember, "PUT", `{"role":"member"}`, models.RoleAdmin, member("2", "99")).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.SetTeamMember, "PUT", `{"role":"member"}`, models.RoleAdmin, member("99", "3")).Code)
+
+		// The manager of the plant manages the technician of its north crew
+		managed, err := teams.ManagedUsers(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{2, 3}, managed)
+
+		rr = serve(guarded(models.PermissionTeamRead, handler.GetTeam), "GET", "", models.RoleManager, team("2"))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var detail TeamDetail
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &detail))
+		assert.Equal(t, "North", detail.Name)
+		if assert.Len(t, detail.Members, 1) {
+			assert.Equal(t, "tech1", detail.Members[0].Username)
+		}
+
+		assert.Equal(t, http.StatusOK, serve(handler.RemoveTeamMember, "DELETE", "", models.RoleAdmin, member("2", "3")).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.RemoveTeamMember, "DELETE", "", models.RoleAdmin, member("2", "3")).Code)
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		rr := serve(handler.ListTeams, "GET", "", models.RoleManager, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var listed []models.Team
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+		assert.Len(t, listed, 2)
+
+		assert.Equal(t, http.StatusConflict, serve(handler.DeleteTeam, "DELETE", "", models.RoleAdmin, team("1")).Code)
+		assert.Equal(t, http.StatusOK, serve(handler.DeleteTeam, "DELETE", "", models.RoleAdmin, team("2")).Code)
+		assert.Equal(t, http.StatusOK, serve(handler.DeleteTeam, "DELETE", "", models.RoleAdmin, team("1")).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler.DeleteTeam, "DELETE", "", models.RoleAdmin, team("1")).Code)
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTenantIsolation drives the task endpoints through the auth middleware
+// with tokens of two organizations. Nothing of one organization may be read,
+// changed or deleted with a token of the other, whatever the role.
+func TestTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tasks := repository.NewMemoryTaskRepository(users)
+	assets := repository.NewMemoryAssetRepository(tasks)
+	teams := repository.NewMemoryTeamRepository(users)
+	keys := testKeySet(t)
+
+	const acme, globex = int64(1), int64(2)
+	newUser := func(orgID int64, username string, role models.Role) models.User {
+		user := models.User{OrganizationID: orgID, Username: username, Role: role}
+		assert.NoError(t, users.Create(ctx, &user))
+		return user
+	}
+	acmeTech := newUser(acme, "acme-tech", models.RoleTechnician)
+	acmeAdmin := newUser(acme, "acme-admin", models.RoleAdmin)
+	globexTech := newUser(globex, "globex-tech", models.RoleTechnician)
+	globexAdmin := newUser(globex, "globex-admin", models.RoleAdmin)
+
+	asset := models.Asset{SerialNumber: "PUMP-1", Type: "pump"}
+	assert.NoError(t, assets.Create(tenant.WithOrganization(ctx, acme), &asset))
+	task := models.Task{ID: "acme-task", TechnicianID: int64(acmeTech.ID), Summary: "Acme only",
+		Status: models.StatusScheduled, AssetID: &asset.ID, PerformedAt: time.Now()}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	authorizer := authz.Default()
+	permissions := middleware.NewPermissionMiddleware(authorizer)
+	authMiddleware := middleware.NewAuthMiddlewareHandler(&auth.JWTValidator{Keys: keys}, users)
+	taskHandler := NewTaskHandler(tasks, WithAssets(assets), WithTeams(teams), WithAuthorizer(authorizer))
+	assetHandler := NewAssetHandler(assets, tasks, teams, authorizer)
+
+	router := mux.NewRouter()
+	route := func(path, method string, permission models.Permission, handler http.HandlerFunc) {
+		router.HandleFunc(path, authMiddleware.AuthMiddleware(permissions.Require(permission, handler))).Methods(method)
+	}
+	route("/tasks", "POST", models.PermissionTaskCreate, taskHandler.CreateTask)
+	route("/tasks", "GET", models.PermissionTaskReadOwn, taskHandler.ListTasks)
+	route("/tasks/{id}", "PUT", models.PermissionTaskUpdateOwn, taskHandler.UpdateTask)
+	route("/tasks/{id}", "DELETE", models.PermissionTaskDeleteTeam, taskHandler.DeleteTask)
+	route("/tasks/{id}/transitions", "POST", models.PermissionTaskTransitionOwn, taskHandler.TransitionTask)
+	route("/tasks/{id}/transitions", "GET", models.PermissionTaskReadOwn, taskHandler.ListTransitions)
+	route("/assets/{id}/tasks", "GET", models.PermissionTaskReadOwn, assetHandler.ListAssetTasks)
+
+	serve := func(user models.User, method, target, body string) *httptest.ResponseRecorder {
+		token, _, err := keys.IssueAccessToken(user.ID, user.OrganizationID, string(user.Role), "", false)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	listed := func(rr *httptest.ResponseRecorder) []models.TaskWithTechnician {
+		var page repository.TaskPage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		return page.Tasks
+	}
+
+	for _, intruder := range []models.User{globexAdmin, globexTech} {
+		t.Run(string(intruder.Role)+" of another organization", func(t *testing.T) {
+			rr := serve(intruder, "GET", "/tasks", "")
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Empty(t, listed(rr))
+
+			rr = serve(intruder, "GET", "/tasks?technician_id=1", "")
+			if rr.Code == http.StatusOK {
+				assert.Empty(t, listed(rr))
+			}
+
+			for _, tt := range []struct {
+				method, target, body string
+				permission           models.Permission
+			}{
+				{"PUT", "/tasks/acme-task", `{"summary":"Hijacked","performed_at":"2025-01-01T00:00:00Z"}`, models.PermissionTaskUpdateOwn},
+				{"POST", "/tasks/acme-task/transitions", `{"status":"in_progress"}`, models.PermissionTaskTransitionOwn},
+				{"GET", "/tasks/acme-task/transitions", "", models.PermissionTaskReadOwn},
+				{"DELETE", "/tasks/acme-task", "", models.PermissionTaskDeleteTeam},
+				{"GET", "/assets/1/tasks", "", models.PermissionTaskReadOwn},
+			} {
+				// Roles without the permission are stopped before the lookup,
+				// the others find nothing
+				want := http.StatusNotFound
+				if !authorizer.Can(intruder.Role, tt.permission) {
+					want = http.StatusForbidden
+				}
+				rr := serve(intruder, tt.method, tt.target, tt.body)
+				assert.Equal(t, want, rr.Code, "%s %s", tt.method, tt.target)
+				assert.NotContains(t, rr.Body.String(), "Acme only")
+			}
+		})
+	}
+
+	t.Run("tasks can not reference an asset of another organization", func(t *testing.T) {
+		rr := serve(globexTech, "POST", "/tasks", `{"summary":"x","performed_at":"2025-01-01T00:00:00Z","asset_id":1}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Asset not found")
+	})
+
+	t.Run("the task is untouched", func(t *testing.T) {
+		stored, err := tasks.Get(ctx, "acme-task")
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme only", stored.Summary)
+		assert.Equal(t, models.StatusScheduled, stored.Status)
+	})
+
+	t.Run("a token naming another organization than the user's is rejected", func(t *testing.T) {
+		token, _, err := keys.IssueAccessToken(acmeTech.ID, globex, string(acmeTech.Role), "", false)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("GET", "/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("the own organization still sees the task", func(t *testing.T) {
+		rr := serve(acmeAdmin, "GET", "/tasks", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, listed(rr), 1)
+		assert.Equal(t, http.StatusOK, serve(acmeAdmin, "GET", "/assets/1/tasks", "").Code)
+		assert.Equal(t, http.StatusOK, serve(acmeAdmin, "DELETE", "/tasks/acme-task", "").Code)
+	})
+
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// UserHandler serves the user administration endpoints, admins only
+type UserHandler struct {
+	users  repository.UserRepository
+	tokens repository.TokenRepository
+
+	// Attempts, when set, is where UnlockUser lifts login lockouts
+	Attempts repository.LoginAttemptRepository
+}
+
+func NewUserHandler(users repository.UserRepository, tokens repository.TokenRepository) *UserHandler {
+	return &UserHandler{
+		users:  users,
+		tokens: tokens,
+	}
+}
+
+// UpdateRoleRequest is the body of UpdateUserRole
+type UpdateRoleRequest struct {
+	Role models.Role `json:"role"`
+}
+
+// ListUsers returns every user, active or not
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.users.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(users); err != nil {
+		log.Printf("Error encoding users: %v", err)
+	}
+}
+
+// GetUser returns a single user
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		log.Printf("Error encoding user: %v", err)
+	}
+}
+
+// UpdateUserRole changes the role of a user and signs them out so their next
+// token carries the new role
+func (h *UserHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.otherUserParam(w, r, "change your own role")
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid role. Must be one of 'technician', 'manager' or 'admin'", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		http.Error(w, "Role is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.users.UpdateRole(r.Context(), id, req.Role)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.signOut(r.Context(), id)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User role updated successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+		"role":    string(req.Role),
+	})
+}
+
+// DeactivateUser blocks a user from signing in and revokes their tokens,
+// keeping their tasks and history
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.otherUserParam(w, r, "deactivate yourself")
+	if !ok {
+		return
+	}
+	if !h.setActive(w, r, id, false) {
+		return
+	}
+	h.signOut(r.Context(), id)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User deactivated successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+// ReactivateUser lets a deactivated user sign in again
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if !h.setActive(w, r, id, true) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User reactivated successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+// UnlockUser lets a user locked out by repeated failed logins sign in again
+// right away. Lockouts of client addresses are left to expire.
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Attempts != nil {
+		if err := h.Attempts.Reset(r.Context(), models.UsernameAttemptKey(user.Username)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User unlocked successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+// SignOutUser signs a user out of every session, revoking their refresh and
+// access tokens. Their API keys are left alone, they are revoked on their own.
+func (h *UserHandler) SignOutUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Only users of the organization of the caller can be signed out
+	if _, err := h.users.GetByID(r.Context(), id); errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.tokens.RevokeUser(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User signed out of every session",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+// DeleteUser removes a user without tasks or schedules, others have to be
+// deactivated to keep the maintenance history intact
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.otherUserParam(w, r, "delete yourself")
+	if !ok {
+		return
+	}
+
+	err := h.users.Delete(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrInUse) {
+		http.Error(w, "User has tasks or schedules, deactivate it instead", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.signOut(r.Context(), id)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User deleted successfully",
+		"id":      strconv.FormatUint(uint64(id), 10),
+	})
+}
+
+func (h *UserHandler) setActive(w http.ResponseWriter, r *http.Request, id uint, active bool) bool {
+	err := h.users.SetActive(r.Context(), id, active)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// signOut revokes every token of the user. Failures are only logged, the
+// auth middleware rejects deactivated users regardless.
+func (h *UserHandler) signOut(ctx context.Context, id uint) {
+	if err := h.tokens.RevokeUser(ctx, id); err != nil {
+		log.Printf("Error revoking tokens of user %d: %v", id, err)
+	}
+}
+
+// otherUserParam parses the user ID of the path and rejects the caller's own
+// ID, so an admin can not lock themselves out
+func (h *UserHandler) otherUserParam(w http.ResponseWriter, r *http.Request, action string) (uint, bool) {
+	subject, ok := requestSubject(w, r)
+	if !ok {
+		return 0, false
+	}
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return 0, false
+	}
+	if int64(id) == subject.UserID {
+		http.Error(w, "You can not "+action, http.StatusForbidden)
+		return 0, false
+	}
+	return id, true
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil || id == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
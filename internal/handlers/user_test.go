@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserHandler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tasks := repository.NewMemoryTaskRepository(users)
+	tokens := repository.NewMemoryTokenRepository()
+	keys := testKeySet(t)
+	authHandler := NewAuthHandler(users, tokens, repository.NewMemoryInvitationRepository(users), keys)
+	handler := NewUserHandler(users, tokens)
+
+	admin := models.User{Username: "admin", Role: models.RoleAdmin}
+	assert.NoError(t, users.Create(ctx, &admin))
+	login := loginAs(t, authHandler, users, "tech1")
+	tech, _ := users.GetByUsername(ctx, "tech1")
+	techID := map[string]string{"id": "2"}
+
+	serve := func(handle http.HandlerFunc, method, target, body string, role models.Role, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, int(admin.ID))
+		ctx = context.WithValue(ctx, middleware.RoleContextKey, string(role))
+		req = mux.SetURLVars(req.WithContext(ctx), vars)
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	t.Run("only admins manage users", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionUserManage, handler.ListUsers), "GET", "/users", "", models.RoleManager, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Missing permission user:manage")
+	})
+
+	t.Run("list and get", func(t *testing.T) {
+		rr := serve(guarded(models.PermissionUserManage, handler.ListUsers), "GET", "/users", "", models.RoleAdmin, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "password")
+		var listed []models.User
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+		assert.Len(t, listed, 2)
+
+		rr = serve(handler.GetUser, "GET", "/users/2", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var user models.User
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &user))
+		assert.Equal(t, "tech1", user.Username)
+		assert.True(t, user.Active)
+
+		rr = serve(handler.GetUser, "GET", "/users/99", "", models.RoleAdmin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = serve(handler.GetUser, "GET", "/users/abc", "", models.RoleAdmin, map[string]string{"id": "abc"})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("update role", func(t *testing.T) {
+		rr := serve(handler.UpdateUserRole, "PUT", "/users/2/role", `{"role":"owner"}`, models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(handler.UpdateUserRole, "PUT", "/users/1/role", `{"role":"technician"}`, models.RoleAdmin, map[string]string{"id": "1"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "You can not change your own role")
+
+		rr = serve(handler.UpdateUserRole, "PUT", "/users/2/role", `{"role":"manager"}`, models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		user, _ := users.GetByID(ctx, tech.ID)
+		assert.Equal(t, models.RoleManager, user.Role)
+
+		// The token carrying the old role is revoked
+		_, err := (&auth.JWTValidator{Keys: keys, Revocations: tokens}).ValidateToken(login.Token)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+		assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, login.RefreshToken).Code)
+	})
+
+	t.Run("deactivate and reactivate", func(t *testing.T) {
+		login := loginAs(t, authHandler, users, "tech1")
+
+		rr := serve(handler.DeactivateUser, "POST", "/users/1/deactivate", "", models.RoleAdmin, map[string]string{"id": "1"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.DeactivateUser, "POST", "/users/2/deactivate", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// Deactivated users can neither use their token nor sign in
+		validator := &auth.JWTValidator{Keys: keys, Revocations: tokens}
+		protected := middleware.NewAuthMiddlewareHandler(validator, users).AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+		req := httptest.NewRequest("GET", "/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+login.Token)
+		rr = httptest.NewRecorder()
+		protected(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		body, _ := json.Marshal(map[string]string{"username": "tech1", "password": "secret"})
+		rr = httptest.NewRecorder()
+		authHandler.Login(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(body)))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.ReactivateUser, "POST", "/users/2/reactivate", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		loginAs(t, authHandler, users, "tech1")
+
+		rr = serve(handler.ReactivateUser, "POST", "/users/99/reactivate", "", models.RoleAdmin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		attempts := repository.NewMemoryLoginAttemptRepository()
+		handler.Attempts = attempts
+		defer func() { handler.Attempts = nil }()
+		key := models.UsernameAttemptKey(tech.Username)
+		assert.NoError(t, attempts.RecordFailure(ctx, key, time.Now(), time.Hour))
+
+		rr := serve(guarded(models.PermissionUserManage, handler.UnlockUser), "POST", "/users/2/unlock", "", models.RoleManager, techID)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.UnlockUser, "POST", "/users/2/unlock", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		_, err := attempts.Get(ctx, key)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		rr = serve(handler.UnlockUser, "POST", "/users/99/unlock", "", models.RoleAdmin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("sign out everywhere", func(t *testing.T) {
+		laptop := loginAs(t, authHandler, users, "tech1")
+		phone := loginAs(t, authHandler, users, "tech1")
+
+		rr := serve(guarded(models.PermissionUserManage, handler.SignOutUser), "POST", "/users/2/sign-out", "", models.RoleManager, techID)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(handler.SignOutUser, "POST", "/users/2/sign-out", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for _, login := range []TokenResponse{laptop, phone} {
+			assert.Equal(t, http.StatusUnauthorized, refresh(authHandler, login.RefreshToken).Code)
+		}
+		sessions, err := tokens.ListSessions(ctx, tech.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		rr = serve(handler.SignOutUser, "POST", "/users/99/sign-out", "", models.RoleAdmin, map[string]string{"id": "99"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task-1", TechnicianID: int64(tech.ID), PerformedAt: time.Now()}, int64(tech.ID)))
+
+		rr := serve(handler.DeleteUser, "DELETE", "/users/2", "", models.RoleAdmin, techID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "deactivate it instead")
+
+		idle := models.User{Username: "idle", Role: models.RoleTechnician}
+		assert.NoError(t, users.Create(ctx, &idle))
+		rr = serve(handler.DeleteUser, "DELETE", "/users/3", "", models.RoleAdmin, map[string]string{"id": "3"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(handler.DeleteUser, "DELETE", "/users/3", "", models.RoleAdmin, map[string]string{"id": "3"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
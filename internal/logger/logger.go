@@ -2,13 +2,13 @@ package logger
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/config"
 )
 
 type Logger struct {
@@ -33,18 +33,30 @@ type LogFields struct {
 }
 
 func New() *Logger {
+	return NewFromConfig(config.Log{Level: "info", Format: "json"})
+}
+
+// NewFromConfig creates a logger writing to stdout with the configured level and format
+func NewFromConfig(cfg config.Log) *Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 	}
 
-	handler := slog.NewJSONHandler(os.Stdout, opts)
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
 	logger := slog.New(handler)
 
 	return &Logger{logger}
 }
 
 func (l *Logger) WithFields(fields LogFields) *Logger {
-	attrs := []slog.Attr{
+	attrs := []any{
 		slog.String("timestamp", time.Now().UTC().Format(time.RFC3339)),
 	}
 
@@ -70,7 +82,7 @@ func (l *Logger) WithFields(fields LogFields) *Logger {
 		attrs = append(attrs, slog.String("error", fields.Error))
 	}
 
-	return &Logger{l.WithAttrs(attrs)}
+	return &Logger{l.With(attrs...)}
 }
 
 func (l *Logger) WithContext(ctx context.Context) *Logger {
@@ -151,12 +163,10 @@ type Metrics struct {
 }
 
 func (l *Logger) LogMetrics(metrics Metrics) {
-	fields := LogFields{
-		"requests_total":     metrics.RequestsTotal,
-		"request_duration":   metrics.RequestDuration.String(),
-		"errors_total":       metrics.ErrorsTotal,
-		"active_connections": metrics.ActiveConnections,
-	}
-
-	l.WithFields(fields).Info("application_metrics")
+	l.Info("application_metrics",
+		slog.Int64("requests_total", metrics.RequestsTotal),
+		slog.String("request_duration", metrics.RequestDuration.String()),
+		slog.Int64("errors_total", metrics.ErrorsTotal),
+		slog.Int64("active_connections", metrics.ActiveConnections),
+	)
 }
\ No newline at end of file
@@ -59,6 +59,23 @@ var (
 		},
 	)
 
+	// Event metrics
+	eventsPublished = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Total number of task lifecycle events published",
+		},
+		[]string{"type", "status"},
+	)
+
+	eventPublishRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_publish_retries_total",
+			Help: "Total number of retried event publishes",
+		},
+		[]string{"type"},
+	)
+
 	// Database metrics
 	dbConnections = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -163,6 +180,20 @@ func RecordAuthAttempt(method string, success bool) {
 	authAttempts.WithLabelValues(method, status).Inc()
 }
 
+// RecordEventPublished records the final outcome of publishing an event
+func RecordEventPublished(eventType string, success bool) {
+	status := "success"
+	if !success {
+		status = "failure"
+	}
+	eventsPublished.WithLabelValues(eventType, status).Inc()
+}
+
+// RecordEventPublishRetry records a retried event publish
+func RecordEventPublishRetry(eventType string) {
+	eventPublishRetries.WithLabelValues(eventType).Inc()
+}
+
 // RecordDBQuery records database query metrics
 func RecordDBQuery(operation, table string, duration time.Duration) {
 	dbQueryDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
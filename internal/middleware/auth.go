@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
 )
 
 const (
@@ -13,17 +16,49 @@ const (
 	roleContextKey   contextKey = "role"
 )
 
+// UserStatusChecker reports whether the user a token was issued to may still
+// use the API
+type UserStatusChecker interface {
+	IsActive(ctx context.Context, userID uint) (bool, error)
+}
+
 type AuthMiddlewareHandler struct {
 	validator auth.TokenValidator
+	users     UserStatusChecker
+
+	// MFARequiredRoles are the roles whose tokens are only accepted when the
+	// login used a second factor, except by MFAEnrolmentMiddleware
+	MFARequiredRoles map[string]bool
 }
 
-func NewAuthMiddlewareHandler(validator auth.TokenValidator) *AuthMiddlewareHandler {
+// NewAuthMiddlewareHandler creates the middleware, users may be nil to skip
+// the check for deactivated accounts
+func NewAuthMiddlewareHandler(validator auth.TokenValidator, users UserStatusChecker) *AuthMiddlewareHandler {
 	return &AuthMiddlewareHandler{
 		validator: validator,
+		users:     users,
 	}
 }
 
+// AuthMiddleware accepts access tokens and API keys
 func (h *AuthMiddlewareHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.authenticate(next, false, true)
+}
+
+// SessionMiddleware is AuthMiddleware for the routes that manage the account
+// itself, such as its password and API keys, it refuses API keys
+func (h *AuthMiddlewareHandler) SessionMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.authenticate(next, false, false)
+}
+
+// MFAEnrolmentMiddleware is SessionMiddleware for the routes a user whose role
+// requires two-factor authentication needs to set it up, it also accepts
+// their tokens from logins without a second factor
+func (h *AuthMiddlewareHandler) MFAEnrolmentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.authenticate(next, true, false)
+}
+
+func (h *AuthMiddlewareHandler) authenticate(next http.HandlerFunc, withoutMFA, apiKeys bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -38,13 +73,58 @@ func (h *AuthMiddlewareHandler) AuthMiddleware(next http.HandlerFunc) http.Handl
 		}
 
 		claims, err := h.validator.ValidateToken(bearerToken[1])
+		if errors.Is(err, auth.ErrSessionTerminated) {
+			http.Error(w, "Session has been terminated", http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
+		isAPIKey := claims.APIKeyID != 0
+		if isAPIKey && !apiKeys {
+			http.Error(w, "API keys are not accepted here", http.StatusForbidden)
+			return
+		}
+		// API keys are created from sessions that already passed the second factor
+		if !withoutMFA && !isAPIKey && !claims.MFA && h.MFARequiredRoles[claims.Role] {
+			http.Error(w, "Two-factor authentication required", http.StatusForbidden)
+			return
+		}
+
+		// Repositories limit every query of the request to the organization
+		// of the user, including the account check below
+		ctx := tenant.WithOrganization(r.Context(), claims.OrgID)
 
-		ctx := context.WithValue(r.Context(), userIDContextKey, int(claims.UserID))
+		// Tokens stay valid until they expire, so deactivation is checked on every request
+		if h.users != nil {
+			active, err := h.users.IsActive(ctx, claims.UserID)
+			if err != nil {
+				http.Error(w, "Error checking account status", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "Account is deactivated", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, userIDContextKey, int(claims.UserID))
 		ctx = context.WithValue(ctx, roleContextKey, claims.Role)
+		ctx = context.WithValue(ctx, TokenIDContextKey, claims.ID)
+		if claims.SessionID != "" {
+			ctx = context.WithValue(ctx, SessionIDContextKey, claims.SessionID)
+		}
+		if claims.ExpiresAt != nil {
+			ctx = context.WithValue(ctx, TokenExpiryContextKey, claims.ExpiresAt.Time)
+		}
+		if isAPIKey {
+			permissions := make([]models.Permission, 0, len(claims.Permissions))
+			for _, permission := range claims.Permissions {
+				permissions = append(permissions, models.Permission(permission))
+			}
+			ctx = context.WithValue(ctx, PermissionsContextKey, permissions)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
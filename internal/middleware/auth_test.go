@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -75,12 +81,22 @@ func TestAuthMiddleware(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:         "Terminated session",
+			authHeader:   "Bearer signed-out-token",
+			expectedCode: http.StatusUnauthorized,
+			validator: &MockTokenValidator{
+				validateFunc: func(token string) (*auth.Claims, error) {
+					return nil, auth.ErrSessionTerminated
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create middleware handler with the mock validator
-			middlewareHandler := NewAuthMiddlewareHandler(tt.validator)
+			middlewareHandler := NewAuthMiddlewareHandler(tt.validator, nil)
 
 			// Create a new request with the test case's authorization header
 			req := httptest.NewRequest("GET", "/", nil)
@@ -100,3 +116,165 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddlewareTokenContext(t *testing.T) {
+	expiresAt := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+	validator := &MockTokenValidator{
+		validateFunc: func(token string) (*auth.Claims, error) {
+			return &auth.Claims{
+				UserID:    123,
+				OrgID:     2,
+				Role:      "technician",
+				SessionID: "session-id",
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:        "token-id",
+					ExpiresAt: jwt.NewNumericDate(expiresAt),
+				},
+			}, nil
+		},
+	}
+
+	var tokenID, sessionID string
+	var tokenExpiry time.Time
+	var orgID int64
+	handler := NewAuthMiddlewareHandler(validator, nil).AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		tokenID, _ = r.Context().Value(TokenIDContextKey).(string)
+		sessionID, _ = r.Context().Value(SessionIDContextKey).(string)
+		tokenExpiry, _ = r.Context().Value(TokenExpiryContextKey).(time.Time)
+		orgID, _ = tenant.Organization(r.Context())
+	})
+
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "token-id", tokenID)
+	assert.Equal(t, "session-id", sessionID)
+	assert.True(t, expiresAt.Equal(tokenExpiry))
+	assert.Equal(t, int64(2), orgID)
+}
+
+// staticUsers implements UserStatusChecker over a fixed set of active users
+type staticUsers map[uint]bool
+
+func (u staticUsers) IsActive(ctx context.Context, userID uint) (bool, error) {
+	if userID == 0 {
+		return false, errors.New("database unavailable")
+	}
+	return u[userID], nil
+}
+
+func TestAuthMiddlewareDeactivatedUser(t *testing.T) {
+	users := staticUsers{1: true, 2: false}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		userID       uint
+		expectedCode int
+		expectedBody string
+	}{
+		{"active user", 1, http.StatusOK, ""},
+		{"deactivated user", 2, http.StatusUnauthorized, "Account is deactivated\n"},
+		{"deleted user", 3, http.StatusUnauthorized, "Account is deactivated\n"},
+		{"lookup error", 0, http.StatusInternalServerError, "Error checking account status\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &MockTokenValidator{
+				validateFunc: func(token string) (*auth.Claims, error) {
+					return &auth.Claims{UserID: tt.userID, Role: "technician"}, nil
+				},
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rr := httptest.NewRecorder()
+			NewAuthMiddlewareHandler(validator, users).AuthMiddleware(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareMFARequired(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		role         string
+		mfa          bool
+		enrolment    bool
+		expectedCode int
+	}{
+		{"required role with mfa", "admin", true, false, http.StatusOK},
+		{"required role without mfa", "admin", false, false, http.StatusForbidden},
+		{"required role enrolling", "admin", false, true, http.StatusOK},
+		{"other role without mfa", "technician", false, false, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &MockTokenValidator{
+				validateFunc: func(token string) (*auth.Claims, error) {
+					return &auth.Claims{UserID: 1, Role: tt.role, MFA: tt.mfa}, nil
+				},
+			}
+			middleware := NewAuthMiddlewareHandler(validator, nil)
+			middleware.MFARequiredRoles = map[string]bool{"admin": true}
+
+			handler := middleware.AuthMiddleware(next)
+			if tt.enrolment {
+				handler = middleware.MFAEnrolmentMiddleware(next)
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer valid-token")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedCode == http.StatusForbidden {
+				assert.Equal(t, "Two-factor authentication required\n", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareAPIKey(t *testing.T) {
+	validator := &MockTokenValidator{
+		validateFunc: func(token string) (*auth.Claims, error) {
+			return &auth.Claims{UserID: 1, Role: "admin", APIKeyID: 4, Permissions: []string{"task:read:any"}}, nil
+		},
+	}
+	middleware := NewAuthMiddlewareHandler(validator, nil)
+	middleware.MFARequiredRoles = map[string]bool{"admin": true}
+
+	var scopes []models.Permission
+	next := func(w http.ResponseWriter, r *http.Request) {
+		scopes, _ = r.Context().Value(PermissionsContextKey).([]models.Permission)
+		w.WriteHeader(http.StatusOK)
+	}
+	serve := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer mapi_key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Keys skip the second factor check and carry their permissions
+	rr := serve(middleware.AuthMiddleware(next))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []models.Permission{models.PermissionTaskReadAny}, scopes)
+
+	for _, handler := range []http.HandlerFunc{middleware.SessionMiddleware(next), middleware.MFAEnrolmentMiddleware(next)} {
+		rr := serve(handler)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Equal(t, "API keys are not accepted here\n", rr.Body.String())
+	}
+}
@@ -6,4 +6,14 @@ type contextKey string
 const (
 	UserIDContextKey contextKey = "userID"
 	RoleContextKey   contextKey = "role"
+	// TokenIDContextKey holds the jti of the access token, empty for tokens issued without one
+	TokenIDContextKey contextKey = "tokenID"
+	// TokenExpiryContextKey holds the expiry of the access token as a time.Time
+	TokenExpiryContextKey contextKey = "tokenExpiry"
+	// SessionIDContextKey holds the session of the access token, it is not set
+	// for API keys and tokens issued without one
+	SessionIDContextKey contextKey = "sessionID"
+	// PermissionsContextKey holds the []models.Permission an API key is limited
+	// to, it is not set for access tokens
+	PermissionsContextKey contextKey = "permissions"
 )
@@ -1,11 +1,10 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 	"time"
 
-	"github.com/your-username/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/logger"
 )
 
 type loggingResponseWriter struct {
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// PermissionMiddleware guards routes with the permissions of the caller's role
+type PermissionMiddleware struct {
+	authorizer *authz.Authorizer
+}
+
+func NewPermissionMiddleware(authorizer *authz.Authorizer) *PermissionMiddleware {
+	return &PermissionMiddleware{
+		authorizer: authorizer,
+	}
+}
+
+// Require answers 403 unless the role of the authenticated user holds the
+// permission and, for API keys, the key was granted it. It must be wrapped by
+// AuthMiddleware.
+func (m *PermissionMiddleware) Require(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role, ok := r.Context().Value(RoleContextKey).(string)
+		if !ok {
+			http.Error(w, "Unable to get role from context", http.StatusInternalServerError)
+			return
+		}
+		scopes, _ := r.Context().Value(PermissionsContextKey).([]models.Permission)
+		if !m.authorizer.Allows(authz.Subject{Role: models.Role(role), Scopes: scopes}, permission) {
+			http.Error(w, fmt.Sprintf("Missing permission %s", permission), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
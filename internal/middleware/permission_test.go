@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequire(t *testing.T) {
+	permissions := NewPermissionMiddleware(authz.Default())
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	serve := func(permission models.Permission, role interface{}, scopes []models.Permission) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if role != nil {
+			req = req.WithContext(context.WithValue(req.Context(), RoleContextKey, role))
+		}
+		if scopes != nil {
+			req = req.WithContext(context.WithValue(req.Context(), PermissionsContextKey, scopes))
+		}
+		rr := httptest.NewRecorder()
+		permissions.Require(permission, next)(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		permission models.Permission
+		role       interface{}
+		scopes     []models.Permission
+		wantCode   int
+	}{
+		{"granted", models.PermissionTaskCreate, "technician", nil, http.StatusNoContent},
+		{"granted through the any variant", models.PermissionTaskReadOwn, "manager", nil, http.StatusNoContent},
+		{"not granted", models.PermissionTaskDeleteTeam, "technician", nil, http.StatusForbidden},
+		{"unknown role", models.PermissionAssetRead, "guest", nil, http.StatusForbidden},
+		{"missing role", models.PermissionAssetRead, nil, nil, http.StatusInternalServerError},
+		{"granted to the API key", models.PermissionAssetRead, "technician", []models.Permission{models.PermissionAssetRead}, http.StatusNoContent},
+		{"not granted to the API key", models.PermissionTaskCreate, "technician", []models.Permission{models.PermissionAssetRead}, http.StatusForbidden},
+		{"granted to the API key but not the role", models.PermissionUserManage, "technician", []models.Permission{models.PermissionUserManage}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.permission, tt.role, tt.scopes)
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode == http.StatusForbidden {
+				assert.Contains(t, rr.Body.String(), string(tt.permission))
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"0002_create_tasks.up.sql":   {Data: []byte("CREATE TABLE tasks (id INT);\nCREATE INDEX idx ON tasks (id);")},
+	"0002_create_tasks.down.sql": {Data: []byte("DROP TABLE tasks;")},
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT GET_LOCK").
+		WithArgs(lockName).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+}
+
+func expectApplied(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(rows)
+}
+
+func appliedRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"version", "checksum", "applied_at"})
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted by version with checksums", func(t *testing.T) {
+		migrations, err := Load(testMigrations)
+		assert.NoError(t, err)
+		assert.Len(t, migrations, 2)
+		assert.Equal(t, 1, migrations[0].Version)
+		assert.Equal(t, "create_users", migrations[0].Name)
+		assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+		assert.Equal(t, checksum("CREATE TABLE users (id INT);"), migrations[0].Checksum)
+		assert.Equal(t, 2, migrations[1].Version)
+	})
+
+	t.Run("invalid file name", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"create_users.sql": {Data: []byte("SELECT 1")}})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing up file", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"0001_users.down.sql": {Data: []byte("DROP TABLE users")}})
+		assert.Error(t, err)
+	})
+
+	t.Run("embedded migrations", func(t *testing.T) {
+		migrator, err := New(nil)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, migrator.Migrations())
+		for i, migration := range migrator.Migrations() {
+			assert.Equal(t, i+1, migration.Version, "migration versions must be contiguous")
+			assert.NotEmpty(t, SplitStatements(migration.Up), "migration %d_%s has no statements", migration.Version, migration.Name)
+			assert.NotEmpty(t, strings.TrimSpace(migration.Down), "migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- leading comment
+CREATE TABLE a (note VARCHAR(10) DEFAULT 'x;y');
+/* block; comment */
+INSERT INTO a VALUES ('it\'s; fine');
+# hash comment;
+`
+	statements := SplitStatements(script)
+	assert.Equal(t, []string{
+		"CREATE TABLE a (note VARCHAR(10) DEFAULT 'x;y')",
+		"INSERT INTO a VALUES ('it\\'s; fine')",
+	}, statements)
+
+	assert.Empty(t, SplitStatements("-- only a comment\n"))
+}
+
+func TestUp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies pending migrations", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+		first := migrator.Migrations()[0]
+
+		expectLock(mock)
+		expectApplied(mock, appliedRows().AddRow(1, first.Checksum, "2025-01-01 10:00:00"))
+		mock.ExpectExec("CREATE TABLE tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE INDEX idx ON tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(2, "create_tasks", migrator.Migrations()[1].Checksum).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		applied, err := migrator.Up(ctx, false)
+		assert.NoError(t, err)
+		assert.Len(t, applied, 1)
+		assert.Equal(t, 2, applied[0].Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failure returns only the completed migrations", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+
+		expectLock(mock)
+		expectApplied(mock, appliedRows())
+		mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(1, "create_users", migrator.Migrations()[0].Checksum).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("CREATE TABLE tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE INDEX idx ON tasks").WillReturnError(errors.New("duplicate key name"))
+		mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		applied, err := migrator.Up(ctx, false)
+		assert.ErrorContains(t, err, "applying migration 2_create_tasks")
+		if assert.Len(t, applied, 1) {
+			assert.Equal(t, 1, applied[0].Version)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dry run executes nothing", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+
+		expectLock(mock)
+		expectApplied(mock, appliedRows())
+		mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		pending, err := migrator.Up(ctx, true)
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+
+		expectLock(mock)
+		expectApplied(mock, appliedRows().AddRow(1, "edited", "2025-01-01 10:00:00"))
+		mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err = migrator.Up(ctx, false)
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+
+	t.Run("unknown applied migration", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+
+		expectLock(mock)
+		expectApplied(mock, appliedRows().AddRow(99, "whatever", "2025-01-01 10:00:00"))
+		mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err = migrator.Up(ctx, false)
+		assert.ErrorIs(t, err, ErrUnknownMigration)
+	})
+
+	t.Run("lock held by another process", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		migrator, err := NewFromFS(db, testMigrations)
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT GET_LOCK").
+			WithArgs(lockName).
+			WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+		_, err = migrator.Up(ctx, false)
+		assert.ErrorIs(t, err, ErrLocked)
+	})
+}
+
+func TestDown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := NewFromFS(db, testMigrations)
+	assert.NoError(t, err)
+	migrations := migrator.Migrations()
+
+	expectLock(mock)
+	expectApplied(mock, appliedRows().
+		AddRow(1, migrations[0].Checksum, "2025-01-01 10:00:00").
+		AddRow(2, migrations[1].Checksum, "2025-01-01 10:00:00"))
+	mock.ExpectExec("DROP TABLE tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations WHERE version = ?").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rolledBack, err := migrator.Down(context.Background(), 1, false)
+	assert.NoError(t, err)
+	assert.Len(t, rolledBack, 1)
+	assert.Equal(t, 2, rolledBack[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := NewFromFS(db, testMigrations)
+	assert.NoError(t, err)
+	migrations := migrator.Migrations()
+
+	expectLock(mock)
+	expectApplied(mock, appliedRows().
+		AddRow(1, migrations[0].Checksum, "2025-01-01 10:00:00").
+		AddRow(2, migrations[1].Checksum, "2025-01-01 10:00:00"))
+	mock.ExpectExec("DROP TABLE tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations WHERE version = ?").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DROP TABLE users").WillReturnError(errors.New("table is referenced"))
+	mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rolledBack, err := migrator.Down(context.Background(), 2, false)
+	assert.ErrorContains(t, err, "rolling back migration 1_create_users")
+	if assert.Len(t, rolledBack, 1) {
+		assert.Equal(t, 2, rolledBack[0].Version)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownWithoutDownFile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := NewFromFS(db, fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_seed_users.up.sql":     {Data: []byte("INSERT INTO users VALUES (1);")},
+	})
+	assert.NoError(t, err)
+	migrations := migrator.Migrations()
+
+	expectLock(mock)
+	expectApplied(mock, appliedRows().
+		AddRow(1, migrations[0].Checksum, "2025-01-01 10:00:00").
+		AddRow(2, migrations[1].Checksum, "2025-01-01 10:00:00"))
+	mock.ExpectExec("SELECT RELEASE_LOCK").WithArgs(lockName).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Nothing is run and schema_migrations is left alone
+	rolledBack, err := migrator.Down(context.Background(), 2, false)
+	assert.ErrorContains(t, err, "migration 2_seed_users has no down file")
+	assert.Empty(t, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := NewFromFS(db, testMigrations)
+	assert.NoError(t, err)
+
+	expectApplied(mock, appliedRows().AddRow(1, "edited", "2025-01-01 10:00:00"))
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.True(t, statuses[0].Modified)
+	assert.Equal(t, 2025, statuses[0].AppliedAt.Year())
+	assert.False(t, statuses[1].Applied)
+}
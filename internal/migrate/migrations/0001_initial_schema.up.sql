@@ -0,0 +1,24 @@
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    username   VARCHAR(255) NOT NULL,
+    password   VARCHAR(255) NOT NULL,
+    role       ENUM ('manager', 'technician') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT username UNIQUE (username)
+);
+
+-- Tasks table
+CREATE TABLE IF NOT EXISTS tasks (
+    id            VARCHAR(36) PRIMARY KEY,
+    summary       TEXT NULL,
+    performed_at  TIMESTAMP NOT NULL,
+    technician_id INT NOT NULL,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT tasks_ibfk_1 FOREIGN KEY (technician_id) REFERENCES users (id),
+    CHECK (CHAR_LENGTH(summary) <= 2500),
+    INDEX idx_performed_at (performed_at),
+    INDEX idx_technician (technician_id)
+);
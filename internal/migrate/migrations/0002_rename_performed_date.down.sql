@@ -0,0 +1 @@
+-- Nothing to undo: performed_at is the column name the application expects.
@@ -0,0 +1,14 @@
+-- Databases created from the original db/init.sql named the column performed_date
+-- while the application always queried performed_at. Rename it when present.
+SET @rename_performed_date = (
+    SELECT IF(COUNT(*) > 0,
+              'ALTER TABLE tasks RENAME COLUMN performed_date TO performed_at',
+              'DO 0')
+    FROM information_schema.columns
+    WHERE table_schema = DATABASE()
+      AND table_name = 'tasks'
+      AND column_name = 'performed_date'
+);
+PREPARE rename_performed_date FROM @rename_performed_date;
+EXECUTE rename_performed_date;
+DEALLOCATE PREPARE rename_performed_date;
@@ -0,0 +1,15 @@
+-- Managers are notified by email when technicians perform tasks
+ALTER TABLE users ADD COLUMN email VARCHAR(255) NULL AFTER username;
+
+-- Transactional outbox, written in the same transaction as the change it describes
+CREATE TABLE notification_outbox (
+    id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type      VARCHAR(64) NOT NULL,
+    payload         JSON NOT NULL,
+    attempts        INT NOT NULL DEFAULT 0,
+    last_error      TEXT NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at    TIMESTAMP NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_outbox_pending (processed_at, next_attempt_at)
+);
@@ -0,0 +1,9 @@
+-- Encrypted summaries cannot be read without their key columns: only roll back
+-- once every summary is stored in plaintext again.
+DROP INDEX idx_summary_key_id ON tasks;
+
+ALTER TABLE tasks
+    DROP COLUMN summary_wrapped_key,
+    DROP COLUMN summary_key_id;
+
+ALTER TABLE tasks ADD CONSTRAINT tasks_summary_length CHECK (CHAR_LENGTH(summary) <= 2500);
@@ -0,0 +1,25 @@
+-- Summaries can be stored AES-GCM encrypted. summary then holds the base64
+-- ciphertext, summary_wrapped_key the base64 data key wrapped with the key
+-- summary_key_id. Rows with a NULL key ID are plaintext.
+ALTER TABLE tasks
+    ADD COLUMN summary_key_id      VARCHAR(64)  NULL AFTER summary,
+    ADD COLUMN summary_wrapped_key VARCHAR(255) NULL AFTER summary_key_id;
+
+CREATE INDEX idx_summary_key_id ON tasks (summary_key_id);
+
+-- The 2500 character limit applies to the plaintext and is enforced by the API,
+-- an encrypted summary is longer. The check is unnamed, so look its name up.
+SET @drop_summary_check = (
+    SELECT IFNULL(MAX(CONCAT('ALTER TABLE tasks DROP CHECK `', tc.constraint_name, '`')), 'DO 0')
+    FROM information_schema.table_constraints tc
+    JOIN information_schema.check_constraints cc
+      ON cc.constraint_schema = tc.constraint_schema
+     AND cc.constraint_name = tc.constraint_name
+    WHERE tc.table_schema = DATABASE()
+      AND tc.table_name = 'tasks'
+      AND tc.constraint_type = 'CHECK'
+      AND cc.check_clause LIKE '%summary%'
+);
+PREPARE drop_summary_check FROM @drop_summary_check;
+EXECUTE drop_summary_check;
+DEALLOCATE PREPARE drop_summary_check;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS task_transitions;
+
+DROP INDEX idx_status ON tasks;
+
+ALTER TABLE tasks DROP COLUMN status;
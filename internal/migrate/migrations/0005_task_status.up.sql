@@ -0,0 +1,23 @@
+-- Tasks move through scheduled -> in_progress -> completed / cancelled, and
+-- can be reopened. Tasks recorded before the workflow existed were performed.
+ALTER TABLE tasks ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'completed' AFTER performed_at;
+
+CREATE INDEX idx_status ON tasks (status);
+
+-- Every status change, from_status is NULL for the status a task was created with
+CREATE TABLE task_transitions (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    task_id     VARCHAR(36) NOT NULL,
+    from_status VARCHAR(16) NULL,
+    to_status   VARCHAR(16) NOT NULL,
+    actor_id    INT NOT NULL,
+    reason      TEXT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_task_transitions_task (task_id, id),
+    CONSTRAINT fk_task_transitions_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE
+);
+
+-- Start the history of existing tasks
+INSERT INTO task_transitions (task_id, from_status, to_status, actor_id, created_at)
+SELECT id, NULL, 'completed', technician_id, COALESCE(created_at, CURRENT_TIMESTAMP)
+FROM tasks;
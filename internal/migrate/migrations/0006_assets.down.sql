@@ -0,0 +1,5 @@
+ALTER TABLE tasks DROP FOREIGN KEY fk_tasks_asset;
+ALTER TABLE tasks DROP INDEX fk_tasks_asset;
+ALTER TABLE tasks DROP COLUMN asset_id;
+
+DROP TABLE assets;
@@ -0,0 +1,18 @@
+-- Equipment that tasks are performed on
+CREATE TABLE assets (
+    id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    serial_number VARCHAR(100) NOT NULL,
+    type          VARCHAR(100) NOT NULL,
+    location      VARCHAR(255) NULL,
+    install_date  DATE NULL,
+    metadata      JSON NULL,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT assets_serial_number UNIQUE (serial_number),
+    INDEX idx_assets_type (type)
+);
+
+-- Assets with maintenance history can not be deleted
+ALTER TABLE tasks
+    ADD COLUMN asset_id BIGINT NULL AFTER technician_id,
+    ADD CONSTRAINT fk_tasks_asset FOREIGN KEY (asset_id) REFERENCES assets (id);
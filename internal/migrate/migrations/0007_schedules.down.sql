@@ -0,0 +1 @@
+DROP TABLE maintenance_schedules;
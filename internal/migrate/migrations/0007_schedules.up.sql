@@ -0,0 +1,20 @@
+-- Recurring preventive maintenance. The scheduler turns every occurrence up
+-- to a horizon into a task and records how far it got in materialized_until.
+CREATE TABLE maintenance_schedules (
+    id                 BIGINT AUTO_INCREMENT PRIMARY KEY,
+    summary            TEXT NOT NULL,
+    rule               VARCHAR(255) NOT NULL,
+    timezone           VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    technician_id      INT NOT NULL,
+    asset_id           BIGINT NULL,
+    starts_at          TIMESTAMP NOT NULL,
+    ends_at            TIMESTAMP NULL,
+    active             BOOLEAN NOT NULL DEFAULT TRUE,
+    materialized_until TIMESTAMP NOT NULL,
+    created_by         INT NOT NULL,
+    created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    updated_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_schedules_active (active),
+    CONSTRAINT fk_schedules_technician FOREIGN KEY (technician_id) REFERENCES users (id),
+    CONSTRAINT fk_schedules_asset FOREIGN KEY (asset_id) REFERENCES assets (id)
+);
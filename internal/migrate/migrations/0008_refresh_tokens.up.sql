@@ -0,0 +1,25 @@
+-- Refresh tokens are stored as SHA-256 hashes. Tokens rotated from the same
+-- login share a family_id so a replayed token can revoke all of them.
+CREATE TABLE refresh_tokens (
+    id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id         INT NOT NULL,
+    family_id       CHAR(36) NOT NULL,
+    token_hash      CHAR(64) NOT NULL,
+    access_token_id CHAR(36) NOT NULL,
+    expires_at      TIMESTAMP NOT NULL,
+    used_at         TIMESTAMP NULL,
+    revoked_at      TIMESTAMP NULL,
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT uq_refresh_tokens_hash UNIQUE (token_hash),
+    INDEX idx_refresh_tokens_family (family_id),
+    INDEX idx_refresh_tokens_access (access_token_id),
+    INDEX idx_refresh_tokens_expires (expires_at),
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Access tokens revoked at logout, kept until they would have expired anyway
+CREATE TABLE revoked_access_tokens (
+    jti        CHAR(36) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX idx_revoked_access_tokens_expires (expires_at)
+);
@@ -0,0 +1,45 @@
+-- Named permissions and the roles they are granted to. Permissions ending in
+-- :own only apply to resources owned by the user, :any to every resource.
+CREATE TABLE permissions (
+    name        VARCHAR(64) PRIMARY KEY,
+    description VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE role_permissions (
+    role       VARCHAR(20) NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role, permission),
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission) REFERENCES permissions (name) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('task:create', 'Record tasks performed by the user'),
+    ('task:read:own', 'List own tasks and their history'),
+    ('task:read:any', 'List every task and its history'),
+    ('task:update:own', 'Edit own tasks'),
+    ('task:update:any', 'Edit every task, not granted by default'),
+    ('task:transition:own', 'Change the status of own tasks'),
+    ('task:transition:any', 'Change the status of every task'),
+    ('task:cancel', 'Cancel tasks'),
+    ('task:delete', 'Delete tasks'),
+    ('asset:read', 'View the asset registry'),
+    ('asset:manage', 'Create, edit and delete assets'),
+    ('schedule:read', 'View maintenance schedules'),
+    ('schedule:manage', 'Create, edit and delete maintenance schedules'),
+    ('user:manage', 'Manage user accounts');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('technician', 'task:create'),
+    ('technician', 'task:read:own'),
+    ('technician', 'task:update:own'),
+    ('technician', 'task:transition:own'),
+    ('technician', 'asset:read'),
+    ('manager', 'task:read:any'),
+    ('manager', 'task:transition:any'),
+    ('manager', 'task:cancel'),
+    ('manager', 'task:delete'),
+    ('manager', 'asset:read'),
+    ('manager', 'asset:manage'),
+    ('manager', 'schedule:read'),
+    ('manager', 'schedule:manage'),
+    ('manager', 'user:manage');
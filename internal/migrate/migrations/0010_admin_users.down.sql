@@ -0,0 +1,6 @@
+INSERT INTO role_permissions (role, permission) VALUES ('manager', 'user:manage');
+DELETE FROM role_permissions WHERE role = 'admin';
+
+UPDATE users SET role = 'manager' WHERE role = 'admin';
+ALTER TABLE users DROP COLUMN active;
+ALTER TABLE users MODIFY role ENUM ('manager', 'technician') NOT NULL;
@@ -0,0 +1,9 @@
+-- Administrators manage user accounts, deactivated users can no longer sign in
+ALTER TABLE users MODIFY role ENUM ('manager', 'technician', 'admin') NOT NULL;
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE AFTER role;
+
+-- Admins can do everything managers can, and user management moves from
+-- managers to admins
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', permission FROM role_permissions WHERE role = 'manager';
+DELETE FROM role_permissions WHERE role = 'manager' AND permission = 'user:manage';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name = 'user:invite';
+DROP TABLE IF EXISTS invitations;
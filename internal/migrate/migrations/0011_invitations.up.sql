@@ -0,0 +1,24 @@
+-- Invitations to register with a given role. Only the jti of the signed
+-- invitation token is stored, accepting it is a compare-and-set on accepted_at.
+CREATE TABLE invitations (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    token_id    VARCHAR(36) NOT NULL,
+    email       VARCHAR(255) NOT NULL,
+    role        ENUM ('manager', 'technician', 'admin') NOT NULL,
+    invited_by  INT NULL,
+    expires_at  TIMESTAMP NOT NULL,
+    accepted_by INT NULL,
+    accepted_at TIMESTAMP NULL,
+    revoked_at  TIMESTAMP NULL,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT invitations_token_id UNIQUE (token_id),
+    CONSTRAINT fk_invitations_invited_by FOREIGN KEY (invited_by) REFERENCES users (id) ON DELETE SET NULL,
+    CONSTRAINT fk_invitations_accepted_by FOREIGN KEY (accepted_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('user:invite', 'Invite users to register');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('manager', 'user:invite'),
+    ('admin', 'user:invite');
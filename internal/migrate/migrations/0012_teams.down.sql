@@ -0,0 +1,16 @@
+INSERT INTO permissions (name, description) VALUES
+    ('task:delete', 'Delete tasks');
+
+INSERT IGNORE INTO role_permissions (role, permission)
+SELECT role, 'task:delete' FROM role_permissions WHERE permission IN ('task:delete:any', 'task:delete:team');
+
+INSERT IGNORE INTO role_permissions (role, permission)
+SELECT role, 'task:read:any' FROM role_permissions WHERE role = 'manager' AND permission = 'task:read:team';
+INSERT IGNORE INTO role_permissions (role, permission)
+SELECT role, 'task:transition:any' FROM role_permissions WHERE role = 'manager' AND permission = 'task:transition:team';
+
+DELETE FROM permissions WHERE name IN ('task:read:team', 'task:transition:team', 'task:delete:team',
+                                       'task:delete:any', 'team:read', 'team:manage');
+
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
@@ -0,0 +1,46 @@
+-- Teams of technicians and the managers they report to. The managers of a
+-- team also manage the members of its sub-teams.
+CREATE TABLE teams (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name       VARCHAR(100) NOT NULL,
+    parent_id  BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT teams_name UNIQUE (name),
+    CONSTRAINT fk_teams_parent FOREIGN KEY (parent_id) REFERENCES teams (id)
+);
+
+CREATE TABLE team_members (
+    team_id    BIGINT NOT NULL,
+    user_id    INT NOT NULL,
+    role       ENUM ('member', 'manager') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    PRIMARY KEY (team_id, user_id),
+    INDEX idx_team_members_user (user_id),
+    CONSTRAINT fk_team_members_team FOREIGN KEY (team_id) REFERENCES teams (id) ON DELETE CASCADE,
+    CONSTRAINT fk_team_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Managers are scoped to the tasks of their teams, admins keep every task.
+-- task:delete becomes task:delete:any, with a task:delete:team variant.
+INSERT INTO permissions (name, description) VALUES
+    ('task:read:team', 'List the tasks of the managed teams and their history'),
+    ('task:transition:team', 'Change the status of the tasks of the managed teams'),
+    ('task:delete:team', 'Delete the tasks of the managed teams'),
+    ('task:delete:any', 'Delete tasks'),
+    ('team:read', 'View teams and their members'),
+    ('team:manage', 'Create, edit and delete teams and manage their members');
+
+INSERT INTO role_permissions (role, permission)
+SELECT role, 'task:delete:any' FROM role_permissions WHERE permission = 'task:delete';
+DELETE FROM permissions WHERE name = 'task:delete';
+
+DELETE FROM role_permissions
+WHERE role = 'manager' AND permission IN ('task:read:any', 'task:transition:any', 'task:delete:any');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('manager', 'task:read:team'),
+    ('manager', 'task:transition:team'),
+    ('manager', 'task:delete:team'),
+    ('manager', 'team:read'),
+    ('admin', 'team:read'),
+    ('admin', 'team:manage');
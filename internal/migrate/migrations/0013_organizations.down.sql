@@ -0,0 +1,25 @@
+DELETE FROM permissions WHERE name = 'org:manage';
+
+-- Restoring the global unique constraints fails while two organizations
+-- share a team name or an asset serial number
+ALTER TABLE invitations
+    DROP FOREIGN KEY fk_invitations_organization,
+    DROP COLUMN organization_id;
+
+ALTER TABLE teams
+    ADD CONSTRAINT teams_name UNIQUE (name),
+    DROP FOREIGN KEY fk_teams_organization,
+    DROP INDEX teams_organization_name,
+    DROP COLUMN organization_id;
+
+ALTER TABLE assets
+    ADD CONSTRAINT assets_serial_number UNIQUE (serial_number),
+    DROP FOREIGN KEY fk_assets_organization,
+    DROP INDEX assets_organization_serial_number,
+    DROP COLUMN organization_id;
+
+ALTER TABLE users
+    DROP FOREIGN KEY fk_users_organization,
+    DROP COLUMN organization_id;
+
+DROP TABLE IF EXISTS organizations;
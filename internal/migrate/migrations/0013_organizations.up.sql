@@ -0,0 +1,46 @@
+-- Customer companies hosted on the deployment. Users belong to one
+-- organization, tasks and schedules belong to the organization of their
+-- technician, assets, teams and invitations carry their own.
+CREATE TABLE organizations (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    slug       VARCHAR(63) NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    settings   JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT organizations_slug UNIQUE (slug)
+);
+
+-- Existing data moves to the default organization, which keeps open
+-- registration working as before
+INSERT INTO organizations (id, slug, name, settings)
+VALUES (1, 'default', 'Default', '{"open_registration": true}');
+
+ALTER TABLE users
+    ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 AFTER id,
+    ADD CONSTRAINT fk_users_organization FOREIGN KEY (organization_id) REFERENCES organizations (id);
+ALTER TABLE users ALTER organization_id DROP DEFAULT;
+
+ALTER TABLE assets
+    ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 AFTER id,
+    ADD CONSTRAINT fk_assets_organization FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    ADD CONSTRAINT assets_organization_serial_number UNIQUE (organization_id, serial_number),
+    DROP INDEX assets_serial_number;
+ALTER TABLE assets ALTER organization_id DROP DEFAULT;
+
+ALTER TABLE teams
+    ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 AFTER id,
+    ADD CONSTRAINT fk_teams_organization FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    ADD CONSTRAINT teams_organization_name UNIQUE (organization_id, name),
+    DROP INDEX teams_name;
+ALTER TABLE teams ALTER organization_id DROP DEFAULT;
+
+ALTER TABLE invitations
+    ADD COLUMN organization_id BIGINT NOT NULL DEFAULT 1 AFTER id,
+    ADD CONSTRAINT fk_invitations_organization FOREIGN KEY (organization_id) REFERENCES organizations (id);
+ALTER TABLE invitations ALTER organization_id DROP DEFAULT;
+
+INSERT INTO permissions (name, description) VALUES
+    ('org:manage', 'Change the settings of the organization');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'org:manage');
@@ -0,0 +1,10 @@
+-- Consecutive failed logins per username (user:<name>) and per client
+-- address (ip:<address>), deleted on a successful login or an admin unlock.
+-- Keys of unknown usernames are tracked too so a lockout does not reveal
+-- whether an account exists.
+CREATE TABLE login_attempts (
+    attempt_key     VARCHAR(300) PRIMARY KEY,
+    failures        INT NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    INDEX idx_login_attempts_last_failure (last_failure_at)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN mfa;
+
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
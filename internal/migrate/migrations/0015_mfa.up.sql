@@ -0,0 +1,28 @@
+-- TOTP second factor. The secret is stored like task summaries: plaintext
+-- when secret_key_id is NULL, otherwise the base64 AES-GCM ciphertext with
+-- its data key wrapped by the key secret_key_id. confirmed_at is set once the
+-- user verified a first code, the factor is only enforced from then on.
+CREATE TABLE user_totp (
+    user_id            INT PRIMARY KEY,
+    secret             VARCHAR(255) NOT NULL,
+    secret_key_id      VARCHAR(64)  NULL,
+    secret_wrapped_key VARCHAR(255) NULL,
+    confirmed_at       TIMESTAMP NULL,
+    last_used_step     BIGINT NOT NULL DEFAULT 0,
+    created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT fk_user_totp_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Single-use recovery codes, stored as SHA-256 hashes
+CREATE TABLE recovery_codes (
+    id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id   INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at   TIMESTAMP NULL,
+    CONSTRAINT uq_recovery_codes_user_hash UNIQUE (user_id, code_hash),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Refresh token families started by a login with a second factor keep
+-- issuing access tokens that say so
+ALTER TABLE refresh_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE AFTER access_token_id;
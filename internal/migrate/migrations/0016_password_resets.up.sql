@@ -0,0 +1,13 @@
+-- Password reset tokens mailed to users, stored as SHA-256 hashes. Using one
+-- marks every other unused token of the user as used too.
+CREATE TABLE password_resets (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id    INT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT uq_password_resets_hash UNIQUE (token_hash),
+    INDEX idx_password_resets_expires (expires_at),
+    CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name = 'apikey:manage';
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,26 @@
+-- API keys for integrations. Only the SHA-256 of a key is stored, next to
+-- its prefix which identifies it. permissions is a JSON array of the
+-- permissions granted to the key.
+CREATE TABLE api_keys (
+    id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+    organization_id BIGINT NOT NULL,
+    user_id         INT NOT NULL,
+    name            VARCHAR(255) NOT NULL,
+    prefix          VARCHAR(16) NOT NULL,
+    key_hash        CHAR(64) NOT NULL,
+    permissions     JSON NOT NULL,
+    expires_at      TIMESTAMP NOT NULL,
+    last_used_at    TIMESTAMP NULL,
+    revoked_at      TIMESTAMP NULL,
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT api_keys_prefix UNIQUE (prefix),
+    CONSTRAINT fk_api_keys_organization FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('apikey:manage', 'Create and revoke API keys');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('manager', 'apikey:manage'),
+    ('admin', 'apikey:manage');
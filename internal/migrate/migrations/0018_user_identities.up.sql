@@ -0,0 +1,13 @@
+-- Accounts at OpenID Connect providers linked to users. An account, named
+-- by the issuer and subject of its ID tokens, belongs to one user at most.
+CREATE TABLE user_identities (
+    id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+    organization_id BIGINT NOT NULL,
+    user_id         INT NOT NULL,
+    issuer          VARCHAR(255) NOT NULL,
+    subject         VARCHAR(255) NOT NULL,
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    CONSTRAINT user_identities_subject UNIQUE (issuer, subject),
+    CONSTRAINT fk_user_identities_organization FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
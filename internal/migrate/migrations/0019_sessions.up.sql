@@ -0,0 +1,16 @@
+-- Sessions are the logins of users, one per refresh token family whose
+-- family_id is their id. Revoking the family terminates the session.
+CREATE TABLE sessions (
+    id           CHAR(36) PRIMARY KEY,
+    user_id      INT NOT NULL,
+    device_name  VARCHAR(100) NOT NULL DEFAULT '',
+    user_agent   VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address   VARCHAR(45) NOT NULL DEFAULT '',
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    revoked_at   TIMESTAMP NULL,
+    INDEX idx_sessions_user (user_id),
+    INDEX idx_sessions_expires (expires_at),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,31 @@
+-- Comments on tasks. Authors are not foreign keys so comments outlive
+-- removed users, like the actors of task_transitions.
+CREATE TABLE task_comments (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    task_id    VARCHAR(36) NOT NULL,
+    author_id  INT NOT NULL,
+    body       TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    edited_at  TIMESTAMP NULL,
+    INDEX idx_task_comments_task (task_id, id),
+    CONSTRAINT fk_task_comments_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE
+);
+
+-- The bodies a comment had before each edit, created_at is when that body was written
+CREATE TABLE task_comment_revisions (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    comment_id BIGINT NOT NULL,
+    body       TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    INDEX idx_task_comment_revisions_comment (comment_id, id),
+    CONSTRAINT fk_task_comment_revisions_comment FOREIGN KEY (comment_id) REFERENCES task_comments (id) ON DELETE CASCADE
+);
+
+-- The users a comment mentions
+CREATE TABLE task_comment_mentions (
+    comment_id BIGINT NOT NULL,
+    user_id    INT NOT NULL,
+    PRIMARY KEY (comment_id, user_id),
+    CONSTRAINT fk_task_comment_mentions_comment FOREIGN KEY (comment_id) REFERENCES task_comments (id) ON DELETE CASCADE,
+    CONSTRAINT fk_task_comment_mentions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
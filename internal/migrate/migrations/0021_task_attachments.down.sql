@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blob_deletions;
+DROP TABLE IF EXISTS task_attachments;
@@ -0,0 +1,26 @@
+-- Files attached to tasks. The content is kept in the blob store under
+-- storage_key, and the JPEG preview of images under thumbnail_key, empty
+-- when there is none. Uploaders are not foreign keys so attachments outlive
+-- removed users, like the authors of task_comments.
+CREATE TABLE task_attachments (
+    id            VARCHAR(36) PRIMARY KEY,
+    task_id       VARCHAR(36) NOT NULL,
+    uploader_id   INT NOT NULL,
+    file_name     VARCHAR(255) NOT NULL,
+    content_type  VARCHAR(100) NOT NULL,
+    size          BIGINT NOT NULL,
+    checksum      CHAR(64) NOT NULL,
+    storage_key   VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_task_attachments_task (task_id, created_at),
+    CONSTRAINT fk_task_attachments_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE
+);
+
+-- Blobs of removed attachments waiting to be deleted from the blob store.
+-- Keys are queued in the transaction removing the attachment or its task and
+-- forgotten once the blob is gone.
+CREATE TABLE blob_deletions (
+    storage_key VARCHAR(255) PRIMARY KEY,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+-- The deliveries of an outbox message that succeeded, one per recipient and
+-- sink, so a retry only repeats the deliveries that failed
+CREATE TABLE notification_deliveries (
+    message_id   BIGINT NOT NULL,
+    user_id      INT NOT NULL,
+    sink         VARCHAR(32) NOT NULL,
+    delivered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, sink),
+    CONSTRAINT fk_notification_deliveries_message FOREIGN KEY (message_id) REFERENCES notification_outbox (id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DELETE FROM notification_outbox WHERE topic <> 'notifications';
+ALTER TABLE notification_outbox
+    DROP INDEX idx_outbox_pending,
+    ADD INDEX idx_outbox_pending (processed_at, next_attempt_at),
+    DROP COLUMN topic;
@@ -0,0 +1,6 @@
+-- The outbox also carries the task events published to the message broker.
+-- Each topic is claimed by its own relay, notifications by the dispatcher.
+ALTER TABLE notification_outbox
+    ADD COLUMN topic VARCHAR(32) NOT NULL DEFAULT 'notifications' AFTER id,
+    DROP INDEX idx_outbox_pending,
+    ADD INDEX idx_outbox_pending (topic, processed_at, next_attempt_at);
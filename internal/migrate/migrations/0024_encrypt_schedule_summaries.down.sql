@@ -0,0 +1,7 @@
+-- Encrypted summaries cannot be read without their key columns: only roll back
+-- once every schedule summary is stored in plaintext again.
+DROP INDEX idx_schedules_summary_key_id ON maintenance_schedules;
+
+ALTER TABLE maintenance_schedules
+    DROP COLUMN summary_wrapped_key,
+    DROP COLUMN summary_key_id;
@@ -0,0 +1,7 @@
+-- Schedule summaries are encrypted like task summaries, see
+-- 0004_encrypt_task_summaries. Rows with a NULL key ID are plaintext.
+ALTER TABLE maintenance_schedules
+    ADD COLUMN summary_key_id      VARCHAR(64)  NULL AFTER summary,
+    ADD COLUMN summary_wrapped_key VARCHAR(255) NULL AFTER summary_key_id;
+
+CREATE INDEX idx_schedules_summary_key_id ON maintenance_schedules (summary_key_id);
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKeyStatus is the state of an API key, derived from its timestamps
+type APIKeyStatus string
+
+const (
+	APIKeyActive  APIKeyStatus = "active"
+	APIKeyRevoked APIKeyStatus = "revoked"
+	APIKeyExpired APIKeyStatus = "expired"
+)
+
+// APIKey lets an integration call the API on behalf of the user who created
+// it, limited to the permissions granted to the key
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix identifies the key in listings and logs, it is the start of the
+	// key itself and is stored in clear
+	Prefix string `json:"prefix"`
+	// KeyHash is the SHA-256 of the key, the key itself is never stored
+	KeyHash string `json:"-"`
+	// Permissions are the only permissions requests made with the key get,
+	// provided the role of the user still holds them
+	Permissions []Permission `json:"permissions"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time   `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	// OrganizationID is the organization of the user who created the key
+	OrganizationID int64 `json:"-"`
+}
+
+// Status returns the state of the key at the given time
+func (k *APIKey) Status(now time.Time) APIKeyStatus {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyRevoked
+	case !now.Before(k.ExpiresAt):
+		return APIKeyExpired
+	}
+	return APIKeyActive
+}
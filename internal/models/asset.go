@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Asset is a piece of equipment that tasks are performed on
+type Asset struct {
+	ID           int64  `json:"id"`
+	SerialNumber string `json:"serial_number"`
+	Type         string `json:"type"`
+	Location     string `json:"location,omitempty"`
+	// InstallDate is a calendar date formatted as YYYY-MM-DD
+	InstallDate string            `json:"install_date,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	// OrganizationID is set from the organization of the request
+	OrganizationID int64 `json:"-"`
+}
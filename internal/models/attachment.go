@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a file attached to a task, such as a photo taken before or
+// after the work or a signed service report
+type Attachment struct {
+	ID          string `json:"id"`
+	TaskID      string `json:"task_id"`
+	UploaderID  int64  `json:"uploader_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Checksum is the hex encoded SHA-256 of the content
+	Checksum string `json:"checksum"`
+	// StorageKey is the blob store key of the content
+	StorageKey string `json:"-"`
+	// ThumbnailKey is the blob store key of the JPEG preview of an image,
+	// empty when there is none
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
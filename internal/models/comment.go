@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// TaskComment is a message left on a task, such as a question of a manager to
+// the technician who performed it
+type TaskComment struct {
+	ID         int64  `json:"id"`
+	TaskID     string `json:"task_id"`
+	AuthorID   int64  `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+	// Mentions holds the IDs of the users mentioned with @username in the body
+	Mentions  []int64   `json:"mentions"`
+	CreatedAt time.Time `json:"created_at"`
+	// EditedAt is the time of the last edit, nil when the comment was never edited
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+}
+
+// TaskCommentRevision is a body a comment had before it was edited
+type TaskCommentRevision struct {
+	ID        int64  `json:"id"`
+	CommentID int64  `json:"comment_id"`
+	Body      string `json:"body"`
+	// CreatedAt is when this body was written
+	CreatedAt time.Time `json:"created_at"`
+}
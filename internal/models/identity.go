@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Identity links an account at an OpenID Connect provider to a user, who
+// can then log in through the provider
+type Identity struct {
+	ID     int64 `json:"id"`
+	UserID uint  `json:"user_id"`
+	// Issuer and Subject are the iss and sub claims of the ID tokens of the
+	// account, which identify it at the provider
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+	// OrganizationID is the organization of the user
+	OrganizationID int64 `json:"-"`
+}
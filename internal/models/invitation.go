@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// InvitationStatus is the state of an invitation, derived from its timestamps
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+// Invitation lets the holder of its signed token register once with the
+// invited role
+type Invitation struct {
+	ID int64 `json:"id"`
+	// TokenID is the jti of the invitation token, the token itself is never stored
+	TokenID string `json:"-"`
+	Email   string `json:"email"`
+	Role    Role   `json:"role"`
+	// InvitedBy is the user who created the invitation, 0 once that user was deleted
+	InvitedBy uint      `json:"invited_by,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// AcceptedBy is the user registered with the invitation
+	AcceptedBy *uint      `json:"accepted_by,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// OrganizationID is the organization the invited user joins, the one of
+	// the user who created the invitation
+	OrganizationID int64 `json:"-"`
+}
+
+// Status returns the state of the invitation at the given time
+func (i *Invitation) Status(now time.Time) InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
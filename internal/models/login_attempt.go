@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// LoginAttempts counts the consecutive failed logins for a username or for a
+// client address, the Key tells which
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// UsernameAttemptKey is the key failed logins for a username are counted
+// under, whether or not a user has that name. Usernames are compared case
+// insensitively, like the users table does.
+func UsernameAttemptKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// PasswordResetAttemptKey is the key password reset requests for a username
+// are counted under. They are kept apart from failed logins, so asking for
+// resets does not lock the user out.
+func PasswordResetAttemptKey(username string) string {
+	return "reset:" + strings.ToLower(username)
+}
+
+// AddressAttemptKey is the key failed logins from a client address are counted under
+func AddressAttemptKey(address string) string {
+	return "ip:" + address
+}
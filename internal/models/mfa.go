@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TOTPEnrollment is the authenticator app a user enrolled as second factor
+type TOTPEnrollment struct {
+	UserID uint
+	// Secret is the shared secret, base32 encoded as in the provisioning URI
+	Secret string
+	// ConfirmedAt is set once the user proved their app produces valid codes,
+	// the second factor is only asked for from then on
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, codes of that
+	// step or an earlier one are rejected so a code can not be replayed
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// Confirmed reports whether the enrollment is complete and enforced at login
+func (e *TOTPEnrollment) Confirmed() bool {
+	return e != nil && e.ConfirmedAt != nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// DefaultOrganizationID is the organization created by the migrations. Users
+// that existed before organizations were introduced belong to it.
+const DefaultOrganizationID int64 = 1
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// Organization is a customer company hosted on the deployment. Users, and the
+// tasks, assets, schedules, teams and invitations they create, belong to
+// exactly one organization and are never visible to another.
+type Organization struct {
+	ID int64 `json:"id"`
+	// Slug identifies the organization at registration and on the command line
+	Slug      string               `json:"slug"`
+	Name      string               `json:"name"`
+	Settings  OrganizationSettings `json:"settings"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// OrganizationSettings are the settings the admins of an organization change
+// for their organization only
+type OrganizationSettings struct {
+	// OpenRegistration lets technicians register into the organization
+	// without an invitation, when the deployment allows open registration
+	OpenRegistration bool `json:"open_registration"`
+	// DefaultTimezone is the timezone of schedules created without one, UTC when empty
+	DefaultTimezone string `json:"default_timezone,omitempty"`
+}
+
+// ValidSlug reports whether slug is lower case letters, digits and dashes,
+// 2 to 63 characters long and not starting with a dash
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// Validate checks the settings, loading the default timezone
+func (s OrganizationSettings) Validate() error {
+	if s.DefaultTimezone != "" {
+		if _, err := time.LoadLocation(s.DefaultTimezone); err != nil {
+			return errors.New("default_timezone is not a known IANA timezone")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+)
+
+// Outbox event types
+const (
+	EventTaskPerformed    = "task.performed"
+	EventCommentMentioned = "comment.mentioned"
+)
+
+// Outbox topics, each claimed by its own consumer
+const (
+	// OutboxNotifications holds the messages the notification dispatcher turns into notifications
+	OutboxNotifications = "notifications"
+	// OutboxEvents holds the task events relayed to the event publisher
+	OutboxEvents = "events"
+)
+
+// OutboxMessage is an event stored in the transactional outbox until it has been dispatched
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+}
+
+// OutboxDelivery is a notification of an outbox message delivered to a
+// recipient through a sink
+type OutboxDelivery struct {
+	UserID uint   `json:"user_id"`
+	Sink   string `json:"sink"`
+}
+
+// TaskPerformedPayload is the outbox payload written when a technician records a task.
+// When summaries are encrypted at rest the summary travels sealed in EncryptedSummary,
+// bound to TaskID, and Summary is left empty.
+type TaskPerformedPayload struct {
+	TaskID           string             `json:"task_id"`
+	TechnicianID     int64              `json:"technician_id"`
+	Summary          string             `json:"summary"`
+	EncryptedSummary *encryption.Sealed `json:"encrypted_summary,omitempty"`
+	PerformedAt      time.Time          `json:"performed_at"`
+}
+
+// CommentMentionedPayload is the outbox payload written when a comment
+// mentions users. An edited comment only lists the users it newly mentions.
+type CommentMentionedPayload struct {
+	TaskID    string    `json:"task_id"`
+	CommentID int64     `json:"comment_id"`
+	AuthorID  int64     `json:"author_id"`
+	UserIDs   []int64   `json:"user_ids"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
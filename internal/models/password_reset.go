@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset is a single-use token that lets a user who forgot their
+// password set a new one until it expires
+type PasswordReset struct {
+	ID     int64
+	UserID uint
+	// TokenHash is the SHA-256 of the token mailed to the user, the token
+	// itself is never stored
+	TokenHash string
+	ExpiresAt time.Time
+	// UsedAt is set once the token was used, or a later one of the user was
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
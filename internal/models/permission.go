@@ -0,0 +1,97 @@
+package models
+
+import "strings"
+
+// Permission names an action a role may perform, as resource:action or, for
+// actions checked against the owner of a resource, resource:action:own,
+// resource:action:team for resources owned by the members of the teams the
+// user manages, and resource:action:any
+type Permission string
+
+const (
+	PermissionTaskCreate         Permission = "task:create"
+	PermissionTaskReadOwn        Permission = "task:read:own"
+	PermissionTaskReadTeam       Permission = "task:read:team"
+	PermissionTaskReadAny        Permission = "task:read:any"
+	PermissionTaskUpdateOwn      Permission = "task:update:own"
+	PermissionTaskUpdateAny      Permission = "task:update:any"
+	PermissionTaskTransitionOwn  Permission = "task:transition:own"
+	PermissionTaskTransitionTeam Permission = "task:transition:team"
+	PermissionTaskTransitionAny  Permission = "task:transition:any"
+	PermissionTaskCancel         Permission = "task:cancel"
+	PermissionTaskDeleteTeam     Permission = "task:delete:team"
+	PermissionTaskDeleteAny      Permission = "task:delete:any"
+	PermissionAssetRead          Permission = "asset:read"
+	PermissionAssetManage        Permission = "asset:manage"
+	PermissionScheduleRead       Permission = "schedule:read"
+	PermissionScheduleManage     Permission = "schedule:manage"
+	PermissionUserManage         Permission = "user:manage"
+	PermissionUserInvite         Permission = "user:invite"
+	PermissionTeamRead           Permission = "team:read"
+	PermissionTeamManage         Permission = "team:manage"
+	PermissionOrgManage          Permission = "org:manage"
+	PermissionAPIKeyManage       Permission = "apikey:manage"
+)
+
+// Team returns the :team variant of an :own permission, or the permission
+// itself when it is not scoped to the owner
+func (p Permission) Team() Permission {
+	if base, ok := strings.CutSuffix(string(p), ":own"); ok {
+		return Permission(base + ":team")
+	}
+	return p
+}
+
+// Any returns the :any variant of an :own or :team permission, or the
+// permission itself when it is not scoped to the owner
+func (p Permission) Any() Permission {
+	for _, scope := range []string{":own", ":team"} {
+		if base, ok := strings.CutSuffix(string(p), scope); ok {
+			return Permission(base + ":any")
+		}
+	}
+	return p
+}
+
+// DefaultRolePermissions are the grants seeded by the migrations, used as is
+// by the in-memory storage. Tasks are only edited by the technician who
+// performed them, PermissionTaskUpdateAny is not granted. Managers are scoped
+// to the tasks of their teams, admins to the tasks of their organization.
+var DefaultRolePermissions = map[Role][]Permission{
+	RoleTechnician: {
+		PermissionTaskCreate,
+		PermissionTaskReadOwn,
+		PermissionTaskUpdateOwn,
+		PermissionTaskTransitionOwn,
+		PermissionAssetRead,
+	},
+	RoleManager: {
+		PermissionTaskReadTeam,
+		PermissionTaskTransitionTeam,
+		PermissionTaskCancel,
+		PermissionTaskDeleteTeam,
+		PermissionAssetRead,
+		PermissionAssetManage,
+		PermissionScheduleRead,
+		PermissionScheduleManage,
+		PermissionUserInvite,
+		PermissionTeamRead,
+		PermissionAPIKeyManage,
+	},
+	RoleAdmin: {
+		PermissionTaskReadAny,
+		PermissionTaskTransitionAny,
+		PermissionTaskCancel,
+		PermissionTaskDeleteAny,
+		PermissionAssetRead,
+		PermissionAssetManage,
+		PermissionScheduleRead,
+		PermissionScheduleManage,
+		PermissionUserManage,
+		PermissionUserInvite,
+		PermissionTeamRead,
+		PermissionTeamManage,
+		PermissionOrgManage,
+		PermissionAPIKeyManage,
+	},
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Schedule is a recurring preventive maintenance plan. Every occurrence of its
+// rule becomes a scheduled task for the technician.
+type Schedule struct {
+	ID      int64  `json:"id"`
+	Summary string `json:"summary"`
+	// Rule is a five-field cron expression or an RRULE
+	Rule string `json:"rule"`
+	// Timezone is the IANA time zone the rule is evaluated in
+	Timezone     string     `json:"timezone"`
+	TechnicianID int64      `json:"technician_id"`
+	AssetID      *int64     `json:"asset_id,omitempty"`
+	StartsAt     time.Time  `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+	Active       bool       `json:"active"`
+	// MaterializedUntil is the time up to which occurrences were turned into
+	// tasks, later occurrences are still pending
+	MaterializedUntil time.Time `json:"materialized_until"`
+	CreatedBy         int64     `json:"created_by"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
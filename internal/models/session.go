@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login of a user on one device. It shares its ID with the
+// refresh token family the login started and lives as long as the family,
+// access tokens name it in their sid claim.
+type Session struct {
+	ID     string `json:"id"`
+	UserID uint   `json:"user_id"`
+	// DeviceName is the name the client gave at login, it may be empty
+	DeviceName string `json:"device_name,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	// IPAddress is the client address of the login or of the last refresh
+	IPAddress  string    `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt follows the latest refresh token of the family
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session can still be used at the given time
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
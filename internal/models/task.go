@@ -5,13 +5,21 @@ import (
 )
 
 type Task struct {
-	ID           string    `json:"id"`
-	TechnicianID int64     `json:"technician_id"`
-	Summary      string    `json:"summary"`
-	PerformedAt  time.Time `json:"performed_at"`
+	ID           string     `json:"id"`
+	TechnicianID int64      `json:"technician_id"`
+	AssetID      *int64     `json:"asset_id,omitempty"`
+	Summary      string     `json:"summary"`
+	PerformedAt  time.Time  `json:"performed_at"`
+	Status       TaskStatus `json:"status"`
 }
 
 type CreateTaskRequest struct {
 	Summary     string    `json:"summary" validate:"required,max=2500"`
 	PerformedAt time.Time `json:"performed_at" validate:"required"`
 }
+
+// TaskWithTechnician is a task together with the username of the technician who performed it
+type TaskWithTechnician struct {
+	Task
+	TechnicianName string `json:"technician_name"`
+}
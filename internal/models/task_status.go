@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// TaskStatus is the stage of a task in its workflow
+type TaskStatus string
+
+const (
+	StatusScheduled  TaskStatus = "scheduled"
+	StatusInProgress TaskStatus = "in_progress"
+	StatusCompleted  TaskStatus = "completed"
+	StatusCancelled  TaskStatus = "cancelled"
+	StatusReopened   TaskStatus = "reopened"
+)
+
+// taskTransitions lists the statuses each status may move to
+var taskTransitions = map[TaskStatus][]TaskStatus{
+	StatusScheduled:  {StatusInProgress, StatusCancelled},
+	StatusInProgress: {StatusCompleted, StatusCancelled},
+	StatusCompleted:  {StatusReopened},
+	StatusCancelled:  {StatusReopened},
+	StatusReopened:   {StatusInProgress, StatusCancelled},
+}
+
+// Valid reports whether s is a known status
+func (s TaskStatus) Valid() bool {
+	_, ok := taskTransitions[s]
+	return ok
+}
+
+// ValidInitial reports whether a task may be created in status s. A task is
+// either planned, started or recorded after the fact.
+func (s TaskStatus) ValidInitial() bool {
+	return s == StatusScheduled || s == StatusInProgress || s == StatusCompleted
+}
+
+// CanTransitionTo reports whether the workflow allows moving from s to next
+func (s TaskStatus) CanTransitionTo(next TaskStatus) bool {
+	for _, allowed := range taskTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskTransition is one recorded status change of a task. From is empty for
+// the status the task was created with.
+type TaskTransition struct {
+	ID        int64      `json:"id"`
+	TaskID    string     `json:"task_id"`
+	From      TaskStatus `json:"from,omitempty"`
+	To        TaskStatus `json:"to"`
+	ActorID   int64      `json:"actor_id"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestTaskStatusTransitions(t *testing.T) {
+	allowed := map[TaskStatus][]TaskStatus{
+		StatusScheduled:  {StatusInProgress, StatusCancelled},
+		StatusInProgress: {StatusCompleted, StatusCancelled},
+		StatusCompleted:  {StatusReopened},
+		StatusCancelled:  {StatusReopened},
+		StatusReopened:   {StatusInProgress, StatusCancelled},
+	}
+	all := []TaskStatus{StatusScheduled, StatusInProgress, StatusCompleted, StatusCancelled, StatusReopened}
+
+	for _, from := range all {
+		for _, to := range all {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: CanTransitionTo() = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	if TaskStatus("done").Valid() {
+		t.Error("unknown status must not be valid")
+	}
+	if TaskStatus("done").CanTransitionTo(StatusCompleted) {
+		t.Error("unknown status must not transition")
+	}
+}
+
+func TestTaskStatusValidInitial(t *testing.T) {
+	tests := map[TaskStatus]bool{
+		StatusScheduled:  true,
+		StatusInProgress: true,
+		StatusCompleted:  true,
+		StatusCancelled:  false,
+		StatusReopened:   false,
+		"":               false,
+	}
+	for status, want := range tests {
+		if got := status.ValidInitial(); got != want {
+			t.Errorf("%q.ValidInitial() = %v, want %v", status, got, want)
+		}
+	}
+}
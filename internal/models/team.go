@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// TeamRole is the part a user plays in a team
+type TeamRole string
+
+const (
+	// TeamRoleMember is a technician reporting to the managers of the team
+	TeamRoleMember TeamRole = "member"
+	// TeamRoleManager manages the members of the team and of its sub-teams
+	TeamRoleManager TeamRole = "manager"
+)
+
+// Valid reports whether r is a known team role
+func (r TeamRole) Valid() bool {
+	return r == TeamRoleMember || r == TeamRoleManager
+}
+
+// Team groups technicians under the managers they report to. Teams can be
+// nested, the managers of a team also manage every sub-team.
+type Team struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// OrganizationID is set from the organization of the request
+	OrganizationID int64 `json:"-"`
+}
+
+// TeamMember is the membership of a user in a team
+type TeamMember struct {
+	TeamID    int64     `json:"team_id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      TeamRole  `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a single-use credential exchanged for a new access token.
+// Every token descending from one login shares a FamilyID, so replaying a
+// token that was already exchanged revokes the whole chain.
+type RefreshToken struct {
+	ID       int64
+	UserID   uint
+	FamilyID string
+	// TokenHash is the SHA-256 of the token, the token itself is never stored
+	TokenHash string
+	// AccessTokenID is the jti of the access token issued alongside, it is
+	// revoked together with the family
+	AccessTokenID string
+	// MFA is set for families started by a login with a second factor, the
+	// access tokens they issue carry the MFA claim
+	MFA       bool
+	ExpiresAt time.Time
+	// UsedAt is set once the token was exchanged for a new pair
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
@@ -12,8 +12,19 @@ type Role string
 const (
 	RoleTechnician Role = "technician"
 	RoleManager    Role = "manager"
+	// RoleAdmin manages user accounts
+	RoleAdmin Role = "admin"
 )
 
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	switch r {
+	case RoleTechnician, RoleManager, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 // Value - Implementation for sql driver to save Role type to database
 func (r Role) Value() (driver.Value, error) {
 	return string(r), nil
@@ -34,13 +45,11 @@ func (r *Role) Scan(value interface{}) error {
 		str = string(bytes)
 	}
 
-	switch Role(str) {
-	case RoleTechnician, RoleManager:
-		*r = Role(str)
-		return nil
-	default:
+	if !Role(str).Valid() {
 		return errors.New("invalid role value")
 	}
+	*r = Role(str)
+	return nil
 }
 
 // UnmarshalJSON - Custom JSON unmarshaling for Role
@@ -50,13 +59,11 @@ func (r *Role) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	switch Role(str) {
-	case RoleTechnician, RoleManager:
-		*r = Role(str)
-		return nil
-	default:
+	if !Role(str).Valid() {
 		return errors.New("invalid role value")
 	}
+	*r = Role(str)
+	return nil
 }
 
 // MarshalJSON - Custom JSON marshaling for Role
@@ -65,10 +72,15 @@ func (r Role) MarshalJSON() ([]byte, error) {
 }
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Username  string    `json:"username" gorm:"unique"`
-	Password  string    `json:"-"` // '-' prevents password from being shown in JSON
-	Role      Role      `json:"role" gorm:"type:varchar(20)"`
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Username string `json:"username" gorm:"unique"`
+	Email    string `json:"email,omitempty"`
+	Password string `json:"-"` // '-' prevents password from being shown in JSON
+	Role     Role   `json:"role" gorm:"type:varchar(20)"`
+	// OrganizationID is the organization the user belongs to and is limited to
+	OrganizationID int64 `json:"organization_id"`
+	// Active is false for deactivated users, who can no longer sign in
+	Active    bool      `json:"active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
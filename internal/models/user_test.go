@@ -55,6 +55,12 @@ func TestRoleScan(t *testing.T) {
 			want:    RoleTechnician,
 			wantErr: false,
 		},
+		{
+			name:    "valid admin string",
+			input:   "admin",
+			want:    RoleAdmin,
+			wantErr: false,
+		},
 		{
 			name:    "valid manager string",
 			input:   "manager",
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// Notification types
+const (
+	TypeTaskPerformed    = "task_performed"
+	TypeCommentMentioned = "comment_mentioned"
+)
+
+// Dispatcher drains the transactional outbox and turns its messages into
+// notifications. Every delivery to a recipient through a sink is recorded, so
+// a failed message is retried only for the deliveries that failed.
+type Dispatcher struct {
+	outbox repository.OutboxRepository
+	users  repository.UserRepository
+	sinks  []Sink
+	logger *logger.Logger
+
+	// BatchSize is the maximum number of messages claimed per run
+	BatchSize int
+	// Lease is how long a claimed message is hidden from other dispatchers
+	Lease time.Duration
+	// MaxAttempts is the number of failed attempts after which a message is discarded
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled on every further attempt
+	RetryBackoff time.Duration
+	// MaxBackoff caps the retry delay
+	MaxBackoff time.Duration
+	// Keyring opens summaries that were encrypted at rest, nil when encryption is disabled
+	Keyring *encryption.Keyring
+	// Teams limits task notifications to the managers of the technician's
+	// teams, nil notifies every manager
+	Teams repository.TeamRepository
+}
+
+// NewDispatcher creates a Dispatcher with default batching and retry settings
+func NewDispatcher(outbox repository.OutboxRepository, users repository.UserRepository, sinks []Sink, logger *logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		outbox:       outbox,
+		users:        users,
+		sinks:        sinks,
+		logger:       logger,
+		BatchSize:    50,
+		Lease:        time.Minute,
+		MaxAttempts:  5,
+		RetryBackoff: 10 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+	}
+}
+
+// Start dispatches pending messages every interval until ctx is cancelled
+func (d *Dispatcher) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.DispatchPending(ctx); err != nil {
+				d.logger.LogError(err, "Failed to dispatch notifications")
+			}
+		}
+	}
+}
+
+// DispatchPending claims one batch of due outbox messages, delivers them and
+// returns how many were delivered successfully
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	messages, err := d.outbox.Claim(ctx, models.OutboxNotifications, d.BatchSize, d.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, message := range messages {
+		err := d.dispatch(ctx, message)
+		if err == nil {
+			delivered++
+			if err := d.outbox.MarkProcessed(ctx, message.ID); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if message.Attempts+1 >= d.MaxAttempts {
+			d.logger.LogError(err, fmt.Sprintf("Discarding outbox message %d after %d attempts", message.ID, message.Attempts+1))
+			if err := d.outbox.MarkDiscarded(ctx, message.ID, err.Error()); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		d.logger.LogError(err, fmt.Sprintf("Failed to dispatch outbox message %d, will retry", message.ID))
+		if err := d.outbox.MarkFailed(ctx, message.ID, err.Error(), d.backoff(message.Attempts)); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// backoff returns the retry delay after the given number of previous attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.RetryBackoff
+	for i := 0; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, message models.OutboxMessage) error {
+	notifications, err := d.notifications(ctx, message)
+	if err != nil {
+		return err
+	}
+	return d.deliver(ctx, message.ID, notifications)
+}
+
+// notifications builds the notifications of an outbox message
+func (d *Dispatcher) notifications(ctx context.Context, message models.OutboxMessage) ([]Notification, error) {
+	switch message.EventType {
+	case models.EventTaskPerformed:
+		var payload models.TaskPerformedPayload
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("decoding %s payload: %w", message.EventType, err)
+		}
+		if err := d.openSummary(&payload); err != nil {
+			return nil, err
+		}
+		return d.taskPerformedNotifications(ctx, payload)
+	case models.EventCommentMentioned:
+		var payload models.CommentMentionedPayload
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("decoding %s payload: %w", message.EventType, err)
+		}
+		return d.commentMentionedNotifications(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown outbox event type %q", message.EventType)
+	}
+}
+
+// deliver sends every notification through every sink, skipping the
+// deliveries recorded by earlier attempts, and records each one that succeeds
+func (d *Dispatcher) deliver(ctx context.Context, messageID int64, notifications []Notification) error {
+	recorded, err := d.outbox.Deliveries(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("loading deliveries: %w", err)
+	}
+	delivered := make(map[models.OutboxDelivery]bool, len(recorded))
+	for _, delivery := range recorded {
+		delivered[delivery] = true
+	}
+
+	var errs []error
+	attempted := 0
+	for _, n := range notifications {
+		for _, sink := range d.sinks {
+			delivery := models.OutboxDelivery{UserID: n.Recipient.UserID, Sink: sink.Name}
+			if delivered[delivery] {
+				continue
+			}
+
+			attempted++
+			if err := sink.Notifier.Notify(ctx, n); err != nil {
+				errs = append(errs, fmt.Errorf("notifying %s through %s: %w", n.Recipient.Username, sink.Name, err))
+				continue
+			}
+			if err := d.outbox.RecordDelivery(ctx, messageID, delivery); err != nil {
+				return fmt.Errorf("recording delivery: %w", err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d deliveries failed: %w", len(errs), attempted, errs[0])
+	}
+	return nil
+}
+
+// openSummary replaces an encrypted summary in the payload with its plaintext
+func (d *Dispatcher) openSummary(payload *models.TaskPerformedPayload) error {
+	if payload.EncryptedSummary == nil {
+		return nil
+	}
+	if d.Keyring == nil {
+		return fmt.Errorf("task %s summary is encrypted but no keyring is configured", payload.TaskID)
+	}
+
+	summary, err := d.Keyring.Open(*payload.EncryptedSummary, []byte(payload.TaskID))
+	if err != nil {
+		return fmt.Errorf("decrypting task %s summary: %w", payload.TaskID, err)
+	}
+	payload.Summary = string(summary)
+	payload.EncryptedSummary = nil
+	return nil
+}
+
+// taskPerformedNotifications tells the managers of a technician that they performed a task
+func (d *Dispatcher) taskPerformedNotifications(ctx context.Context, payload models.TaskPerformedPayload) ([]Notification, error) {
+	technician, err := d.users.GetByID(ctx, uint(payload.TechnicianID))
+	if err != nil {
+		return nil, fmt.Errorf("looking up technician %d: %w", payload.TechnicianID, err)
+	}
+
+	managers, err := d.managers(ctx, technician)
+	if err != nil {
+		return nil, fmt.Errorf("listing managers: %w", err)
+	}
+
+	performedOn := payload.PerformedAt.UTC().Format("2006-01-02 15:04 MST")
+	subject := fmt.Sprintf("%s performed a task", technician.Username)
+	body := fmt.Sprintf("Technician %s performed task %q on %s.\n\nTask ID: %s",
+		technician.Username, payload.Summary, performedOn, payload.TaskID)
+
+	notifications := make([]Notification, 0, len(managers))
+	for _, manager := range managers {
+		notifications = append(notifications, Notification{
+			Type: TypeTaskPerformed,
+			Recipient: Recipient{
+				UserID:   manager.ID,
+				Username: manager.Username,
+				Email:    manager.Email,
+			},
+			Subject: subject,
+			Body:    body,
+			Data:    payload,
+		})
+	}
+	return notifications, nil
+}
+
+// commentMentionedNotifications tells the users mentioned in a comment about
+// it. Users that were removed or deactivated since are skipped.
+func (d *Dispatcher) commentMentionedNotifications(ctx context.Context, payload models.CommentMentionedPayload) ([]Notification, error) {
+	authorName := "Someone"
+	author, err := d.users.GetByID(ctx, uint(payload.AuthorID))
+	if err == nil {
+		authorName = author.Username
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("looking up author %d: %w", payload.AuthorID, err)
+	}
+
+	subject := fmt.Sprintf("%s mentioned you on a task", authorName)
+	body := fmt.Sprintf("%s mentioned you in a comment on task %s:\n\n%s", authorName, payload.TaskID, payload.Body)
+
+	var notifications []Notification
+	for _, userID := range payload.UserIDs {
+		user, err := d.users.GetByID(ctx, uint(userID))
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("looking up user %d: %w", userID, err)
+		}
+		if !user.Active {
+			continue
+		}
+
+		notifications = append(notifications, Notification{
+			Type: TypeCommentMentioned,
+			Recipient: Recipient{
+				UserID:   user.ID,
+				Username: user.Username,
+				Email:    user.Email,
+			},
+			Subject: subject,
+			Body:    body,
+			Data:    payload,
+		})
+	}
+	return notifications, nil
+}
+
+// managers returns the managers notified about the tasks of a technician.
+// Without teams these are the managers of the organization of the technician.
+func (d *Dispatcher) managers(ctx context.Context, technician *models.User) ([]models.User, error) {
+	if d.Teams != nil {
+		return d.Teams.Managers(ctx, technician.ID)
+	}
+	return d.users.ListByRole(tenant.WithOrganization(ctx, technician.OrganizationID), models.RoleManager)
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/mail"
+)
+
+// Recipient is the user a notification is addressed to
+type Recipient struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+// Notification is a message for a single recipient
+type Notification struct {
+	Type      string    `json:"type"`
+	Recipient Recipient `json:"recipient"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	// Data carries the structured event the notification was built from
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications to a sink
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Sink is a named Notifier. The dispatcher records its deliveries under the
+// name, so a retry skips the sinks that already delivered a notification.
+type Sink struct {
+	Name     string
+	Notifier Notifier
+}
+
+// LogNotifier writes notifications to the application log. Only who was told
+// what kind of thing is logged: the body and data carry task summaries and
+// comments, which are kept out of the log even when they are encrypted at rest.
+type LogNotifier struct {
+	logger *logger.Logger
+}
+
+// NewLogNotifier creates a new LogNotifier
+func NewLogNotifier(logger *logger.Logger) *LogNotifier {
+	return &LogNotifier{
+		logger: logger,
+	}
+}
+
+// Notify logs the notification without its body and data
+func (l *LogNotifier) Notify(ctx context.Context, n Notification) error {
+	l.logger.Info("notification",
+		"type", n.Type,
+		"recipient", n.Recipient.Username,
+		"subject", n.Subject,
+	)
+	return nil
+}
+
+// EmailNotifier delivers notifications by email. Recipients without an email
+// address are skipped since there is nothing to deliver to.
+type EmailNotifier struct {
+	sender mail.Sender
+}
+
+// NewEmailNotifier creates a new EmailNotifier
+func NewEmailNotifier(sender mail.Sender) *EmailNotifier {
+	return &EmailNotifier{
+		sender: sender,
+	}
+}
+
+// Notify emails the notification to the recipient
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	if n.Recipient.Email == "" {
+		return nil
+	}
+	return e.sender.Send(ctx, mail.Message{
+		To:      []string{n.Recipient.Email},
+		Subject: n.Subject,
+		Body:    n.Body,
+	})
+}
+
+// WebhookNotifier posts notifications as JSON to an HTTP endpoint
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the notification and treats any non-2xx response as a failure
+func (wh *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
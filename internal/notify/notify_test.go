@@ -0,0 +1,323 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/mail"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingNotifier keeps every notification and can be told to fail
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []Notification
+	err           error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+func setupDispatcher(t *testing.T, notifier Notifier) (*Dispatcher, *repository.MemoryTaskRepository, *repository.MemoryOutboxRepository) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	for _, user := range []models.User{
+		{Username: "john_tech", Role: models.RoleTechnician},
+		{Username: "manager1", Email: "manager1@example.com", Role: models.RoleManager},
+		{Username: "manager2", Role: models.RoleManager},
+	} {
+		assert.NoError(t, users.Create(ctx, &user))
+	}
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	dispatcher := NewDispatcher(tasks.Outbox(), users, []Sink{{Name: "test", Notifier: notifier}}, logger.New())
+	return dispatcher, tasks, tasks.Outbox()
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	performedAt := time.Date(2024, 12, 29, 10, 30, 0, 0, time.UTC)
+
+	t.Run("notifies every manager", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		dispatcher, tasks, outbox := setupDispatcher(t, notifier)
+
+		assert.NoError(t, tasks.Create(ctx, &models.Task{
+			ID: "task1", TechnicianID: 1, Summary: "Replaced the faulty part", PerformedAt: performedAt,
+		}, 1))
+
+		delivered, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, 0, outbox.Pending(models.OutboxNotifications))
+
+		assert.Len(t, notifier.notifications, 2)
+		first := notifier.notifications[0]
+		assert.Equal(t, TypeTaskPerformed, first.Type)
+		assert.Equal(t, "manager1", first.Recipient.Username)
+		assert.Equal(t, "manager1@example.com", first.Recipient.Email)
+		assert.Contains(t, first.Body, "john_tech")
+		assert.Contains(t, first.Body, "Replaced the faulty part")
+		assert.Contains(t, first.Body, "2024-12-29")
+		assert.Equal(t, "manager2", notifier.notifications[1].Recipient.Username)
+
+		// Nothing left to send
+		delivered, err = dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+	})
+
+	t.Run("teams limit notifications to the technician's managers", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		dispatcher, tasks, _ := setupDispatcher(t, notifier)
+		teams := repository.NewMemoryTeamRepository(dispatcher.users.(*repository.MemoryUserRepository))
+		team := models.Team{Name: "Crew"}
+		assert.NoError(t, teams.Create(ctx, &team))
+		assert.NoError(t, teams.SetMember(ctx, &models.TeamMember{TeamID: team.ID, UserID: 1, Role: models.TeamRoleMember}))
+		assert.NoError(t, teams.SetMember(ctx, &models.TeamMember{TeamID: team.ID, UserID: 3, Role: models.TeamRoleManager}))
+		dispatcher.Teams = teams
+
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, PerformedAt: performedAt}, 1))
+		_, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, notifier.notifications, 1) {
+			assert.Equal(t, "manager2", notifier.notifications[0].Recipient.Username)
+		}
+	})
+
+	t.Run("managers of other organizations are not notified", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		dispatcher, tasks, _ := setupDispatcher(t, notifier)
+		outsider := models.User{OrganizationID: 2, Username: "outsider", Role: models.RoleManager}
+		assert.NoError(t, dispatcher.users.(*repository.MemoryUserRepository).Create(ctx, &outsider))
+
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, PerformedAt: performedAt}, 1))
+		_, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, notifier.notifications, 2)
+		for _, n := range notifier.notifications {
+			assert.NotEqual(t, "outsider", n.Recipient.Username)
+		}
+	})
+
+	t.Run("failed delivery is retried with backoff", func(t *testing.T) {
+		notifier := &recordingNotifier{err: errors.New("sink down")}
+		dispatcher, tasks, outbox := setupDispatcher(t, notifier)
+
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, PerformedAt: performedAt}, 1))
+
+		delivered, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		assert.Equal(t, 1, outbox.Pending(models.OutboxNotifications))
+
+		// The retry is scheduled in the future, so the message is not claimed again yet
+		delivered, err = dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		messages, err := outbox.Claim(ctx, models.OutboxNotifications, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Empty(t, messages)
+	})
+
+	t.Run("message is discarded after max attempts", func(t *testing.T) {
+		notifier := &recordingNotifier{err: errors.New("sink down")}
+		dispatcher, tasks, outbox := setupDispatcher(t, notifier)
+		dispatcher.RetryBackoff = 0
+		dispatcher.MaxAttempts = 2
+
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, PerformedAt: performedAt}, 1))
+
+		_, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, outbox.Pending(models.OutboxNotifications))
+
+		_, err = dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, outbox.Pending(models.OutboxNotifications))
+	})
+
+	t.Run("encrypted summaries are decrypted", func(t *testing.T) {
+		keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+		assert.NoError(t, err)
+		sealed, err := keyring.Seal([]byte("Fixed the boiler at 12 Main St"), []byte("task1"))
+		assert.NoError(t, err)
+		payload, err := json.Marshal(models.TaskPerformedPayload{
+			TaskID: "task1", TechnicianID: 1, EncryptedSummary: &sealed, PerformedAt: performedAt,
+		})
+		assert.NoError(t, err)
+		message := models.OutboxMessage{EventType: models.EventTaskPerformed, Payload: payload}
+
+		dispatcher, _, _ := setupDispatcher(t, &recordingNotifier{})
+		_, err = dispatcher.notifications(ctx, message)
+		assert.Error(t, err, "no keyring configured")
+
+		dispatcher.Keyring = keyring
+		notifications, err := dispatcher.notifications(ctx, message)
+		assert.NoError(t, err)
+		if assert.Len(t, notifications, 2) {
+			assert.Contains(t, notifications[0].Body, "Fixed the boiler at 12 Main St")
+			data := notifications[0].Data.(models.TaskPerformedPayload)
+			assert.Nil(t, data.EncryptedSummary)
+		}
+	})
+
+	t.Run("mentioned users are notified", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		dispatcher, tasks, _ := setupDispatcher(t, notifier)
+		users := dispatcher.users.(*repository.MemoryUserRepository)
+		comments := repository.NewMemoryCommentRepository(tasks)
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, Status: models.StatusInProgress, PerformedAt: performedAt}, 1))
+		assert.NoError(t, users.SetActive(ctx, 3, false))
+
+		assert.NoError(t, comments.Create(ctx, &models.TaskComment{
+			TaskID: "task1", AuthorID: 2, Body: "@john_tech was the seal replaced? cc @manager2", Mentions: []int64{1, 3},
+		}))
+		delivered, err := dispatcher.DispatchPending(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+
+		// Deactivated users are skipped
+		if assert.Len(t, notifier.notifications, 1) {
+			n := notifier.notifications[0]
+			assert.Equal(t, TypeCommentMentioned, n.Type)
+			assert.Equal(t, "john_tech", n.Recipient.Username)
+			assert.Equal(t, "manager1 mentioned you on a task", n.Subject)
+			assert.Contains(t, n.Body, "task1")
+			assert.Contains(t, n.Body, "was the seal replaced?")
+		}
+	})
+
+	t.Run("unknown event type is an error", func(t *testing.T) {
+		dispatcher, _, _ := setupDispatcher(t, &recordingNotifier{})
+		err := dispatcher.dispatch(ctx, models.OutboxMessage{EventType: "unknown"})
+		assert.Error(t, err)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, nil, nil, nil)
+	dispatcher.RetryBackoff = time.Second
+	dispatcher.MaxBackoff = 5 * time.Second
+
+	assert.Equal(t, time.Second, dispatcher.backoff(0))
+	assert.Equal(t, 2*time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 4*time.Second, dispatcher.backoff(2))
+	assert.Equal(t, 5*time.Second, dispatcher.backoff(3))
+}
+
+func TestLogNotifier(t *testing.T) {
+	var out bytes.Buffer
+	notifier := NewLogNotifier(&logger.Logger{Logger: slog.New(slog.NewJSONHandler(&out, nil))})
+
+	err := notifier.Notify(context.Background(), Notification{
+		Type:      TypeTaskPerformed,
+		Recipient: Recipient{Username: "manager1"},
+		Subject:   "tech1 performed a task",
+		Body:      `Technician tech1 performed task "Fixed the boiler at 12 Main St"`,
+		Data:      models.TaskPerformedPayload{TaskID: "task1", Summary: "Fixed the boiler at 12 Main St"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "manager1")
+	assert.Contains(t, out.String(), "tech1 performed a task")
+	assert.NotContains(t, out.String(), "Main St", "summaries are kept out of the log")
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sender := &mail.MemorySender{}
+	notifier := NewEmailNotifier(sender)
+
+	err := notifier.Notify(context.Background(), Notification{
+		Recipient: Recipient{Username: "manager1", Email: "manager1@example.com"},
+		Subject:   "Subject",
+		Body:      "Body",
+	})
+	assert.NoError(t, err)
+
+	// Recipients without an email address are skipped
+	err = notifier.Notify(context.Background(), Notification{Recipient: Recipient{Username: "manager2"}})
+	assert.NoError(t, err)
+
+	messages := sender.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, []string{"manager1@example.com"}, messages[0].To)
+	assert.Equal(t, "Subject", messages[0].Subject)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	t.Run("posts the notification as JSON", func(t *testing.T) {
+		var received Notification
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		err := NewWebhookNotifier(server.URL).Notify(context.Background(), Notification{
+			Type:      TypeTaskPerformed,
+			Recipient: Recipient{Username: "manager1"},
+			Subject:   "Subject",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, TypeTaskPerformed, received.Type)
+		assert.Equal(t, "manager1", received.Recipient.Username)
+	})
+
+	t.Run("non-2xx response is an error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		err := NewWebhookNotifier(server.URL).Notify(context.Background(), Notification{})
+		assert.Error(t, err)
+	})
+}
+
+func TestDispatcherRetriesOnlyFailedDeliveries(t *testing.T) {
+	ctx := context.Background()
+	ok := &recordingNotifier{}
+	failing := &recordingNotifier{err: errors.New("sink down")}
+	dispatcher, tasks, outbox := setupDispatcher(t, ok)
+	dispatcher.sinks = append(dispatcher.sinks, Sink{Name: "failing", Notifier: failing})
+	dispatcher.RetryBackoff = 0
+
+	assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task1", TechnicianID: 1, PerformedAt: time.Now()}, 1))
+
+	delivered, err := dispatcher.DispatchPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, ok.notifications, 2, "a failing sink must not stop the others")
+
+	// Once the failing sink recovers the retry only goes through it
+	failing.err = nil
+	ok.notifications = nil
+	delivered, err = dispatcher.DispatchPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Empty(t, ok.notifications, "deliveries that succeeded are not repeated")
+	assert.Len(t, failing.notifications, 2)
+	assert.Equal(t, 0, outbox.Pending(models.OutboxNotifications))
+}
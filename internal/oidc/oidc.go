@@ -0,0 +1,362 @@
+// Package oidc logs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/makcim392/maintenance-api/internal/auth"
+)
+
+const (
+	// discoveryPath is where providers publish their metadata, relative to the issuer
+	discoveryPath = "/.well-known/openid-configuration"
+	// keyRefreshInterval limits how often the keys of the provider are fetched
+	// again for ID tokens signed with a key that is not known yet
+	keyRefreshInterval = time.Minute
+	// maxResponseSize bounds the documents read from the provider
+	maxResponseSize = 1 << 20
+)
+
+// ErrInvalidIDToken is returned for an ID token that was not issued by the
+// provider for this client and this login
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Config identifies the provider and the client registered with it
+type Config struct {
+	// IssuerURL is the issuer of the provider, its metadata is discovered below it
+	IssuerURL string
+	ClientID  string
+	// ClientSecret authenticates the client at the token endpoint, public
+	// clients rely on PKCE alone
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back with the code
+	RedirectURL string
+	// Scopes are requested on top of openid
+	Scopes []string
+}
+
+// Metadata is the part of the discovery document of a provider the client uses
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	// AMR lists the authentication methods used at the provider (RFC 8176)
+	AMR []string
+	// Claims holds every claim of the token, for the ones named in the configuration
+	Claims map[string]interface{}
+}
+
+// Strings returns a claim holding a string or a list of strings, such as a
+// list of groups, nil when the token does not carry it
+func (t *IDToken) Strings(claim string) []string {
+	switch value := t.Claims[claim].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Client logs users in at a provider. The metadata and keys of the provider
+// are fetched on first use, so the API starts while the provider is down.
+type Client struct {
+	config Config
+	http   *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          *auth.KeySet
+	keysFetchedAt time.Time
+}
+
+// NewClient creates a client for the provider, httpClient may be nil to use
+// one with a 10 second timeout
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		config: config,
+		http:   httpClient,
+	}
+}
+
+// Issuer returns the issuer of the provider, which scopes the subjects of its users
+func (c *Client) Issuer() string {
+	return c.config.IssuerURL
+}
+
+// RedirectURL returns the callback URL the provider sends users back to
+func (c *Client) RedirectURL() string {
+	return c.config.RedirectURL
+}
+
+// AuthCodeURL returns the authorization endpoint URL the user is sent to,
+// with the state and nonce of the login and the S256 challenge of the verifier
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.config.ClientID)
+	query.Set("redirect_uri", c.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, c.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", Challenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// tokenResponse is the answer of the token endpoint, or its error
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the code the provider sent the user back with and returns
+// the raw ID token, which still has to be verified
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {c.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.config.ClientSecret != "" {
+		// client_secret_basic form encodes both values (RFC 6749 section 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no ID token")
+	}
+	return token.IDToken, nil
+}
+
+// Verify checks the signature of an ID token against the keys of the
+// provider, its issuer, audience and expiry, and that it carries the nonce of
+// the login
+func (c *Client) Verify(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	metadata, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, c.keyfunc(ctx),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case !claims.VerifyExpiresAt(time.Now().Unix(), true):
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+	case !claims.VerifyIssuer(metadata.Issuer, true):
+		return nil, fmt.Errorf("%w: issued by %v", ErrInvalidIDToken, claims["iss"])
+	case !claims.VerifyAudience(c.config.ClientID, true):
+		return nil, fmt.Errorf("%w: issued for another client", ErrInvalidIDToken)
+	}
+	// A token issued for several clients names the one it was requested by
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 && claims["azp"] != c.config.ClientID {
+		return nil, fmt.Errorf("%w: requested by another client", ErrInvalidIDToken)
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce does not match the login", ErrInvalidIDToken)
+	}
+
+	token := &IDToken{Claims: claims}
+	token.Issuer, _ = claims["iss"].(string)
+	token.Subject, _ = claims["sub"].(string)
+	token.Email, _ = claims["email"].(string)
+	token.Name, _ = claims["name"].(string)
+	token.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string
+	token.EmailVerified = claims["email_verified"] == true || claims["email_verified"] == "true"
+	token.AMR = token.Strings("amr")
+	if token.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	return token, nil
+}
+
+// keyfunc resolves the key of an ID token, fetching the keys of the provider
+// again when the token is signed with one that is not known yet
+func (c *Client) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		keys, err := c.keySet(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		key, err := keys.Keyfunc(token)
+		if !errors.Is(err, auth.ErrUnknownKey) {
+			return key, err
+		}
+		// The provider may have rotated its keys
+		if keys, err = c.keySet(ctx, true); err != nil {
+			return nil, err
+		}
+		return keys.Keyfunc(token)
+	}
+}
+
+// keySet returns the keys of the provider, fetched again on refresh unless
+// they were fetched less than keyRefreshInterval ago
+func (c *Client) keySet(ctx context.Context, refresh bool) (*auth.KeySet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys != nil && (!refresh || time.Since(c.keysFetchedAt) < keyRefreshInterval) {
+		return c.keys, nil
+	}
+
+	metadata, err := c.discoverLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.get(ctx, metadata.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("fetching provider keys: %w", err)
+	}
+	keys, err := auth.ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	set, err := auth.NewVerificationKeySet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	c.keys, c.keysFetchedAt = set, time.Now()
+	return set, nil
+}
+
+// discover returns the metadata of the provider, fetching it on first use
+func (c *Client) discover(ctx context.Context) (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discoverLocked(ctx)
+}
+
+func (c *Client) discoverLocked(ctx context.Context) (*Metadata, error) {
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	data, err := c.get(ctx, strings.TrimSuffix(c.config.IssuerURL, "/")+discoveryPath)
+	if err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid provider metadata: %w", err)
+	}
+
+	// The issuer must be the one configured, or the provider could vouch for
+	// the users of another one
+	if metadata.Issuer != c.config.IssuerURL {
+		return nil, fmt.Errorf("provider metadata names issuer %q instead of %q", metadata.Issuer, c.config.IssuerURL)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider metadata lacks the authorization, token or keys endpoint")
+	}
+	if len(metadata.CodeChallengeMethods) > 0 && !contains(metadata.CodeChallengeMethods, "S256") {
+		return nil, errors.New("provider does not support S256 PKCE challenges")
+	}
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+// get fetches a JSON document from the provider
+func (c *Client) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	provider := oidctest.NewProvider("maintenance-api", "client-secret")
+	defer provider.Close()
+	client := NewClient(Config{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     "maintenance-api",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://api.example.com/oidc/callback",
+		Scopes:       []string{"email", "groups"},
+	}, nil)
+
+	// login runs the flow up to the code, returning the callback query
+	login := func(t *testing.T, nonce, verifier string) url.Values {
+		t.Helper()
+		authURL, err := client.AuthCodeURL(ctx, "the-state", nonce, verifier)
+		assert.NoError(t, err)
+		callback, err := provider.Authorize(authURL)
+		assert.NoError(t, err)
+		assert.Equal(t, "api.example.com", callback.Host)
+		return callback.Query()
+	}
+	provider.SetUser(map[string]interface{}{
+		"sub": "user-1", "email": "alice@example.com", "email_verified": "true",
+		"preferred_username": "alice", "groups": []string{"maintenance", "admins"}, "amr": []string{"pwd", "mfa"},
+	})
+
+	t.Run("authorization URL", func(t *testing.T) {
+		authURL, err := client.AuthCodeURL(ctx, "the-state", "the-nonce", "the-verifier")
+		assert.NoError(t, err)
+		parsed, err := url.Parse(authURL)
+		assert.NoError(t, err)
+		query := parsed.Query()
+		assert.Equal(t, provider.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+		assert.Equal(t, "code", query.Get("response_type"))
+		assert.Equal(t, "openid email groups", query.Get("scope"))
+		assert.Equal(t, "the-state", query.Get("state"))
+		assert.Equal(t, "the-nonce", query.Get("nonce"))
+		assert.Equal(t, Challenge("the-verifier"), query.Get("code_challenge"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	})
+
+	t.Run("code exchange and ID token", func(t *testing.T) {
+		verifier, err := NewVerifier()
+		assert.NoError(t, err)
+		callback := login(t, "nonce-1", verifier)
+		assert.Equal(t, "the-state", callback.Get("state"))
+
+		idToken, err := client.Exchange(ctx, callback.Get("code"), verifier)
+		assert.NoError(t, err)
+		token, err := client.Verify(ctx, idToken, "nonce-1")
+		assert.NoError(t, err)
+		assert.Equal(t, provider.Issuer(), token.Issuer)
+		assert.Equal(t, "user-1", token.Subject)
+		assert.Equal(t, "alice@example.com", token.Email)
+		assert.True(t, token.EmailVerified)
+		assert.Equal(t, "alice", token.PreferredUsername)
+		assert.Equal(t, []string{"maintenance", "admins"}, token.Strings("groups"))
+		assert.Equal(t, []string{"pwd", "mfa"}, token.AMR)
+		assert.Nil(t, token.Strings("roles"))
+
+		// The nonce ties the token to the login
+		_, err = client.Verify(ctx, idToken, "nonce-2")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+		// Codes are redeemed once
+		_, err = client.Exchange(ctx, callback.Get("code"), verifier)
+		assert.ErrorContains(t, err, "invalid_grant")
+	})
+
+	t.Run("the code needs the verifier of the challenge", func(t *testing.T) {
+		callback := login(t, "nonce", "the-verifier")
+		_, err := client.Exchange(ctx, callback.Get("code"), "another-verifier")
+		assert.ErrorContains(t, err, "invalid_grant")
+	})
+
+	t.Run("wrong client secret", func(t *testing.T) {
+		other := NewClient(Config{IssuerURL: provider.Issuer(), ClientID: "maintenance-api", ClientSecret: "wrong",
+			RedirectURL: "https://api.example.com/oidc/callback"}, nil)
+		callback := login(t, "nonce", "the-verifier")
+		_, err := other.Exchange(ctx, callback.Get("code"), "the-verifier")
+		assert.ErrorContains(t, err, "invalid_client")
+	})
+
+	t.Run("refused login", func(t *testing.T) {
+		provider.SetUser(nil)
+		defer provider.SetUser(map[string]interface{}{"sub": "user-1"})
+		callback := login(t, "nonce", "the-verifier")
+		assert.Equal(t, "access_denied", callback.Get("error"))
+	})
+
+	t.Run("ID token checks", func(t *testing.T) {
+		now := time.Now()
+		valid := func() map[string]interface{} {
+			return map[string]interface{}{"iss": provider.Issuer(), "aud": "maintenance-api", "sub": "user-1",
+				"nonce": "nonce", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+		}
+		for name, change := range map[string]func(claims map[string]interface{}){
+			"other issuer":      func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" },
+			"other audience":    func(claims map[string]interface{}) { claims["aud"] = "other-client" },
+			"several audiences": func(claims map[string]interface{}) { claims["aud"] = []string{"maintenance-api", "other-client"} },
+			"expired":           func(claims map[string]interface{}) { claims["exp"] = now.Add(-time.Minute).Unix() },
+			"no expiry":         func(claims map[string]interface{}) { delete(claims, "exp") },
+			"no subject":        func(claims map[string]interface{}) { delete(claims, "sub") },
+			"requested by other client": func(claims map[string]interface{}) {
+				claims["aud"] = []string{"maintenance-api", "other-client"}
+				claims["azp"] = "other-client"
+			},
+		} {
+			claims := valid()
+			change(claims)
+			token, err := provider.Sign(claims)
+			assert.NoError(t, err)
+			_, err = client.Verify(ctx, token, "nonce")
+			assert.ErrorIs(t, err, ErrInvalidIDToken, name)
+		}
+
+		claims := valid()
+		claims["aud"] = []string{"maintenance-api", "other-client"}
+		claims["azp"] = "maintenance-api"
+		token, err := provider.Sign(claims)
+		assert.NoError(t, err)
+		_, err = client.Verify(ctx, token, "nonce")
+		assert.NoError(t, err)
+
+		// A token signed with a key of another provider
+		other := oidctest.NewProvider("maintenance-api", "")
+		defer other.Close()
+		forged, err := other.Sign(valid())
+		assert.NoError(t, err)
+		_, err = client.Verify(ctx, forged, "nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("rotated keys are fetched again", func(t *testing.T) {
+		assert.NoError(t, provider.RotateKey())
+		token, err := provider.Sign(map[string]interface{}{"iss": provider.Issuer(), "aud": "maintenance-api",
+			"sub": "user-1", "nonce": "nonce", "exp": time.Now().Add(time.Minute).Unix()})
+		assert.NoError(t, err)
+
+		// Not within a minute of the last fetch
+		_, err = client.Verify(ctx, token, "nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+
+		client.mu.Lock()
+		client.keysFetchedAt = time.Now().Add(-keyRefreshInterval)
+		client.mu.Unlock()
+		_, err = client.Verify(ctx, token, "nonce")
+		assert.NoError(t, err)
+	})
+}
+
+func TestDiscovery(t *testing.T) {
+	metadata := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, discoveryPath, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer":"` + metadata["issuer"] + `","authorization_endpoint":"` + metadata["authorization_endpoint"] +
+			`","token_endpoint":"https://idp/token","jwks_uri":"https://idp/jwks","code_challenge_methods_supported":["` + metadata["pkce"] + `"]}`))
+	}))
+	defer server.Close()
+
+	for name, tt := range map[string]struct {
+		metadata map[string]string
+		wantErr  string
+	}{
+		"valid":              {map[string]string{"issuer": server.URL, "authorization_endpoint": "https://idp/auth", "pkce": "S256"}, ""},
+		"other issuer":       {map[string]string{"issuer": "https://idp", "authorization_endpoint": "https://idp/auth", "pkce": "S256"}, "names issuer"},
+		"missing endpoint":   {map[string]string{"issuer": server.URL, "pkce": "S256"}, "lacks"},
+		"plain PKCE only":    {map[string]string{"issuer": server.URL, "authorization_endpoint": "https://idp/auth", "pkce": "plain"}, "S256"},
+		"unreachable issuer": {nil, "discovering provider"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			metadata = tt.metadata
+			issuer := server.URL
+			if tt.metadata == nil {
+				issuer = "http://127.0.0.1:1"
+			}
+			client := NewClient(Config{IssuerURL: issuer, ClientID: "client"}, nil)
+			_, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636 appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+
+	verifier, err := NewVerifier()
+	assert.NoError(t, err)
+	assert.Len(t, verifier, 43)
+	other, err := NewVerifier()
+	assert.NoError(t, err)
+	assert.NotEqual(t, verifier, other)
+}
@@ -0,0 +1,451 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryUserRepository is an in-memory UserRepository for tests and local development
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	users  map[uint]models.User
+	// inUse reports whether tasks reference a user, set by NewMemoryTaskRepository
+	inUse func(id uint) bool
+}
+
+// NewMemoryUserRepository creates an empty MemoryUserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		nextID: 1,
+		users:  make(map[uint]models.User),
+	}
+}
+
+// Create stores a new user and assigns it the next free ID, in
+// user.OrganizationID or else the organization of the context
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+
+	now := time.Now().UTC()
+	user.ID = r.nextID
+	user.OrganizationID = organizationFor(ctx, user.OrganizationID)
+	user.Active = true
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.nextID++
+	r.users[user.ID] = *user
+	return nil
+}
+
+// GetByUsername returns the user with the given username
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.Username == username && visible(ctx, u.OrganizationID) {
+			user := u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByID returns the user with the given ID
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || !visible(ctx, user.OrganizationID) {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+// ListByRole returns every active user with the given role ordered by ID
+func (r *MemoryUserRepository) ListByRole(ctx context.Context, role models.Role) ([]models.User, error) {
+	var users []models.User
+	all, _ := r.List(ctx)
+	for _, u := range all {
+		if u.Role == role && u.Active {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// List returns every user ordered by ID
+func (r *MemoryUserRepository) List(ctx context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, u := range r.users {
+		if visible(ctx, u.OrganizationID) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// UpdateRole changes the role of a user
+func (r *MemoryUserRepository) UpdateRole(ctx context.Context, id uint, role models.Role) error {
+	return r.update(ctx, id, func(user *models.User) {
+		user.Role = role
+	})
+}
+
+// SetActive deactivates or reactivates a user
+func (r *MemoryUserRepository) SetActive(ctx context.Context, id uint, active bool) error {
+	return r.update(ctx, id, func(user *models.User) {
+		user.Active = active
+	})
+}
+
+// UpdatePassword replaces the password hash of a user
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, id uint, passwordHash string) error {
+	return r.update(ctx, id, func(user *models.User) {
+		user.Password = passwordHash
+	})
+}
+
+func (r *MemoryUserRepository) update(ctx context.Context, id uint, change func(user *models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || !visible(ctx, user.OrganizationID) {
+		return ErrNotFound
+	}
+	change(&user)
+	user.UpdatedAt = time.Now().UTC()
+	r.users[id] = user
+	return nil
+}
+
+// IsActive reports whether a user exists and is active
+func (r *MemoryUserRepository) IsActive(ctx context.Context, id uint) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user := r.users[id]
+	return user.Active && visible(ctx, user.OrganizationID), nil
+}
+
+// Delete removes a user, returning ErrInUse while tasks reference it
+func (r *MemoryUserRepository) Delete(ctx context.Context, id uint) error {
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return err
+	}
+	// Checked before locking, the task repository reads usernames under this lock
+	if r.inUse != nil && r.inUse(id) {
+		return ErrInUse
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// username returns the username for an ID, or an empty string if the user is unknown
+func (r *MemoryUserRepository) username(id uint) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.users[id].Username
+}
+
+// organization returns the organization of a user, 0 if the user is unknown
+func (r *MemoryUserRepository) organization(id uint) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.users[id].OrganizationID
+}
+
+// MemoryTaskRepository is an in-memory TaskRepository for tests and local development
+type MemoryTaskRepository struct {
+	mu          sync.RWMutex
+	tasks       map[string]models.Task
+	transitions map[string][]models.TaskTransition
+	nextID      int64
+	users       *MemoryUserRepository
+	outbox      *MemoryOutboxRepository
+	// onDelete is called with the ID of every deleted task, mirroring the
+	// cascading foreign keys of the records that belong to tasks
+	onDelete []func(id string)
+}
+
+// NewMemoryTaskRepository creates an empty MemoryTaskRepository. Technician
+// names are resolved against users, mirroring the JOIN done by the MySQL implementation.
+func NewMemoryTaskRepository(users *MemoryUserRepository) *MemoryTaskRepository {
+	r := &MemoryTaskRepository{
+		tasks:       make(map[string]models.Task),
+		transitions: make(map[string][]models.TaskTransition),
+		nextID:      1,
+		users:       users,
+		outbox:      NewMemoryOutboxRepository(),
+	}
+	// Mirror the foreign key from tasks to users
+	users.inUse = r.hasTechnician
+	return r
+}
+
+// hasTechnician reports whether any task was performed by the user
+func (r *MemoryTaskRepository) hasTechnician(id uint) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, task := range r.tasks {
+		if task.TechnicianID == int64(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether the task can be seen from ctx, tasks belong to the
+// organization of their technician
+func (r *MemoryTaskRepository) visible(ctx context.Context, task models.Task) bool {
+	return visible(ctx, r.organization(task))
+}
+
+// Outbox returns the outbox that task performed messages and task events are written to
+func (r *MemoryTaskRepository) Outbox() *MemoryOutboxRepository {
+	return r.outbox
+}
+
+// Create stores a new task, records its initial status and queues its
+// task.created event. Completed tasks also queue a task performed outbox message.
+func (r *MemoryTaskRepository) Create(ctx context.Context, task *models.Task, actorID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tasks[task.ID]; ok {
+		return ErrDuplicate
+	}
+	if task.Status == "" {
+		task.Status = models.StatusCompleted
+	}
+	if task.Status == models.StatusCompleted {
+		if err := r.outbox.enqueue(models.EventTaskPerformed, taskPerformedPayload(task)); err != nil {
+			return err
+		}
+	}
+	if err := r.outbox.enqueueEvent(events.NewTaskCreated(events.NewTaskData(*task), r.organization(*task), actorID)); err != nil {
+		return err
+	}
+	r.tasks[task.ID] = *task
+	r.appendTransition(&models.TaskTransition{TaskID: task.ID, To: task.Status, ActorID: task.TechnicianID})
+	return nil
+}
+
+// Get returns a task
+func (r *MemoryTaskRepository) Get(ctx context.Context, id string) (*models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok || !r.visible(ctx, task) {
+		return nil, ErrNotFound
+	}
+	return &task, nil
+}
+
+// Transition moves a task to a new status and records it in the history
+func (r *MemoryTaskRepository) Transition(ctx context.Context, transition *models.TaskTransition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[transition.TaskID]
+	if !ok || !r.visible(ctx, task) {
+		return ErrNotFound
+	}
+	if task.Status != transition.From {
+		return ErrConflict
+	}
+	if transition.To == models.StatusCompleted {
+		if err := r.outbox.enqueue(models.EventTaskPerformed, taskPerformedPayload(&task)); err != nil {
+			return err
+		}
+	}
+	if err := r.outbox.enqueueEvent(events.NewTaskTransitioned(*transition, r.organization(task))); err != nil {
+		return err
+	}
+
+	task.Status = transition.To
+	r.tasks[task.ID] = task
+	r.appendTransition(transition)
+	return nil
+}
+
+// Transitions returns the status history of a task, oldest first
+func (r *MemoryTaskRepository) Transitions(ctx context.Context, taskID string) ([]models.TaskTransition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if task, ok := r.tasks[taskID]; !ok || !r.visible(ctx, task) {
+		return nil, ErrNotFound
+	}
+	return append([]models.TaskTransition(nil), r.transitions[taskID]...), nil
+}
+
+// organization returns the organization of the technician of a task
+func (r *MemoryTaskRepository) organization(task models.Task) int64 {
+	return r.users.organization(uint(task.TechnicianID))
+}
+
+// appendTransition assigns an ID and timestamp and stores the transition. Callers hold r.mu.
+func (r *MemoryTaskRepository) appendTransition(transition *models.TaskTransition) {
+	transition.ID = r.nextID
+	transition.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.transitions[transition.TaskID] = append(r.transitions[transition.TaskID], *transition)
+}
+
+// Owner returns the technician ID of a task
+func (r *MemoryTaskRepository) Owner(ctx context.Context, id string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok || !r.visible(ctx, task) {
+		return 0, ErrNotFound
+	}
+	return task.TechnicianID, nil
+}
+
+// Update changes a task owned by task.TechnicianID and queues its task.updated event
+func (r *MemoryTaskRepository) Update(ctx context.Context, task *models.Task, actorID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[task.ID]
+	if !ok || stored.TechnicianID != task.TechnicianID || !r.visible(ctx, stored) {
+		return ErrNotFound
+	}
+	stored.Summary = task.Summary
+	stored.PerformedAt = task.PerformedAt
+	if err := r.outbox.enqueueEvent(events.NewTaskUpdated(events.NewTaskData(stored), r.organization(stored), actorID)); err != nil {
+		return err
+	}
+	r.tasks[task.ID] = stored
+	return nil
+}
+
+// List returns the tasks matching the filter, most recent first
+func (r *MemoryTaskRepository) List(ctx context.Context, filter TaskFilter) (TaskPage, error) {
+	order := filter.sort()
+	cursor, err := decodeTaskCursor(filter.Cursor, order)
+	if err != nil {
+		return TaskPage{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tasks []models.TaskWithTechnician
+	for _, task := range r.tasks {
+		if !r.visible(ctx, task) {
+			continue
+		}
+		if filter.TechnicianID != nil && task.TechnicianID != *filter.TechnicianID {
+			continue
+		}
+		if !matchesTechnicians(task.TechnicianID, filter.TechnicianIDs) {
+			continue
+		}
+		if filter.AssetID != nil && (task.AssetID == nil || *task.AssetID != *filter.AssetID) {
+			continue
+		}
+		if filter.Status != "" && task.Status != filter.Status {
+			continue
+		}
+		if filter.PerformedFrom != nil && task.PerformedAt.Before(*filter.PerformedFrom) {
+			continue
+		}
+		if filter.PerformedTo != nil && task.PerformedAt.After(*filter.PerformedTo) {
+			continue
+		}
+
+		item := models.TaskWithTechnician{
+			Task:           task,
+			TechnicianName: r.users.username(uint(task.TechnicianID)),
+		}
+		if filter.Query != "" && !matchesQuery(item, filter.Query) {
+			continue
+		}
+		if cursor != nil && !cursor.follows(item) {
+			continue
+		}
+		tasks = append(tasks, item)
+	}
+
+	sortTasks(tasks, order)
+	limit := filter.limit()
+	if len(tasks) > limit+1 {
+		tasks = tasks[:limit+1]
+	}
+	return newTaskPage(tasks, order, limit), nil
+}
+
+// referencesAsset reports whether any task was performed on the asset
+func (r *MemoryTaskRepository) referencesAsset(assetID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, task := range r.tasks {
+		if task.AssetID != nil && *task.AssetID == assetID {
+			return true
+		}
+	}
+	return false
+}
+
+// Exists reports whether the task is stored
+func (r *MemoryTaskRepository) Exists(ctx context.Context, id string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	return ok && r.visible(ctx, task), nil
+}
+
+// Delete removes a task and queues its task.deleted event
+func (r *MemoryTaskRepository) Delete(ctx context.Context, id string, actorID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[id]
+	if !ok || !r.visible(ctx, task) {
+		return ErrNotFound
+	}
+	if err := r.outbox.enqueueEvent(events.NewTaskDeleted(id, r.organization(task), actorID)); err != nil {
+		return err
+	}
+	delete(r.tasks, id)
+	delete(r.transitions, id)
+	for _, cascade := range r.onDelete {
+		cascade(id)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryAPIKeyRepository is an in-memory APIKeyRepository for tests and local development
+type MemoryAPIKeyRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	keys   map[int64]models.APIKey
+}
+
+// NewMemoryAPIKeyRepository creates an empty MemoryAPIKeyRepository
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{
+		nextID: 1,
+		keys:   make(map[int64]models.APIKey),
+	}
+}
+
+// Create stores a new API key in the organization of the context and assigns it the next free ID
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.Prefix == key.Prefix {
+			return ErrDuplicate
+		}
+	}
+
+	key.OrganizationID = organizationFor(ctx, key.OrganizationID)
+	key.ID = r.nextID
+	key.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.keys[key.ID] = copyAPIKey(*key)
+	return nil
+}
+
+// Get returns the API key with the given ID
+func (r *MemoryAPIKeyRepository) Get(ctx context.Context, id int64) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || !visible(ctx, key.OrganizationID) {
+		return nil, ErrNotFound
+	}
+	key = copyAPIKey(key)
+	return &key, nil
+}
+
+// GetByPrefix returns the API key with the given prefix. It is not scoped,
+// the organization is only known once the key is found.
+func (r *MemoryAPIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Prefix == prefix {
+			key := copyAPIKey(k)
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// List returns every API key ordered by ID
+func (r *MemoryAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]models.APIKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		if visible(ctx, k.OrganizationID) {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Revoke revokes an API key
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || !visible(ctx, key.OrganizationID) {
+		return ErrNotFound
+	}
+	if key.RevokedAt != nil {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	r.keys[id] = key
+	return nil
+}
+
+// Touch records that an API key was used at the given time
+func (r *MemoryAPIKeyRepository) Touch(ctx context.Context, id int64, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	at = at.UTC()
+	key.LastUsedAt = &at
+	r.keys[id] = key
+	return nil
+}
+
+// copyAPIKey returns a copy of the key that shares no slice with it
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Permissions = append([]models.Permission(nil), key.Permissions...)
+	return key
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAPIKeyRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryAPIKeyRepository()
+	expiresAt := time.Now().Add(time.Hour)
+
+	key := &models.APIKey{UserID: 1, Name: "cmms", Prefix: "abcd1234", KeyHash: "hash",
+		Permissions: []models.Permission{models.PermissionTaskReadOwn}, ExpiresAt: expiresAt}
+	assert.NoError(t, repo.Create(ctx, key))
+	assert.Equal(t, int64(1), key.ID)
+	assert.Equal(t, models.DefaultOrganizationID, key.OrganizationID)
+
+	t.Run("prefixes are unique", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Create(ctx, &models.APIKey{Prefix: "abcd1234", ExpiresAt: expiresAt}), ErrDuplicate)
+	})
+
+	t.Run("get by prefix is not scoped", func(t *testing.T) {
+		stored, err := repo.GetByPrefix(tenant.WithOrganization(ctx, 2), "abcd1234")
+		assert.NoError(t, err)
+		assert.Equal(t, key.ID, stored.ID)
+		assert.Equal(t, []models.Permission{models.PermissionTaskReadOwn}, stored.Permissions)
+
+		// The stored permissions are not shared with callers
+		stored.Permissions[0] = models.PermissionTaskReadAny
+		stored, _ = repo.Get(ctx, key.ID)
+		assert.Equal(t, models.PermissionTaskReadOwn, stored.Permissions[0])
+
+		_, err = repo.GetByPrefix(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("other organizations do not see the key", func(t *testing.T) {
+		other := tenant.WithOrganization(ctx, 2)
+		_, err := repo.Get(other, key.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		keys, err := repo.List(other)
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+		assert.ErrorIs(t, repo.Revoke(other, key.ID), ErrNotFound)
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		usedAt := time.Now()
+		assert.NoError(t, repo.Touch(ctx, key.ID, usedAt))
+		stored, _ := repo.Get(ctx, key.ID)
+		assert.True(t, usedAt.Equal(*stored.LastUsedAt))
+		assert.ErrorIs(t, repo.Touch(ctx, 99, usedAt), ErrNotFound)
+	})
+
+	t.Run("revoke once", func(t *testing.T) {
+		assert.NoError(t, repo.Revoke(ctx, key.ID))
+		assert.ErrorIs(t, repo.Revoke(ctx, key.ID), ErrConflict)
+		assert.ErrorIs(t, repo.Revoke(ctx, 99), ErrNotFound)
+
+		keys, err := repo.List(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, keys, 1)
+		assert.Equal(t, models.APIKeyRevoked, keys[0].Status(time.Now()))
+	})
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryAssetRepository is an in-memory AssetRepository for tests and local development
+type MemoryAssetRepository struct {
+	mu     sync.RWMutex
+	nextID int64
+	assets map[int64]models.Asset
+	tasks  *MemoryTaskRepository
+}
+
+// NewMemoryAssetRepository creates an empty MemoryAssetRepository. Deletes are
+// checked against tasks, mirroring the foreign key of the MySQL schema.
+func NewMemoryAssetRepository(tasks *MemoryTaskRepository) *MemoryAssetRepository {
+	return &MemoryAssetRepository{
+		nextID: 1,
+		assets: make(map[int64]models.Asset),
+		tasks:  tasks,
+	}
+}
+
+// Create stores a new asset in the organization of the context and assigns it the next free ID
+func (r *MemoryAssetRepository) Create(ctx context.Context, asset *models.Asset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	asset.OrganizationID = organizationFor(ctx, asset.OrganizationID)
+	if r.serialTaken(asset.OrganizationID, asset.SerialNumber, 0) {
+		return ErrDuplicate
+	}
+
+	now := time.Now().UTC()
+	asset.ID = r.nextID
+	asset.CreatedAt = now
+	asset.UpdatedAt = now
+	r.nextID++
+	r.assets[asset.ID] = copyAsset(*asset)
+	return nil
+}
+
+// Get returns an asset
+func (r *MemoryAssetRepository) Get(ctx context.Context, id int64) (*models.Asset, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	asset, ok := r.assets[id]
+	if !ok || !visible(ctx, asset.OrganizationID) {
+		return nil, ErrNotFound
+	}
+	asset = copyAsset(asset)
+	return &asset, nil
+}
+
+// List returns every asset ordered by ID
+func (r *MemoryAssetRepository) List(ctx context.Context) ([]models.Asset, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	assets := []models.Asset{}
+	for _, asset := range r.assets {
+		if visible(ctx, asset.OrganizationID) {
+			assets = append(assets, copyAsset(asset))
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].ID < assets[j].ID
+	})
+	return assets, nil
+}
+
+// Update changes every field of an asset but its ID and timestamps
+func (r *MemoryAssetRepository) Update(ctx context.Context, asset *models.Asset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.assets[asset.ID]
+	if !ok || !visible(ctx, stored.OrganizationID) {
+		return ErrNotFound
+	}
+	if r.serialTaken(stored.OrganizationID, asset.SerialNumber, asset.ID) {
+		return ErrDuplicate
+	}
+
+	asset.OrganizationID = stored.OrganizationID
+	asset.CreatedAt = stored.CreatedAt
+	asset.UpdatedAt = time.Now().UTC()
+	r.assets[asset.ID] = copyAsset(*asset)
+	return nil
+}
+
+// Exists reports whether the asset is stored
+func (r *MemoryAssetRepository) Exists(ctx context.Context, id int64) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	asset, ok := r.assets[id]
+	return ok && visible(ctx, asset.OrganizationID), nil
+}
+
+// Delete removes an asset that no task references
+func (r *MemoryAssetRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if asset, ok := r.assets[id]; !ok || !visible(ctx, asset.OrganizationID) {
+		return ErrNotFound
+	}
+	if r.tasks != nil && r.tasks.referencesAsset(id) {
+		return ErrInUse
+	}
+	delete(r.assets, id)
+	return nil
+}
+
+// serialTaken reports whether another asset of the organization than exceptID
+// uses the serial number. Callers hold r.mu.
+func (r *MemoryAssetRepository) serialTaken(organizationID int64, serial string, exceptID int64) bool {
+	for _, asset := range r.assets {
+		if asset.OrganizationID == organizationID && asset.SerialNumber == serial && asset.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// copyAsset detaches the metadata map so stored assets can not be changed through callers
+func copyAsset(asset models.Asset) models.Asset {
+	if asset.Metadata != nil {
+		metadata := make(map[string]string, len(asset.Metadata))
+		for k, v := range asset.Metadata {
+			metadata[k] = v
+		}
+		asset.Metadata = metadata
+	}
+	return asset
+}
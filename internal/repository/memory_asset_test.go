@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAssetRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tasks := NewMemoryTaskRepository(users)
+	repo := NewMemoryAssetRepository(tasks)
+
+	pump := models.Asset{SerialNumber: "PUMP-0001", Type: "pump", Metadata: map[string]string{"vendor": "Acme"}}
+	assert.NoError(t, repo.Create(ctx, &pump))
+	assert.Equal(t, int64(1), pump.ID)
+
+	t.Run("serial numbers are unique", func(t *testing.T) {
+		duplicate := models.Asset{SerialNumber: "PUMP-0001", Type: "pump"}
+		assert.ErrorIs(t, repo.Create(ctx, &duplicate), ErrDuplicate)
+	})
+
+	t.Run("stored metadata is detached from the caller", func(t *testing.T) {
+		pump.Metadata["vendor"] = "Changed"
+		stored, err := repo.Get(ctx, pump.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Acme", stored.Metadata["vendor"])
+	})
+
+	t.Run("update", func(t *testing.T) {
+		boiler := models.Asset{SerialNumber: "BOILER-1", Type: "boiler"}
+		assert.NoError(t, repo.Create(ctx, &boiler))
+
+		boiler.SerialNumber = "PUMP-0001"
+		assert.ErrorIs(t, repo.Update(ctx, &boiler), ErrDuplicate)
+
+		boiler.SerialNumber = "BOILER-1"
+		boiler.Location = "Basement"
+		assert.NoError(t, repo.Update(ctx, &boiler))
+
+		assets, err := repo.List(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, assets, 2) {
+			assert.Equal(t, "Basement", assets[1].Location)
+		}
+
+		missing := models.Asset{ID: 99, SerialNumber: "X", Type: "x"}
+		assert.ErrorIs(t, repo.Update(ctx, &missing), ErrNotFound)
+	})
+
+	t.Run("assets with maintenance history can not be deleted", func(t *testing.T) {
+		task := models.Task{ID: "task1", TechnicianID: 1, AssetID: &pump.ID, PerformedAt: time.Now()}
+		assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+		assert.ErrorIs(t, repo.Delete(ctx, pump.ID), ErrInUse)
+
+		assert.NoError(t, tasks.Delete(ctx, "task1", 1))
+		assert.NoError(t, repo.Delete(ctx, pump.ID))
+
+		exists, err := repo.Exists(ctx, pump.ID)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		assert.ErrorIs(t, repo.Delete(ctx, pump.ID), ErrNotFound)
+	})
+}
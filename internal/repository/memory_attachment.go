@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryAttachmentRepository is an in-memory AttachmentRepository for tests and local development
+type MemoryAttachmentRepository struct {
+	mu          sync.RWMutex
+	attachments map[string]models.Attachment
+	deletions   []string
+	tasks       *MemoryTaskRepository
+}
+
+// NewMemoryAttachmentRepository creates an empty MemoryAttachmentRepository.
+// Attachments are checked against tasks and removed with their task, which
+// queues their blobs for deletion.
+func NewMemoryAttachmentRepository(tasks *MemoryTaskRepository) *MemoryAttachmentRepository {
+	r := &MemoryAttachmentRepository{
+		attachments: make(map[string]models.Attachment),
+		tasks:       tasks,
+	}
+
+	tasks.mu.Lock()
+	tasks.onDelete = append(tasks.onDelete, r.deleteTask)
+	tasks.mu.Unlock()
+	return r
+}
+
+// deleteTask removes the attachments of a deleted task
+func (r *MemoryAttachmentRepository) deleteTask(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, attachment := range r.attachments {
+		if attachment.TaskID == taskID {
+			r.remove(id)
+		}
+	}
+}
+
+// remove deletes an attachment and queues its blobs, the caller holds r.mu
+func (r *MemoryAttachmentRepository) remove(id string) {
+	attachment := r.attachments[id]
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key != "" {
+			r.deletions = append(r.deletions, key)
+		}
+	}
+	delete(r.attachments, id)
+}
+
+// taskVisible reports whether the task exists and can be seen from ctx. It
+// is called before taking r.mu since deleting a task locks both repositories.
+func (r *MemoryAttachmentRepository) taskVisible(ctx context.Context, taskID string) bool {
+	exists, _ := r.tasks.Exists(ctx, taskID)
+	return exists
+}
+
+// Create stores a new attachment
+func (r *MemoryAttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	if !r.taskVisible(ctx, attachment.TaskID) {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.attachments[attachment.ID]; ok {
+		return ErrDuplicate
+	}
+	attachment.CreatedAt = time.Now().UTC()
+	r.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+// Get returns an attachment of a task
+func (r *MemoryAttachmentRepository) Get(ctx context.Context, taskID, id string) (*models.Attachment, error) {
+	if !r.taskVisible(ctx, taskID) {
+		return nil, ErrNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attachment, ok := r.attachments[id]
+	if !ok || attachment.TaskID != taskID {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+// List returns the attachments of a task, oldest first
+func (r *MemoryAttachmentRepository) List(ctx context.Context, taskID string) ([]models.Attachment, error) {
+	attachments := []models.Attachment{}
+	if !r.taskVisible(ctx, taskID) {
+		return attachments, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, attachment := range r.attachments {
+		if attachment.TaskID == taskID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments, nil
+}
+
+// Delete removes an attachment and queues its blobs for deletion
+func (r *MemoryAttachmentRepository) Delete(ctx context.Context, taskID, id string) error {
+	if !r.taskVisible(ctx, taskID) {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attachment, ok := r.attachments[id]; !ok || attachment.TaskID != taskID {
+		return ErrNotFound
+	}
+	r.remove(id)
+	return nil
+}
+
+// PendingBlobDeletions returns up to limit keys of queued blobs, oldest first
+func (r *MemoryAttachmentRepository) PendingBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if limit > len(r.deletions) {
+		limit = len(r.deletions)
+	}
+	return append([]string{}, r.deletions[:limit]...), nil
+}
+
+// ForgetBlobDeletions removes keys from the queue
+func (r *MemoryAttachmentRepository) ForgetBlobDeletions(ctx context.Context, keys []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	forget := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		forget[key] = true
+	}
+	pending := r.deletions[:0]
+	for _, key := range r.deletions {
+		if !forget[key] {
+			pending = append(pending, key)
+		}
+	}
+	r.deletions = pending
+	return nil
+}
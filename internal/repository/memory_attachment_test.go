@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryAttachmentRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tasks := NewMemoryTaskRepository(users)
+	repo := NewMemoryAttachmentRepository(tasks)
+
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Status: models.StatusInProgress, PerformedAt: time.Now()}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	photo := models.Attachment{ID: "a1", TaskID: task.ID, UploaderID: int64(tech.ID), FileName: "before.jpg",
+		ContentType: "image/jpeg", Size: 1024, StorageKey: "attachments/a1", ThumbnailKey: "attachments/a1-thumbnail"}
+	assert.NoError(t, repo.Create(ctx, &photo))
+	assert.False(t, photo.CreatedAt.IsZero())
+	report := models.Attachment{ID: "a2", TaskID: task.ID, UploaderID: int64(tech.ID), FileName: "report.pdf",
+		ContentType: "application/pdf", Size: 2048, StorageKey: "attachments/a2"}
+	assert.NoError(t, repo.Create(ctx, &report))
+
+	t.Run("attachments of unknown tasks", func(t *testing.T) {
+		orphan := models.Attachment{ID: "a3", TaskID: "missing", StorageKey: "attachments/a3"}
+		assert.ErrorIs(t, repo.Create(ctx, &orphan), ErrNotFound)
+		assert.ErrorIs(t, repo.Create(ctx, &models.Attachment{ID: "a1", TaskID: task.ID}), ErrDuplicate)
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		got, err := repo.Get(ctx, task.ID, photo.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "attachments/a1-thumbnail", got.ThumbnailKey)
+		_, err = repo.Get(ctx, "other", photo.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		attachments, err := repo.List(ctx, task.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, attachments, 2) {
+			assert.Equal(t, "a1", attachments[0].ID)
+			assert.Equal(t, "a2", attachments[1].ID)
+		}
+	})
+
+	t.Run("other organizations see nothing", func(t *testing.T) {
+		globex := tenant.WithOrganization(ctx, 2)
+		_, err := repo.Get(globex, task.ID, photo.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		attachments, err := repo.List(globex, task.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, attachments)
+		assert.ErrorIs(t, repo.Delete(globex, task.ID, photo.ID), ErrNotFound)
+	})
+
+	t.Run("delete queues the blobs", func(t *testing.T) {
+		assert.NoError(t, repo.Delete(ctx, task.ID, photo.ID))
+		assert.ErrorIs(t, repo.Delete(ctx, task.ID, photo.ID), ErrNotFound)
+
+		keys, err := repo.PendingBlobDeletions(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"attachments/a1", "attachments/a1-thumbnail"}, keys)
+
+		keys, err = repo.PendingBlobDeletions(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"attachments/a1"}, keys)
+		assert.NoError(t, repo.ForgetBlobDeletions(ctx, keys))
+		keys, err = repo.PendingBlobDeletions(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"attachments/a1-thumbnail"}, keys)
+		assert.NoError(t, repo.ForgetBlobDeletions(ctx, keys))
+	})
+
+	t.Run("attachments go with their task", func(t *testing.T) {
+		assert.NoError(t, tasks.Delete(ctx, task.ID, 1))
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: task.ID, TechnicianID: int64(tech.ID), PerformedAt: time.Now()}, int64(tech.ID)))
+
+		attachments, err := repo.List(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, attachments)
+		keys, err := repo.PendingBlobDeletions(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"attachments/a2"}, keys)
+	})
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryCommentRepository is an in-memory CommentRepository for tests and local development
+type MemoryCommentRepository struct {
+	mu             sync.RWMutex
+	nextID         int64
+	nextRevisionID int64
+	comments       map[int64]models.TaskComment
+	revisions      map[int64][]models.TaskCommentRevision
+	tasks          *MemoryTaskRepository
+}
+
+// NewMemoryCommentRepository creates an empty MemoryCommentRepository.
+// Comments are checked against tasks, queue their mention messages in the
+// outbox of tasks and are removed with their task.
+func NewMemoryCommentRepository(tasks *MemoryTaskRepository) *MemoryCommentRepository {
+	r := &MemoryCommentRepository{
+		nextID:         1,
+		nextRevisionID: 1,
+		comments:       make(map[int64]models.TaskComment),
+		revisions:      make(map[int64][]models.TaskCommentRevision),
+		tasks:          tasks,
+	}
+
+	tasks.mu.Lock()
+	tasks.onDelete = append(tasks.onDelete, r.deleteTask)
+	tasks.mu.Unlock()
+	return r
+}
+
+// deleteTask removes the comments of a deleted task
+func (r *MemoryCommentRepository) deleteTask(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, comment := range r.comments {
+		if comment.TaskID == taskID {
+			delete(r.comments, id)
+			delete(r.revisions, id)
+		}
+	}
+}
+
+// taskVisible reports whether the task exists and can be seen from ctx. It
+// is called before taking r.mu since deleting a task locks both repositories.
+func (r *MemoryCommentRepository) taskVisible(ctx context.Context, taskID string) bool {
+	exists, _ := r.tasks.Exists(ctx, taskID)
+	return exists
+}
+
+// Create stores a new comment and assigns it the next free ID
+func (r *MemoryCommentRepository) Create(ctx context.Context, comment *models.TaskComment) error {
+	if !r.taskVisible(ctx, comment.TaskID) {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	comment.ID = r.nextID
+	comment.AuthorName = r.tasks.users.username(uint(comment.AuthorID))
+	comment.CreatedAt = time.Now().UTC()
+	comment.EditedAt = nil
+	if payload, ok := commentMentionedPayload(comment, nil); ok {
+		if err := r.tasks.outbox.enqueue(models.EventCommentMentioned, payload); err != nil {
+			return err
+		}
+	}
+	r.nextID++
+	r.comments[comment.ID] = copyComment(*comment)
+	return nil
+}
+
+// Get returns a comment of a task
+func (r *MemoryCommentRepository) Get(ctx context.Context, taskID string, id int64) (*models.TaskComment, error) {
+	if !r.taskVisible(ctx, taskID) {
+		return nil, ErrNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	comment, ok := r.comments[id]
+	if !ok || comment.TaskID != taskID {
+		return nil, ErrNotFound
+	}
+	comment = r.withAuthor(comment)
+	return &comment, nil
+}
+
+// List returns the comments of a task, oldest first
+func (r *MemoryCommentRepository) List(ctx context.Context, taskID string) ([]models.TaskComment, error) {
+	comments := []models.TaskComment{}
+	if !r.taskVisible(ctx, taskID) {
+		return comments, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, comment := range r.comments {
+		if comment.TaskID == taskID {
+			comments = append(comments, r.withAuthor(comment))
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].ID < comments[j].ID
+	})
+	return comments, nil
+}
+
+// Update replaces the body and mentions of a comment, keeping the previous body as a revision
+func (r *MemoryCommentRepository) Update(ctx context.Context, comment *models.TaskComment) error {
+	if !r.taskVisible(ctx, comment.TaskID) {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.comments[comment.ID]
+	if !ok || stored.TaskID != comment.TaskID {
+		return ErrNotFound
+	}
+
+	editedAt := time.Now().UTC()
+	comment.EditedAt = &editedAt
+	if payload, ok := commentMentionedPayload(comment, stored.Mentions); ok {
+		if err := r.tasks.outbox.enqueue(models.EventCommentMentioned, payload); err != nil {
+			return err
+		}
+	}
+
+	written := stored.CreatedAt
+	if stored.EditedAt != nil {
+		written = *stored.EditedAt
+	}
+	r.revisions[stored.ID] = append(r.revisions[stored.ID], models.TaskCommentRevision{
+		ID:        r.nextRevisionID,
+		CommentID: stored.ID,
+		Body:      stored.Body,
+		CreatedAt: written,
+	})
+	r.nextRevisionID++
+
+	stored.Body = comment.Body
+	stored.Mentions = append([]int64{}, comment.Mentions...)
+	stored.EditedAt = comment.EditedAt
+	r.comments[stored.ID] = stored
+	return nil
+}
+
+// Revisions returns the previous bodies of a comment, oldest first
+func (r *MemoryCommentRepository) Revisions(ctx context.Context, taskID string, id int64) ([]models.TaskCommentRevision, error) {
+	revisions := []models.TaskCommentRevision{}
+	if !r.taskVisible(ctx, taskID) {
+		return revisions, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if comment, ok := r.comments[id]; !ok || comment.TaskID != taskID {
+		return revisions, nil
+	}
+	return append(revisions, r.revisions[id]...), nil
+}
+
+// Delete removes a comment and its revisions
+func (r *MemoryCommentRepository) Delete(ctx context.Context, taskID string, id int64) error {
+	if !r.taskVisible(ctx, taskID) {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if comment, ok := r.comments[id]; !ok || comment.TaskID != taskID {
+		return ErrNotFound
+	}
+	delete(r.comments, id)
+	delete(r.revisions, id)
+	return nil
+}
+
+// withAuthor returns a copy of a stored comment with the current username of
+// its author, mirroring the JOIN done by the MySQL implementation
+func (r *MemoryCommentRepository) withAuthor(comment models.TaskComment) models.TaskComment {
+	comment = copyComment(comment)
+	comment.AuthorName = r.tasks.users.username(uint(comment.AuthorID))
+	return comment
+}
+
+// copyComment returns a comment that shares no memory with the original
+func copyComment(comment models.TaskComment) models.TaskComment {
+	comment.Mentions = append([]int64{}, comment.Mentions...)
+	if comment.EditedAt != nil {
+		editedAt := *comment.EditedAt
+		comment.EditedAt = &editedAt
+	}
+	return comment
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCommentRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tasks := NewMemoryTaskRepository(users)
+	repo := NewMemoryCommentRepository(tasks)
+
+	manager := models.User{Username: "manager1", Role: models.RoleManager}
+	assert.NoError(t, users.Create(ctx, &manager))
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+	other := models.User{Username: "tech2", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &other))
+
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Status: models.StatusInProgress, PerformedAt: time.Now()}
+	assert.NoError(t, tasks.Create(ctx, &task, task.TechnicianID))
+
+	// mentioned returns the users of the mention messages queued since the last call
+	mentioned := func(t *testing.T) [][]int64 {
+		t.Helper()
+		messages, err := tasks.Outbox().Claim(ctx, models.OutboxNotifications, 10, time.Minute)
+		assert.NoError(t, err)
+		var users [][]int64
+		for _, message := range messages {
+			assert.Equal(t, models.EventCommentMentioned, message.EventType)
+			var payload models.CommentMentionedPayload
+			assert.NoError(t, json.Unmarshal(message.Payload, &payload))
+			assert.Equal(t, task.ID, payload.TaskID)
+			users = append(users, payload.UserIDs)
+			assert.NoError(t, tasks.Outbox().MarkProcessed(ctx, message.ID))
+		}
+		return users
+	}
+
+	comment := models.TaskComment{TaskID: task.ID, AuthorID: int64(manager.ID), Body: "Was the seal replaced, @tech1?",
+		Mentions: []int64{int64(tech.ID)}}
+	assert.NoError(t, repo.Create(ctx, &comment))
+	assert.Equal(t, int64(1), comment.ID)
+	assert.Equal(t, "manager1", comment.AuthorName)
+	assert.Equal(t, [][]int64{{int64(tech.ID)}}, mentioned(t))
+
+	t.Run("comments on unknown tasks", func(t *testing.T) {
+		missing := models.TaskComment{TaskID: "missing", AuthorID: int64(manager.ID), Body: "Hello"}
+		assert.ErrorIs(t, repo.Create(ctx, &missing), ErrNotFound)
+		_, err := repo.Get(ctx, "missing", comment.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("list oldest first", func(t *testing.T) {
+		reply := models.TaskComment{TaskID: task.ID, AuthorID: int64(tech.ID), Body: "Yes"}
+		assert.NoError(t, repo.Create(ctx, &reply))
+		assert.Empty(t, mentioned(t))
+
+		comments, err := repo.List(ctx, task.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, comments, 2) {
+			assert.Equal(t, comment.ID, comments[0].ID)
+			assert.Equal(t, []int64{int64(tech.ID)}, comments[0].Mentions)
+			assert.Equal(t, "tech1", comments[1].AuthorName)
+			assert.Empty(t, comments[1].Mentions)
+		}
+	})
+
+	t.Run("edits keep the previous bodies and notify new mentions only", func(t *testing.T) {
+		edit := comment
+		edit.Body = "Was the seal replaced, @tech1? Ask @tech2 otherwise."
+		edit.Mentions = []int64{int64(tech.ID), int64(other.ID)}
+		assert.NoError(t, repo.Update(ctx, &edit))
+		assert.NotNil(t, edit.EditedAt)
+		assert.Equal(t, [][]int64{{int64(other.ID)}}, mentioned(t))
+
+		edit.Body = "Was the seal replaced?"
+		edit.Mentions = nil
+		assert.NoError(t, repo.Update(ctx, &edit))
+		assert.Empty(t, mentioned(t))
+
+		stored, err := repo.Get(ctx, task.ID, comment.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Was the seal replaced?", stored.Body)
+		assert.Empty(t, stored.Mentions)
+		assert.Equal(t, comment.CreatedAt, stored.CreatedAt)
+
+		revisions, err := repo.Revisions(ctx, task.ID, comment.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, revisions, 2) {
+			assert.Equal(t, "Was the seal replaced, @tech1?", revisions[0].Body)
+			assert.Equal(t, comment.CreatedAt, revisions[0].CreatedAt)
+			assert.Equal(t, "Was the seal replaced, @tech1? Ask @tech2 otherwise.", revisions[1].Body)
+		}
+
+		missing := models.TaskComment{ID: 99, TaskID: task.ID, Body: "x"}
+		assert.ErrorIs(t, repo.Update(ctx, &missing), ErrNotFound)
+	})
+
+	t.Run("comments belong to their task", func(t *testing.T) {
+		second := models.Task{ID: "task2", TechnicianID: int64(tech.ID), Status: models.StatusInProgress, PerformedAt: time.Now()}
+		assert.NoError(t, tasks.Create(ctx, &second, second.TechnicianID))
+
+		_, err := repo.Get(ctx, second.ID, comment.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, second.ID, comment.ID), ErrNotFound)
+		comments, err := repo.List(ctx, second.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, comments)
+	})
+
+	t.Run("other organizations see nothing", func(t *testing.T) {
+		globex := tenant.WithOrganization(ctx, 2)
+		_, err := repo.Get(globex, task.ID, comment.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		comments, err := repo.List(globex, task.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, comments)
+		assert.ErrorIs(t, repo.Delete(globex, task.ID, comment.ID), ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, repo.Delete(ctx, task.ID, comment.ID))
+		_, err := repo.Get(ctx, task.ID, comment.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, task.ID, comment.ID), ErrNotFound)
+	})
+
+	t.Run("comments go with their task", func(t *testing.T) {
+		assert.NoError(t, tasks.Delete(ctx, task.ID, 1))
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: task.ID, TechnicianID: int64(tech.ID), PerformedAt: time.Now()}, int64(tech.ID)))
+
+		comments, err := repo.List(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, comments)
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryIdentityRepository is an in-memory IdentityRepository for tests and local development
+type MemoryIdentityRepository struct {
+	mu         sync.Mutex
+	nextID     int64
+	identities map[int64]models.Identity
+	users      *MemoryUserRepository
+}
+
+// NewMemoryIdentityRepository creates an empty MemoryIdentityRepository that
+// creates provisioned users in users
+func NewMemoryIdentityRepository(users *MemoryUserRepository) *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{
+		nextID:     1,
+		identities: make(map[int64]models.Identity),
+		users:      users,
+	}
+}
+
+// Create links an account to a user, in the organization of the context
+// unless identity.OrganizationID is set
+func (r *MemoryIdentityRepository) Create(ctx context.Context, identity *models.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(ctx, identity)
+}
+
+// create stores an identity, the caller holds the lock
+func (r *MemoryIdentityRepository) create(ctx context.Context, identity *models.Identity) error {
+	if r.linked(identity.Issuer, identity.Subject) {
+		return ErrDuplicate
+	}
+	identity.ID = r.nextID
+	identity.OrganizationID = organizationFor(ctx, identity.OrganizationID)
+	identity.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+func (r *MemoryIdentityRepository) linked(issuer, subject string) bool {
+	for _, i := range r.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBySubject returns the account with the given issuer and subject. It is
+// not scoped, the user logging in has no organization yet.
+func (r *MemoryIdentityRepository) GetBySubject(ctx context.Context, issuer, subject string) (*models.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			identity := i
+			return &identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Provision creates the user and links the account to it, holding the lock
+// throughout so an account is provisioned at most once
+func (r *MemoryIdentityRepository) Provision(ctx context.Context, identity *models.Identity, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.linked(identity.Issuer, identity.Subject) {
+		return ErrDuplicate
+	}
+	if err := r.users.Create(ctx, user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	identity.OrganizationID = user.OrganizationID
+	return r.create(ctx, identity)
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIdentityRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	repo := NewMemoryIdentityRepository(users)
+
+	identity := &models.Identity{UserID: 1, Issuer: "https://idp.example.com", Subject: "user-1"}
+	assert.NoError(t, repo.Create(ctx, identity))
+	assert.Equal(t, int64(1), identity.ID)
+	assert.Equal(t, models.DefaultOrganizationID, identity.OrganizationID)
+
+	t.Run("an account is linked once", func(t *testing.T) {
+		err := repo.Create(ctx, &models.Identity{UserID: 2, Issuer: "https://idp.example.com", Subject: "user-1"})
+		assert.ErrorIs(t, err, ErrDuplicate)
+
+		// The same subject at another provider is another account
+		assert.NoError(t, repo.Create(ctx, &models.Identity{UserID: 2, Issuer: "https://other.example.com", Subject: "user-1"}))
+	})
+
+	t.Run("get by subject is not scoped", func(t *testing.T) {
+		stored, err := repo.GetBySubject(tenant.WithOrganization(ctx, 2), "https://idp.example.com", "user-1")
+		assert.NoError(t, err)
+		assert.Equal(t, identity.ID, stored.ID)
+		assert.Equal(t, uint(1), stored.UserID)
+
+		_, err = repo.GetBySubject(ctx, "https://idp.example.com", "user-2")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("provision", func(t *testing.T) {
+		user := &models.User{Username: "alice", Role: models.RoleTechnician, OrganizationID: 2}
+		provisioned := &models.Identity{Issuer: "https://idp.example.com", Subject: "user-2"}
+		assert.NoError(t, repo.Provision(ctx, provisioned, user))
+		assert.NotZero(t, user.ID)
+		assert.Equal(t, user.ID, provisioned.UserID)
+		assert.Equal(t, int64(2), provisioned.OrganizationID)
+
+		stored, err := users.GetByUsername(ctx, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), stored.OrganizationID)
+
+		// Neither a known username nor a linked account creates a user
+		err = repo.Provision(ctx, &models.Identity{Issuer: "https://idp.example.com", Subject: "user-3"},
+			&models.User{Username: "alice", Role: models.RoleTechnician})
+		assert.ErrorIs(t, err, ErrDuplicate)
+		_, err = repo.GetBySubject(ctx, "https://idp.example.com", "user-3")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		err = repo.Provision(ctx, &models.Identity{Issuer: "https://idp.example.com", Subject: "user-2"},
+			&models.User{Username: "alice2", Role: models.RoleTechnician})
+		assert.ErrorIs(t, err, ErrDuplicate)
+		_, err = users.GetByUsername(ctx, "alice2")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
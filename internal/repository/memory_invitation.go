@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryInvitationRepository is an in-memory InvitationRepository for tests and local development
+type MemoryInvitationRepository struct {
+	mu          sync.Mutex
+	nextID      int64
+	invitations map[int64]models.Invitation
+	users       *MemoryUserRepository
+}
+
+// NewMemoryInvitationRepository creates an empty MemoryInvitationRepository
+// that registers accepted invitations in users
+func NewMemoryInvitationRepository(users *MemoryUserRepository) *MemoryInvitationRepository {
+	return &MemoryInvitationRepository{
+		nextID:      1,
+		invitations: make(map[int64]models.Invitation),
+		users:       users,
+	}
+}
+
+// Create stores a new invitation in the organization of the context and assigns it the next free ID
+func (r *MemoryInvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation.OrganizationID = organizationFor(ctx, invitation.OrganizationID)
+	for _, i := range r.invitations {
+		if i.TokenID == invitation.TokenID {
+			return ErrDuplicate
+		}
+	}
+
+	invitation.ID = r.nextID
+	invitation.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.invitations[invitation.ID] = *invitation
+	return nil
+}
+
+// Get returns the invitation with the given ID
+func (r *MemoryInvitationRepository) Get(ctx context.Context, id int64) (*models.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[id]
+	if !ok || !visible(ctx, invitation.OrganizationID) {
+		return nil, ErrNotFound
+	}
+	return &invitation, nil
+}
+
+// GetByTokenID returns the invitation issued with the token with the given
+// jti. It is not scoped, the invitee has no organization yet.
+func (r *MemoryInvitationRepository) GetByTokenID(ctx context.Context, tokenID string) (*models.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.invitations {
+		if i.TokenID == tokenID {
+			invitation := i
+			return &invitation, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// List returns every invitation ordered by ID
+func (r *MemoryInvitationRepository) List(ctx context.Context) ([]models.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitations := make([]models.Invitation, 0, len(r.invitations))
+	for _, i := range r.invitations {
+		if visible(ctx, i.OrganizationID) {
+			invitations = append(invitations, i)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+	return invitations, nil
+}
+
+// Revoke revokes a pending invitation
+func (r *MemoryInvitationRepository) Revoke(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[id]
+	if !ok || !visible(ctx, invitation.OrganizationID) {
+		return ErrNotFound
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	invitation.RevokedAt = &now
+	r.invitations[id] = invitation
+	return nil
+}
+
+// Accept creates the user in the organization of the invitation and marks the
+// invitation as accepted, holding the lock throughout so an invitation is
+// accepted at most once
+func (r *MemoryInvitationRepository) Accept(ctx context.Context, tokenID string, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, invitation := range r.invitations {
+		if invitation.TokenID != tokenID {
+			continue
+		}
+		if invitation.Status(now) != models.InvitationPending {
+			return ErrConflict
+		}
+		user.OrganizationID = invitation.OrganizationID
+		if err := r.users.Create(ctx, user); err != nil {
+			return err
+		}
+		invitation.AcceptedAt = &now
+		invitation.AcceptedBy = &user.ID
+		r.invitations[id] = invitation
+		return nil
+	}
+	return ErrConflict
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryInvitationRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	repo := NewMemoryInvitationRepository(users)
+	expiresAt := time.Now().Add(time.Hour)
+
+	invite := func(tokenID string, expiresAt time.Time) *models.Invitation {
+		invitation := &models.Invitation{TokenID: tokenID, Email: tokenID + "@example.com", Role: models.RoleManager,
+			InvitedBy: 1, ExpiresAt: expiresAt}
+		assert.NoError(t, repo.Create(ctx, invitation))
+		return invitation
+	}
+	first := invite("jti-1", expiresAt)
+	assert.Equal(t, int64(1), first.ID)
+
+	t.Run("token IDs are unique", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Create(ctx, &models.Invitation{TokenID: "jti-1", ExpiresAt: expiresAt}), ErrDuplicate)
+	})
+
+	t.Run("accept once", func(t *testing.T) {
+		manager := models.User{Username: "manager1", Role: models.RoleManager}
+		assert.NoError(t, repo.Accept(ctx, "jti-1", &manager))
+		assert.Equal(t, uint(1), manager.ID)
+
+		again := models.User{Username: "manager2", Role: models.RoleManager}
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-1", &again), ErrConflict)
+		_, err := users.GetByUsername(ctx, "manager2")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		stored, err := repo.GetByTokenID(ctx, "jti-1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.InvitationAccepted, stored.Status(time.Now()))
+		assert.Equal(t, manager.ID, *stored.AcceptedBy)
+		assert.ErrorIs(t, repo.Revoke(ctx, stored.ID), ErrConflict)
+	})
+
+	t.Run("duplicate username leaves the invitation pending", func(t *testing.T) {
+		second := invite("jti-2", expiresAt)
+		taken := models.User{Username: "manager1", Role: models.RoleManager}
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-2", &taken), ErrDuplicate)
+
+		stored, err := repo.Get(ctx, second.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.InvitationPending, stored.Status(time.Now()))
+	})
+
+	t.Run("revoked and expired invitations can not be accepted", func(t *testing.T) {
+		revoked := invite("jti-3", expiresAt)
+		assert.NoError(t, repo.Revoke(ctx, revoked.ID))
+		assert.ErrorIs(t, repo.Revoke(ctx, revoked.ID), ErrConflict)
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-3", &models.User{Username: "revoked"}), ErrConflict)
+
+		invite("jti-4", time.Now().Add(-time.Minute))
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-4", &models.User{Username: "late"}), ErrConflict)
+
+		assert.ErrorIs(t, repo.Accept(ctx, "unknown", &models.User{Username: "unknown"}), ErrConflict)
+		assert.ErrorIs(t, repo.Revoke(ctx, 99), ErrNotFound)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		invitations, err := repo.List(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, invitations, 4) {
+			assert.Equal(t, "jti-1", invitations[0].TokenID)
+			assert.Equal(t, "jti-4", invitations[3].TokenID)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryLoginAttemptRepository is an in-memory LoginAttemptRepository for tests and local development
+type MemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+// NewMemoryLoginAttemptRepository creates an empty MemoryLoginAttemptRepository
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{
+		attempts: make(map[string]models.LoginAttempts),
+	}
+}
+
+// Get returns the failures counted for a key
+func (r *MemoryLoginAttemptRepository) Get(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attempts, nil
+}
+
+// RecordFailure counts a failed login, starting over after window
+func (r *MemoryLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(at.Add(-window)) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at.UTC()
+	r.attempts[key] = attempts
+	return nil
+}
+
+// Reserve counts an attempt unless the key is locked out, under the same lock
+func (r *MemoryLoginAttemptRepository) Reserve(ctx context.Context, key string, at time.Time, policy auth.LockoutPolicy) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(at.Add(-policy.Window)) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	if until := policy.LockedUntil(&attempts); until.After(at) {
+		return until, nil
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at.UTC()
+	r.attempts[key] = attempts
+	return time.Time{}, nil
+}
+
+// Release takes back a reserved attempt
+func (r *MemoryLoginAttemptRepository) Release(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempts, ok := r.attempts[key]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		r.attempts[key] = attempts
+	}
+	return nil
+}
+
+// Reset forgets the failures of a key
+func (r *MemoryLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+// Purge deletes the keys whose last failure is older than before
+func (r *MemoryLoginAttemptRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for key, attempts := range r.attempts {
+		if attempts.LastFailureAt.Before(before) {
+			delete(r.attempts, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLoginAttemptRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryLoginAttemptRepository()
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	_, err := repo.Get(ctx, "user:alice")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, repo.RecordFailure(ctx, "user:alice", now, time.Hour))
+	assert.NoError(t, repo.RecordFailure(ctx, "user:alice", now.Add(time.Minute), time.Hour))
+	attempts, err := repo.Get(ctx, "user:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+	assert.True(t, now.Add(time.Minute).Equal(attempts.LastFailureAt))
+
+	t.Run("count starts over after the window", func(t *testing.T) {
+		assert.NoError(t, repo.RecordFailure(ctx, "user:alice", now.Add(3*time.Hour), time.Hour))
+		attempts, _ := repo.Get(ctx, "user:alice")
+		assert.Equal(t, 1, attempts.Failures)
+	})
+
+	t.Run("concurrent reservations stop at the lockout", func(t *testing.T) {
+		policy := auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		refused := 0
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				until, err := repo.Reserve(ctx, "user:bob", now, policy)
+				assert.NoError(t, err)
+				if !until.IsZero() {
+					mu.Lock()
+					refused++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 47, refused)
+		attempts, _ := repo.Get(ctx, "user:bob")
+		assert.Equal(t, 3, attempts.Failures)
+
+		// A released attempt no longer counts
+		assert.NoError(t, repo.Release(ctx, "user:bob"))
+		until, err := repo.Reserve(ctx, "user:bob", now, policy)
+		assert.NoError(t, err)
+		assert.True(t, until.IsZero())
+		assert.NoError(t, repo.Reset(ctx, "user:bob"))
+	})
+
+	t.Run("reset and purge", func(t *testing.T) {
+		assert.NoError(t, repo.RecordFailure(ctx, "ip:10.0.0.1", now, time.Hour))
+		assert.NoError(t, repo.Reset(ctx, "user:alice"))
+		_, err := repo.Get(ctx, "user:alice")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		purged, err := repo.Purge(ctx, now.Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+		_, err = repo.Get(ctx, "ip:10.0.0.1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryMFARepository is an in-memory MFARepository for tests and local development
+type MemoryMFARepository struct {
+	mu    sync.Mutex
+	totp  map[uint]models.TOTPEnrollment
+	codes map[uint]map[string]bool
+}
+
+// NewMemoryMFARepository creates an empty MemoryMFARepository
+func NewMemoryMFARepository() *MemoryMFARepository {
+	return &MemoryMFARepository{
+		totp:  make(map[uint]models.TOTPEnrollment),
+		codes: make(map[uint]map[string]bool),
+	}
+}
+
+// GetTOTP returns the TOTP enrollment of a user
+func (r *MemoryMFARepository) GetTOTP(ctx context.Context, userID uint) (*models.TOTPEnrollment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.totp[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &enrollment, nil
+}
+
+// StartTOTP stores a new unconfirmed enrollment
+func (r *MemoryMFARepository) StartTOTP(ctx context.Context, enrollment *models.TOTPEnrollment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.totp[enrollment.UserID]; ok && existing.Confirmed() {
+		return ErrConflict
+	}
+	enrollment.ConfirmedAt = nil
+	enrollment.LastUsedStep = 0
+	enrollment.CreatedAt = time.Now().UTC()
+	r.totp[enrollment.UserID] = *enrollment
+	return nil
+}
+
+// ConfirmTOTP confirms a pending enrollment and replaces the recovery codes
+func (r *MemoryMFARepository) ConfirmTOTP(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.totp[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if enrollment.Confirmed() {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	enrollment.ConfirmedAt = &now
+	enrollment.LastUsedStep = step
+	r.totp[userID] = enrollment
+	r.replaceCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+// UseTOTPStep records the step of an accepted code
+func (r *MemoryMFARepository) UseTOTPStep(ctx context.Context, userID uint, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.totp[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if step <= enrollment.LastUsedStep {
+		return ErrConflict
+	}
+	enrollment.LastUsedStep = step
+	r.totp[userID] = enrollment
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.codes[userID][codeHash]
+	if !ok || used {
+		return ErrNotFound
+	}
+	r.codes[userID][codeHash] = true
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user
+func (r *MemoryMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replaceCodes(userID, codeHashes)
+	return nil
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of a user
+func (r *MemoryMFARepository) RecoveryCodesLeft(ctx context.Context, userID uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	left := 0
+	for _, used := range r.codes[userID] {
+		if !used {
+			left++
+		}
+	}
+	return left, nil
+}
+
+// DeleteTOTP removes the enrollment and the recovery codes of a user
+func (r *MemoryMFARepository) DeleteTOTP(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.totp[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.totp, userID)
+	delete(r.codes, userID)
+	return nil
+}
+
+func (r *MemoryMFARepository) replaceCodes(userID uint, codeHashes []string) {
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	r.codes[userID] = codes
+}
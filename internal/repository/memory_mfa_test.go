@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMFARepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryMFARepository()
+
+	_, err := repo.GetTOTP(ctx, 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, repo.ConfirmTOTP(ctx, 1, 10, nil), ErrNotFound)
+
+	t.Run("pending enrollment can be restarted", func(t *testing.T) {
+		assert.NoError(t, repo.StartTOTP(ctx, &models.TOTPEnrollment{UserID: 1, Secret: "FIRST"}))
+		assert.NoError(t, repo.StartTOTP(ctx, &models.TOTPEnrollment{UserID: 1, Secret: "SECOND"}))
+		enrollment, err := repo.GetTOTP(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "SECOND", enrollment.Secret)
+		assert.False(t, enrollment.Confirmed())
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		assert.NoError(t, repo.ConfirmTOTP(ctx, 1, 100, []string{"hash-1", "hash-2"}))
+		assert.ErrorIs(t, repo.ConfirmTOTP(ctx, 1, 101, nil), ErrConflict)
+		assert.ErrorIs(t, repo.StartTOTP(ctx, &models.TOTPEnrollment{UserID: 1, Secret: "THIRD"}), ErrConflict)
+
+		enrollment, _ := repo.GetTOTP(ctx, 1)
+		assert.True(t, enrollment.Confirmed())
+		assert.Equal(t, int64(100), enrollment.LastUsedStep)
+	})
+
+	t.Run("steps are used once", func(t *testing.T) {
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, 1, 100), ErrConflict)
+		assert.NoError(t, repo.UseTOTPStep(ctx, 1, 101))
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, 1, 99), ErrConflict)
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, 2, 101), ErrNotFound)
+	})
+
+	t.Run("recovery codes are used once", func(t *testing.T) {
+		assert.NoError(t, repo.UseRecoveryCode(ctx, 1, "hash-1"))
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, 1, "hash-1"), ErrNotFound)
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, 2, "hash-2"), ErrNotFound)
+		left, err := repo.RecoveryCodesLeft(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, left)
+
+		assert.NoError(t, repo.ReplaceRecoveryCodes(ctx, 1, []string{"hash-3", "hash-4", "hash-5"}))
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, 1, "hash-2"), ErrNotFound)
+		left, _ = repo.RecoveryCodesLeft(ctx, 1)
+		assert.Equal(t, 3, left)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, repo.DeleteTOTP(ctx, 1))
+		assert.ErrorIs(t, repo.DeleteTOTP(ctx, 1), ErrNotFound)
+		left, _ := repo.RecoveryCodesLeft(ctx, 1)
+		assert.Zero(t, left)
+	})
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryOrganizationRepository is an in-memory OrganizationRepository for tests and local development
+type MemoryOrganizationRepository struct {
+	mu            sync.RWMutex
+	nextID        int64
+	organizations map[int64]models.Organization
+}
+
+// NewMemoryOrganizationRepository creates a MemoryOrganizationRepository
+// holding the default organization, like the migrations do
+func NewMemoryOrganizationRepository() *MemoryOrganizationRepository {
+	return &MemoryOrganizationRepository{
+		nextID: models.DefaultOrganizationID + 1,
+		organizations: map[int64]models.Organization{
+			models.DefaultOrganizationID: {
+				ID:        models.DefaultOrganizationID,
+				Slug:      "default",
+				Name:      "Default",
+				Settings:  models.OrganizationSettings{OpenRegistration: true},
+				CreatedAt: time.Now().UTC(),
+			},
+		},
+	}
+}
+
+// Create stores a new organization and assigns it the next free ID
+func (r *MemoryOrganizationRepository) Create(ctx context.Context, organization *models.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, o := range r.organizations {
+		if o.Slug == organization.Slug {
+			return ErrDuplicate
+		}
+	}
+	organization.ID = r.nextID
+	organization.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.organizations[organization.ID] = *organization
+	return nil
+}
+
+// Get returns the organization with the given ID
+func (r *MemoryOrganizationRepository) Get(ctx context.Context, id int64) (*models.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	organization, ok := r.organizations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &organization, nil
+}
+
+// GetBySlug returns the organization with the given slug
+func (r *MemoryOrganizationRepository) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, o := range r.organizations {
+		if o.Slug == slug {
+			organization := o
+			return &organization, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateSettings replaces the settings of an organization
+func (r *MemoryOrganizationRepository) UpdateSettings(ctx context.Context, id int64, settings models.OrganizationSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	organization, ok := r.organizations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	organization.Settings = settings
+	r.organizations[id] = organization
+	return nil
+}
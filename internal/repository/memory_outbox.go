@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+type memoryOutboxEntry struct {
+	topic       string
+	message     models.OutboxMessage
+	nextAttempt time.Time
+	processed   bool
+	lastError   string
+	deliveries  map[models.OutboxDelivery]bool
+}
+
+// MemoryOutboxRepository is an in-memory OutboxRepository for tests and local development
+type MemoryOutboxRepository struct {
+	mu      sync.Mutex
+	nextID  int64
+	entries []*memoryOutboxEntry
+	now     func() time.Time
+}
+
+// NewMemoryOutboxRepository creates an empty MemoryOutboxRepository
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{
+		nextID: 1,
+		now:    time.Now,
+	}
+}
+
+// enqueue adds a message to the notifications topic of the outbox
+func (r *MemoryOutboxRepository) enqueue(eventType string, payload interface{}) error {
+	return r.enqueueTopic(models.OutboxNotifications, eventType, payload)
+}
+
+// enqueueEvent adds an event to the events topic of the outbox
+func (r *MemoryOutboxRepository) enqueueEvent(envelope events.Envelope) error {
+	return r.enqueueTopic(models.OutboxEvents, envelope.Type, envelope)
+}
+
+func (r *MemoryOutboxRepository) enqueueTopic(topic, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, &memoryOutboxEntry{
+		topic: topic,
+		message: models.OutboxMessage{
+			ID:        r.nextID,
+			EventType: eventType,
+			Payload:   data,
+		},
+		nextAttempt: r.now(),
+	})
+	r.nextID++
+	return nil
+}
+
+// Claim returns up to limit due messages of the topic and hides them for the lease duration
+func (r *MemoryOutboxRepository) Claim(ctx context.Context, topic string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var messages []models.OutboxMessage
+	for _, entry := range r.entries {
+		if len(messages) >= limit {
+			break
+		}
+		if entry.topic != topic || entry.processed || entry.nextAttempt.After(now) {
+			continue
+		}
+		entry.nextAttempt = now.Add(lease)
+		messages = append(messages, entry.message)
+	}
+	return messages, nil
+}
+
+// MarkProcessed records that a message was dispatched
+func (r *MemoryOutboxRepository) MarkProcessed(ctx context.Context, id int64) error {
+	return r.update(id, func(entry *memoryOutboxEntry) {
+		entry.processed = true
+		entry.lastError = ""
+	})
+}
+
+// MarkFailed records a failed attempt and schedules a retry
+func (r *MemoryOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	return r.update(id, func(entry *memoryOutboxEntry) {
+		entry.message.Attempts++
+		entry.lastError = reason
+		entry.nextAttempt = r.now().Add(retryAfter)
+	})
+}
+
+// MarkDiscarded gives up on a message
+func (r *MemoryOutboxRepository) MarkDiscarded(ctx context.Context, id int64, reason string) error {
+	return r.update(id, func(entry *memoryOutboxEntry) {
+		entry.message.Attempts++
+		entry.lastError = reason
+		entry.processed = true
+	})
+}
+
+// Deliveries returns the deliveries of a message recorded by earlier attempts
+func (r *MemoryOutboxRepository) Deliveries(ctx context.Context, id int64) ([]models.OutboxDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []models.OutboxDelivery
+	for _, entry := range r.entries {
+		if entry.message.ID != id {
+			continue
+		}
+		for delivery := range entry.deliveries {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// RecordDelivery records that a notification of a message was delivered
+func (r *MemoryOutboxRepository) RecordDelivery(ctx context.Context, id int64, delivery models.OutboxDelivery) error {
+	return r.update(id, func(entry *memoryOutboxEntry) {
+		if entry.deliveries == nil {
+			entry.deliveries = make(map[models.OutboxDelivery]bool)
+		}
+		entry.deliveries[delivery] = true
+	})
+}
+
+// Pending returns the number of messages of the topic that have not been
+// processed or discarded
+func (r *MemoryOutboxRepository) Pending(topic string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := 0
+	for _, entry := range r.entries {
+		if entry.topic == topic && !entry.processed {
+			pending++
+		}
+	}
+	return pending
+}
+
+func (r *MemoryOutboxRepository) update(id int64, fn func(entry *memoryOutboxEntry)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.message.ID == id {
+			fn(entry)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryPasswordResetRepository is an in-memory PasswordResetRepository for tests and local development
+type MemoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	resets map[int64]models.PasswordReset
+}
+
+// NewMemoryPasswordResetRepository creates an empty MemoryPasswordResetRepository
+func NewMemoryPasswordResetRepository() *MemoryPasswordResetRepository {
+	return &MemoryPasswordResetRepository{
+		nextID: 1,
+		resets: make(map[int64]models.PasswordReset),
+	}
+}
+
+// Create stores a new reset token and assigns it the next free ID
+func (r *MemoryPasswordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.resets {
+		if existing.TokenHash == reset.TokenHash {
+			return ErrDuplicate
+		}
+	}
+
+	reset.ID = r.nextID
+	reset.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.resets[reset.ID] = *reset
+	return nil
+}
+
+// Get returns the reset token with the given hash
+func (r *MemoryPasswordResetRepository) Get(ctx context.Context, hash string) (*models.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.resets {
+		if existing.TokenHash == hash {
+			reset := existing
+			return &reset, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Use marks the reset token and every other unused one of its user as used
+func (r *MemoryPasswordResetRepository) Use(ctx context.Context, reset *models.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.resets[reset.ID]
+	if !ok || stored.UsedAt != nil {
+		return ErrConflict
+	}
+
+	now := time.Now().UTC()
+	for id, existing := range r.resets {
+		if existing.UserID == stored.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+			r.resets[id] = existing
+		}
+	}
+	return nil
+}
+
+// CountActiveSince counts the unused, unexpired reset tokens of a user created at or after since
+func (r *MemoryPasswordResetRepository) CountActiveSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, reset := range r.resets {
+		if reset.UserID == userID && reset.UsedAt == nil && reset.ExpiresAt.After(now) && !reset.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// PurgeExpired deletes reset tokens that expired before the given time
+func (r *MemoryPasswordResetRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, reset := range r.resets {
+		if reset.ExpiresAt.Before(before) {
+			delete(r.resets, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPasswordResetRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryPasswordResetRepository()
+	expiresAt := time.Now().Add(time.Hour)
+
+	first := models.PasswordReset{UserID: 1, TokenHash: "hash-1", ExpiresAt: expiresAt}
+	second := models.PasswordReset{UserID: 1, TokenHash: "hash-2", ExpiresAt: expiresAt}
+	other := models.PasswordReset{UserID: 2, TokenHash: "hash-3", ExpiresAt: expiresAt}
+	for _, reset := range []*models.PasswordReset{&first, &second, &other} {
+		assert.NoError(t, repo.Create(ctx, reset))
+	}
+	assert.Equal(t, int64(1), first.ID)
+
+	t.Run("hashes are unique", func(t *testing.T) {
+		duplicate := models.PasswordReset{UserID: 2, TokenHash: "hash-1", ExpiresAt: expiresAt}
+		assert.ErrorIs(t, repo.Create(ctx, &duplicate), ErrDuplicate)
+	})
+
+	t.Run("count active since", func(t *testing.T) {
+		count, err := repo.CountActiveSince(ctx, 1, time.Now().Add(-time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		count, err = repo.CountActiveSince(ctx, 1, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("using a token uses every token of the user", func(t *testing.T) {
+		assert.NoError(t, repo.Use(ctx, &second))
+		assert.ErrorIs(t, repo.Use(ctx, &second), ErrConflict)
+		assert.ErrorIs(t, repo.Use(ctx, &first), ErrConflict)
+
+		stored, err := repo.Get(ctx, "hash-1")
+		assert.NoError(t, err)
+		assert.NotNil(t, stored.UsedAt)
+		stored, err = repo.Get(ctx, "hash-3")
+		assert.NoError(t, err)
+		assert.Nil(t, stored.UsedAt)
+
+		count, err := repo.CountActiveSince(ctx, 1, time.Time{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+	})
+
+	t.Run("unknown hash", func(t *testing.T) {
+		_, err := repo.Get(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("purge expired", func(t *testing.T) {
+		purged, err := repo.PurgeExpired(ctx, expiresAt.Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), purged)
+		_, err = repo.Get(ctx, "hash-3")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
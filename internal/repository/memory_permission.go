@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryPermissionRepository is an in-memory PermissionRepository seeded
+// with models.DefaultRolePermissions
+type MemoryPermissionRepository struct {
+	mu     sync.RWMutex
+	grants map[models.Role][]models.Permission
+}
+
+// NewMemoryPermissionRepository creates a MemoryPermissionRepository with the default grants
+func NewMemoryPermissionRepository() *MemoryPermissionRepository {
+	r := &MemoryPermissionRepository{}
+	r.SetRolePermissions(models.DefaultRolePermissions)
+	return r
+}
+
+// RolePermissions returns a copy of the grants of every role
+func (r *MemoryPermissionRepository) RolePermissions(ctx context.Context) (map[models.Role][]models.Permission, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return copyGrants(r.grants), nil
+}
+
+// SetRolePermissions replaces the grants of every role
+func (r *MemoryPermissionRepository) SetRolePermissions(grants map[models.Role][]models.Permission) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.grants = copyGrants(grants)
+}
+
+func copyGrants(grants map[models.Role][]models.Permission) map[models.Role][]models.Permission {
+	copied := make(map[models.Role][]models.Permission, len(grants))
+	for role, permissions := range grants {
+		copied[role] = append([]models.Permission(nil), permissions...)
+	}
+	return copied
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryScheduleRepository is an in-memory ScheduleRepository for tests and local development
+type MemoryScheduleRepository struct {
+	mu        sync.RWMutex
+	nextID    int64
+	schedules map[int64]models.Schedule
+	users     *MemoryUserRepository
+}
+
+// NewMemoryScheduleRepository creates an empty MemoryScheduleRepository that
+// looks up the organization of technicians in users
+func NewMemoryScheduleRepository(users *MemoryUserRepository) *MemoryScheduleRepository {
+	return &MemoryScheduleRepository{
+		nextID:    1,
+		schedules: make(map[int64]models.Schedule),
+		users:     users,
+	}
+}
+
+// visible reports whether the technician of the schedule belongs to the
+// organization of ctx
+func (r *MemoryScheduleRepository) visible(ctx context.Context, schedule models.Schedule) bool {
+	return visible(ctx, r.users.organization(uint(schedule.TechnicianID)))
+}
+
+// Create stores a new schedule and assigns it the next free ID
+func (r *MemoryScheduleRepository) Create(ctx context.Context, schedule *models.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	schedule.ID = r.nextID
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	r.nextID++
+	r.schedules[schedule.ID] = *schedule
+	return nil
+}
+
+// Get returns a schedule
+func (r *MemoryScheduleRepository) Get(ctx context.Context, id int64) (*models.Schedule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schedule, ok := r.schedules[id]
+	if !ok || !r.visible(ctx, schedule) {
+		return nil, ErrNotFound
+	}
+	return &schedule, nil
+}
+
+// List returns every schedule ordered by ID
+func (r *MemoryScheduleRepository) List(ctx context.Context) ([]models.Schedule, error) {
+	return r.list(ctx, false), nil
+}
+
+// ListActive returns the active schedules ordered by ID
+func (r *MemoryScheduleRepository) ListActive(ctx context.Context) ([]models.Schedule, error) {
+	return r.list(ctx, true), nil
+}
+
+func (r *MemoryScheduleRepository) list(ctx context.Context, activeOnly bool) []models.Schedule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schedules := []models.Schedule{}
+	for _, schedule := range r.schedules {
+		if (!activeOnly || schedule.Active) && r.visible(ctx, schedule) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules
+}
+
+// Update changes the definition of a schedule and moves MaterializedUntil forward if needed
+func (r *MemoryScheduleRepository) Update(ctx context.Context, schedule *models.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.schedules[schedule.ID]
+	if !ok || !r.visible(ctx, stored) {
+		return ErrNotFound
+	}
+	if stored.MaterializedUntil.After(schedule.MaterializedUntil) {
+		schedule.MaterializedUntil = stored.MaterializedUntil
+	}
+	schedule.CreatedBy = stored.CreatedBy
+	schedule.CreatedAt = stored.CreatedAt
+	schedule.UpdatedAt = time.Now().UTC()
+	r.schedules[schedule.ID] = *schedule
+	return nil
+}
+
+// Advance moves MaterializedUntil forward if no other scheduler did so first
+func (r *MemoryScheduleRepository) Advance(ctx context.Context, id int64, from, to time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedule, ok := r.schedules[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !schedule.MaterializedUntil.Equal(from) {
+		return ErrConflict
+	}
+	schedule.MaterializedUntil = to
+	r.schedules[id] = schedule
+	return nil
+}
+
+// Delete removes a schedule
+func (r *MemoryScheduleRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if schedule, ok := r.schedules[id]; !ok || !r.visible(ctx, schedule) {
+		return ErrNotFound
+	}
+	delete(r.schedules, id)
+	return nil
+}
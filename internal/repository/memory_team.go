@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryTeamRepository is an in-memory TeamRepository for tests and local development
+type MemoryTeamRepository struct {
+	mu      sync.RWMutex
+	nextID  int64
+	teams   map[int64]models.Team
+	members map[int64]map[uint]models.TeamMember
+	users   *MemoryUserRepository
+}
+
+// NewMemoryTeamRepository creates an empty MemoryTeamRepository. Members are
+// resolved against users, mirroring the foreign keys of the MySQL schema.
+func NewMemoryTeamRepository(users *MemoryUserRepository) *MemoryTeamRepository {
+	return &MemoryTeamRepository{
+		nextID:  1,
+		teams:   make(map[int64]models.Team),
+		members: make(map[int64]map[uint]models.TeamMember),
+		users:   users,
+	}
+}
+
+// Create stores a new team in the organization of the context and assigns it the next free ID
+func (r *MemoryTeamRepository) Create(ctx context.Context, team *models.Team) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	team.OrganizationID = organizationFor(ctx, team.OrganizationID)
+	if err := r.check(team); err != nil {
+		return err
+	}
+	team.ID = r.nextID
+	team.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.teams[team.ID] = *team
+	r.members[team.ID] = make(map[uint]models.TeamMember)
+	return nil
+}
+
+// check rejects a name taken in the organization of the team and a parent
+// that is unknown or belongs to another organization
+func (r *MemoryTeamRepository) check(team *models.Team) error {
+	for _, t := range r.teams {
+		if t.OrganizationID == team.OrganizationID && t.Name == team.Name && t.ID != team.ID {
+			return ErrDuplicate
+		}
+	}
+	if team.ParentID != nil {
+		if parent, ok := r.teams[*team.ParentID]; !ok || parent.OrganizationID != team.OrganizationID {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// Get returns a team
+func (r *MemoryTeamRepository) Get(ctx context.Context, id int64) (*models.Team, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	team, ok := r.teams[id]
+	if !ok || !visible(ctx, team.OrganizationID) {
+		return nil, ErrNotFound
+	}
+	return &team, nil
+}
+
+// List returns every team ordered by ID
+func (r *MemoryTeamRepository) List(ctx context.Context) ([]models.Team, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	teams := make([]models.Team, 0, len(r.teams))
+	for _, team := range r.teams {
+		if visible(ctx, team.OrganizationID) {
+			teams = append(teams, team)
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+	return teams, nil
+}
+
+// Update renames a team or moves it under another parent
+func (r *MemoryTeamRepository) Update(ctx context.Context, team *models.Team) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.teams[team.ID]
+	if !ok || !visible(ctx, stored.OrganizationID) {
+		return ErrNotFound
+	}
+	team.OrganizationID = stored.OrganizationID
+	if err := r.check(team); err != nil {
+		return err
+	}
+	stored.Name = team.Name
+	stored.ParentID = team.ParentID
+	r.teams[team.ID] = stored
+	*team = stored
+	return nil
+}
+
+// Delete removes a team and its memberships, returning ErrInUse while it has sub-teams
+func (r *MemoryTeamRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if team, ok := r.teams[id]; !ok || !visible(ctx, team.OrganizationID) {
+		return ErrNotFound
+	}
+	for _, team := range r.teams {
+		if team.ParentID != nil && *team.ParentID == id {
+			return ErrInUse
+		}
+	}
+	delete(r.teams, id)
+	delete(r.members, id)
+	return nil
+}
+
+// Members returns the members of a team ordered by user ID, skipping deleted users
+func (r *MemoryTeamRepository) Members(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := []models.TeamMember{}
+	for _, member := range r.members[teamID] {
+		user, err := r.users.GetByID(ctx, member.UserID)
+		if err != nil {
+			continue
+		}
+		member.Username = user.Username
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members, nil
+}
+
+// SetMember adds a user to a team or changes their role in it, returning
+// ErrNotFound for an unknown team or user
+func (r *MemoryTeamRepository) SetMember(ctx context.Context, member *models.TeamMember) error {
+	if _, err := r.users.GetByID(ctx, member.UserID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, ok := r.members[member.TeamID]
+	if !ok || !visible(ctx, r.teams[member.TeamID].OrganizationID) {
+		return ErrNotFound
+	}
+	stored, ok := members[member.UserID]
+	if !ok {
+		stored = models.TeamMember{TeamID: member.TeamID, UserID: member.UserID, CreatedAt: time.Now().UTC()}
+	}
+	stored.Role = member.Role
+	members[member.UserID] = stored
+	return nil
+}
+
+// RemoveMember removes a user from a team
+func (r *MemoryTeamRepository) RemoveMember(ctx context.Context, teamID int64, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[teamID][userID]; !ok || !visible(ctx, r.teams[teamID].OrganizationID) {
+		return ErrNotFound
+	}
+	delete(r.members[teamID], userID)
+	return nil
+}
+
+// ManagedUsers returns the IDs of the members of the teams the user manages
+// and of their sub-teams
+func (r *MemoryTeamRepository) ManagedUsers(ctx context.Context, managerID uint) ([]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Walk down from the managed teams, marking teams as they are reached
+	managed := make(map[int64]bool)
+	var queue []int64
+	for teamID, members := range r.members {
+		if members[managerID].Role == models.TeamRoleManager {
+			managed[teamID] = true
+			queue = append(queue, teamID)
+		}
+	}
+	for len(queue) > 0 {
+		parentID := queue[0]
+		queue = queue[1:]
+		for _, team := range r.teams {
+			if team.ParentID != nil && *team.ParentID == parentID && !managed[team.ID] {
+				managed[team.ID] = true
+				queue = append(queue, team.ID)
+			}
+		}
+	}
+
+	seen := make(map[uint]bool)
+	ids := []int64{}
+	for teamID := range managed {
+		for userID := range r.members[teamID] {
+			if !seen[userID] {
+				seen[userID] = true
+				ids = append(ids, int64(userID))
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Managers returns the active users managing a team the user is a member of,
+// or any team above it, except the user themselves
+func (r *MemoryTeamRepository) Managers(ctx context.Context, userID uint) ([]models.User, error) {
+	r.mu.RLock()
+	// Walk up from the teams of the user, marking teams as they are reached
+	above := make(map[int64]bool)
+	for teamID, members := range r.members {
+		if _, ok := members[userID]; !ok {
+			continue
+		}
+		for id := teamID; !above[id]; {
+			above[id] = true
+			parentID := r.teams[id].ParentID
+			if parentID == nil {
+				break
+			}
+			id = *parentID
+		}
+	}
+
+	managerIDs := make(map[uint]bool)
+	for teamID := range above {
+		for id, member := range r.members[teamID] {
+			if member.Role == models.TeamRoleManager && id != userID {
+				managerIDs[id] = true
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	var managers []models.User
+	for id := range managerIDs {
+		user, err := r.users.GetByID(ctx, id)
+		if err != nil || !user.Active {
+			continue
+		}
+		managers = append(managers, *user)
+	}
+	sort.Slice(managers, func(i, j int) bool { return managers[i].ID < managers[j].ID })
+	return managers, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTeamRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	repo := NewMemoryTeamRepository(users)
+
+	// head manages the plant, lead manages its north crew
+	for _, user := range []models.User{
+		{Username: "head", Role: models.RoleManager},
+		{Username: "lead", Role: models.RoleManager},
+		{Username: "tech1", Role: models.RoleTechnician},
+		{Username: "tech2", Role: models.RoleTechnician},
+		{Username: "tech3", Role: models.RoleTechnician},
+	} {
+		assert.NoError(t, users.Create(ctx, &user))
+	}
+	const head, lead, tech1, tech2, tech3 = 1, 2, 3, 4, 5
+
+	plant := models.Team{Name: "Plant"}
+	assert.NoError(t, repo.Create(ctx, &plant))
+	north := models.Team{Name: "North crew", ParentID: &plant.ID}
+	assert.NoError(t, repo.Create(ctx, &north))
+	other := models.Team{Name: "Other"}
+	assert.NoError(t, repo.Create(ctx, &other))
+
+	for _, member := range []models.TeamMember{
+		{TeamID: plant.ID, UserID: head, Role: models.TeamRoleManager},
+		{TeamID: plant.ID, UserID: tech1, Role: models.TeamRoleMember},
+		{TeamID: north.ID, UserID: lead, Role: models.TeamRoleManager},
+		{TeamID: north.ID, UserID: tech2, Role: models.TeamRoleMember},
+		{TeamID: other.ID, UserID: tech3, Role: models.TeamRoleMember},
+	} {
+		assert.NoError(t, repo.SetMember(ctx, &member))
+	}
+
+	t.Run("names are unique and parents must exist", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Create(ctx, &models.Team{Name: "Plant"}), ErrDuplicate)
+		unknown := int64(99)
+		assert.ErrorIs(t, repo.Create(ctx, &models.Team{Name: "Orphan", ParentID: &unknown}), ErrNotFound)
+		assert.ErrorIs(t, repo.Update(ctx, &models.Team{ID: other.ID, Name: "North crew"}), ErrDuplicate)
+		assert.ErrorIs(t, repo.Update(ctx, &models.Team{ID: 99, Name: "Missing"}), ErrNotFound)
+	})
+
+	t.Run("managers of a team manage its sub-teams", func(t *testing.T) {
+		managed, err := repo.ManagedUsers(ctx, head)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{head, lead, tech1, tech2}, managed)
+
+		managed, err = repo.ManagedUsers(ctx, lead)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{lead, tech2}, managed)
+
+		managed, err = repo.ManagedUsers(ctx, tech1)
+		assert.NoError(t, err)
+		assert.Empty(t, managed)
+	})
+
+	t.Run("managers of a member", func(t *testing.T) {
+		managers, err := repo.Managers(ctx, tech2)
+		assert.NoError(t, err)
+		if assert.Len(t, managers, 2) {
+			assert.Equal(t, "head", managers[0].Username)
+			assert.Equal(t, "lead", managers[1].Username)
+		}
+
+		// Managers are not their own managers, deactivated managers are skipped
+		managers, _ = repo.Managers(ctx, lead)
+		assert.Len(t, managers, 1)
+		assert.NoError(t, users.SetActive(ctx, head, false))
+		managers, _ = repo.Managers(ctx, tech1)
+		assert.Empty(t, managers)
+		assert.NoError(t, users.SetActive(ctx, head, true))
+
+		managers, _ = repo.Managers(ctx, tech3)
+		assert.Empty(t, managers)
+	})
+
+	t.Run("members", func(t *testing.T) {
+		// Setting a member again changes their role
+		assert.NoError(t, repo.SetMember(ctx, &models.TeamMember{TeamID: north.ID, UserID: tech2, Role: models.TeamRoleManager}))
+		members, err := repo.Members(ctx, north.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, members, 2) {
+			assert.Equal(t, "tech2", members[1].Username)
+			assert.Equal(t, models.TeamRoleManager, members[1].Role)
+		}
+
+		assert.ErrorIs(t, repo.SetMember(ctx, &models.TeamMember{TeamID: 99, UserID: tech1, Role: models.TeamRoleMember}), ErrNotFound)
+		assert.ErrorIs(t, repo.SetMember(ctx, &models.TeamMember{TeamID: north.ID, UserID: 99, Role: models.TeamRoleMember}), ErrNotFound)
+
+		assert.NoError(t, repo.RemoveMember(ctx, north.ID, tech2))
+		assert.ErrorIs(t, repo.RemoveMember(ctx, north.ID, tech2), ErrNotFound)
+	})
+
+	t.Run("teams with sub-teams can not be deleted", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Delete(ctx, plant.ID), ErrInUse)
+		assert.NoError(t, repo.Delete(ctx, north.ID))
+		assert.NoError(t, repo.Delete(ctx, plant.ID))
+		assert.ErrorIs(t, repo.Delete(ctx, plant.ID), ErrNotFound)
+
+		managed, _ := repo.ManagedUsers(ctx, head)
+		assert.Empty(t, managed)
+		teams, _ := repo.List(ctx)
+		assert.Len(t, teams, 1)
+	})
+}
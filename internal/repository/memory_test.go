@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+
+	t.Run("create assigns incremental IDs", func(t *testing.T) {
+		first := models.User{Username: "tech1", Password: "hash", Role: models.RoleTechnician}
+		second := models.User{Username: "manager1", Password: "hash", Role: models.RoleManager}
+
+		assert.NoError(t, repo.Create(ctx, &first))
+		assert.NoError(t, repo.Create(ctx, &second))
+		assert.Equal(t, uint(1), first.ID)
+		assert.Equal(t, uint(2), second.ID)
+	})
+
+	t.Run("duplicate username", func(t *testing.T) {
+		user := models.User{Username: "tech1", Password: "hash", Role: models.RoleTechnician}
+		assert.ErrorIs(t, repo.Create(ctx, &user), ErrDuplicate)
+	})
+
+	t.Run("get by username", func(t *testing.T) {
+		user, err := repo.GetByUsername(ctx, "manager1")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(2), user.ID)
+		assert.Equal(t, models.RoleManager, user.Role)
+	})
+
+	t.Run("unknown username", func(t *testing.T) {
+		_, err := repo.GetByUsername(ctx, "nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("role and activation", func(t *testing.T) {
+		assert.NoError(t, repo.UpdateRole(ctx, 1, models.RoleAdmin))
+		assert.NoError(t, repo.SetActive(ctx, 2, false))
+		assert.ErrorIs(t, repo.SetActive(ctx, 99, false), ErrNotFound)
+		assert.NoError(t, repo.UpdatePassword(ctx, 1, "new-hash"))
+		assert.ErrorIs(t, repo.UpdatePassword(ctx, 99, "new-hash"), ErrNotFound)
+		user, err := repo.GetByID(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "new-hash", user.Password)
+
+		users, err := repo.List(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, users, 2) {
+			assert.Equal(t, models.RoleAdmin, users[0].Role)
+			assert.True(t, users[0].Active)
+			assert.False(t, users[1].Active)
+		}
+
+		// Deactivated users are not notified
+		managers, err := repo.ListByRole(ctx, models.RoleManager)
+		assert.NoError(t, err)
+		assert.Empty(t, managers)
+
+		active, err := repo.IsActive(ctx, 2)
+		assert.NoError(t, err)
+		assert.False(t, active)
+		active, err = repo.IsActive(ctx, 99)
+		assert.NoError(t, err)
+		assert.False(t, active)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		tasks := NewMemoryTaskRepository(repo)
+		assert.NoError(t, tasks.Create(ctx, &models.Task{ID: "task-1", TechnicianID: 1, PerformedAt: time.Now()}, 1))
+
+		assert.ErrorIs(t, repo.Delete(ctx, 1), ErrInUse)
+		assert.NoError(t, repo.Delete(ctx, 2))
+		assert.ErrorIs(t, repo.Delete(ctx, 2), ErrNotFound)
+	})
+}
+
+func TestMemoryTaskRepository(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	repo := NewMemoryTaskRepository(users)
+
+	tech1 := models.User{Username: "tech1", Role: models.RoleTechnician}
+	tech2 := models.User{Username: "tech2", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech1))
+	assert.NoError(t, users.Create(ctx, &tech2))
+
+	older := time.Date(2024, 12, 24, 10, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 12, 25, 10, 0, 0, 0, time.UTC)
+
+	tasks := []models.Task{
+		{ID: "task1", TechnicianID: int64(tech1.ID), Summary: "Task 1", PerformedAt: older},
+		{ID: "task2", TechnicianID: int64(tech1.ID), Summary: "Task 2", PerformedAt: newer},
+		{ID: "task3", TechnicianID: int64(tech2.ID), Summary: "Task 3", PerformedAt: older},
+	}
+	for i := range tasks {
+		assert.NoError(t, repo.Create(ctx, &tasks[i], 1))
+	}
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Create(ctx, &tasks[0], 1), ErrDuplicate)
+	})
+
+	t.Run("list all tasks most recent first", func(t *testing.T) {
+		page, err := repo.List(ctx, TaskFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 3)
+		assert.Equal(t, "task2", page.Tasks[0].ID)
+		assert.Equal(t, "tech1", page.Tasks[0].TechnicianName)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("list tasks of a technician", func(t *testing.T) {
+		technicianID := int64(tech2.ID)
+		page, err := repo.List(ctx, TaskFilter{TechnicianID: &technicianID})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 1)
+		assert.Equal(t, "task3", page.Tasks[0].ID)
+		assert.Equal(t, "tech2", page.Tasks[0].TechnicianName)
+	})
+
+	t.Run("list pages through tasks with a cursor", func(t *testing.T) {
+		page, err := repo.List(ctx, TaskFilter{Sort: SortPerformedAtAsc, Limit: 2})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 2) {
+			assert.Equal(t, "task1", page.Tasks[0].ID)
+			assert.Equal(t, "task3", page.Tasks[1].ID)
+		}
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = repo.List(ctx, TaskFilter{Sort: SortPerformedAtAsc, Limit: 2, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "task2", page.Tasks[0].ID)
+		}
+		assert.Empty(t, page.NextCursor)
+
+		_, err = repo.List(ctx, TaskFilter{Cursor: "not-a-cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("list filters by date and text", func(t *testing.T) {
+		page, err := repo.List(ctx, TaskFilter{PerformedFrom: &newer})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 1)
+
+		page, err = repo.List(ctx, TaskFilter{PerformedTo: &older})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 2)
+
+		page, err = repo.List(ctx, TaskFilter{Query: "TECH2"})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "task3", page.Tasks[0].ID)
+		}
+
+		page, err = repo.List(ctx, TaskFilter{Query: "task 2"})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 1)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		owner, err := repo.Owner(ctx, "task3")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(tech2.ID), owner)
+
+		_, err = repo.Owner(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("update own task", func(t *testing.T) {
+		update := models.Task{ID: "task1", TechnicianID: int64(tech1.ID), Summary: "Updated", PerformedAt: newer}
+		assert.NoError(t, repo.Update(ctx, &update, update.TechnicianID))
+
+		page, err := repo.List(ctx, TaskFilter{})
+		assert.NoError(t, err)
+		for _, task := range page.Tasks {
+			if task.ID == "task1" {
+				assert.Equal(t, "Updated", task.Summary)
+			}
+		}
+	})
+
+	t.Run("update task of another technician", func(t *testing.T) {
+		update := models.Task{ID: "task3", TechnicianID: int64(tech1.ID), Summary: "Nope"}
+		assert.ErrorIs(t, repo.Update(ctx, &update, update.TechnicianID), ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, repo.Delete(ctx, "task3", 1))
+
+		exists, err := repo.Exists(ctx, "task3")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		assert.ErrorIs(t, repo.Delete(ctx, "task3", 1), ErrNotFound)
+	})
+}
+
+func TestMemoryTaskRepositoryTransitions(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+	repo := NewMemoryTaskRepository(users)
+
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Status: models.StatusScheduled, PerformedAt: time.Now()}
+	assert.NoError(t, repo.Create(ctx, &task, task.TechnicianID))
+	assert.Equal(t, 0, repo.Outbox().Pending(models.OutboxNotifications), "scheduled tasks are not performed yet")
+
+	t.Run("default status is completed", func(t *testing.T) {
+		recorded := models.Task{ID: "task2", TechnicianID: int64(tech.ID), PerformedAt: time.Now()}
+		assert.NoError(t, repo.Create(ctx, &recorded, recorded.TechnicianID))
+		assert.Equal(t, models.StatusCompleted, recorded.Status)
+		assert.Equal(t, 1, repo.Outbox().Pending(models.OutboxNotifications))
+	})
+
+	t.Run("transition updates the status and history", func(t *testing.T) {
+		start := models.TaskTransition{TaskID: "task1", From: models.StatusScheduled, To: models.StatusInProgress, ActorID: int64(tech.ID)}
+		assert.NoError(t, repo.Transition(ctx, &start))
+		complete := models.TaskTransition{TaskID: "task1", From: models.StatusInProgress, To: models.StatusCompleted, ActorID: int64(tech.ID), Reason: "done"}
+		assert.NoError(t, repo.Transition(ctx, &complete))
+		assert.Equal(t, 2, repo.Outbox().Pending(models.OutboxNotifications), "completing a task notifies managers")
+
+		stored, err := repo.Get(ctx, "task1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.StatusCompleted, stored.Status)
+
+		history, err := repo.Transitions(ctx, "task1")
+		assert.NoError(t, err)
+		if assert.Len(t, history, 3) {
+			assert.Equal(t, models.TaskStatus(""), history[0].From)
+			assert.Equal(t, models.StatusScheduled, history[0].To)
+			assert.Equal(t, models.StatusInProgress, history[1].To)
+			assert.Equal(t, "done", history[2].Reason)
+			assert.Less(t, history[1].ID, history[2].ID)
+		}
+	})
+
+	t.Run("stale from status is a conflict", func(t *testing.T) {
+		transition := models.TaskTransition{TaskID: "task1", From: models.StatusInProgress, To: models.StatusCancelled}
+		assert.ErrorIs(t, repo.Transition(ctx, &transition), ErrConflict)
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		transition := models.TaskTransition{TaskID: "missing", To: models.StatusCancelled}
+		assert.ErrorIs(t, repo.Transition(ctx, &transition), ErrNotFound)
+
+		_, err := repo.Transitions(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = repo.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("list filters by status", func(t *testing.T) {
+		page, err := repo.List(ctx, TaskFilter{Status: models.StatusCompleted})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 2)
+
+		page, err = repo.List(ctx, TaskFilter{Status: models.StatusScheduled})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Tasks)
+	})
+}
+
+func TestMemoryTaskRepositoryEvents(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician, OrganizationID: 2}
+	assert.NoError(t, users.Create(ctx, &tech))
+	repo := NewMemoryTaskRepository(users)
+
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), Status: models.StatusInProgress, PerformedAt: time.Now()}
+	assert.NoError(t, repo.Create(ctx, &task, task.TechnicianID))
+	// Updates only store the summary and time, the event keeps the stored status
+	update := models.Task{ID: "task1", TechnicianID: task.TechnicianID, Summary: "Replaced the valve",
+		PerformedAt: task.PerformedAt, Status: models.StatusCancelled}
+	assert.NoError(t, repo.Update(ctx, &update, 9))
+	assert.NoError(t, repo.Transition(ctx, &models.TaskTransition{TaskID: "task1", From: models.StatusInProgress, To: models.StatusCompleted, ActorID: 9}))
+	assert.NoError(t, repo.Delete(ctx, "task1", 9))
+	assert.ErrorIs(t, repo.Delete(ctx, "task1", 9), ErrNotFound)
+
+	messages, err := repo.Outbox().Claim(ctx, models.OutboxEvents, 10, time.Minute)
+	assert.NoError(t, err)
+	var types []string
+	for _, message := range messages {
+		var envelope events.Envelope
+		assert.NoError(t, json.Unmarshal(message.Payload, &envelope))
+		assert.Equal(t, message.EventType, envelope.Type)
+		assert.Equal(t, int64(2), envelope.OrganizationID)
+		types = append(types, envelope.Type)
+		if envelope.Type == events.TypeTaskUpdated {
+			var data events.TaskData
+			assert.NoError(t, json.Unmarshal(envelope.Data, &data))
+			assert.Equal(t, "Replaced the valve", data.Summary)
+			assert.Equal(t, "in_progress", data.Status)
+		}
+	}
+	assert.Equal(t, []string{events.TypeTaskCreated, events.TypeTaskUpdated, events.TypeTaskTransitioned, events.TypeTaskDeleted}, types)
+	assert.Equal(t, 1, repo.Outbox().Pending(models.OutboxNotifications), "events do not notify managers")
+}
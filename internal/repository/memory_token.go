@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MemoryTokenRepository is an in-memory TokenRepository for tests and local development
+type MemoryTokenRepository struct {
+	mu      sync.RWMutex
+	nextID  int64
+	refresh map[int64]models.RefreshToken
+	// revoked maps the jti of revoked access tokens to their expiry
+	revoked  map[string]time.Time
+	sessions map[string]models.Session
+}
+
+// NewMemoryTokenRepository creates an empty MemoryTokenRepository
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{
+		nextID:   1,
+		refresh:  make(map[int64]models.RefreshToken),
+		revoked:  make(map[string]time.Time),
+		sessions: make(map[string]models.Session),
+	}
+}
+
+// CreateRefreshToken stores a new refresh token and assigns it the next free ID
+func (r *MemoryTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.refresh {
+		if t.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+
+	token.ID = r.nextID
+	token.CreatedAt = time.Now().UTC()
+	r.nextID++
+	r.refresh[token.ID] = *token
+	return nil
+}
+
+// GetRefreshToken returns the refresh token with the given hash
+func (r *MemoryTokenRepository) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.refresh {
+		if t.TokenHash == hash {
+			token := t
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UseRefreshToken marks a refresh token as exchanged if it is still unused and not revoked
+func (r *MemoryTokenRepository) UseRefreshToken(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refresh[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	token.UsedAt = &now
+	r.refresh[id] = token
+	return nil
+}
+
+// RevokeFamily revokes every refresh token of a family that is not revoked
+// yet and terminates its session
+func (r *MemoryTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, token := range r.refresh {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.refresh[id] = token
+		}
+	}
+	if session, ok := r.sessions[familyID]; ok && session.RevokedAt == nil {
+		session.RevokedAt = &now
+		r.sessions[familyID] = session
+	}
+	return nil
+}
+
+// RevokeUser revokes every refresh token of a user that is not revoked yet
+// and terminates their sessions
+func (r *MemoryTokenRepository) RevokeUser(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, token := range r.refresh {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.refresh[id] = token
+		}
+	}
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken records a revoked access token
+func (r *MemoryTokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[jti] = expiresAt.UTC()
+	return nil
+}
+
+// IsRevoked reports whether an access token was revoked at logout or with its refresh token family
+func (r *MemoryTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.revoked[jti]; ok {
+		return true, nil
+	}
+	for _, token := range r.refresh {
+		if token.AccessTokenID == jti && token.RevokedAt != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PurgeExpired deletes refresh tokens, sessions and access token revocations
+// that expired before the given time
+func (r *MemoryTokenRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, token := range r.refresh {
+		if token.ExpiresAt.Before(before) {
+			delete(r.refresh, id)
+			purged++
+		}
+	}
+	for jti, expiresAt := range r.revoked {
+		if expiresAt.Before(before) {
+			delete(r.revoked, jti)
+			purged++
+		}
+	}
+	for id, session := range r.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(r.sessions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CreateSession stores the session of a new login
+func (r *MemoryTokenRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+// GetSession returns the session with the given ID
+func (r *MemoryTokenRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+// ListSessions returns the active sessions of a user, the most recently seen first
+func (r *MemoryTokenRepository) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	sessions := []models.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions, nil
+}
+
+// RenewSession records a refresh of the session, unknown sessions are ignored
+func (r *MemoryTokenRepository) RenewSession(ctx context.Context, id, address string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.IPAddress = address
+		session.LastSeenAt = time.Now().UTC()
+		session.ExpiresAt = expiresAt.UTC()
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+// TouchSession records that the session was used, unknown sessions are ignored
+func (r *MemoryTokenRepository) TouchSession(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.LastSeenAt = at.UTC()
+		r.sessions[id] = session
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTokenRepository()
+	expiresAt := time.Now().Add(time.Hour)
+
+	first := models.RefreshToken{UserID: 1, FamilyID: "family-1", TokenHash: "hash-1", AccessTokenID: "jti-1", ExpiresAt: expiresAt}
+	assert.NoError(t, repo.CreateRefreshToken(ctx, &first))
+	assert.Equal(t, int64(1), first.ID)
+
+	t.Run("hashes are unique", func(t *testing.T) {
+		duplicate := models.RefreshToken{UserID: 2, FamilyID: "family-2", TokenHash: "hash-1", ExpiresAt: expiresAt}
+		assert.ErrorIs(t, repo.CreateRefreshToken(ctx, &duplicate), ErrDuplicate)
+	})
+
+	t.Run("token can be used once", func(t *testing.T) {
+		assert.NoError(t, repo.UseRefreshToken(ctx, first.ID))
+		assert.ErrorIs(t, repo.UseRefreshToken(ctx, first.ID), ErrConflict)
+
+		stored, err := repo.GetRefreshToken(ctx, "hash-1")
+		assert.NoError(t, err)
+		assert.NotNil(t, stored.UsedAt)
+		assert.Nil(t, stored.RevokedAt)
+	})
+
+	t.Run("revoking a family revokes its access tokens", func(t *testing.T) {
+		second := models.RefreshToken{UserID: 1, FamilyID: "family-1", TokenHash: "hash-2", AccessTokenID: "jti-2", ExpiresAt: expiresAt}
+		other := models.RefreshToken{UserID: 1, FamilyID: "family-3", TokenHash: "hash-3", AccessTokenID: "jti-3", ExpiresAt: expiresAt}
+		assert.NoError(t, repo.CreateRefreshToken(ctx, &second))
+		assert.NoError(t, repo.CreateRefreshToken(ctx, &other))
+
+		assert.NoError(t, repo.RevokeFamily(ctx, "family-1"))
+
+		for jti, want := range map[string]bool{"jti-1": true, "jti-2": true, "jti-3": false} {
+			revoked, err := repo.IsRevoked(ctx, jti)
+			assert.NoError(t, err)
+			assert.Equal(t, want, revoked, jti)
+		}
+		assert.ErrorIs(t, repo.UseRefreshToken(ctx, second.ID), ErrConflict)
+	})
+
+	t.Run("revoking a user revokes every family", func(t *testing.T) {
+		own := models.RefreshToken{UserID: 6, FamilyID: "family-6", TokenHash: "hash-6", AccessTokenID: "jti-6", ExpiresAt: expiresAt}
+		assert.NoError(t, repo.CreateRefreshToken(ctx, &own))
+
+		assert.NoError(t, repo.RevokeUser(ctx, 1))
+
+		for jti, want := range map[string]bool{"jti-3": true, "jti-6": false} {
+			revoked, err := repo.IsRevoked(ctx, jti)
+			assert.NoError(t, err)
+			assert.Equal(t, want, revoked, jti)
+		}
+	})
+
+	t.Run("revoked access token", func(t *testing.T) {
+		assert.NoError(t, repo.RevokeAccessToken(ctx, "jti-4", expiresAt))
+		revoked, err := repo.IsRevoked(ctx, "jti-4")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("purge expired", func(t *testing.T) {
+		expired := models.RefreshToken{UserID: 1, FamilyID: "family-5", TokenHash: "hash-5", ExpiresAt: time.Now().Add(-time.Minute)}
+		assert.NoError(t, repo.CreateRefreshToken(ctx, &expired))
+		assert.NoError(t, repo.RevokeAccessToken(ctx, "jti-5", time.Now().Add(-time.Minute)))
+
+		purged, err := repo.PurgeExpired(ctx, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+
+		_, err = repo.GetRefreshToken(ctx, "hash-5")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repo.GetRefreshToken(ctx, "hash-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		sessions := NewMemoryTokenRepository()
+		laptop := models.Session{ID: "family-1", UserID: 1, DeviceName: "Laptop", IPAddress: "192.0.2.1", ExpiresAt: expiresAt}
+		phone := models.Session{ID: "family-2", UserID: 1, DeviceName: "Phone", ExpiresAt: expiresAt}
+		other := models.Session{ID: "family-3", UserID: 2, ExpiresAt: expiresAt}
+		expired := models.Session{ID: "family-4", UserID: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+		for _, session := range []*models.Session{&laptop, &phone, &other, &expired} {
+			assert.NoError(t, sessions.CreateSession(ctx, session))
+		}
+		assert.False(t, laptop.CreatedAt.IsZero())
+		assert.ErrorIs(t, sessions.CreateSession(ctx, &models.Session{ID: "family-1", UserID: 2}), ErrDuplicate)
+
+		// The most recently seen first, expired sessions are left out
+		assert.NoError(t, sessions.TouchSession(ctx, "family-2", time.Now().Add(time.Second)))
+		list, err := sessions.ListSessions(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, "family-2", list[0].ID)
+		assert.Equal(t, "family-1", list[1].ID)
+
+		later := expiresAt.Add(time.Hour)
+		assert.NoError(t, sessions.RenewSession(ctx, "family-1", "192.0.2.9", later))
+		stored, err := sessions.GetSession(ctx, "family-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "192.0.2.9", stored.IPAddress)
+		assert.True(t, later.Equal(stored.ExpiresAt))
+		assert.NoError(t, sessions.RenewSession(ctx, "unknown", "192.0.2.9", later))
+
+		// Revoking the family terminates its session only
+		assert.NoError(t, sessions.RevokeFamily(ctx, "family-1"))
+		stored, err = sessions.GetSession(ctx, "family-1")
+		assert.NoError(t, err)
+		assert.NotNil(t, stored.RevokedAt)
+		list, err = sessions.ListSessions(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		// Revoking the user terminates the rest
+		assert.NoError(t, sessions.RevokeUser(ctx, 1))
+		list, err = sessions.ListSessions(ctx, 1)
+		assert.NoError(t, err)
+		assert.Empty(t, list)
+		list, err = sessions.ListSessions(ctx, 2)
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		purged, err := sessions.PurgeExpired(ctx, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
+		_, err = sessions.GetSession(ctx, "family-4")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLAPIKeyRepository implements APIKeyRepository on top of a MySQL database
+type MySQLAPIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLAPIKeyRepository creates a new MySQLAPIKeyRepository
+func NewMySQLAPIKeyRepository(db *sql.DB) *MySQLAPIKeyRepository {
+	return &MySQLAPIKeyRepository{
+		db: db,
+	}
+}
+
+const apiKeySelect = `
+        SELECT id, organization_id, user_id, name, prefix, key_hash, permissions,
+        DATE_FORMAT(expires_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(last_used_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(revoked_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM api_keys`
+
+// Create inserts a new API key into the organization of the context and sets
+// its ID from the auto-increment column
+func (r *MySQLAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	permissions, err := json.Marshal(key.Permissions)
+	if err != nil {
+		return err
+	}
+
+	orgID := organizationFor(ctx, key.OrganizationID)
+	result, err := r.db.ExecContext(ctx, `
+        INSERT INTO api_keys (organization_id, user_id, name, prefix, key_hash, permissions, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		orgID, key.UserID, key.Name, key.Prefix, key.KeyHash, string(permissions), key.ExpiresAt.UTC())
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	key.ID = id
+	key.OrganizationID = orgID
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// Get returns the API key with the given ID
+func (r *MySQLAPIKeyRepository) Get(ctx context.Context, id int64) (*models.APIKey, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	return scanAPIKey(r.db.QueryRowContext(ctx, apiKeySelect+` WHERE id = ?`+scope, append([]interface{}{id}, args...)...))
+}
+
+// GetByPrefix returns the API key with the given prefix. It is not scoped,
+// the organization is only known once the key is found.
+func (r *MySQLAPIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, apiKeySelect+` WHERE prefix = ?`, prefix))
+}
+
+// List returns every API key ordered by ID
+func (r *MySQLAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	scope, args := whereOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, apiKeySelect+scope+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke revokes an API key
+func (r *MySQLAPIKeyRepository) Revoke(ctx context.Context, id int64) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"+scope,
+		append([]interface{}{time.Now().UTC(), id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Tell an unknown key from one that was already revoked
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+// Touch records that an API key was used at the given time
+func (r *MySQLAPIKeyRepository) Touch(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", at.UTC(), id)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var permissions []byte
+	var expiresAt string
+	var lastUsedAt, revokedAt, createdAt sql.NullString
+	err := row.Scan(&key.ID, &key.OrganizationID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &permissions,
+		&expiresAt, &lastUsedAt, &revokedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(permissions, &key.Permissions); err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt, err = time.Parse("2006-01-02 15:04:05", expiresAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if key.LastUsedAt, err = parseNullTime(lastUsedAt); err != nil {
+		return nil, err
+	}
+	if key.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+	created, err := parseNullTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		key.CreatedAt = *created
+	}
+	return &key, nil
+}
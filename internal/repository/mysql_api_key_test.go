@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLAPIKeyRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLAPIKeyRepository(db)
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC)
+	columns := []string{"id", "organization_id", "user_id", "name", "prefix", "key_hash", "permissions", "expires_at",
+		"last_used_at", "revoked_at", "created_at"}
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO api_keys").
+			WithArgs(int64(2), 7, "cmms", "abcd1234", "hash", `["task:read:own","asset:read"]`, expiresAt).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+
+		key := models.APIKey{UserID: 7, Name: "cmms", Prefix: "abcd1234", KeyHash: "hash",
+			Permissions: []models.Permission{models.PermissionTaskReadOwn, models.PermissionAssetRead}, ExpiresAt: expiresAt}
+		assert.NoError(t, repo.Create(tenant.WithOrganization(ctx, 2), &key))
+		assert.Equal(t, int64(3), key.ID)
+		assert.Equal(t, int64(2), key.OrganizationID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create with a known prefix", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO api_keys").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+
+		key := models.APIKey{Prefix: "abcd1234", ExpiresAt: expiresAt}
+		assert.ErrorIs(t, repo.Create(ctx, &key), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get by prefix", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, user_id, name, prefix, key_hash, permissions,.*FROM api_keys WHERE prefix = \\?$").
+			WithArgs("abcd1234").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 2, 7, "cmms", "abcd1234", "hash", `["task:read:own"]`, "2025-04-01 08:00:00",
+					"2025-03-02 08:00:00", nil, "2025-01-01 08:00:00"))
+
+		key, err := repo.GetByPrefix(ctx, "abcd1234")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), key.OrganizationID)
+		assert.Equal(t, []models.Permission{models.PermissionTaskReadOwn}, key.Permissions)
+		assert.True(t, expiresAt.Equal(key.ExpiresAt))
+		assert.Equal(t, time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC), *key.LastUsedAt)
+		assert.Equal(t, models.APIKeyActive, key.Status(expiresAt.Add(-time.Hour)))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list in the organization", func(t *testing.T) {
+		mock.ExpectQuery("FROM api_keys WHERE organization_id = \\? ORDER BY id").
+			WithArgs(int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 2, 7, "cmms", "abcd1234", "hash", `[]`, "2025-04-01 08:00:00", nil,
+					"2025-03-01 08:00:00", "2025-01-01 08:00:00"))
+
+		keys, err := repo.List(tenant.WithOrganization(ctx, 2))
+		assert.NoError(t, err)
+		assert.Len(t, keys, 1)
+		assert.Equal(t, models.APIKeyRevoked, keys[0].Status(time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke a revoked key", func(t *testing.T) {
+		mock.ExpectExec("UPDATE api_keys SET revoked_at = \\? WHERE id = \\? AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FROM api_keys WHERE id = \\?").
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 2, 7, "cmms", "abcd1234", "hash", `[]`, "2025-04-01 08:00:00", nil,
+					"2025-03-01 08:00:00", "2025-01-01 08:00:00"))
+
+		assert.ErrorIs(t, repo.Revoke(ctx, 3), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke a key of another organization", func(t *testing.T) {
+		mock.ExpectExec("UPDATE api_keys SET revoked_at = \\?.* AND organization_id = \\?").
+			WithArgs(sqlmock.AnyArg(), 3, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FROM api_keys WHERE id = \\? AND organization_id = \\?").
+			WithArgs(3, int64(1)).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		assert.ErrorIs(t, repo.Revoke(tenant.WithOrganization(ctx, 1), 3), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		usedAt := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+		mock.ExpectExec("UPDATE api_keys SET last_used_at = \\? WHERE id = \\?").
+			WithArgs(usedAt, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.Touch(ctx, 3, usedAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQL error numbers mapped to repository errors
+const (
+	mysqlErrDuplicateEntry  = 1062
+	mysqlErrRowIsReferenced = 1451
+	mysqlErrNoReferencedRow = 1452
+)
+
+// MySQLAssetRepository implements AssetRepository on top of a MySQL database
+type MySQLAssetRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLAssetRepository creates a new MySQLAssetRepository
+func NewMySQLAssetRepository(db *sql.DB) *MySQLAssetRepository {
+	return &MySQLAssetRepository{
+		db: db,
+	}
+}
+
+const selectAsset = `
+        SELECT id, serial_number, type, location,
+        DATE_FORMAT(install_date, '%Y-%m-%d'), metadata,
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(updated_at, '%Y-%m-%d %H:%i:%s')
+        FROM assets`
+
+// Create inserts a new asset into the organization of the context and sets
+// its ID from the auto-increment column
+func (r *MySQLAssetRepository) Create(ctx context.Context, asset *models.Asset) error {
+	metadata, err := marshalMetadata(asset.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO assets (organization_id, serial_number, type, location, install_date, metadata)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	orgID := organizationFor(ctx, asset.OrganizationID)
+	result, err := r.db.ExecContext(ctx, query, orgID, asset.SerialNumber, asset.Type,
+		nullString(asset.Location), nullString(asset.InstallDate), metadata)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	now := time.Now().UTC().Truncate(time.Second)
+	asset.ID = id
+	asset.OrganizationID = orgID
+	asset.CreatedAt = now
+	asset.UpdatedAt = now
+	return nil
+}
+
+// Get returns an asset
+func (r *MySQLAssetRepository) Get(ctx context.Context, id int64) (*models.Asset, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	asset, err := scanAsset(r.db.QueryRowContext(ctx, selectAsset+" WHERE id = ?"+scope, append([]interface{}{id}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return asset, err
+}
+
+// List returns every asset ordered by ID
+func (r *MySQLAssetRepository) List(ctx context.Context) ([]models.Asset, error) {
+	scope, args := whereOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, selectAsset+scope+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []models.Asset{}
+	for rows.Next() {
+		asset, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, *asset)
+	}
+	return assets, rows.Err()
+}
+
+// Update changes every field of an asset but its ID and timestamps
+func (r *MySQLAssetRepository) Update(ctx context.Context, asset *models.Asset) error {
+	metadata, err := marshalMetadata(asset.Metadata)
+	if err != nil {
+		return err
+	}
+
+	scope, args := inOrganization(ctx, "organization_id")
+	query := `
+        UPDATE assets
+        SET serial_number = ?, type = ?, location = ?, install_date = ?, metadata = ?
+        WHERE id = ?` + scope
+	args = append([]interface{}{asset.SerialNumber, asset.Type,
+		nullString(asset.Location), nullString(asset.InstallDate), metadata, asset.ID}, args...)
+	_, err = r.db.ExecContext(ctx, query, args...)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	// RowsAffected is zero when nothing changed, so check existence separately
+	exists, err := r.Exists(ctx, asset.ID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Exists reports whether the asset is stored
+func (r *MySQLAssetRepository) Exists(ctx context.Context, id int64) (bool, error) {
+	var exists bool
+	scope, args := inOrganization(ctx, "organization_id")
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM assets WHERE id = ?"+scope+")", append([]interface{}{id}, args...)...).Scan(&exists)
+	return exists, err
+}
+
+// Delete removes an asset that no task references
+func (r *MySQLAssetRepository) Delete(ctx context.Context, id int64) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx, "DELETE FROM assets WHERE id = ?"+scope, append([]interface{}{id}, args...)...)
+	if isMySQLError(err, mysqlErrRowIsReferenced) {
+		return ErrInUse
+	} else if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAsset(row rowScanner) (*models.Asset, error) {
+	var asset models.Asset
+	var location, installDate, metadata sql.NullString
+	var createdAt, updatedAt string
+	err := row.Scan(&asset.ID, &asset.SerialNumber, &asset.Type, &location,
+		&installDate, &metadata, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	asset.Location = location.String
+	asset.InstallDate = installDate.String
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &asset.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if asset.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if asset.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", updatedAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &asset, nil
+}
+
+// marshalMetadata maps empty metadata to SQL NULL
+func marshalMetadata(metadata map[string]string) (sql.NullString, error) {
+	if len(metadata) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// isMySQLError reports whether err is a MySQL server error with the given number
+func isMySQLError(err error, number uint16) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == number
+}
+
+// nullInt64 maps a nil pointer to SQL NULL
+func nullInt64(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
+
+// int64Ptr maps SQL NULL to a nil pointer
+func int64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
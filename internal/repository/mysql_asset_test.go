@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLAssetRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLAssetRepository(db)
+	ctx := context.Background()
+	columns := []string{"id", "serial_number", "type", "location", "install_date", "metadata", "created_at", "updated_at"}
+
+	t.Run("create stores metadata as JSON", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO assets").
+			WithArgs(models.DefaultOrganizationID, "PUMP-0001", "pump", "Plant 1", "2021-03-15", `{"vendor":"Acme"}`).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+
+		asset := models.Asset{SerialNumber: "PUMP-0001", Type: "pump", Location: "Plant 1", InstallDate: "2021-03-15",
+			Metadata: map[string]string{"vendor": "Acme"}}
+		assert.NoError(t, repo.Create(ctx, &asset))
+		assert.Equal(t, int64(4), asset.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("duplicate serial number", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO assets").
+			WithArgs(models.DefaultOrganizationID, "PUMP-0001", "pump", nil, nil, nil).
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+		asset := models.Asset{SerialNumber: "PUMP-0001", Type: "pump"}
+		assert.ErrorIs(t, repo.Create(ctx, &asset), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, serial_number.*FROM assets WHERE id = \\?").
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(4, "PUMP-0001", "pump", nil, "2021-03-15", `{"vendor":"Acme"}`, "2024-12-29 10:30:00", "2024-12-29 10:30:00"))
+
+		asset, err := repo.Get(ctx, 4)
+		assert.NoError(t, err)
+		assert.Equal(t, "PUMP-0001", asset.SerialNumber)
+		assert.Empty(t, asset.Location)
+		assert.Equal(t, "2021-03-15", asset.InstallDate)
+		assert.Equal(t, map[string]string{"vendor": "Acme"}, asset.Metadata)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown asset", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, serial_number.*FROM assets WHERE id = \\?").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		_, err := repo.Get(ctx, 5)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update unknown asset", func(t *testing.T) {
+		mock.ExpectExec("UPDATE assets").
+			WithArgs("X-1", "pump", nil, nil, nil, 5).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		asset := models.Asset{ID: 5, SerialNumber: "X-1", Type: "pump"}
+		assert.ErrorIs(t, repo.Update(ctx, &asset), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("scoped to the organization of the context", func(t *testing.T) {
+		orgCtx := tenant.WithOrganization(ctx, 2)
+		mock.ExpectExec("INSERT INTO assets").
+			WithArgs(int64(2), "VALVE-1", "valve", nil, nil, nil).
+			WillReturnResult(sqlmock.NewResult(6, 1))
+		mock.ExpectQuery("FROM assets WHERE id = \\? AND organization_id = \\?").
+			WithArgs(4, int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectQuery("FROM assets WHERE organization_id = \\? ORDER BY id").
+			WithArgs(int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		asset := models.Asset{SerialNumber: "VALVE-1", Type: "valve"}
+		assert.NoError(t, repo.Create(orgCtx, &asset))
+		assert.Equal(t, int64(2), asset.OrganizationID)
+		_, err := repo.Get(orgCtx, 4)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assets, err := repo.List(orgCtx)
+		assert.NoError(t, err)
+		assert.Empty(t, assets)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete referenced asset", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM assets WHERE id = \\?").
+			WithArgs(4).
+			WillReturnError(&mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"})
+
+		assert.ErrorIs(t, repo.Delete(ctx, 4), ErrInUse)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
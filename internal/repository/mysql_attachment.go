@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLAttachmentRepository implements AttachmentRepository on top of a MySQL database
+type MySQLAttachmentRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLAttachmentRepository creates a new MySQLAttachmentRepository
+func NewMySQLAttachmentRepository(db *sql.DB) *MySQLAttachmentRepository {
+	return &MySQLAttachmentRepository{
+		db: db,
+	}
+}
+
+const selectAttachment = `
+        SELECT id, task_id, uploader_id, file_name, content_type, size, checksum, storage_key, thumbnail_key,
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM task_attachments`
+
+// Create inserts a new attachment after checking its task can be seen from ctx
+func (r *MySQLAttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?"+scope+")",
+		append([]interface{}{attachment.TaskID}, args...)...).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO task_attachments (id, task_id, uploader_id, file_name, content_type, size, checksum,
+        storage_key, thumbnail_key, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.ID, attachment.TaskID, attachment.UploaderID, attachment.FileName, attachment.ContentType,
+		attachment.Size, attachment.Checksum, attachment.StorageKey, attachment.ThumbnailKey, createdAt)
+	if isMySQLError(err, mysqlErrNoReferencedRow) {
+		return ErrNotFound
+	} else if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	attachment.CreatedAt = createdAt
+	return tx.Commit()
+}
+
+// Get returns an attachment of a task
+func (r *MySQLAttachmentRepository) Get(ctx context.Context, taskID, id string) (*models.Attachment, error) {
+	scope, args := taskInOrganization(ctx, "task_id")
+	attachment, err := scanAttachment(r.db.QueryRowContext(ctx, selectAttachment+" WHERE id = ? AND task_id = ?"+scope,
+		append([]interface{}{id, taskID}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return attachment, err
+}
+
+// List returns the attachments of a task, oldest first
+func (r *MySQLAttachmentRepository) List(ctx context.Context, taskID string) ([]models.Attachment, error) {
+	scope, args := taskInOrganization(ctx, "task_id")
+	rows, err := r.db.QueryContext(ctx, selectAttachment+" WHERE task_id = ?"+scope+" ORDER BY created_at, id",
+		append([]interface{}{taskID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// Delete removes an attachment and queues its blobs for deletion in one transaction
+func (r *MySQLAttachmentRepository) Delete(ctx context.Context, taskID, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var storageKey, thumbnailKey string
+	scope, args := taskInOrganization(ctx, "task_id")
+	err = tx.QueryRowContext(ctx, "SELECT storage_key, thumbnail_key FROM task_attachments WHERE id = ? AND task_id = ?"+scope+" FOR UPDATE",
+		append([]interface{}{id, taskID}, args...)...).Scan(&storageKey, &thumbnailKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	for _, key := range []string{storageKey, thumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO blob_deletions (storage_key) VALUES (?)", key); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM task_attachments WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queueTaskBlobDeletions queues the blobs of the attachments of a task as
+// part of the caller's transaction, before the attachments go with the task
+// through their foreign key
+func queueTaskBlobDeletions(ctx context.Context, tx *sql.Tx, taskID string) error {
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO blob_deletions (storage_key)
+        SELECT storage_key FROM task_attachments WHERE task_id = ?
+        UNION ALL
+        SELECT thumbnail_key FROM task_attachments WHERE task_id = ? AND thumbnail_key <> ''`, taskID, taskID)
+	return err
+}
+
+// PendingBlobDeletions returns up to limit keys of queued blobs, oldest first
+func (r *MySQLAttachmentRepository) PendingBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT storage_key FROM blob_deletions ORDER BY created_at, storage_key LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ForgetBlobDeletions removes keys from the queue
+func (r *MySQLAttachmentRepository) ForgetBlobDeletions(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	_, err := r.db.ExecContext(ctx, "DELETE FROM blob_deletions WHERE storage_key IN ("+placeholders+")", args...)
+	return err
+}
+
+func scanAttachment(row rowScanner) (*models.Attachment, error) {
+	var attachment models.Attachment
+	var createdAt string
+	err := row.Scan(&attachment.ID, &attachment.TaskID, &attachment.UploaderID, &attachment.FileName, &attachment.ContentType,
+		&attachment.Size, &attachment.Checksum, &attachment.StorageKey, &attachment.ThumbnailKey, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLAttachmentRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLAttachmentRepository(db)
+	ctx := context.Background()
+	attachmentColumns := []string{"id", "task_id", "uploader_id", "file_name", "content_type", "size", "checksum",
+		"storage_key", "thumbnail_key", "created_at"}
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec("INSERT INTO task_attachments").
+			WithArgs("a1", "task1", int64(2), "before.jpg", "image/jpeg", int64(1024), "abc",
+				"attachments/a1", "attachments/a1-thumbnail", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		attachment := models.Attachment{ID: "a1", TaskID: "task1", UploaderID: 2, FileName: "before.jpg", ContentType: "image/jpeg",
+			Size: 1024, Checksum: "abc", StorageKey: "attachments/a1", ThumbnailKey: "attachments/a1-thumbnail"}
+		assert.NoError(t, repo.Create(ctx, &attachment))
+		assert.False(t, attachment.CreatedAt.IsZero())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create on a task of another organization", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\? AND technician_id IN").
+			WithArgs("task1", int64(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+
+		attachment := models.Attachment{ID: "a1", TaskID: "task1"}
+		assert.ErrorIs(t, repo.Create(tenant.WithOrganization(ctx, 2), &attachment), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, task_id, uploader_id.*FROM task_attachments WHERE id = \\? AND task_id = \\?").
+			WithArgs("a1", "task1").
+			WillReturnRows(sqlmock.NewRows(attachmentColumns).
+				AddRow("a1", "task1", 2, "before.jpg", "image/jpeg", 1024, "abc", "attachments/a1", "", "2024-12-29 10:30:00"))
+
+		attachment, err := repo.Get(ctx, "task1", "a1")
+		assert.NoError(t, err)
+		assert.Equal(t, "before.jpg", attachment.FileName)
+		assert.Equal(t, int64(1024), attachment.Size)
+		assert.Empty(t, attachment.ThumbnailKey)
+		assert.Equal(t, "2024-12-29 10:30:00", attachment.CreatedAt.Format("2006-01-02 15:04:05"))
+
+		mock.ExpectQuery("SELECT id, task_id, uploader_id.*FROM task_attachments").
+			WithArgs("a9", "task1").
+			WillReturnError(sql.ErrNoRows)
+		_, err = repo.Get(ctx, "task1", "a9")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list oldest first", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, task_id, uploader_id.*WHERE task_id = \\? ORDER BY created_at, id").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(attachmentColumns).
+				AddRow("a1", "task1", 2, "before.jpg", "image/jpeg", 1024, "abc", "attachments/a1", "", "2024-12-29 10:30:00").
+				AddRow("a2", "task1", 2, "report.pdf", "application/pdf", 2048, "def", "attachments/a2", "", "2024-12-29 10:45:00"))
+
+		attachments, err := repo.List(ctx, "task1")
+		assert.NoError(t, err)
+		assert.Len(t, attachments, 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete queues the blobs", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT storage_key, thumbnail_key FROM task_attachments WHERE id = \\? AND task_id = \\? FOR UPDATE").
+			WithArgs("a1", "task1").
+			WillReturnRows(sqlmock.NewRows([]string{"storage_key", "thumbnail_key"}).AddRow("attachments/a1", "attachments/a1-thumbnail"))
+		mock.ExpectExec("INSERT INTO blob_deletions \\(storage_key\\) VALUES \\(\\?\\)").
+			WithArgs("attachments/a1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO blob_deletions \\(storage_key\\) VALUES \\(\\?\\)").
+			WithArgs("attachments/a1-thumbnail").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM task_attachments WHERE id = \\?").
+			WithArgs("a1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		assert.NoError(t, repo.Delete(ctx, "task1", "a1"))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT storage_key, thumbnail_key FROM task_attachments").
+			WithArgs("a1", "task1").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, repo.Delete(ctx, "task1", "a1"), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("blob deletion queue", func(t *testing.T) {
+		mock.ExpectQuery("SELECT storage_key FROM blob_deletions ORDER BY created_at, storage_key LIMIT \\?").
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("attachments/a1").AddRow("attachments/a1-thumbnail"))
+		keys, err := repo.PendingBlobDeletions(ctx, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"attachments/a1", "attachments/a1-thumbnail"}, keys)
+
+		mock.ExpectExec("DELETE FROM blob_deletions WHERE storage_key IN \\(\\?, \\?\\)").
+			WithArgs("attachments/a1", "attachments/a1-thumbnail").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		assert.NoError(t, repo.ForgetBlobDeletions(ctx, keys))
+		assert.NoError(t, repo.ForgetBlobDeletions(ctx, nil))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
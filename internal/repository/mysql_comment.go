@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLCommentRepository implements CommentRepository on top of a MySQL database
+type MySQLCommentRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLCommentRepository creates a new MySQLCommentRepository
+func NewMySQLCommentRepository(db *sql.DB) *MySQLCommentRepository {
+	return &MySQLCommentRepository{
+		db: db,
+	}
+}
+
+const selectComment = `
+        SELECT c.id, c.task_id, c.author_id, COALESCE(u.username, ''), c.body,
+        DATE_FORMAT(c.created_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(c.edited_at, '%Y-%m-%d %H:%i:%s')
+        FROM task_comments c
+        LEFT JOIN users u ON u.id = c.author_id`
+
+// Create inserts a new comment together with its mentions and their outbox
+// message in one transaction
+func (r *MySQLCommentRepository) Create(ctx context.Context, comment *models.TaskComment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?"+scope+")",
+		append([]interface{}{comment.TaskID}, args...)...).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO task_comments (task_id, author_id, body) VALUES (?, ?, ?)",
+		comment.TaskID, comment.AuthorID, comment.Body)
+	if isMySQLError(err, mysqlErrNoReferencedRow) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	var authorName sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT username FROM users WHERE id = ?", comment.AuthorID).Scan(&authorName)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	comment.ID = id
+	comment.AuthorName = authorName.String
+	comment.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	comment.EditedAt = nil
+	if err := insertMentions(ctx, tx, comment, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertMentions stores the mentions of a comment and queues an outbox
+// message for those that are not in previous
+func insertMentions(ctx context.Context, tx *sql.Tx, comment *models.TaskComment, previous []int64) error {
+	for _, userID := range comment.Mentions {
+		_, err := tx.ExecContext(ctx, "INSERT INTO task_comment_mentions (comment_id, user_id) VALUES (?, ?)", comment.ID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload, ok := commentMentionedPayload(comment, previous); ok {
+		return insertOutboxMessage(ctx, tx, models.EventCommentMentioned, payload)
+	}
+	return nil
+}
+
+// commentMentionedPayload builds the outbox payload for the users a comment
+// mentions that are not in previous, ok is false when there are none
+func commentMentionedPayload(comment *models.TaskComment, previous []int64) (models.CommentMentionedPayload, bool) {
+	known := make(map[int64]bool, len(previous))
+	for _, userID := range previous {
+		known[userID] = true
+	}
+
+	payload := models.CommentMentionedPayload{
+		TaskID:    comment.TaskID,
+		CommentID: comment.ID,
+		AuthorID:  comment.AuthorID,
+		Body:      comment.Body,
+		CreatedAt: comment.CreatedAt,
+	}
+	if comment.EditedAt != nil {
+		payload.CreatedAt = *comment.EditedAt
+	}
+	for _, userID := range comment.Mentions {
+		if !known[userID] {
+			payload.UserIDs = append(payload.UserIDs, userID)
+		}
+	}
+	return payload, len(payload.UserIDs) > 0
+}
+
+// Get returns a comment of a task
+func (r *MySQLCommentRepository) Get(ctx context.Context, taskID string, id int64) (*models.TaskComment, error) {
+	scope, args := taskInOrganization(ctx, "c.task_id")
+	comment, err := scanComment(r.db.QueryRowContext(ctx, selectComment+" WHERE c.id = ? AND c.task_id = ?"+scope,
+		append([]interface{}{id, taskID}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id FROM task_comment_mentions WHERE comment_id = ? ORDER BY user_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		comment.Mentions = append(comment.Mentions, userID)
+	}
+	return comment, rows.Err()
+}
+
+// List returns the comments of a task, oldest first
+func (r *MySQLCommentRepository) List(ctx context.Context, taskID string) ([]models.TaskComment, error) {
+	scope, args := taskInOrganization(ctx, "c.task_id")
+	rows, err := r.db.QueryContext(ctx, selectComment+" WHERE c.task_id = ?"+scope+" ORDER BY c.id",
+		append([]interface{}{taskID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.TaskComment{}
+	index := map[int64]int{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[comment.ID] = len(comments)
+		comments = append(comments, *comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return comments, nil
+	}
+
+	mentions, err := r.db.QueryContext(ctx, `
+        SELECT m.comment_id, m.user_id
+        FROM task_comment_mentions m
+        JOIN task_comments c ON c.id = m.comment_id
+        WHERE c.task_id = ?
+        ORDER BY m.comment_id, m.user_id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer mentions.Close()
+
+	for mentions.Next() {
+		var commentID, userID int64
+		if err := mentions.Scan(&commentID, &userID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[commentID]; ok {
+			comments[i].Mentions = append(comments[i].Mentions, userID)
+		}
+	}
+	return comments, mentions.Err()
+}
+
+// Update replaces the body and mentions of a comment, storing the previous
+// body as a revision in the same transaction
+func (r *MySQLCommentRepository) Update(ctx context.Context, comment *models.TaskComment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Copying the current body also locks the comment until the commit
+	scope, args := taskInOrganization(ctx, "task_id")
+	result, err := tx.ExecContext(ctx, `
+        INSERT INTO task_comment_revisions (comment_id, body, created_at)
+        SELECT id, body, COALESCE(edited_at, created_at)
+        FROM task_comments
+        WHERE id = ? AND task_id = ?`+scope,
+		append([]interface{}{comment.ID, comment.TaskID}, args...)...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	previous, err := commentMentions(ctx, tx, comment.ID)
+	if err != nil {
+		return err
+	}
+
+	editedAt := time.Now().UTC().Truncate(time.Second)
+	_, err = tx.ExecContext(ctx, "UPDATE task_comments SET body = ?, edited_at = ? WHERE id = ?", comment.Body, editedAt, comment.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM task_comment_mentions WHERE comment_id = ?", comment.ID)
+	if err != nil {
+		return err
+	}
+
+	comment.EditedAt = &editedAt
+	if err := insertMentions(ctx, tx, comment, previous); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// commentMentions returns the users a comment mentions as part of the caller's transaction
+func commentMentions(ctx context.Context, tx *sql.Tx, commentID int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT user_id FROM task_comment_mentions WHERE comment_id = ?", commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, userID)
+	}
+	return mentions, rows.Err()
+}
+
+// Revisions returns the previous bodies of a comment, oldest first
+func (r *MySQLCommentRepository) Revisions(ctx context.Context, taskID string, id int64) ([]models.TaskCommentRevision, error) {
+	scope, args := taskInOrganization(ctx, "c.task_id")
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT r.id, r.body, DATE_FORMAT(r.created_at, '%Y-%m-%d %H:%i:%s')
+        FROM task_comment_revisions r
+        JOIN task_comments c ON c.id = r.comment_id
+        WHERE r.comment_id = ? AND c.task_id = ?`+scope+`
+        ORDER BY r.id`, append([]interface{}{id, taskID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.TaskCommentRevision{}
+	for rows.Next() {
+		revision := models.TaskCommentRevision{CommentID: id}
+		var createdAt string
+		if err := rows.Scan(&revision.ID, &revision.Body, &createdAt); err != nil {
+			return nil, err
+		}
+		revision.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
+		if err != nil {
+			return nil, ErrInvalidDate
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// Delete removes a comment, its revisions and mentions go with it through
+// their foreign keys
+func (r *MySQLCommentRepository) Delete(ctx context.Context, taskID string, id int64) error {
+	scope, args := taskInOrganization(ctx, "task_id")
+	result, err := r.db.ExecContext(ctx, "DELETE FROM task_comments WHERE id = ? AND task_id = ?"+scope,
+		append([]interface{}{id, taskID}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanComment(row rowScanner) (*models.TaskComment, error) {
+	comment := models.TaskComment{Mentions: []int64{}}
+	var createdAt string
+	var editedAt sql.NullString
+	err := row.Scan(&comment.ID, &comment.TaskID, &comment.AuthorID, &comment.AuthorName, &comment.Body, &createdAt, &editedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	comment.EditedAt, err = parseNullTime(editedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
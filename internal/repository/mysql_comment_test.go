@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+// mentionedUsers matches the outbox payload of a comment mentioning userIDs
+type mentionedUsers []int64
+
+func (m mentionedUsers) Match(value driver.Value) bool {
+	data, ok := value.([]byte)
+	if !ok {
+		return false
+	}
+	var payload models.CommentMentionedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return false
+	}
+	if len(payload.UserIDs) != len(m) {
+		return false
+	}
+	for i, userID := range m {
+		if payload.UserIDs[i] != userID {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMySQLCommentRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLCommentRepository(db)
+	ctx := context.Background()
+	commentColumns := []string{"id", "task_id", "author_id", "username", "body", "created_at", "edited_at"}
+
+	t.Run("create stores mentions and queues their notification", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec("INSERT INTO task_comments \\(task_id, author_id, body\\)").
+			WithArgs("task1", int64(2), "Ask @tech1 and @tech2").
+			WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectQuery("SELECT username FROM users WHERE id = \\?").
+			WithArgs(int64(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("manager1"))
+		mock.ExpectExec("INSERT INTO task_comment_mentions").
+			WithArgs(int64(5), int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO task_comment_mentions").
+			WithArgs(int64(5), int64(8)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventCommentMentioned, mentionedUsers{7, 8}).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		comment := models.TaskComment{TaskID: "task1", AuthorID: 2, Body: "Ask @tech1 and @tech2", Mentions: []int64{7, 8}}
+		assert.NoError(t, repo.Create(ctx, &comment))
+		assert.Equal(t, int64(5), comment.ID)
+		assert.Equal(t, "manager1", comment.AuthorName)
+		assert.False(t, comment.CreatedAt.IsZero())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create on a task of another organization", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\? AND technician_id IN").
+			WithArgs("task1", int64(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+
+		comment := models.TaskComment{TaskID: "task1", AuthorID: 2, Body: "Hello"}
+		assert.ErrorIs(t, repo.Create(tenant.WithOrganization(ctx, 2), &comment), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT c.id, c.task_id, c.author_id.*FROM task_comments c.*WHERE c.id = \\? AND c.task_id = \\?").
+			WithArgs(int64(5), "task1").
+			WillReturnRows(sqlmock.NewRows(commentColumns).
+				AddRow(5, "task1", 2, "manager1", "Ask @tech1", "2024-12-29 10:30:00", "2024-12-29 11:00:00"))
+		mock.ExpectQuery("SELECT user_id FROM task_comment_mentions WHERE comment_id = \\?").
+			WithArgs(int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+
+		comment, err := repo.Get(ctx, "task1", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, "manager1", comment.AuthorName)
+		assert.Equal(t, []int64{7}, comment.Mentions)
+		if assert.NotNil(t, comment.EditedAt) {
+			assert.Equal(t, "2024-12-29 11:00:00", comment.EditedAt.Format("2006-01-02 15:04:05"))
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown comment", func(t *testing.T) {
+		mock.ExpectQuery("SELECT c.id, c.task_id, c.author_id.*FROM task_comments c").
+			WithArgs(int64(99), "task1").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Get(ctx, "task1", 99)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list oldest first with mentions", func(t *testing.T) {
+		mock.ExpectQuery("SELECT c.id, c.task_id, c.author_id.*WHERE c.task_id = \\? ORDER BY c.id").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(commentColumns).
+				AddRow(5, "task1", 2, "manager1", "Ask @tech1", "2024-12-29 10:30:00", nil).
+				AddRow(6, "task1", 7, "", "Done", "2024-12-29 10:45:00", nil))
+		mock.ExpectQuery("SELECT m.comment_id, m.user_id.*FROM task_comment_mentions m").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"comment_id", "user_id"}).AddRow(5, 7))
+
+		comments, err := repo.List(ctx, "task1")
+		assert.NoError(t, err)
+		if assert.Len(t, comments, 2) {
+			assert.Equal(t, []int64{7}, comments[0].Mentions)
+			assert.Nil(t, comments[0].EditedAt)
+			assert.Equal(t, []int64{}, comments[1].Mentions)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update keeps a revision and notifies new mentions", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO task_comment_revisions \\(comment_id, body, created_at\\).*SELECT id, body, COALESCE\\(edited_at, created_at\\)").
+			WithArgs(int64(5), "task1").
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectQuery("SELECT user_id FROM task_comment_mentions WHERE comment_id = \\?").
+			WithArgs(int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+		mock.ExpectExec("UPDATE task_comments SET body = \\?, edited_at = \\? WHERE id = \\?").
+			WithArgs("Ask @tech1 and @tech2", sqlmock.AnyArg(), int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM task_comment_mentions WHERE comment_id = \\?").
+			WithArgs(int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO task_comment_mentions").
+			WithArgs(int64(5), int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO task_comment_mentions").
+			WithArgs(int64(5), int64(8)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventCommentMentioned, mentionedUsers{8}).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		comment := models.TaskComment{ID: 5, TaskID: "task1", AuthorID: 2, Body: "Ask @tech1 and @tech2", Mentions: []int64{7, 8}}
+		assert.NoError(t, repo.Update(ctx, &comment))
+		assert.NotNil(t, comment.EditedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update unknown comment", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO task_comment_revisions").
+			WithArgs(int64(99), "task1").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		comment := models.TaskComment{ID: 99, TaskID: "task1", Body: "x"}
+		assert.ErrorIs(t, repo.Update(ctx, &comment), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revisions oldest first", func(t *testing.T) {
+		mock.ExpectQuery("SELECT r.id, r.body.*FROM task_comment_revisions r.*ORDER BY r.id").
+			WithArgs(int64(5), "task1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "body", "created_at"}).
+				AddRow(3, "Ask @tech1", "2024-12-29 10:30:00"))
+
+		revisions, err := repo.Revisions(ctx, "task1", 5)
+		assert.NoError(t, err)
+		if assert.Len(t, revisions, 1) {
+			assert.Equal(t, int64(5), revisions[0].CommentID)
+			assert.Equal(t, "Ask @tech1", revisions[0].Body)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM task_comments WHERE id = \\? AND task_id = \\?").
+			WithArgs(int64(5), "task1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, repo.Delete(ctx, "task1", 5))
+
+		mock.ExpectExec("DELETE FROM task_comments WHERE id = \\? AND task_id = \\?").
+			WithArgs(int64(5), "task1").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.ErrorIs(t, repo.Delete(ctx, "task1", 5), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
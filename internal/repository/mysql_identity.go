@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLIdentityRepository implements IdentityRepository on top of a MySQL database
+type MySQLIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLIdentityRepository creates a new MySQLIdentityRepository
+func NewMySQLIdentityRepository(db *sql.DB) *MySQLIdentityRepository {
+	return &MySQLIdentityRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new identity into the organization of the context, unless
+// identity.OrganizationID is set, and sets its ID from the auto-increment column
+func (r *MySQLIdentityRepository) Create(ctx context.Context, identity *models.Identity) error {
+	return insertIdentity(ctx, r.db, identity)
+}
+
+func insertIdentity(ctx context.Context, db execer, identity *models.Identity) error {
+	orgID := organizationFor(ctx, identity.OrganizationID)
+	result, err := db.ExecContext(ctx,
+		"INSERT INTO user_identities (organization_id, user_id, issuer, subject) VALUES (?, ?, ?, ?)",
+		orgID, identity.UserID, identity.Issuer, identity.Subject)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	identity.ID = id
+	identity.OrganizationID = orgID
+	identity.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// GetBySubject returns the account with the given issuer and subject. It is
+// not scoped, the user logging in has no organization yet.
+func (r *MySQLIdentityRepository) GetBySubject(ctx context.Context, issuer, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	var createdAt string
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, organization_id, user_id, issuer, subject, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM user_identities WHERE issuer = ? AND subject = ?`, issuer, subject).
+		Scan(&identity.ID, &identity.OrganizationID, &identity.UserID, &identity.Issuer, &identity.Subject, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if identity.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &identity, nil
+}
+
+// Provision creates the user and links the account to it in one transaction,
+// so a taken username leaves nothing behind and an account linked meanwhile
+// leaves no user behind
+func (r *MySQLIdentityRepository) Provision(ctx context.Context, identity *models.Identity, user *models.User) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	identity.OrganizationID = user.OrganizationID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLIdentityRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLIdentityRepository(db)
+	ctx := context.Background()
+	issuer := "https://idp.example.com"
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO user_identities").
+			WithArgs(int64(2), 7, issuer, "user-1").
+			WillReturnResult(sqlmock.NewResult(3, 1))
+
+		identity := models.Identity{UserID: 7, Issuer: issuer, Subject: "user-1"}
+		assert.NoError(t, repo.Create(tenant.WithOrganization(ctx, 2), &identity))
+		assert.Equal(t, int64(3), identity.ID)
+		assert.Equal(t, int64(2), identity.OrganizationID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create a linked account", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO user_identities").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+
+		err := repo.Create(ctx, &models.Identity{UserID: 8, Issuer: issuer, Subject: "user-1"})
+		assert.ErrorIs(t, err, ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get by subject is not scoped", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, user_id, issuer, subject,.*FROM user_identities WHERE issuer = \\? AND subject = \\?$").
+			WithArgs(issuer, "user-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "user_id", "issuer", "subject", "created_at"}).
+				AddRow(3, 2, 7, issuer, "user-1", "2025-01-01 08:00:00"))
+
+		identity, err := repo.GetBySubject(tenant.WithOrganization(ctx, 1), issuer, "user-1")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(7), identity.UserID)
+		assert.Equal(t, int64(2), identity.OrganizationID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get an unknown subject", func(t *testing.T) {
+		mock.ExpectQuery("FROM user_identities").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "user_id", "issuer", "subject", "created_at"}))
+
+		_, err := repo.GetBySubject(ctx, issuer, "user-2")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("provision", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs(int64(2), "alice", nil, "", models.RoleTechnician).
+			WillReturnResult(sqlmock.NewResult(9, 1))
+		mock.ExpectExec("INSERT INTO user_identities").
+			WithArgs(int64(2), uint(9), issuer, "user-2").
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectCommit()
+
+		user := models.User{Username: "alice", Role: models.RoleTechnician, OrganizationID: 2}
+		identity := models.Identity{Issuer: issuer, Subject: "user-2"}
+		assert.NoError(t, repo.Provision(ctx, &identity, &user))
+		assert.Equal(t, uint(9), user.ID)
+		assert.Equal(t, uint(9), identity.UserID)
+		assert.Equal(t, int64(4), identity.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("provision a linked account rolls back", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectExec("INSERT INTO user_identities").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+		mock.ExpectRollback()
+
+		err := repo.Provision(ctx, &models.Identity{Issuer: issuer, Subject: "user-2"},
+			&models.User{Username: "alice2", Role: models.RoleTechnician})
+		assert.ErrorIs(t, err, ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
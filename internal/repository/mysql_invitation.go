@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLInvitationRepository implements InvitationRepository on top of a MySQL database
+type MySQLInvitationRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLInvitationRepository creates a new MySQLInvitationRepository
+func NewMySQLInvitationRepository(db *sql.DB) *MySQLInvitationRepository {
+	return &MySQLInvitationRepository{
+		db: db,
+	}
+}
+
+const invitationSelect = `
+        SELECT id, organization_id, token_id, email, role, invited_by,
+        DATE_FORMAT(expires_at, '%Y-%m-%d %H:%i:%s'),
+        accepted_by,
+        DATE_FORMAT(accepted_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(revoked_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM invitations`
+
+// Create inserts a new invitation into the organization of the context and
+// sets its ID from the auto-increment column
+func (r *MySQLInvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	query := `
+        INSERT INTO invitations (organization_id, token_id, email, role, invited_by, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	orgID := organizationFor(ctx, invitation.OrganizationID)
+	invitedBy := sql.NullInt64{Int64: int64(invitation.InvitedBy), Valid: invitation.InvitedBy != 0}
+	result, err := r.db.ExecContext(ctx, query, orgID, invitation.TokenID, invitation.Email, invitation.Role,
+		invitedBy, invitation.ExpiresAt.UTC())
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	invitation.ID = id
+	invitation.OrganizationID = orgID
+	invitation.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// Get returns the invitation with the given ID
+func (r *MySQLInvitationRepository) Get(ctx context.Context, id int64) (*models.Invitation, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	return scanInvitation(r.db.QueryRowContext(ctx, invitationSelect+` WHERE id = ?`+scope, append([]interface{}{id}, args...)...))
+}
+
+// GetByTokenID returns the invitation issued with the token with the given
+// jti. It is not scoped, the invitee has no organization yet.
+func (r *MySQLInvitationRepository) GetByTokenID(ctx context.Context, tokenID string) (*models.Invitation, error) {
+	return scanInvitation(r.db.QueryRowContext(ctx, invitationSelect+` WHERE token_id = ?`, tokenID))
+}
+
+// List returns every invitation ordered by ID
+func (r *MySQLInvitationRepository) List(ctx context.Context) ([]models.Invitation, error) {
+	scope, args := whereOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, invitationSelect+scope+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// Revoke revokes a pending invitation
+func (r *MySQLInvitationRepository) Revoke(ctx context.Context, id int64) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE invitations SET revoked_at = ? WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL"+scope,
+		append([]interface{}{time.Now().UTC(), id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Tell an unknown invitation from one that is no longer pending
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+// Accept claims the invitation with a compare-and-set and creates the user,
+// in the organization of the invitation, in the same transaction, so a failed
+// registration leaves it pending
+func (r *MySQLInvitationRepository) Accept(ctx context.Context, tokenID string, user *models.User) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `
+        UPDATE invitations SET accepted_at = ?
+        WHERE token_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?`,
+		now, tokenID, now)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+
+	if err := tx.QueryRowContext(ctx, "SELECT organization_id FROM invitations WHERE token_id = ?", tokenID).
+		Scan(&user.OrganizationID); err != nil {
+		return err
+	}
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE invitations SET accepted_by = ? WHERE token_id = ?", user.ID, tokenID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	var invitation models.Invitation
+	var invitedBy, acceptedBy sql.NullInt64
+	var expiresAt, createdAt string
+	var acceptedAt, revokedAt sql.NullString
+	err := row.Scan(&invitation.ID, &invitation.OrganizationID, &invitation.TokenID, &invitation.Email, &invitation.Role, &invitedBy,
+		&expiresAt, &acceptedBy, &acceptedAt, &revokedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.InvitedBy = uint(invitedBy.Int64)
+	if acceptedBy.Valid {
+		id := uint(acceptedBy.Int64)
+		invitation.AcceptedBy = &id
+	}
+	if invitation.ExpiresAt, err = time.Parse("2006-01-02 15:04:05", expiresAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if invitation.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if invitation.AcceptedAt, err = parseNullTime(acceptedAt); err != nil {
+		return nil, err
+	}
+	if invitation.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLInvitationRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLInvitationRepository(db)
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC)
+	columns := []string{"id", "organization_id", "token_id", "email", "role", "invited_by", "expires_at", "accepted_by",
+		"accepted_at", "revoked_at", "created_at"}
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO invitations").
+			WithArgs(models.DefaultOrganizationID, "jti-1", "new@example.com", models.RoleManager, 1, expiresAt).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+
+		invitation := models.Invitation{TokenID: "jti-1", Email: "new@example.com", Role: models.RoleManager,
+			InvitedBy: 1, ExpiresAt: expiresAt}
+		assert.NoError(t, repo.Create(ctx, &invitation))
+		assert.Equal(t, int64(3), invitation.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get by token ID", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, token_id, email, role, invited_by,.*FROM invitations WHERE token_id = ?").
+			WithArgs("jti-1").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 1, "jti-1", "new@example.com", "manager", nil, "2025-02-01 08:00:00", 7,
+					"2025-01-02 08:00:00", nil, "2025-01-01 08:00:00"))
+
+		invitation, err := repo.GetByTokenID(ctx, "jti-1")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(0), invitation.InvitedBy)
+		assert.Equal(t, uint(7), *invitation.AcceptedBy)
+		assert.True(t, expiresAt.Equal(invitation.ExpiresAt))
+		assert.Equal(t, models.InvitationAccepted, invitation.Status(expiresAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke an accepted invitation", func(t *testing.T) {
+		mock.ExpectExec("UPDATE invitations SET revoked_at = \\? WHERE id = \\? AND accepted_at IS NULL AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT id, organization_id, token_id.*FROM invitations WHERE id = ?").
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(3, 1, "jti-1", "new@example.com", "manager", 1, "2025-02-01 08:00:00", 7,
+					"2025-01-02 08:00:00", nil, "2025-01-01 08:00:00"))
+
+		assert.ErrorIs(t, repo.Revoke(ctx, 3), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke an invitation of another organization", func(t *testing.T) {
+		mock.ExpectExec("UPDATE invitations SET revoked_at = \\?.* AND organization_id = \\?").
+			WithArgs(sqlmock.AnyArg(), 3, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FROM invitations WHERE id = \\? AND organization_id = \\?").
+			WithArgs(3, int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		assert.ErrorIs(t, repo.Revoke(tenant.WithOrganization(ctx, 2), 3), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("accept into the organization of the invitation", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE invitations SET accepted_at = \\?").
+			WithArgs(sqlmock.AnyArg(), "jti-1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT organization_id FROM invitations WHERE token_id = \\?").
+			WithArgs("jti-1").
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(2))
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs(int64(2), "manager1", "new@example.com", "hash", models.RoleManager).
+			WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("UPDATE invitations SET accepted_by = \\? WHERE token_id = \\?").
+			WithArgs(7, "jti-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		user := models.User{Username: "manager1", Email: "new@example.com", Password: "hash", Role: models.RoleManager}
+		assert.NoError(t, repo.Accept(ctx, "jti-1", &user))
+		assert.Equal(t, uint(7), user.ID)
+		assert.Equal(t, int64(2), user.OrganizationID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("accept twice", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE invitations SET accepted_at = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-1", &models.User{Username: "manager2"}), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("accept with a taken username rolls back", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE invitations SET accepted_at = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT organization_id FROM invitations").
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.Accept(ctx, "jti-2", &models.User{Username: "manager1"}), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLLoginAttemptRepository implements LoginAttemptRepository on top of a MySQL database
+type MySQLLoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLLoginAttemptRepository creates a new MySQLLoginAttemptRepository
+func NewMySQLLoginAttemptRepository(db *sql.DB) *MySQLLoginAttemptRepository {
+	return &MySQLLoginAttemptRepository{
+		db: db,
+	}
+}
+
+// Get returns the failures counted for a key
+func (r *MySQLLoginAttemptRepository) Get(ctx context.Context, key string) (*models.LoginAttempts, error) {
+	query := `
+        SELECT failures, DATE_FORMAT(last_failure_at, '%Y-%m-%d %H:%i:%s')
+        FROM login_attempts WHERE attempt_key = ?`
+
+	attempts := models.LoginAttempts{Key: key}
+	var lastFailureAt string
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&attempts.Failures, &lastFailureAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if attempts.LastFailureAt, err = time.Parse("2006-01-02 15:04:05", lastFailureAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &attempts, nil
+}
+
+// RecordFailure counts a failed login in one statement, so concurrent
+// failures are all counted. The count starts over after window.
+func (r *MySQLLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) error {
+	// The assignments are evaluated in order, failures still sees the
+	// previous last_failure_at
+	query := `
+        INSERT INTO login_attempts (attempt_key, failures, last_failure_at) VALUES (?, 1, ?)
+        ON DUPLICATE KEY UPDATE
+            failures = IF(last_failure_at < ?, 1, failures + 1),
+            last_failure_at = VALUES(last_failure_at)
+    `
+	_, err := r.db.ExecContext(ctx, query, key, at.UTC(), at.Add(-window).UTC())
+	return err
+}
+
+// Reserve counts an attempt unless the key is locked out. The row of the key
+// is locked while the failures are checked, so concurrent attempts are
+// checked one after the other.
+func (r *MySQLLoginAttemptRepository) Reserve(ctx context.Context, key string, at time.Time, policy auth.LockoutPolicy) (time.Time, error) {
+	// Make sure there is a row to lock, concurrent transactions locking the
+	// gap of a missing row deadlock when they both insert it
+	_, err := r.db.ExecContext(ctx, `
+        INSERT IGNORE INTO login_attempts (attempt_key, failures, last_failure_at) VALUES (?, 0, ?)`,
+		key, at.UTC())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT failures, DATE_FORMAT(last_failure_at, '%Y-%m-%d %H:%i:%s')
+        FROM login_attempts WHERE attempt_key = ? FOR UPDATE`
+
+	attempts := models.LoginAttempts{Key: key}
+	var lastFailureAt string
+	if err := tx.QueryRowContext(ctx, query, key).Scan(&attempts.Failures, &lastFailureAt); err != nil {
+		return time.Time{}, err
+	}
+	if attempts.LastFailureAt, err = time.Parse("2006-01-02 15:04:05", lastFailureAt); err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	if attempts.LastFailureAt.Before(at.Add(-policy.Window)) {
+		attempts.Failures = 0
+	}
+	if until := policy.LockedUntil(&attempts); until.After(at) {
+		return until, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE login_attempts SET failures = ?, last_failure_at = ? WHERE attempt_key = ?",
+		attempts.Failures+1, at.UTC(), key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, tx.Commit()
+}
+
+// Release takes back a reserved attempt
+func (r *MySQLLoginAttemptRepository) Release(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE login_attempts SET failures = failures - 1 WHERE attempt_key = ? AND failures > 0", key)
+	return err
+}
+
+// Reset forgets the failures of a key
+func (r *MySQLLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
+
+// Purge deletes the keys whose last failure is older than before
+func (r *MySQLLoginAttemptRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE last_failure_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
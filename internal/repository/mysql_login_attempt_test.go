@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLLoginAttemptRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLLoginAttemptRepository(db)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT failures, .* FROM login_attempts WHERE attempt_key = ?").
+			WithArgs("user:alice").
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at"}).AddRow(3, "2025-01-01 08:00:00"))
+
+		attempts, err := repo.Get(ctx, "user:alice")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts.Failures)
+		assert.True(t, now.Equal(attempts.LastFailureAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown key", func(t *testing.T) {
+		mock.ExpectQuery("SELECT failures, .* FROM login_attempts WHERE attempt_key = ?").
+			WithArgs("user:bob").
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at"}))
+
+		_, err := repo.Get(ctx, "user:bob")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("record failure", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO login_attempts .* ON DUPLICATE KEY UPDATE").
+			WithArgs("user:alice", now, now.Add(-time.Hour)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		assert.NoError(t, repo.RecordFailure(ctx, "user:alice", now, time.Hour))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reserve locks the row while checking", func(t *testing.T) {
+		policy := auth.LockoutPolicy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+		expectRow := func(failures int) {
+			mock.ExpectExec("INSERT IGNORE INTO login_attempts").
+				WithArgs("user:alice", now).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT failures, .* FROM login_attempts WHERE attempt_key = \\? FOR UPDATE").
+				WithArgs("user:alice").
+				WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at"}).AddRow(failures, "2025-01-01 07:59:30"))
+		}
+
+		expectRow(2)
+		mock.ExpectExec("UPDATE login_attempts SET failures = \\?, last_failure_at = \\?").
+			WithArgs(3, now, "user:alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		until, err := repo.Reserve(ctx, "user:alice", now, policy)
+		assert.NoError(t, err)
+		assert.True(t, until.IsZero())
+
+		expectRow(3)
+		mock.ExpectRollback()
+		until, err = repo.Reserve(ctx, "user:alice", now, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(30*time.Second), until)
+
+		mock.ExpectExec("UPDATE login_attempts SET failures = failures - 1").
+			WithArgs("user:alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, repo.Release(ctx, "user:alice"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reset and purge", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM login_attempts WHERE attempt_key = ?").
+			WithArgs("user:alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM login_attempts WHERE last_failure_at < ?").
+			WithArgs(now).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		assert.NoError(t, repo.Reset(ctx, "user:alice"))
+		purged, err := repo.Purge(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), purged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLMFARepository implements MFARepository on top of a MySQL database
+type MySQLMFARepository struct {
+	db *sql.DB
+	// keyring encrypts TOTP secrets at rest, they are stored in plaintext without it
+	keyring *encryption.Keyring
+}
+
+// NewMySQLMFARepository creates a new MySQLMFARepository. TOTP secrets are
+// encrypted with keys from the keyring, which may be nil to store them in
+// plaintext.
+func NewMySQLMFARepository(db *sql.DB, keyring *encryption.Keyring) *MySQLMFARepository {
+	return &MySQLMFARepository{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+// GetTOTP returns the TOTP enrollment of a user, decrypting its secret
+func (r *MySQLMFARepository) GetTOTP(ctx context.Context, userID uint) (*models.TOTPEnrollment, error) {
+	query := `
+        SELECT secret, secret_key_id, secret_wrapped_key, last_used_step,
+        DATE_FORMAT(confirmed_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM user_totp WHERE user_id = ?`
+
+	enrollment := models.TOTPEnrollment{UserID: userID}
+	var secret string
+	var keyID, wrappedKey, confirmedAt sql.NullString
+	var createdAt string
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&secret, &keyID, &wrappedKey, &enrollment.LastUsedStep,
+		&confirmedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if enrollment.Secret, err = r.openSecret(userID, secret, keyID, wrappedKey); err != nil {
+		return nil, err
+	}
+	if enrollment.ConfirmedAt, err = parseNullTime(confirmedAt); err != nil {
+		return nil, err
+	}
+	if enrollment.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &enrollment, nil
+}
+
+// StartTOTP replaces an unconfirmed enrollment with a new one. A confirmed
+// enrollment is left in place and makes the insert fail as a duplicate.
+func (r *MySQLMFARepository) StartTOTP(ctx context.Context, enrollment *models.TOTPEnrollment) error {
+	secret, keyID, wrappedKey, err := r.sealSecret(enrollment.UserID, enrollment.Secret)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ? AND confirmed_at IS NULL", enrollment.UserID); err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO user_totp (user_id, secret, secret_key_id, secret_wrapped_key) VALUES (?, ?, ?, ?)",
+		enrollment.UserID, secret, keyID, wrappedKey)
+	if err != nil {
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			return ErrConflict
+		}
+		return err
+	}
+
+	enrollment.ConfirmedAt = nil
+	enrollment.LastUsedStep = 0
+	enrollment.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// ConfirmTOTP confirms a pending enrollment and replaces the recovery codes in one transaction
+func (r *MySQLMFARepository) ConfirmTOTP(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE user_totp SET confirmed_at = ?, last_used_step = ? WHERE user_id = ? AND confirmed_at IS NULL",
+		time.Now().UTC(), step, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return r.missingOrConflict(ctx, userID)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep moves the last used step forward with a compare-and-set, so of
+// two concurrent logins with the same code only one succeeds
+func (r *MySQLMFARepository) UseTOTPStep(ctx context.Context, userID uint, step int64) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?",
+		step, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return r.missingOrConflict(ctx, userID)
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used
+func (r *MySQLMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of a user in one transaction
+func (r *MySQLMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of a user
+func (r *MySQLMFARepository) RecoveryCodesLeft(ctx context.Context, userID uint) (int, error) {
+	var left int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&left)
+	return left, err
+}
+
+// DeleteTOTP removes the enrollment and the recovery codes of a user in one transaction
+func (r *MySQLMFARepository) DeleteTOTP(ctx context.Context, userID uint) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// missingOrConflict tells apart an update that matched nothing because the
+// user has no enrollment from one whose condition no longer held
+func (r *MySQLMFARepository) missingOrConflict(ctx context.Context, userID uint) error {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = ?)", userID).
+		Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and inserts the new ones
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uint, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(codeHashes))
+	args := make([]interface{}, 0, 2*len(codeHashes))
+	for _, hash := range codeHashes {
+		placeholders = append(placeholders, "(?, ?)")
+		args = append(args, userID, hash)
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO recovery_codes (user_id, code_hash) VALUES "+strings.Join(placeholders, ", "), args...)
+	return err
+}
+
+// sealSecret prepares a TOTP secret for storage, encrypting it when a keyring
+// is configured. The user ID is bound to the ciphertext so a secret can not be
+// moved to another user.
+func (r *MySQLMFARepository) sealSecret(userID uint, secret string) (string, sql.NullString, sql.NullString, error) {
+	if r.keyring == nil {
+		return secret, sql.NullString{}, sql.NullString{}, nil
+	}
+
+	sealed, err := r.keyring.Seal([]byte(secret), []byte(strconv.FormatUint(uint64(userID), 10)))
+	if err != nil {
+		return "", sql.NullString{}, sql.NullString{}, err
+	}
+	return base64.StdEncoding.EncodeToString(sealed.Ciphertext),
+		sql.NullString{String: sealed.KeyID, Valid: true},
+		sql.NullString{String: base64.StdEncoding.EncodeToString(sealed.WrappedKey), Valid: true},
+		nil
+}
+
+// openSecret returns the plaintext of a stored TOTP secret
+func (r *MySQLMFARepository) openSecret(userID uint, secret string, keyID, wrappedKey sql.NullString) (string, error) {
+	if !keyID.Valid {
+		return secret, nil
+	}
+	if r.keyring == nil {
+		return "", fmt.Errorf("%w: TOTP secret of user %d is encrypted with key %s but no keyring is configured", ErrDecrypt, userID, keyID.String)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("%w: TOTP secret of user %d: %v", ErrDecrypt, userID, err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedKey.String)
+	if err != nil {
+		return "", fmt.Errorf("%w: TOTP secret of user %d: %v", ErrDecrypt, userID, err)
+	}
+	plaintext, err := r.keyring.Open(encryption.Sealed{KeyID: keyID.String, WrappedKey: wrapped, Ciphertext: ciphertext},
+		[]byte(strconv.FormatUint(uint64(userID), 10)))
+	if err != nil {
+		return "", fmt.Errorf("%w: TOTP secret of user %d: %v", ErrDecrypt, userID, err)
+	}
+	return string(plaintext), nil
+}
+
+// RotateSecretKeys re-encrypts under the primary key every TOTP secret that
+// is stored in plaintext or under an older key, like RotateSummaryKeys does
+// for task summaries. It returns the total number of secrets rotated.
+func (r *MySQLMFARepository) RotateSecretKeys(ctx context.Context, batchSize int, onBatch func(rotated int)) (int, error) {
+	if r.keyring == nil {
+		return 0, fmt.Errorf("TOTP secret encryption is not configured")
+	}
+
+	total := 0
+	var lastUserID uint
+	for {
+		rotated, last, err := r.rotateSecretBatch(ctx, lastUserID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if rotated == 0 {
+			return total, nil
+		}
+
+		total += rotated
+		lastUserID = last
+		if onBatch != nil {
+			onBatch(rotated)
+		}
+		if rotated < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// rotateSecretBatch re-encrypts the next batch of stale secrets after afterUserID
+func (r *MySQLMFARepository) rotateSecretBatch(ctx context.Context, afterUserID uint, batchSize int) (int, uint, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT user_id, secret, secret_key_id, secret_wrapped_key
+        FROM user_totp
+        WHERE user_id > ? AND (secret_key_id IS NULL OR secret_key_id <> ?)
+        ORDER BY user_id
+        LIMIT ?
+        FOR UPDATE`, afterUserID, r.keyring.PrimaryKeyID(), batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type staleRow struct {
+		userID     uint
+		secret     string
+		keyID      sql.NullString
+		wrappedKey sql.NullString
+	}
+	var batch []staleRow
+	for rows.Next() {
+		var row staleRow
+		if err := rows.Scan(&row.userID, &row.secret, &row.keyID, &row.wrappedKey); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, row := range batch {
+		secret, err := r.openSecret(row.userID, row.secret, row.keyID, row.wrappedKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		sealed, keyID, wrappedKey, err := r.sealSecret(row.userID, secret)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE user_totp SET secret = ?, secret_key_id = ?, secret_wrapped_key = ? WHERE user_id = ?",
+			sealed, keyID, wrappedKey, row.userID)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if len(batch) == 0 {
+		return 0, 0, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return len(batch), batch[len(batch)-1].userID, nil
+}
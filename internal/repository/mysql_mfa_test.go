@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLMFARepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	totpColumns := []string{"secret", "secret_key_id", "secret_wrapped_key", "last_used_step", "confirmed_at", "created_at"}
+
+	t.Run("secrets are encrypted with the keyring", func(t *testing.T) {
+		repo := NewMySQLMFARepository(db, testKeyring(t, "new"))
+		secret, keyID, wrappedKey := &capture{}, &capture{}, &capture{}
+		mock.ExpectExec("DELETE FROM user_totp WHERE user_id = \\? AND confirmed_at IS NULL").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO user_totp").
+			WithArgs(7, secret, keyID, wrappedKey).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.StartTOTP(ctx, &models.TOTPEnrollment{UserID: 7, Secret: "JBSWY3DPEHPK3PXP"}))
+		assert.NotEqual(t, "JBSWY3DPEHPK3PXP", secret.value)
+		assert.Equal(t, "new", keyID.value)
+
+		mock.ExpectQuery("SELECT secret, secret_key_id, secret_wrapped_key, last_used_step, .* FROM user_totp WHERE user_id = ?").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(totpColumns).
+				AddRow(secret.value, keyID.value, wrappedKey.value, 0, nil, "2025-01-01 08:00:00"))
+		enrollment, err := repo.GetTOTP(ctx, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", enrollment.Secret)
+		assert.False(t, enrollment.Confirmed())
+
+		// The ciphertext is bound to the user
+		mock.ExpectQuery("SELECT secret, .* FROM user_totp WHERE user_id = ?").
+			WithArgs(8).
+			WillReturnRows(sqlmock.NewRows(totpColumns).
+				AddRow(secret.value, keyID.value, wrappedKey.value, 0, nil, "2025-01-01 08:00:00"))
+		_, err = repo.GetTOTP(ctx, 8)
+		assert.ErrorIs(t, err, ErrDecrypt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rotation re-encrypts stale secrets so the old key can be dropped", func(t *testing.T) {
+		stale, staleKeyID, staleWrappedKey, err := NewMySQLMFARepository(db, testKeyring(t, "old")).sealSecret(7, "JBSWY3DPEHPK3PXP")
+		assert.NoError(t, err)
+
+		secret, keyID, wrappedKey := &capture{}, &capture{}, &capture{}
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT user_id, secret, secret_key_id, secret_wrapped_key\\s+FROM user_totp.*FOR UPDATE").
+			WithArgs(0, "new", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "secret_key_id", "secret_wrapped_key"}).
+				AddRow(7, stale, staleKeyID.String, staleWrappedKey.String).
+				AddRow(9, "KRUGS4ZANFZSAYJA", nil, nil))
+		mock.ExpectExec("UPDATE user_totp SET secret = \\?, secret_key_id = \\?, secret_wrapped_key = \\? WHERE user_id = \\?").
+			WithArgs(secret, keyID, wrappedKey, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE user_totp SET secret").
+			WithArgs(sqlmock.AnyArg(), "new", sqlmock.AnyArg(), 9).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rotated, err := NewMySQLMFARepository(db, testKeyring(t, "new")).RotateSecretKeys(ctx, 10, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rotated)
+		assert.Equal(t, "new", keyID.value)
+
+		newOnly, err := encryption.NewKeyring("new", map[string][]byte{"new": bytes.Repeat([]byte{2}, encryption.KeySize)})
+		assert.NoError(t, err)
+		mock.ExpectQuery("SELECT secret, .* FROM user_totp WHERE user_id = ?").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(totpColumns).
+				AddRow(secret.value, keyID.value, wrappedKey.value, 0, "2025-01-01 08:00:00", "2025-01-01 08:00:00"))
+		enrollment, err := NewMySQLMFARepository(db, newOnly).GetTOTP(ctx, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", enrollment.Secret)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	repo := NewMySQLMFARepository(db, nil)
+
+	t.Run("rotation needs a keyring", func(t *testing.T) {
+		_, err := repo.RotateSecretKeys(ctx, 10, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("start with a confirmed enrollment", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM user_totp").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO user_totp").
+			WithArgs(7, "JBSWY3DPEHPK3PXP", nil, nil).
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+		assert.ErrorIs(t, repo.StartTOTP(ctx, &models.TOTPEnrollment{UserID: 7, Secret: "JBSWY3DPEHPK3PXP"}), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_totp SET confirmed_at = \\?, last_used_step = \\? WHERE user_id = \\? AND confirmed_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 100, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id = ?").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO recovery_codes \\(user_id, code_hash\\) VALUES \\(\\?, \\?\\), \\(\\?, \\?\\)").
+			WithArgs(7, "hash-1", 7, "hash-2").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.ConfirmTOTP(ctx, 7, 100, []string{"hash-1", "hash-2"}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("confirm a confirmed enrollment", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_totp SET confirmed_at").
+			WithArgs(sqlmock.AnyArg(), 100, 7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM user_totp WHERE user_id = \\?\\)").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.ConfirmTOTP(ctx, 7, 100, nil), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("replayed step", func(t *testing.T) {
+		mock.ExpectExec("UPDATE user_totp SET last_used_step = \\? WHERE user_id = \\? AND last_used_step < \\?").
+			WithArgs(100, 7, 100).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		assert.ErrorIs(t, repo.UseTOTPStep(ctx, 7, 100), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+		mock.ExpectExec("UPDATE recovery_codes SET used_at = \\? WHERE user_id = \\? AND code_hash = \\? AND used_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 7, "hash-1").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM recovery_codes WHERE user_id = \\? AND used_at IS NULL").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(9))
+
+		assert.ErrorIs(t, repo.UseRecoveryCode(ctx, 7, "hash-1"), ErrNotFound)
+		left, err := repo.RecoveryCodesLeft(ctx, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, 9, left)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM user_totp WHERE user_id = ?").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id = ?").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.DeleteTOTP(ctx, 7))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
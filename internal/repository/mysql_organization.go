@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLOrganizationRepository implements OrganizationRepository on top of a MySQL database
+type MySQLOrganizationRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLOrganizationRepository creates a new MySQLOrganizationRepository
+func NewMySQLOrganizationRepository(db *sql.DB) *MySQLOrganizationRepository {
+	return &MySQLOrganizationRepository{
+		db: db,
+	}
+}
+
+const organizationSelect = `
+        SELECT id, slug, name, settings, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM organizations`
+
+// Create inserts a new organization and sets its ID from the auto-increment column
+func (r *MySQLOrganizationRepository) Create(ctx context.Context, organization *models.Organization) error {
+	settings, err := json.Marshal(organization.Settings)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, `INSERT INTO organizations (slug, name, settings) VALUES (?, ?, ?)`,
+		organization.Slug, organization.Name, string(settings))
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	organization.ID = id
+	organization.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// Get returns the organization with the given ID
+func (r *MySQLOrganizationRepository) Get(ctx context.Context, id int64) (*models.Organization, error) {
+	return scanOrganization(r.db.QueryRowContext(ctx, organizationSelect+` WHERE id = ?`, id))
+}
+
+// GetBySlug returns the organization with the given slug
+func (r *MySQLOrganizationRepository) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	return scanOrganization(r.db.QueryRowContext(ctx, organizationSelect+` WHERE slug = ?`, slug))
+}
+
+// UpdateSettings replaces the settings of an organization
+func (r *MySQLOrganizationRepository) UpdateSettings(ctx context.Context, id int64, settings models.OrganizationSettings) error {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE organizations SET settings = ? WHERE id = ?`, string(encoded), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Either the organization is unknown or nothing changed
+		_, err := r.Get(ctx, id)
+		return err
+	}
+	return nil
+}
+
+func scanOrganization(row rowScanner) (*models.Organization, error) {
+	var organization models.Organization
+	var settings []byte
+	var createdAt sql.NullString
+	err := row.Scan(&organization.ID, &organization.Slug, &organization.Name, &settings, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(settings, &organization.Settings); err != nil {
+		return nil, err
+	}
+	created, err := parseNullTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		organization.CreatedAt = *created
+	}
+	return &organization, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLOrganizationRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLOrganizationRepository(db)
+	ctx := context.Background()
+	columns := []string{"id", "slug", "name", "settings", "created_at"}
+
+	t.Run("create stores settings as JSON", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO organizations \\(slug, name, settings\\)").
+			WithArgs("globex", "Globex", `{"open_registration":false,"default_timezone":"Europe/Madrid"}`).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+
+		organization := models.Organization{Slug: "globex", Name: "Globex",
+			Settings: models.OrganizationSettings{DefaultTimezone: "Europe/Madrid"}}
+		assert.NoError(t, repo.Create(ctx, &organization))
+		assert.Equal(t, int64(2), organization.ID)
+
+		mock.ExpectExec("INSERT INTO organizations").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+		assert.ErrorIs(t, repo.Create(ctx, &models.Organization{Slug: "globex"}), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get by slug", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, slug, name, settings,.*FROM organizations WHERE slug = ?").
+			WithArgs("default").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "default", "Default", `{"open_registration": true}`, "2025-01-01 08:00:00"))
+
+		organization, err := repo.GetBySlug(ctx, "default")
+		assert.NoError(t, err)
+		assert.Equal(t, models.DefaultOrganizationID, organization.ID)
+		assert.True(t, organization.Settings.OpenRegistration)
+
+		mock.ExpectQuery("FROM organizations WHERE slug = ?").
+			WithArgs("nobody").
+			WillReturnRows(sqlmock.NewRows(columns))
+		_, err = repo.GetBySlug(ctx, "nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update settings of an unknown organization", func(t *testing.T) {
+		mock.ExpectExec("UPDATE organizations SET settings = \\? WHERE id = \\?").
+			WithArgs(`{"open_registration":true}`, 9).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FROM organizations WHERE id = ?").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		assert.ErrorIs(t, repo.UpdateSettings(ctx, 9, models.OrganizationSettings{OpenRegistration: true}), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
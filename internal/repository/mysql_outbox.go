@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLOutboxRepository implements OutboxRepository on top of the notification_outbox table
+type MySQLOutboxRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLOutboxRepository creates a new MySQLOutboxRepository
+func NewMySQLOutboxRepository(db *sql.DB) *MySQLOutboxRepository {
+	return &MySQLOutboxRepository{
+		db: db,
+	}
+}
+
+// insertOutboxMessage queues a message as part of the caller's transaction
+func insertOutboxMessage(ctx context.Context, tx *sql.Tx, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO notification_outbox (event_type, payload) VALUES (?, ?)", eventType, data)
+	return err
+}
+
+// insertOutboxEvent queues an event in the events topic as part of the
+// caller's transaction, it is published once the transaction commits
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, envelope events.Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO notification_outbox (topic, event_type, payload) VALUES (?, ?, ?)",
+		models.OutboxEvents, envelope.Type, data)
+	return err
+}
+
+// taskPerformedPayload builds the outbox payload for a newly created task
+func taskPerformedPayload(task *models.Task) models.TaskPerformedPayload {
+	return models.TaskPerformedPayload{
+		TaskID:       task.ID,
+		TechnicianID: task.TechnicianID,
+		Summary:      task.Summary,
+		PerformedAt:  task.PerformedAt,
+	}
+}
+
+// Claim locks due messages of the topic, skipping rows claimed by other
+// dispatchers, and pushes their next attempt past the lease so they are not
+// picked up twice
+func (r *MySQLOutboxRepository) Claim(ctx context.Context, topic string, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, event_type, payload, attempts
+        FROM notification_outbox
+        WHERE topic = ? AND processed_at IS NULL AND next_attempt_at <= NOW()
+        ORDER BY id
+        LIMIT ?
+        FOR UPDATE SKIP LOCKED`, topic, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		var payload []byte
+		if err := rows.Scan(&message.ID, &message.EventType, &payload, &message.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		message.Payload = json.RawMessage(payload)
+		messages = append(messages, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE notification_outbox SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ?",
+			int(lease.Seconds()), message.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, tx.Commit()
+}
+
+// MarkProcessed records that a message was dispatched
+func (r *MySQLOutboxRepository) MarkProcessed(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE notification_outbox SET processed_at = NOW(), last_error = NULL WHERE id = ?", id)
+	return err
+}
+
+// MarkFailed records a failed attempt and schedules a retry
+func (r *MySQLOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE notification_outbox
+        SET attempts = attempts + 1, last_error = ?, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+        WHERE id = ?`, reason, int(retryAfter.Seconds()), id)
+	return err
+}
+
+// Deliveries returns the deliveries of a message recorded by earlier attempts
+func (r *MySQLOutboxRepository) Deliveries(ctx context.Context, id int64) ([]models.OutboxDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id, sink FROM notification_deliveries WHERE message_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.OutboxDelivery
+	for rows.Next() {
+		var delivery models.OutboxDelivery
+		if err := rows.Scan(&delivery.UserID, &delivery.Sink); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordDelivery records that a notification of a message was delivered
+func (r *MySQLOutboxRepository) RecordDelivery(ctx context.Context, id int64, delivery models.OutboxDelivery) error {
+	_, err := r.db.ExecContext(ctx, "INSERT IGNORE INTO notification_deliveries (message_id, user_id, sink) VALUES (?, ?, ?)",
+		id, delivery.UserID, delivery.Sink)
+	return err
+}
+
+// MarkDiscarded gives up on a message, keeping it for inspection
+func (r *MySQLOutboxRepository) MarkDiscarded(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE notification_outbox
+        SET attempts = attempts + 1, last_error = ?, processed_at = NOW()
+        WHERE id = ?`, reason, id)
+	return err
+}
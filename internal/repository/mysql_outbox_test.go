@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLOutboxRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLOutboxRepository(db)
+	ctx := context.Background()
+
+	t.Run("claim locks due messages of the topic and extends their lease", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, event_type, payload, attempts FROM notification_outbox\\s+WHERE topic = \\?.*FOR UPDATE SKIP LOCKED").
+			WithArgs(models.OutboxNotifications, 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "attempts"}).
+				AddRow(1, "task.performed", []byte(`{"task_id":"task1"}`), 0).
+				AddRow(2, "task.performed", []byte(`{"task_id":"task2"}`), 2))
+		mock.ExpectExec("UPDATE notification_outbox SET next_attempt_at").
+			WithArgs(60, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE notification_outbox SET next_attempt_at").
+			WithArgs(60, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		messages, err := repo.Claim(ctx, models.OutboxNotifications, 10, time.Minute)
+		assert.NoError(t, err)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, `{"task_id":"task1"}`, string(messages[0].Payload))
+		assert.Equal(t, 2, messages[1].Attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mark failed schedules a retry", func(t *testing.T) {
+		mock.ExpectExec("UPDATE notification_outbox SET attempts = attempts \\+ 1, last_error = \\?, next_attempt_at").
+			WithArgs("sink down", 30, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.MarkFailed(ctx, 1, "sink down", 30*time.Second))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mark processed", func(t *testing.T) {
+		mock.ExpectExec("UPDATE notification_outbox SET processed_at = NOW\\(\\)").
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.MarkProcessed(ctx, 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("deliveries are recorded per recipient and sink", func(t *testing.T) {
+		mock.ExpectExec("INSERT IGNORE INTO notification_deliveries \\(message_id, user_id, sink\\)").
+			WithArgs(int64(1), uint(2), "smtp").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT user_id, sink FROM notification_deliveries WHERE message_id = \\?").
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "sink"}).AddRow(2, "smtp"))
+
+		assert.NoError(t, repo.RecordDelivery(ctx, 1, models.OutboxDelivery{UserID: 2, Sink: "smtp"}))
+		deliveries, err := repo.Deliveries(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.OutboxDelivery{{UserID: 2, Sink: "smtp"}}, deliveries)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
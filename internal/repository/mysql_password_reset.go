@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLPasswordResetRepository implements PasswordResetRepository on top of a MySQL database
+type MySQLPasswordResetRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLPasswordResetRepository creates a new MySQLPasswordResetRepository
+func NewMySQLPasswordResetRepository(db *sql.DB) *MySQLPasswordResetRepository {
+	return &MySQLPasswordResetRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new reset token and sets its ID from the auto-increment column
+func (r *MySQLPasswordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	// created_at is set here rather than by the column default, so
+	// CountActiveSince compares it with times from the same clock
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		reset.UserID, reset.TokenHash, reset.ExpiresAt.UTC(), createdAt)
+	if err != nil {
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	reset.ID = id
+	reset.CreatedAt = createdAt
+	return nil
+}
+
+// Get returns the reset token with the given hash
+func (r *MySQLPasswordResetRepository) Get(ctx context.Context, hash string) (*models.PasswordReset, error) {
+	query := `
+        SELECT id, user_id,
+        DATE_FORMAT(expires_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(used_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM password_resets WHERE token_hash = ?`
+
+	reset := models.PasswordReset{TokenHash: hash}
+	var expiresAt, createdAt string
+	var usedAt sql.NullString
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(&reset.ID, &reset.UserID, &expiresAt, &usedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reset.ExpiresAt, err = time.Parse("2006-01-02 15:04:05", expiresAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if reset.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if reset.UsedAt, err = parseNullTime(usedAt); err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// Use marks the reset token as used if it is still unused, then every other
+// unused token of its user. The first update is a compare-and-set, so of two
+// concurrent resets with the same token only one succeeds.
+func (r *MySQLPasswordResetRepository) Use(ctx context.Context, reset *models.PasswordReset) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result, err := tx.ExecContext(ctx,
+		"UPDATE password_resets SET used_at = ? WHERE id = ? AND used_at IS NULL", now, reset.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, reset.UserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CountActiveSince counts the unused, unexpired reset tokens of a user created at or after since
+func (r *MySQLPasswordResetRepository) CountActiveSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND used_at IS NULL AND expires_at > ? AND created_at >= ?",
+		userID, time.Now().UTC(), since.UTC()).Scan(&count)
+	return count, err
+}
+
+// PurgeExpired deletes reset tokens that expired before the given time
+func (r *MySQLPasswordResetRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM password_resets WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLPasswordResetRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLPasswordResetRepository(db)
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO password_resets \\(user_id, token_hash, expires_at, created_at\\) VALUES \\(\\?, \\?, \\?, \\?\\)").
+			WithArgs(1, "hash-1", expiresAt, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+
+		reset := models.PasswordReset{UserID: 1, TokenHash: "hash-1", ExpiresAt: expiresAt}
+		assert.NoError(t, repo.Create(ctx, &reset))
+		assert.Equal(t, int64(4), reset.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create a duplicate", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO password_resets").
+			WithArgs(1, "hash-1", expiresAt, sqlmock.AnyArg()).
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+		reset := models.PasswordReset{UserID: 1, TokenHash: "hash-1", ExpiresAt: expiresAt}
+		assert.ErrorIs(t, repo.Create(ctx, &reset), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, user_id, .* FROM password_resets WHERE token_hash = ?").
+			WithArgs("hash-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at", "created_at"}).
+				AddRow(4, 1, "2025-01-01 09:00:00", "2025-01-01 08:30:00", "2025-01-01 08:00:00"))
+
+		reset, err := repo.Get(ctx, "hash-1")
+		assert.NoError(t, err)
+		assert.Equal(t, expiresAt, reset.ExpiresAt)
+		if assert.NotNil(t, reset.UsedAt) {
+			assert.Equal(t, expiresAt.Add(-30*time.Minute), *reset.UsedAt)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("use", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE password_resets SET used_at = \\? WHERE id = \\? AND used_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE password_resets SET used_at = \\? WHERE user_id = \\? AND used_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.Use(ctx, &models.PasswordReset{ID: 4, UserID: 1}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("use a used token", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE password_resets SET used_at").
+			WithArgs(sqlmock.AnyArg(), 4).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.Use(ctx, &models.PasswordReset{ID: 4, UserID: 1}), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("count active since", func(t *testing.T) {
+		since := expiresAt.Add(-time.Minute)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM password_resets WHERE user_id = \\? AND used_at IS NULL AND expires_at > \\? AND created_at >= \\?").
+			WithArgs(1, sqlmock.AnyArg(), since).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+		count, err := repo.CountActiveSince(ctx, 1, since)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("purge expired", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM password_resets WHERE expires_at < ?").
+			WithArgs(expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		purged, err := repo.PurgeExpired(ctx, expiresAt)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), purged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLPermissionRepository reads the role_permissions table
+type MySQLPermissionRepository struct {
+	db *sql.DB
+}
+
+func NewMySQLPermissionRepository(db *sql.DB) *MySQLPermissionRepository {
+	return &MySQLPermissionRepository{db: db}
+}
+
+// RolePermissions returns the permissions of every role that has any
+func (r *MySQLPermissionRepository) RolePermissions(ctx context.Context) (map[models.Role][]models.Permission, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT role, permission FROM role_permissions ORDER BY role, permission")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make(map[models.Role][]models.Permission)
+	for rows.Next() {
+		// Scanned as strings so a role unknown to this version does not fail the load
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		grants[models.Role(role)] = append(grants[models.Role(role)], models.Permission(permission))
+	}
+	return grants, rows.Err()
+}
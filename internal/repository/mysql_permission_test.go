@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLPermissionRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLPermissionRepository(db)
+
+	t.Run("grants are grouped by role", func(t *testing.T) {
+		mock.ExpectQuery("SELECT role, permission FROM role_permissions").
+			WillReturnRows(sqlmock.NewRows([]string{"role", "permission"}).
+				AddRow("manager", "task:delete:team").
+				AddRow("manager", "task:read:any").
+				AddRow("technician", "task:create"))
+
+		grants, err := repo.RolePermissions(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, map[models.Role][]models.Permission{
+			models.RoleManager:    {models.PermissionTaskDeleteTeam, models.PermissionTaskReadAny},
+			models.RoleTechnician: {models.PermissionTaskCreate},
+		}, grants)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		mock.ExpectQuery("SELECT role, permission FROM role_permissions").
+			WillReturnError(errors.New("connection lost"))
+
+		_, err := repo.RolePermissions(context.Background())
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLScheduleRepository implements ScheduleRepository on top of a MySQL database
+type MySQLScheduleRepository struct {
+	db *sql.DB
+	// keyring encrypts summaries at rest, they are stored in plaintext without it
+	keyring *encryption.Keyring
+}
+
+// NewMySQLScheduleRepository creates a new MySQLScheduleRepository. Summaries
+// are encrypted with keys from the keyring of the task summaries, which may
+// be nil to store them in plaintext.
+func NewMySQLScheduleRepository(db *sql.DB, keyring *encryption.Keyring) *MySQLScheduleRepository {
+	return &MySQLScheduleRepository{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+const selectSchedule = `
+        SELECT id, summary, summary_key_id, summary_wrapped_key, rule, timezone, technician_id, asset_id,
+        DATE_FORMAT(starts_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(ends_at, '%Y-%m-%d %H:%i:%s'),
+        active,
+        DATE_FORMAT(materialized_until, '%Y-%m-%d %H:%i:%s'),
+        created_by,
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(updated_at, '%Y-%m-%d %H:%i:%s')
+        FROM maintenance_schedules`
+
+// Create inserts a new schedule and sets its ID from the auto-increment
+// column. An encrypted summary is bound to that ID, so it is stored by a
+// second statement in the same transaction.
+func (r *MySQLScheduleRepository) Create(ctx context.Context, schedule *models.Schedule) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	summary := schedule.Summary
+	if r.keyring != nil {
+		summary = ""
+	}
+	query := `
+        INSERT INTO maintenance_schedules
+        (summary, rule, timezone, technician_id, asset_id, starts_at, ends_at, active, materialized_until, created_by)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	result, err := tx.ExecContext(ctx, query, summary, schedule.Rule, schedule.Timezone,
+		schedule.TechnicianID, nullInt64(schedule.AssetID), schedule.StartsAt.UTC(), nullTime(schedule.EndsAt),
+		schedule.Active, schedule.MaterializedUntil.UTC(), schedule.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if r.keyring != nil {
+		stored, err := r.sealSummary(id, schedule.Summary)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE maintenance_schedules SET summary = ?, summary_key_id = ?, summary_wrapped_key = ? WHERE id = ?",
+			stored.Value, stored.KeyID, stored.WrappedKey, id)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	schedule.ID = id
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	return nil
+}
+
+// Get returns a schedule
+func (r *MySQLScheduleRepository) Get(ctx context.Context, id int64) (*models.Schedule, error) {
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	schedule, err := r.scanSchedule(r.db.QueryRowContext(ctx, selectSchedule+" WHERE id = ?"+scope, append([]interface{}{id}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return schedule, err
+}
+
+// List returns every schedule ordered by ID
+func (r *MySQLScheduleRepository) List(ctx context.Context) ([]models.Schedule, error) {
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	return r.query(ctx, selectSchedule+" WHERE TRUE"+scope+" ORDER BY id", args...)
+}
+
+// ListActive returns the active schedules ordered by ID
+func (r *MySQLScheduleRepository) ListActive(ctx context.Context) ([]models.Schedule, error) {
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	return r.query(ctx, selectSchedule+" WHERE active = TRUE"+scope+" ORDER BY id", args...)
+}
+
+func (r *MySQLScheduleRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.Schedule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.Schedule{}
+	for rows.Next() {
+		schedule, err := r.scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// Update changes the definition of a schedule and moves MaterializedUntil forward if needed
+func (r *MySQLScheduleRepository) Update(ctx context.Context, schedule *models.Schedule) error {
+	stored, err := r.sealSummary(schedule.ID, schedule.Summary)
+	if err != nil {
+		return err
+	}
+
+	scope, scopeArgs := technicianInOrganization(ctx, "technician_id")
+	query := `
+        UPDATE maintenance_schedules
+        SET summary = ?, summary_key_id = ?, summary_wrapped_key = ?, rule = ?, timezone = ?, technician_id = ?, asset_id = ?, starts_at = ?, ends_at = ?,
+        active = ?, materialized_until = GREATEST(materialized_until, ?)
+        WHERE id = ?` + scope
+	args := append([]interface{}{stored.Value, stored.KeyID, stored.WrappedKey, schedule.Rule, schedule.Timezone,
+		schedule.TechnicianID, nullInt64(schedule.AssetID), schedule.StartsAt.UTC(), nullTime(schedule.EndsAt),
+		schedule.Active, schedule.MaterializedUntil.UTC(), schedule.ID}, scopeArgs...)
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Nothing changed or nothing matched
+		var exists bool
+		err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM maintenance_schedules WHERE id = ?"+scope+")",
+			append([]interface{}{schedule.ID}, scopeArgs...)...).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// Advance moves MaterializedUntil forward if no other scheduler did so first
+func (r *MySQLScheduleRepository) Advance(ctx context.Context, id int64, from, to time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE maintenance_schedules SET materialized_until = ? WHERE id = ? AND materialized_until = ?",
+		to.UTC(), id, from.UTC())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Delete removes a schedule
+func (r *MySQLScheduleRepository) Delete(ctx context.Context, id int64) error {
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	result, err := r.db.ExecContext(ctx, "DELETE FROM maintenance_schedules WHERE id = ?"+scope, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MySQLScheduleRepository) scanSchedule(row rowScanner) (*models.Schedule, error) {
+	var schedule models.Schedule
+	var stored storedSummary
+	var assetID sql.NullInt64
+	var startsAt, materializedUntil, createdAt, updatedAt string
+	var endsAt sql.NullString
+	err := row.Scan(&schedule.ID, &stored.Value, &stored.KeyID, &stored.WrappedKey, &schedule.Rule, &schedule.Timezone, &schedule.TechnicianID,
+		&assetID, &startsAt, &endsAt, &schedule.Active, &materializedUntil, &schedule.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	schedule.AssetID = int64Ptr(assetID)
+	if schedule.Summary, err = r.openSummary(schedule.ID, stored); err != nil {
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		value string
+		dest  *time.Time
+	}{
+		{startsAt, &schedule.StartsAt},
+		{materializedUntil, &schedule.MaterializedUntil},
+		{createdAt, &schedule.CreatedAt},
+		{updatedAt, &schedule.UpdatedAt},
+	} {
+		if *field.dest, err = time.Parse("2006-01-02 15:04:05", field.value); err != nil {
+			return nil, ErrInvalidDate
+		}
+	}
+	if endsAt.Valid {
+		t, err := time.Parse("2006-01-02 15:04:05", endsAt.String)
+		if err != nil {
+			return nil, ErrInvalidDate
+		}
+		schedule.EndsAt = &t
+	}
+	return &schedule, nil
+}
+
+// summaryAAD binds an encrypted summary to its schedule. The prefix keeps it
+// apart from the numeric IDs other sealed values are bound to.
+func summaryAAD(id int64) []byte {
+	return []byte("schedule:" + strconv.FormatInt(id, 10))
+}
+
+// sealSummary prepares a summary for storage, encrypting it when a keyring is configured
+func (r *MySQLScheduleRepository) sealSummary(id int64, summary string) (storedSummary, error) {
+	return sealStoredSummary(r.keyring, summary, summaryAAD(id))
+}
+
+// openSummary returns the plaintext of a stored summary
+func (r *MySQLScheduleRepository) openSummary(id int64, stored storedSummary) (string, error) {
+	if !stored.KeyID.Valid {
+		return stored.Value, nil
+	}
+	if r.keyring == nil {
+		return "", fmt.Errorf("%w: schedule %d is encrypted with key %s but no keyring is configured", ErrDecrypt, id, stored.KeyID.String)
+	}
+
+	sealed, err := stored.sealed()
+	if err != nil {
+		return "", fmt.Errorf("%w: schedule %d: %v", ErrDecrypt, id, err)
+	}
+	plaintext, err := r.keyring.Open(*sealed, summaryAAD(id))
+	if err != nil {
+		return "", fmt.Errorf("%w: schedule %d: %v", ErrDecrypt, id, err)
+	}
+	return string(plaintext), nil
+}
+
+// RotateSummaryKeys re-encrypts under the primary key every schedule summary
+// that is stored in plaintext or under an older key, like the method of the
+// same name does for task summaries. It returns the total number of rows rotated.
+func (r *MySQLScheduleRepository) RotateSummaryKeys(ctx context.Context, batchSize int, onBatch func(rotated int)) (int, error) {
+	if r.keyring == nil {
+		return 0, fmt.Errorf("summary encryption is not configured")
+	}
+
+	total := 0
+	var lastID int64
+	for {
+		rotated, last, err := r.rotateSummaryBatch(ctx, lastID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if rotated == 0 {
+			return total, nil
+		}
+
+		total += rotated
+		lastID = last
+		if onBatch != nil {
+			onBatch(rotated)
+		}
+		if rotated < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// rotateSummaryBatch re-encrypts the next batch of stale summaries after afterID
+func (r *MySQLScheduleRepository) rotateSummaryBatch(ctx context.Context, afterID int64, batchSize int) (int, int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, summary, summary_key_id, summary_wrapped_key
+        FROM maintenance_schedules
+        WHERE id > ? AND (summary_key_id IS NULL OR summary_key_id <> ?)
+        ORDER BY id
+        LIMIT ?
+        FOR UPDATE`, afterID, r.keyring.PrimaryKeyID(), batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type staleRow struct {
+		id     int64
+		stored storedSummary
+	}
+	var batch []staleRow
+	for rows.Next() {
+		var row staleRow
+		if err := rows.Scan(&row.id, &row.stored.Value, &row.stored.KeyID, &row.stored.WrappedKey); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, row := range batch {
+		summary, err := r.openSummary(row.id, row.stored)
+		if err != nil {
+			return 0, 0, err
+		}
+		stored, err := r.sealSummary(row.id, summary)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE maintenance_schedules SET summary = ?, summary_key_id = ?, summary_wrapped_key = ? WHERE id = ?",
+			stored.Value, stored.KeyID, stored.WrappedKey, row.id)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if len(batch) == 0 {
+		return 0, 0, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return len(batch), batch[len(batch)-1].id, nil
+}
+
+// nullTime maps a nil pointer to SQL NULL
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLScheduleRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLScheduleRepository(db, nil)
+	ctx := context.Background()
+	startsAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	materializedUntil := time.Date(2025, 1, 8, 8, 0, 0, 0, time.UTC)
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO maintenance_schedules").
+			WithArgs("Check the boiler", "0 8 * * *", "UTC", int64(7), nil, startsAt, nil, true, startsAt, int64(2)).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectCommit()
+
+		schedule := models.Schedule{Summary: "Check the boiler", Rule: "0 8 * * *", Timezone: "UTC", TechnicianID: 7,
+			StartsAt: startsAt, Active: true, MaterializedUntil: startsAt, CreatedBy: 2}
+		assert.NoError(t, repo.Create(ctx, &schedule))
+		assert.Equal(t, int64(3), schedule.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list active", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key, rule.*FROM maintenance_schedules WHERE active = TRUE ORDER BY id").
+			WillReturnRows(sqlmock.NewRows(scheduleColumns).
+				AddRow(3, "Check the boiler", nil, nil, "0 8 * * *", "UTC", 7, 4, "2025-01-01 00:00:00", nil, true,
+					"2025-01-08 08:00:00", 2, "2024-12-31 10:00:00", "2024-12-31 10:00:00"))
+
+		schedules, err := repo.ListActive(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, schedules, 1) {
+			assert.Equal(t, "Check the boiler", schedules[0].Summary)
+			assert.Equal(t, int64(4), *schedules[0].AssetID)
+			assert.Nil(t, schedules[0].EndsAt)
+			assert.Equal(t, materializedUntil, schedules[0].MaterializedUntil)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("advance is a compare and set", func(t *testing.T) {
+		next := materializedUntil.Add(24 * time.Hour)
+		mock.ExpectExec("UPDATE maintenance_schedules SET materialized_until = \\? WHERE id = \\? AND materialized_until = \\?").
+			WithArgs(next, int64(3), materializedUntil).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE maintenance_schedules SET materialized_until").
+			WithArgs(next, int64(3), materializedUntil).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.NoError(t, repo.Advance(ctx, 3, materializedUntil, next))
+		assert.ErrorIs(t, repo.Advance(ctx, 3, materializedUntil, next), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+var scheduleColumns = []string{"id", "summary", "summary_key_id", "summary_wrapped_key", "rule", "timezone",
+	"technician_id", "asset_id", "starts_at", "ends_at", "active", "materialized_until", "created_by", "created_at", "updated_at"}
+
+func TestMySQLScheduleRepositorySummaryEncryption(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	startsAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduleRow := func(id int64, summary, keyID, wrappedKey interface{}) *sqlmock.Rows {
+		return sqlmock.NewRows(scheduleColumns).
+			AddRow(id, summary, keyID, wrappedKey, "0 8 * * *", "UTC", 7, nil, "2025-01-01 00:00:00", nil, true,
+				"2025-01-08 08:00:00", 2, "2024-12-31 10:00:00", "2024-12-31 10:00:00")
+	}
+
+	t.Run("summaries are sealed with the ID of their schedule", func(t *testing.T) {
+		repo := NewMySQLScheduleRepository(db, testKeyring(t, "new"))
+		summary, keyID, wrappedKey := &capture{}, &capture{}, &capture{}
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO maintenance_schedules").
+			WithArgs("", "0 8 * * *", "UTC", int64(7), nil, startsAt, nil, true, startsAt, int64(2)).
+			WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectExec("UPDATE maintenance_schedules SET summary = \\?, summary_key_id = \\?, summary_wrapped_key = \\? WHERE id = \\?").
+			WithArgs(summary, keyID, wrappedKey, int64(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		schedule := models.Schedule{Summary: "Check the boiler", Rule: "0 8 * * *", Timezone: "UTC", TechnicianID: 7,
+			StartsAt: startsAt, Active: true, MaterializedUntil: startsAt, CreatedBy: 2}
+		assert.NoError(t, repo.Create(ctx, &schedule))
+		assert.NotContains(t, summary.value, "boiler")
+		assert.Equal(t, "new", keyID.value)
+
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key, .* FROM maintenance_schedules WHERE id = \\?").
+			WithArgs(int64(3)).
+			WillReturnRows(scheduleRow(3, summary.value, keyID.value, wrappedKey.value))
+		stored, err := repo.Get(ctx, 3)
+		assert.NoError(t, err)
+		if assert.NotNil(t, stored) {
+			assert.Equal(t, "Check the boiler", stored.Summary)
+		}
+
+		// A summary copied onto another schedule does not open
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key, .* FROM maintenance_schedules WHERE id = \\?").
+			WithArgs(int64(4)).
+			WillReturnRows(scheduleRow(4, summary.value, keyID.value, wrappedKey.value))
+		_, err = repo.Get(ctx, 4)
+		assert.ErrorIs(t, err, ErrDecrypt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update seals the new summary", func(t *testing.T) {
+		repo := NewMySQLScheduleRepository(db, testKeyring(t, "new"))
+		summary := &capture{}
+		mock.ExpectExec("UPDATE maintenance_schedules\\s+SET summary = \\?, summary_key_id = \\?, summary_wrapped_key = \\?, rule = \\?").
+			WithArgs(summary, "new", sqlmock.AnyArg(), "0 8 * * *", "UTC", int64(7), nil, startsAt, nil, true, startsAt, int64(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		schedule := models.Schedule{ID: 3, Summary: "Check the boiler", Rule: "0 8 * * *", Timezone: "UTC", TechnicianID: 7,
+			StartsAt: startsAt, Active: true, MaterializedUntil: startsAt}
+		assert.NoError(t, repo.Update(ctx, &schedule))
+		assert.NotContains(t, summary.value, "boiler")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rotate keys", func(t *testing.T) {
+		stale, err := NewMySQLScheduleRepository(db, testKeyring(t, "old")).sealSummary(5, "Grease the hinges")
+		assert.NoError(t, err)
+
+		rotatedColumns := []string{"id", "summary", "summary_key_id", "summary_wrapped_key"}
+		summary, keyID, wrappedKey := &capture{}, &capture{}, &capture{}
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key\\s+FROM maintenance_schedules.*FOR UPDATE").
+			WithArgs(int64(0), "new", 10).
+			WillReturnRows(sqlmock.NewRows(rotatedColumns).
+				AddRow(4, "Check the boiler", nil, nil).
+				AddRow(5, stale.Value, stale.KeyID.String, stale.WrappedKey.String))
+		mock.ExpectExec("UPDATE maintenance_schedules SET summary = \\?, summary_key_id = \\?, summary_wrapped_key = \\? WHERE id = \\?").
+			WithArgs(sqlmock.AnyArg(), "new", sqlmock.AnyArg(), int64(4)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE maintenance_schedules SET summary = \\?, summary_key_id = \\?, summary_wrapped_key = \\? WHERE id = \\?").
+			WithArgs(summary, keyID, wrappedKey, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rotated, err := NewMySQLScheduleRepository(db, testKeyring(t, "new")).RotateSummaryKeys(ctx, 10, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rotated)
+
+		// The rotated summary opens without the old key
+		newOnly, err := encryption.NewKeyring("new", map[string][]byte{"new": bytes.Repeat([]byte{2}, encryption.KeySize)})
+		assert.NoError(t, err)
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key, .* FROM maintenance_schedules WHERE id = \\?").
+			WithArgs(int64(5)).
+			WillReturnRows(scheduleRow(5, summary.value, keyID.value, wrappedKey.value))
+		schedule, err := NewMySQLScheduleRepository(db, newOnly).Get(ctx, 5)
+		assert.NoError(t, err)
+		if assert.NotNil(t, schedule) {
+			assert.Equal(t, "Grease the hinges", schedule.Summary)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// storedSummary is a task summary as it is kept in the tasks table. KeyID is
+// NULL for plaintext summaries, otherwise Value and WrappedKey hold the base64
+// encoded ciphertext and data key of an encryption.Sealed value.
+type storedSummary struct {
+	Value      string
+	KeyID      sql.NullString
+	WrappedKey sql.NullString
+}
+
+// sealSummary prepares a summary for storage, encrypting it when a keyring is configured
+func (r *MySQLTaskRepository) sealSummary(taskID, summary string) (storedSummary, error) {
+	return sealStoredSummary(r.keyring, summary, []byte(taskID))
+}
+
+// sealStoredSummary encrypts a summary bound to aad, it is kept in plaintext
+// when keyring is nil
+func sealStoredSummary(keyring *encryption.Keyring, summary string, aad []byte) (storedSummary, error) {
+	if keyring == nil {
+		return storedSummary{Value: summary}, nil
+	}
+
+	sealed, err := keyring.Seal([]byte(summary), aad)
+	if err != nil {
+		return storedSummary{}, err
+	}
+	return storedSummary{
+		Value:      base64.StdEncoding.EncodeToString(sealed.Ciphertext),
+		KeyID:      sql.NullString{String: sealed.KeyID, Valid: true},
+		WrappedKey: sql.NullString{String: base64.StdEncoding.EncodeToString(sealed.WrappedKey), Valid: true},
+	}, nil
+}
+
+// sealed decodes an encrypted stored summary, it returns nil for plaintext
+func (s storedSummary) sealed() (*encryption.Sealed, error) {
+	if !s.KeyID.Valid {
+		return nil, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(s.Value)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(s.WrappedKey.String)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption.Sealed{
+		KeyID:      s.KeyID.String,
+		WrappedKey: wrappedKey,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// performedPayload builds the outbox payload of a completed task. The outbox
+// is stored too, so an encrypted summary is carried sealed rather than in plaintext.
+func performedPayload(task *models.Task, stored storedSummary) (models.TaskPerformedPayload, error) {
+	payload := taskPerformedPayload(task)
+	sealed, err := stored.sealed()
+	if err != nil {
+		return payload, err
+	}
+	if sealed != nil {
+		payload.Summary = ""
+		payload.EncryptedSummary = sealed
+	}
+	return payload, nil
+}
+
+// taskEventData builds the payload of a task event. The event waits in the
+// outbox, so an encrypted summary is carried sealed rather than in plaintext.
+func taskEventData(task *models.Task, stored storedSummary) (events.TaskData, error) {
+	data := events.NewTaskData(*task)
+	sealed, err := stored.sealed()
+	if err != nil {
+		return data, err
+	}
+	if sealed != nil {
+		data.Summary = ""
+		data.EncryptedSummary = sealed
+	}
+	return data, nil
+}
+
+// openSummary returns the plaintext of a stored summary
+func (r *MySQLTaskRepository) openSummary(taskID string, stored storedSummary) (string, error) {
+	if !stored.KeyID.Valid {
+		return stored.Value, nil
+	}
+	if r.keyring == nil {
+		return "", fmt.Errorf("%w: task %s is encrypted with key %s but no keyring is configured", ErrDecrypt, taskID, stored.KeyID.String)
+	}
+
+	sealed, err := stored.sealed()
+	if err != nil {
+		return "", fmt.Errorf("%w: task %s: %v", ErrDecrypt, taskID, err)
+	}
+	plaintext, err := r.keyring.Open(*sealed, []byte(taskID))
+	if err != nil {
+		return "", fmt.Errorf("%w: task %s: %v", ErrDecrypt, taskID, err)
+	}
+	return string(plaintext), nil
+}
+
+// RotateSummaryKeys re-encrypts under the primary key every summary that is
+// stored in plaintext or under an older key. Rows are processed in batches of
+// batchSize, each in its own transaction, and onBatch is called with the size
+// of every committed batch. It returns the total number of rows rotated.
+func (r *MySQLTaskRepository) RotateSummaryKeys(ctx context.Context, batchSize int, onBatch func(rotated int)) (int, error) {
+	if r.keyring == nil {
+		return 0, fmt.Errorf("summary encryption is not configured")
+	}
+
+	total := 0
+	lastID := ""
+	for {
+		rotated, last, err := r.rotateSummaryBatch(ctx, lastID, batchSize)
+		if err != nil {
+			return total, err
+		}
+		if rotated == 0 {
+			return total, nil
+		}
+
+		total += rotated
+		lastID = last
+		if onBatch != nil {
+			onBatch(rotated)
+		}
+		if rotated < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// rotateSummaryBatch re-encrypts the next batch of stale summaries after afterID
+func (r *MySQLTaskRepository) rotateSummaryBatch(ctx context.Context, afterID string, batchSize int) (int, string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, summary, summary_key_id, summary_wrapped_key
+        FROM tasks
+        WHERE id > ? AND (summary_key_id IS NULL OR summary_key_id <> ?)
+        ORDER BY id
+        LIMIT ?
+        FOR UPDATE`, afterID, r.keyring.PrimaryKeyID(), batchSize)
+	if err != nil {
+		return 0, "", err
+	}
+
+	type staleRow struct {
+		id     string
+		stored storedSummary
+	}
+	var batch []staleRow
+	for rows.Next() {
+		var row staleRow
+		var summary sql.NullString
+		if err := rows.Scan(&row.id, &summary, &row.stored.KeyID, &row.stored.WrappedKey); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		row.stored.Value = summary.String
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	for _, row := range batch {
+		summary, err := r.openSummary(row.id, row.stored)
+		if err != nil {
+			return 0, "", err
+		}
+		stored, err := r.sealSummary(row.id, summary)
+		if err != nil {
+			return 0, "", err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE tasks SET summary = ?, summary_key_id = ?, summary_wrapped_key = ? WHERE id = ?",
+			stored.Value, stored.KeyID, stored.WrappedKey, row.id)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	if len(batch) == 0 {
+		return 0, "", nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return len(batch), batch[len(batch)-1].id, nil
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// capture matches any argument and remembers its value
+type capture struct {
+	value driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func testKeyring(t *testing.T, primary string) *encryption.Keyring {
+	keyring, err := encryption.NewKeyring(primary, map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, encryption.KeySize),
+		"new": bytes.Repeat([]byte{2}, encryption.KeySize),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+func TestMySQLTaskRepositorySummaryEncryption(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLTaskRepository(db, WithSummaryEncryption(testKeyring(t, "new")))
+	ctx := context.Background()
+	performedAt := time.Date(2024, 12, 29, 10, 30, 0, 0, time.UTC)
+	listColumns := []string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}
+
+	var summary, keyID, wrappedKey, payload, event capture
+
+	t.Run("create stores the summary, outbox payload and event encrypted", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO tasks").
+			WithArgs("task1", int64(7), nil, &summary, &keyID, &wrappedKey, performedAt, models.StatusCompleted).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WithArgs("task1", nil, models.StatusCompleted, int64(7), nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventTaskPerformed, &payload).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT u.organization_id FROM tasks t").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO notification_outbox \\(topic, event_type, payload\\)").
+			WithArgs(models.OutboxEvents, "task.created", &event).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		err := repo.Create(ctx, &models.Task{
+			ID: "task1", TechnicianID: 7, Summary: "Fixed the boiler at 12 Main St", PerformedAt: performedAt,
+		}, 7)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		assert.Equal(t, "new", keyID.value)
+		assert.NotContains(t, summary.value, "Main St")
+		assert.NotContains(t, string(payload.value.([]byte)), "Main St")
+
+		var decoded models.TaskPerformedPayload
+		assert.NoError(t, json.Unmarshal(payload.value.([]byte), &decoded))
+		assert.Empty(t, decoded.Summary)
+		if assert.NotNil(t, decoded.EncryptedSummary) {
+			plaintext, err := testKeyring(t, "new").Open(*decoded.EncryptedSummary, []byte("task1"))
+			assert.NoError(t, err)
+			assert.Equal(t, "Fixed the boiler at 12 Main St", string(plaintext))
+		}
+
+		assert.NotContains(t, string(event.value.([]byte)), "Main St")
+		assert.Contains(t, string(event.value.([]byte)), `"encrypted_summary"`)
+	})
+
+	t.Run("list decrypts encrypted and passes plaintext rows through", func(t *testing.T) {
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*").
+			WillReturnRows(sqlmock.NewRows(listColumns).
+				AddRow("task1", summary.value, "2024-12-29 10:30:00", 7, nil, "tech", keyID.value, wrappedKey.value, "completed").
+				AddRow("task2", "Legacy plaintext", "2024-12-28 10:30:00", 7, nil, "tech", nil, nil, "completed"))
+
+		page, err := repo.List(ctx, TaskFilter{})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 2) {
+			assert.Equal(t, "Fixed the boiler at 12 Main St", page.Tasks[0].Summary)
+			assert.Equal(t, "Legacy plaintext", page.Tasks[1].Summary)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a summary copied to another row does not decrypt", func(t *testing.T) {
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*").
+			WillReturnRows(sqlmock.NewRows(listColumns).
+				AddRow("task2", summary.value, "2024-12-29 10:30:00", 7, nil, "tech", keyID.value, wrappedKey.value, "completed"))
+
+		_, err := repo.List(ctx, TaskFilter{})
+		assert.ErrorIs(t, err, ErrDecrypt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("text search runs on decrypted summaries", func(t *testing.T) {
+		// The query must not search the ciphertext, and keeps fetching until the page is full
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*ORDER BY t.performed_at DESC, t.id DESC\\s+LIMIT \\?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(listColumns).
+				AddRow("task3", "No match", "2024-12-30 10:30:00", 7, nil, "tech", nil, nil, "completed").
+				AddRow("task2", "Legacy boiler", "2024-12-29 10:30:00", 7, nil, "tech", nil, nil, "completed"))
+		mock.ExpectQuery("SELECT t.id, t.summary, DATE_FORMAT.*t.performed_at < \\?").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "task2", 2).
+			WillReturnRows(sqlmock.NewRows(listColumns).
+				AddRow("task1", summary.value, "2024-12-29 10:30:00", 7, nil, "tech", keyID.value, wrappedKey.value, "completed").
+				AddRow("task0", "Another boiler", "2024-12-28 10:30:00", 7, nil, "tech", nil, nil, "completed"))
+
+		page, err := repo.List(ctx, TaskFilter{Query: "BOILER", Limit: 1})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "task2", page.Tasks[0].ID)
+		}
+		assert.NotEmpty(t, page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rotation re-encrypts stale rows in batches", func(t *testing.T) {
+		oldRepo := NewMySQLTaskRepository(db, WithSummaryEncryption(testKeyring(t, "old")))
+		stale, err := oldRepo.sealSummary("task1", "Sealed with the old key")
+		assert.NoError(t, err)
+
+		rotatedColumns := []string{"id", "summary", "summary_key_id", "summary_wrapped_key"}
+		var rotatedKeyID capture
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key\\s+FROM tasks.*FOR UPDATE").
+			WithArgs("", "new", 2).
+			WillReturnRows(sqlmock.NewRows(rotatedColumns).
+				AddRow("task1", stale.Value, stale.KeyID.String, stale.WrappedKey.String).
+				AddRow("task2", "Legacy plaintext", nil, nil))
+		mock.ExpectExec("UPDATE tasks SET summary = \\?, summary_key_id = \\?, summary_wrapped_key = \\? WHERE id = \\?").
+			WithArgs(sqlmock.AnyArg(), &rotatedKeyID, sqlmock.AnyArg(), "task1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE tasks SET summary").
+			WithArgs(sqlmock.AnyArg(), "new", sqlmock.AnyArg(), "task2").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, summary, summary_key_id, summary_wrapped_key").
+			WithArgs("task2", "new", 2).
+			WillReturnRows(sqlmock.NewRows(rotatedColumns))
+		mock.ExpectRollback()
+
+		var batches []int
+		rotated, err := repo.RotateSummaryKeys(ctx, 2, func(n int) { batches = append(batches, n) })
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rotated)
+		assert.Equal(t, []int{2}, batches)
+		assert.Equal(t, "new", rotatedKeyID.value)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rotation needs a keyring", func(t *testing.T) {
+		_, err := NewMySQLTaskRepository(db).RotateSummaryKeys(ctx, 10, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// MySQLTaskRepository implements TaskRepository on top of a MySQL database
+type MySQLTaskRepository struct {
+	db      *sql.DB
+	keyring *encryption.Keyring
+}
+
+// MySQLTaskOption configures optional MySQLTaskRepository behaviour
+type MySQLTaskOption func(*MySQLTaskRepository)
+
+// WithSummaryEncryption encrypts task summaries at rest with keys from the keyring.
+// Summaries stored before encryption was enabled are still read as plaintext.
+func WithSummaryEncryption(keyring *encryption.Keyring) MySQLTaskOption {
+	return func(r *MySQLTaskRepository) {
+		r.keyring = keyring
+	}
+}
+
+// NewMySQLTaskRepository creates a new MySQLTaskRepository
+func NewMySQLTaskRepository(db *sql.DB, opts ...MySQLTaskOption) *MySQLTaskRepository {
+	r := &MySQLTaskRepository{
+		db: db,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Create inserts a new task, its initial transition, its task.created event
+// and, for completed tasks, its task performed outbox message in one transaction
+func (r *MySQLTaskRepository) Create(ctx context.Context, task *models.Task, actorID int64) error {
+	if task.Status == "" {
+		task.Status = models.StatusCompleted
+	}
+
+	summary, err := r.sealSummary(task.ID, task.Summary)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO tasks (id, technician_id, asset_id, summary, summary_key_id, summary_wrapped_key, performed_at, status)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err = tx.ExecContext(ctx, query, task.ID, task.TechnicianID, nullInt64(task.AssetID), summary.Value, summary.KeyID, summary.WrappedKey, task.PerformedAt, task.Status)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	initial := models.TaskTransition{TaskID: task.ID, To: task.Status, ActorID: task.TechnicianID}
+	if err := insertTransition(ctx, tx, &initial); err != nil {
+		return err
+	}
+
+	if task.Status == models.StatusCompleted {
+		payload, err := performedPayload(task, summary)
+		if err != nil {
+			return err
+		}
+		if err := insertOutboxMessage(ctx, tx, models.EventTaskPerformed, payload); err != nil {
+			return err
+		}
+	}
+
+	organizationID, err := taskOrganization(ctx, tx, task.ID)
+	if err != nil {
+		return err
+	}
+	data, err := taskEventData(task, summary)
+	if err != nil {
+		return err
+	}
+	if err := insertOutboxEvent(ctx, tx, events.NewTaskCreated(data, organizationID, actorID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get returns a task with its summary decrypted
+func (r *MySQLTaskRepository) Get(ctx context.Context, id string) (*models.Task, error) {
+	task, summary, err := getStoredTask(ctx, r.db, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	task.Summary, err = r.openSummary(task.ID, summary)
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getStoredTask reads a task without decrypting its summary, optionally locking the row
+func getStoredTask(ctx context.Context, db queryRower, id string, forUpdate bool) (*models.Task, storedSummary, error) {
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	query := `
+        SELECT technician_id, asset_id, summary, summary_key_id, summary_wrapped_key,
+        DATE_FORMAT(performed_at, '%Y-%m-%d %H:%i:%s'), status
+        FROM tasks WHERE id = ?` + scope
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	task := models.Task{ID: id}
+	var summary storedSummary
+	var value sql.NullString
+	var assetID sql.NullInt64
+	var performedAt string
+	err := db.QueryRowContext(ctx, query, append([]interface{}{id}, args...)...).Scan(
+		&task.TechnicianID, &assetID, &value, &summary.KeyID, &summary.WrappedKey, &performedAt, &task.Status,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, summary, ErrNotFound
+	} else if err != nil {
+		return nil, summary, err
+	}
+	summary.Value = value.String
+	task.AssetID = int64Ptr(assetID)
+
+	task.PerformedAt, err = time.Parse("2006-01-02 15:04:05", performedAt)
+	if err != nil {
+		return nil, summary, ErrInvalidDate
+	}
+	return &task, summary, nil
+}
+
+// Owner returns the technician ID of a task
+func (r *MySQLTaskRepository) Owner(ctx context.Context, id string) (int64, error) {
+	var technicianID int64
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	err := r.db.QueryRowContext(ctx, "SELECT technician_id FROM tasks WHERE id = ?"+scope, append([]interface{}{id}, args...)...).Scan(&technicianID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return technicianID, err
+}
+
+// Update changes a task owned by task.TechnicianID and queues its
+// task.updated event in one transaction
+func (r *MySQLTaskRepository) Update(ctx context.Context, task *models.Task, actorID int64) error {
+	summary, err := r.sealSummary(task.ID, task.Summary)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	query := `
+        UPDATE tasks SET summary = ?, summary_key_id = ?, summary_wrapped_key = ?, performed_at = ?
+		WHERE
+		id = ? AND technician_id = ?` + scope
+	args = append([]interface{}{summary.Value, summary.KeyID, summary.WrappedKey, task.PerformedAt, task.ID, task.TechnicianID}, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	// The event describes the stored task, the update only sets the summary
+	// and the performed at time
+	stored, _, err := getStoredTask(ctx, tx, task.ID, true)
+	if err != nil {
+		return err
+	}
+	stored.Summary = task.Summary
+	organizationID, err := taskOrganization(ctx, tx, task.ID)
+	if err != nil {
+		return err
+	}
+	data, err := taskEventData(stored, summary)
+	if err != nil {
+		return err
+	}
+	if err := insertOutboxEvent(ctx, tx, events.NewTaskUpdated(data, organizationID, actorID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List returns one page of the tasks matching the filter joined with the technician username
+func (r *MySQLTaskRepository) List(ctx context.Context, filter TaskFilter) (TaskPage, error) {
+	order := filter.sort()
+	limit := filter.limit()
+	cursor, err := decodeTaskCursor(filter.Cursor, order)
+	if err != nil {
+		return TaskPage{}, err
+	}
+	filter.organizationID, _ = tenant.Organization(ctx)
+
+	// Encrypted summaries cannot be searched by the database, so the text
+	// search then runs on the decrypted rows, fetching until the page is full
+	searchInSQL := r.keyring == nil
+	var tasks []models.TaskWithTechnician
+	for {
+		query, args := buildTaskListQuery(filter, cursor, searchInSQL, limit+1)
+		batch, err := r.queryTasks(ctx, query, args)
+		if err != nil {
+			return TaskPage{}, err
+		}
+		if searchInSQL || filter.Query == "" {
+			tasks = batch
+			break
+		}
+
+		for _, task := range batch {
+			if matchesQuery(task, filter.Query) {
+				tasks = append(tasks, task)
+			}
+		}
+		if len(tasks) > limit || len(batch) <= limit {
+			break
+		}
+		last := batch[len(batch)-1]
+		cursor = &taskCursor{Sort: order, PerformedAt: last.PerformedAt, ID: last.ID}
+	}
+
+	return newTaskPage(tasks, order, limit), nil
+}
+
+// queryTasks runs a query built by buildTaskListQuery and decrypts the summaries
+func (r *MySQLTaskRepository) queryTasks(ctx context.Context, query string, args []interface{}) ([]models.TaskWithTechnician, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.TaskWithTechnician
+	for rows.Next() {
+		var task models.TaskWithTechnician
+		var performedAtStr string
+		var summary storedSummary
+		var assetID sql.NullInt64
+
+		err := rows.Scan(
+			&task.ID,
+			&summary.Value,
+			&performedAtStr,
+			&task.TechnicianID,
+			&assetID,
+			&task.TechnicianName,
+			&summary.KeyID,
+			&summary.WrappedKey,
+			&task.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		task.AssetID = int64Ptr(assetID)
+
+		task.Summary, err = r.openSummary(task.ID, summary)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse the formatted date string
+		parsedTime, err := time.Parse("2006-01-02 15:04:05", performedAtStr)
+		if err != nil {
+			return nil, ErrInvalidDate
+		}
+		task.PerformedAt = parsedTime
+
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Exists reports whether the task is stored
+func (r *MySQLTaskRepository) Exists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?"+scope+")", append([]interface{}{id}, args...)...).Scan(&exists)
+	return exists, err
+}
+
+// Delete removes a task, queues the blobs of its attachments for deletion and
+// queues its task.deleted event in one transaction
+func (r *MySQLTaskRepository) Delete(ctx context.Context, id string, actorID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The technician is gone with the task, so the organization is read first
+	organizationID, err := taskOrganization(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	// The attachments go with the task, their blobs are deleted later
+	if err := queueTaskBlobDeletions(ctx, tx, id); err != nil {
+		return err
+	}
+
+	scope, args := technicianInOrganization(ctx, "technician_id")
+	result, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?"+scope, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	if err := insertOutboxEvent(ctx, tx, events.NewTaskDeleted(id, organizationID, actorID)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// taskOrganization returns the organization of the technician of a task as
+// part of the caller's transaction
+func taskOrganization(ctx context.Context, tx *sql.Tx, taskID string) (int64, error) {
+	var organizationID int64
+	err := tx.QueryRowContext(ctx, `
+        SELECT u.organization_id FROM tasks t
+        JOIN users u ON u.id = t.technician_id
+        WHERE t.id = ?`, taskID).Scan(&organizationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return organizationID, err
+}
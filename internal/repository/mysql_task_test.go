@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLTaskRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLTaskRepository(db)
+	ctx := context.Background()
+	performedAt := time.Date(2024, 12, 29, 10, 30, 0, 0, time.UTC)
+	columns := []string{"technician_id", "asset_id", "summary", "summary_key_id", "summary_wrapped_key", "performed_at", "status"}
+	listColumns := []string{"id", "summary", "performed_at", "technician_id", "asset_id", "username", "summary_key_id", "summary_wrapped_key", "status"}
+
+	// Every change queues its event in the events topic of the outbox, attributed
+	// to the organization of the technician
+	expectOrganization := func(taskID string) {
+		mock.ExpectQuery("SELECT u.organization_id FROM tasks t\\s+JOIN users u ON u.id = t.technician_id\\s+WHERE t.id = \\?").
+			WithArgs(taskID).
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(3))
+	}
+	expectEvent := func(eventType string, payload sqlmock.Argument) {
+		mock.ExpectExec("INSERT INTO notification_outbox \\(topic, event_type, payload\\)").
+			WithArgs(models.OutboxEvents, eventType, payload).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	t.Run("create stores the task with its initial transition", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO tasks").
+			WithArgs("task1", int64(7), nil, "Replaced the pump seal", nil, nil, performedAt, models.StatusScheduled).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WithArgs("task1", nil, models.StatusScheduled, int64(7), nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		var event capture
+		expectOrganization("task1")
+		expectEvent(events.TypeTaskCreated, &event)
+		mock.ExpectCommit()
+
+		task := models.Task{ID: "task1", TechnicianID: 7, Summary: "Replaced the pump seal", PerformedAt: performedAt,
+			Status: models.StatusScheduled}
+		assert.NoError(t, repo.Create(ctx, &task, 5))
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		var envelope events.Envelope
+		assert.NoError(t, json.Unmarshal(event.value.([]byte), &envelope))
+		assert.NotEmpty(t, envelope.ID)
+		assert.Equal(t, int64(3), envelope.OrganizationID)
+		assert.Equal(t, int64(5), envelope.ActorID)
+		var data events.TaskData
+		assert.NoError(t, json.Unmarshal(envelope.Data, &data))
+		assert.Equal(t, "Replaced the pump seal", data.Summary)
+		assert.Equal(t, "scheduled", data.Status)
+	})
+
+	t.Run("create defaults to completed and queues the outbox message", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO tasks").
+			WithArgs("task2", int64(7), int64(4), "Replaced the pump seal", nil, nil, performedAt, models.StatusCompleted).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WithArgs("task2", nil, models.StatusCompleted, int64(7), nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventTaskPerformed, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectOrganization("task2")
+		expectEvent(events.TypeTaskCreated, sqlmock.AnyArg())
+		mock.ExpectCommit()
+
+		assetID := int64(4)
+		task := models.Task{ID: "task2", TechnicianID: 7, AssetID: &assetID, Summary: "Replaced the pump seal", PerformedAt: performedAt}
+		assert.NoError(t, repo.Create(ctx, &task, task.TechnicianID))
+		assert.Equal(t, models.StatusCompleted, task.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create duplicate task", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO tasks").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		mock.ExpectRollback()
+
+		task := models.Task{ID: "task1", TechnicianID: 7, Summary: "Replaced the pump seal", PerformedAt: performedAt}
+		assert.ErrorIs(t, repo.Create(ctx, &task, task.TechnicianID), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FROM tasks WHERE id = \\?").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, 4, "Replaced the pump seal", nil, nil, "2024-12-29 10:30:00", models.StatusCompleted))
+
+		task, err := repo.Get(ctx, "task1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), task.TechnicianID)
+		if assert.NotNil(t, task.AssetID) {
+			assert.Equal(t, int64(4), *task.AssetID)
+		}
+		assert.Equal(t, "Replaced the pump seal", task.Summary)
+		assert.Equal(t, performedAt, task.PerformedAt)
+		assert.Equal(t, models.StatusCompleted, task.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown task", func(t *testing.T) {
+		mock.ExpectQuery("FROM tasks WHERE id = \\?").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		_, err := repo.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get with a malformed date", func(t *testing.T) {
+		mock.ExpectQuery("FROM tasks WHERE id = \\?").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, nil, "Replaced the pump seal", nil, nil, "yesterday", models.StatusCompleted))
+
+		_, err := repo.Get(ctx, "task1")
+		assert.ErrorIs(t, err, ErrInvalidDate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = \\?").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}).AddRow(7))
+		mock.ExpectQuery("SELECT technician_id FROM tasks WHERE id = \\?").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows([]string{"technician_id"}))
+
+		owner, err := repo.Owner(ctx, "task1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), owner)
+		_, err = repo.Owner(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE tasks SET summary = \\?").
+			WithArgs("Replaced the gasket too", nil, nil, performedAt, "task1", int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FROM tasks WHERE id = \\? FOR UPDATE").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, 4, "Replaced the gasket too", nil, nil, "2024-12-29 10:30:00", models.StatusInProgress))
+		var event capture
+		expectOrganization("task1")
+		expectEvent(events.TypeTaskUpdated, &event)
+		mock.ExpectCommit()
+
+		// The status and asset of the body are not stored, the event must not carry them
+		assetID := int64(99)
+		task := models.Task{ID: "task1", TechnicianID: 7, Summary: "Replaced the gasket too", PerformedAt: performedAt,
+			Status: models.StatusCancelled, AssetID: &assetID}
+		assert.NoError(t, repo.Update(ctx, &task, task.TechnicianID))
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		var envelope events.Envelope
+		assert.NoError(t, json.Unmarshal(event.value.([]byte), &envelope))
+		var data events.TaskData
+		assert.NoError(t, json.Unmarshal(envelope.Data, &data))
+		assert.Equal(t, "Replaced the gasket too", data.Summary)
+		assert.Equal(t, "in_progress", data.Status)
+		if assert.NotNil(t, data.AssetID) {
+			assert.Equal(t, int64(4), *data.AssetID)
+		}
+	})
+
+	t.Run("update a task of another technician", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE tasks SET summary = \\?").
+			WithArgs("Replaced the gasket too", nil, nil, performedAt, "task1", int64(8)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		task := models.Task{ID: "task1", TechnicianID: 8, Summary: "Replaced the gasket too", PerformedAt: performedAt}
+		assert.ErrorIs(t, repo.Update(ctx, &task, task.TechnicianID), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list joins the technician", func(t *testing.T) {
+		mock.ExpectQuery("SELECT t.id, t.summary.*FROM tasks t\\s+JOIN users u").
+			WithArgs(DefaultTaskLimit + 1).
+			WillReturnRows(sqlmock.NewRows(listColumns).
+				AddRow("task1", "Replaced the pump seal", "2024-12-29 10:30:00", 7, nil, "pat_tech", nil, nil, models.StatusCompleted))
+
+		page, err := repo.List(ctx, TaskFilter{})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "pat_tech", page.Tasks[0].TechnicianName)
+			assert.Equal(t, performedAt, page.Tasks[0].PerformedAt)
+			assert.Nil(t, page.Tasks[0].AssetID)
+		}
+		assert.Empty(t, page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list with a malformed cursor", func(t *testing.T) {
+		_, err := repo.List(ctx, TaskFilter{Cursor: "not a cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM tasks WHERE id = \\?\\)").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		exists, err := repo.Exists(ctx, "task1")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectOrganization("task1")
+		mock.ExpectExec("INSERT INTO blob_deletions").
+			WithArgs("task1", "task1").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM tasks WHERE id = \\?").
+			WithArgs("task1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectEvent(events.TypeTaskDeleted, sqlmock.AnyArg())
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.Delete(ctx, "task1", 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete unknown task", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT u.organization_id FROM tasks t").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}))
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.Delete(ctx, "missing", 1), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete failure rolls back", func(t *testing.T) {
+		mock.ExpectBegin()
+		expectOrganization("task1")
+		mock.ExpectExec("INSERT INTO blob_deletions").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM tasks").
+			WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+
+		assert.Error(t, repo.Delete(ctx, "task1", 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("scoped to the organization of the context", func(t *testing.T) {
+		orgCtx := tenant.WithOrganization(ctx, 2)
+		mock.ExpectQuery("FROM tasks WHERE id = \\? AND technician_id IN \\(SELECT id FROM users WHERE organization_id = \\?\\)").
+			WithArgs("task1", int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE tasks .* AND technician_id IN \\(SELECT id FROM users WHERE organization_id = \\?\\)").
+			WithArgs("Replaced the gasket too", nil, nil, performedAt, "task1", int64(7), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := repo.Get(orgCtx, "task1")
+		assert.ErrorIs(t, err, ErrNotFound)
+		task := models.Task{ID: "task1", TechnicianID: 7, Summary: "Replaced the gasket too", PerformedAt: performedAt}
+		assert.ErrorIs(t, repo.Update(orgCtx, &task, task.TechnicianID), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
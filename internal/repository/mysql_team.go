@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// MySQLTeamRepository implements TeamRepository on top of a MySQL database
+type MySQLTeamRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLTeamRepository creates a new MySQLTeamRepository
+func NewMySQLTeamRepository(db *sql.DB) *MySQLTeamRepository {
+	return &MySQLTeamRepository{
+		db: db,
+	}
+}
+
+const teamSelect = `
+        SELECT id, organization_id, name, parent_id, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM teams`
+
+// Create inserts a new team into the organization of the context and sets its
+// ID from the auto-increment column
+func (r *MySQLTeamRepository) Create(ctx context.Context, team *models.Team) error {
+	orgID := organizationFor(ctx, team.OrganizationID)
+	if err := r.checkParent(ctx, orgID, team.ParentID); err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `INSERT INTO teams (organization_id, name, parent_id) VALUES (?, ?, ?)`,
+		orgID, team.Name, nullInt64(team.ParentID))
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if isMySQLError(err, mysqlErrNoReferencedRow) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	team.ID = id
+	team.OrganizationID = orgID
+	team.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// Get returns a team
+func (r *MySQLTeamRepository) Get(ctx context.Context, id int64) (*models.Team, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	return scanTeam(r.db.QueryRowContext(ctx, teamSelect+` WHERE id = ?`+scope, append([]interface{}{id}, args...)...))
+}
+
+// List returns every team ordered by ID
+func (r *MySQLTeamRepository) List(ctx context.Context) ([]models.Team, error) {
+	scope, args := whereOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, teamSelect+scope+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, *team)
+	}
+	return teams, rows.Err()
+}
+
+// Update renames a team or moves it under another parent
+func (r *MySQLTeamRepository) Update(ctx context.Context, team *models.Team) error {
+	stored, err := r.Get(ctx, team.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.checkParent(ctx, stored.OrganizationID, team.ParentID); err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE teams SET name = ?, parent_id = ? WHERE id = ?`,
+		team.Name, nullInt64(team.ParentID), team.ID)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	} else if isMySQLError(err, mysqlErrNoReferencedRow) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	team.OrganizationID = stored.OrganizationID
+	return nil
+}
+
+// checkParent returns ErrNotFound when parentID is set to a team that does
+// not belong to the organization. The foreign key only covers unknown teams.
+func (r *MySQLTeamRepository) checkParent(ctx context.Context, organizationID int64, parentID *int64) error {
+	if parentID == nil {
+		return nil
+	}
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM teams WHERE id = ? AND organization_id = ?)`,
+		*parentID, organizationID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a team, its memberships are removed by the foreign key
+func (r *MySQLTeamRepository) Delete(ctx context.Context, id int64) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx, `DELETE FROM teams WHERE id = ?`+scope, append([]interface{}{id}, args...)...)
+	if isMySQLError(err, mysqlErrRowIsReferenced) {
+		return ErrInUse
+	} else if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Members returns the members of a team ordered by user ID
+func (r *MySQLTeamRepository) Members(ctx context.Context, teamID int64) ([]models.TeamMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT m.team_id, m.user_id, u.username, m.role, DATE_FORMAT(m.created_at, '%Y-%m-%d %H:%i:%s')
+        FROM team_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.team_id = ?
+        ORDER BY m.user_id`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.TeamMember{}
+	for rows.Next() {
+		var member models.TeamMember
+		var createdAt sql.NullString
+		if err := rows.Scan(&member.TeamID, &member.UserID, &member.Username, &member.Role, &createdAt); err != nil {
+			return nil, err
+		}
+		if created, err := parseNullTime(createdAt); err != nil {
+			return nil, err
+		} else if created != nil {
+			member.CreatedAt = *created
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds a user to a team or changes their role in it, returning
+// ErrNotFound for an unknown team or user
+func (r *MySQLTeamRepository) SetMember(ctx context.Context, member *models.TeamMember) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO team_members (team_id, user_id, role) VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE role = VALUES(role)`,
+		member.TeamID, member.UserID, member.Role)
+	if isMySQLError(err, mysqlErrNoReferencedRow) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// RemoveMember removes a user from a team
+func (r *MySQLTeamRepository) RemoveMember(ctx context.Context, teamID int64, userID uint) error {
+	query := `DELETE FROM team_members WHERE team_id = ? AND user_id = ?`
+	args := []interface{}{teamID, userID}
+	if orgID, ok := tenant.Organization(ctx); ok {
+		query += ` AND team_id IN (SELECT id FROM teams WHERE organization_id = ?)`
+		args = append(args, orgID)
+	}
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ManagedUsers walks down from the teams the user manages to every sub-team
+// and returns their members
+func (r *MySQLTeamRepository) ManagedUsers(ctx context.Context, managerID uint) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH RECURSIVE managed (id) AS (
+            SELECT team_id FROM team_members WHERE user_id = ? AND role = 'manager'
+            UNION
+            SELECT t.id FROM teams t JOIN managed ON t.parent_id = managed.id
+        )
+        SELECT DISTINCT m.user_id
+        FROM team_members m
+        JOIN managed ON m.team_id = managed.id
+        ORDER BY m.user_id`, managerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Managers walks up from the teams of the user to the top level teams and
+// returns their active managers, except the user themselves
+func (r *MySQLTeamRepository) Managers(ctx context.Context, userID uint) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH RECURSIVE above (id) AS (
+            SELECT team_id FROM team_members WHERE user_id = ?
+            UNION
+            SELECT t.parent_id FROM teams t JOIN above ON t.id = above.id WHERE t.parent_id IS NOT NULL
+        )
+        SELECT DISTINCT u.id, u.username, u.email, u.role
+        FROM team_members m
+        JOIN above ON m.team_id = above.id
+        JOIN users u ON u.id = m.user_id
+        WHERE m.role = 'manager' AND u.active AND u.id <> ?
+        ORDER BY u.id`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var managers []models.User
+	for rows.Next() {
+		user := models.User{Active: true}
+		var email sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &email, &user.Role); err != nil {
+			return nil, err
+		}
+		user.Email = email.String
+		managers = append(managers, user)
+	}
+	return managers, rows.Err()
+}
+
+func scanTeam(row rowScanner) (*models.Team, error) {
+	var team models.Team
+	var parentID sql.NullInt64
+	var createdAt sql.NullString
+	err := row.Scan(&team.ID, &team.OrganizationID, &team.Name, &parentID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	team.ParentID = int64Ptr(parentID)
+	created, err := parseNullTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		team.CreatedAt = *created
+	}
+	return &team, nil
+}
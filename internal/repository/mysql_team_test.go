@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLTeamRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLTeamRepository(db)
+	ctx := context.Background()
+	parentID := int64(1)
+	columns := []string{"id", "organization_id", "name", "parent_id", "created_at"}
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM teams WHERE id = \\? AND organization_id = \\?\\)").
+			WithArgs(parentID, models.DefaultOrganizationID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec("INSERT INTO teams \\(organization_id, name, parent_id\\)").
+			WithArgs(models.DefaultOrganizationID, "North crew", parentID).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+
+		team := models.Team{Name: "North crew", ParentID: &parentID}
+		assert.NoError(t, repo.Create(ctx, &team))
+		assert.Equal(t, int64(2), team.ID)
+
+		mock.ExpectExec("INSERT INTO teams").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+		assert.ErrorIs(t, repo.Create(ctx, &models.Team{Name: "North crew"}), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("parent of another organization", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(parentID, int64(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		team := models.Team{Name: "South crew", ParentID: &parentID}
+		assert.ErrorIs(t, repo.Create(tenant.WithOrganization(ctx, 2), &team), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, name, parent_id,.*FROM teams WHERE id = ?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(2, 1, "North crew", 1, "2025-01-01 08:00:00"))
+
+		team, err := repo.Get(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "North crew", team.Name)
+		assert.Equal(t, parentID, *team.ParentID)
+
+		mock.ExpectQuery("SELECT id, organization_id, name, parent_id,.*FROM teams WHERE id = ?").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows(columns))
+		_, err = repo.Get(ctx, 9)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete a team with sub-teams", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM teams WHERE id = ?").
+			WithArgs(1).
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrRowIsReferenced})
+
+		assert.ErrorIs(t, repo.Delete(ctx, 1), ErrInUse)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("set member", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO team_members \\(team_id, user_id, role\\) VALUES \\(\\?, \\?, \\?\\)\\s+ON DUPLICATE KEY UPDATE role = VALUES\\(role\\)").
+			WithArgs(2, 5, models.TeamRoleManager).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, repo.SetMember(ctx, &models.TeamMember{TeamID: 2, UserID: 5, Role: models.TeamRoleManager}))
+
+		mock.ExpectExec("INSERT INTO team_members").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrNoReferencedRow})
+		assert.ErrorIs(t, repo.SetMember(ctx, &models.TeamMember{TeamID: 2, UserID: 99, Role: models.TeamRoleMember}), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("remove unknown member", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM team_members WHERE team_id = \\? AND user_id = \\?").
+			WithArgs(2, 99).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.ErrorIs(t, repo.RemoveMember(ctx, 2, 99), ErrNotFound)
+
+		mock.ExpectExec("DELETE FROM team_members WHERE team_id = \\? AND user_id = \\? AND team_id IN \\(SELECT id FROM teams WHERE organization_id = \\?\\)").
+			WithArgs(2, 5, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.ErrorIs(t, repo.RemoveMember(tenant.WithOrganization(ctx, 2), 2, 5), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("managed users", func(t *testing.T) {
+		mock.ExpectQuery("WITH RECURSIVE managed .* role = 'manager'.*JOIN managed ON t.parent_id = managed.id.*SELECT DISTINCT m.user_id").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1).AddRow(3).AddRow(4))
+
+		managed, err := repo.ManagedUsers(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 3, 4}, managed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("managers", func(t *testing.T) {
+		mock.ExpectQuery("WITH RECURSIVE above .*SELECT t.parent_id FROM teams t JOIN above ON t.id = above.id.*m.role = 'manager' AND u.active AND u.id <> ?").
+			WithArgs(4, 4).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "role"}).
+				AddRow(1, "head", "head@example.com", "manager").
+				AddRow(2, "lead", nil, "manager"))
+
+		managers, err := repo.Managers(ctx, 4)
+		assert.NoError(t, err)
+		if assert.Len(t, managers, 2) {
+			assert.Equal(t, "head@example.com", managers[0].Email)
+			assert.Equal(t, "lead", managers[1].Username)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLTokenRepository implements TokenRepository on top of a MySQL database
+type MySQLTokenRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLTokenRepository creates a new MySQLTokenRepository
+func NewMySQLTokenRepository(db *sql.DB) *MySQLTokenRepository {
+	return &MySQLTokenRepository{
+		db: db,
+	}
+}
+
+// CreateRefreshToken inserts a new refresh token and sets its ID from the auto-increment column
+func (r *MySQLTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+        INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_token_id, mfa, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	result, err := r.db.ExecContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash,
+		token.AccessTokenID, token.MFA, token.ExpiresAt.UTC())
+	if err != nil {
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	token.ID = id
+	token.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// GetRefreshToken returns the refresh token with the given hash
+func (r *MySQLTokenRepository) GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := `
+        SELECT id, user_id, family_id, access_token_id, mfa,
+        DATE_FORMAT(expires_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(used_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(revoked_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM refresh_tokens WHERE token_hash = ?`
+
+	token := models.RefreshToken{TokenHash: hash}
+	var expiresAt, createdAt string
+	var usedAt, revokedAt sql.NullString
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(&token.ID, &token.UserID, &token.FamilyID,
+		&token.AccessTokenID, &token.MFA, &expiresAt, &usedAt, &revokedAt, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ExpiresAt, err = time.Parse("2006-01-02 15:04:05", expiresAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if token.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if token.UsedAt, err = parseNullTime(usedAt); err != nil {
+		return nil, err
+	}
+	if token.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token as exchanged if it is still unused and not revoked
+func (r *MySQLTokenRepository) UseRefreshToken(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// RevokeFamily revokes every refresh token of a family that is not revoked
+// yet and terminates its session
+func (r *MySQLTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	return r.revoke(ctx, "family_id", "id", familyID)
+}
+
+// RevokeUser revokes every refresh token of a user that is not revoked yet
+// and terminates their sessions
+func (r *MySQLTokenRepository) RevokeUser(ctx context.Context, userID uint) error {
+	return r.revoke(ctx, "user_id", "user_id", userID)
+}
+
+// revoke revokes the refresh tokens and the sessions matching the value in
+// one transaction, so no session outlives its tokens
+func (r *MySQLTokenRepository) revoke(ctx context.Context, tokenColumn, sessionColumn string, value interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE "+tokenColumn+" = ? AND revoked_at IS NULL", now, value); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE "+sessionColumn+" = ? AND revoked_at IS NULL", now, value); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeAccessToken records a revoked access token, revoking it twice is not an error
+func (r *MySQLTokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT IGNORE INTO revoked_access_tokens (jti, expires_at) VALUES (?, ?)",
+		jti, expiresAt.UTC())
+	return err
+}
+
+// IsRevoked reports whether an access token was revoked at logout or with its refresh token family
+func (r *MySQLTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `
+        SELECT EXISTS(SELECT 1 FROM revoked_access_tokens WHERE jti = ?)
+        OR EXISTS(SELECT 1 FROM refresh_tokens WHERE access_token_id = ? AND revoked_at IS NOT NULL)
+    `
+	var revoked bool
+	if err := r.db.QueryRowContext(ctx, query, jti, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// PurgeExpired deletes refresh tokens, sessions and access token revocations
+// that expired before the given time
+func (r *MySQLTokenRepository) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	for _, query := range []string{
+		"DELETE FROM refresh_tokens WHERE expires_at < ?",
+		"DELETE FROM revoked_access_tokens WHERE expires_at < ?",
+		"DELETE FROM sessions WHERE expires_at < ?",
+	} {
+		result, err := r.db.ExecContext(ctx, query, before.UTC())
+		if err != nil {
+			return purged, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += rowsAffected
+	}
+	return purged, nil
+}
+
+const sessionSelect = `
+        SELECT id, user_id, device_name, user_agent, ip_address,
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(last_seen_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(expires_at, '%Y-%m-%d %H:%i:%s'),
+        DATE_FORMAT(revoked_at, '%Y-%m-%d %H:%i:%s')
+        FROM sessions`
+
+// CreateSession inserts the session of a new login
+func (r *MySQLTokenRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO sessions (id, user_id, device_name, user_agent, ip_address, last_seen_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.DeviceName, session.UserAgent, session.IPAddress, now, session.ExpiresAt.UTC())
+	if err != nil {
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	return nil
+}
+
+// GetSession returns the session with the given ID
+func (r *MySQLTokenRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	return scanSession(r.db.QueryRowContext(ctx, sessionSelect+` WHERE id = ?`, id))
+}
+
+// ListSessions returns the active sessions of a user, the most recently seen first
+func (r *MySQLTokenRepository) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		sessionSelect+` WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC, id`,
+		userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// RenewSession records a refresh of the session, unknown sessions are ignored
+func (r *MySQLTokenRepository) RenewSession(ctx context.Context, id, address string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE sessions SET ip_address = ?, last_seen_at = ?, expires_at = ? WHERE id = ?",
+		address, time.Now().UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+// TouchSession records that the session was used, unknown sessions are ignored
+func (r *MySQLTokenRepository) TouchSession(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", at.UTC(), id)
+	return err
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	var createdAt, lastSeenAt, expiresAt string
+	var revokedAt sql.NullString
+	err := row.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+		&createdAt, &lastSeenAt, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if session.LastSeenAt, err = time.Parse("2006-01-02 15:04:05", lastSeenAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if session.ExpiresAt, err = time.Parse("2006-01-02 15:04:05", expiresAt); err != nil {
+		return nil, ErrInvalidDate
+	}
+	if session.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// parseNullTime parses a formatted nullable timestamp column
+func parseNullTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", value.String)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	return &t, nil
+}
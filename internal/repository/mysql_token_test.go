@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLTokenRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLTokenRepository(db)
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("create", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO refresh_tokens").
+			WithArgs(1, "family-1", "hash-1", "jti-1", true, expiresAt).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+
+		token := models.RefreshToken{UserID: 1, FamilyID: "family-1", TokenHash: "hash-1", AccessTokenID: "jti-1", MFA: true, ExpiresAt: expiresAt}
+		assert.NoError(t, repo.CreateRefreshToken(ctx, &token))
+		assert.Equal(t, int64(4), token.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, user_id, family_id.*FROM refresh_tokens WHERE token_hash = ?").
+			WithArgs("hash-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "access_token_id", "mfa",
+				"expires_at", "used_at", "revoked_at", "created_at"}).
+				AddRow(4, 1, "family-1", "jti-1", true, "2025-02-01 08:00:00", "2025-01-02 08:00:00", nil, "2025-01-01 08:00:00"))
+
+		token, err := repo.GetRefreshToken(ctx, "hash-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "family-1", token.FamilyID)
+		assert.True(t, token.MFA)
+		assert.True(t, expiresAt.Equal(token.ExpiresAt))
+		assert.NotNil(t, token.UsedAt)
+		assert.Nil(t, token.RevokedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("use an exchanged token", func(t *testing.T) {
+		mock.ExpectExec("UPDATE refresh_tokens SET used_at = \\? WHERE id = \\? AND used_at IS NULL AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 4).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.ErrorIs(t, repo.UseRefreshToken(ctx, 4), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke family", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = \\? WHERE family_id = \\? AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), "family-1").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("UPDATE sessions SET revoked_at = \\? WHERE id = \\? AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), "family-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.RevokeFamily(ctx, "family-1"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke user", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at = \\? WHERE user_id = \\? AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("UPDATE sessions SET revoked_at = \\? WHERE user_id = \\? AND revoked_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.RevokeUser(ctx, 1))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoking rolls back on error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refresh_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE sessions").WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+
+		assert.Error(t, repo.RevokeFamily(ctx, "family-1"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("is revoked", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS.*revoked_access_tokens.*OR EXISTS.*refresh_tokens WHERE access_token_id = \\? AND revoked_at IS NOT NULL").
+			WithArgs("jti-1", "jti-1").
+			WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(true))
+
+		revoked, err := repo.IsRevoked(ctx, "jti-1")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("purge expired", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM refresh_tokens WHERE expires_at < ?").
+			WithArgs(expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("DELETE FROM revoked_access_tokens WHERE expires_at < ?").
+			WithArgs(expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM sessions WHERE expires_at < ?").
+			WithArgs(expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		purged, err := repo.PurgeExpired(ctx, expiresAt)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), purged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create session", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO sessions").
+			WithArgs("family-1", 1, "Work laptop", "curl/8.0", "192.0.2.1", sqlmock.AnyArg(), expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		session := models.Session{ID: "family-1", UserID: 1, DeviceName: "Work laptop", UserAgent: "curl/8.0",
+			IPAddress: "192.0.2.1", ExpiresAt: expiresAt}
+		assert.NoError(t, repo.CreateSession(ctx, &session))
+		assert.False(t, session.CreatedAt.IsZero())
+		assert.Equal(t, session.CreatedAt, session.LastSeenAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("create a known session", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO sessions").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+
+		session := models.Session{ID: "family-1", UserID: 1, ExpiresAt: expiresAt}
+		assert.ErrorIs(t, repo.CreateSession(ctx, &session), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	sessionColumns := []string{"id", "user_id", "device_name", "user_agent", "ip_address",
+		"created_at", "last_seen_at", "expires_at", "revoked_at"}
+
+	t.Run("get session", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, user_id, device_name.*FROM sessions WHERE id = \\?").
+			WithArgs("family-1").
+			WillReturnRows(sqlmock.NewRows(sessionColumns).
+				AddRow("family-1", 1, "Work laptop", "curl/8.0", "192.0.2.1",
+					"2025-01-01 08:00:00", "2025-01-02 08:00:00", "2025-02-01 08:00:00", "2025-01-03 08:00:00"))
+
+		session, err := repo.GetSession(ctx, "family-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Work laptop", session.DeviceName)
+		assert.Equal(t, time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC), session.LastSeenAt)
+		assert.True(t, expiresAt.Equal(session.ExpiresAt))
+		assert.NotNil(t, session.RevokedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown session", func(t *testing.T) {
+		mock.ExpectQuery("FROM sessions WHERE id = \\?").
+			WithArgs("family-9").
+			WillReturnRows(sqlmock.NewRows(sessionColumns))
+
+		_, err := repo.GetSession(ctx, "family-9")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list sessions", func(t *testing.T) {
+		mock.ExpectQuery("FROM sessions WHERE user_id = \\? AND revoked_at IS NULL AND expires_at > \\? ORDER BY last_seen_at DESC, id").
+			WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(sessionColumns).
+				AddRow("family-2", 1, "", "", "192.0.2.2", "2025-01-01 08:00:00", "2025-01-05 08:00:00", "2025-02-04 08:00:00", nil).
+				AddRow("family-3", 1, "Phone", "", "192.0.2.3", "2025-01-01 09:00:00", "2025-01-04 08:00:00", "2025-02-03 08:00:00", nil))
+
+		sessions, err := repo.ListSessions(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+		assert.Equal(t, "family-2", sessions[0].ID)
+		assert.Equal(t, "Phone", sessions[1].DeviceName)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("renew session", func(t *testing.T) {
+		mock.ExpectExec("UPDATE sessions SET ip_address = \\?, last_seen_at = \\?, expires_at = \\? WHERE id = \\?").
+			WithArgs("192.0.2.4", sqlmock.AnyArg(), expiresAt, "family-2").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.RenewSession(ctx, "family-2", "192.0.2.4", expiresAt))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("touch session", func(t *testing.T) {
+		at := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+		mock.ExpectExec("UPDATE sessions SET last_seen_at = \\? WHERE id = \\?").
+			WithArgs(at, "family-2").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.TouchSession(ctx, "family-2", at))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
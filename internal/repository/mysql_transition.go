@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/events"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// insertTransition appends a transition to the history as part of the caller's transaction
+func insertTransition(ctx context.Context, tx *sql.Tx, transition *models.TaskTransition) error {
+	result, err := tx.ExecContext(ctx, `
+        INSERT INTO task_transitions (task_id, from_status, to_status, actor_id, reason)
+        VALUES (?, ?, ?, ?, ?)`,
+		transition.TaskID, nullString(string(transition.From)), transition.To, transition.ActorID, nullString(transition.Reason))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	transition.ID = id
+	transition.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// Transition moves a task to a new status, records it in the history and
+// queues its task.transitioned event in one transaction. Completing a task
+// also queues its task performed outbox message.
+func (r *MySQLTaskRepository) Transition(ctx context.Context, transition *models.TaskTransition) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	task, summary, err := getStoredTask(ctx, tx, transition.TaskID, true)
+	if err != nil {
+		return err
+	}
+	if task.Status != transition.From {
+		return ErrConflict
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE tasks SET status = ? WHERE id = ?", transition.To, transition.TaskID)
+	if err != nil {
+		return err
+	}
+	if err := insertTransition(ctx, tx, transition); err != nil {
+		return err
+	}
+
+	if transition.To == models.StatusCompleted {
+		payload, err := performedPayload(task, summary)
+		if err != nil {
+			return err
+		}
+		if err := insertOutboxMessage(ctx, tx, models.EventTaskPerformed, payload); err != nil {
+			return err
+		}
+	}
+
+	organizationID, err := taskOrganization(ctx, tx, transition.TaskID)
+	if err != nil {
+		return err
+	}
+	if err := insertOutboxEvent(ctx, tx, events.NewTaskTransitioned(*transition, organizationID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Transitions returns the status history of a task, oldest first
+func (r *MySQLTaskRepository) Transitions(ctx context.Context, taskID string) ([]models.TaskTransition, error) {
+	exists, err := r.Exists(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, from_status, to_status, actor_id, reason,
+        DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s')
+        FROM task_transitions
+        WHERE task_id = ?
+        ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []models.TaskTransition{}
+	for rows.Next() {
+		transition := models.TaskTransition{TaskID: taskID}
+		var from, reason sql.NullString
+		var createdAt string
+		if err := rows.Scan(&transition.ID, &from, &transition.To, &transition.ActorID, &reason, &createdAt); err != nil {
+			return nil, err
+		}
+		transition.From = models.TaskStatus(from.String)
+		transition.Reason = reason.String
+
+		transition.CreatedAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
+		if err != nil {
+			return nil, ErrInvalidDate
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLTaskRepositoryTransitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLTaskRepository(db)
+	ctx := context.Background()
+	taskColumns := []string{"technician_id", "asset_id", "summary", "summary_key_id", "summary_wrapped_key", "performed_at", "status"}
+
+	t.Run("completing a task records it and queues a notification and its event", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FROM tasks WHERE id = \\? FOR UPDATE").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(taskColumns).
+				AddRow(7, nil, "Fixed the pump", nil, nil, "2024-12-29 10:30:00", "in_progress"))
+		mock.ExpectExec("UPDATE tasks SET status = \\? WHERE id = \\?").
+			WithArgs(models.StatusCompleted, "task1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO task_transitions").
+			WithArgs("task1", models.StatusInProgress, models.StatusCompleted, int64(7), "all good").
+			WillReturnResult(sqlmock.NewResult(12, 1))
+		mock.ExpectExec("INSERT INTO notification_outbox").
+			WithArgs(models.EventTaskPerformed, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT u.organization_id FROM tasks t").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO notification_outbox \\(topic, event_type, payload\\)").
+			WithArgs(models.OutboxEvents, "task.transitioned", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		transition := models.TaskTransition{
+			TaskID: "task1", From: models.StatusInProgress, To: models.StatusCompleted, ActorID: 7, Reason: "all good",
+		}
+		assert.NoError(t, repo.Transition(ctx, &transition))
+		assert.Equal(t, int64(12), transition.ID)
+		assert.False(t, transition.CreatedAt.IsZero())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("status changed since it was read", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FOR UPDATE").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows(taskColumns).
+				AddRow(7, nil, "Fixed the pump", nil, nil, "2024-12-29 10:30:00", "cancelled"))
+		mock.ExpectRollback()
+
+		transition := models.TaskTransition{TaskID: "task1", From: models.StatusInProgress, To: models.StatusCompleted}
+		assert.ErrorIs(t, repo.Transition(ctx, &transition), ErrConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT technician_id, asset_id, summary.*FOR UPDATE").
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		transition := models.TaskTransition{TaskID: "missing", To: models.StatusCancelled}
+		assert.ErrorIs(t, repo.Transition(ctx, &transition), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("history oldest first", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT id, from_status, to_status, actor_id, reason.*FROM task_transitions").
+			WithArgs("task1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "from_status", "to_status", "actor_id", "reason", "created_at"}).
+				AddRow(1, nil, "scheduled", 7, nil, "2024-12-28 09:00:00").
+				AddRow(2, "scheduled", "cancelled", 2, "duplicate", "2024-12-28 10:00:00"))
+
+		history, err := repo.Transitions(ctx, "task1")
+		assert.NoError(t, err)
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, models.TaskStatus(""), history[0].From)
+			assert.Equal(t, models.StatusScheduled, history[0].To)
+			assert.Equal(t, models.StatusCancelled, history[1].To)
+			assert.Equal(t, "duplicate", history[1].Reason)
+			assert.Equal(t, int64(2), history[1].ActorID)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// MySQLUserRepository implements UserRepository on top of a MySQL database
+type MySQLUserRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLUserRepository creates a new MySQLUserRepository
+func NewMySQLUserRepository(db *sql.DB) *MySQLUserRepository {
+	return &MySQLUserRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new user and sets its ID from the auto-increment column
+func (r *MySQLUserRepository) Create(ctx context.Context, user *models.User) error {
+	return insertUser(ctx, r.db, user)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertUser inserts a user with db or within a transaction, into
+// user.OrganizationID or else the organization of the context
+func insertUser(ctx context.Context, db execer, user *models.User) error {
+	query := `
+        INSERT INTO users (organization_id, username, email, password, role)
+        VALUES (?, ?, ?, ?, ?)
+    `
+	orgID := organizationFor(ctx, user.OrganizationID)
+	result, err := db.ExecContext(ctx, query, orgID, user.Username, nullString(user.Email), user.Password, user.Role)
+	if isMySQLError(err, mysqlErrDuplicateEntry) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	user.ID = uint(id)
+	user.OrganizationID = orgID
+	user.Active = true
+	return nil
+}
+
+// GetByUsername returns the user with the given username. Usernames are
+// unique across organizations, so users sign in without naming theirs.
+func (r *MySQLUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	user := models.User{Username: username}
+	scope, args := inOrganization(ctx, "organization_id")
+	query := `SELECT id, organization_id, password, role, active FROM users WHERE username = ?` + scope
+	err := r.db.QueryRowContext(ctx, query, append([]interface{}{username}, args...)...).
+		Scan(&user.ID, &user.OrganizationID, &user.Password, &user.Role, &user.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByID returns the user with the given ID
+func (r *MySQLUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	query := userSelect + ` WHERE id = ?` + scope
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, append([]interface{}{id}, args...)...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListByRole returns every active user with the given role
+func (r *MySQLUserRepository) ListByRole(ctx context.Context, role models.Role) ([]models.User, error) {
+	scope, args := inOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, `SELECT id, organization_id, username, email FROM users WHERE role = ? AND active`+scope+` ORDER BY id`,
+		append([]interface{}{role}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user := models.User{Role: role, Active: true}
+		var email sql.NullString
+		if err := rows.Scan(&user.ID, &user.OrganizationID, &user.Username, &email); err != nil {
+			return nil, err
+		}
+		user.Email = email.String
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// List returns every user ordered by ID
+func (r *MySQLUserRepository) List(ctx context.Context) ([]models.User, error) {
+	scope, args := whereOrganization(ctx, "organization_id")
+	rows, err := r.db.QueryContext(ctx, userSelect+scope+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// UpdateRole changes the role of a user
+func (r *MySQLUserRepository) UpdateRole(ctx context.Context, id uint, role models.Role) error {
+	return r.update(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, id)
+}
+
+// SetActive deactivates or reactivates a user
+func (r *MySQLUserRepository) SetActive(ctx context.Context, id uint, active bool) error {
+	return r.update(ctx, `UPDATE users SET active = ? WHERE id = ?`, active, id)
+}
+
+// UpdatePassword replaces the password hash of a user
+func (r *MySQLUserRepository) UpdatePassword(ctx context.Context, id uint, passwordHash string) error {
+	return r.update(ctx, `UPDATE users SET password = ? WHERE id = ?`, passwordHash, id)
+}
+
+// update runs a single row update, returning ErrNotFound for an unknown user.
+// Setting a value the user already has is no error.
+func (r *MySQLUserRepository) update(ctx context.Context, query string, value interface{}, id uint) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx, query+scope, append([]interface{}{value, id}, args...)...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Nothing changed, either the user is unknown or already had the value
+	var exists bool
+	err = r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = ?`+scope+`)`,
+		append([]interface{}{id}, args...)...).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IsActive reports whether a user exists and is active
+func (r *MySQLUserRepository) IsActive(ctx context.Context, id uint) (bool, error) {
+	var active bool
+	scope, args := inOrganization(ctx, "organization_id")
+	err := r.db.QueryRowContext(ctx, `SELECT active FROM users WHERE id = ?`+scope, append([]interface{}{id}, args...)...).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+// Delete removes a user, returning ErrInUse while tasks or schedules reference it
+func (r *MySQLUserRepository) Delete(ctx context.Context, id uint) error {
+	scope, args := inOrganization(ctx, "organization_id")
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`+scope, append([]interface{}{id}, args...)...)
+	if isMySQLError(err, mysqlErrRowIsReferenced) {
+		return ErrInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// userSelect selects the columns read by scanUser
+const userSelect = `
+        SELECT id, organization_id, username, email, role, active,
+               DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s'), DATE_FORMAT(updated_at, '%Y-%m-%d %H:%i:%s')
+        FROM users`
+
+// scanUser reads a user selected with userSelect, without its password
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var email, createdAt, updatedAt sql.NullString
+	if err := row.Scan(&user.ID, &user.OrganizationID, &user.Username, &email, &user.Role, &user.Active, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	user.Email = email.String
+
+	created, err := parseNullTime(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		user.CreatedAt = *created
+	}
+	updated, err := parseNullTime(updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if updated != nil {
+		user.UpdatedAt = *updated
+	}
+	return &user, nil
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
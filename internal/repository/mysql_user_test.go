@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLUserRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLUserRepository(db)
+	ctx := context.Background()
+	columns := []string{"id", "organization_id", "username", "email", "role", "active", "created_at", "updated_at"}
+
+	t.Run("duplicate username", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrDuplicateEntry})
+
+		user := models.User{Username: "tech1", Password: "hash", Role: models.RoleTechnician}
+		assert.ErrorIs(t, repo.Create(ctx, &user), ErrDuplicate)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("list", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, username, email, role, active,.*FROM users ORDER BY id").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, 1, "admin", nil, "admin", true, "2025-01-01 08:00:00", "2025-01-01 08:00:00").
+				AddRow(2, 1, "tech1", "tech1@example.com", "technician", false, "2025-01-02 08:00:00", "2025-01-03 08:00:00"))
+
+		users, err := repo.List(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, users, 2) {
+			assert.Equal(t, models.RoleAdmin, users[0].Role)
+			assert.Equal(t, models.DefaultOrganizationID, users[0].OrganizationID)
+			assert.Equal(t, "tech1@example.com", users[1].Email)
+			assert.False(t, users[1].Active)
+			assert.Equal(t, 3, users[1].UpdatedAt.Day())
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("get unknown user", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id, organization_id, username, email, role, active,.*FROM users WHERE id = ?").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		_, err := repo.GetByID(ctx, 9)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("scoped to the organization of the context", func(t *testing.T) {
+		orgCtx := tenant.WithOrganization(ctx, 2)
+		mock.ExpectQuery("FROM users WHERE organization_id = \\? ORDER BY id").
+			WithArgs(int64(2)).
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectExec("DELETE FROM users WHERE id = \\? AND organization_id = \\?").
+			WithArgs(1, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		users, err := repo.List(orgCtx)
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+		assert.ErrorIs(t, repo.Delete(orgCtx, 1), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("set active on an unknown user", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET active = \\? WHERE id = \\?").
+			WithArgs(false, 9).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM users WHERE id = \\?\\)").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		assert.ErrorIs(t, repo.SetActive(ctx, 9, false), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update role", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET role = \\? WHERE id = \\?").
+			WithArgs(models.RoleAdmin, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.UpdateRole(ctx, 1, models.RoleAdmin))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update password", func(t *testing.T) {
+		mock.ExpectExec("UPDATE users SET password = \\? WHERE id = \\?").
+			WithArgs("new-hash", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.UpdatePassword(ctx, 1, "new-hash"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete a user with tasks", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM users WHERE id = ?").
+			WithArgs(2).
+			WillReturnError(&mysql.MySQLError{Number: mysqlErrRowIsReferenced})
+
+		assert.ErrorIs(t, repo.Delete(ctx, 2), ErrInUse)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("is active", func(t *testing.T) {
+		mock.ExpectQuery("SELECT active FROM users WHERE id = ?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(false))
+
+		active, err := repo.IsActive(ctx, 2)
+		assert.NoError(t, err)
+		assert.False(t, active)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
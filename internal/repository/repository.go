@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// ErrDuplicate is returned when a record violates a uniqueness constraint
+	ErrDuplicate = errors.New("record already exists")
+
+	// ErrInvalidDate is returned when a stored date cannot be parsed
+	ErrInvalidDate = errors.New("error parsing date")
+
+	// ErrDecrypt is returned when a stored encrypted field cannot be decrypted
+	ErrDecrypt = errors.New("error decrypting stored data")
+
+	// ErrInvalidCursor is returned when a pagination cursor is malformed or was issued for another sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrConflict is returned when a record changed between reading and writing it
+	ErrConflict = errors.New("record was modified concurrently")
+
+	// ErrInUse is returned when a record can not be deleted because other records reference it
+	ErrInUse = errors.New("record is still referenced")
+)
+
+// The repositories of tenant data limit every operation to the organization of
+// the context, see package tenant. Records of another organization are
+// reported as ErrNotFound.
+
+// TaskRepository defines the storage operations needed by the task handlers
+type TaskRepository interface {
+	// Create stores a new task, defaulting its status to models.StatusCompleted,
+	// and records the initial status in the transition history. Completed tasks
+	// also queue a models.EventTaskPerformed message in the notification outbox,
+	// all in one transaction. A task with a known ID is rejected with ErrDuplicate.
+	//
+	// Create, Update, Delete and Transition queue the matching task event,
+	// attributed to the actor, in the events topic of the outbox as part of
+	// the same transaction.
+	Create(ctx context.Context, task *models.Task, actorID int64) error
+	// Get returns a task
+	Get(ctx context.Context, id string) (*models.Task, error)
+	// Owner returns the ID of the technician who performed the task
+	Owner(ctx context.Context, id string) (int64, error)
+	// Update changes the summary and performed date of a task owned by task.TechnicianID
+	Update(ctx context.Context, task *models.Task, actorID int64) error
+	// List returns one page of the tasks matching the filter
+	List(ctx context.Context, filter TaskFilter) (TaskPage, error)
+	// Exists reports whether a task with the given ID is stored
+	Exists(ctx context.Context, id string) (bool, error)
+	// Delete removes a task, queueing the blobs of its attachments for deletion
+	Delete(ctx context.Context, id string, actorID int64) error
+	// Transition moves a task from transition.From to transition.To and appends
+	// it to the history, returning ErrConflict when the task is no longer in
+	// transition.From. Completing a task queues a models.EventTaskPerformed message.
+	Transition(ctx context.Context, transition *models.TaskTransition) error
+	// Transitions returns the status history of a task, oldest first
+	Transitions(ctx context.Context, taskID string) ([]models.TaskTransition, error)
+}
+
+// CommentRepository defines the storage operations needed by the task comment handlers
+type CommentRepository interface {
+	// Create stores a new comment on comment.TaskID and sets its ID, creation
+	// time and author name. When it mentions users a
+	// models.EventCommentMentioned message is queued in the same transaction.
+	// An unknown task is reported as ErrNotFound.
+	Create(ctx context.Context, comment *models.TaskComment) error
+	// Get returns a comment of a task
+	Get(ctx context.Context, taskID string, id int64) (*models.TaskComment, error)
+	// List returns the comments of a task, oldest first
+	List(ctx context.Context, taskID string) ([]models.TaskComment, error)
+	// Update replaces the body and mentions of a comment and sets its EditedAt,
+	// keeping the previous body as a revision. Users mentioned for the first
+	// time are notified like in Create.
+	Update(ctx context.Context, comment *models.TaskComment) error
+	// Revisions returns the previous bodies of a comment, oldest first
+	Revisions(ctx context.Context, taskID string, id int64) ([]models.TaskCommentRevision, error)
+	// Delete removes a comment and its revisions
+	Delete(ctx context.Context, taskID string, id int64) error
+}
+
+// AttachmentRepository defines the storage operations needed by the task
+// attachment handlers. The content of attachments is kept in a blob store,
+// the blobs of removed attachments are queued for deletion.
+type AttachmentRepository interface {
+	// Create stores a new attachment of attachment.TaskID and sets its
+	// creation time. An unknown task is reported as ErrNotFound.
+	Create(ctx context.Context, attachment *models.Attachment) error
+	// Get returns an attachment of a task
+	Get(ctx context.Context, taskID, id string) (*models.Attachment, error)
+	// List returns the attachments of a task, oldest first
+	List(ctx context.Context, taskID string) ([]models.Attachment, error)
+	// Delete removes an attachment of a task and queues its blobs for
+	// deletion in the same transaction. Deleting a task queues the blobs of
+	// its attachments the same way.
+	Delete(ctx context.Context, taskID, id string) error
+	// PendingBlobDeletions returns up to limit keys of queued blobs, oldest first
+	PendingBlobDeletions(ctx context.Context, limit int) ([]string, error)
+	// ForgetBlobDeletions removes keys from the queue once their blobs are deleted
+	ForgetBlobDeletions(ctx context.Context, keys []string) error
+}
+
+// AssetRepository defines the storage operations needed by the asset handlers
+type AssetRepository interface {
+	// Create stores a new asset and sets its ID, returning ErrDuplicate for a known serial number
+	Create(ctx context.Context, asset *models.Asset) error
+	// Get returns an asset
+	Get(ctx context.Context, id int64) (*models.Asset, error)
+	// List returns every asset ordered by ID
+	List(ctx context.Context) ([]models.Asset, error)
+	// Update changes every field of an asset but its ID and timestamps
+	Update(ctx context.Context, asset *models.Asset) error
+	// Exists reports whether an asset with the given ID is stored
+	Exists(ctx context.Context, id int64) (bool, error)
+	// Delete removes an asset, returning ErrInUse while tasks reference it
+	Delete(ctx context.Context, id int64) error
+}
+
+// ScheduleRepository defines the storage operations needed by the schedule handlers and the scheduler
+type ScheduleRepository interface {
+	// Create stores a new schedule and sets its ID
+	Create(ctx context.Context, schedule *models.Schedule) error
+	// Get returns a schedule
+	Get(ctx context.Context, id int64) (*models.Schedule, error)
+	// List returns every schedule ordered by ID
+	List(ctx context.Context) ([]models.Schedule, error)
+	// ListActive returns the active schedules ordered by ID
+	ListActive(ctx context.Context) ([]models.Schedule, error)
+	// Update changes the definition of a schedule. MaterializedUntil is only
+	// ever moved forward, to schedule.MaterializedUntil when that is later.
+	Update(ctx context.Context, schedule *models.Schedule) error
+	// Advance moves MaterializedUntil from from to to, returning ErrConflict
+	// when another scheduler advanced it first
+	Advance(ctx context.Context, id int64, from, to time.Time) error
+	// Delete removes a schedule, the tasks it created are kept
+	Delete(ctx context.Context, id int64) error
+}
+
+// UserRepository defines the storage operations needed by the auth and user handlers
+type UserRepository interface {
+	// Create stores a new active user and sets its ID, returning ErrDuplicate for a known username
+	Create(ctx context.Context, user *models.User) error
+	// GetByUsername returns the user with the given username
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// GetByID returns the user with the given ID
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	// ListByRole returns every active user with the given role
+	ListByRole(ctx context.Context, role models.Role) ([]models.User, error)
+	// List returns every user ordered by ID
+	List(ctx context.Context) ([]models.User, error)
+	// UpdateRole changes the role of a user
+	UpdateRole(ctx context.Context, id uint, role models.Role) error
+	// SetActive deactivates or reactivates a user
+	SetActive(ctx context.Context, id uint, active bool) error
+	// UpdatePassword replaces the bcrypt hash of the password of a user
+	UpdatePassword(ctx context.Context, id uint, passwordHash string) error
+	// IsActive reports whether a user exists and is active
+	IsActive(ctx context.Context, id uint) (bool, error)
+	// Delete removes a user, returning ErrInUse while tasks or schedules reference it
+	Delete(ctx context.Context, id uint) error
+}
+
+// OrganizationRepository stores the organizations hosted on the deployment
+type OrganizationRepository interface {
+	// Create stores a new organization and sets its ID, returning ErrDuplicate for a known slug
+	Create(ctx context.Context, organization *models.Organization) error
+	// Get returns the organization with the given ID
+	Get(ctx context.Context, id int64) (*models.Organization, error)
+	// GetBySlug returns the organization with the given slug
+	GetBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	// UpdateSettings replaces the settings of an organization
+	UpdateSettings(ctx context.Context, id int64, settings models.OrganizationSettings) error
+}
+
+// InvitationRepository stores the invitations users register with
+type InvitationRepository interface {
+	// Create stores a new invitation and sets its ID
+	Create(ctx context.Context, invitation *models.Invitation) error
+	// Get returns the invitation with the given ID
+	Get(ctx context.Context, id int64) (*models.Invitation, error)
+	// GetByTokenID returns the invitation issued with the token with the given jti
+	GetByTokenID(ctx context.Context, tokenID string) (*models.Invitation, error)
+	// List returns every invitation ordered by ID
+	List(ctx context.Context) ([]models.Invitation, error)
+	// Revoke revokes a pending invitation, returning ErrConflict when it was
+	// already accepted or revoked
+	Revoke(ctx context.Context, id int64) error
+	// Accept creates the user and marks the invitation as accepted in one
+	// step. It returns ErrConflict when the invitation is no longer pending
+	// and ErrDuplicate for a known username, leaving the invitation pending.
+	Accept(ctx context.Context, tokenID string, user *models.User) error
+}
+
+// TeamRepository stores teams and their members
+type TeamRepository interface {
+	// Create stores a new team and sets its ID, returning ErrDuplicate for a known name
+	Create(ctx context.Context, team *models.Team) error
+	// Get returns a team
+	Get(ctx context.Context, id int64) (*models.Team, error)
+	// List returns every team ordered by ID
+	List(ctx context.Context) ([]models.Team, error)
+	// Update renames a team or moves it under another parent
+	Update(ctx context.Context, team *models.Team) error
+	// Delete removes a team and its memberships, returning ErrInUse while it has sub-teams
+	Delete(ctx context.Context, id int64) error
+	// Members returns the members of a team ordered by user ID
+	Members(ctx context.Context, teamID int64) ([]models.TeamMember, error)
+	// SetMember adds a user to a team or changes their role in it
+	SetMember(ctx context.Context, member *models.TeamMember) error
+	// RemoveMember removes a user from a team
+	RemoveMember(ctx context.Context, teamID int64, userID uint) error
+	// ManagedUsers returns the IDs of the members of the teams the user
+	// manages and of their sub-teams
+	ManagedUsers(ctx context.Context, managerID uint) ([]int64, error)
+	// Managers returns the active users managing a team the user is a member
+	// of, or any team above it
+	Managers(ctx context.Context, userID uint) ([]models.User, error)
+}
+
+// PermissionRepository reads the permissions granted to each role
+type PermissionRepository interface {
+	// RolePermissions returns the permissions of every role that has any
+	RolePermissions(ctx context.Context) (map[models.Role][]models.Permission, error)
+}
+
+// TokenRepository stores refresh tokens and revoked access tokens
+type TokenRepository interface {
+	// CreateRefreshToken stores a new refresh token and sets its ID
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// GetRefreshToken returns the refresh token with the given hash
+	GetRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error)
+	// UseRefreshToken marks a refresh token as exchanged, returning ErrConflict
+	// when it was already exchanged or revoked
+	UseRefreshToken(ctx context.Context, id int64) error
+	// RevokeFamily revokes every refresh token of a family and the access
+	// tokens issued with them, terminating the session of the family
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeUser revokes every refresh token of a user and the access tokens
+	// issued with them, terminating every session of the user
+	RevokeUser(ctx context.Context, userID uint) error
+	// RevokeAccessToken rejects an access token until it expires
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsRevoked reports whether an access token was revoked, directly or with its family
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// PurgeExpired deletes refresh tokens, sessions and revocations that
+	// expired before the given time
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+
+	// CreateSession stores the session of a new login, whose ID is the family
+	// of its refresh tokens, and sets its timestamps
+	CreateSession(ctx context.Context, session *models.Session) error
+	// GetSession returns the session with the given ID, terminated or not
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	// ListSessions returns the active sessions of a user, the most recently
+	// seen first
+	ListSessions(ctx context.Context, userID uint) ([]models.Session, error)
+	// RenewSession records a refresh of the session from the given address and
+	// extends it to the expiry of the new refresh token
+	RenewSession(ctx context.Context, id, address string, expiresAt time.Time) error
+	// TouchSession records that an access token of the session was used at
+	// the given time
+	TouchSession(ctx context.Context, id string, at time.Time) error
+}
+
+// MFARepository stores the second factors of users: their TOTP enrollment
+// and recovery codes. Callers check the user is visible to them first.
+type MFARepository interface {
+	// GetTOTP returns the TOTP enrollment of a user, confirmed or not
+	GetTOTP(ctx context.Context, userID uint) (*models.TOTPEnrollment, error)
+	// StartTOTP stores a new unconfirmed enrollment, replacing an unconfirmed
+	// one. It returns ErrConflict when the user has a confirmed enrollment.
+	StartTOTP(ctx context.Context, enrollment *models.TOTPEnrollment) error
+	// ConfirmTOTP confirms a pending enrollment with the code of the given
+	// step and replaces the recovery codes of the user in one step. It returns
+	// ErrNotFound without an enrollment and ErrConflict when it is confirmed.
+	ConfirmTOTP(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records the step of an accepted code, returning ErrConflict
+	// when a code of that step or a later one was already accepted
+	UseTOTPStep(ctx context.Context, userID uint, step int64) error
+	// UseRecoveryCode marks an unused recovery code as used, returning
+	// ErrNotFound when the user has no such unused code
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error
+	// ReplaceRecoveryCodes replaces every recovery code of a user
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error
+	// RecoveryCodesLeft returns the number of unused recovery codes of a user
+	RecoveryCodesLeft(ctx context.Context, userID uint) (int, error)
+	// DeleteTOTP removes the enrollment and the recovery codes of a user
+	DeleteTOTP(ctx context.Context, userID uint) error
+}
+
+// PasswordResetRepository stores the password reset tokens mailed to users
+type PasswordResetRepository interface {
+	// Create stores a new reset token and sets its ID
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	// Get returns the reset token with the given hash
+	Get(ctx context.Context, hash string) (*models.PasswordReset, error)
+	// Use marks a reset token and every other unused one of its user as used,
+	// returning ErrConflict when it was already used
+	Use(ctx context.Context, reset *models.PasswordReset) error
+	// CountActiveSince counts the unused, unexpired reset tokens of a user
+	// created at or after the given time
+	CountActiveSince(ctx context.Context, userID uint, since time.Time) (int, error)
+	// PurgeExpired deletes reset tokens that expired before the given time
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// APIKeyRepository stores the API keys of integrations
+type APIKeyRepository interface {
+	// Create stores a new API key and sets its ID, returning ErrDuplicate for a known prefix
+	Create(ctx context.Context, key *models.APIKey) error
+	// Get returns the API key with the given ID
+	Get(ctx context.Context, id int64) (*models.APIKey, error)
+	// GetByPrefix returns the API key with the given prefix
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// List returns every API key ordered by ID
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Revoke revokes an API key, returning ErrConflict when it was already revoked
+	Revoke(ctx context.Context, id int64) error
+	// Touch records that an API key was used at the given time
+	Touch(ctx context.Context, id int64, at time.Time) error
+}
+
+// IdentityRepository stores the OpenID Connect accounts linked to users
+type IdentityRepository interface {
+	// Create links an account to a user and sets its ID, returning
+	// ErrDuplicate when the account is linked already
+	Create(ctx context.Context, identity *models.Identity) error
+	// GetBySubject returns the account with the given issuer and subject
+	GetBySubject(ctx context.Context, issuer, subject string) (*models.Identity, error)
+	// Provision creates the user and links the account to it in one step. It
+	// returns ErrDuplicate for a known username or an account linked already.
+	Provision(ctx context.Context, identity *models.Identity, user *models.User) error
+}
+
+// LoginAttemptRepository counts consecutive failed logins per key, see
+// models.UsernameAttemptKey and models.AddressAttemptKey
+type LoginAttemptRepository interface {
+	// Get returns the failures counted for a key, ErrNotFound when there are none
+	Get(ctx context.Context, key string) (*models.LoginAttempts, error)
+	// RecordFailure counts a failed login at the given time. The count starts
+	// over when the previous failure is older than window.
+	RecordFailure(ctx context.Context, key string, at time.Time, window time.Duration) error
+	// Reserve counts an attempt at the given time as failed before it is
+	// checked, unless the failures counted so far lock the key out under
+	// policy. It then returns the time the key is locked until and counts
+	// nothing. Checking and counting are one step, so concurrent attempts
+	// can not all pass the check before any of them failed.
+	Reserve(ctx context.Context, key string, at time.Time, policy auth.LockoutPolicy) (time.Time, error)
+	// Release takes back an attempt counted by Reserve that did not fail
+	Release(ctx context.Context, key string) error
+	// Reset forgets the failures of a key
+	Reset(ctx context.Context, key string) error
+	// Purge deletes the keys whose last failure is older than before
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxRepository gives the notification dispatcher access to the transactional outbox
+type OutboxRepository interface {
+	// Claim returns up to limit messages of the topic that are due and hides
+	// them from other dispatchers for the lease duration
+	Claim(ctx context.Context, topic string, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	// MarkProcessed records that a message was dispatched
+	MarkProcessed(ctx context.Context, id int64) error
+	// MarkFailed records a failed attempt and schedules a retry after retryAfter
+	MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error
+	// MarkDiscarded gives up on a message that can not be dispatched
+	MarkDiscarded(ctx context.Context, id int64, reason string) error
+	// Deliveries returns the deliveries of a message recorded by earlier attempts
+	Deliveries(ctx context.Context, id int64) ([]models.OutboxDelivery, error)
+	// RecordDelivery records that a notification of a message was delivered,
+	// recording the same delivery twice is not an error
+	RecordDelivery(ctx context.Context, id int64, delivery models.OutboxDelivery) error
+}
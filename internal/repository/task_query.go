@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+)
+
+// TaskSort orders the tasks returned by TaskRepository.List
+type TaskSort string
+
+const (
+	// SortPerformedAtDesc lists the most recently performed tasks first
+	SortPerformedAtDesc TaskSort = "-performed_at"
+	// SortPerformedAtAsc lists the oldest tasks first
+	SortPerformedAtAsc TaskSort = "performed_at"
+)
+
+// Page sizes for TaskRepository.List
+const (
+	DefaultTaskLimit = 50
+	MaxTaskLimit     = 100
+)
+
+// ParseTaskSort validates a sort order, the empty string selects the default
+func ParseTaskSort(value string) (TaskSort, error) {
+	switch TaskSort(value) {
+	case "":
+		return SortPerformedAtDesc, nil
+	case SortPerformedAtDesc, SortPerformedAtAsc:
+		return TaskSort(value), nil
+	default:
+		return "", fmt.Errorf("unknown sort %q", value)
+	}
+}
+
+// TaskFilter narrows down and pages the tasks returned by TaskRepository.List
+type TaskFilter struct {
+	// TechnicianID restricts the result to a single technician when set
+	TechnicianID *int64
+	// TechnicianIDs restricts the result to the tasks of these technicians
+	// when not nil, an empty slice matches no task
+	TechnicianIDs []int64
+	// AssetID restricts the result to tasks performed on a single asset when set
+	AssetID *int64
+	// PerformedFrom and PerformedTo bound the performed date, both inclusive
+	PerformedFrom *time.Time
+	PerformedTo   *time.Time
+	// Status restricts the result to tasks in this status when set
+	Status models.TaskStatus
+	// Query keeps tasks whose summary or technician username contains it, ignoring case
+	Query string
+	// Sort defaults to SortPerformedAtDesc
+	Sort TaskSort
+	// Limit is the page size, DefaultTaskLimit when zero
+	Limit int
+	// Cursor continues a previous listing from its TaskPage.NextCursor
+	Cursor string
+
+	// organizationID limits the result to the tasks of the technicians of an
+	// organization, set by the repository from the context
+	organizationID int64
+}
+
+func (f TaskFilter) sort() TaskSort {
+	if f.Sort == "" {
+		return SortPerformedAtDesc
+	}
+	return f.Sort
+}
+
+func (f TaskFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultTaskLimit
+	}
+	return f.Limit
+}
+
+// TaskPage is one page of tasks. NextCursor is empty on the last page.
+type TaskPage struct {
+	Tasks      []models.TaskWithTechnician `json:"tasks"`
+	NextCursor string                      `json:"next_cursor,omitempty"`
+}
+
+// taskCursor is the position after the last task of a page. It is handed to
+// clients as opaque base64 JSON and only valid for the sort it was made for.
+type taskCursor struct {
+	Sort        TaskSort  `json:"s"`
+	PerformedAt time.Time `json:"p"`
+	ID          string    `json:"i"`
+}
+
+func encodeTaskCursor(sort TaskSort, task models.TaskWithTechnician) string {
+	data, _ := json.Marshal(taskCursor{Sort: sort, PerformedAt: task.PerformedAt, ID: task.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTaskCursor returns nil for an empty cursor
+func decodeTaskCursor(value string, sort TaskSort) (*taskCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// follows reports whether the task comes after the cursor position
+func (c *taskCursor) follows(task models.TaskWithTechnician) bool {
+	if c.Sort == SortPerformedAtAsc {
+		return task.PerformedAt.After(c.PerformedAt) || (task.PerformedAt.Equal(c.PerformedAt) && task.ID > c.ID)
+	}
+	return task.PerformedAt.Before(c.PerformedAt) || (task.PerformedAt.Equal(c.PerformedAt) && task.ID < c.ID)
+}
+
+// sortTasks orders tasks by performed date with the ID as tie breaker, like the SQL query
+func sortTasks(tasks []models.TaskWithTechnician, order TaskSort) {
+	sort.Slice(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if order == SortPerformedAtAsc {
+			return a.PerformedAt.Before(b.PerformedAt) || (a.PerformedAt.Equal(b.PerformedAt) && a.ID < b.ID)
+		}
+		return a.PerformedAt.After(b.PerformedAt) || (a.PerformedAt.Equal(b.PerformedAt) && a.ID > b.ID)
+	})
+}
+
+// matchesTechnicians implements the TaskFilter.TechnicianIDs restriction in process
+func matchesTechnicians(technicianID int64, ids []int64) bool {
+	if ids == nil {
+		return true
+	}
+	for _, id := range ids {
+		if id == technicianID {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesQuery implements the TaskFilter.Query text search in process
+func matchesQuery(task models.TaskWithTechnician, query string) bool {
+	query = strings.ToLower(query)
+	return strings.Contains(strings.ToLower(task.Summary), query) ||
+		strings.Contains(strings.ToLower(task.TechnicianName), query)
+}
+
+// newTaskPage cuts a result fetched with one extra row down to the page size
+// and derives the next cursor from whether that extra row exists
+func newTaskPage(tasks []models.TaskWithTechnician, sort TaskSort, limit int) TaskPage {
+	page := TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		page.NextCursor = encodeTaskCursor(sort, page.Tasks[limit-1])
+	}
+	if page.Tasks == nil {
+		page.Tasks = []models.TaskWithTechnician{}
+	}
+	return page
+}
+
+// buildTaskListQuery builds the SELECT behind MySQLTaskRepository.List.
+// searchInSQL is false when summaries are encrypted, in which case the text
+// search is left to the caller.
+func buildTaskListQuery(filter TaskFilter, cursor *taskCursor, searchInSQL bool, limit int) (string, []interface{}) {
+	query := `
+            SELECT t.id, t.summary,
+            DATE_FORMAT(t.performed_at, '%Y-%m-%d %H:%i:%s') as performed_at,
+            t.technician_id, t.asset_id, u.username,
+            t.summary_key_id, t.summary_wrapped_key, t.status
+            FROM tasks t
+            JOIN users u ON t.technician_id = u.id`
+
+	var conditions []string
+	var args []interface{}
+
+	if filter.organizationID != 0 {
+		conditions = append(conditions, "u.organization_id = ?")
+		args = append(args, filter.organizationID)
+	}
+	if filter.TechnicianID != nil {
+		conditions = append(conditions, "t.technician_id = ?")
+		args = append(args, *filter.TechnicianID)
+	}
+	if filter.TechnicianIDs != nil {
+		if len(filter.TechnicianIDs) == 0 {
+			conditions = append(conditions, "FALSE")
+		} else {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.TechnicianIDs)), ", ")
+			conditions = append(conditions, "t.technician_id IN ("+placeholders+")")
+			for _, id := range filter.TechnicianIDs {
+				args = append(args, id)
+			}
+		}
+	}
+	if filter.AssetID != nil {
+		conditions = append(conditions, "t.asset_id = ?")
+		args = append(args, *filter.AssetID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "t.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.PerformedFrom != nil {
+		conditions = append(conditions, "t.performed_at >= ?")
+		args = append(args, filter.PerformedFrom.UTC())
+	}
+	if filter.PerformedTo != nil {
+		conditions = append(conditions, "t.performed_at <= ?")
+		args = append(args, filter.PerformedTo.UTC())
+	}
+	if filter.Query != "" && searchInSQL {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		conditions = append(conditions, "(t.summary LIKE ? OR u.username LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+
+	order := "DESC"
+	comparison := "<"
+	if filter.sort() == SortPerformedAtAsc {
+		order = "ASC"
+		comparison = ">"
+	}
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(t.performed_at %[1]s ? OR (t.performed_at = ? AND t.id %[1]s ?))", comparison))
+		performedAt := cursor.PerformedAt.UTC()
+		args = append(args, performedAt, performedAt, cursor.ID)
+	}
+
+	if len(conditions) > 0 {
+		query += `
+            WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(`
+            ORDER BY t.performed_at %[1]s, t.id %[1]s
+            LIMIT ?`, order)
+	args = append(args, limit)
+
+	return query, args
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied search term
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
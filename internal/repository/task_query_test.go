@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTaskListQuery(t *testing.T) {
+	from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)
+	technicianID := int64(7)
+
+	t.Run("no filters", func(t *testing.T) {
+		query, args := buildTaskListQuery(TaskFilter{}, nil, true, 51)
+		assert.NotContains(t, query, "WHERE")
+		assert.Contains(t, query, "ORDER BY t.performed_at DESC, t.id DESC")
+		assert.Equal(t, []interface{}{51}, args)
+	})
+
+	t.Run("every filter", func(t *testing.T) {
+		filter := TaskFilter{
+			TechnicianID:  &technicianID,
+			PerformedFrom: &from,
+			PerformedTo:   &to,
+			Query:         "50%_off",
+			Sort:          SortPerformedAtAsc,
+		}
+		query, args := buildTaskListQuery(filter, nil, true, 11)
+
+		assert.Contains(t, query, "WHERE t.technician_id = ? AND t.performed_at >= ? AND t.performed_at <= ? AND (t.summary LIKE ? OR u.username LIKE ?)")
+		assert.Contains(t, query, "ORDER BY t.performed_at ASC, t.id ASC")
+		assert.Equal(t, []interface{}{technicianID, from, to, `%50\%\_off%`, `%50\%\_off%`, 11}, args)
+	})
+
+	t.Run("status filter", func(t *testing.T) {
+		query, args := buildTaskListQuery(TaskFilter{Status: models.StatusScheduled}, nil, true, 51)
+		assert.Contains(t, query, "WHERE t.status = ?")
+		assert.Equal(t, []interface{}{models.StatusScheduled, 51}, args)
+	})
+
+	t.Run("team filter", func(t *testing.T) {
+		query, args := buildTaskListQuery(TaskFilter{TechnicianIDs: []int64{3, 5}}, nil, true, 51)
+		assert.Contains(t, query, "WHERE t.technician_id IN (?, ?)")
+		assert.Equal(t, []interface{}{int64(3), int64(5), 51}, args)
+
+		// A manager without a team sees no task rather than every task
+		query, args = buildTaskListQuery(TaskFilter{TechnicianIDs: []int64{}}, nil, true, 51)
+		assert.Contains(t, query, "WHERE FALSE")
+		assert.Equal(t, []interface{}{51}, args)
+	})
+
+	t.Run("organization filter", func(t *testing.T) {
+		query, args := buildTaskListQuery(TaskFilter{TechnicianID: &technicianID, organizationID: 2}, nil, true, 51)
+		assert.Contains(t, query, "WHERE u.organization_id = ? AND t.technician_id = ?")
+		assert.Equal(t, []interface{}{int64(2), technicianID, 51}, args)
+	})
+
+	t.Run("text search is skipped when summaries are encrypted", func(t *testing.T) {
+		query, args := buildTaskListQuery(TaskFilter{Query: "pump"}, nil, false, 51)
+		assert.NotContains(t, query, "LIKE")
+		assert.Equal(t, []interface{}{51}, args)
+	})
+
+	t.Run("cursor continues after the last row", func(t *testing.T) {
+		cursor := &taskCursor{Sort: SortPerformedAtDesc, PerformedAt: from, ID: "task1"}
+		query, args := buildTaskListQuery(TaskFilter{TechnicianID: &technicianID}, cursor, true, 51)
+		assert.Contains(t, query, "t.technician_id = ? AND (t.performed_at < ? OR (t.performed_at = ? AND t.id < ?))")
+		assert.Equal(t, []interface{}{technicianID, from, from, "task1", 51}, args)
+
+		cursor.Sort = SortPerformedAtAsc
+		query, _ = buildTaskListQuery(TaskFilter{Sort: SortPerformedAtAsc}, cursor, true, 51)
+		assert.Contains(t, query, "(t.performed_at > ? OR (t.performed_at = ? AND t.id > ?))")
+	})
+}
+
+func TestTaskCursor(t *testing.T) {
+	task := models.TaskWithTechnician{Task: models.Task{ID: "task1", PerformedAt: time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)}}
+
+	encoded := encodeTaskCursor(SortPerformedAtAsc, task)
+	assert.False(t, strings.ContainsAny(encoded, "+/="), "cursor must be URL safe")
+
+	cursor, err := decodeTaskCursor(encoded, SortPerformedAtAsc)
+	assert.NoError(t, err)
+	assert.Equal(t, "task1", cursor.ID)
+	assert.True(t, task.PerformedAt.Equal(cursor.PerformedAt))
+
+	_, err = decodeTaskCursor(encoded, SortPerformedAtDesc)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "cursor of another sort")
+
+	_, err = decodeTaskCursor("%%%", SortPerformedAtAsc)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	cursor, err = decodeTaskCursor("", SortPerformedAtAsc)
+	assert.NoError(t, err)
+	assert.Nil(t, cursor)
+}
+
+func TestParseTaskSort(t *testing.T) {
+	sort, err := ParseTaskSort("")
+	assert.NoError(t, err)
+	assert.Equal(t, SortPerformedAtDesc, sort)
+
+	sort, err = ParseTaskSort("performed_at")
+	assert.NoError(t, err)
+	assert.Equal(t, SortPerformedAtAsc, sort)
+
+	_, err = ParseTaskSort("summary")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+)
+
+// organizationFor returns the organization a new record is stored in: id
+// when set, else the organization of the context, else the default one
+func organizationFor(ctx context.Context, id int64) int64 {
+	if id != 0 {
+		return id
+	}
+	if orgID, ok := tenant.Organization(ctx); ok {
+		return orgID
+	}
+	return models.DefaultOrganizationID
+}
+
+// visible reports whether a record of the organization can be seen from ctx
+func visible(ctx context.Context, organizationID int64) bool {
+	orgID, ok := tenant.Organization(ctx)
+	return !ok || orgID == organizationID
+}
+
+// inOrganization limits a query to the organization of the context by
+// returning " AND column = ?" and its argument, or nothing for callers
+// without an organization
+func inOrganization(ctx context.Context, column string) (string, []interface{}) {
+	orgID, ok := tenant.Organization(ctx)
+	if !ok {
+		return "", nil
+	}
+	return " AND " + column + " = ?", []interface{}{orgID}
+}
+
+// whereOrganization is inOrganization for queries without other conditions
+func whereOrganization(ctx context.Context, column string) (string, []interface{}) {
+	orgID, ok := tenant.Organization(ctx)
+	if !ok {
+		return "", nil
+	}
+	return " WHERE " + column + " = ?", []interface{}{orgID}
+}
+
+// technicianInOrganization limits a query on tasks or schedules to those
+// whose technician, in column, belongs to the organization of the context
+func technicianInOrganization(ctx context.Context, column string) (string, []interface{}) {
+	orgID, ok := tenant.Organization(ctx)
+	if !ok {
+		return "", nil
+	}
+	return " AND " + column + " IN (SELECT id FROM users WHERE organization_id = ?)", []interface{}{orgID}
+}
+
+// taskInOrganization limits a query on records that belong to a task, whose
+// ID is in column, to the tasks of the organization of the context
+func taskInOrganization(ctx context.Context, column string) (string, []interface{}) {
+	orgID, ok := tenant.Organization(ctx)
+	if !ok {
+		return "", nil
+	}
+	return " AND " + column + " IN (SELECT tasks.id FROM tasks JOIN users ON users.id = tasks.technician_id WHERE users.organization_id = ?)",
+		[]interface{}{orgID}
+}
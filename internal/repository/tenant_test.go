@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/tenant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRepositoriesTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	tasks := NewMemoryTaskRepository(users)
+	assets := NewMemoryAssetRepository(tasks)
+	schedules := NewMemoryScheduleRepository(users)
+	teams := NewMemoryTeamRepository(users)
+	invitations := NewMemoryInvitationRepository(users)
+
+	acme := tenant.WithOrganization(ctx, 1)
+	globex := tenant.WithOrganization(ctx, 2)
+
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(acme, &tech))
+	assert.Equal(t, int64(1), tech.OrganizationID)
+	other := models.User{Username: "tech2", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(globex, &other))
+	assert.Equal(t, int64(2), other.OrganizationID)
+
+	task := models.Task{ID: "task1", TechnicianID: int64(tech.ID), PerformedAt: time.Now()}
+	assert.NoError(t, tasks.Create(acme, &task, task.TechnicianID))
+	asset := models.Asset{SerialNumber: "PUMP-1", Type: "pump"}
+	assert.NoError(t, assets.Create(acme, &asset))
+	schedule := models.Schedule{Summary: "Inspect", TechnicianID: int64(tech.ID), Active: true}
+	assert.NoError(t, schedules.Create(acme, &schedule))
+	team := models.Team{Name: "Crew"}
+	assert.NoError(t, teams.Create(acme, &team))
+	invitation := models.Invitation{TokenID: "jti-1", Role: models.RoleTechnician, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, invitations.Create(acme, &invitation))
+
+	t.Run("another organization sees nothing", func(t *testing.T) {
+		_, err := users.GetByID(globex, tech.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		listedUsers, _ := users.List(globex)
+		assert.Len(t, listedUsers, 1)
+		assert.ErrorIs(t, users.SetActive(globex, tech.ID, false), ErrNotFound)
+		assert.ErrorIs(t, users.Delete(globex, tech.ID), ErrNotFound)
+
+		_, err = tasks.Get(globex, task.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		exists, _ := tasks.Exists(globex, task.ID)
+		assert.False(t, exists)
+		page, _ := tasks.List(globex, TaskFilter{})
+		assert.Empty(t, page.Tasks)
+		assert.ErrorIs(t, tasks.Update(globex, &models.Task{ID: task.ID, TechnicianID: int64(other.ID)}, int64(other.ID)), ErrNotFound)
+		assert.ErrorIs(t, tasks.Delete(globex, task.ID, 1), ErrNotFound)
+
+		_, err = assets.Get(globex, asset.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, assets.Delete(globex, asset.ID), ErrNotFound)
+		_, err = schedules.Get(globex, schedule.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		listedSchedules, _ := schedules.List(globex)
+		assert.Empty(t, listedSchedules)
+		_, err = teams.Get(globex, team.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, teams.SetMember(globex, &models.TeamMember{TeamID: team.ID, UserID: other.ID, Role: models.TeamRoleMember}), ErrNotFound)
+		assert.ErrorIs(t, invitations.Revoke(globex, invitation.ID), ErrNotFound)
+	})
+
+	t.Run("records are unique per organization", func(t *testing.T) {
+		assert.NoError(t, assets.Create(globex, &models.Asset{SerialNumber: "PUMP-1", Type: "pump"}))
+		assert.NoError(t, teams.Create(globex, &models.Team{Name: "Crew"}))
+		assert.ErrorIs(t, teams.Create(globex, &models.Team{Name: "Sub", ParentID: &team.ID}), ErrNotFound)
+	})
+
+	t.Run("invitations register into their organization", func(t *testing.T) {
+		user := models.User{Username: "invited", Role: models.RoleTechnician}
+		assert.NoError(t, invitations.Accept(ctx, "jti-1", &user))
+		assert.Equal(t, int64(1), user.OrganizationID)
+	})
+
+	t.Run("callers without an organization see every tenant", func(t *testing.T) {
+		listedUsers, _ := users.List(ctx)
+		assert.Len(t, listedUsers, 3)
+		listedAssets, _ := assets.List(ctx)
+		assert.Len(t, listedAssets, 2)
+		active, _ := schedules.ListActive(ctx)
+		assert.Len(t, active, 1)
+	})
+}
+
+func TestMemoryOrganizationRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrganizationRepository()
+
+	organization, err := repo.GetBySlug(ctx, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultOrganizationID, organization.ID)
+	assert.True(t, organization.Settings.OpenRegistration)
+
+	globex := models.Organization{Slug: "globex", Name: "Globex"}
+	assert.NoError(t, repo.Create(ctx, &globex))
+	assert.Equal(t, int64(2), globex.ID)
+	assert.ErrorIs(t, repo.Create(ctx, &models.Organization{Slug: "globex"}), ErrDuplicate)
+
+	settings := models.OrganizationSettings{DefaultTimezone: "Europe/Madrid"}
+	assert.NoError(t, repo.UpdateSettings(ctx, globex.ID, settings))
+	stored, err := repo.Get(ctx, globex.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, settings, stored.Settings)
+	assert.ErrorIs(t, repo.UpdateSettings(ctx, 99, settings), ErrNotFound)
+}
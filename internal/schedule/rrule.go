@@ -0,0 +1,330 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRULE frequencies
+const (
+	freqDaily   = "DAILY"
+	freqWeekly  = "WEEKLY"
+	freqMonthly = "MONTHLY"
+	freqYearly  = "YEARLY"
+)
+
+// maxEmptyPeriods stops the search for rules whose filters never match
+const maxEmptyPeriods = 2000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// rrule implements the subset of RFC 5545 recurrence rules useful for
+// maintenance: FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL,
+// BYMONTH, BYMONTHDAY (negative values count from the end of the month),
+// BYDAY (weekdays without ordinals), BYHOUR and BYMINUTE. Unset parts are taken
+// from the start time, which is the first period and DTSTART of the rule.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []time.Weekday
+	byHour     []int
+	byMinute   []int
+	start      time.Time
+	loc        *time.Location
+}
+
+func parseRRule(expr string, start time.Time, loc *time.Location) (*rrule, error) {
+	rule := &rrule{interval: 1, start: start, loc: loc}
+	for _, part := range strings.Split(expr, ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch name {
+		case "FREQ":
+			switch value {
+			case freqDaily, freqWeekly, freqMonthly, freqYearly:
+				rule.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(value)
+			if err == nil && rule.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(value)
+			if err == nil && rule.count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			rule.until, err = parseUntil(value, loc)
+		case "BYMONTH":
+			rule.byMonth, err = parseIntList(value, 1, 12, false)
+		case "BYMONTHDAY":
+			rule.byMonthDay, err = parseIntList(value, 1, 31, true)
+		case "BYHOUR":
+			rule.byHour, err = parseIntList(value, 0, 23, false)
+		case "BYMINUTE":
+			rule.byMinute, err = parseIntList(value, 0, 59, false)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY: unsupported day %q", day)
+				}
+				rule.byDay = append(rule.byDay, weekday)
+			}
+		case "WKST":
+			// Weeks always start on Monday
+			if value != "MO" {
+				err = fmt.Errorf("only MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if rule.freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if rule.count > 0 && !rule.until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL are mutually exclusive")
+	}
+	if rule.freq == freqWeekly && len(rule.byMonthDay) > 0 {
+		return nil, fmt.Errorf("BYMONTHDAY is not allowed with FREQ=WEEKLY")
+	}
+	sort.Ints(rule.byHour)
+	sort.Ints(rule.byMinute)
+	return rule, nil
+}
+
+// parseUntil accepts the UTC, floating and date forms of an RRULE UNTIL
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("20060102", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	// A date includes the whole day
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+func parseIntList(value string, min, max int, allowNegative bool) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(part)
+		abs := n
+		if allowNegative && n < 0 {
+			abs = -n
+		}
+		if err != nil || abs < min || abs > max {
+			return nil, fmt.Errorf("invalid value %q", part)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// Next returns the first occurrence strictly after the given time
+func (r *rrule) Next(after time.Time) time.Time {
+	period := 0
+	seen := 0
+	// Without COUNT there is nothing to count, so skip the periods before after
+	if r.count == 0 {
+		period = r.periodsBefore(after)
+	}
+
+	for empty := 0; empty < maxEmptyPeriods; period++ {
+		occurrences := r.expand(period)
+		if len(occurrences) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		for _, occurrence := range occurrences {
+			if !r.until.IsZero() && occurrence.After(r.until) {
+				return time.Time{}
+			}
+			seen++
+			if occurrence.After(after) {
+				return occurrence
+			}
+			if r.count > 0 && seen >= r.count {
+				return time.Time{}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// periodsBefore returns the index of a period that starts no later than the given time
+func (r *rrule) periodsBefore(t time.Time) int {
+	if !t.After(r.start) {
+		return 0
+	}
+	t = t.In(r.loc)
+
+	var elapsed int
+	switch r.freq {
+	case freqDaily:
+		elapsed = civilDays(r.start, t)
+	case freqWeekly:
+		elapsed = civilDays(weekStart(r.start), t) / 7
+	case freqMonthly:
+		elapsed = (t.Year()-r.start.Year())*12 + int(t.Month()-r.start.Month())
+	case freqYearly:
+		elapsed = t.Year() - r.start.Year()
+	}
+	period := elapsed/r.interval - 1
+	if period < 0 {
+		return 0
+	}
+	return period
+}
+
+// expand returns the sorted occurrences of the given period that are not before the start
+func (r *rrule) expand(period int) []time.Time {
+	var first, end time.Time
+	y, m, d := r.start.Date()
+	step := period * r.interval
+	switch r.freq {
+	case freqDaily:
+		first = time.Date(y, m, d+step, 0, 0, 0, 0, time.UTC)
+		end = first.AddDate(0, 0, 1)
+	case freqWeekly:
+		monday := weekStart(r.start)
+		first = time.Date(monday.Year(), monday.Month(), monday.Day()+7*step, 0, 0, 0, 0, time.UTC)
+		end = first.AddDate(0, 0, 7)
+	case freqMonthly:
+		first = time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		end = first.AddDate(0, 1, 0)
+	case freqYearly:
+		first = time.Date(y+step, 1, 1, 0, 0, 0, 0, time.UTC)
+		end = first.AddDate(1, 0, 0)
+	}
+
+	hours := r.byHour
+	if len(hours) == 0 {
+		hours = []int{r.start.Hour()}
+	}
+	minutes := r.byMinute
+	if len(minutes) == 0 {
+		minutes = []int{r.start.Minute()}
+	}
+
+	var occurrences []time.Time
+	for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !r.dayMatches(day) {
+			continue
+		}
+		for _, hour := range hours {
+			for _, minute := range minutes {
+				occurrence := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, r.start.Second(), 0, r.loc)
+				if !occurrence.Before(r.start) {
+					occurrences = append(occurrences, occurrence)
+				}
+			}
+		}
+	}
+	return occurrences
+}
+
+// dayMatches applies the BY* filters to a civil date. When no day is given,
+// the day is taken from the start as the frequency implies.
+func (r *rrule) dayMatches(day time.Time) bool {
+	if len(r.byMonth) > 0 && !containsInt(r.byMonth, int(day.Month())) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 && !r.monthDayMatches(day) {
+		return false
+	}
+	if len(r.byDay) > 0 && !containsWeekday(r.byDay, day.Weekday()) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 || len(r.byDay) > 0 {
+		return true
+	}
+
+	switch r.freq {
+	case freqWeekly:
+		return day.Weekday() == r.start.Weekday()
+	case freqMonthly:
+		return day.Day() == r.start.Day()
+	case freqYearly:
+		if len(r.byMonth) == 0 && day.Month() != r.start.Month() {
+			return false
+		}
+		return day.Day() == r.start.Day()
+	}
+	return true
+}
+
+func (r *rrule) monthDayMatches(day time.Time) bool {
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, monthDay := range r.byMonthDay {
+		if monthDay < 0 {
+			monthDay = daysInMonth + monthDay + 1
+		}
+		if monthDay == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// civilDays returns the number of calendar days from a to b
+func civilDays(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return int(time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC).Sub(time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// weekStart returns the Monday of the week containing t
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWeekday(values []time.Weekday, v time.Weekday) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+// Package schedule turns recurring maintenance schedules into tasks.
+package schedule
+
+import (
+	"strings"
+	"time"
+)
+
+// maxSearch bounds how far ahead a rule looks for its next occurrence, so
+// rules that can never match (like February 30th) terminate
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Rule is a recurrence rule
+type Rule interface {
+	// Next returns the first occurrence strictly after the given time, or the
+	// zero time when the rule has no further occurrences
+	Next(after time.Time) time.Time
+}
+
+// ParseRule parses either a five-field cron expression ("0 8 * * MON") or an
+// RFC 5545 RRULE ("FREQ=WEEKLY;BYDAY=MO;BYHOUR=8"). Occurrences are evaluated
+// in loc and never fall before start, which also anchors RRULE intervals.
+func ParseRule(expr string, start time.Time, loc *time.Location) (Rule, error) {
+	expr = strings.TrimSpace(expr)
+	upper := strings.ToUpper(expr)
+	if strings.HasPrefix(upper, "RRULE:") || strings.HasPrefix(upper, "FREQ=") || strings.Contains(upper, ";FREQ=") {
+		return parseRRule(strings.TrimPrefix(upper, "RRULE:"), start.In(loc), loc)
+	}
+	return parseCron(expr, start, loc)
+}
+
+// Occurrences returns up to n occurrences of rule strictly after the given
+// time, stopping at endsAt when it is set
+func Occurrences(rule Rule, after time.Time, endsAt *time.Time, n int) []time.Time {
+	occurrences := []time.Time{}
+	for len(occurrences) < n {
+		next := rule.Next(after)
+		if next.IsZero() || (endsAt != nil && next.After(*endsAt)) {
+			break
+		}
+		occurrences = append(occurrences, next)
+		after = next
+	}
+	return occurrences
+}
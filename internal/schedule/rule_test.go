@@ -0,0 +1,134 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, expr string, start time.Time, loc *time.Location) Rule {
+	t.Helper()
+	rule, err := ParseRule(expr, start, loc)
+	if err != nil {
+		t.Fatalf("ParseRule(%q): %v", expr, err)
+	}
+	return rule
+}
+
+func formatAll(times []time.Time) []string {
+	formatted := make([]string, len(times))
+	for i, t := range times {
+		formatted[i] = t.Format("2006-01-02 15:04 Mon")
+	}
+	return formatted
+}
+
+func TestCronRule(t *testing.T) {
+	// Wednesday
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"0 8 * * MON-FRI", []string{"2025-01-01 08:00 Wed", "2025-01-02 08:00 Thu", "2025-01-03 08:00 Fri", "2025-01-06 08:00 Mon"}},
+		{"*/30 9-10 * * *", []string{"2025-01-01 09:00 Wed", "2025-01-01 09:30 Wed", "2025-01-01 10:00 Wed", "2025-01-01 10:30 Wed"}},
+		{"0 6 1 */3 *", []string{"2025-01-01 06:00 Wed", "2025-04-01 06:00 Tue", "2025-07-01 06:00 Tue", "2025-10-01 06:00 Wed"}},
+		{"@monthly", []string{"2025-01-01 00:00 Wed", "2025-02-01 00:00 Sat", "2025-03-01 00:00 Sat", "2025-04-01 00:00 Tue"}},
+		// A restricted day of month and day of week match when either does
+		{"0 12 15 * 7", []string{"2025-01-05 12:00 Sun", "2025-01-12 12:00 Sun", "2025-01-15 12:00 Wed", "2025-01-19 12:00 Sun"}},
+		{"0 0 29 2 *", []string{"2028-02-29 00:00 Tue", "2032-02-29 00:00 Sun", "2036-02-29 00:00 Fri", "2040-02-29 00:00 Wed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule := mustParse(t, tt.expr, start, time.UTC)
+			assert.Equal(t, tt.want, formatAll(Occurrences(rule, start.Add(-time.Minute), nil, 4)))
+		})
+	}
+
+	t.Run("occurrences are strictly after and never before the start", func(t *testing.T) {
+		rule := mustParse(t, "0 8 * * *", start, time.UTC)
+		first := rule.Next(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		assert.Equal(t, time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), first)
+		assert.Equal(t, time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC), rule.Next(first))
+	})
+
+	t.Run("evaluated in the schedule time zone across DST", func(t *testing.T) {
+		berlin, err := time.LoadLocation("Europe/Berlin")
+		if err != nil {
+			t.Skip("time zone database not available")
+		}
+		rule := mustParse(t, "30 2 * * *", start, berlin)
+		// 02:30 does not exist on 2025-03-30 in Berlin
+		occurrences := Occurrences(rule, time.Date(2025, 3, 28, 12, 0, 0, 0, berlin), nil, 3)
+		assert.Equal(t, []string{"2025-03-29 02:30 Sat", "2025-03-31 02:30 Mon", "2025-04-01 02:30 Tue"}, formatAll(occurrences))
+		assert.Equal(t, 0, occurrences[1].UTC().Hour(), "CEST is UTC+2")
+	})
+
+	t.Run("never matching", func(t *testing.T) {
+		rule := mustParse(t, "0 0 30 2 *", start, time.UTC)
+		assert.True(t, rule.Next(start).IsZero())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * * FOO"} {
+			_, err := ParseRule(expr, start, time.UTC)
+			assert.Error(t, err, expr)
+		}
+	})
+}
+
+func TestRRule(t *testing.T) {
+	// Wednesday 09:15
+	start := time.Date(2025, 1, 1, 9, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"FREQ=DAILY", []string{"2025-01-01 09:15 Wed", "2025-01-02 09:15 Thu", "2025-01-03 09:15 Fri", "2025-01-04 09:15 Sat"}},
+		{"RRULE:FREQ=DAILY;INTERVAL=10;BYHOUR=7;BYMINUTE=0", []string{"2025-01-11 07:00 Sat", "2025-01-21 07:00 Tue", "2025-01-31 07:00 Fri", "2025-02-10 07:00 Mon"}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", []string{"2025-01-03 09:15 Fri", "2025-01-13 09:15 Mon", "2025-01-17 09:15 Fri", "2025-01-27 09:15 Mon"}},
+		{"FREQ=WEEKLY", []string{"2025-01-01 09:15 Wed", "2025-01-08 09:15 Wed", "2025-01-15 09:15 Wed", "2025-01-22 09:15 Wed"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;BYHOUR=17;BYMINUTE=0", []string{"2025-01-31 17:00 Fri", "2025-02-28 17:00 Fri", "2025-03-31 17:00 Mon", "2025-04-30 17:00 Wed"}},
+		{"FREQ=MONTHLY;INTERVAL=6", []string{"2025-01-01 09:15 Wed", "2025-07-01 09:15 Tue", "2026-01-01 09:15 Thu", "2026-07-01 09:15 Wed"}},
+		{"FREQ=YEARLY;BYMONTH=3,9;BYMONTHDAY=15", []string{"2025-03-15 09:15 Sat", "2025-09-15 09:15 Mon", "2026-03-15 09:15 Sun", "2026-09-15 09:15 Tue"}},
+		{"FREQ=DAILY;COUNT=2", []string{"2025-01-01 09:15 Wed", "2025-01-02 09:15 Thu"}},
+		{"FREQ=WEEKLY;UNTIL=20250115", []string{"2025-01-01 09:15 Wed", "2025-01-08 09:15 Wed", "2025-01-15 09:15 Wed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule := mustParse(t, tt.expr, start, time.UTC)
+			assert.Equal(t, tt.want, formatAll(Occurrences(rule, start.Add(-time.Second), nil, 4)))
+		})
+	}
+
+	t.Run("skipping ahead keeps the interval phase", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=WEEKLY;INTERVAL=3", start, time.UTC)
+		after := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+		next := rule.Next(after)
+		assert.True(t, next.After(after))
+		assert.Equal(t, 0, civilDays(start, next)%21)
+		assert.True(t, next.Sub(after) <= 21*24*time.Hour)
+	})
+
+	t.Run("count is exhausted", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=MONTHLY;COUNT=3", start, time.UTC)
+		assert.True(t, rule.Next(time.Date(2025, 3, 1, 9, 15, 0, 0, time.UTC)).IsZero())
+	})
+
+	t.Run("ends at", func(t *testing.T) {
+		rule := mustParse(t, "FREQ=DAILY", start, time.UTC)
+		endsAt := time.Date(2025, 1, 2, 23, 59, 0, 0, time.UTC)
+		assert.Len(t, Occurrences(rule, start.Add(-time.Second), &endsAt, 10), 2)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, expr := range []string{"FREQ=HOURLY", "INTERVAL=2", "FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;BYDAY=1MO",
+			"FREQ=DAILY;COUNT=2;UNTIL=20250101", "FREQ=WEEKLY;BYMONTHDAY=1", "FREQ=DAILY;BYHOUR=24", "FREQ=DAILY;FOO=1"} {
+			_, err := ParseRule(expr, start, time.UTC)
+			assert.Error(t, err, expr)
+		}
+	})
+}
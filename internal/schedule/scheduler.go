@@ -0,0 +1,152 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+)
+
+// taskNamespace derives the IDs of generated tasks, see TaskID
+var taskNamespace = uuid.MustParse("6f1c2a52-8d0e-4c4b-9a55-3c1f0e7b2d90")
+
+// TaskID returns the ID of the task generated for an occurrence of a
+// schedule. It is deterministic, so materializing an occurrence twice, after
+// a restart or from a second server, hits the primary key instead of
+// creating a duplicate task.
+func TaskID(scheduleID int64, occurrence time.Time) string {
+	return uuid.NewSHA1(taskNamespace, []byte(fmt.Sprintf("schedule/%d/%d", scheduleID, occurrence.Unix()))).String()
+}
+
+// Scheduler materializes the upcoming occurrences of active schedules as scheduled tasks
+type Scheduler struct {
+	schedules repository.ScheduleRepository
+	tasks     repository.TaskRepository
+	logger    *logger.Logger
+	now       func() time.Time
+
+	// Horizon is how far ahead occurrences are turned into tasks
+	Horizon time.Duration
+	// MaxPerRun caps the tasks created for one schedule per run, the rest
+	// follow on the next runs
+	MaxPerRun int
+}
+
+// NewScheduler creates a Scheduler that plans a week ahead
+func NewScheduler(schedules repository.ScheduleRepository, tasks repository.TaskRepository, logger *logger.Logger) *Scheduler {
+	return &Scheduler{
+		schedules: schedules,
+		tasks:     tasks,
+		logger:    logger,
+		now:       time.Now,
+		Horizon:   7 * 24 * time.Hour,
+		MaxPerRun: 100,
+	}
+}
+
+// Start materializes due occurrences every interval until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.LogError(err, "Failed to materialize scheduled tasks")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce materializes the occurrences of every active schedule up to the
+// horizon and returns the number of tasks created
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	schedules, err := s.schedules.ListActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	var errs []error
+	for _, schedule := range schedules {
+		n, err := s.materialize(ctx, schedule)
+		created += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", schedule.ID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return created, fmt.Errorf("%d of %d schedules failed: %w", len(errs), len(schedules), errs[0])
+	}
+	return created, nil
+}
+
+// materialize creates the tasks of one schedule and then records how far it
+// got. A crash in between only repeats task creations, which are idempotent.
+func (s *Scheduler) materialize(ctx context.Context, schedule models.Schedule) (int, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return 0, err
+	}
+	rule, err := ParseRule(schedule.Rule, schedule.StartsAt, loc)
+	if err != nil {
+		return 0, err
+	}
+
+	until := s.now().Add(s.Horizon)
+	if schedule.EndsAt != nil && schedule.EndsAt.Before(until) {
+		until = *schedule.EndsAt
+	}
+
+	created := 0
+	reached := schedule.MaterializedUntil
+	for _, occurrence := range Occurrences(rule, reached, &until, s.MaxPerRun) {
+		task := models.Task{
+			ID:           TaskID(schedule.ID, occurrence),
+			TechnicianID: schedule.TechnicianID,
+			AssetID:      schedule.AssetID,
+			Summary:      schedule.Summary,
+			PerformedAt:  occurrence.UTC(),
+			Status:       models.StatusScheduled,
+		}
+		// The task.created event is attributed to the author of the schedule
+		err := s.tasks.Create(ctx, &task, schedule.CreatedBy)
+		if err == nil {
+			created++
+		} else if !errors.Is(err, repository.ErrDuplicate) {
+			// Keep what was created so far, the rest is retried on the next run
+			if advanceErr := s.advance(ctx, schedule, reached); advanceErr != nil {
+				return created, advanceErr
+			}
+			return created, err
+		}
+		reached = occurrence
+	}
+
+	if created > 0 {
+		s.logger.LogInfo("Schedule %d: created %d tasks up to %s", schedule.ID, created, reached.UTC().Format(time.RFC3339))
+	}
+	return created, s.advance(ctx, schedule, reached)
+}
+
+// advance records reached as materialized. Losing the race to another
+// scheduler is fine, it created the same tasks.
+func (s *Scheduler) advance(ctx context.Context, schedule models.Schedule, reached time.Time) error {
+	if !reached.After(schedule.MaterializedUntil) {
+		return nil
+	}
+	err := s.schedules.Advance(ctx, schedule.ID, schedule.MaterializedUntil, reached)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/logger"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	tech := models.User{Username: "tech1", Role: models.RoleTechnician}
+	assert.NoError(t, users.Create(ctx, &tech))
+
+	tasks := repository.NewMemoryTaskRepository(users)
+	schedules := repository.NewMemoryScheduleRepository(users)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	newScheduler := func() *Scheduler {
+		scheduler := NewScheduler(schedules, tasks, logger.New())
+		scheduler.now = func() time.Time { return now }
+		scheduler.Horizon = 7 * 24 * time.Hour
+		return scheduler
+	}
+
+	assetID := int64(3)
+	daily := models.Schedule{
+		Summary: "Check the boiler pressure", Rule: "0 8 * * *", Timezone: "UTC",
+		TechnicianID: int64(tech.ID), AssetID: &assetID, StartsAt: now, Active: true, MaterializedUntil: now,
+	}
+	assert.NoError(t, schedules.Create(ctx, &daily))
+
+	paused := models.Schedule{
+		Summary: "Paused", Rule: "0 * * * *", Timezone: "UTC",
+		TechnicianID: int64(tech.ID), StartsAt: now, MaterializedUntil: now,
+	}
+	assert.NoError(t, schedules.Create(ctx, &paused))
+
+	t.Run("materializes the occurrences within the horizon", func(t *testing.T) {
+		created, err := newScheduler().RunOnce(ctx)
+		assert.NoError(t, err)
+		// 2025-01-02 through 2025-01-08 at 08:00
+		assert.Equal(t, 7, created)
+
+		page, err := tasks.List(ctx, repository.TaskFilter{Sort: repository.SortPerformedAtAsc})
+		assert.NoError(t, err)
+		if assert.Len(t, page.Tasks, 7) {
+			first := page.Tasks[0]
+			assert.Equal(t, TaskID(daily.ID, time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC)), first.ID)
+			assert.Equal(t, models.StatusScheduled, first.Status)
+			assert.Equal(t, "Check the boiler pressure", first.Summary)
+			assert.Equal(t, &assetID, first.AssetID)
+		}
+		assert.Equal(t, 0, tasks.Outbox().Pending(models.OutboxNotifications), "scheduled tasks do not notify managers")
+
+		stored, _ := schedules.Get(ctx, daily.ID)
+		assert.Equal(t, time.Date(2025, 1, 8, 8, 0, 0, 0, time.UTC), stored.MaterializedUntil)
+	})
+
+	t.Run("running again creates nothing", func(t *testing.T) {
+		created, err := newScheduler().RunOnce(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, created)
+	})
+
+	t.Run("a restart before recording progress does not duplicate tasks", func(t *testing.T) {
+		// Simulate a crash after creating the tasks but before Advance
+		stored, _ := schedules.Get(ctx, daily.ID)
+		assert.NoError(t, schedules.Advance(ctx, daily.ID, stored.MaterializedUntil, now))
+
+		now = now.Add(24 * time.Hour)
+		created, err := newScheduler().RunOnce(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, created, "only the newly reached day")
+
+		page, err := tasks.List(ctx, repository.TaskFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Tasks, 8)
+	})
+
+	t.Run("stops at the end of the schedule", func(t *testing.T) {
+		endsAt := now.Add(48 * time.Hour)
+		ending := models.Schedule{
+			Summary: "Ends soon", Rule: "FREQ=DAILY;BYHOUR=18;BYMINUTE=0", Timezone: "Europe/Berlin",
+			TechnicianID: int64(tech.ID), StartsAt: now, EndsAt: &endsAt, Active: true, MaterializedUntil: now,
+		}
+		assert.NoError(t, schedules.Create(ctx, &ending))
+
+		created, err := newScheduler().RunOnce(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, created)
+	})
+
+	t.Run("an invalid schedule does not block the others", func(t *testing.T) {
+		broken := models.Schedule{Summary: "Broken", Rule: "0 8 * * *", Timezone: "Mars/Olympus",
+			TechnicianID: int64(tech.ID), StartsAt: now, Active: true, MaterializedUntil: now}
+		assert.NoError(t, schedules.Create(ctx, &broken))
+
+		now = now.Add(24 * time.Hour)
+		created, err := newScheduler().RunOnce(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 1, created)
+	})
+}
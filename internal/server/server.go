@@ -8,32 +8,42 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/makcim392/maintenance-api/internal/config"
 	"github.com/makcim392/maintenance-api/internal/health"
 	"github.com/makcim392/maintenance-api/internal/logger"
 )
 
 // Server wraps the HTTP server with graceful shutdown capabilities
 type Server struct {
-	httpServer *http.Server
-	logger     *logger.Logger
-	health     *health.HealthChecker
+	httpServer      *http.Server
+	logger          *logger.Logger
+	health          *health.HealthChecker
+	background      []func(ctx context.Context)
+	shutdownTimeout time.Duration
 }
 
-// New creates a new server instance
-func New(addr string, handler http.Handler, logger *logger.Logger, healthChecker *health.HealthChecker) *Server {
+// New creates a new server instance listening on the configured port
+func New(cfg config.Server, handler http.Handler, logger *logger.Logger, healthChecker *health.HealthChecker) *Server {
 	return &Server{
 		httpServer: &http.Server{
-			Addr:         addr,
+			Addr:         cfg.Addr(),
 			Handler:      handler,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
 		},
-		logger: logger,
-		health: healthChecker,
+		logger:          logger,
+		health:          healthChecker,
+		shutdownTimeout: cfg.ShutdownTimeout,
 	}
 }
 
+// RunInBackground registers a worker that runs alongside the background health
+// checks while the server is up. The worker must return once ctx is cancelled.
+func (s *Server) RunInBackground(worker func(ctx context.Context)) {
+	s.background = append(s.background, worker)
+}
+
 // Start starts the server with graceful shutdown
 func (s *Server) Start() error {
 	// Create a context that listens for interrupt signal
@@ -53,13 +63,18 @@ func (s *Server) Start() error {
 		s.health.StartBackgroundChecks(ctx, 30*time.Second)
 	}()
 
+	// Start registered background workers
+	for _, worker := range s.background {
+		go worker(ctx)
+	}
+
 	// Wait for interrupt signal
 	<-ctx.Done()
 
 	s.logger.LogInfo("Shutting down server...")
 
 	// Create a context with timeout for graceful shutdown
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 
 	// Shutdown server gracefully
@@ -0,0 +1,24 @@
+// Package tenant carries the organization a request is served for.
+//
+// The auth middleware stores the organization of the authenticated user in
+// the request context and the repositories limit every query on tenant data,
+// users and the tasks they perform among them, to that organization. Code
+// running outside of a request, such as the notification dispatcher, the
+// scheduler or the command line, has no organization and sees every tenant.
+package tenant
+
+import "context"
+
+type contextKey struct{}
+
+// WithOrganization returns a copy of ctx scoped to the organization
+func WithOrganization(ctx context.Context, organizationID int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// Organization returns the organization ctx is scoped to, false when it is
+// not scoped to any
+func Organization(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(contextKey{}).(int64)
+	return id, ok && id != 0
+}
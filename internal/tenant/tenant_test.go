@@ -0,0 +1,21 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganization(t *testing.T) {
+	_, ok := Organization(context.Background())
+	assert.False(t, ok)
+
+	id, ok := Organization(WithOrganization(context.Background(), 7))
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), id)
+
+	// The zero ID is no organization
+	_, ok = Organization(WithOrganization(context.Background(), 0))
+	assert.False(t, ok)
+}
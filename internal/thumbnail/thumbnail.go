@@ -0,0 +1,112 @@
+// Package thumbnail renders small JPEG previews of JPEG, PNG and GIF images
+// with the standard library decoders.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+)
+
+// MaxPixels bounds the size of the images Generate decodes, so a small file
+// declaring huge dimensions can not exhaust the memory. A decoded image takes
+// up to 4 bytes a pixel, 64MB at the limit.
+const MaxPixels = 16_000_000
+
+// ErrTooLarge is returned by Generate for images of more than MaxPixels pixels
+var ErrTooLarge = errors.New("image too large for a thumbnail")
+
+// Supported reports whether Generate can decode images of the content type
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Generate decodes the image read from r, the first frame of an animated
+// GIF, and returns a JPEG fitting in size x size pixels. Smaller images keep
+// their size and transparent areas are rendered white.
+func Generate(r io.ReadSeeker, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, errors.New("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, downscale(src, size), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// downscale renders an image over a white background, shrunk to fit in size
+// x size pixels, every pixel of the result averaging the source pixels it
+// covers. The source is converted one band of rows at a time, so no full size
+// copy of it is made.
+func downscale(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if width > size || height > size {
+		dstWidth, dstHeight = size, size
+		if width > height {
+			dstHeight = max(1, height*size/width)
+		} else {
+			dstWidth = max(1, width*size/height)
+		}
+	}
+
+	white := image.NewUniform(color.White)
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	band := image.NewRGBA(image.Rect(0, 0, width, (height+dstHeight-1)/dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, (y+1)*height/dstHeight
+		rows := image.Rect(0, 0, width, y1-y0)
+		draw.Draw(band, rows, white, image.Point{}, draw.Src)
+		draw.Draw(band, rows, src, image.Pt(bounds.Min.X, bounds.Min.Y+y0), draw.Over)
+
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, (x+1)*width/dstWidth
+
+			var r, g, b, n int
+			for sy := 0; sy < y1-y0; sy++ {
+				row := band.Pix[sy*band.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
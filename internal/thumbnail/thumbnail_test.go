@@ -0,0 +1,105 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodePNG returns a PNG of the given size, left half red and right half
+// transparent
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width/2; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("large images are scaled down keeping the aspect ratio", func(t *testing.T) {
+		thumb, err := Generate(bytes.NewReader(encodePNG(t, 1000, 500)), 256)
+		assert.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(thumb))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, 256, 128), img.Bounds())
+
+			// Transparent areas become white
+			r, g, b, _ := img.At(10, 64).RGBA()
+			assert.Greater(t, r>>8, uint32(200))
+			assert.Less(t, g>>8, uint32(60))
+			assert.Less(t, b>>8, uint32(60))
+			r, g, b, _ = img.At(245, 64).RGBA()
+			assert.Greater(t, r>>8, uint32(240))
+			assert.Greater(t, g>>8, uint32(240))
+			assert.Greater(t, b>>8, uint32(240))
+		}
+	})
+
+	t.Run("small images keep their size", func(t *testing.T) {
+		thumb, err := Generate(bytes.NewReader(encodePNG(t, 40, 100)), 256)
+		assert.NoError(t, err)
+		config, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 40, config.Width)
+		assert.Equal(t, 100, config.Height)
+	})
+
+	t.Run("huge images are refused before decoding", func(t *testing.T) {
+		// Only the header of this PNG is valid, Generate must not decode the rest
+		header := encodePNG(t, 1, 1)[:33]
+		header[16], header[17], header[18], header[19] = 0, 0, 0x40, 0 // width 16384
+		header[20], header[21], header[22], header[23] = 0, 0, 0x40, 0 // height 16384
+		binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+		_, err := Generate(bytes.NewReader(header), 256)
+		assert.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("images of more than 16 megapixels are refused", func(t *testing.T) {
+		header := encodePNG(t, 1, 1)[:33]
+		binary.BigEndian.PutUint32(header[16:], 5000)
+		binary.BigEndian.PutUint32(header[20:], 4000)
+		binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+		_, err := Generate(bytes.NewReader(header), 256)
+		assert.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("images not starting at the origin are scaled from their bounds", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+		for y := 0; y < 200; y++ {
+			for x := 100; x < 200; x++ {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+		// Only the right half is blue, the left half would render white
+		thumb := downscale(img.SubImage(image.Rect(100, 50, 200, 150)), 10)
+		assert.Equal(t, image.Rect(0, 0, 10, 10), thumb.Bounds())
+		assert.Equal(t, color.RGBA{B: 255, A: 255}, thumb.RGBAAt(0, 0))
+		assert.Equal(t, color.RGBA{B: 255, A: 255}, thumb.RGBAAt(9, 9))
+	})
+
+	t.Run("corrupt images", func(t *testing.T) {
+		_, err := Generate(bytes.NewReader([]byte("%PDF-1.7")), 256)
+		assert.Error(t, err)
+	})
+
+	assert.True(t, Supported("image/png"))
+	assert.False(t, Supported("image/webp"))
+	assert.False(t, Supported("application/pdf"))
+}
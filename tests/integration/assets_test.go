@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssetMaintenanceHistory(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	managerToken := registerAndLogin(t, server, models.User{Username: "asset_manager", Password: "copper kettle 42", Role: models.RoleManager})
+	techToken := registerAndLogin(t, server, models.User{Username: "asset_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+	server.AddTeam(t, "Pump crew", "asset_manager", "asset_tech")
+
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/assets", managerToken, models.Asset{
+		SerialNumber: "PUMP-0002", Type: "pump", Location: "Plant 1", InstallDate: "2021-03-15",
+		Metadata: map[string]string{"vendor": "Acme"},
+	})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var asset models.Asset
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &asset))
+
+	t.Run("technician cannot register assets", func(t *testing.T) {
+		rr := do("POST", "/assets", techToken, models.Asset{SerialNumber: "PUMP-0003", Type: "pump"})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("task on an unknown asset is rejected", func(t *testing.T) {
+		unknown := int64(999999)
+		rr := do("POST", "/tasks", techToken, models.Task{Summary: "Nothing", PerformedAt: time.Now(), AssetID: &unknown})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("history lists the tasks performed on the asset", func(t *testing.T) {
+		rr := do("POST", "/tasks", techToken, models.Task{Summary: "Replaced the seal", PerformedAt: time.Now(), AssetID: &asset.ID})
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		rr = do("POST", "/tasks", techToken, models.Task{Summary: "Unrelated", PerformedAt: time.Now()})
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = do("GET", fmt.Sprintf("/assets/%d/tasks", asset.ID), managerToken, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var page struct {
+			Tasks []models.TaskWithTechnician `json:"tasks"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		if assert.Len(t, page.Tasks, 1) {
+			assert.Equal(t, "Replaced the seal", page.Tasks[0].Summary)
+			assert.Equal(t, asset.ID, *page.Tasks[0].AssetID)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskAttachments(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.Cleanup()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	technician := models.User{Username: "pat_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	other := models.User{Username: "sam_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	techToken := registerAndLogin(t, server, technician)
+	otherToken := registerAndLogin(t, server, other)
+
+	var techID int64
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = ?", technician.Username).Scan(&techID))
+	taskID := uuid.New().String()
+	_, err := server.DB.Exec("INSERT INTO tasks (id, summary, performed_at, technician_id) VALUES (?, ?, ?, ?)",
+		taskID, "Replace the pump seal", time.Now().Format("2006-01-02 15:04:05"), techID)
+	assert.NoError(t, err)
+
+	photo := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for x := 0; x < 640; x++ {
+		for y := 0; y < 480; y++ {
+			photo.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 90, A: 255})
+		}
+	}
+	var photoPNG bytes.Buffer
+	assert.NoError(t, png.Encode(&photoPNG, photo))
+
+	serve := func(req *http.Request, token string) *httptest.ResponseRecorder {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	upload := func(token, fileName string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", fileName)
+		assert.NoError(t, err)
+		_, err = part.Write(content)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/tasks/"+taskID+"/attachments", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return serve(req, token)
+	}
+
+	rr := upload(techToken, "before.png", photoPNG.Bytes())
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var attachment handlers.AttachmentResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &attachment))
+
+	t.Run("the photo and its thumbnail are stored in the bucket", func(t *testing.T) {
+		assert.Equal(t, "image/png", attachment.ContentType)
+		assert.Equal(t, int64(photoPNG.Len()), attachment.Size)
+		assert.NotEmpty(t, attachment.ThumbnailURL)
+
+		var storageKey, thumbnailKey string
+		err := server.DB.QueryRow("SELECT storage_key, thumbnail_key FROM task_attachments WHERE id = ?", attachment.ID).
+			Scan(&storageKey, &thumbnailKey)
+		assert.NoError(t, err)
+		object, ok := server.Blobs.Object(storageKey)
+		if assert.True(t, ok) {
+			assert.Equal(t, photoPNG.Bytes(), object.Content)
+		}
+		_, ok = server.Blobs.Object(thumbnailKey)
+		assert.True(t, ok)
+	})
+
+	t.Run("signed links download without a token", func(t *testing.T) {
+		rr := serve(httptest.NewRequest(http.MethodGet, attachment.DownloadURL, nil), "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		content, err := io.ReadAll(rr.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, photoPNG.Bytes(), content)
+
+		rr = serve(httptest.NewRequest(http.MethodGet, attachment.ThumbnailURL, nil), "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+
+		tampered := "/tasks/" + taskID + "/attachments/" + attachment.ID + "/content?expires=4102444800&signature=AAAA"
+		assert.Equal(t, http.StatusForbidden, serve(httptest.NewRequest(http.MethodGet, tampered, nil), "").Code)
+	})
+
+	t.Run("other technicians do not see the attachments", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/tasks/"+taskID+"/attachments", nil)
+		assert.Equal(t, http.StatusNotFound, serve(req, otherToken).Code)
+		assert.Equal(t, http.StatusNotFound, upload(otherToken, "after.png", photoPNG.Bytes()).Code)
+	})
+
+	t.Run("deleting the task queues its blobs for deletion", func(t *testing.T) {
+		assert.NoError(t, repository.NewMySQLTaskRepository(server.DB).Delete(context.Background(), taskID, 1))
+
+		var count int
+		assert.NoError(t, server.DB.QueryRow("SELECT COUNT(*) FROM task_attachments WHERE task_id = ?", taskID).Scan(&count))
+		assert.Equal(t, 0, count)
+
+		pending, err := repository.NewMySQLAttachmentRepository(server.DB).PendingBlobDeletions(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+	})
+}
@@ -0,0 +1,612 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/encryption"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenRefreshAndLogout(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	user := models.User{Username: "token_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	registerAndLogin(t, server, user)
+
+	post := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest("POST", path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	listTasks := func(token string) int {
+		req := httptest.NewRequest("GET", "/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	login := func() handlers.TokenResponse {
+		rr := post("/login", "", map[string]string{"username": user.Username, "password": user.Password})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var tokens handlers.TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+		return tokens
+	}
+
+	t.Run("refresh token reuse revokes the family", func(t *testing.T) {
+		first := login()
+
+		rr := post("/token/refresh", "", handlers.RefreshRequest{RefreshToken: first.RefreshToken})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var rotated handlers.TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rotated))
+		assert.Equal(t, http.StatusOK, listTasks(rotated.Token))
+
+		rr = post("/token/refresh", "", handlers.RefreshRequest{RefreshToken: first.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, listTasks(rotated.Token))
+		rr = post("/token/refresh", "", handlers.RefreshRequest{RefreshToken: rotated.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("logout revokes the session", func(t *testing.T) {
+		tokens := login()
+		assert.Equal(t, http.StatusOK, listTasks(tokens.Token))
+
+		rr := post("/logout", tokens.Token, handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, listTasks(tokens.Token))
+		rr = post("/token/refresh", "", handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestDeactivateUser(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	// Admins can not register, the first one is promoted directly
+	registerAndLogin(t, server, models.User{Username: "first_admin", Password: "copper kettle 42", Role: models.RoleManager})
+	_, err := server.DB.Exec("UPDATE users SET role = 'admin' WHERE username = 'first_admin'")
+	assert.NoError(t, err)
+	managerToken := registerAndLogin(t, server, models.User{Username: "some_manager", Password: "copper kettle 42", Role: models.RoleManager})
+	techToken := registerAndLogin(t, server, models.User{Username: "leaving_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A manager token does not carry user:manage
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/users", managerToken).Code)
+
+	var adminID, techID int
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = 'first_admin'").Scan(&adminID))
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = 'leaving_tech'").Scan(&techID))
+
+	userJSON, _ := json.Marshal(map[string]string{"username": "first_admin", "password": "copper kettle 42"})
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(userJSON)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var tokens handlers.TokenResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+
+	rr = serve("GET", "/users", tokens.Token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var users []models.User
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &users))
+	assert.Len(t, users, 3)
+
+	rr = serve("POST", fmt.Sprintf("/users/%d/deactivate", techID), tokens.Token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/tasks", techToken).Code)
+
+	rr = serve("POST", fmt.Sprintf("/users/%d/deactivate", adminID), tokens.Token)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSessions(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	registerAndLogin(t, server, models.User{Username: "session_admin", Password: "copper kettle 42", Role: models.RoleManager})
+	_, err := server.DB.Exec("UPDATE users SET role = 'admin' WHERE username = 'session_admin'")
+	assert.NoError(t, err)
+	user := models.User{Username: "session_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	registerAndLogin(t, server, user)
+
+	serve := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("User-Agent", "integration-test")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func(username, deviceName string) handlers.TokenResponse {
+		rr := serve("POST", "/login", "", map[string]string{"username": username, "password": "copper kettle 42", "device_name": deviceName})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var tokens handlers.TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+		return tokens
+	}
+	listSessions := func(token string) []handlers.SessionResponse {
+		rr := serve("GET", "/me/sessions", token, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var sessions []handlers.SessionResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sessions))
+		return sessions
+	}
+
+	laptop := login(user.Username, "Laptop")
+	phone := login(user.Username, "Phone")
+
+	// registerAndLogin started a session too
+	sessions := listSessions(laptop.Token)
+	assert.Len(t, sessions, 3)
+	var phoneID string
+	for _, session := range sessions {
+		assert.Equal(t, session.DeviceName == "Laptop", session.Current)
+		if session.DeviceName == "Phone" {
+			assert.Equal(t, "integration-test", session.UserAgent)
+			phoneID = session.ID
+		}
+	}
+	assert.NotEmpty(t, phoneID)
+
+	rr := serve("DELETE", "/me/sessions/"+phoneID, laptop.Token, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/tasks", phone.Token, nil).Code)
+	rr = serve("POST", "/token/refresh", "", handlers.RefreshRequest{RefreshToken: phone.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Len(t, listSessions(laptop.Token), 2)
+
+	// An admin signs the user out everywhere
+	var techID int
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = 'session_tech'").Scan(&techID))
+	admin := login("session_admin", "")
+	rr = serve("POST", fmt.Sprintf("/users/%d/sign-out", techID), admin.Token, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/tasks", laptop.Token, nil).Code)
+	var open int
+	assert.NoError(t, server.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ? AND revoked_at IS NULL", techID).Scan(&open))
+	assert.Zero(t, open)
+	assert.Equal(t, http.StatusOK, serve("GET", "/tasks", admin.Token, nil).Code)
+}
+
+func TestInvitations(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	managerToken := registerAndLogin(t, server, models.User{Username: "inviting_manager", Password: "copper kettle 42", Role: models.RoleManager})
+	techToken := registerAndLogin(t, server, models.User{Username: "inviting_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+
+	serve := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	invite := func(token string) handlers.InvitationResponse {
+		rr := serve("POST", "/invitations", token, map[string]string{"email": "invited@example.com", "role": "manager"})
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var invitation handlers.InvitationResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &invitation))
+		return invitation
+	}
+
+	// Self registration as a manager is closed
+	rr := serve("POST", "/register", "", map[string]string{"username": "self_made", "password": "copper kettle 42", "role": "manager"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Technicians can not invite
+	rr = serve("POST", "/invitations", techToken, map[string]string{"email": "invited@example.com", "role": "manager"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	t.Run("invitation registers once with its role", func(t *testing.T) {
+		invitation := invite(managerToken)
+
+		register := map[string]string{"username": "invited_manager", "password": "copper kettle 42", "role": "technician",
+			"invitation_token": invitation.Token}
+		rr := serve("POST", "/register", "", register)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var role, email string
+		assert.NoError(t, server.DB.QueryRow("SELECT role, email FROM users WHERE username = 'invited_manager'").Scan(&role, &email))
+		assert.Equal(t, "manager", role)
+		assert.Equal(t, "invited@example.com", email)
+
+		register["username"] = "second_use"
+		rr = serve("POST", "/register", "", register)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("revoked invitation", func(t *testing.T) {
+		invitation := invite(managerToken)
+
+		rr := serve("DELETE", fmt.Sprintf("/invitations/%d", invitation.ID), managerToken, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve("POST", "/register", "", map[string]string{"username": "revoked_invitee", "password": "copper kettle 42",
+			"invitation_token": invitation.Token})
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	registerAndLogin(t, server, models.User{Username: "lock_admin", Password: "copper kettle 42", Role: models.RoleManager})
+	_, err := server.DB.Exec("UPDATE users SET role = 'admin' WHERE username = 'lock_admin'")
+	assert.NoError(t, err)
+	registerAndLogin(t, server, models.User{Username: "locked_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+		req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.RemoteAddr = "198.51.100.7:5000"
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("locked_tech", "wrong-password").Code)
+	}
+	rr := login("locked_tech", "copper kettle 42")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	rr = login("lock_admin", "copper kettle 42")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var tokens handlers.TokenResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+
+	var techID int
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = 'locked_tech'").Scan(&techID))
+	req := httptest.NewRequest("POST", fmt.Sprintf("/users/%d/unlock", techID), nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Token)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, http.StatusOK, login("locked_tech", "copper kettle 42").Code)
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	token := registerAndLogin(t, server, models.User{Username: "mfa_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+	post := func(path, bearer string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(payload))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("/me/mfa/totp", token, nil)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var enrollment handlers.TOTPEnrollmentResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+
+	step := auth.TOTPStep(time.Now())
+	code, err := auth.TOTPCode(enrollment.Secret, step)
+	assert.NoError(t, err)
+	rr = post("/me/mfa/totp/verify", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var recovery handlers.RecoveryCodesResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &recovery))
+	assert.Len(t, recovery.RecoveryCodes, auth.RecoveryCodeCount)
+
+	rr = post("/login", "", map[string]string{"username": "mfa_tech", "password": "copper kettle 42"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var challenge handlers.MFAChallengeResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+	assert.True(t, challenge.MFARequired)
+
+	// The code used to confirm the enrollment can not be used again
+	rr = post("/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	next, err := auth.TOTPCode(enrollment.Secret, step+1)
+	assert.NoError(t, err)
+	rr = post("/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "code": next})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = post("/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "recovery_code": recovery.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = post("/login/mfa", "", map[string]string{"mfa_token": challenge.MFAToken, "recovery_code": recovery.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLoginWithTOTPAfterKeyRotation(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	ctx := context.Background()
+	oldKey := bytes.Repeat([]byte{1}, encryption.KeySize)
+	newKey := bytes.Repeat([]byte{2}, encryption.KeySize)
+	keyring := func(primary string, keys map[string][]byte) *encryption.Keyring {
+		keyring, err := encryption.NewKeyring(primary, keys)
+		if err != nil {
+			t.Fatalf("Failed to create keyring: %v", err)
+		}
+		return keyring
+	}
+
+	registerAndLogin(t, server, models.User{Username: "rotated_tech", Password: "copper kettle 42", Role: models.RoleTechnician})
+	var userID uint
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = 'rotated_tech'").Scan(&userID))
+
+	secret, err := auth.NewTOTPSecret()
+	assert.NoError(t, err)
+	mfa := repository.NewMySQLMFARepository(server.DB, keyring("old", map[string][]byte{"old": oldKey}))
+	assert.NoError(t, mfa.StartTOTP(ctx, &models.TOTPEnrollment{UserID: userID, Secret: secret}))
+	assert.NoError(t, mfa.ConfirmTOTP(ctx, userID, 0, nil))
+
+	// Rotate to the new key, then drop the old one
+	rotated, err := repository.NewMySQLMFARepository(server.DB, keyring("new", map[string][]byte{"old": oldKey, "new": newKey})).
+		RotateSecretKeys(ctx, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rotated)
+
+	users := repository.NewMySQLUserRepository(server.DB)
+	handler := handlers.NewAuthHandler(users, repository.NewMySQLTokenRepository(server.DB),
+		repository.NewMySQLInvitationRepository(server.DB), server.Keys)
+	handler.MFA = repository.NewMySQLMFARepository(server.DB, keyring("new", map[string][]byte{"new": newKey}))
+	post := func(handle http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		handle(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(payload)))
+		return rr
+	}
+
+	rr := post(handler.Login, map[string]string{"username": "rotated_tech", "password": "copper kettle 42"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var challenge handlers.MFAChallengeResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+	assert.True(t, challenge.MFARequired)
+
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	assert.NoError(t, err)
+	rr = post(handler.LoginMFA, map[string]string{"mfa_token": challenge.MFAToken, "code": code})
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestPasswordReset(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, httptest.NewRequest("POST", path, bytes.NewBuffer(payload)))
+		return rr
+	}
+
+	rr := post("/register", map[string]string{"username": "forgetful_tech", "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = post("/register", map[string]string{"username": "forgetful_tech", "password": "copper kettle 42",
+		"email": "forgetful@example.com"})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = post("/password/forgot", map[string]string{"username": "forgetful_tech"})
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	// The token is mailed after the answer
+	assert.Eventually(t, func() bool { return len(server.Mail.Messages()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	messages := server.Mail.Messages()
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	token := regexp.MustCompile(`Reset token: (\S+)`).FindStringSubmatch(messages[0].Body)
+	if !assert.Len(t, token, 2) {
+		return
+	}
+
+	rr = post("/password/reset", map[string]string{"token": token[1], "password": "silver teapot 9"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = post("/password/reset", map[string]string{"token": token[1], "password": "golden ladle 3"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = post("/login", map[string]string{"username": "forgetful_tech", "password": "copper kettle 42"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = post("/login", map[string]string{"username": "forgetful_tech", "password": "silver teapot 9"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	managerToken := registerAndLogin(t, server, models.User{Username: "key_manager", Password: "copper kettle 42", Role: models.RoleManager})
+
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/api-keys", managerToken, `{"name":"reporting","permissions":["task:read:team"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var key handlers.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &key))
+
+	// The key reads tasks but holds no other permission of the manager
+	assert.Equal(t, http.StatusOK, serve("GET", "/tasks", key.Key, "").Code)
+	rr = serve("POST", "/tasks", key.Key, `{"summary":"From an integration","performed_at":"2024-01-01T10:00:00Z"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "task:create")
+
+	// Keys can not manage the account
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/api-keys", key.Key, `{"name":"more","permissions":["task:read:team"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/me/password", key.Key, `{"current_password":"copper kettle 42","new_password":"brass lantern 42"}`).Code)
+
+	var hash string
+	var lastUsed *time.Time
+	assert.NoError(t, server.DB.QueryRow("SELECT key_hash, last_used_at FROM api_keys WHERE id = ?", key.ID).Scan(&hash, &lastUsed))
+	assert.Equal(t, auth.HashAPIKey(key.Key), hash)
+	assert.NotNil(t, lastUsed)
+
+	rr = serve("DELETE", fmt.Sprintf("/api-keys/%d", key.ID), managerToken, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/tasks", key.Key, "").Code)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.DB.Close()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	// login goes to the provider and back with the state cookie, from
+	// /oidc/login or from the authorization URL of a link
+	login := func(start *httptest.ResponseRecorder, authURL string) *httptest.ResponseRecorder {
+		back, err := server.OIDC.Authorize(authURL)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("GET", "/oidc/callback?"+back.RawQuery, nil)
+		for _, cookie := range start.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	oidcLogin := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/oidc/login", nil))
+		assert.Equal(t, http.StatusFound, rr.Code)
+		return login(rr, rr.Header().Get("Location"))
+	}
+	validator := &auth.JWTValidator{Keys: server.Keys}
+	tokens := func(rr *httptest.ResponseRecorder) handlers.TokenResponse {
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response handlers.TokenResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+
+	// The first login provisions a manager from the group of the account
+	server.OIDC.SetUser(map[string]interface{}{"sub": "idp-42", "preferred_username": "oidc_manager",
+		"groups": []string{"maintenance-managers"}})
+	first := tokens(oidcLogin())
+	claims, err := validator.ValidateToken(first.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, string(models.RoleManager), claims.Role)
+
+	var userID uint
+	assert.NoError(t, server.DB.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?",
+		server.OIDC.Issuer(), "idp-42").Scan(&userID))
+	assert.Equal(t, claims.UserID, userID)
+
+	req := httptest.NewRequest("GET", "/tasks", nil)
+	req.Header.Set("Authorization", "Bearer "+first.Token)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The next login finds the same user
+	again, err := validator.ValidateToken(tokens(oidcLogin()).Token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, again.UserID)
+
+	// A local user links another account and logs in with it
+	localToken := registerAndLogin(t, server, models.User{Username: "oidc_local", Password: "copper kettle 42", Role: models.RoleTechnician})
+	req = httptest.NewRequest("POST", "/me/identities/oidc", nil)
+	req.Header.Set("Authorization", "Bearer "+localToken)
+	start := httptest.NewRecorder()
+	server.Router.ServeHTTP(start, req)
+	assert.Equal(t, http.StatusOK, start.Code, start.Body.String())
+	var link map[string]string
+	assert.NoError(t, json.Unmarshal(start.Body.Bytes(), &link))
+	server.OIDC.SetUser(map[string]interface{}{"sub": "idp-43"})
+	assert.Equal(t, http.StatusOK, login(start, link["authorization_url"]).Code)
+
+	local, err := validator.ValidateToken(localToken)
+	assert.NoError(t, err)
+	linked, err := validator.ValidateToken(tokens(oidcLogin()).Token)
+	assert.NoError(t, err)
+	assert.Equal(t, local.UserID, linked.UserID)
+}
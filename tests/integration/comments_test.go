@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskComments(t *testing.T) {
+	server := SetupTestServer(t)
+	defer server.Cleanup()
+
+	if err := server.CleanDB(); err != nil {
+		t.Fatalf("Failed to clean database: %v", err)
+	}
+
+	technician := models.User{Username: "pat_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	other := models.User{Username: "sam_tech", Password: "copper kettle 42", Role: models.RoleTechnician}
+	manager := models.User{Username: "kim_manager", Password: "copper kettle 42", Role: models.RoleManager}
+	techToken := registerAndLogin(t, server, technician)
+	otherToken := registerAndLogin(t, server, other)
+	managerToken := registerAndLogin(t, server, manager)
+	server.AddTeam(t, "Crew", manager.Username, technician.Username)
+
+	var techID int64
+	assert.NoError(t, server.DB.QueryRow("SELECT id FROM users WHERE username = ?", technician.Username).Scan(&techID))
+	taskID := uuid.New().String()
+	_, err := server.DB.Exec("INSERT INTO tasks (id, summary, performed_at, technician_id) VALUES (?, ?, ?, ?)",
+		taskID, "Replace the pump seal", time.Now().Format("2006-01-02 15:04:05"), techID)
+	assert.NoError(t, err)
+
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	comments := "/tasks/" + taskID + "/comments"
+
+	rr := serve(http.MethodPost, comments, managerToken, `{"body":"@pat_tech was the seal replaced? @sam_tech"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var question models.TaskComment
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &question))
+	commentURL := comments + "/" + strconv.FormatInt(question.ID, 10)
+
+	t.Run("mentions of users who can see the task are notified", func(t *testing.T) {
+		assert.Equal(t, manager.Username, question.AuthorName)
+		assert.Equal(t, []int64{techID}, question.Mentions)
+
+		var count int
+		err := server.DB.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE event_type = ? AND payload LIKE ?",
+			models.EventCommentMentioned, "%"+taskID+"%").Scan(&count)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("the technician answers", func(t *testing.T) {
+		rr := serve(http.MethodPost, comments, techToken, `{"body":"Yes, and the gasket too"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = serve(http.MethodGet, comments, techToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list []models.TaskComment
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		assert.Len(t, list, 2)
+	})
+
+	t.Run("other technicians do not see the thread", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, comments, otherToken, "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, comments, otherToken, `{"body":"Hi"}`).Code)
+	})
+
+	t.Run("edits keep the history", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, commentURL, techToken, `{"body":"Changed"}`).Code)
+
+		rr := serve(http.MethodPut, commentURL, managerToken, `{"body":"@pat_tech was the seal replaced?"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve(http.MethodGet, commentURL, techToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response handlers.CommentResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.NotNil(t, response.EditedAt)
+		if assert.Len(t, response.Revisions, 1) {
+			assert.Equal(t, question.Body, response.Revisions[0].Body)
+		}
+	})
+
+	t.Run("comments go with their task", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodDelete, commentURL, managerToken, "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, commentURL, managerToken, "").Code)
+
+		_, err := server.DB.Exec("DELETE FROM tasks WHERE id = ?", taskID)
+		assert.NoError(t, err)
+		var count int
+		assert.NoError(t, server.DB.QueryRow("SELECT COUNT(*) FROM task_comments WHERE task_id = ?", taskID).Scan(&count))
+		assert.Equal(t, 0, count)
+	})
+}
@@ -0,0 +1,92 @@
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/makcim392/maintenance-api/internal/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+// dropAllTables empties the test database so migrations start from scratch
+func dropAllTables(t *testing.T, db *sql.DB) {
+	rows, err := db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()")
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("Failed to scan table name: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+
+	if _, err := db.Exec("SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		t.Fatalf("Failed to disable foreign key checks: %v", err)
+	}
+	for _, table := range tables {
+		if _, err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", table)); err != nil {
+			t.Fatalf("Failed to drop table %s: %v", table, err)
+		}
+	}
+	if _, err := db.Exec("SET FOREIGN_KEY_CHECKS = 1"); err != nil {
+		t.Fatalf("Failed to enable foreign key checks: %v", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	if err := loadTestEnv(); err != nil {
+		t.Fatalf("Failed to load test environment: %v", err)
+	}
+	db, err := setupTestDB()
+	if err != nil {
+		t.Fatalf("Failed to setup test database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	dropAllTables(t, db)
+
+	migrator, err := migrate.New(db)
+	assert.NoError(t, err)
+	total := len(migrator.Migrations())
+
+	t.Run("every migration applies to a fresh database", func(t *testing.T) {
+		applied, err := migrator.Up(ctx, false)
+		assert.NoError(t, err)
+		assert.Len(t, applied, total)
+
+		statuses, err := migrator.Status(ctx)
+		assert.NoError(t, err)
+		for _, status := range statuses {
+			assert.True(t, status.Applied, "migration %d_%s not applied", status.Version, status.Name)
+			assert.False(t, status.Modified)
+		}
+	})
+
+	t.Run("up is idempotent", func(t *testing.T) {
+		applied, err := migrator.Up(ctx, false)
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("schema matches the queries used by the application", func(t *testing.T) {
+		_, err := db.Exec("SELECT id, technician_id, summary, summary_key_id, summary_wrapped_key, performed_at FROM tasks LIMIT 1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("every migration rolls back and re-applies", func(t *testing.T) {
+		rolledBack, err := migrator.Down(ctx, total, false)
+		assert.NoError(t, err)
+		assert.Len(t, rolledBack, total)
+
+		applied, err := migrator.Up(ctx, false)
+		assert.NoError(t, err)
+		assert.Len(t, applied, total)
+	})
+}
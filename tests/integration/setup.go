@@ -12,15 +12,32 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
-	"github.com/makcim392/swordhealth-interviewer/internal/auth"
-	"github.com/makcim392/swordhealth-interviewer/internal/handlers"
-	"github.com/makcim392/swordhealth-interviewer/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/auth"
+	"github.com/makcim392/maintenance-api/internal/authz"
+	"github.com/makcim392/maintenance-api/internal/blob"
+	"github.com/makcim392/maintenance-api/internal/blob/blobtest"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/mail"
+	"github.com/makcim392/maintenance-api/internal/middleware"
+	"github.com/makcim392/maintenance-api/internal/migrate"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/oidc"
+	"github.com/makcim392/maintenance-api/internal/oidc/oidctest"
+	"github.com/makcim392/maintenance-api/internal/repository"
 )
 
 type TestServer struct {
 	DB     *sql.DB
 	Router *mux.Router
 	Server *http.Server
+	// Keys signs the access and invitation tokens of the router
+	Keys *auth.KeySet
+	// Mail keeps the mails sent by the router
+	Mail *mail.MemorySender
+	// OIDC is the OpenID Connect provider /oidc/login sends users to
+	OIDC *oidctest.Provider
+	// Blobs is the S3 compatible service keeping the content of attachments
+	Blobs *blobtest.S3Server
 	// Add cleanup function
 	cleanup func()
 }
@@ -38,8 +55,20 @@ func SetupTestServer(t *testing.T) *TestServer {
 		t.Fatalf("Failed to setup test database: %v", err)
 	}
 
+	// Bring the schema up to date with the migrations compiled into the binary
+	migrator, err := migrate.New(db)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background(), false); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
 	// Setup router and handlers
-	router := setupRouter(db)
+	mailer := &mail.MemorySender{}
+	provider := oidctest.NewProvider("maintenance-api", "integration-secret")
+	blobs := blobtest.NewS3Server("attachments", "integration")
+	router, keys := setupRouter(db, mailer, provider, blobs)
 
 	// Create test server with proper configuration
 	server := &http.Server{
@@ -61,12 +90,18 @@ func SetupTestServer(t *testing.T) *TestServer {
 		if err := db.Close(); err != nil {
 			t.Errorf("Failed to close database connection: %v", err)
 		}
+		provider.Close()
+		blobs.Close()
 	}
 
 	return &TestServer{
 		DB:      db,
 		Router:  router,
 		Server:  server,
+		Keys:    keys,
+		Mail:    mailer,
+		OIDC:    provider,
+		Blobs:   blobs,
 		cleanup: cleanup,
 	}
 }
@@ -126,21 +161,112 @@ func setupTestDB() (*sql.DB, error) {
 	return nil, fmt.Errorf("database not ready after 30 seconds, last error: %v", lastErr)
 }
 
-func setupRouter(db *sql.DB) *mux.Router {
+func setupRouter(db *sql.DB, mailer mail.Sender, provider *oidctest.Provider, blobs *blobtest.S3Server) (*mux.Router, *auth.KeySet) {
 	router := mux.NewRouter()
 
-	taskHandler := handlers.NewTaskHandler(db)
-	authHandler := handlers.NewAuthHandler(db)
-	validator := &auth.JWTValidator{}
-	authMiddleware := middleware.NewAuthMiddlewareHandler(validator)
+	assetRepo := repository.NewMySQLAssetRepository(db)
+	taskRepo := repository.NewMySQLTaskRepository(db)
+	// Use the grants seeded by the migrations
+	authorizer := authz.New(nil)
+	if err := authorizer.Load(context.Background(), repository.NewMySQLPermissionRepository(db)); err != nil {
+		panic(err)
+	}
+	teamRepo := repository.NewMySQLTeamRepository(db)
+	taskHandler := handlers.NewTaskHandler(taskRepo, handlers.WithAssets(assetRepo), handlers.WithAuthorizer(authorizer),
+		handlers.WithTeams(teamRepo))
+	assetHandler := handlers.NewAssetHandler(assetRepo, taskRepo, teamRepo, authorizer)
+	tokenRepo := repository.NewMySQLTokenRepository(db)
+	signingKey, err := auth.GenerateKey("integration")
+	if err != nil {
+		panic(err)
+	}
+	signingKeys, err := auth.NewKeySet(signingKey.ID, signingKey)
+	if err != nil {
+		panic(err)
+	}
+	userRepo := repository.NewMySQLUserRepository(db)
+	commentHandler := handlers.NewCommentHandler(repository.NewMySQLCommentRepository(db), taskRepo, userRepo, teamRepo, authorizer)
+	blobStore, err := blob.NewS3Store(blob.S3Config{Endpoint: blobs.URL, Region: "us-east-1", Bucket: blobs.Bucket,
+		AccessKeyID: blobs.AccessKeyID, SecretAccessKey: "integration-secret", PathStyle: true})
+	if err != nil {
+		panic(err)
+	}
+	attachmentHandler := handlers.NewAttachmentHandler(repository.NewMySQLAttachmentRepository(db), taskRepo, teamRepo, blobStore,
+		authorizer, []byte("integration-url-secret"))
+	authHandler := handlers.NewAuthHandler(userRepo, tokenRepo, repository.NewMySQLInvitationRepository(db), signingKeys)
+	authHandler.OpenRegistration = true
+	authHandler.Organizations = repository.NewMySQLOrganizationRepository(db)
+	attemptRepo := repository.NewMySQLLoginAttemptRepository(db)
+	authHandler.Attempts = attemptRepo
+	mfaRepo := repository.NewMySQLMFARepository(db, nil)
+	authHandler.MFA = mfaRepo
+	userHandler := handlers.NewUserHandler(userRepo, tokenRepo)
+	userHandler.Attempts = attemptRepo
+	mfaHandler := handlers.NewMFAHandler(mfaRepo, userRepo)
+	passwordHandler := handlers.NewPasswordHandler(userRepo, tokenRepo, repository.NewMySQLPasswordResetRepository(db), mailer)
+	passwordHandler.Attempts = attemptRepo
+	invitationHandler := handlers.NewInvitationHandler(repository.NewMySQLInvitationRepository(db), signingKeys, authorizer)
+	apiKeyRepo := repository.NewMySQLAPIKeyRepository(db)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, authorizer)
+	sessionHandler := handlers.NewSessionHandler(tokenRepo)
+	oidcHandler := handlers.NewOIDCHandler(oidc.NewClient(oidc.Config{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  "http://localhost:8081/oidc/callback",
+	}, nil), repository.NewMySQLIdentityRepository(db), userRepo, authHandler)
+	oidcHandler.RoleMapping = map[string]models.Role{"maintenance-managers": models.RoleManager}
+	validator := auth.ValidatorChain{
+		&auth.APIKeyValidator{Keys: apiKeyRepo, Users: userRepo},
+		&auth.JWTValidator{Keys: signingKeys, Revocations: tokenRepo, Sessions: tokenRepo},
+	}
+	authMiddleware := middleware.NewAuthMiddlewareHandler(validator, userRepo)
+	permissions := middleware.NewPermissionMiddleware(authorizer)
 
 	router.HandleFunc("/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods("POST")
 	router.HandleFunc("/register", authHandler.Register).Methods("POST")
-	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(taskHandler.CreateTask)).Methods("POST")
-	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(taskHandler.UpdateTask)).Methods("PUT")
-	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(taskHandler.ListTasks)).Methods("GET")
+	router.HandleFunc("/token/refresh", authHandler.RefreshToken).Methods("POST")
+	router.HandleFunc("/logout", authMiddleware.AuthMiddleware(authHandler.Logout)).Methods("POST")
+	router.HandleFunc("/password/forgot", passwordHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", passwordHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/me/password", authMiddleware.SessionMiddleware(passwordHandler.ChangePassword)).Methods("POST")
+	router.HandleFunc("/me/sessions", authMiddleware.SessionMiddleware(sessionHandler.ListSessions)).Methods("GET")
+	router.HandleFunc("/me/sessions/{id}", authMiddleware.SessionMiddleware(sessionHandler.DeleteSession)).Methods("DELETE")
+	router.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler(signingKeys)).Methods("GET")
+	router.HandleFunc("/oidc/login", oidcHandler.Login).Methods("GET")
+	router.HandleFunc("/oidc/callback", oidcHandler.Callback).Methods("GET")
+	router.HandleFunc("/me/identities/oidc", authMiddleware.SessionMiddleware(oidcHandler.LinkIdentity)).Methods("POST")
+	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskCreate, taskHandler.CreateTask))).Methods("POST")
+	router.HandleFunc("/tasks/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskUpdateOwn, taskHandler.UpdateTask))).Methods("PUT")
+	router.HandleFunc("/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, taskHandler.ListTasks))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/transitions", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskTransitionOwn, taskHandler.TransitionTask))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/transitions", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, taskHandler.ListTransitions))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.CreateComment))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/comments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.ListComments))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.GetComment))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.UpdateComment))).Methods("PUT")
+	router.HandleFunc("/tasks/{id}/comments/{comment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, commentHandler.DeleteComment))).Methods("DELETE")
+	router.HandleFunc("/tasks/{id}/attachments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.UploadAttachment))).Methods("POST")
+	router.HandleFunc("/tasks/{id}/attachments", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.ListAttachments))).Methods("GET")
+	router.HandleFunc("/tasks/{id}/attachments/{attachment_id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, attachmentHandler.DeleteAttachment))).Methods("DELETE")
+	router.HandleFunc("/tasks/{id}/attachments/{attachment_id}/{variant:content|thumbnail}", attachmentHandler.DownloadAttachment).Methods("GET")
 
-	return router
+	router.HandleFunc("/assets", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionAssetManage, assetHandler.CreateAsset))).Methods("POST")
+	router.HandleFunc("/assets/{id}/tasks", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionTaskReadOwn, assetHandler.ListAssetTasks))).Methods("GET")
+
+	router.HandleFunc("/users", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.ListUsers))).Methods("GET")
+	router.HandleFunc("/invitations", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserInvite, invitationHandler.CreateInvitation))).Methods("POST")
+	router.HandleFunc("/invitations/{id}", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserInvite, invitationHandler.RevokeInvitation))).Methods("DELETE")
+	router.HandleFunc("/users/{id}/deactivate", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.DeactivateUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/unlock", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.UnlockUser))).Methods("POST")
+	router.HandleFunc("/users/{id}/sign-out", authMiddleware.AuthMiddleware(permissions.Require(models.PermissionUserManage, userHandler.SignOutUser))).Methods("POST")
+	router.HandleFunc("/api-keys", authMiddleware.SessionMiddleware(permissions.Require(models.PermissionAPIKeyManage, apiKeyHandler.CreateAPIKey))).Methods("POST")
+	router.HandleFunc("/api-keys/{id}", authMiddleware.SessionMiddleware(permissions.Require(models.PermissionAPIKeyManage, apiKeyHandler.RevokeAPIKey))).Methods("DELETE")
+	router.HandleFunc("/me/mfa/totp", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.StartTOTP)).Methods("POST")
+	router.HandleFunc("/me/mfa/totp/verify", authMiddleware.MFAEnrolmentMiddleware(mfaHandler.ConfirmTOTP)).Methods("POST")
+
+	return router, signingKeys
 }
 
 // Helper function to get environment variable with default value
@@ -154,7 +280,8 @@ func getEnvWithDefault(key, defaultValue string) string {
 // CleanDB now returns error instead of failing test
 func (ts *TestServer) CleanDB() error {
 	// Reverse the order - truncate tasks first, then users
-	tables := []string{"tasks", "users"}
+	tables := []string{"blob_deletions", "task_attachments", "task_comment_mentions", "task_comment_revisions", "task_comments", "task_transitions", "tasks", "maintenance_schedules", "assets",
+		"refresh_tokens", "revoked_access_tokens", "sessions", "login_attempts", "password_resets", "recovery_codes", "api_keys", "user_identities", "user_totp", "invitations", "team_members", "teams", "users"}
 	for _, table := range tables {
 		// Temporarily disable foreign key checks before truncating
 		if _, err := ts.DB.Exec("SET FOREIGN_KEY_CHECKS = 0"); err != nil {
@@ -171,9 +298,36 @@ func (ts *TestServer) CleanDB() error {
 			return fmt.Errorf("failed to enable foreign key checks: %w", err)
 		}
 	}
+	// Keep the default organization seeded by the migrations
+	if _, err := ts.DB.Exec("DELETE FROM organizations WHERE id <> ?", models.DefaultOrganizationID); err != nil {
+		return fmt.Errorf("failed to delete organizations: %w", err)
+	}
 	return nil
 }
 
+// AddTeam creates a team managed by the manager with the given members, all
+// referenced by username
+func (ts *TestServer) AddTeam(t *testing.T, name, manager string, members ...string) {
+	t.Helper()
+	result, err := ts.DB.Exec("INSERT INTO teams (organization_id, name) VALUES (?, ?)", models.DefaultOrganizationID, name)
+	if err != nil {
+		t.Fatalf("Failed to create team %s: %v", name, err)
+	}
+	teamID, _ := result.LastInsertId()
+
+	add := func(username, role string) {
+		_, err := ts.DB.Exec(`INSERT INTO team_members (team_id, user_id, role)
+			SELECT ?, id, ? FROM users WHERE username = ?`, teamID, role, username)
+		if err != nil {
+			t.Fatalf("Failed to add %s to team %s: %v", username, name, err)
+		}
+	}
+	add(manager, "manager")
+	for _, member := range members {
+		add(member, "member")
+	}
+}
+
 // Cleanup method to be called in tests
 func (ts *TestServer) Cleanup() {
 	if ts.cleanup != nil {
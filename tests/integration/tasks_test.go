@@ -2,7 +2,9 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,7 +12,9 @@ import (
 
 	"github.com/google/uuid"
 
-	"github.com/makcim392/swordhealth-interviewer/internal/models"
+	"github.com/makcim392/maintenance-api/internal/handlers"
+	"github.com/makcim392/maintenance-api/internal/models"
+	"github.com/makcim392/maintenance-api/internal/repository"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,7 +29,7 @@ func TestTaskCreation(t *testing.T) {
 	// First register a test user
 	user := models.User{
 		Username: "test@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleTechnician,
 	}
 
@@ -62,10 +66,21 @@ func TestTaskCreation(t *testing.T) {
 	})
 }
 
-// Helper function to register and login a user
+// Helper function to register and login a user, roles other than technician
+// register with an invitation
 func registerAndLogin(t *testing.T, server *TestServer, user models.User) string {
+	body := map[string]string{"username": user.Username, "password": user.Password, "role": string(user.Role)}
+	if user.Role != models.RoleTechnician {
+		invitation := models.Invitation{TokenID: uuid.NewString(), Email: user.Username + "@example.com",
+			Role: user.Role, ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+		token, err := server.Keys.IssueInvitationToken(invitation.TokenID, invitation.Email, string(invitation.Role), invitation.ExpiresAt)
+		assert.NoError(t, err)
+		assert.NoError(t, repository.NewMySQLInvitationRepository(server.DB).Create(context.Background(), &invitation))
+		body["invitation_token"] = token
+	}
+
 	// Register
-	userJSON, _ := json.Marshal(user)
+	userJSON, _ := json.Marshal(body)
 	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(userJSON))
 	req.Header.Set("Content-Type", "application/json")
 
@@ -80,10 +95,10 @@ func registerAndLogin(t *testing.T, server *TestServer, user models.User) string
 	loginRR := httptest.NewRecorder()
 	server.Router.ServeHTTP(loginRR, loginReq)
 
-	var response map[string]string
+	var response handlers.TokenResponse
 	json.NewDecoder(loginRR.Body).Decode(&response)
 
-	return response["token"]
+	return response.Token
 }
 
 func TestListTasks(t *testing.T) {
@@ -98,19 +113,20 @@ func TestListTasks(t *testing.T) {
 	// Create test users
 	technician := models.User{
 		Username: "tech@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleTechnician,
 	}
 
 	manager := models.User{
 		Username: "manager@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleManager,
 	}
 
 	// Register and login users
 	techToken := registerAndLogin(t, server, technician)
 	managerToken := registerAndLogin(t, server, manager)
+	server.AddTeam(t, "Crew", manager.Username, technician.Username)
 
 	// Get the technician ID
 	var technicianID int
@@ -160,15 +176,19 @@ func TestListTasks(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		var response []struct {
-			ID           string    `json:"id"`
-			Summary      string    `json:"summary"`
-			PerformedAt  time.Time `json:"performed_at"`
-			TechnicianID int       `json:"technician_id"`
-			Username     string    `json:"technician_name"`
+		var page struct {
+			Tasks []struct {
+				ID           string    `json:"id"`
+				Summary      string    `json:"summary"`
+				PerformedAt  time.Time `json:"performed_at"`
+				TechnicianID int       `json:"technician_id"`
+				Username     string    `json:"technician_name"`
+			} `json:"tasks"`
+			NextCursor string `json:"next_cursor"`
 		}
-		err := json.NewDecoder(rr.Body).Decode(&response)
+		err := json.NewDecoder(rr.Body).Decode(&page)
 		assert.NoError(t, err)
+		response := page.Tasks
 
 		assert.Len(t, response, 2, "Technician should see 2 tasks")
 		for _, task := range response {
@@ -177,7 +197,7 @@ func TestListTasks(t *testing.T) {
 		}
 	})
 
-	t.Run("manager can see all tasks", func(t *testing.T) {
+	t.Run("manager can see the tasks of their team", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
 		req.Header.Set("Authorization", "Bearer "+managerToken)
 
@@ -186,17 +206,52 @@ func TestListTasks(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		var response []struct {
-			ID           string    `json:"id"`
-			Summary      string    `json:"summary"`
-			PerformedAt  time.Time `json:"performed_at"`
-			TechnicianID int       `json:"technician_id"`
-			Username     string    `json:"technician_name"`
+		var page struct {
+			Tasks []struct {
+				ID           string    `json:"id"`
+				Summary      string    `json:"summary"`
+				PerformedAt  time.Time `json:"performed_at"`
+				TechnicianID int       `json:"technician_id"`
+				Username     string    `json:"technician_name"`
+			} `json:"tasks"`
+			NextCursor string `json:"next_cursor"`
 		}
-		err := json.NewDecoder(rr.Body).Decode(&response)
+		err := json.NewDecoder(rr.Body).Decode(&page)
 		assert.NoError(t, err)
+		response := page.Tasks
 
-		assert.Len(t, response, 2, "Manager should see all 2 tasks")
+		assert.Len(t, response, 2, "Manager should see the 2 tasks of their team")
+	})
+
+	t.Run("manager pages through filtered tasks", func(t *testing.T) {
+		url := fmt.Sprintf("/tasks?technician_id=%d&q=task&sort=performed_at&limit=1", technicianID)
+		var seen []string
+		for url != "" {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			req.Header.Set("Authorization", "Bearer "+managerToken)
+
+			rr := httptest.NewRecorder()
+			server.Router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var page struct {
+				Tasks []struct {
+					Summary string `json:"summary"`
+				} `json:"tasks"`
+				NextCursor string `json:"next_cursor"`
+			}
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&page))
+			for _, task := range page.Tasks {
+				seen = append(seen, task.Summary)
+			}
+
+			url = ""
+			if page.NextCursor != "" {
+				url = "/tasks?sort=performed_at&limit=1&q=task&cursor=" + page.NextCursor +
+					fmt.Sprintf("&technician_id=%d", technicianID)
+			}
+		}
+		assert.Equal(t, []string{"Task 1 for testing", "Task 2 for testing"}, seen)
 	})
 
 	t.Run("unauthorized access returns 401", func(t *testing.T) {
@@ -226,19 +281,19 @@ func TestUpdateTask(t *testing.T) {
 	// Create test users
 	technician1 := models.User{
 		Username: "tech1@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleTechnician,
 	}
 
 	technician2 := models.User{
 		Username: "tech2@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleTechnician,
 	}
 
 	manager := models.User{
 		Username: "manager@example.com",
-		Password: "password123",
+		Password: "copper kettle 42",
 		Role:     models.RoleManager,
 	}
 